@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// accountNumberKeys are the JSON fields holding bank account numbers,
+// which responses carry masked
+var accountNumberKeys = map[string]bool{
+	"payout_destination":  true,
+	"settlement_account":  true,
+	"destination_account": true,
+}
+
+// maskAccountNumber hides all but the last four characters of an account
+// number, enough for its holder to tell their accounts apart
+func maskAccountNumber(number string) string {
+	const shown = 4
+	if number == "" {
+		return ""
+	}
+	if len(number) <= shown {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-shown) + number[len(number)-shown:]
+}
+
+// maskAccountNumbers returns data with the account numbers in it masked,
+// as a jsonNode that encodes as data would. A Page stays a Page with its
+// items masked, and data holding none is returned as it is.
+func maskAccountNumbers(data any) any {
+	if page, ok := data.(Page); ok {
+		page.Items = maskAccountNumbers(page.Items)
+		return page
+	}
+	raw, err := json.Marshal(data)
+	if err != nil || !containsAccountNumberKey(raw) {
+		return data
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	node, err := readJSONNode(dec)
+	if err != nil {
+		return data
+	}
+	node.maskAccountNumbers()
+	return node
+}
+
+// containsAccountNumberKey reports whether JSON may hold an account number,
+// so that responses without one are not decoded again
+func containsAccountNumberKey(raw []byte) bool {
+	for key := range accountNumberKeys {
+		if bytes.Contains(raw, []byte(`"`+key+`"`)) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskAccountNumbers masks the strings under accountNumberKeys anywhere in n
+func (n *jsonNode) maskAccountNumbers() {
+	for i, value := range n.values {
+		if n.kind == '{' && value.kind == 's' && accountNumberKeys[n.keys[i]] {
+			value.text = maskAccountNumber(value.text)
+			continue
+		}
+		value.maskAccountNumbers()
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaskAccountNumber(t *testing.T) {
+	for number, want := range map[string]string{
+		"1000123456789": "*********6789",
+		"12345":         "*2345",
+		"1234":          "****",
+		"":              "",
+	} {
+		if got := maskAccountNumber(number); got != want {
+			t.Errorf("maskAccountNumber(%q) = %q, want %q", number, got, want)
+		}
+	}
+}
+
+func TestAccountNumbersMasked(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(82)
+	if w := api.do(http.MethodPut, "/v2/block-account/"+id+"/maturity-instruction",
+		`{"instruction":"payout","destination_account":"1000123456789"}`, "If-Match", api.etag(id)); w.Code != http.StatusOK {
+		t.Fatalf("set payout destination: %d %s", w.Code, w.Body)
+	}
+
+	for _, c := range []struct {
+		name, path, accept string
+	}{
+		{"JSON", "/v2/block-account/" + id, ""},
+		{"bare JSON", "/v2/block-account/" + id, BareMediaType},
+		{"XML", "/v2/block-account/" + id, "application/xml"},
+		{"CSV list", "/v2/user/82/block-accounts", "text/csv"},
+	} {
+		w := api.do(http.MethodGet, c.path, "", "Accept", c.accept)
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "1000123456789") || !strings.Contains(w.Body.String(), "*********6789") {
+			t.Errorf("%s: %d %s, want the destination masked", c.name, w.Code, w.Body)
+		}
+	}
+
+	var query struct {
+		Account struct {
+			PayoutDestination string `json:"payoutDestination"`
+		} `json:"account"`
+	}
+	decodeData(t, api.do(http.MethodPost, GraphQLPath, `{"query":"{ account(id: \"`+id+`\") { payoutDestination } }"}`).Body.Bytes(), &query)
+	if query.Account.PayoutDestination != "*********6789" {
+		t.Errorf("GraphQL payoutDestination = %q, want it masked", query.Account.PayoutDestination)
+	}
+
+	// The service keeps the number itself to pay out to
+	ctx := context.Background()
+	accountID, _ := api.repo.ResolveAccountID(ctx, id)
+	if account, err := api.repo.GetAccount(ctx, accountID); err != nil || account.PayoutDestination != "1000123456789" {
+		t.Errorf("stored account = %+v, %v, want the destination unmasked", account, err)
+	}
+}
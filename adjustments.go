@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Interest adjustment kinds
+const (
+	// AdjustmentRecalculation re-derives the account's rate from the rate
+	// plan and settles the difference on interest already paid
+	AdjustmentRecalculation = "recalculation"
+	// AdjustmentManual credits or debits an amount staff chose
+	AdjustmentManual = "manual"
+)
+
+var (
+	// ErrInterestUpToDate is returned when recalculating an account whose interest already follows the rate plan
+	ErrInterestUpToDate = newAPIError(CodeInterestUpToDate, "interest already follows the rate plan")
+	// ErrNoRatePlan is returned when recalculating an account opened without a period
+	ErrNoRatePlan = newAPIError(CodeNoRatePlan, "block account has no period to take a rate from")
+	// ErrAdjustmentExceedsInterest is returned for a debit larger than the interest still to be paid
+	ErrAdjustmentExceedsInterest = newAPIError(CodeAdjustmentExceedsInterest,
+		"debit exceeds the interest still to be paid; the maturity payout cannot fall below the principal")
+)
+
+// InterestAdjustment is an approved correction to an account's interest
+type InterestAdjustment struct {
+	ID        int
+	AccountID int
+	Kind      string
+	// Amount is credited with the interest at maturity, or debited when
+	// negative
+	Amount float64
+	// PreviousRate and Rate are the account's rate before and after; they
+	// differ only for a recalculation that changed the rate
+	PreviousRate float64
+	Rate         float64
+	Reason       string
+	ApprovalID   int
+	RequestedBy  string
+	ApprovedBy   string
+	CreatedAt    time.Time
+	// ValueDate is when a value-dated adjustment takes effect; CreatedAt is
+	// when it was booked
+	ValueDate *time.Time
+}
+
+// RecalculationPreview is what recalculating an account's interest would
+// change, found by carrying the recalculation out and rolling it back
+// @Description Dry run of an interest recalculation; nothing it shows was kept
+type RecalculationPreview struct {
+	DryRun    bool   `json:"dry_run" example:"true"`
+	AccountID string `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	// Adjustment would be credited with the interest at maturity, or
+	// debited when negative
+	Adjustment   float64 `json:"adjustment" example:"41.10"`
+	PreviousRate float64 `json:"previous_rate" example:"0.005"`
+	Rate         float64 `json:"rate" example:"0.05"`
+	// InterestAdjustment is the account's total adjustment afterwards
+	InterestAdjustment float64 `json:"interest_adjustment" example:"41.10"`
+}
+
+// RecalculateInterestRequest is the payload for recalculating interest
+// @Description Request payload for re-deriving an account's interest from the rate plan
+type RecalculateInterestRequest struct {
+	Reason string `json:"reason" example:"1y rate entered as 0.5% instead of 5%, case 3107" validate:"notblank"`
+	// ValueDate is when the plan's rate takes effect. Interest before it
+	// keeps the account's rate. Defaults to the account's start date.
+	ValueDate *time.Time `json:"value_date,omitempty" example:"2026-03-01T00:00:00Z"`
+}
+
+// AdjustInterestRequest is the payload for a manual interest adjustment
+// @Description Request payload for crediting or debiting an account's interest
+type AdjustInterestRequest struct {
+	// Amount is credited, or debited when negative
+	Amount float64 `json:"amount" example:"12.50" validate:"required"`
+	Reason string  `json:"reason" example:"Goodwill credit for delayed payout, case 3112" validate:"notblank"`
+	// ValueDate is when the credit or debit takes effect, when earlier than
+	// its booking
+	ValueDate *time.Time `json:"value_date,omitempty" example:"2026-03-01T00:00:00Z"`
+}
+
+// planRecalculation re-derives the interest of an account from its tenant's
+// rate plan for its period; interest still to be paid follows the new rate.
+// Without a value date, interest paid so far is recomputed at the plan's
+// rate, and the difference, less what earlier recalculations already
+// settled, becomes the adjustment. With one, the plan's rate applies from
+// the value date only: the adjustment is the difference between the rates
+// from the value date to where the paid interest ends, a debit when the
+// value date falls after it, so the unpaid interest before the value date
+// keeps the old rate.
+func planRecalculation(a *BlockAccount, rates ratePlan, paid []*InterestPayout, prior []*InterestAdjustment, valueDate *time.Time) (*InterestAdjustment, error) {
+	if a.Period == "" {
+		return nil, ErrNoRatePlan
+	}
+	term, err := rates.terms(a.Period)
+	if err != nil {
+		return nil, err
+	}
+	rated := *a
+	rated.InterestRate = term.Rate
+
+	var difference float64
+	switch paidFrom := interestPaidFrom(a); {
+	case valueDate == nil:
+		for _, p := range paid {
+			difference += roundMoney(interestBetween(&rated, p.PeriodStart, p.PeriodEnd)) - p.Amount
+		}
+		for _, adj := range prior {
+			if adj.Kind == AdjustmentRecalculation {
+				difference -= adj.Amount
+			}
+		}
+	case valueDate.Before(paidFrom):
+		difference = interestBetween(&rated, *valueDate, paidFrom) - interestBetween(a, *valueDate, paidFrom)
+	default:
+		difference = interestBetween(a, paidFrom, *valueDate) - interestBetween(&rated, paidFrom, *valueDate)
+	}
+	difference = roundMoney(difference)
+	if difference == 0 && term.Rate == a.InterestRate {
+		return nil, ErrInterestUpToDate
+	}
+	return &InterestAdjustment{
+		AccountID: a.ID, Kind: AdjustmentRecalculation, Amount: difference,
+		PreviousRate: a.InterestRate, Rate: term.Rate, ValueDate: valueDate,
+	}, nil
+}
+
+// checkAdjustment refuses an adjustment that would take the account's
+// maturity payout below its principal
+func checkAdjustment(a *BlockAccount, adj *InterestAdjustment) error {
+	rated := *a
+	rated.InterestRate = adj.Rate
+	unpaid := interestBetween(&rated, interestPaidFrom(&rated), rated.EndDate)
+	if roundMoney(unpaid+a.InterestAdjustment+adj.Amount) < 0 {
+		return ErrAdjustmentExceedsInterest
+	}
+	return nil
+}
+
+// RequestRecalculation holds a recalculation of the account's interest from
+// the rate plan until a second staff member approves it. The approval shows
+// the adjustment as of the request; it is derived again on approval. It
+// returns nil when the account does not exist.
+func (s *service) RequestRecalculation(ctx context.Context, id int, staffID string, req *RecalculateInterestRequest) (*Approval, error) {
+	account, err := s.repo.GetAccount(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+	if err := checkApprovalAction(ApprovalRecalculation, account, s.Now()); err != nil {
+		return nil, err
+	}
+	valueDate := utcOrNil(req.ValueDate)
+	if err := checkValueDate(account, valueDate, s.Now()); err != nil {
+		return nil, err
+	}
+	paid, err := s.repo.ListInterestPayouts(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to list interest payouts", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	prior, err := s.repo.ListInterestAdjustments(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to list interest adjustments", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	rates, err := s.ratePlan(ctx, account.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	adj, err := planRecalculation(account, rates, paid, prior, valueDate)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAdjustment(account, adj); err != nil {
+		return nil, err
+	}
+	return s.holdForApproval(ctx, staffID, account, &Approval{
+		Action: ApprovalRecalculation, Adjustment: adj.Amount, Reason: req.Reason, ValueDate: valueDate,
+	})
+}
+
+// PreviewRecalculation carries out a recalculation of the account's interest
+// as approving one would, under the account's lock, and rolls it back. It
+// returns nil when the account does not exist.
+func (s *service) PreviewRecalculation(ctx context.Context, id int, req *RecalculateInterestRequest) (*RecalculationPreview, error) {
+	account, err := s.repo.GetAccount(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+	rates, err := s.ratePlan(ctx, account.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	valueDate, now := utcOrNil(req.ValueDate), s.Now()
+	updated, adj, err := s.repo.AdjustInterest(withDryRun(ctx), id,
+		func(account *BlockAccount, paid []*InterestPayout, prior []*InterestAdjustment) (*InterestAdjustment, error) {
+			if err := checkApprovalAction(ApprovalRecalculation, account, now); err != nil {
+				return nil, err
+			}
+			if err := checkValueDate(account, valueDate, now); err != nil {
+				return nil, err
+			}
+			adj, err := planRecalculation(account, rates, paid, prior, valueDate)
+			if err != nil {
+				return nil, err
+			}
+			return adj, checkAdjustment(account, adj)
+		})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &RecalculationPreview{
+		DryRun: true, AccountID: updated.ExternalID, Adjustment: adj.Amount,
+		PreviousRate: adj.PreviousRate, Rate: adj.Rate, InterestAdjustment: updated.InterestAdjustment,
+	}, nil
+}
+
+// RequestAdjustment holds a manual credit or debit of the account's interest
+// until a second staff member approves it. It returns nil when the account
+// does not exist.
+func (s *service) RequestAdjustment(ctx context.Context, id int, staffID string, req *AdjustInterestRequest) (*Approval, error) {
+	account, err := s.repo.GetAccount(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+	if err := checkApprovalAction(ApprovalAdjustment, account, s.Now()); err != nil {
+		return nil, err
+	}
+	valueDate := utcOrNil(req.ValueDate)
+	if err := checkValueDate(account, valueDate, s.Now()); err != nil {
+		return nil, err
+	}
+	amount := roundMoney(req.Amount)
+	adj := &InterestAdjustment{Kind: AdjustmentManual, Amount: amount, PreviousRate: account.InterestRate, Rate: account.InterestRate}
+	if err := checkAdjustment(account, adj); err != nil {
+		return nil, err
+	}
+	return s.holdForApproval(ctx, staffID, account, &Approval{
+		Action: ApprovalAdjustment, Adjustment: amount, Reason: req.Reason, ValueDate: valueDate,
+	})
+}
+
+// adjustInterest carries out an approved recalculation or manual adjustment,
+// checking the account again under its lock
+func (s *service) adjustInterest(ctx context.Context, a *Approval) error {
+	// Approvals are decided within the tenant of their account
+	rates, err := s.ratePlan(ctx, tenantOf(ctx))
+	if err != nil {
+		return err
+	}
+	_, adj, err := s.repo.AdjustInterest(ctx, a.AccountID,
+		func(account *BlockAccount, paid []*InterestPayout, prior []*InterestAdjustment) (*InterestAdjustment, error) {
+			if err := checkApprovalAction(a.Action, account, s.Now()); err != nil {
+				return nil, err
+			}
+			adj := &InterestAdjustment{
+				AccountID: account.ID, Kind: AdjustmentManual, Amount: a.Adjustment,
+				PreviousRate: account.InterestRate, Rate: account.InterestRate, ValueDate: a.ValueDate,
+			}
+			if a.Action == ApprovalRecalculation {
+				var err error
+				if adj, err = planRecalculation(account, rates, paid, prior, a.ValueDate); err != nil {
+					return nil, err
+				}
+			}
+			if err := checkAdjustment(account, adj); err != nil {
+				return nil, err
+			}
+			adj.Reason, adj.ApprovalID, adj.RequestedBy, adj.ApprovedBy = a.Reason, a.ID, a.RequestedBy, a.DecidedBy
+			return adj, nil
+		})
+	if err == sql.ErrNoRows {
+		return ErrAccountGone
+	}
+	if err != nil {
+		return err
+	}
+	s.log(ctx).Info("Interest adjusted", zap.Int("approvalID", a.ID), zap.Int("accountID", a.AccountID),
+		zap.String("kind", adj.Kind), zap.Float64("amount", adj.Amount),
+		zap.Float64("previousRate", adj.PreviousRate), zap.Float64("rate", adj.Rate))
+	return nil
+}
+
+// recalculateInterestHandler godoc
+// @Summary Recalculate a block account's interest
+// @Description Requests that the account's rate be re-derived from the rate plan for its period, with the interest already paid recomputed at that rate and the difference credited or debited at maturity. The recalculation is held until a second staff member approves it with POST /admin/approvals/{id}/approve, and is derived again then; the returned approval shows the adjustment as of the request. With a value_date the plan's rate applies from that date only, for corrections that take effect part way through the term: interest before it keeps the account's rate. With dry_run=true the recalculation is carried out at once and rolled back, and the response shows what it would change without requesting an approval.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param recalculation body RecalculateInterestRequest true "Why the interest is recalculated"
+// @Param dry_run query bool false "Show what the recalculation would change without keeping anything"
+// @Success 200 {object} RecalculationPreview "Dry run"
+// @Success 202 {object} Approval
+// @Header 202 {string} Location "URL of the approval"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Account not active, interest already follows the rate plan, or no period to take a rate from"
+// @Failure 422 {object} ErrorResponse "Recalculated debit exceeds the interest still to be paid, or value_date is in the future or outside the term"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/block-account/{id}/recalculate [post]
+func recalculateInterestHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	var req RecalculateInterestRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	if dryRun {
+		preview, err := svc.PreviewRecalculation(ctx, id, &req)
+		switch {
+		case err != nil:
+			writeAdjustmentError(w, err)
+		case preview == nil:
+			writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		default:
+			writeSuccess(w, r, preview, "Dry run: interest recalculation previewed, nothing was changed")
+		}
+		return
+	}
+
+	approval, err := svc.RequestRecalculation(ctx, id, staffID, &req)
+	writeAdjustmentApproval(w, r, approval, err, "Interest recalculation requested, waiting for a second approver")
+}
+
+// adjustInterestHandler godoc
+// @Summary Adjust a block account's interest
+// @Description Requests a manual credit, or a debit when amount is negative, of the account's interest, paid with the interest at maturity. A debit may not take the maturity payout below the principal. A value_date in the past is recorded with the adjustment as when it took effect, apart from when it was booked. The adjustment is held until a second staff member approves it with POST /admin/approvals/{id}/approve.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param adjustment body AdjustInterestRequest true "Amount and reason"
+// @Success 202 {object} Approval
+// @Header 202 {string} Location "URL of the approval"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Account not active"
+// @Failure 422 {object} ErrorResponse "Debit exceeds the interest still to be paid, or value_date is in the future or outside the term"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/block-account/{id}/adjust [post]
+func adjustInterestHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	var req AdjustInterestRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	approval, err := svc.RequestAdjustment(ctx, id, staffID, &req)
+	writeAdjustmentApproval(w, r, approval, err, "Interest adjustment requested, waiting for a second approver")
+}
+
+// writeAdjustmentApproval writes the response to a requested recalculation
+// or adjustment
+func writeAdjustmentApproval(w http.ResponseWriter, r *http.Request, approval *Approval, err error, message string) {
+	if err != nil {
+		writeAdjustmentError(w, err)
+		return
+	}
+	if approval == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+
+	w.Header().Set("Location", apiPath("/admin/approvals/"+strconv.Itoa(approval.ID)))
+	writeSuccessStatus(w, r, http.StatusAccepted, approval, message)
+}
+
+// writeAdjustmentError writes the error response of a recalculation or
+// adjustment that could not be requested
+func writeAdjustmentError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrAccountNotActive, ErrAccountFrozen, ErrInterestUpToDate, ErrNoRatePlan:
+		writeAPIError(w, http.StatusConflict, err)
+	case ErrAdjustmentExceedsInterest, ErrValueDateInFuture, ErrValueDateOutsideTerm:
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+	default:
+		writeAPIError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// currentAgreementVersion is the template new accounts are issued under.
+// Issued agreements are re-rendered from their own version, so a changed
+// legal text ships as a new template file and never edits an old one.
+const currentAgreementVersion = "v1"
+
+//go:embed templates/agreements/*.tmpl
+var agreementTemplateFiles embed.FS
+
+// ErrAgreementMismatch is returned when a re-rendered agreement no longer
+// matches the hash recorded when it was issued
+var ErrAgreementMismatch = newAPIError(CodeAgreementMismatch, "agreement document does not match the issued document")
+
+// documentTemplateFuncs format values in agreement and report templates
+var documentTemplateFuncs = template.FuncMap{
+	"money":   func(v float64) string { return strconv.FormatFloat(roundMoney(v), 'f', 2, 64) },
+	"percent": func(v float64) string { return strconv.FormatFloat(v*100, 'f', -1, 64) + "%" },
+	"date":    func(t time.Time) string { return t.In(businessLocation()).Format("2 January 2006") },
+	"term": func(period string) string {
+		p, ok := catalog.get(period)
+		switch {
+		case !ok:
+			return period
+		case p.TermMonths == 12:
+			return "1 year"
+		case p.TermMonths%12 == 0:
+			return fmt.Sprintf("%d years", p.TermMonths/12)
+		}
+		return fmt.Sprintf("%d months", p.TermMonths)
+	},
+	"frequency": func(f string) string {
+		switch f {
+		case FrequencyMonthly:
+			return "monthly"
+		case FrequencyQuarterly:
+			return "quarterly"
+		}
+		return "at maturity together with the principal"
+	},
+	"instruction": func(i string) string {
+		if i == InstructionRollover {
+			return "renew the deposit for the same term at the rate then offered"
+		}
+		return "pay out the principal and interest"
+	},
+}
+
+// AgreementTerms are the account terms an agreement was issued with. They
+// are kept with the agreement, so it reads the same after the account changes.
+type AgreementTerms struct {
+	Version             string    `json:"version"`
+	AccountID           int       `json:"account_id"`
+	UserID              int       `json:"user_id"`
+	Principal           float64   `json:"principal"`
+	Currency            string    `json:"currency"`
+	Period              string    `json:"period"`
+	InterestRate        float64   `json:"interest_rate"`
+	Interest            float64   `json:"interest"`
+	StartDate           time.Time `json:"start_date"`
+	EndDate             time.Time `json:"end_date"`
+	PayoutFrequency     string    `json:"payout_frequency"`
+	MaturityInstruction string    `json:"maturity_instruction"`
+	IssuedAt            time.Time `json:"issued_at"`
+}
+
+// Agreement is the deposit agreement issued for an account
+type Agreement struct {
+	AccountID       int
+	TemplateVersion string
+	Terms           AgreementTerms
+	// SHA256 is the hex digest of the issued PDF
+	SHA256 string
+	// DocumentKey is where the PDF is kept in the object store, empty when
+	// no store was configured at issue time
+	DocumentKey string
+	CreatedAt   time.Time
+}
+
+// agreementKey is where an account's agreement is kept in the object store.
+// The digest in the name keeps a concurrently issued copy from overwriting
+// the one that was recorded.
+func agreementKey(accountID int, version, sha string) string {
+	return fmt.Sprintf("agreements/%d/%s-%s.pdf", accountID, version, sha[:16])
+}
+
+// agreementLocation is the download link for an account's agreement
+func agreementLocation(externalID string) string {
+	return apiPath("/block-account/" + externalID + "/agreement")
+}
+
+// newAgreementTerms captures the account's terms under the current template
+func newAgreementTerms(account *BlockAccount, now time.Time) AgreementTerms {
+	return AgreementTerms{
+		Version:             currentAgreementVersion,
+		AccountID:           account.ID,
+		UserID:              account.UserID,
+		Principal:           account.Principal,
+		Currency:            accountCurrency(),
+		Period:              account.Period,
+		InterestRate:        account.InterestRate,
+		Interest:            roundMoney(interestBetween(account, account.StartDate, account.EndDate)),
+		StartDate:           account.StartDate,
+		EndDate:             account.EndDate,
+		PayoutFrequency:     account.PayoutFrequency,
+		MaturityInstruction: account.MaturityInstruction,
+		IssuedAt:            now,
+	}
+}
+
+// renderAgreementPDF fills the terms' template version and lays it out as a PDF
+func renderAgreementPDF(terms AgreementTerms) ([]byte, error) {
+	tmpl, err := template.New(terms.Version+".tmpl").Funcs(documentTemplateFuncs).
+		ParseFS(agreementTemplateFiles, "templates/agreements/"+terms.Version+".tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("agreement template %s: %w", terms.Version, err)
+	}
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, terms); err != nil {
+		return nil, fmt.Errorf("agreement template %s: %w", terms.Version, err)
+	}
+
+	doc := &simplePDF{title: fmt.Sprintf("Deposit Agreement %d", terms.AccountID)}
+	for _, line := range strings.Split(strings.TrimRight(text.String(), "\n"), "\n") {
+		doc.addLine("%s", line)
+	}
+	return doc.Bytes(), nil
+}
+
+// issueAgreement renders the account's agreement from the current template,
+// keeps the PDF in the object store when one is configured and records it
+// with the account. An account only ever has one agreement; if one was
+// issued already, that one is returned.
+func (s *service) issueAgreement(ctx context.Context, account *BlockAccount) (*Agreement, error) {
+	terms := newAgreementTerms(account, s.Now().UTC())
+	doc, err := renderAgreementPDF(terms)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(doc)
+	agreement := &Agreement{
+		AccountID:       account.ID,
+		TemplateVersion: terms.Version,
+		Terms:           terms,
+		SHA256:          hex.EncodeToString(sum[:]),
+	}
+	if s.store != nil {
+		key := agreementKey(account.ID, terms.Version, agreement.SHA256)
+		if err := s.store.Put(ctx, key, bytes.NewReader(doc), int64(len(doc)), "application/pdf"); err != nil {
+			return nil, err
+		}
+		agreement.DocumentKey = key
+	}
+	return s.repo.CreateAgreement(ctx, agreement)
+}
+
+// GetAgreement returns the account's agreement and its PDF. The PDF comes
+// from the object store when it was kept there, and is otherwise rendered
+// again from the recorded terms and checked against the issued hash.
+// Accounts created before agreements existed are issued one on first
+// request. A missing account returns sql.ErrNoRows.
+func (s *service) GetAgreement(ctx context.Context, accountID int) (*Agreement, []byte, error) {
+	agreement, err := s.repo.GetAgreement(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get agreement", zap.Error(err), zap.Int("account_id", accountID))
+		return nil, nil, err
+	}
+	if agreement == nil {
+		account, err := s.repo.GetAccount(ctx, accountID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if account == nil {
+			return nil, nil, sql.ErrNoRows
+		}
+		if agreement, err = s.issueAgreement(ctx, account); err != nil {
+			s.log(ctx).Error("Failed to issue agreement", zap.Error(err), zap.Int("account_id", accountID))
+			return nil, nil, err
+		}
+	}
+
+	if agreement.DocumentKey != "" && s.store != nil {
+		doc, err := s.store.Get(ctx, agreement.DocumentKey)
+		if err != nil {
+			s.log(ctx).Error("Failed to read agreement", zap.Error(err), zap.String("key", agreement.DocumentKey))
+			return nil, nil, err
+		}
+		defer doc.Close()
+		b, err := io.ReadAll(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+		return agreement, b, nil
+	}
+
+	doc, err := renderAgreementPDF(agreement.Terms)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sum := sha256.Sum256(doc); hex.EncodeToString(sum[:]) != agreement.SHA256 {
+		s.log(ctx).Error("Re-rendered agreement does not match the issued hash",
+			zap.Int("account_id", accountID), zap.String("version", agreement.TemplateVersion))
+		return nil, nil, ErrAgreementMismatch
+	}
+	return agreement, doc, nil
+}
+
+// getAgreementHandler godoc
+// @Summary Download the deposit agreement
+// @Description Returns the deposit agreement issued when the account was opened, as a PDF. X-Agreement-Version names the template it was issued from and X-Content-SHA256 the digest recorded at issue.
+// @Tags block-account
+// @Produce application/pdf
+// @Param id path string true "Account ID" Format(uuid)
+// @Success 200 {file} file
+// @Header 200 {string} X-Agreement-Version "Template version the agreement was issued from"
+// @Header 200 {string} X-Content-SHA256 "SHA-256 of the issued document"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/agreement [get]
+func getAgreementHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	agreement, doc, err := svc.GetAgreement(ctx, id)
+	if err == sql.ErrNoRows {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="deposit-agreement-%d.pdf"`, id))
+	w.Header().Set("X-Agreement-Version", agreement.TemplateVersion)
+	w.Header().Set("X-Content-SHA256", agreement.SHA256)
+	w.Write(doc)
+}
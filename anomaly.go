@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Anomaly rule codes, recorded on every compliance flag
+const (
+	AnomalyUserVelocity   = "user_velocity"
+	AnomalyIPVelocity     = "ip_velocity"
+	AnomalyPrincipalSpike = "principal_spike"
+)
+
+// What was done about the activity a flag was raised for
+const (
+	AnomalyFlagged = "flagged"
+	AnomalyBlocked = "blocked"
+)
+
+// Compliance flag review statuses
+const (
+	FlagOpen      = "open"
+	FlagCleared   = "cleared"
+	FlagEscalated = "escalated"
+)
+
+// anomalyWindow is the trailing window account creations are counted over
+const anomalyWindow = time.Hour
+
+// Default anomaly thresholds, overridden by the ANOMALY_* variables
+const (
+	defaultUserHourlyLimit      = 10
+	defaultIPHourlyLimit        = 30
+	defaultPrincipalSpikeFactor = 10
+	defaultPrincipalSpikeMin    = 10000
+)
+
+const clientIPKey ctxKey = "clientIP"
+
+// ErrFlagReviewed is returned when reviewing a flag that is no longer open
+var ErrFlagReviewed = newAPIError(CodeFlagReviewed, "compliance flag has already been reviewed")
+
+// AnomalyBlock is returned when an account creation is refused as suspicious.
+// The caller may try again after RetryAfter, once the window has moved on.
+type AnomalyBlock struct {
+	Rule       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (b *AnomalyBlock) Error() string {
+	return b.Message
+}
+
+// ComplianceFlag is suspicious activity queued for compliance review. Repeats
+// of the same rule for the same user or IP within the window add to one open
+// flag rather than queueing another.
+// @Description Suspicious account activity awaiting or after compliance review
+type ComplianceFlag struct {
+	ID   int    `json:"id" example:"1"`
+	Rule string `json:"rule" example:"user_velocity"`
+	// Subject is who tripped the rule, "user:<id>" or "ip:<address>"
+	Subject           string `json:"subject" example:"user:123"`
+	UserID            int    `json:"user_id" example:"123"`
+	AccountID         *int   `json:"-"`
+	AccountExternalID string `json:"account_id,omitempty" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	ClientIP          string `json:"client_ip,omitempty" example:"203.0.113.7"`
+	Detail            string `json:"detail" example:"user 123 tried to open 11 accounts within an hour; the limit is 10"`
+	// Action is "flagged" when the activity went ahead and "blocked" when refused
+	Action      string     `json:"action" example:"blocked"`
+	Occurrences int        `json:"occurrences" example:"1"`
+	Status      string     `json:"status" example:"open"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ReviewedBy  string     `json:"reviewed_by,omitempty" example:"staff-42"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	ReviewNote  string     `json:"review_note,omitempty" example:"Payroll batch from the employer portal"`
+}
+
+// ReviewComplianceFlagRequest closes a flag
+// @Description Outcome of a compliance review
+type ReviewComplianceFlagRequest struct {
+	// Status is "cleared" for legitimate activity or "escalated" for a case
+	Status string `json:"status" example:"cleared" validate:"oneof=cleared escalated"`
+	Note   string `json:"note" example:"Payroll batch from the employer portal" validate:"notblank,max=1000"`
+}
+
+// anomalyRules are the detector's thresholds. A zero limit or factor turns
+// its rule off.
+type anomalyRules struct {
+	// userHourlyLimit and ipHourlyLimit are the most accounts a user or an IP
+	// address may open in anomalyWindow
+	userHourlyLimit int
+	ipHourlyLimit   int
+	// blockVelocity refuses creations over a velocity limit rather than only
+	// flagging them
+	blockVelocity bool
+	// a principal at least spikeFactor times the user's average open
+	// principal, and at least spikeMin, is flagged
+	spikeFactor float64
+	spikeMin    float64
+}
+
+// loadAnomalyRules reads the thresholds from ANOMALY_USER_HOURLY_LIMIT,
+// ANOMALY_IP_HOURLY_LIMIT, ANOMALY_VELOCITY_ACTION,
+// ANOMALY_PRINCIPAL_SPIKE_FACTOR and ANOMALY_PRINCIPAL_SPIKE_MIN
+func loadAnomalyRules() anomalyRules {
+	rules := anomalyRules{
+		userHourlyLimit: defaultUserHourlyLimit,
+		ipHourlyLimit:   defaultIPHourlyLimit,
+		blockVelocity:   os.Getenv("ANOMALY_VELOCITY_ACTION") != "flag",
+		spikeFactor:     defaultPrincipalSpikeFactor,
+		spikeMin:        defaultPrincipalSpikeMin,
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANOMALY_USER_HOURLY_LIMIT")); err == nil && n >= 0 {
+		rules.userHourlyLimit = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANOMALY_IP_HOURLY_LIMIT")); err == nil && n >= 0 {
+		rules.ipHourlyLimit = n
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("ANOMALY_PRINCIPAL_SPIKE_FACTOR"), 64); err == nil && f >= 0 {
+		rules.spikeFactor = f
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("ANOMALY_PRINCIPAL_SPIKE_MIN"), 64); err == nil && f >= 0 {
+		rules.spikeMin = f
+	}
+	return rules
+}
+
+// withClientIP records the caller's address for the anomaly checks
+func withClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+// clientIPFromContext returns the address recorded by withClientIP, or ""
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
+
+// clientIP returns the address of the client behind r: the first hop of
+// X-Forwarded-For as set by the gateway, or the peer address
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		if ip := strings.TrimSpace(strings.Split(fwd, ",")[0]); ip != "" {
+			return ip
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// checkCreationVelocity returns an *AnomalyBlock when the user or the client
+// IP has already opened as many accounts in the window as allowed and
+// velocity is blocked. Over-limit creations are queued for compliance
+// review either way.
+func (s *service) checkCreationVelocity(ctx context.Context, userID int) error {
+	rules := loadAnomalyRules()
+	if rules.userHourlyLimit == 0 && rules.ipHourlyLimit == 0 {
+		return nil
+	}
+	ip := clientIPFromContext(ctx)
+	now := time.Now().UTC()
+	byUser, byIP, err := s.repo.CountAccountCreations(ctx, userID, ip, now.Add(-anomalyWindow))
+	if err != nil {
+		s.log(ctx).Error("Failed to count account creations", zap.Error(err), zap.Int("userID", userID))
+		return err
+	}
+
+	flag := &ComplianceFlag{UserID: userID, ClientIP: ip, Action: AnomalyFlagged}
+	if rules.blockVelocity {
+		flag.Action = AnomalyBlocked
+	}
+	switch {
+	case rules.userHourlyLimit > 0 && byUser >= rules.userHourlyLimit:
+		flag.Rule, flag.Subject = AnomalyUserVelocity, "user:"+strconv.Itoa(userID)
+		flag.Detail = fmt.Sprintf("user %d tried to open %d accounts within an hour; the limit is %d",
+			userID, byUser+1, rules.userHourlyLimit)
+	case rules.ipHourlyLimit > 0 && ip != "" && byIP >= rules.ipHourlyLimit:
+		flag.Rule, flag.Subject = AnomalyIPVelocity, "ip:"+ip
+		flag.Detail = fmt.Sprintf("%s tried to open %d accounts within an hour; the limit is %d",
+			ip, byIP+1, rules.ipHourlyLimit)
+	default:
+		return nil
+	}
+
+	s.raiseComplianceFlag(ctx, flag, now)
+	if !rules.blockVelocity {
+		return nil
+	}
+	return &AnomalyBlock{Rule: flag.Rule, RetryAfter: anomalyWindow,
+		Message: "too many accounts opened recently; try again later"}
+}
+
+// recordAccountCreation counts the new account towards the velocity limits
+// and flags a principal far above what the user already holds. It runs
+// after the account is written, so its failures are logged and not returned.
+func (s *service) recordAccountCreation(ctx context.Context, account *BlockAccount) {
+	ip := clientIPFromContext(ctx)
+	now := time.Now().UTC()
+	if err := s.repo.RecordAccountCreation(ctx, account.ID, account.UserID, ip, now, now.Add(-anomalyWindow)); err != nil {
+		s.log(ctx).Error("Failed to record account creation", zap.Error(err), zap.Int("account_id", account.ID))
+	}
+
+	rules := loadAnomalyRules()
+	if rules.spikeFactor == 0 || account.Principal < rules.spikeMin {
+		return
+	}
+	exposure, err := s.repo.GetUserExposure(ctx, account.UserID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get user exposure", zap.Error(err), zap.Int("userID", account.UserID))
+		return
+	}
+	// The exposure includes the new account; compare against the others
+	others := exposure.OpenAccounts - 1
+	if others <= 0 {
+		return
+	}
+	average := (exposure.Principal - account.Principal) / float64(others)
+	if average <= 0 || account.Principal < average*rules.spikeFactor {
+		return
+	}
+	accountID := account.ID
+	s.raiseComplianceFlag(ctx, &ComplianceFlag{
+		Rule:      AnomalyPrincipalSpike,
+		Subject:   "user:" + strconv.Itoa(account.UserID),
+		UserID:    account.UserID,
+		AccountID: &accountID,
+		ClientIP:  ip,
+		Action:    AnomalyFlagged,
+		Detail: fmt.Sprintf("principal %.2f is %.1f times user %d's average open principal of %.2f",
+			account.Principal, account.Principal/average, account.UserID, average),
+	}, now)
+}
+
+// raiseComplianceFlag queues f for review, or adds to the open flag of the
+// same rule and subject raised within the window
+func (s *service) raiseComplianceFlag(ctx context.Context, f *ComplianceFlag, now time.Time) {
+	flag, err := s.repo.RaiseComplianceFlag(ctx, f, now, now.Add(-anomalyWindow))
+	if err != nil {
+		s.log(ctx).Error("Failed to raise compliance flag", zap.Error(err),
+			zap.String("rule", f.Rule), zap.String("subject", f.Subject))
+		return
+	}
+	s.log(ctx).Warn("Suspicious activity flagged", zap.Int("flag_id", flag.ID), zap.String("rule", flag.Rule),
+		zap.String("subject", flag.Subject), zap.String("action", f.Action), zap.Int("occurrences", flag.Occurrences))
+}
+
+// ListComplianceFlags returns the latest flags, newest first, optionally only
+// those in status
+func (s *service) ListComplianceFlags(ctx context.Context, status string) ([]*ComplianceFlag, error) {
+	flags, err := s.repo.ListComplianceFlags(ctx, status, 200)
+	if err != nil {
+		s.log(ctx).Error("Failed to list compliance flags", zap.Error(err))
+		return nil, err
+	}
+	if flags == nil {
+		flags = []*ComplianceFlag{}
+	}
+	return flags, nil
+}
+
+// ReviewComplianceFlag closes an open flag as cleared or escalated. It
+// returns nil when the flag does not exist and ErrFlagReviewed when it is
+// no longer open.
+func (s *service) ReviewComplianceFlag(ctx context.Context, id int, staffID string, req *ReviewComplianceFlagRequest) (*ComplianceFlag, error) {
+	flag, err := s.repo.GetComplianceFlag(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get compliance flag", zap.Error(err), zap.Int("flag_id", id))
+		return nil, err
+	}
+	if flag == nil {
+		return nil, nil
+	}
+	if flag.Status != FlagOpen {
+		return nil, ErrFlagReviewed
+	}
+
+	flag, err = s.repo.ReviewComplianceFlag(ctx, id, req.Status, staffID, strings.TrimSpace(req.Note), time.Now().UTC())
+	if err == sql.ErrNoRows {
+		// Another reviewer got there first
+		return nil, ErrFlagReviewed
+	}
+	if err != nil {
+		s.log(ctx).Error("Failed to review compliance flag", zap.Error(err), zap.Int("flag_id", id))
+		return nil, err
+	}
+	s.log(ctx).Info("Compliance flag reviewed", zap.Int("flag_id", id), zap.String("rule", flag.Rule),
+		zap.String("status", flag.Status), zap.String("staffID", staffID))
+	return flag, nil
+}
+
+// writeAnomalyBlock writes a 429 telling the client when to try again
+func writeAnomalyBlock(w http.ResponseWriter, b *AnomalyBlock) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(b.RetryAfter.Seconds())))
+	writeErrorResponse(w, http.StatusTooManyRequests, ErrorResponse{
+		Message:   b.Message,
+		ErrorCode: CodeActivityThrottled,
+		Details:   map[string]any{"rule": b.Rule},
+	})
+}
+
+// listComplianceFlagsHandler godoc
+// @Summary List compliance flags
+// @Description Lists the latest 200 flags raised by the anomaly detector, newest first. Filter on status=open for the review queue.
+// @Tags admin
+// @Produce json
+// @Param status query string false "Only flags in this status" Enums(open, cleared, escalated)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]ComplianceFlag}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/compliance/flags [get]
+func listComplianceFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", FlagOpen, FlagCleared, FlagEscalated:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid status: %s. Valid options are: open, cleared, escalated", status))
+		return
+	}
+
+	ctx := r.Context()
+
+	flags, err := svc.ListComplianceFlags(ctx, status)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, flags, "Compliance flags retrieved successfully")
+}
+
+// reviewComplianceFlagHandler godoc
+// @Summary Review a compliance flag
+// @Description Closes an open flag, clearing the activity as legitimate or escalating it to a case. A note is required.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Flag ID" Format(int64)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param review body ReviewComplianceFlagRequest true "Review outcome"
+// @Success 200 {object} ComplianceFlag
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/compliance/flags/{id}/review [post]
+func reviewComplianceFlagHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid compliance flag ID")
+		return
+	}
+
+	var req ReviewComplianceFlagRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	flag, err := svc.ReviewComplianceFlag(ctx, id, staffID, &req)
+	if err == ErrFlagReviewed {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if flag == nil {
+		writeError(w, http.StatusNotFound, "Compliance flag not found")
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, flag, "Compliance flag reviewed successfully")
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"main.go/config"
+)
+
+// testAPI serves the HTTP API in process, over a service and a freshly
+// migrated SQLite database, with rate limits off. Requests carry a platform
+// admin key unless a test sends its own X-API-Key.
+type testAPI struct {
+	t       *testing.T
+	handler http.Handler
+	svc     *service
+	repo    Repository
+	db      *sql.DB
+	// adminKey is the platform admin key requests are sent with
+	adminKey string
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Database = testDatabase(t, DriverSQLite)
+	repo, db := testRepository(t, cfg.Database)
+	a := &app{cfg: cfg, logger: zap.NewNop(), driver: DriverSQLite, db: db, repo: repo, ids: uuidV7Generator{}, startedAt: time.Now(), clock: newClock()}
+	// Products defined by a test stay out of the tests after it
+	t.Cleanup(func() { catalog.replace(builtinProducts) })
+	svc := a.newService()
+	admin, err := svc.IssueAPIKey(context.Background(), "staff-1", &IssueAPIKeyRequest{Name: "tests", Scopes: []string{ScopeAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAPI{t: t, handler: newRouter(svc, nil, rateLimits{}, cfg.Server, a.logger), svc: svc, repo: repo, db: db,
+		adminKey: admin.Key}
+}
+
+// do serves a request with body, as JSON when it is not empty, and headers
+// given as name and value pairs. Requests carry a staff ID and the admin
+// key; an empty X-API-Key sends them without credentials.
+func (api *testAPI) do(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(StaffIDHeader, "staff-1")
+	req.Header.Set(APIKeyHeader, api.adminKey)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	api.handler.ServeHTTP(w, req)
+	return w
+}
+
+// create serves a request that must succeed and decodes its data into out
+func (api *testAPI) create(method, path, body string, out any) {
+	api.t.Helper()
+	w := api.do(method, path, body)
+	if w.Code >= 300 {
+		api.t.Fatalf("%s %s: %d %s", method, path, w.Code, w.Body)
+	}
+	var env struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		api.t.Fatalf("%s %s: decode response: %v", method, path, err)
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		api.t.Fatalf("%s %s: decode data: %v", method, path, err)
+	}
+}
+
+// createAccount opens a 1y account for userID and returns its ID
+func (api *testAPI) createAccount(userID int) string {
+	api.t.Helper()
+	var account struct {
+		ID string `json:"id"`
+	}
+	api.create(http.MethodPost, "/v2/block-account", `{"user_id":`+strconv.Itoa(userID)+`,"principal":1000,"period":"1y"}`, &account)
+	return account.ID
+}
+
+// etag returns the current ETag of the account with id
+func (api *testAPI) etag(id string) string {
+	api.t.Helper()
+	w := api.do(http.MethodGet, "/v2/block-account/"+id, "")
+	if w.Code != http.StatusOK {
+		api.t.Fatalf("get %s: %d %s", id, w.Code, w.Body)
+	}
+	return w.Header().Get("ETag")
+}
+
+// errorCode returns the error_code of an error response, or "" for any
+// other body
+func errorCode(w *httptest.ResponseRecorder) string {
+	var env struct {
+		ErrorCode string `json:"error_code"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &env)
+	return env.ErrorCode
+}
+
+// handlerCase is a request to the API and the response it should get. The
+// placeholders {account}, {closing}, {webhook}, {approval}, {job} and {key}
+// in its path and body are replaced with the IDs of fixtures.
+type handlerCase struct {
+	name    string
+	method  string
+	path    string
+	body    string
+	headers []string
+	status  int
+	// code is the error_code of an error response
+	code string
+}
+
+// TestHandlers serves at least one request to every route of the API, in
+// order, against one database. Later cases may depend on what earlier ones
+// changed.
+func TestHandlers(t *testing.T) {
+	api := newTestAPI(t)
+
+	var id struct {
+		ID int `json:"id"`
+	}
+	fixtures := map[string]string{
+		"{account}": api.createAccount(1),
+		"{closing}": api.createAccount(2),
+	}
+	api.create(http.MethodPost, "/v2/webhooks", `{"url":"https://example.com/hooks","events":["account.created"]}`, &id)
+	fixtures["{webhook}"] = strconv.Itoa(id.ID)
+	api.create(http.MethodPost, "/v2/admin/approvals", `{"action":"freeze","account_id":"`+fixtures["{account}"]+`","reason":"Sanctions screening match"}`, &id)
+	fixtures["{approval}"] = strconv.Itoa(id.ID)
+	api.create(http.MethodPost, "/v2/admin/api-keys", `{"name":"batch","scopes":["read"]}`, &id)
+	fixtures["{key}"] = strconv.Itoa(id.ID)
+	api.create(http.MethodPost, "/v2/admin/maturity/run", "", &id)
+	fixtures["{job}"] = strconv.Itoa(id.ID)
+	expand := func(s string) string {
+		for placeholder, v := range fixtures {
+			s = strings.ReplaceAll(s, placeholder, v)
+		}
+		return s
+	}
+
+	tests := []handlerCase{
+		// Probes, metrics and the API description
+		{name: "liveness", method: "GET", path: "/healthz", status: 200},
+		{name: "readiness", method: "GET", path: "/readyz", status: 200},
+		{name: "health", method: "GET", path: "/health", status: 200},
+		{name: "ready", method: "GET", path: "/ready", status: 200},
+		{name: "status", method: "GET", path: "/status", status: 200},
+		{name: "metrics", method: "GET", path: MetricsPath, status: 200},
+		{name: "spec", method: "GET", path: "/swagger/doc.json", status: 200},
+		{name: "spec digest", method: "GET", path: "/swagger/doc.hash", status: 200},
+		{name: "versions", method: "GET", path: "/versions", status: 200},
+		{name: "unknown route", method: "GET", path: "/v2/nothing-here", status: 404},
+
+		// Products and accounts
+		{name: "list products", method: "GET", path: "/v2/products", status: 200},
+		{name: "list products unversioned", method: "GET", path: "/products", status: 200},
+		{name: "create account", method: "POST", path: "/v2/block-account", body: `{"user_id":3,"principal":500,"period":"6m","payout_frequency":"monthly"}`, status: 201},
+		{name: "create account invalid", method: "POST", path: "/v2/block-account", body: `{"user_id":0,"principal":500,"period":"6m"}`, status: 400, code: CodeInvalidUserID},
+		{name: "create account invalid fields", method: "POST", path: "/v2/block-account", body: `{}`, status: 400, code: CodeValidationFailed},
+		{name: "create account malformed", method: "POST", path: "/v2/block-account", body: `{`, status: 400, code: CodeMalformedBody},
+		{name: "get account", method: "GET", path: "/v2/block-account/{account}", status: 200},
+		{name: "get account not modified", method: "GET", path: "/v2/block-account/{account}", headers: []string{"If-None-Match", "*"}, status: 304},
+		{name: "get account invalid ID", method: "GET", path: "/v2/block-account/42", status: 400, code: CodeInvalidAccountID},
+		{name: "get account missing", method: "GET", path: "/v2/block-account/01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f", status: 404, code: CodeAccountNotFound},
+		{name: "list user accounts", method: "GET", path: "/v2/user/1/block-accounts", status: 200},
+		{name: "list user accounts paged", method: "GET", path: "/v2/user/1/block-accounts?limit=1", status: 200},
+		{name: "list user accounts bad limit", method: "GET", path: "/v2/user/1/block-accounts?limit=1000", status: 400},
+		{name: "list user accounts invalid user", method: "GET", path: "/v2/user/x/block-accounts", status: 400, code: CodeInvalidUserID},
+		{name: "stream events invalid user", method: "GET", path: "/v2/user/x/block-accounts/events", status: 400, code: CodeInvalidUserID},
+		{name: "stream events invalid resume", method: "GET", path: "/v2/user/1/block-accounts/events", headers: []string{"Last-Event-ID", "x"}, status: 400, code: CodeInvalidField},
+		{name: "user portfolio", method: "GET", path: "/v2/user/1/portfolio", status: 200},
+		{name: "user portfolio invalid user", method: "GET", path: "/v2/user/x/portfolio", status: 400, code: CodeInvalidUserID},
+		{name: "tax certificate", method: "GET", path: "/v2/user/1/tax-certificate?year=2025", status: 200},
+		{name: "tax certificate without year", method: "GET", path: "/v2/user/1/tax-certificate", status: 400},
+		{name: "get notification preferences", method: "GET", path: "/v2/user/1/notification-preferences", status: 200},
+		{name: "set notification preferences", method: "PUT", path: "/v2/user/1/notification-preferences", body: `{"channels":[],"reminder_days":14}`, status: 200},
+		{name: "set notification preferences unavailable channel", method: "PUT", path: "/v2/user/1/notification-preferences", body: `{"channels":["email"],"email":"customer@example.com"}`, status: 400, code: CodeChannelUnavailable},
+		{name: "set notification preferences invalid", method: "PUT", path: "/v2/user/1/notification-preferences", body: `{"channels":["pigeon"]}`, status: 400},
+		{name: "change maturity instruction without If-Match", method: "PUT", path: "/v2/block-account/{account}/maturity-instruction", body: `{"instruction":"rollover"}`, status: 428},
+		{name: "change maturity instruction stale", method: "PUT", path: "/v2/block-account/{account}/maturity-instruction", body: `{"instruction":"rollover"}`, headers: []string{"If-Match", `"stale"`}, status: 412, code: CodeAccountChanged},
+		{name: "change maturity instruction", method: "PUT", path: "/v2/block-account/{account}/maturity-instruction", body: `{"instruction":"rollover"}`, headers: []string{"If-Match", "*"}, status: 200},
+		{name: "change maturity instruction invalid", method: "PUT", path: "/v2/block-account/{account}/maturity-instruction", body: `{"instruction":"payout"}`, headers: []string{"If-Match", "*"}, status: 400},
+		{name: "communications", method: "GET", path: "/v2/block-account/{account}/communications", status: 200},
+		{name: "payout schedule", method: "GET", path: "/v2/block-account/{account}/payout-schedule", status: 200},
+		{name: "history", method: "GET", path: "/v2/block-account/{account}/history", status: 200},
+		{name: "agreement", method: "GET", path: "/v2/block-account/{account}/agreement", status: 200},
+		{name: "mute notifications", method: "PUT", path: "/v2/block-account/{account}/notification-mute", body: `{"until":"` + time.Now().UTC().AddDate(0, 0, 7).Format(time.RFC3339) + `"}`, status: 200},
+		{name: "list notification mutes", method: "GET", path: "/v2/block-account/{account}/notification-mutes", status: 200},
+		{name: "unmute notifications", method: "DELETE", path: "/v2/block-account/{account}/notification-mute", status: 200},
+		{name: "delete account without If-Match", method: "DELETE", path: "/v2/block-account/{closing}", status: 428},
+		{name: "delete account", method: "DELETE", path: "/v2/block-account/{closing}", headers: []string{"If-Match", "*"}, status: 204},
+		{name: "delete account again", method: "DELETE", path: "/v2/block-account/{closing}", headers: []string{"If-Match", "*"}, status: 404, code: CodeAccountNotFound},
+		{name: "delete account unversioned", method: "DELETE", path: "/block-account/01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f", status: 404, code: CodeAccountNotFound},
+
+		// Bulk loading and jobs
+		{name: "bulk create", method: "POST", path: "/v2/block-account/bulk", body: `[{"user_id":4,"principal":100,"period":"3m"}]`, status: 200},
+		{name: "bulk create dry run", method: "POST", path: "/v2/block-account/bulk?dry_run=true", body: `[{"user_id":4,"principal":100,"period":"3m"}]`, status: 200},
+		{name: "bulk create dry run queued", method: "POST", path: "/v2/block-account/bulk?dry_run=true&async=true", body: `[{"user_id":4,"principal":100,"period":"3m"}]`, status: 400},
+		{name: "bulk create invalid dry run", method: "POST", path: "/v2/block-account/bulk?dry_run=yes", body: `[{"user_id":4,"principal":100,"period":"3m"}]`, status: 400},
+		{name: "bulk create empty", method: "POST", path: "/v2/block-account/bulk", body: `{}`, status: 400, code: CodeInvalidRequest},
+		{name: "get import missing", method: "GET", path: "/v2/block-account/bulk/999", status: 404},
+		{name: "get job", method: "GET", path: "/v2/jobs/{job}", status: 200},
+		{name: "get job invalid", method: "GET", path: "/v2/jobs/x", status: 400, code: CodeInvalidRequest},
+		{name: "cancel job", method: "POST", path: "/v2/jobs/{job}/cancel", status: 200},
+
+		// Webhooks
+		{name: "create webhook", method: "POST", path: "/v2/webhooks", body: `{"url":"https://example.com/other","events":["account.matured"]}`, status: 201},
+		{name: "create webhook invalid", method: "POST", path: "/v2/webhooks", body: `{}`, status: 400, code: CodeValidationFailed},
+		{name: "webhook deliveries", method: "GET", path: "/v2/webhooks/{webhook}/deliveries", status: 200},
+		{name: "replay webhook deliveries", method: "POST", path: "/v2/admin/webhooks/{webhook}/replay", status: 200},
+		{name: "delete webhook", method: "DELETE", path: "/v2/webhooks/{webhook}", status: 204},
+
+		// Account administration
+		{name: "fail payout without one", method: "POST", path: "/v2/admin/block-account/{account}/payout/failure", body: `{"reason":"Rejected account number"}`, status: 404},
+		{name: "retry payout without one", method: "POST", path: "/v2/admin/block-account/{account}/payout/retry", body: `{}`, status: 404},
+		{name: "recalculate interest up to date", method: "POST", path: "/v2/admin/block-account/{account}/recalculate", body: `{"reason":"Rate entered wrong, case 1"}`, status: 409, code: CodeInterestUpToDate},
+		{name: "adjust interest needs approval", method: "POST", path: "/v2/admin/block-account/{account}/adjust", body: `{"amount":12.5,"reason":"Goodwill credit, case 2"}`, status: 202},
+		{name: "adjust interest without reason", method: "POST", path: "/v2/admin/block-account/{account}/adjust", body: `{"amount":12.5}`, status: 400},
+		{name: "adjust interest value-dated before the account", method: "POST", path: "/v2/admin/block-account/{account}/adjust", body: `{"amount":12.5,"reason":"Goodwill credit, case 2","value_date":"2020-01-01T00:00:00Z"}`, status: 422, code: CodeInvalidValueDate},
+		{name: "book value-dated account", method: "POST", path: "/v2/admin/block-account", body: `{"user_id":1,"principal":1000,"period":"3y","value_date":"2026-01-01T00:00:00Z","reason":"Migrated, case 4"}`, status: 201},
+		{name: "book value-dated account without value date", method: "POST", path: "/v2/admin/block-account", body: `{"user_id":1,"principal":1000,"period":"3y","reason":"Migrated, case 4"}`, status: 400},
+		{name: "maturing soon", method: "GET", path: "/v2/admin/block-accounts/maturing-soon?days=30", status: 200},
+		{name: "maturing soon window too long", method: "GET", path: "/v2/admin/block-accounts/maturing-soon?days=400", status: 400},
+		{name: "portfolio stats", method: "GET", path: "/v2/admin/stats", status: 200},
+		{name: "rate scenario", method: "POST", path: "/v2/admin/analysis/rate-scenario", body: `{"rates":{"1y":0.06}}`, status: 200},
+		{name: "rate scenario empty", method: "POST", path: "/v2/admin/analysis/rate-scenario", body: `{}`, status: 400},
+		{name: "start impersonation without a staff principal", method: "POST", path: "/v2/admin/impersonations", body: `{"user_id":1,"reason":"Ticket 1"}`, status: 401},
+		{name: "get impersonation missing", method: "GET", path: "/v2/admin/impersonations/999", status: 404},
+		{name: "end impersonation missing", method: "DELETE", path: "/v2/admin/impersonations/999", status: 404},
+		{name: "set product gate", method: "PUT", path: "/v2/admin/product-gates/3y", body: `{"allowed_user_ids":[1],"rollout_percent":10}`, status: 200},
+		{name: "list product gates", method: "GET", path: "/v2/admin/product-gates", status: 200},
+		{name: "delete product gate", method: "DELETE", path: "/v2/admin/product-gates/3y", status: 204},
+		{name: "set account limit", method: "PUT", path: "/v2/admin/limits/max_total_principal", body: `{"value":250000}`, status: 200},
+		{name: "set account limit invalid", method: "PUT", path: "/v2/admin/limits/max_total_principal", body: `{}`, status: 400},
+		{name: "list account limits", method: "GET", path: "/v2/admin/limits", status: 200},
+		{name: "delete account limit", method: "DELETE", path: "/v2/admin/limits/max_total_principal", status: 204},
+		{name: "list approvals", method: "GET", path: "/v2/admin/approvals?status=pending", status: 200},
+		{name: "request approval invalid", method: "POST", path: "/v2/admin/approvals", body: `{}`, status: 400, code: CodeValidationFailed},
+		{name: "get approval", method: "GET", path: "/v2/admin/approvals/{approval}", status: 200},
+		{name: "approve own request", method: "POST", path: "/v2/admin/approvals/{approval}/approve", body: `{}`, status: 403},
+		{name: "approve", method: "POST", path: "/v2/admin/approvals/{approval}/approve", body: `{}`, headers: []string{StaffIDHeader, "staff-2"}, status: 200},
+		{name: "reject decided", method: "POST", path: "/v2/admin/approvals/{approval}/reject", body: `{"note":"Too late"}`, headers: []string{StaffIDHeader, "staff-2"}, status: 409},
+		{name: "list compliance flags", method: "GET", path: "/v2/admin/compliance/flags", status: 200},
+		{name: "review compliance flag missing", method: "POST", path: "/v2/admin/compliance/flags/999/review", body: `{"status":"cleared","note":"Payroll"}`, status: 404},
+		{name: "issue API key", method: "POST", path: "/v2/admin/api-keys", body: `{"name":"reporting","scopes":["read","write"]}`, status: 201},
+		{name: "issue API key invalid", method: "POST", path: "/v2/admin/api-keys", body: `{}`, status: 400, code: CodeValidationFailed},
+		{name: "issue API key without credentials", method: "POST", path: "/v2/admin/api-keys", body: `{"name":"intruder","scopes":["admin"]}`, headers: []string{APIKeyHeader, ""}, status: 401},
+		{name: "list API keys without credentials", method: "GET", path: "/v2/admin/api-keys", headers: []string{APIKeyHeader, ""}, status: 401},
+		{name: "create account without credentials", method: "POST", path: "/v2/block-account", body: `{"user_id":1,"principal":1000,"period":"1y"}`, headers: []string{APIKeyHeader, ""}, status: 401},
+		{name: "get account without credentials", method: "GET", path: "/v2/block-account/{account}", headers: []string{APIKeyHeader, ""}, status: 200},
+		{name: "list API keys", method: "GET", path: "/v2/admin/api-keys", status: 200},
+		{name: "rotate API key", method: "POST", path: "/v2/admin/api-keys/{key}/rotate", body: `{}`, status: 200},
+		{name: "revoke API key", method: "DELETE", path: "/v2/admin/api-keys/{key}", status: 204},
+		{name: "list rates", method: "GET", path: "/v2/admin/rates", status: 200},
+		{name: "set rate", method: "PUT", path: "/v2/admin/rates/1y", body: `{"rate":0.045}`, status: 200},
+		{name: "recalculate interest dry run frozen", method: "POST", path: "/v2/admin/block-account/{account}/recalculate?dry_run=true", body: `{"reason":"Rate plan changed"}`, status: 409, code: CodeAccountFrozen},
+		{name: "set rate invalid", method: "PUT", path: "/v2/admin/rates/1y", body: `{"rate":2}`, status: 400},
+		{name: "delete rate", method: "DELETE", path: "/v2/admin/rates/1y", status: 204},
+
+		// Platform administration
+		{name: "run maturity", method: "POST", path: "/v2/admin/maturity/run", status: 202},
+		{name: "run maturity dry run", method: "POST", path: "/v2/admin/maturity/run?dry_run=true", status: 200},
+		{name: "batch action", method: "POST", path: "/v2/admin/block-accounts/batch-action", body: `{"action":"freeze","account_ids":["{closing}"],"reason":"Sanctions list match"}`, status: 202},
+		{name: "batch action listed and filtered", method: "POST", path: "/v2/admin/block-accounts/batch-action", body: `{"action":"freeze","account_ids":["{closing}"],"filter":{"period":"1y"},"reason":"Sanctions list match"}`, status: 400, code: CodeInvalidField},
+		{name: "dashboard", method: "GET", path: "/v2/admin/dashboard", status: 200},
+		{name: "run report", method: "POST", path: "/v2/admin/reports/" + ReportDailySummary + "/run", status: 202},
+		{name: "run unknown report", method: "POST", path: "/v2/admin/reports/weekly/run", status: 404},
+		{name: "get report not generated", method: "GET", path: "/v2/admin/reports/" + ReportDailySummary + "/2020-01-01", status: 404},
+		{name: "cache stats without a cache", method: "GET", path: "/v2/admin/cache/stats", status: 404},
+		{name: "replay events", method: "POST", path: "/v2/admin/events/replay", body: `{"account_ids":["{account}"],"destination":{"type":"broker"}}`, status: 202},
+		{name: "replay events invalid", method: "POST", path: "/v2/admin/events/replay", body: `{}`, status: 400},
+		{name: "get event replay missing", method: "GET", path: "/v2/admin/events/replay/999", status: 404},
+		{name: "replay events after sequence", method: "POST", path: "/v2/admin/events/replay", body: `{"after_sequence":1,"destination":{"type":"broker"}}`, status: 202},
+		{name: "list event log", method: "GET", path: "/v2/admin/events?account_id={account}", status: 200},
+		{name: "list event log invalid account", method: "GET", path: "/v2/admin/events?account_id=42", status: 400, code: CodeInvalidAccountID},
+		{name: "rebuild projection", method: "POST", path: "/v2/admin/events/rebuild", body: `{"projection":"notifications"}`, status: 202},
+		{name: "rebuild projection unknown", method: "POST", path: "/v2/admin/events/rebuild", body: `{"projection":"search"}`, status: 400},
+		{name: "rebuild projection without staff", method: "POST", path: "/v2/admin/events/rebuild", body: `{"projection":"notifications"}`, headers: []string{"X-Staff-ID", ""}, status: 401},
+		{name: "region single-region", method: "GET", path: "/v2/admin/region", status: 404, code: CodeRegionNotConfigured},
+		{name: "promote region single-region", method: "POST", path: "/v2/admin/region/promote", body: `{"reason":"drill"}`, status: 409, code: CodeRegionNotConfigured},
+		{name: "create tenant", method: "POST", path: "/v2/admin/tenants", body: `{"id":"acme","name":"Acme Savings Bank"}`, status: 201},
+		{name: "create tenant again", method: "POST", path: "/v2/admin/tenants", body: `{"id":"acme","name":"Acme Savings Bank"}`, status: 409},
+		{name: "list tenants", method: "GET", path: "/v2/admin/tenants", status: 200},
+		{name: "list product definitions", method: "GET", path: "/v2/admin/products", status: 200},
+		{name: "define product", method: "PUT", path: "/v2/admin/products/9m", body: `{"name":"9-month deposit","term_months":9,"rate":0.042}`, status: 200},
+		{name: "define product invalid code", method: "PUT", path: "/v2/admin/products/9M", body: `{"name":"9-month deposit","term_months":9,"rate":0.042}`, status: 400, code: CodeInvalidPeriod},
+		{name: "define product invalid", method: "PUT", path: "/v2/admin/products/9m", body: `{"name":"","term_months":0,"rate":0.042,"early_withdrawal":"never"}`, status: 400, code: CodeValidationFailed},
+		{name: "retire product", method: "DELETE", path: "/v2/admin/products/9m", status: 204},
+		{name: "retire product again", method: "DELETE", path: "/v2/admin/products/9m", status: 404},
+		{name: "export accounts", method: "GET", path: "/v2/admin/export/block-accounts", status: 200},
+		{name: "list scheduled jobs", method: "GET", path: "/v2/admin/scheduler/jobs", status: 200},
+		{name: "pause scheduled job", method: "POST", path: "/v2/admin/scheduler/jobs/" + ScheduledJobReports + "/pause", status: 200},
+		{name: "resume scheduled job", method: "POST", path: "/v2/admin/scheduler/jobs/" + ScheduledJobReports + "/resume", status: 200},
+		{name: "trigger scheduled job", method: "POST", path: "/v2/admin/scheduler/jobs/" + ScheduledJobReports + "/trigger", status: 202},
+		{name: "trigger unknown scheduled job", method: "POST", path: "/v2/admin/scheduler/jobs/funding/trigger", status: 404, code: CodeUnknownScheduledJob},
+		{name: "trigger scheduled job without staff", method: "POST", path: "/v2/admin/scheduler/jobs/" + ScheduledJobReports + "/trigger", headers: []string{StaffIDHeader, ""}, status: 401, code: CodeStaffIdentityRequired},
+
+		// GraphQL
+		{name: "graphql", method: "POST", path: GraphQLPath, body: `{"query":"{ userAccounts(userId: 1) { id status } }"}`, status: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := api.do(tt.method, expand(tt.path), expand(tt.body), tt.headers...)
+			if w.Code != tt.status {
+				t.Fatalf("%s %s: status %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, w.Body)
+			}
+			if code := errorCode(w); tt.code != "" && code != tt.code {
+				t.Errorf("error_code %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
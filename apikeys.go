@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to scan for
+const apiKeyPrefix = "bak_"
+
+// Rotation grace periods, during which the replaced secret keeps working
+const (
+	defaultRotationGrace = 24 * time.Hour
+	maxRotationGrace     = 7 * 24 * time.Hour
+)
+
+// apiKeyTouchInterval is how stale last_used_at may get, so that a busy key
+// is not written on every request
+const apiKeyTouchInterval = time.Minute
+
+// ErrAPIKeyRevoked is returned when rotating a revoked key
+var ErrAPIKeyRevoked = newAPIError(CodeAPIKeyRevoked, "API key has been revoked")
+
+// APIKey authenticates a service-to-service caller. Only a hash of the
+// secret is stored; the key itself is returned once, when issued or rotated.
+// @Description An API key for service-to-service callers
+type APIKey struct {
+	ID   int    `json:"id" example:"1"`
+	Name string `json:"name" example:"core-banking-batch"`
+	// Prefix identifies the key in logs and is the part of it after "bak_"
+	Prefix string   `json:"prefix" example:"3f9a1c2e"`
+	Scopes []string `json:"scopes" example:"read,write"`
+	// Key is only set in the responses that issue or rotate the key
+	Key        string     `json:"key,omitempty" example:"bak_3f9a1c2e_5d41402abc4b2a76b9719d911017c592"`
+	CreatedBy  string     `json:"created_by" example:"staff-42"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	// PreviousKeyExpiresAt is when the secret replaced by the last rotation stops working
+	PreviousKeyExpiresAt *time.Time `json:"previous_key_expires_at,omitempty"`
+	RevokedAt            *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy            string     `json:"revoked_by,omitempty" example:"staff-42"`
+	// TenantID is the tenant the key acts for, empty for a platform key that
+	// may act for any tenant
+	TenantID string `json:"tenant_id,omitempty" example:"acme"`
+
+	keyHash      string
+	previousHash string
+}
+
+// IssueAPIKeyRequest is the payload for issuing an API key
+// @Description Request payload for issuing an API key
+type IssueAPIKeyRequest struct {
+	Name string `json:"name" example:"core-banking-batch" validate:"notblank,max=100"`
+	// Scopes are any of read, write and admin. write includes read and admin includes both.
+	Scopes    []string   `json:"scopes" example:"read,write" validate:"min=1,dive,oneof=read write admin"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// TenantID ties the key to a tenant. Callers bound to a tenant can only
+	// issue keys for it; platform callers leave it empty for a platform key.
+	TenantID string `json:"tenant_id,omitempty" example:"acme" validate:"omitempty,tenant_id"`
+}
+
+// RotateAPIKeyRequest is the payload for rotating an API key
+// @Description Request payload for rotating an API key
+type RotateAPIKeyRequest struct {
+	// GracePeriod is how long the old secret keeps working, up to 168h. Defaults to 24h; "0s" ends it at once.
+	GracePeriod string `json:"grace_period,omitempty" example:"24h"`
+}
+
+// validateIssueAPIKeyRequest validates an issue request
+func validateIssueAPIKeyRequest(req *IssueAPIKeyRequest, now time.Time) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Scopes = slices.Compact(slices.Sorted(slices.Values(req.Scopes)))
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	return nil
+}
+
+// rotationGrace parses a rotation's grace period
+func rotationGrace(req *RotateAPIKeyRequest) (time.Duration, error) {
+	if req.GracePeriod == "" {
+		return defaultRotationGrace, nil
+	}
+	d, err := time.ParseDuration(req.GracePeriod)
+	if err != nil || d < 0 || d > maxRotationGrace {
+		return 0, fmt.Errorf("grace_period must be a duration between 0s and %s", maxRotationGrace)
+	}
+	return d, nil
+}
+
+// newAPIKeySecret returns a key and the prefix it is looked up by
+func newAPIKeySecret() (key, prefix string, err error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(b)
+	return apiKeyPrefix + prefix + "_" + secret, prefix, nil
+}
+
+// hashAPIKey returns the stored form of a key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// matches reports whether key is the API key's current secret, or its
+// previous one while the rotation grace period lasts
+func (k *APIKey) matches(key string, now time.Time) bool {
+	hash := []byte(hashAPIKey(key))
+	if subtle.ConstantTimeCompare(hash, []byte(k.keyHash)) == 1 {
+		return true
+	}
+	return k.previousHash != "" && k.PreviousKeyExpiresAt != nil && now.Before(*k.PreviousKeyExpiresAt) &&
+		subtle.ConstantTimeCompare(hash, []byte(k.previousHash)) == 1
+}
+
+// IssueAPIKey creates a key with the requested scopes. The returned key
+// carries the secret, which is not stored and cannot be shown again.
+func (s *service) IssueAPIKey(ctx context.Context, staffID string, req *IssueAPIKeyRequest) (*APIKey, error) {
+	tenant := req.TenantID
+	switch {
+	case tenantBound(ctx) && tenant != "" && tenant != tenantOf(ctx):
+		return nil, ErrTenantMismatch
+	case tenantBound(ctx):
+		tenant = tenantOf(ctx)
+	case tenant != "":
+		exists, err := s.TenantExists(ctx, tenant)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrUnknownTenant
+		}
+	}
+
+	key, prefix, err := newAPIKeySecret()
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := s.repo.CreateAPIKey(ctx, &APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		Scopes:    req.Scopes,
+		CreatedBy: staffID,
+		ExpiresAt: req.ExpiresAt,
+		TenantID:  tenant,
+		keyHash:   hashAPIKey(key),
+	})
+	if err != nil {
+		s.log(ctx).Error("Failed to issue API key", zap.Error(err))
+		return nil, err
+	}
+	apiKey.Key = key
+
+	s.log(ctx).Info("API key issued", zap.Int("apiKeyID", apiKey.ID), zap.String("prefix", prefix),
+		zap.String("name", apiKey.Name), zap.Strings("scopes", apiKey.Scopes), zap.String("keyTenant", tenant),
+		zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("API key %s issued", apiKey.Name),
+		map[string]any{"setting": "api_key", "api_key_id": apiKey.ID, "prefix": prefix, "scopes": apiKey.Scopes, "changed_by": staffID})
+	return apiKey, nil
+}
+
+// apiKeyScope scopes ctx for managing API keys: platform callers manage
+// every key, platform keys included, callers bound to a tenant only its own
+func apiKeyScope(ctx context.Context) context.Context {
+	if tenantBound(ctx) {
+		return ctx
+	}
+	return withTenant(ctx, "")
+}
+
+// ListAPIKeys returns every key the caller manages, newest first, without
+// secrets
+func (s *service) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(apiKeyScope(ctx))
+	if err != nil {
+		s.log(ctx).Error("Failed to list API keys", zap.Error(err))
+		return nil, err
+	}
+	if keys == nil {
+		keys = []*APIKey{}
+	}
+	return keys, nil
+}
+
+// RotateAPIKey replaces a key's secret, keeping its prefix and scopes. The
+// old secret keeps working for grace so callers can roll the new one out.
+// It returns nil when the key does not exist.
+func (s *service) RotateAPIKey(ctx context.Context, id int, staffID string, grace time.Duration) (*APIKey, error) {
+	existing, err := s.repo.GetAPIKey(apiKeyScope(ctx), id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get API key", zap.Error(err), zap.Int("apiKeyID", id))
+		return nil, err
+	}
+	if existing == nil {
+		return nil, nil
+	}
+	if existing.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + existing.Prefix + "_" + secret
+	now := time.Now().UTC()
+	apiKey, err := s.repo.RotateAPIKey(apiKeyScope(ctx), id, hashAPIKey(key), now.Add(grace), now)
+	if err == sql.ErrNoRows {
+		// Revoked while we were rotating it
+		return nil, ErrAPIKeyRevoked
+	}
+	if err != nil {
+		s.log(ctx).Error("Failed to rotate API key", zap.Error(err), zap.Int("apiKeyID", id))
+		return nil, err
+	}
+	apiKey.Key = key
+
+	s.log(ctx).Info("API key rotated", zap.Int("apiKeyID", id), zap.String("prefix", apiKey.Prefix),
+		zap.Duration("grace", grace), zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("API key %s rotated", apiKey.Name),
+		map[string]any{"setting": "api_key", "api_key_id": id, "prefix": apiKey.Prefix, "grace": grace.String(), "changed_by": staffID})
+	return apiKey, nil
+}
+
+// RevokeAPIKey stops a key, and any secret still in its rotation grace
+// period, from authenticating. It returns sql.ErrNoRows when the key does
+// not exist or is already revoked.
+func (s *service) RevokeAPIKey(ctx context.Context, id int, staffID string) error {
+	apiKey, err := s.repo.RevokeAPIKey(apiKeyScope(ctx), id, staffID, time.Now().UTC())
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to revoke API key", zap.Error(err), zap.Int("apiKeyID", id))
+		}
+		return err
+	}
+	s.log(ctx).Warn("API key revoked", zap.Int("apiKeyID", id), zap.String("prefix", apiKey.Prefix), zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityWarning, fmt.Sprintf("API key %s revoked", apiKey.Name),
+		map[string]any{"setting": "api_key", "api_key_id": id, "prefix": apiKey.Prefix, "changed_by": staffID})
+	return nil
+}
+
+// AuthenticateAPIKey returns the active key matching key, or nil when it is
+// unknown, expired or revoked
+func (s *service) AuthenticateAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return nil, nil
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, nil
+	}
+
+	apiKey, err := s.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		s.log(ctx).Error("Failed to look up API key", zap.Error(err), zap.String("prefix", prefix))
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if apiKey == nil || apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt)) ||
+		!apiKey.matches(key, now) {
+		return nil, nil
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.repo.TouchAPIKey(ctx, apiKey.ID, now); err != nil {
+			s.log(ctx).Warn("Failed to record API key use", zap.Error(err), zap.Int("apiKeyID", apiKey.ID))
+		}
+	}
+	return apiKey, nil
+}
+
+// issueAPIKeyHandler godoc
+// @Summary Issue an API key
+// @Description Issues an API key with read, write or admin scope for a service-to-service caller, which sends it in X-API-Key. A key with a tenant_id acts for that tenant only. The key is returned only in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param key body IssueAPIKeyRequest true "Name and scopes"
+// @Success 201 {object} APIKey
+// @Header 201 {string} Location "URL of the key"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/api-keys [post]
+func issueAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req IssueAPIKeyRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if err := validateIssueAPIKeyRequest(&req, time.Now()); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	apiKey, err := svc.IssueAPIKey(ctx, staffID, &req)
+	switch {
+	case err == ErrUnknownTenant:
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	case err == ErrTenantMismatch:
+		writeAPIError(w, http.StatusForbidden, err)
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	w.Header().Set("Location", apiPath("/admin/api-keys/"+strconv.Itoa(apiKey.ID)))
+	writeSuccessStatus(w, r, http.StatusCreated, apiKey, "API key issued; store it now, it will not be shown again")
+}
+
+// listAPIKeysHandler godoc
+// @Summary List API keys
+// @Description Every API key, newest first, with its scopes, last use and revocation: all of them for platform callers, the tenant's own for callers bound to a tenant. Secrets are never returned.
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]APIKey}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/api-keys [get]
+func listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	keys, err := svc.ListAPIKeys(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeList(w, r, page, keys, "API keys retrieved successfully")
+}
+
+// rotateAPIKeyHandler godoc
+// @Summary Rotate an API key
+// @Description Replaces the key's secret, keeping its prefix and scopes. The old secret keeps working for the grace period so callers can roll out the new one. The new key is returned only in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "API key ID" Format(int64)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param rotation body RotateAPIKeyRequest false "Grace period for the old secret"
+// @Success 200 {object} APIKey
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/api-keys/{id}/rotate [post]
+func rotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	var req RotateAPIKeyRequest
+	if r.ContentLength != 0 && !decodeRequest(w, r, &req) {
+		return
+	}
+	grace, err := rotationGrace(&req)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	apiKey, err := svc.RotateAPIKey(ctx, id, staffID, grace)
+	if err == ErrAPIKeyRevoked {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if apiKey == nil {
+		writeError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, apiKey, "API key rotated; store it now, it will not be shown again")
+}
+
+// revokeAPIKeyHandler godoc
+// @Summary Revoke an API key
+// @Description Stops the key, and any old secret still in its rotation grace period, from authenticating. The key stays listed as revoked.
+// @Tags admin
+// @Param id path int true "API key ID" Format(int64)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/api-keys/{id} [delete]
+func revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := svc.RevokeAPIKey(ctx, id, staffID); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "API key not found or already revoked")
+			return
+		}
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// StatusFrozen is the status of an account an approved freeze has stopped.
+// Frozen accounts neither accrue payouts nor mature until they are unfrozen.
+const StatusFrozen = "frozen"
+
+// Sensitive operations that need a second staff member's approval
+const (
+	ApprovalEarlyWithdrawal = "early_withdrawal"
+	ApprovalFreeze          = "freeze"
+	ApprovalUnfreeze        = "unfreeze"
+	ApprovalRecalculation   = "interest_recalculation"
+	ApprovalAdjustment      = "interest_adjustment"
+)
+
+// Approval statuses. An approval is approved once its action was carried out,
+// and failed when the action could no longer be carried out on approval.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalFailed   = "failed"
+)
+
+// maxApprovalsListed caps the approvals returned by one list request
+const maxApprovalsListed = 200
+
+var (
+	// ErrApprovalRequired is returned when an early withdrawal is large enough to need a second approver
+	ErrApprovalRequired = newAPIError(CodeApprovalRequired, "early withdrawal of this amount needs a second approver; request one with POST /admin/approvals")
+	// ErrApprovalNotPending is returned when an approval has already been decided
+	ErrApprovalNotPending = newAPIError(CodeApprovalNotPending, "approval has already been decided")
+	// ErrSelfApproval is returned when staff try to decide their own request
+	ErrSelfApproval = newAPIError(CodeSelfApproval, "approvals must be decided by someone other than the requester")
+	// ErrApprovalFailed is returned when an approved action could not be carried out
+	ErrApprovalFailed = newAPIError(CodeApprovalFailed, "approved action could not be carried out")
+	// ErrAccountFrozen is returned for changes to a frozen account
+	ErrAccountFrozen = newAPIError(CodeAccountFrozen, "block account is frozen")
+	// ErrAccountNotFrozen is returned when unfreezing an account that is not frozen
+	ErrAccountNotFrozen = newAPIError(CodeAccountNotFrozen, "block account is not frozen")
+	// ErrAccountGone is returned when an approved action's account was deleted meanwhile
+	ErrAccountGone = newAPIError(CodeAccountNotFound, "block account no longer exists")
+)
+
+// Approval is a sensitive operation held until a second staff member approves it
+// @Description Sensitive operation waiting for, or decided by, a second staff member
+type Approval struct {
+	ID int `json:"id" example:"1"`
+	// Action is early_withdrawal, freeze, unfreeze, interest_recalculation
+	// or interest_adjustment
+	Action            string `json:"action" example:"freeze"`
+	AccountID         int    `json:"-"`
+	AccountExternalID string `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	// Amount is the account's principal when the approval was requested
+	Amount float64 `json:"amount" example:"75000"`
+	// Adjustment is the interest credited, or debited when negative, by an
+	// interest adjustment, or by a recalculation as of its request
+	Adjustment  float64 `json:"adjustment,omitempty" example:"12.50"`
+	Reason      string  `json:"reason" example:"Sanctions screening match, case 2291"`
+	Status      string  `json:"status" example:"pending"`
+	RequestedBy string  `json:"requested_by" example:"ops-17"`
+	DecidedBy   string  `json:"decided_by,omitempty" example:"ops-4"`
+	// DecisionNote is the approver's comment, required when rejecting
+	DecisionNote string `json:"decision_note,omitempty" example:"Confirmed with compliance"`
+	// FailureReason explains why an approved action could not be carried out
+	FailureReason string     `json:"failure_reason,omitempty" example:"block account is not active"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	// ValueDate is when a value-dated interest adjustment or recalculation
+	// takes effect
+	ValueDate *time.Time `json:"value_date,omitempty"`
+}
+
+// ApprovalRequest is the payload for requesting a sensitive operation
+// @Description Request payload for a sensitive operation needing a second approver
+type ApprovalRequest struct {
+	Action    string `json:"action" example:"freeze" validate:"oneof=early_withdrawal freeze unfreeze"` // "early_withdrawal", "freeze" or "unfreeze"
+	AccountID string `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f" validate:"external_id"`
+	Reason    string `json:"reason" example:"Sanctions screening match, case 2291" validate:"notblank"`
+}
+
+// ApprovalDecisionRequest is the payload for approving or rejecting
+// @Description Approver's comment on a decision
+type ApprovalDecisionRequest struct {
+	Note string `json:"note,omitempty" example:"Confirmed with compliance"`
+}
+
+// earlyWithdrawalThreshold returns the principal from which closing an
+// active account before maturity needs approval, or 0 when it never does
+func earlyWithdrawalThreshold() float64 {
+	if v := os.Getenv("APPROVAL_EARLY_WITHDRAWAL_THRESHOLD"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+			return f
+		}
+	}
+	return 0
+}
+
+// needsWithdrawalApproval reports whether closing the account now is an
+// early withdrawal that is large or of a product that needs approval
+func needsWithdrawalApproval(a *BlockAccount, now time.Time) bool {
+	if a.Status != StatusActive || !now.Before(a.EndDate) {
+		return false
+	}
+	threshold := earlyWithdrawalThreshold()
+	return earlyWithdrawalRule(a.Period) == EarlyWithdrawalApproval || (threshold > 0 && a.Principal >= threshold)
+}
+
+// withdrawalForbidden reports whether closing the account now is an early
+// withdrawal its product does not allow
+func withdrawalForbidden(a *BlockAccount, now time.Time) bool {
+	return a.Status == StatusActive && now.Before(a.EndDate) && earlyWithdrawalRule(a.Period) == EarlyWithdrawalNotAllowed
+}
+
+// checkApprovalAction returns why action cannot be carried out on the account
+// at now, if anything
+func checkApprovalAction(action string, a *BlockAccount, now time.Time) error {
+	switch {
+	case action == ApprovalUnfreeze && a.Status != StatusFrozen:
+		return ErrAccountNotFrozen
+	case action != ApprovalUnfreeze && a.Status == StatusFrozen:
+		return ErrAccountFrozen
+	case action != ApprovalUnfreeze && a.Status != StatusActive:
+		return ErrAccountNotActive
+	case action == ApprovalEarlyWithdrawal && withdrawalForbidden(a, now):
+		return ErrEarlyWithdrawalNotAllowed
+	}
+	return nil
+}
+
+// RequestApproval holds a sensitive operation on an account until a second
+// staff member approves it. It returns nil when the account does not exist.
+func (s *service) RequestApproval(ctx context.Context, staffID string, req *ApprovalRequest) (*Approval, error) {
+	id, err := s.ResolveAccountID(ctx, req.AccountID)
+	if err != nil || id == 0 {
+		return nil, err
+	}
+	account, err := s.repo.GetAccount(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+	if err := checkApprovalAction(req.Action, account, s.Now()); err != nil {
+		return nil, err
+	}
+	return s.holdForApproval(ctx, staffID, account, &Approval{Action: req.Action, Reason: req.Reason})
+}
+
+// holdForApproval records a request by staffID to carry out a on the
+// account, and lets approvers know about it
+func (s *service) holdForApproval(ctx context.Context, staffID string, account *BlockAccount, a *Approval) (*Approval, error) {
+	a.AccountID, a.AccountExternalID = account.ID, account.ExternalID
+	a.Amount, a.RequestedBy = account.Principal, staffID
+	approval, err := s.repo.CreateApproval(ctx, a)
+	if err != nil {
+		s.log(ctx).Error("Failed to create approval", zap.Error(err), zap.Int("accountID", account.ID))
+		return nil, err
+	}
+
+	s.log(ctx).Info("Approval requested", zap.Int("approvalID", approval.ID), zap.String("action", a.Action),
+		zap.Int("accountID", account.ID), zap.String("staffID", staffID))
+	details := map[string]any{"approval_id": approval.ID, "action": a.Action, "account_id": account.ExternalID,
+		"amount": approval.Amount, "requested_by": staffID}
+	if a.Action == ApprovalRecalculation || a.Action == ApprovalAdjustment {
+		details["adjustment"] = approval.Adjustment
+	}
+	s.emitOperational(ctx, EventApprovalRequested, SeverityInfo,
+		fmt.Sprintf("Approval %d requested: %s of block account %s", approval.ID, a.Action, account.ExternalID), details)
+	return approval, nil
+}
+
+// GetApproval returns an approval, or nil when it does not exist
+func (s *service) GetApproval(ctx context.Context, id int) (*Approval, error) {
+	approval, err := s.repo.GetApproval(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get approval", zap.Error(err), zap.Int("id", id))
+	}
+	return approval, err
+}
+
+// ListApprovals returns the latest approvals, only those in status when it is set
+func (s *service) ListApprovals(ctx context.Context, status string) ([]*Approval, error) {
+	approvals, err := s.repo.ListApprovals(ctx, status, maxApprovalsListed)
+	if err != nil {
+		s.log(ctx).Error("Failed to list approvals", zap.Error(err))
+		return nil, err
+	}
+	if approvals == nil {
+		approvals = []*Approval{}
+	}
+	return approvals, nil
+}
+
+// DecideApproval approves or rejects a pending approval on behalf of
+// staffID, who must not be its requester. Approving carries the action out;
+// when that fails the approval is recorded as failed and an error wrapping
+// ErrApprovalFailed is returned with it. It returns nil, nil when the
+// approval does not exist.
+func (s *service) DecideApproval(ctx context.Context, id int, approve bool, staffID, note string) (*Approval, error) {
+	approval, err := s.GetApproval(ctx, id)
+	if err != nil || approval == nil {
+		return nil, err
+	}
+	switch {
+	case approval.Status != ApprovalPending:
+		return nil, ErrApprovalNotPending
+	case approval.RequestedBy == staffID:
+		return nil, ErrSelfApproval
+	}
+
+	status := ApprovalRejected
+	if approve {
+		status = ApprovalApproved
+	}
+	approval, err = s.repo.DecideApproval(ctx, id, status, staffID, note)
+	if err == sql.ErrNoRows {
+		// Another approver got there first
+		return nil, ErrApprovalNotPending
+	}
+	if err != nil {
+		s.log(ctx).Error("Failed to decide approval", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	s.log(ctx).Info("Approval decided", zap.Int("approvalID", id), zap.String("status", status),
+		zap.String("action", approval.Action), zap.Int("accountID", approval.AccountID), zap.String("staffID", staffID))
+	if !approve {
+		return approval, nil
+	}
+
+	if err := s.executeApproval(ctx, approval); err != nil {
+		s.log(ctx).Warn("Approved action failed", zap.Error(err), zap.Int("approvalID", id))
+		approval.Status, approval.FailureReason = ApprovalFailed, err.Error()
+		if ferr := s.repo.FailApproval(ctx, id, err.Error()); ferr != nil {
+			s.log(ctx).Error("Failed to record approval failure", zap.Error(ferr), zap.Int("approvalID", id))
+		}
+		return approval, fmt.Errorf("%w: %w", ErrApprovalFailed, err)
+	}
+	return approval, nil
+}
+
+// executeApproval carries out an approved action
+func (s *service) executeApproval(ctx context.Context, a *Approval) error {
+	switch a.Action {
+	case ApprovalEarlyWithdrawal:
+		account, err := s.repo.GetAccount(ctx, a.AccountID)
+		if err != nil {
+			return err
+		}
+		if account == nil {
+			return ErrAccountGone
+		}
+		if err := checkApprovalAction(a.Action, account, s.Now()); err != nil {
+			return err
+		}
+		return s.closeApproved(ctx, account)
+	case ApprovalFreeze, ApprovalUnfreeze:
+		status := StatusFrozen
+		if a.Action == ApprovalUnfreeze {
+			status = StatusActive
+		}
+		account, err := s.repo.UpdateAccountStatus(ctx, a.AccountID, status, func(account *BlockAccount) error {
+			return checkApprovalAction(a.Action, account, s.Now())
+		})
+		if err != nil {
+			return err
+		}
+		if account == nil {
+			return ErrAccountGone
+		}
+		return nil
+	case ApprovalRecalculation, ApprovalAdjustment:
+		return s.adjustInterest(ctx, a)
+	default:
+		return fmt.Errorf("unsupported action: %s", a.Action)
+	}
+}
+
+// requestApprovalHandler godoc
+// @Summary Request a sensitive operation
+// @Description Holds an early withdrawal, freeze or unfreeze of a block account until a second staff member approves it. Approvers are notified with approval.requested on the operations webhook channel.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param approval body ApprovalRequest true "Action, account and reason"
+// @Success 202 {object} Approval
+// @Header 202 {string} Location "URL of the approval"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/approvals [post]
+func requestApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req ApprovalRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	approval, err := svc.RequestApproval(ctx, staffID, &req)
+	if err != nil {
+		switch err {
+		case ErrAccountNotActive, ErrAccountFrozen, ErrAccountNotFrozen, ErrEarlyWithdrawalNotAllowed:
+			writeAPIError(w, http.StatusConflict, err)
+		default:
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	if approval == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+
+	w.Header().Set("Location", apiPath("/admin/approvals/"+strconv.Itoa(approval.ID)))
+	writeSuccessStatus(w, r, http.StatusAccepted, approval, "Approval requested, waiting for a second approver")
+}
+
+// listApprovalsHandler godoc
+// @Summary List approvals
+// @Description Lists the latest 200 approvals, newest first
+// @Tags admin
+// @Produce json
+// @Param status query string false "Only approvals in this status" Enums(pending, approved, rejected, failed)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]Approval}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/approvals [get]
+func listApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", ApprovalPending, ApprovalApproved, ApprovalRejected, ApprovalFailed:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid status: %s. Valid options are: pending, approved, rejected, failed", status))
+		return
+	}
+
+	ctx := r.Context()
+
+	approvals, err := svc.ListApprovals(ctx, status)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, approvals, "Approvals retrieved successfully")
+}
+
+// getApprovalHandler godoc
+// @Summary Get an approval
+// @Tags admin
+// @Produce json
+// @Param id path int true "Approval ID" Format(int64)
+// @Success 200 {object} Approval
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/approvals/{id} [get]
+func getApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid approval ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	approval, err := svc.GetApproval(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if approval == nil {
+		writeError(w, http.StatusNotFound, "Approval not found")
+		return
+	}
+
+	writeSuccess(w, r, approval, "Approval retrieved successfully")
+}
+
+// approveHandler godoc
+// @Summary Approve a sensitive operation
+// @Description Approves a pending request and carries out its action. The approver must be a different staff member from the requester. When the action can no longer be carried out, for example because the account matured meanwhile, the approval is recorded as failed and 409 is returned.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Approval ID" Format(int64)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param decision body ApprovalDecisionRequest false "Approver's comment"
+// @Success 200 {object} Approval
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/approvals/{id}/approve [post]
+func approveHandler(w http.ResponseWriter, r *http.Request) {
+	decideApproval(w, r, true)
+}
+
+// rejectHandler godoc
+// @Summary Reject a sensitive operation
+// @Description Rejects a pending request so its action is never carried out. A note explaining the rejection is required.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Approval ID" Format(int64)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param decision body ApprovalDecisionRequest true "Reason for rejecting"
+// @Success 200 {object} Approval
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/approvals/{id}/reject [post]
+func rejectHandler(w http.ResponseWriter, r *http.Request) {
+	decideApproval(w, r, false)
+}
+
+// decideApproval handles the approve and reject routes
+func decideApproval(w http.ResponseWriter, r *http.Request, approve bool) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid approval ID")
+		return
+	}
+
+	var req ApprovalDecisionRequest
+	if r.ContentLength != 0 && !decodeRequest(w, r, &req) {
+		return
+	}
+	if !approve && strings.TrimSpace(req.Note) == "" {
+		writeError(w, http.StatusBadRequest, "note is required when rejecting")
+		return
+	}
+
+	ctx := r.Context()
+
+	approval, err := svc.DecideApproval(ctx, id, approve, staffID, req.Note)
+	switch {
+	case err == ErrSelfApproval:
+		writeAPIError(w, http.StatusForbidden, err)
+		return
+	case err == ErrApprovalNotPending:
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	case errors.Is(err, ErrApprovalFailed):
+		if errors.Is(err, ErrAccountGone) || errors.Is(err, ErrAccountNotActive) ||
+			errors.Is(err, ErrAccountFrozen) || errors.Is(err, ErrAccountNotFrozen) || errors.Is(err, ErrEarlyWithdrawalNotAllowed) ||
+			errors.Is(err, ErrInterestUpToDate) || errors.Is(err, ErrAdjustmentExceedsInterest) {
+			writeAPIError(w, http.StatusConflict, err)
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	case approval == nil:
+		writeError(w, http.StatusNotFound, "Approval not found")
+		return
+	}
+
+	if approve {
+		markWrite(w)
+		writeSuccess(w, r, approval, "Approval granted and carried out")
+		return
+	}
+	writeSuccess(w, r, approval, "Approval rejected")
+}
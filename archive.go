@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultRetentionYears is how long accounts stay in the live tables
+	// after they close when RETENTION_YEARS does not say otherwise
+	defaultRetentionYears = 7
+	// defaultRetentionSchedule runs the retention worker nightly, in
+	// BUSINESS_TIMEZONE
+	defaultRetentionSchedule = "30 2 * * *"
+)
+
+// archivableStatuses are the statuses accounts end in, which the retention
+// worker archives them from
+var archivableStatuses = []string{StatusMatured, StatusRolledOver, StatusFundingFailed, StatusClosed}
+
+// ArchivedAccount is a closed account moved out of the live tables once its
+// retention period ran out
+// @Description A block account archived after its retention period, with everything recorded about it when it was archived
+type ArchivedAccount struct {
+	AccountID  int    `json:"-"`
+	ExternalID string `json:"id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	TenantID   string `json:"tenant_id" example:"default"`
+	// Status is the status the account ended in: "matured", "rolled_over",
+	// "funding_failed" or "closed"
+	Status string `json:"status" example:"matured"`
+	// ClosedAt is when the account reached Status
+	ClosedAt   time.Time `json:"closed_at"`
+	ArchivedAt time.Time `json:"archived_at"`
+	// Record is an ArchiveRecord
+	Record json.RawMessage `json:"record" swaggertype:"object"`
+}
+
+// ArchiveRecord is what an archived account keeps of the account
+type ArchiveRecord struct {
+	// Account is omitted for accounts staff deleted before they were
+	// archived
+	Account       *BlockAccount    `json:"account,omitempty"`
+	History       *AccountHistory  `json:"history"`
+	Holders       []*AccountHolder `json:"holders,omitempty"`
+	Beneficiaries []*Beneficiary   `json:"beneficiaries,omitempty"`
+}
+
+// retentionSchedule returns RETENTION_SCHEDULE, falling back to the default
+func retentionSchedule() string {
+	if v := os.Getenv("RETENTION_SCHEDULE"); v != "" {
+		return v
+	}
+	return defaultRetentionSchedule
+}
+
+// retentionPolicy returns how many years accounts of each archivable status
+// are kept after they close. RETENTION_YEARS overrides the default per
+// status as comma-separated status=years pairs; 0 keeps them for good.
+func retentionPolicy() (map[string]int, error) {
+	policy := make(map[string]int, len(archivableStatuses))
+	for _, status := range archivableStatuses {
+		policy[status] = defaultRetentionYears
+	}
+	spec := strings.TrimSpace(os.Getenv("RETENTION_YEARS"))
+	if spec == "" {
+		return policy, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		status, years, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if _, known := policy[status]; !ok || !known {
+			return nil, fmt.Errorf("invalid RETENTION_YEARS entry %q: want status=years, status one of %s",
+				pair, strings.Join(archivableStatuses, ", "))
+		}
+		n, err := strconv.Atoi(years)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("RETENTION_YEARS for %s must be a whole number of years, not %q", status, years)
+		}
+		policy[status] = n
+	}
+	return policy, nil
+}
+
+// ArchiveExpiredAccounts archives the accounts whose retention period under
+// policy has run out by now, batchSize at a time, and returns how many it
+// archived. Accounts that change while being archived are left for the
+// next run.
+func (s *service) ArchiveExpiredAccounts(ctx context.Context, now time.Time, policy map[string]int, batchSize int) (int, error) {
+	statuses := make([]string, 0, len(policy))
+	for status := range policy {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	archived := 0
+	for _, status := range statuses {
+		if policy[status] <= 0 {
+			continue
+		}
+		cutoff := now.AddDate(-policy[status], 0, 0)
+		for {
+			ids, err := s.repo.ListArchivable(ctx, status, cutoff, batchSize)
+			if err != nil {
+				s.log(ctx).Error("Failed to list archivable accounts", zap.Error(err), zap.String("status", status))
+				return archived, err
+			}
+			n := 0
+			for _, id := range ids {
+				ok, err := s.archiveAccount(ctx, id, status, now)
+				if err != nil {
+					return archived, err
+				}
+				if ok {
+					n++
+				}
+			}
+			archived += n
+			// A batch that archived nothing would only come back the same
+			if len(ids) < batchSize || n == 0 {
+				break
+			}
+		}
+	}
+	return archived, nil
+}
+
+// archiveAccount archives the account as it stands, reporting false when it
+// is no longer in status
+func (s *service) archiveAccount(ctx context.Context, id int, status string, now time.Time) (bool, error) {
+	history, err := s.GetAccountHistory(ctx, id)
+	if err != nil || history == nil {
+		return false, err
+	}
+	account, err := s.repo.GetAccount(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+		return false, err
+	}
+	record := &ArchiveRecord{Account: account, History: history}
+	if account != nil {
+		if account.Closure, err = s.repo.GetClosure(ctx, id); err != nil {
+			s.log(ctx).Error("Failed to get closure", zap.Error(err), zap.Int("id", id))
+			return false, err
+		}
+		if record.Holders, err = s.repo.ListAccountHolders(ctx, id); err != nil {
+			s.log(ctx).Error("Failed to list account holders", zap.Error(err), zap.Int("id", id))
+			return false, err
+		}
+		if record.Beneficiaries, err = s.repo.ListBeneficiaries(ctx, []int{id}); err != nil {
+			s.log(ctx).Error("Failed to list beneficiaries", zap.Error(err), zap.Int("id", id))
+			return false, err
+		}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+
+	archived := &ArchivedAccount{AccountID: id, Status: status, ArchivedAt: now.UTC(), Record: data}
+	for _, e := range history.Entries {
+		if e.Type == HistoryStatusChange {
+			archived.ClosedAt = e.At
+		}
+	}
+	switch err := s.repo.ArchiveAccount(ctx, archived); err {
+	case nil:
+	case sql.ErrNoRows:
+		return false, nil
+	default:
+		s.log(ctx).Error("Failed to archive account", zap.Error(err), zap.Int("id", id))
+		return false, err
+	}
+	s.log(ctx).Info("Account archived", zap.String("accountID", archived.ExternalID),
+		zap.String("status", status), zap.Time("closedAt", archived.ClosedAt))
+	return true, nil
+}
+
+// GetArchivedAccount returns an archived account, or nil when the account
+// was not archived
+func (s *service) GetArchivedAccount(ctx context.Context, accountID int) (*ArchivedAccount, error) {
+	archived, err := s.repo.GetArchivedAccount(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get archived account", zap.Error(err), zap.Int("accountID", accountID))
+	}
+	return archived, err
+}
+
+// getArchivedAccountHandler godoc
+// @Summary Get an archived block account
+// @Description Returns an account the retention worker moved out of the live tables once it had been closed for longer than its status's retention period, with the account, its history, holders and beneficiaries as they were archived. Archived accounts are no longer served by the other account routes.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Success 200 {object} ArchivedAccount
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/archive/block-account/{id} [get]
+func getArchivedAccountHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	archived, err := svc.GetArchivedAccount(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if archived == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Archived block account not found")
+		return
+	}
+
+	writeSuccess(w, r, archived, "Archived block account retrieved successfully")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestArchiveExpiredAccounts(t *testing.T) {
+	api := newTestAPI(t)
+	closed := api.createAccount(1)
+	if w := api.do(http.MethodDelete, "/v2/block-account/"+closed, "", "If-Match", api.etag(closed)); w.Code != http.StatusNoContent {
+		t.Fatalf("close: %d %s", w.Code, w.Body)
+	}
+	open := api.createAccount(2)
+
+	ctx := context.Background()
+	policy := map[string]int{StatusClosed: 7, StatusMatured: 7}
+	if n, err := api.svc.ArchiveExpiredAccounts(ctx, time.Now(), policy, 10); err != nil || n != 0 {
+		t.Fatalf("archive before the retention period = %d, %v, want 0", n, err)
+	}
+	if n, err := api.svc.ArchiveExpiredAccounts(ctx, time.Now().AddDate(7, 0, 1), policy, 1); err != nil || n != 1 {
+		t.Fatalf("archive after the retention period = %d, %v, want 1", n, err)
+	}
+
+	var archived ArchivedAccount
+	decodeData(t, api.do(http.MethodGet, "/v2/admin/archive/block-account/"+closed, "").Body.Bytes(), &archived)
+	var record ArchiveRecord
+	if err := json.Unmarshal(archived.Record, &record); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if archived.ExternalID != closed || archived.Status != StatusClosed || record.Account != nil ||
+		record.History == nil || len(record.History.Entries) < 2 {
+		t.Errorf("archived = %+v with %s, want the closed account and its history", archived, archived.Record)
+	}
+	if w := api.do(http.MethodGet, "/v2/block-account/"+closed+"/history", ""); w.Code != http.StatusNotFound {
+		t.Errorf("history of archived account = %d, want 404 once purged", w.Code)
+	}
+
+	if w := api.do(http.MethodGet, "/v2/admin/archive/block-account/"+open, ""); w.Code != http.StatusNotFound || errorCode(w) != CodeAccountNotFound {
+		t.Errorf("archive of open account = %d %s, want 404", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodGet, "/v2/block-account/"+open, ""); w.Code != http.StatusOK {
+		t.Errorf("open account = %d, want it kept", w.Code)
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	t.Setenv("RETENTION_YEARS", "closed=10, funding_failed=0")
+	policy, err := retentionPolicy()
+	if err != nil || policy[StatusClosed] != 10 || policy[StatusFundingFailed] != 0 || policy[StatusMatured] != defaultRetentionYears {
+		t.Errorf("policy = %v, %v", policy, err)
+	}
+	for _, spec := range []string{"active=1", "closed", "closed=-1", "closed=ten"} {
+		t.Setenv("RETENTION_YEARS", spec)
+		if _, err := retentionPolicy(); err == nil {
+			t.Errorf("RETENTION_YEARS=%s accepted, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Scopes granted to API keys and tokens. Each includes the ones before it:
+// write may also read, and admin may do anything.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// scopeRank orders the scopes for grants
+var scopeRank = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+// Kinds of authenticated caller
+const (
+	PrincipalAPIKey = "api_key"
+	PrincipalToken  = "token"
+)
+
+// jwtLeeway is the clock skew allowed when checking a token's exp and nbf
+const jwtLeeway = 30 * time.Second
+
+const principalKey ctxKey = "principal"
+
+// errInvalidToken is returned for any JWT that fails verification; the
+// reason is logged but not told to the caller
+var errInvalidToken = errors.New("invalid token")
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// Kind is "api_key" or "token"
+	Kind string
+	// ID is the API key's ID or the token's subject
+	ID     string
+	Name   string
+	Scopes []string
+	// Tenant is the tenant the caller is bound to, empty for platform
+	// callers, which may act for any tenant
+	Tenant string
+}
+
+// grants reports whether the principal holds scope or one that includes it
+func (p *Principal) grants(scope string) bool {
+	for _, s := range p.Scopes {
+		if scopeRank[s] >= scopeRank[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// principalFromContext returns the request's authenticated caller, or nil
+func principalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
+
+// authRequired reports whether AUTH_REQUIRED turns away requests without
+// credentials. Credentials that are sent are checked either way.
+func authRequired() bool {
+	return os.Getenv("AUTH_REQUIRED") == "true"
+}
+
+// requiredScope is the scope a request needs: admin for the admin routes,
+// read for reads and write for anything else
+func requiredScope(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(unversionedPath(r.URL.Path), "/admin/"):
+		return ScopeAdmin
+	case readOnlyRequest(r):
+		return ScopeRead
+	default:
+		return ScopeWrite
+	}
+}
+
+// readOnlyRequest reports whether r only reads: a GET or HEAD, or a
+// GraphQL query, the schema having no mutations
+func readOnlyRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead || r.URL.Path == GraphQLPath
+}
+
+// credentialError is a credential that was sent but refused
+type credentialError struct {
+	Message string
+}
+
+func (e *credentialError) Error() string { return e.Message }
+
+// authenticate returns the caller named by an API key or, failing that, an
+// "Authorization: Bearer" JWT. It returns nil, nil when neither was sent and
+// a *credentialError when the one sent is refused.
+func authenticate(ctx context.Context, svc BlockAccountService, key, authorization string, logger *zap.Logger) (*Principal, error) {
+	if key != "" {
+		apiKey, err := svc.AuthenticateAPIKey(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if apiKey == nil {
+			return nil, &credentialError{"API key is invalid, expired or revoked"}
+		}
+		return &Principal{Kind: PrincipalAPIKey, ID: apiKey.Prefix, Name: apiKey.Name, Scopes: apiKey.Scopes, Tenant: apiKey.TenantID}, nil
+	}
+	bearer, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return nil, nil
+	}
+	principal, err := svc.VerifyToken(ctx, strings.TrimSpace(bearer))
+	switch {
+	case errors.Is(err, ErrIdentityProviderUnavailable):
+		loggerFromContext(ctx, logger).Error("Bearer token could not be checked", zap.Error(err))
+		return nil, err
+	case err != nil:
+		loggerFromContext(ctx, logger).Info("Bearer token refused", zap.Error(err))
+		return nil, &credentialError{"Bearer token is invalid or expired"}
+	}
+	return principal, nil
+}
+
+// VerifyToken returns the caller named by a bearer token
+func (s *service) VerifyToken(ctx context.Context, token string) (*Principal, error) {
+	if s.tokens == nil {
+		return nil, errors.New("bearer tokens are not accepted: neither JWT_SECRET nor OIDC_ISSUER is set")
+	}
+	return s.tokens.Verify(ctx, token, time.Now())
+}
+
+// withPrincipal stores the caller, and a logger naming it, in ctx
+func withPrincipal(ctx context.Context, p *Principal, logger *zap.Logger) context.Context {
+	ctx = context.WithValue(ctx, principalKey, p)
+	return withCallerFields(ctx, logger, zap.String("principal", p.Kind+":"+p.ID))
+}
+
+// AuthMiddleware authenticates the caller from an X-API-Key or a bearer JWT
+// and checks it holds the scope the route needs. Without credentials only
+// reads are let through, and only while AUTH_REQUIRED is not set; writes
+// and the admin routes always need credentials. Impersonation sessions
+// carry their own credentials and are let through.
+func AuthMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+			if !ok {
+				writeError(w, http.StatusInternalServerError, "Service not available")
+				return
+			}
+
+			principal, err := authenticate(r.Context(), svc, r.Header.Get(APIKeyHeader), r.Header.Get("Authorization"), logger)
+			var refused *credentialError
+			switch {
+			case errors.As(err, &refused):
+				writeError(w, http.StatusUnauthorized, refused.Message)
+				return
+			case errors.Is(err, ErrIdentityProviderUnavailable):
+				writeErrorCode(w, http.StatusServiceUnavailable, CodeIdentityProviderDown, "Bearer tokens cannot be checked right now")
+				return
+			case err != nil:
+				writeAPIError(w, http.StatusInternalServerError, err)
+				return
+			case principal == nil && impersonationFromContext(r.Context()) != nil,
+				principal == nil && !authRequired() && requiredScope(r) == ScopeRead:
+				next.ServeHTTP(w, r)
+				return
+			case principal == nil:
+				w.Header().Set("WWW-Authenticate", `Bearer realm="block-account"`)
+				writeError(w, http.StatusUnauthorized, "Credentials required: send X-API-Key or a bearer token")
+				return
+			}
+
+			if scope := requiredScope(r); !principal.grants(scope) {
+				writeError(w, http.StatusForbidden, "This route needs the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), principal, logger)))
+		})
+	}
+}
+
+// TokenVerifier checks a bearer token and returns the caller it names. The
+// error wraps ErrIdentityProviderUnavailable when the token could not be
+// checked; any other error refuses the token.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string, now time.Time) (*Principal, error)
+}
+
+// newTokenVerifier builds the verifier for HS256 tokens signed with
+// JWT_SECRET and tokens issued by the OIDC provider at OIDC_ISSUER, or nil
+// when neither is set. Both may be set while callers move to the provider.
+func newTokenVerifier(logger *zap.Logger) (TokenVerifier, error) {
+	oidc, err := newOIDCProvider(logger)
+	if err != nil {
+		return nil, err
+	}
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" && oidc == nil {
+		return nil, nil
+	}
+	v := &jwtVerifier{issuer: os.Getenv("JWT_ISSUER"), audience: os.Getenv("JWT_AUDIENCE"), oidc: oidc}
+	if secret != "" {
+		v.secret = []byte(secret)
+	}
+	return v, nil
+}
+
+// jwtVerifier checks JWTs: HS256 ones against the shared secret, and those
+// signed with the OIDC provider's keys against the provider
+type jwtVerifier struct {
+	secret []byte // nil when HS256 tokens are refused
+	// issuer and audience are the iss and aud HS256 tokens must carry, when set
+	issuer   string
+	audience string
+	oidc     *oidcProvider // nil when no OIDC provider is configured
+}
+
+// jwtHeader is the JOSE header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the token's signature and that it is current at now, and
+// that it names the issuer and audience expected of it
+func (v *jwtVerifier) Verify(ctx context.Context, token string, now time.Time) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	issuer, audience, scopePrefix := v.issuer, v.audience, ""
+	switch {
+	case header.Alg == "HS256" && v.secret != nil:
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errInvalidToken
+		}
+	case header.Alg != "HS256" && v.oidc != nil:
+		if err := v.oidc.verifySignature(ctx, &header, signed, sig, now); err != nil {
+			return nil, err
+		}
+		issuer, audience, scopePrefix = v.oidc.issuer, v.oidc.audience, v.oidc.scopePrefix
+	default:
+		return nil, fmt.Errorf("tokens signed with %q are not accepted", header.Alg)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errInvalidToken
+	}
+	if err := claims.validate(now, issuer, audience); err != nil {
+		return nil, err
+	}
+	name := claims.Username
+	if name == "" {
+		name = claims.Subject
+	}
+	return &Principal{Kind: PrincipalToken, ID: claims.Subject, Name: name, Scopes: claims.scopes(scopePrefix), Tenant: claims.Tenant}, nil
+}
+
+// jwtClaims are the claims read from a bearer token
+type jwtClaims struct {
+	Subject   string     `json:"sub"`
+	Issuer    string     `json:"iss"`
+	Audience  stringList `json:"aud"`
+	ExpiresAt int64      `json:"exp"`
+	NotBefore int64      `json:"nbf"`
+	// Username is the OIDC preferred_username, used to name the caller in logs
+	Username string `json:"preferred_username"`
+	// Scope is space separated, as in OAuth 2.0. Some providers send scp
+	// instead, or list API permissions in permissions, as Auth0 does.
+	Scope       string     `json:"scope"`
+	Scp         stringList `json:"scp"`
+	Permissions []string   `json:"permissions"`
+	// Tenant binds the caller to a tenant; tokens without it are platform
+	// tokens
+	Tenant string `json:"tenant_id"`
+}
+
+// scopes returns the token's recognised scopes, named with prefix
+func (c *jwtClaims) scopes(prefix string) []string {
+	granted := strings.Fields(c.Scope)
+	for _, s := range c.Scp {
+		granted = append(granted, strings.Fields(s)...)
+	}
+	granted = append(granted, c.Permissions...)
+
+	var scopes []string
+	for _, s := range granted {
+		if s, ok := strings.CutPrefix(s, prefix); ok && scopeRank[s] > 0 && !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// validate checks the token is current at now, and names issuer and
+// audience when they are set
+func (c *jwtClaims) validate(now time.Time, issuer, audience string) error {
+	switch {
+	case c.Subject == "":
+		return errors.New("token has no subject")
+	case c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(jwtLeeway)):
+		return errors.New("token has expired")
+	case c.NotBefore != 0 && now.Add(jwtLeeway).Before(time.Unix(c.NotBefore, 0)):
+		return errors.New("token is not valid yet")
+	case issuer != "" && c.Issuer != issuer:
+		return errors.New("token is from another issuer")
+	case audience != "" && !slices.Contains(c.Audience, audience):
+		return errors.New("token is for another audience")
+	}
+	return nil
+}
+
+// stringList is a claim that may be a string or a list, such as aud
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*l = stringList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*l = many
+	return nil
+}
+
+// decodeJWTPart decodes a base64url JSON segment of a token
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Actions a batch action applies to each of its accounts
+const (
+	BatchActionFreeze   = "freeze"
+	BatchActionUnfreeze = "unfreeze"
+	// BatchActionMature matures accounts past their end date without waiting
+	// for the maturity worker
+	BatchActionMature = "mature"
+)
+
+// Outcomes of a batch action for one account. Skipped accounts were already
+// in the state the action puts them in, so running a batch action again,
+// as a worker does after a crash, skips what the first run did.
+const (
+	BatchOutcomeSucceeded = "succeeded"
+	BatchOutcomeSkipped   = "skipped"
+	BatchOutcomeFailed    = "failed"
+)
+
+const (
+	// maxBatchActionAccounts is how many accounts one batch action may act on
+	maxBatchActionAccounts = 10000
+	// batchActionChunkSize is how many accounts are looked up per query
+	batchActionChunkSize = 500
+	// batchActionProgressEvery is how many accounts a batch action works
+	// through between saving its progress
+	batchActionProgressEvery = 50
+)
+
+// ErrAccountNotDue is returned when maturing an account before its end date
+var ErrAccountNotDue = newAPIError(CodeAccountNotDue, "block account has not reached its end date")
+
+// errBatchSkip is returned by a batch action's check for an account already
+// in the state the action puts it in
+var errBatchSkip = errors.New("already done")
+
+// batchActionSources are the statuses each action moves accounts out of
+var batchActionSources = map[string]string{
+	BatchActionFreeze:   StatusActive,
+	BatchActionUnfreeze: StatusFrozen,
+	BatchActionMature:   StatusActive,
+}
+
+// BatchActionFilter selects the accounts of a batch action. Only accounts
+// the action can apply to are selected: active ones to freeze or mature,
+// frozen ones to unfreeze. Every criterion given must match.
+// @Description Criteria selecting the accounts of a batch action; at least one is required
+type BatchActionFilter struct {
+	TenantID string `json:"tenant_id,omitempty" example:"acme" validate:"omitempty,tenant_id"`
+	UserIDs  []int  `json:"user_ids,omitempty" example:"123,456" validate:"omitempty,max=1000,dive,gt=0"`
+	Period   string `json:"period,omitempty" example:"1y" validate:"omitempty,period"`
+	// MaturesBefore selects accounts with an end date before it
+	MaturesBefore *time.Time `json:"matures_before,omitempty" example:"2026-01-01T00:00:00Z"`
+}
+
+// empty reports whether f has no criteria, and so would select every account
+func (f *BatchActionFilter) empty() bool {
+	return f.TenantID == "" && len(f.UserIDs) == 0 && f.Period == "" && f.MaturesBefore == nil
+}
+
+// matches reports whether a meets every criterion of f
+func (f *BatchActionFilter) matches(a *BlockAccount) bool {
+	switch {
+	case len(f.UserIDs) > 0 && !slices.Contains(f.UserIDs, a.UserID):
+		return false
+	case f.Period != "" && a.Period != f.Period:
+		return false
+	case f.MaturesBefore != nil && !a.EndDate.Before(*f.MaturesBefore):
+		return false
+	}
+	return true
+}
+
+// BatchActionRequest is the payload for acting on many accounts at once
+// @Description Action and the accounts to apply it to, listed or selected by a filter
+type BatchActionRequest struct {
+	Action     string             `json:"action" example:"freeze" validate:"oneof=freeze unfreeze mature"` // "freeze", "unfreeze" or "mature"
+	AccountIDs []string           `json:"account_ids,omitempty" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f" validate:"required_without=Filter,omitempty,min=1,max=10000,dive,external_id"`
+	Filter     *BatchActionFilter `json:"filter,omitempty"`
+	Reason     string             `json:"reason" example:"Sanctions list match, case 2291" validate:"notblank,max=500"`
+}
+
+// validateBatchAction reports what validate tags can't: the accounts are
+// listed or filtered, not both, and a filter has criteria
+func validateBatchAction(req *BatchActionRequest) error {
+	var errs validationErrors
+	switch {
+	case req.Filter != nil && len(req.AccountIDs) > 0:
+		errs.add("filter", CodeInvalidField, "give account_ids or filter, not both")
+	case req.Filter != nil && req.Filter.empty():
+		errs.add("filter", CodeFieldRequired, "filter needs at least one criterion")
+	}
+	return errs.err()
+}
+
+// BatchActionResult is what a batch action did to one account
+// @Description Outcome of a batch action for one account
+type BatchActionResult struct {
+	AccountID string `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	// Outcome is succeeded, skipped (already done) or failed
+	Outcome   string `json:"outcome" example:"failed"`
+	ErrorCode string `json:"error_code,omitempty" example:"ACCOUNT_NOT_ACTIVE"`
+	Error     string `json:"error,omitempty" example:"block account is not active"`
+}
+
+// BatchActionSummary is the result of a batch action job
+// @Description Per-account outcomes of a batch action, in the order the accounts were listed or found
+type BatchActionSummary struct {
+	Action    string              `json:"action" example:"freeze"`
+	Reason    string              `json:"reason" example:"Sanctions list match, case 2291"`
+	Accounts  int                 `json:"accounts" example:"3"`
+	Succeeded int                 `json:"succeeded" example:"2"`
+	Skipped   int                 `json:"skipped" example:"0"`
+	Failed    int                 `json:"failed" example:"1"`
+	Results   []BatchActionResult `json:"results"`
+}
+
+// add records the outcome for account id, err explaining a failure
+func (sum *BatchActionSummary) add(id, outcome string, err error) {
+	result := BatchActionResult{AccountID: id, Outcome: outcome}
+	switch outcome {
+	case BatchOutcomeSucceeded:
+		sum.Succeeded++
+	case BatchOutcomeSkipped:
+		sum.Skipped++
+	default:
+		sum.Failed++
+		result.Error, result.ErrorCode = err.Error(), CodeInternal
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			result.ErrorCode = apiErr.Code
+		}
+	}
+	sum.Results = append(sum.Results, result)
+}
+
+// QueueBatchAction queues a job applying req's action to its accounts
+func (s *service) QueueBatchAction(ctx context.Context, req *BatchActionRequest, staffID string) (*Job, error) {
+	return s.enqueueJob(ctx, JobTypeBatchAction, req, staffID)
+}
+
+// runBatchActionJob applies a batch action to each of its accounts in turn.
+// One account failing does not stop the rest; the summary reports each.
+func runBatchActionJob(ctx context.Context, s *service, job *Job, progress func(done, total int)) (any, error) {
+	var req BatchActionRequest
+	if err := json.Unmarshal(job.Payload, &req); err != nil {
+		return nil, err
+	}
+	targets, summary, err := s.batchActionTargets(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	// Listed IDs that name no account are already done
+	done, total := summary.Failed, summary.Failed+len(targets)
+	progress(done, total)
+
+	apply, err := s.batchActionFunc(ctx, req.Action)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range targets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		switch err := apply(a); {
+		case err == nil:
+			summary.add(a.ExternalID, BatchOutcomeSucceeded, nil)
+		case errors.Is(err, errBatchSkip):
+			summary.add(a.ExternalID, BatchOutcomeSkipped, nil)
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		default:
+			summary.add(a.ExternalID, BatchOutcomeFailed, err)
+		}
+		if done++; done%batchActionProgressEvery == 0 {
+			progress(done, total)
+		}
+	}
+	progress(total, total)
+
+	summary.Action, summary.Reason, summary.Accounts = req.Action, req.Reason, total
+	s.log(ctx).Info("Batch action finished", zap.Int("jobID", job.ID), zap.String("action", req.Action),
+		zap.Int("succeeded", summary.Succeeded), zap.Int("skipped", summary.Skipped), zap.Int("failed", summary.Failed),
+		zap.String("staffID", job.RequestedBy), zap.String("reason", req.Reason))
+	return summary, nil
+}
+
+// batchActionTargets returns the accounts req acts on. Listed IDs that name
+// no account are reported as failures in the summary it starts.
+func (s *service) batchActionTargets(ctx context.Context, req *BatchActionRequest) ([]*BlockAccount, *BatchActionSummary, error) {
+	summary := &BatchActionSummary{Results: []BatchActionResult{}}
+	if req.Filter == nil {
+		var targets []*BlockAccount
+		ids := make([]string, 0, len(req.AccountIDs))
+		for _, id := range req.AccountIDs {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		for chunk := range slices.Chunk(ids, batchActionChunkSize) {
+			found, err := s.GetAccountsByExternalID(ctx, chunk)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, id := range chunk {
+				if a := found[id]; a != nil {
+					targets = append(targets, a)
+					continue
+				}
+				summary.add(id, BatchOutcomeFailed, newAPIError(CodeAccountNotFound, "block account not found"))
+			}
+		}
+		return targets, summary, nil
+	}
+
+	var targets []*BlockAccount
+	statuses := []string{batchActionSources[req.Action]}
+	listCtx := ctx
+	if req.Filter.TenantID != "" {
+		listCtx = withTenant(ctx, req.Filter.TenantID)
+	}
+	for after := 0; ; {
+		accounts, err := s.repo.ListAccountsAfter(listCtx, after, statuses, batchActionChunkSize)
+		if err != nil {
+			s.log(ctx).Error("Failed to list accounts for batch action", zap.Error(err))
+			return nil, nil, err
+		}
+		for _, a := range accounts {
+			if req.Filter.matches(a) {
+				targets = append(targets, a)
+			}
+		}
+		if len(targets) > maxBatchActionAccounts {
+			return nil, nil, fmt.Errorf("filter matches more than %d accounts; narrow it", maxBatchActionAccounts)
+		}
+		if len(accounts) < batchActionChunkSize {
+			return targets, summary, nil
+		}
+		after = accounts[len(accounts)-1].ID
+	}
+}
+
+// batchActionFunc returns what action does to one account. It returns
+// errBatchSkip for an account the action was already applied to.
+func (s *service) batchActionFunc(ctx context.Context, action string) (func(*BlockAccount) error, error) {
+	switch action {
+	case BatchActionFreeze, BatchActionUnfreeze:
+		status, approval := StatusFrozen, ApprovalFreeze
+		if action == BatchActionUnfreeze {
+			status, approval = StatusActive, ApprovalUnfreeze
+		}
+		return func(a *BlockAccount) error {
+			account, err := s.repo.UpdateAccountStatus(ctx, a.ID, status, func(account *BlockAccount) error {
+				if account.Status == status {
+					return errBatchSkip
+				}
+				return checkApprovalAction(approval, account, s.Now())
+			})
+			if err == nil && account == nil {
+				return ErrAccountGone
+			}
+			return err
+		}, nil
+	case BatchActionMature:
+		plan, err := s.maturityPlan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return func(a *BlockAccount) error {
+			now := s.Now().UTC()
+			matured, err := s.repo.MatureAccount(ctx, a.ID, now, plan)
+			if err != nil || matured {
+				return err
+			}
+			// Say why it was not matured
+			current, err := s.repo.GetAccount(ctx, a.ID)
+			switch {
+			case err != nil:
+				return err
+			case current == nil:
+				return ErrAccountGone
+			case current.Status == StatusMatured || current.Status == StatusRolledOver:
+				return errBatchSkip
+			case current.Status == StatusFrozen:
+				return ErrAccountFrozen
+			case current.Status != StatusActive:
+				return ErrAccountNotActive
+			}
+			return ErrAccountNotDue
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported batch action: %s", action)
+	}
+}
+
+// batchActionHandler godoc
+// @Summary Act on many accounts at once
+// @Description Queues a job that freezes, unfreezes or matures a set of accounts, given as account_ids or selected by a filter, and returns 202 with the job. Freezes and unfreezes take effect at once, without the second approver a single account's needs, so the reason is kept with the job. Maturing only applies to accounts past their end date. Poll the job: its result lists the outcome for every account, and one account failing does not stop the rest. Requires the X-Staff-ID header.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param request body BatchActionRequest true "Action, accounts and reason"
+// @Success 202 {object} Job
+// @Header 202 {string} Location "Job status URL"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/block-accounts/batch-action [post]
+func batchActionHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req BatchActionRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if err := validateBatchAction(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := svc.QueueBatchAction(ctx, &req, staffID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	markWrite(w)
+
+	w.Header().Set("Location", jobLocation(job.ID))
+	writeSuccessStatus(w, r, http.StatusAccepted, job, "Batch action queued")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBatchAction(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	first, second, other := api.createAccount(71), api.createAccount(71), api.createAccount(72)
+	const missing = "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+
+	for _, body := range []string{
+		`{"action":"freeze","reason":"Sanctions list match"}`,
+		`{"action":"freeze","filter":{},"reason":"Sanctions list match"}`,
+		`{"action":"close","account_ids":["` + first + `"],"reason":"Sanctions list match"}`,
+		`{"action":"freeze","account_ids":["` + first + `"],"reason":" "}`,
+	} {
+		if w := api.do(http.MethodPost, "/v2/admin/block-accounts/batch-action", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d %s, want 400", body, w.Code, w.Body)
+		}
+	}
+
+	// run queues a batch action, runs it and returns its summary
+	run := func(body string) BatchActionSummary {
+		t.Helper()
+		var job Job
+		api.create(http.MethodPost, "/v2/admin/block-accounts/batch-action", body, &job)
+		if _, err := api.svc.RunJobs(ctx, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		api.create(http.MethodGet, "/v2/jobs/"+strconv.Itoa(job.ID), "", &job)
+		var summary BatchActionSummary
+		if job.Status != JobSucceeded || json.Unmarshal(job.Result, &summary) != nil {
+			t.Fatalf("job = %+v", job)
+		}
+		if job.Progress.Done != summary.Accounts || job.RequestedBy != "staff-1" {
+			t.Errorf("progress = %+v, requested by %q", job.Progress, job.RequestedBy)
+		}
+		return summary
+	}
+	outcomes := func(sum BatchActionSummary) map[string]string {
+		m := map[string]string{}
+		for _, r := range sum.Results {
+			m[r.AccountID] = r.Outcome + r.ErrorCode
+		}
+		return m
+	}
+
+	// Listed accounts, one frozen already and one that doesn't exist
+	run(`{"action":"freeze","account_ids":["` + second + `"],"reason":"Sanctions list match"}`)
+	sum := run(`{"action":"freeze","account_ids":["` + first + `","` + second + `","` + missing + `","` + first + `"],"reason":"Sanctions list match"}`)
+	want := map[string]string{first: BatchOutcomeSucceeded, second: BatchOutcomeSkipped, missing: BatchOutcomeFailed + CodeAccountNotFound}
+	if got := outcomes(sum); len(got) != 3 || got[first] != want[first] || got[second] != want[second] || got[missing] != want[missing] {
+		t.Errorf("freeze outcomes = %v, want %v", got, want)
+	}
+	if sum.Accounts != 3 || sum.Succeeded != 1 || sum.Skipped != 1 || sum.Failed != 1 {
+		t.Errorf("summary = %+v", sum)
+	}
+
+	// A filter only selects the accounts the action applies to
+	sum = run(`{"action":"unfreeze","filter":{"user_ids":[71,72]},"reason":"Cleared by compliance"}`)
+	if got := outcomes(sum); len(got) != 2 || got[first] != BatchOutcomeSucceeded || got[second] != BatchOutcomeSucceeded {
+		t.Errorf("unfreeze outcomes = %v", got)
+	}
+
+	// Only accounts past their end date mature
+	if _, err := api.db.Exec(`UPDATE block_accounts SET end_date=? WHERE external_id=?`, time.Now().Add(-time.Hour).UTC(), first); err != nil {
+		t.Fatal(err)
+	}
+	sum = run(`{"action":"mature","account_ids":["` + first + `","` + other + `"],"reason":"Matured by hand after an outage"}`)
+	if got := outcomes(sum); got[first] != BatchOutcomeSucceeded || got[other] != BatchOutcomeFailed+CodeAccountNotDue {
+		t.Errorf("mature outcomes = %v", got)
+	}
+	var account BlockAccount
+	api.create(http.MethodGet, "/v2/block-account/"+first, "", &account)
+	if account.Status != StatusMatured {
+		t.Errorf("status = %s, want matured", account.Status)
+	}
+	if got := outcomes(run(`{"action":"mature","account_ids":["` + first + `"],"reason":"Run again"}`)); got[first] != BatchOutcomeSkipped {
+		t.Errorf("maturing again = %v, want skipped", got)
+	}
+}
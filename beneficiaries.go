@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrAllocationTotal is returned when beneficiary allocations do not add up to 100%
+var ErrAllocationTotal = newAPIError(CodeInvalidAllocation, "beneficiary allocations must add up to 100%")
+
+// Beneficiary is a person a block account passes to
+// @Description A person named to receive a share of a block account, a regulatory requirement for term deposits. An account's beneficiaries' allocations add up to 100%.
+type Beneficiary struct {
+	AccountID    int    `json:"-"`
+	Name         string `json:"name" example:"Almaz Tesfaye"`
+	Relationship string `json:"relationship" example:"spouse"`
+	// AllocationPercent is the beneficiary's share of the account, in percent
+	AllocationPercent float64 `json:"allocation_percent" example:"60"`
+	// DesignatedBy is the staff ID that named the beneficiaries, or "customer"
+	DesignatedBy string    `json:"designated_by,omitempty" example:"customer"`
+	DesignatedAt time.Time `json:"designated_at"`
+}
+
+// BeneficiaryRequest names one beneficiary
+// @Description A beneficiary to name on a block account
+type BeneficiaryRequest struct {
+	Name              string  `json:"name" example:"Almaz Tesfaye" validate:"notblank,max=200"`
+	Relationship      string  `json:"relationship" example:"spouse" validate:"notblank,max=50"`
+	AllocationPercent float64 `json:"allocation_percent" example:"60" validate:"gt=0,lte=100"`
+}
+
+// BeneficiariesRequest replaces an account's beneficiaries
+// @Description Request payload naming every beneficiary of a block account. Allocations are percentages with at most two decimals and must add up to 100.
+type BeneficiariesRequest struct {
+	Beneficiaries []BeneficiaryRequest `json:"beneficiaries" validate:"required,min=1,max=10,dive"`
+}
+
+// GetBeneficiaries returns the account's beneficiaries in the order they
+// were named, and sql.ErrNoRows when the account does not exist
+func (s *service) GetBeneficiaries(ctx context.Context, accountID int) ([]*Beneficiary, error) {
+	account, err := s.repo.GetAccount(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	if account == nil {
+		return nil, sql.ErrNoRows
+	}
+	beneficiaries, err := s.repo.ListBeneficiaries(ctx, []int{accountID})
+	if err != nil {
+		s.log(ctx).Error("Failed to list beneficiaries", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	if beneficiaries == nil {
+		beneficiaries = []*Beneficiary{}
+	}
+	return beneficiaries, nil
+}
+
+// SetBeneficiaries replaces the account's beneficiaries, whose allocations
+// must add up to 100%. Only its primary holder may name them. It returns
+// sql.ErrNoRows when the account does not exist.
+func (s *service) SetBeneficiaries(ctx context.Context, accountID int, actor string, req *BeneficiariesRequest) ([]*Beneficiary, error) {
+	var total float64
+	now := time.Now().UTC()
+	beneficiaries := make([]*Beneficiary, len(req.Beneficiaries))
+	for i, b := range req.Beneficiaries {
+		beneficiaries[i] = &Beneficiary{
+			AccountID:         accountID,
+			Name:              b.Name,
+			Relationship:      b.Relationship,
+			AllocationPercent: roundMoney(b.AllocationPercent),
+			DesignatedBy:      actor,
+			DesignatedAt:      now,
+		}
+		total += beneficiaries[i].AllocationPercent
+	}
+	if math.Round(total*100) != 100*100 {
+		return nil, ErrAllocationTotal
+	}
+
+	if err := s.replaceBeneficiaries(ctx, accountID, beneficiaries); err != nil {
+		return nil, err
+	}
+	s.log(ctx).Info("Beneficiaries designated", zap.Int("accountID", accountID),
+		zap.Int("beneficiaries", len(beneficiaries)), zap.String("by", actor))
+	return beneficiaries, nil
+}
+
+// RemoveBeneficiaries clears the account's beneficiaries. Only its primary
+// holder may. It returns sql.ErrNoRows when the account does not exist.
+func (s *service) RemoveBeneficiaries(ctx context.Context, accountID int) error {
+	if err := s.replaceBeneficiaries(ctx, accountID, nil); err != nil {
+		return err
+	}
+	s.log(ctx).Info("Beneficiaries removed", zap.Int("accountID", accountID))
+	return nil
+}
+
+// replaceBeneficiaries stores beneficiaries in place of the account's
+// current ones, once the request is found to act for its primary holder
+func (s *service) replaceBeneficiaries(ctx context.Context, accountID int, beneficiaries []*Beneficiary) error {
+	account, err := s.repo.GetAccount(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account", zap.Error(err), zap.Int("accountID", accountID))
+		return err
+	}
+	if account == nil {
+		return sql.ErrNoRows
+	}
+	if err := checkPrimaryHolder(ctx, account); err != nil {
+		return err
+	}
+	if err := s.repo.ReplaceBeneficiaries(ctx, accountID, beneficiaries); err != nil {
+		s.log(ctx).Error("Failed to replace beneficiaries", zap.Error(err), zap.Int("accountID", accountID))
+		return err
+	}
+	return nil
+}
+
+// getBeneficiariesHandler godoc
+// @Summary List an account's beneficiaries
+// @Description The people the account passes to, in the order they were named, with their share of it. An account without beneficiaries lists none.
+// @Tags block-account
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]Beneficiary}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/beneficiaries [get]
+func getBeneficiariesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	beneficiaries, err := svc.GetBeneficiaries(ctx, id)
+	if err == sql.ErrNoRows {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeList(w, r, page, beneficiaries, "Beneficiaries retrieved successfully")
+}
+
+// setBeneficiariesHandler godoc
+// @Summary Name an account's beneficiaries
+// @Description Replaces the account's beneficiaries with up to 10 people whose allocation percentages add up to 100. Beneficiaries carry over when the account rolls over and are listed on the holder's interest certificate. When X-User-ID is sent it must name the primary holder.
+// @Tags block-account
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param X-User-ID header int false "Customer the request acts for, set by the gateway"
+// @Param beneficiaries body BeneficiariesRequest true "Every beneficiary of the account"
+// @Success 200 {array} Beneficiary
+// @Failure 400 {object} ErrorResponse "Invalid beneficiary, or allocations do not add up to 100"
+// @Failure 403 {object} ErrorResponse "X-User-ID is not the primary holder"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/beneficiaries [put]
+func setBeneficiariesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	var req BeneficiariesRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	beneficiaries, err := svc.SetBeneficiaries(ctx, id, requestActor(r), &req)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	case ErrAllocationTotal:
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	case ErrPrimaryHolderRequired:
+		writeAPIError(w, http.StatusForbidden, err)
+		return
+	default:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, beneficiaries, "Beneficiaries designated successfully")
+}
+
+// removeBeneficiariesHandler godoc
+// @Summary Remove an account's beneficiaries
+// @Description Clears every beneficiary of the account. When X-User-ID is sent it must name the primary holder.
+// @Tags block-account
+// @Param id path string true "Account ID" Format(uuid)
+// @Param X-User-ID header int false "Customer the request acts for, set by the gateway"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "X-User-ID is not the primary holder"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/beneficiaries [delete]
+func removeBeneficiariesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	switch err := svc.RemoveBeneficiaries(ctx, id); err {
+	case nil:
+	case sql.ErrNoRows:
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	case ErrPrimaryHolderRequired:
+		writeAPIError(w, http.StatusForbidden, err)
+		return
+	default:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	w.WriteHeader(http.StatusNoContent)
+}
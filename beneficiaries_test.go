@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBeneficiaries(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(1)
+	path := "/v2/block-account/" + id + "/beneficiaries"
+
+	tests := []struct {
+		name    string
+		body    string
+		headers []string
+		status  int
+		code    string
+	}{
+		{"short of 100%", `{"beneficiaries":[{"name":"Almaz","relationship":"spouse","allocation_percent":60},{"name":"Dawit","relationship":"son","allocation_percent":30}]}`,
+			nil, http.StatusBadRequest, CodeInvalidAllocation},
+		{"over 100%", `{"beneficiaries":[{"name":"Almaz","relationship":"spouse","allocation_percent":60},{"name":"Dawit","relationship":"son","allocation_percent":40.01}]}`,
+			nil, http.StatusBadRequest, CodeInvalidAllocation},
+		{"none", `{"beneficiaries":[]}`, nil, http.StatusBadRequest, CodeInvalidField},
+		{"blank name", `{"beneficiaries":[{"name":" ","relationship":"spouse","allocation_percent":100}]}`, nil, http.StatusBadRequest, CodeFieldRequired},
+		{"zero allocation", `{"beneficiaries":[{"name":"Almaz","relationship":"spouse","allocation_percent":0},{"name":"Dawit","relationship":"son","allocation_percent":100}]}`,
+			nil, http.StatusBadRequest, CodeInvalidField},
+		{"by a co-holder", `{"beneficiaries":[{"name":"Almaz","relationship":"spouse","allocation_percent":100}]}`,
+			[]string{UserIDHeader, "2"}, http.StatusForbidden, CodePrimaryHolderRequired},
+		{"thirds", `{"beneficiaries":[{"name":"Almaz","relationship":"spouse","allocation_percent":33.34},{"name":"Dawit","relationship":"son","allocation_percent":33.33},{"name":"Hana","relationship":"daughter","allocation_percent":33.33}]}`,
+			[]string{UserIDHeader, "1"}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := api.do(http.MethodPut, path, tt.body, tt.headers...)
+			if w.Code != tt.status || errorCode(w) != tt.code {
+				t.Errorf("PUT %s = %d %s, want %d %s", path, w.Code, w.Body, tt.status, tt.code)
+			}
+		})
+	}
+
+	var listed struct {
+		Items []*Beneficiary `json:"items"`
+	}
+	decodeData(t, api.do(http.MethodGet, path, "").Body.Bytes(), &listed)
+	if len(listed.Items) != 3 || listed.Items[0].Name != "Almaz" || listed.Items[0].AllocationPercent != 33.34 || listed.Items[2].Relationship != "daughter" {
+		t.Errorf("beneficiaries = %+v, want Almaz, Dawit and Hana in order", listed.Items)
+	}
+
+	var cert TaxCertificate
+	year := time.Now().In(businessLocation()).Year()
+	decodeData(t, api.do(http.MethodGet, "/v2/user/1/tax-certificate?year="+strconv.Itoa(year), "").Body.Bytes(), &cert)
+	if len(cert.Accounts) != 1 || len(cert.Accounts[0].Beneficiaries) != 3 {
+		t.Errorf("certificate lines = %+v, want the account with its 3 beneficiaries", cert.Accounts)
+	}
+
+	if w := api.do(http.MethodDelete, path, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("remove: %d %s", w.Code, w.Body)
+	}
+	decodeData(t, api.do(http.MethodGet, path, "").Body.Bytes(), &listed)
+	if len(listed.Items) != 0 {
+		t.Errorf("beneficiaries after removal = %+v, want none", listed.Items)
+	}
+}
@@ -0,0 +1,120 @@
+package blockaccounttest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// PostgresImage is the image StartPostgres runs, the oldest PostgreSQL the
+// migrations support
+const PostgresImage = "postgres:16-alpine"
+
+// PostgresURLEnv names an existing database for StartPostgres to use instead
+// of starting one, e.g. a CI service container. It must be empty: tests
+// migrate it from scratch.
+const PostgresURLEnv = "BLOCKACCOUNT_TEST_POSTGRES_URL"
+
+// postgresStartTimeout bounds pulling the image and starting the database
+const postgresStartTimeout = 2 * time.Minute
+
+// Postgres is a database for a test, empty until the test migrates it
+type Postgres struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+	// URL is the connection string of the database
+	URL string
+}
+
+// StartPostgres returns an empty PostgreSQL database for tb, started in a
+// container with testcontainers and removed when tb finishes. It skips tb
+// when Docker isn't available, unless PostgresURLEnv names a database to use
+// instead.
+func StartPostgres(tb testing.TB) *Postgres {
+	tb.Helper()
+	if raw := os.Getenv(PostgresURLEnv); raw != "" {
+		db, err := parsePostgresURL(raw)
+		if err != nil {
+			tb.Fatalf("%s: %v", PostgresURLEnv, err)
+		}
+		return db
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresStartTimeout)
+	defer cancel()
+	if err := dockerHealth(ctx); err != nil {
+		tb.Skipf("Docker isn't available to start PostgreSQL, set %s to use an existing database: %v", PostgresURLEnv, err)
+	}
+
+	container, err := postgres.Run(ctx, PostgresImage,
+		postgres.WithDatabase("block_account_test"),
+		postgres.WithUsername("blockaccount"),
+		postgres.WithPassword("blockaccount"),
+		postgres.BasicWaitStrategies())
+	testcontainers.CleanupContainer(tb, container)
+	if err != nil {
+		tb.Fatalf("start postgres: %v", err)
+	}
+	raw, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		tb.Fatalf("postgres connection string: %v", err)
+	}
+	db, err := parsePostgresURL(raw)
+	if err != nil {
+		tb.Fatalf("postgres connection string: %v", err)
+	}
+	return db
+}
+
+// dockerHealth returns why Docker can't run containers, or nil when it can.
+// testcontainers panics when it finds no Docker host at all, which is
+// reported as an error too.
+func dockerHealth(ctx context.Context) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+	return provider.Health(ctx)
+}
+
+// parsePostgresURL splits a postgres:// URL into its settings
+func parsePostgresURL(raw string) (*Postgres, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return nil, fmt.Errorf("not a postgres URL: %s", u.Redacted())
+	}
+	port := 5432
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, fmt.Errorf("invalid port: %s", p)
+		}
+	}
+	password, _ := u.User.Password()
+	return &Postgres{
+		Host:     u.Hostname(),
+		Port:     port,
+		User:     u.User.Username(),
+		Password: password,
+		Database: u.Path[min(1, len(u.Path)):],
+		URL:      raw,
+	}, nil
+}
@@ -0,0 +1,635 @@
+// Package blockaccounttest provides test doubles of the Block Account API for
+// programs that call it through package client, and helpers for the
+// service's own integration tests.
+//
+// Server is an in-memory stand-in for the service's account API. It keeps
+// accounts in a map, speaks the same envelopes, status codes, error codes,
+// ETags, pagination and idempotency keys the service does, masks account
+// numbers as it does, and can be made to fail, so client code can be tested
+// without a database:
+//
+//	srv := blockaccounttest.NewServer(t)
+//	c := srv.Client()
+//	account, err := c.CreateAccount(ctx, client.CreateAccountRequest{UserID: 1, Principal: 1000, Period: "1y"})
+//
+// It models the account lifecycle only as far as the client needs: deposits
+// mature on the same day of the month their term later, with no business day
+// adjustment, and nothing matures on its own.
+package blockaccounttest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"main.go/client"
+)
+
+// Error codes the Server answers with, as the service does
+const (
+	CodeInvalidRequest       = "INVALID_REQUEST"
+	CodeValidationFailed     = "VALIDATION_FAILED"
+	CodeInvalidPeriod        = "INVALID_PERIOD"
+	CodeInvalidUserID        = "INVALID_USER_ID"
+	CodeInvalidAmount        = "INVALID_AMOUNT"
+	CodeInvalidFrequency     = "INVALID_PAYOUT_FREQUENCY"
+	CodeInvalidCursor        = "INVALID_CURSOR"
+	CodeAccountNotFound      = "ACCOUNT_NOT_FOUND"
+	CodeAccountNotActive     = "ACCOUNT_NOT_ACTIVE"
+	CodeAccountChanged       = "ACCOUNT_CHANGED"
+	CodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	CodePreconditionRequired = "PRECONDITION_REQUIRED"
+	CodeNotImplemented       = "NOT_IMPLEMENTED"
+)
+
+// Pages hold defaultPageLimit items unless a request asks for up to
+// maxPageLimit, as the service's do
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// defaultMaturingWindow is the window of the maturing-soon listing when the
+// request names none
+const defaultMaturingWindow = 30
+
+// Products are the deposit products the Server offers, the service's
+// built-in rate plan
+var Products = []client.Product{
+	{Period: "3m", Name: "3-month deposit", Months: 3, Rate: 0.02, EarlyWithdrawal: "allowed"},
+	{Period: "6m", Name: "6-month deposit", Months: 6, Rate: 0.035, EarlyWithdrawal: "allowed"},
+	{Period: "1y", Name: "1-year deposit", Months: 12, Rate: 0.05, EarlyWithdrawal: "allowed"},
+	{Period: "3y", Name: "3-year deposit", Months: 36, Rate: 0.10, EarlyWithdrawal: "allowed"},
+}
+
+// Server is an in-memory Block Account API. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	accounts map[string]*client.Account
+	// order is the IDs of accounts in the order they were added
+	order []string
+	// created maps the idempotency key of each create to the account it made
+	created map[string]idempotentCreate
+	// failures are the responses the next requests get instead of being served
+	failures []int
+	// requests counts the API requests served, failed ones included
+	requests int
+}
+
+// idempotentCreate is the account a create opened and the request it was for
+type idempotentCreate struct {
+	id  string
+	req client.CreateAccountRequest
+}
+
+// NewServer starts a Server that tb closes when it finishes
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+	s := &Server{accounts: map[string]*client.Account{}, created: map[string]idempotentCreate{}}
+	s.Server = httptest.NewServer(s.routes())
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a client of the Server. Its retries don't back off, so
+// tests of failures stay fast; opts may override that.
+func (s *Server) Client(opts ...client.Option) *client.Client {
+	opts = append([]client.Option{client.WithRetry(3, time.Millisecond, time.Millisecond)}, opts...)
+	return client.New(s.URL, opts...)
+}
+
+// AddAccount stores a copy of account as it is, filling in what it leaves
+// out the way the service would: an ID, an active status, the term's rate
+// and dates from now, and the payout instruction and frequency defaults.
+// It returns the stored account.
+func (s *Server) AddAccount(account client.Account) *client.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if account.ID == "" {
+		account.ID = uuid.NewString()
+	}
+	if account.Status == "" {
+		account.Status = "active"
+	}
+	if account.TenantID == "" {
+		account.TenantID = "default"
+	}
+	if account.MaturityInstruction == "" {
+		account.MaturityInstruction = "payout"
+	}
+	if account.PayoutFrequency == "" {
+		account.PayoutFrequency = "at_maturity"
+	}
+	if account.StartDate.IsZero() {
+		account.StartDate = now
+	}
+	if product, ok := productOf(account.Period); ok {
+		if account.InterestRate == 0 {
+			account.InterestRate = product.Rate
+		}
+		if account.EndDate.IsZero() {
+			account.EndDate = account.StartDate.AddDate(0, product.Months, 0)
+		}
+	}
+	if account.CreatedAt.IsZero() {
+		account.CreatedAt = now
+	}
+	if account.UpdatedAt.IsZero() {
+		account.UpdatedAt = account.CreatedAt
+	}
+	account.ETag = etag(&account)
+
+	if _, ok := s.accounts[account.ID]; !ok {
+		s.order = append(s.order, account.ID)
+	}
+	s.accounts[account.ID] = &account
+	stored := account
+	return &stored
+}
+
+// Account returns a copy of the account with the ID id, as it is now
+func (s *Server) Account(id string) (*client.Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *account
+	return &copied, true
+}
+
+// Accounts returns copies of every account, oldest first
+func (s *Server) Accounts() []*client.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accounts := make([]*client.Account, 0, len(s.order))
+	for _, id := range s.order {
+		copied := *s.accounts[id]
+		accounts = append(accounts, &copied)
+	}
+	return accounts
+}
+
+// FailNext makes the next n API requests fail with status, before they
+// change anything. A 429 or 503 carries Retry-After so clients retry it.
+func (s *Server) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Requests returns how many API requests the Server has answered, failed
+// ones included
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// routes returns the handler of the API routes the Server serves. Routes
+// the client has but the Server doesn't model answer 501.
+func (s *Server) routes() http.Handler {
+	r := chi.NewRouter()
+	r.Use(s.countAndFail)
+	r.Route("/v2", func(r chi.Router) {
+		r.Get("/products", s.listProducts)
+		r.Post("/block-account", s.createAccount)
+		r.Get("/block-account/{id}", s.getAccount)
+		r.Delete("/block-account/{id}", s.deleteAccount)
+		r.Post("/block-account/{id}/close", s.closeAccount)
+		r.Put("/block-account/{id}/maturity-instruction", s.changeMaturityInstruction)
+		r.Get("/user/{userID}/block-accounts", s.listUserAccounts)
+		r.Get("/admin/block-accounts/maturing-soon", s.listMaturingSoon)
+	})
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotImplemented, CodeNotImplemented, r.Method+" "+r.URL.Path+" is not modelled by blockaccounttest.Server")
+	})
+	return r
+}
+
+// countAndFail counts requests and answers the ones FailNext asked to fail
+func (s *Server) countAndFail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		status := 0
+		if len(s.failures) > 0 {
+			status, s.failures = s.failures[0], s.failures[1:]
+		}
+		s.mu.Unlock()
+
+		if status == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "0")
+		}
+		writeError(w, status, genericCode(status), "failure injected by blockaccounttest.Server")
+	})
+}
+
+func (s *Server) listProducts(w http.ResponseWriter, r *http.Request) {
+	writeList(w, r, Products)
+}
+
+func (s *Server) createAccount(w http.ResponseWriter, r *http.Request) {
+	var req client.CreateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+	if req.Period == "" {
+		req.Period = req.ProductCode
+	}
+	product, ok := productOf(req.Period)
+	switch {
+	case req.UserID < 1:
+		writeError(w, http.StatusBadRequest, CodeInvalidUserID, "user_id must be positive")
+		return
+	case req.Principal <= 0:
+		writeError(w, http.StatusBadRequest, CodeInvalidAmount, "principal must be positive")
+		return
+	case !ok:
+		writeError(w, http.StatusBadRequest, CodeInvalidPeriod,
+			fmt.Sprintf("invalid period: %s. Valid options are: 3m, 6m, 1y, 3y", req.Period))
+		return
+	}
+	frequency := req.PayoutFrequency
+	switch frequency {
+	case "":
+		frequency = "at_maturity"
+	case "at_maturity", "monthly", "quarterly":
+	default:
+		writeError(w, http.StatusBadRequest, CodeInvalidFrequency,
+			fmt.Sprintf("invalid payout_frequency: %s. Valid options are: at_maturity, monthly, quarterly", frequency))
+		return
+	}
+
+	// A retried create gets the account its first attempt made; the key
+	// cannot be used for another request
+	key := r.Header.Get(client.IdempotencyKeyHeader)
+	s.mu.Lock()
+	earlier, replayed := s.created[key]
+	s.mu.Unlock()
+	if key != "" && replayed {
+		if account, ok := s.Account(earlier.id); ok {
+			if earlier.req != req {
+				writeError(w, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused,
+					"the Idempotency-Key was sent before with a different request")
+				return
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeAccount(w, http.StatusCreated, account)
+			return
+		}
+	}
+
+	account := s.AddAccount(client.Account{
+		UserID:          req.UserID,
+		Principal:       req.Principal,
+		Period:          req.Period,
+		InterestRate:    product.Rate,
+		PayoutFrequency: frequency,
+	})
+	if key != "" {
+		s.mu.Lock()
+		s.created[key] = idempotentCreate{id: account.ID, req: req}
+		s.mu.Unlock()
+	}
+	writeAccount(w, http.StatusCreated, account)
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := s.Account(chi.URLParam(r, "id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+	if r.Header.Get("If-None-Match") == account.ETag {
+		w.Header().Set("ETag", account.ETag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeAccount(w, http.StatusOK, account)
+}
+
+func (s *Server) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := chi.URLParam(r, "id")
+	account, ok := s.accounts[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+	if !checkIfMatch(w, r, account) {
+		return
+	}
+	delete(s.accounts, id)
+	for i, ordered := range s.order {
+		if ordered == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// closeAccount moves the account to closing. Its final payout is its
+// principal, as the Server accrues no interest, and is never sent.
+func (s *Server) closeAccount(w http.ResponseWriter, r *http.Request) {
+	var req client.CloseAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+	switch {
+	case strings.TrimSpace(req.DestinationAccount) == "":
+		writeError(w, http.StatusBadRequest, CodeValidationFailed, "destination_account is required")
+		return
+	case req.Method != "bank_transfer" && req.Method != "internal_transfer":
+		writeError(w, http.StatusBadRequest, CodeValidationFailed, "method must be one of: bank_transfer internal_transfer")
+		return
+	}
+
+	s.mu.Lock()
+	account, ok := s.accounts[chi.URLParam(r, "id")]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+	if !checkIfMatch(w, r, account) {
+		s.mu.Unlock()
+		return
+	}
+	if account.Status != "active" {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, CodeAccountNotActive, "block account is not active")
+		return
+	}
+	account.Status = "closing"
+	account.Closure = &client.Closure{
+		DestinationAccount: req.DestinationAccount,
+		Method:             req.Method,
+		Amount:             account.Principal,
+		RequestedAt:        time.Now().UTC(),
+	}
+	touch(account)
+	updated := *account
+	s.mu.Unlock()
+
+	writeAccount(w, http.StatusAccepted, &updated)
+}
+
+func (s *Server) changeMaturityInstruction(w http.ResponseWriter, r *http.Request) {
+	var req client.MaturityInstructionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request payload")
+		return
+	}
+	switch {
+	case req.Instruction != "payout" && req.Instruction != "rollover":
+		writeError(w, http.StatusBadRequest, CodeValidationFailed, "instruction must be one of: payout rollover")
+		return
+	case req.Instruction == "payout" && req.DestinationAccount == "":
+		writeError(w, http.StatusBadRequest, CodeValidationFailed, "destination_account is required when instruction is payout")
+		return
+	}
+
+	s.mu.Lock()
+	account, ok := s.accounts[chi.URLParam(r, "id")]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+	if !checkIfMatch(w, r, account) {
+		s.mu.Unlock()
+		return
+	}
+	if account.Status != "active" {
+		s.mu.Unlock()
+		writeError(w, http.StatusUnprocessableEntity, CodeAccountNotActive, "block account is not active")
+		return
+	}
+	account.MaturityInstruction = req.Instruction
+	account.PayoutDestination = req.DestinationAccount
+	touch(account)
+	updated := *account
+	s.mu.Unlock()
+
+	writeAccount(w, http.StatusOK, &updated)
+}
+
+func (s *Server) listUserAccounts(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil || userID < 1 {
+		writeError(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID")
+		return
+	}
+	var accounts []*client.Account
+	for _, a := range s.Accounts() {
+		if a.UserID == userID {
+			accounts = append(accounts, masked(a))
+		}
+	}
+	// Newest first, as the service lists them
+	for i, j := 0, len(accounts)-1; i < j; i, j = i+1, j-1 {
+		accounts[i], accounts[j] = accounts[j], accounts[i]
+	}
+	writeList(w, r, accounts)
+}
+
+func (s *Server) listMaturingSoon(w http.ResponseWriter, r *http.Request) {
+	days := defaultMaturingWindow
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, CodeValidationFailed, "days must be a positive integer")
+			return
+		}
+		days = n
+	}
+	now := time.Now().UTC()
+	until := now.AddDate(0, 0, days)
+	var accounts []*client.Account
+	for _, a := range s.Accounts() {
+		if a.Status == "active" && a.EndDate.After(now) && !a.EndDate.After(until) {
+			accounts = append(accounts, masked(a))
+		}
+	}
+	sort.SliceStable(accounts, func(i, j int) bool { return accounts[i].EndDate.Before(accounts[j].EndDate) })
+	writeList(w, r, accounts)
+}
+
+// checkIfMatch writes a 428 or 412 and returns false unless r's If-Match
+// names account's current ETag
+func checkIfMatch(w http.ResponseWriter, r *http.Request, account *client.Account) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeError(w, http.StatusPreconditionRequired, CodePreconditionRequired, "send the account's ETag in If-Match to change it")
+		return false
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == account.ETag {
+			return true
+		}
+	}
+	writeError(w, http.StatusPreconditionFailed, CodeAccountChanged, "block account has changed since it was read; fetch it again")
+	return false
+}
+
+// touch moves account's updated_at, and so its ETag, past its last version
+func touch(account *client.Account) {
+	now := time.Now().UTC()
+	if !now.After(account.UpdatedAt) {
+		now = account.UpdatedAt.Add(time.Nanosecond)
+	}
+	account.UpdatedAt = now
+	account.ETag = etag(account)
+}
+
+// etag is the account's ETag as the service computes it, from updated_at
+func etag(account *client.Account) string {
+	return `"` + strconv.FormatInt(account.UpdatedAt.UnixNano(), 36) + `"`
+}
+
+// productOf returns the product of period
+func productOf(period string) (client.Product, bool) {
+	for _, p := range Products {
+		if p.Period == period {
+			return p, true
+		}
+	}
+	return client.Product{}, false
+}
+
+// writeAccount writes account with its ETag
+func writeAccount(w http.ResponseWriter, status int, account *client.Account) {
+	w.Header().Set("ETag", account.ETag)
+	writeData(w, status, masked(account))
+}
+
+// masked returns a copy of account with its account numbers masked, as the
+// service returns them
+func masked(account *client.Account) *client.Account {
+	copied := *account
+	copied.PayoutDestination = maskAccountNumber(account.PayoutDestination)
+	if account.Funding != nil {
+		funding := *account.Funding
+		funding.SettlementAccount = maskAccountNumber(funding.SettlementAccount)
+		copied.Funding = &funding
+	}
+	if account.Closure != nil {
+		closure := *account.Closure
+		closure.DestinationAccount = maskAccountNumber(closure.DestinationAccount)
+		copied.Closure = &closure
+	}
+	return &copied
+}
+
+// maskAccountNumber hides all but the last four characters of number
+func maskAccountNumber(number string) string {
+	if len(number) <= 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+}
+
+// writeList writes the page of items r asks for
+func writeList[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	limit := defaultPageLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err == nil {
+			offset, err = strconv.Atoi(string(raw))
+		}
+		if err != nil || offset < 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidCursor, "invalid cursor")
+			return
+		}
+	}
+
+	page := struct {
+		Items      []T    `json:"items"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		Limit      int    `json:"limit"`
+	}{Items: []T{}, Limit: limit}
+	if offset < len(items) {
+		end := min(offset+limit, len(items))
+		page.Items = items[offset:end]
+		if end < len(items) {
+			page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+		}
+	}
+	writeData(w, http.StatusOK, page)
+}
+
+// writeData writes data in the success envelope
+func writeData(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "data": data})
+}
+
+// writeError writes the error envelope
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":      http.StatusText(status),
+		"code":       status,
+		"message":    message,
+		"error_code": code,
+	})
+}
+
+// genericCode is the error code the service gives a status when nothing more
+// specific applies
+func genericCode(status int) string {
+	switch status {
+	case http.StatusTooManyRequests:
+		return "RATE_LIMITED"
+	case http.StatusServiceUnavailable:
+		return "SERVICE_UNAVAILABLE"
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return "UPSTREAM_FAILED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusConflict:
+		return "CONFLICT"
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	default:
+		return "INTERNAL_ERROR"
+	}
+}
@@ -0,0 +1,243 @@
+package blockaccounttest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"main.go/blockaccounttest"
+	"main.go/client"
+)
+
+func TestServerCreateAndGet(t *testing.T) {
+	ctx := context.Background()
+	srv := blockaccounttest.NewServer(t)
+	c := srv.Client()
+
+	created, err := c.CreateAccount(ctx, client.CreateAccountRequest{UserID: 7, Principal: 1000, Period: "1y"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.Status != "active" || created.InterestRate != 0.05 || created.ETag == "" {
+		t.Errorf("created = %+v, want an active 1y account at 5%% with an ETag", created)
+	}
+	if want := created.StartDate.AddDate(1, 0, 0); !created.EndDate.Equal(want) {
+		t.Errorf("end date = %v, want %v", created.EndDate, want)
+	}
+
+	got, err := c.GetAccount(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.ID != created.ID || got.ETag != created.ETag {
+		t.Errorf("get = %+v, want %+v", got, created)
+	}
+
+	_, err = c.GetAccount(ctx, "missing")
+	if !client.IsNotFound(err) || client.ErrorCode(err) != blockaccounttest.CodeAccountNotFound {
+		t.Errorf("get missing: err = %v, want %s", err, blockaccounttest.CodeAccountNotFound)
+	}
+}
+
+func TestServerCreateValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		req  client.CreateAccountRequest
+		code string
+	}{
+		{"no user", client.CreateAccountRequest{Principal: 1000, Period: "1y"}, blockaccounttest.CodeInvalidUserID},
+		{"no principal", client.CreateAccountRequest{UserID: 1, Period: "1y"}, blockaccounttest.CodeInvalidAmount},
+		{"unknown period", client.CreateAccountRequest{UserID: 1, Principal: 1000, Period: "2y"}, blockaccounttest.CodeInvalidPeriod},
+		{"unknown frequency", client.CreateAccountRequest{UserID: 1, Principal: 1000, Period: "1y", PayoutFrequency: "weekly"}, blockaccounttest.CodeInvalidFrequency},
+	}
+	srv := blockaccounttest.NewServer(t)
+	c := srv.Client()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.CreateAccount(context.Background(), tt.req)
+			if code := client.ErrorCode(err); code != tt.code {
+				t.Errorf("error code = %q (%v), want %q", code, err, tt.code)
+			}
+		})
+	}
+	if n := len(srv.Accounts()); n != 0 {
+		t.Errorf("%d accounts stored, want none", n)
+	}
+}
+
+func TestServerIdempotentCreate(t *testing.T) {
+	srv := blockaccounttest.NewServer(t)
+	c := srv.Client()
+	ctx := client.WithIdempotencyKey(context.Background(), "create-1")
+
+	first, err := c.CreateAccount(ctx, client.CreateAccountRequest{UserID: 1, Principal: 500, Period: "3m"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	second, err := c.CreateAccount(ctx, client.CreateAccountRequest{UserID: 1, Principal: 500, Period: "3m"})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("replayed create made %s, want %s", second.ID, first.ID)
+	}
+	if n := len(srv.Accounts()); n != 1 {
+		t.Errorf("%d accounts stored, want 1", n)
+	}
+}
+
+func TestServerChangesNeedIfMatch(t *testing.T) {
+	srv := blockaccounttest.NewServer(t)
+	c := srv.Client()
+	account := srv.AddAccount(client.Account{UserID: 1, Principal: 1000, Period: "6m"})
+	rollover := client.MaturityInstructionRequest{Instruction: "rollover"}
+
+	tests := []struct {
+		name   string
+		etag   string
+		status int
+	}{
+		{"without If-Match", "", http.StatusPreconditionRequired},
+		{"stale ETag", `"stale"`, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := client.WithIfMatch(context.Background(), tt.etag)
+			_, err := c.ChangeMaturityInstruction(ctx, account.ID, rollover)
+			var apiErr *client.Error
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Errorf("change: err = %v, want a %d", err, tt.status)
+			}
+		})
+	}
+
+	changed, err := c.ChangeMaturityInstruction(client.WithIfMatch(context.Background(), account.ETag), account.ID, rollover)
+	if err != nil {
+		t.Fatalf("change: %v", err)
+	}
+	if changed.MaturityInstruction != "rollover" || changed.ETag == account.ETag {
+		t.Errorf("changed = %+v, want a rollover with a new ETag", changed)
+	}
+
+	// The ETag read before the change no longer deletes the account
+	if err := c.DeleteAccount(client.WithIfMatch(context.Background(), account.ETag), account.ID); err == nil {
+		t.Fatal("delete with a stale ETag succeeded")
+	}
+	if err := c.DeleteAccount(client.WithIfMatch(context.Background(), changed.ETag), account.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := srv.Account(account.ID); ok {
+		t.Error("deleted account is still stored")
+	}
+}
+
+func TestServerCloseAccount(t *testing.T) {
+	srv := blockaccounttest.NewServer(t)
+	c := srv.Client()
+	account := srv.AddAccount(client.Account{UserID: 1, Principal: 1000, Period: "6m"})
+	ctx := client.WithIfMatch(context.Background(), account.ETag)
+	req := client.CloseAccountRequest{DestinationAccount: "1000123456789", Method: "bank_transfer"}
+
+	closing, err := c.CloseAccount(ctx, account.ID, req)
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if closing.Status != "closing" || closing.Closure == nil || closing.Closure.Amount != 1000 {
+		t.Errorf("closed = %+v, want closing with a closure of 1000", closing)
+	}
+
+	// A closing account cannot be closed again
+	_, err = c.CloseAccount(client.WithIfMatch(context.Background(), closing.ETag), account.ID, req)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("second close: err = %v, want a 409", err)
+	}
+}
+
+func TestServerListsPageByPage(t *testing.T) {
+	srv := blockaccounttest.NewServer(t)
+	const total = 230
+	for i := 0; i < total; i++ {
+		srv.AddAccount(client.Account{UserID: 3, Principal: float64(100 + i), Period: "1y"})
+	}
+	srv.AddAccount(client.Account{UserID: 4, Principal: 100, Period: "1y"})
+
+	before := srv.Requests()
+	accounts, err := srv.Client().ListAccountsByUser(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(accounts) != total {
+		t.Fatalf("listed %d accounts, want %d", len(accounts), total)
+	}
+	if accounts[0].Principal != 100+total-1 {
+		t.Errorf("first account has principal %v, want the newest", accounts[0].Principal)
+	}
+	if pages := srv.Requests() - before; pages < 2 {
+		t.Errorf("listed in %d request, want several pages", pages)
+	}
+}
+
+func TestServerListMaturingSoon(t *testing.T) {
+	srv := blockaccounttest.NewServer(t)
+	now := time.Now().UTC()
+	soon := srv.AddAccount(client.Account{UserID: 1, Principal: 100, Period: "3m", EndDate: now.AddDate(0, 0, 5)})
+	sooner := srv.AddAccount(client.Account{UserID: 1, Principal: 100, Period: "3m", EndDate: now.AddDate(0, 0, 2)})
+	srv.AddAccount(client.Account{UserID: 1, Principal: 100, Period: "3m", EndDate: now.AddDate(0, 0, 40)})
+	srv.AddAccount(client.Account{UserID: 1, Principal: 100, Period: "3m", EndDate: now.AddDate(0, 0, 3), Status: "frozen"})
+
+	accounts, err := srv.Client().ListMaturingSoon(context.Background(), 7*24*time.Hour, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].ID != sooner.ID || accounts[1].ID != soon.ID {
+		t.Errorf("maturing soon = %v, want %s then %s", ids(accounts), sooner.ID, soon.ID)
+	}
+}
+
+func TestServerFailNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		status   int
+		wantErr  bool
+		requests int
+	}{
+		{"retried until it succeeds", 2, http.StatusServiceUnavailable, false, 3},
+		{"retries exhausted", 4, http.StatusServiceUnavailable, true, 4},
+		{"not retried", 1, http.StatusInternalServerError, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := blockaccounttest.NewServer(t)
+			account := srv.AddAccount(client.Account{UserID: 1, Principal: 100, Period: "1y"})
+			srv.FailNext(tt.failures, tt.status)
+
+			_, err := srv.Client().GetAccount(context.Background(), account.ID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("get: err = %v, want error %v", err, tt.wantErr)
+			}
+			if n := srv.Requests(); n != tt.requests {
+				t.Errorf("%d requests, want %d", n, tt.requests)
+			}
+		})
+	}
+}
+
+func TestServerUnmodelledRoute(t *testing.T) {
+	srv := blockaccounttest.NewServer(t)
+	_, err := srv.Client().GetPayoutSchedule(context.Background(), "any")
+	if code := client.ErrorCode(err); code != blockaccounttest.CodeNotImplemented {
+		t.Errorf("error code = %q (%v), want %q", code, err, blockaccounttest.CodeNotImplemented)
+	}
+}
+
+func ids(accounts []*client.Account) []string {
+	out := make([]string, len(accounts))
+	for i, a := range accounts {
+		out[i] = a.ID
+	}
+	return out
+}
@@ -0,0 +1,820 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Bulk import statuses
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	// ImportCancelled and ImportFailed imports keep the accounts loaded
+	// before they stopped
+	ImportCancelled = "cancelled"
+	ImportFailed    = "failed"
+)
+
+// Per-row outcomes of a bulk import
+const (
+	RowCreated = "created"
+	RowInvalid = "invalid"
+	RowFailed  = "failed"
+)
+
+const (
+	// defaultBulkSyncMaxRows is the most rows imported within the request when
+	// BULK_SYNC_MAX_ROWS is not set; larger uploads are queued
+	defaultBulkSyncMaxRows = 1000
+	// defaultBulkSyncMaxBytes is the largest upload imported within the
+	// request when BULK_SYNC_MAX_BYTES is not set
+	defaultBulkSyncMaxBytes = 1 << 20
+	// defaultBulkChunkSize is the number of accounts inserted per transaction
+	// when BULK_CHUNK_SIZE is not set
+	defaultBulkChunkSize = 500
+	// maxBulkChunkSize caps BULK_CHUNK_SIZE so one transaction stays short
+	maxBulkChunkSize = 5000
+	// defaultBulkMaxPendingImports is how many async imports may be queued or
+	// running before more are turned away, when BULK_MAX_PENDING_IMPORTS is not set
+	defaultBulkMaxPendingImports = 10
+	// bulkQueueRetryAfter is when a client turned away by a full import queue
+	// is told to try again
+	bulkQueueRetryAfter = time.Minute
+	// maxBulkRows caps the rows of one import
+	maxBulkRows = 100000
+	// maxBulkBodyBytes caps the size of an uploaded file
+	maxBulkBodyBytes = 64 << 20
+)
+
+// ErrImportQueueFull is returned when too many async imports are waiting to load
+var ErrImportQueueFull = newAPIError(CodeImportQueueFull, "too many imports are waiting to load; try again later")
+
+// bulkCSVColumns are the columns a CSV upload may have, named like the JSON fields
+var bulkCSVColumns = map[string]bool{
+	"user_id": true, "principal": true, "period": true, "start_date": true, "interest_rate": true,
+	"payout_frequency": true, "maturity_instruction": true, "payout_destination": true, "external_reference": true,
+}
+
+// BulkAccountRow is one existing deposit to load
+// @Description Existing deposit to load into a block account
+type BulkAccountRow struct {
+	UserID    int     `json:"user_id" example:"123"`
+	Principal float64 `json:"principal" example:"25000" maximum:"1000000000000"`
+	Period    string  `json:"period" example:"1y"` // "3m", "6m", "1y", "3y"
+	// StartDate is when the deposit opened, as RFC 3339 or YYYY-MM-DD. Defaults to now.
+	StartDate string `json:"start_date,omitempty" example:"2025-03-01"`
+	// InterestRate is the rate the deposit was opened at. Defaults to the period's current rate.
+	InterestRate *float64 `json:"interest_rate,omitempty" example:"0.045"`
+	// PayoutFrequency defaults to "at_maturity"
+	PayoutFrequency string `json:"payout_frequency,omitempty" example:"monthly"`
+	// MaturityInstruction defaults to "payout"
+	MaturityInstruction string `json:"maturity_instruction,omitempty" example:"payout"`
+	PayoutDestination   string `json:"payout_destination,omitempty" example:"1000123456789"`
+	// ExternalReference identifies the deposit in the source system and is echoed in the report
+	ExternalReference string `json:"external_reference,omitempty" example:"LEGACY-000412"`
+}
+
+// BulkRowResult is the outcome of one row of a bulk import
+// @Description Outcome of one row of a bulk import
+type BulkRowResult struct {
+	// Row is the 1-based position of the row in the upload, not counting a CSV header
+	Row               int    `json:"row" example:"1"`
+	ExternalReference string `json:"external_reference,omitempty" example:"LEGACY-000412"`
+	// Status is "created", "invalid" (the row was rejected) or "failed" (it could not be stored)
+	Status    string `json:"status" example:"created"`
+	AccountID string `json:"account_id,omitempty" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	Error     string `json:"error,omitempty" example:"invalid period: 2y"`
+	// legacyAccountID is the internal ID reports stored before accounts had
+	// external IDs recorded in account_id
+	legacyAccountID int
+}
+
+// UnmarshalJSON reads a row result, accepting the internal account IDs of
+// reports stored before accounts had external IDs
+func (r *BulkRowResult) UnmarshalJSON(b []byte) error {
+	type plain BulkRowResult
+	var v struct {
+		plain
+		AccountID json.RawMessage `json:"account_id,omitempty"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*r = BulkRowResult(v.plain)
+	if len(v.AccountID) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(v.AccountID, &r.AccountID); err != nil {
+		return json.Unmarshal(v.AccountID, &r.legacyAccountID)
+	}
+	return nil
+}
+
+// AccountImport reports on a bulk import. Synchronous imports are not stored
+// and have no ID.
+// @Description Progress and per-row report of a bulk account import
+type AccountImport struct {
+	ID int `json:"id,omitempty" example:"7"`
+	// JobID is the job loading an async import
+	JobID       int    `json:"job_id,omitempty" example:"12"`
+	Status      string `json:"status" example:"completed"`
+	Total       int    `json:"total" example:"2500"`
+	Processed   int    `json:"processed" example:"2500"`
+	Created     int    `json:"created" example:"2497"`
+	Failed      int    `json:"failed" example:"3"`
+	RequestedBy string `json:"requested_by,omitempty" example:"ops-17"`
+	// Results has one entry per processed row, in upload order
+	Results     []*BulkRowResult `json:"results"`
+	CreatedAt   time.Time        `json:"created_at"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+	// DryRun is set when nothing was kept: the report shows what loading the
+	// upload would do, and its account IDs were never stored
+	DryRun bool `json:"dry_run,omitempty"`
+	// Principal is the total principal of the accounts a dry run would
+	// create
+	Principal float64 `json:"principal,omitempty" example:"2497000"`
+
+	rows []importRow
+	// tenantID is the tenant the accounts are loaded into
+	tenantID string
+	// onBatch, when set, is called after every batch ImportAccounts loads
+	onBatch func()
+}
+
+// importRow is an uploaded row as stored for async imports. Error is set when
+// the row could not be parsed.
+type importRow struct {
+	Row   BulkAccountRow `json:"row"`
+	Error string         `json:"error,omitempty"`
+}
+
+// count recomputes the created and failed totals from the results
+func (imp *AccountImport) count() {
+	imp.Created, imp.Failed = 0, 0
+	for _, r := range imp.Results {
+		if r.Status == RowCreated {
+			imp.Created++
+		} else {
+			imp.Failed++
+		}
+	}
+}
+
+// bulkSyncMaxRows returns the most rows imported within the request
+func bulkSyncMaxRows() int {
+	return bulkSetting("BULK_SYNC_MAX_ROWS", defaultBulkSyncMaxRows)
+}
+
+// bulkSyncMaxBytes returns the largest upload imported within the request
+func bulkSyncMaxBytes() int {
+	return bulkSetting("BULK_SYNC_MAX_BYTES", defaultBulkSyncMaxBytes)
+}
+
+// bulkChunkSize returns the number of accounts inserted per transaction
+func bulkChunkSize() int {
+	return min(bulkSetting("BULK_CHUNK_SIZE", defaultBulkChunkSize), maxBulkChunkSize)
+}
+
+// bulkMaxPendingImports returns how many async imports may wait at once
+func bulkMaxPendingImports() int {
+	return bulkSetting("BULK_MAX_PENDING_IMPORTS", defaultBulkMaxPendingImports)
+}
+
+// bulkSetting reads a positive integer from the environment variable name
+func bulkSetting(name string, fallback int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return fallback
+}
+
+// parseStartDate parses a deposit's start date, as RFC 3339 or a date in the business time zone
+func parseStartDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, businessLocation())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start_date: %s. Use RFC 3339 or YYYY-MM-DD", v)
+	}
+	return t.UTC(), nil
+}
+
+// buildImportedAccount validates a row and returns the active account it
+// loads, at the rate of rates unless the row carries its own. Interest on
+// periodic payouts is taken to have been paid on schedule by the source
+// system up to now.
+func buildImportedAccount(row *BulkAccountRow, rates ratePlan, now time.Time) (*BlockAccount, error) {
+	if row.UserID <= 0 {
+		return nil, fmt.Errorf("user_id must be positive")
+	}
+	if err := validatePrincipal(row.Principal); err != nil {
+		return nil, err
+	}
+	if !isValidPeriod(row.Period) {
+		return nil, fmt.Errorf("invalid period: %s. Valid options are: %s", row.Period, validPeriods())
+	}
+	term, err := rates.terms(row.Period)
+	if err != nil {
+		return nil, err
+	}
+
+	frequency := row.PayoutFrequency
+	if frequency == "" {
+		frequency = FrequencyAtMaturity
+	}
+	if !isValidPayoutFrequency(frequency) {
+		return nil, fmt.Errorf("invalid payout_frequency: %s. Valid options are: monthly, quarterly, at_maturity", frequency)
+	}
+	instruction := row.MaturityInstruction
+	if instruction == "" {
+		instruction = InstructionPayout
+	}
+	if instruction != InstructionPayout && instruction != InstructionRollover {
+		return nil, fmt.Errorf("invalid maturity_instruction: %s. Valid options are: payout, rollover", instruction)
+	}
+
+	rate := term.Rate
+	if row.InterestRate != nil {
+		if *row.InterestRate < 0 || *row.InterestRate >= 1 {
+			return nil, fmt.Errorf("interest_rate must be a fraction between 0 and 1")
+		}
+		rate = *row.InterestRate
+	}
+
+	start := now
+	if row.StartDate != "" {
+		if start, err = parseStartDate(row.StartDate); err != nil {
+			return nil, err
+		}
+		if start.After(now) {
+			return nil, fmt.Errorf("start_date is in the future")
+		}
+	}
+	end := term.maturityDate(start)
+	if !end.After(now) {
+		return nil, fmt.Errorf("deposit has already matured on %s", end.Format(time.DateOnly))
+	}
+
+	account := &BlockAccount{
+		UserID:              row.UserID,
+		Principal:           roundMoney(row.Principal),
+		StartDate:           start,
+		EndDate:             end,
+		InterestRate:        rate,
+		Period:              row.Period,
+		Status:              StatusActive,
+		MaturityInstruction: instruction,
+		PayoutDestination:   row.PayoutDestination,
+		PayoutFrequency:     frequency,
+	}
+	scheduleInterest(account, now)
+	return account, nil
+}
+
+// newAccountImport wraps uploaded rows for ImportAccounts
+func newAccountImport(rows []importRow, staffID string) *AccountImport {
+	return &AccountImport{
+		Status:      ImportQueued,
+		Total:       len(rows),
+		RequestedBy: staffID,
+		Results:     []*BulkRowResult{},
+		CreatedAt:   time.Now().UTC(),
+		rows:        rows,
+	}
+}
+
+// QueueAccountImport stores a bulk import with the job that loads it. It
+// returns ErrImportQueueFull while BULK_MAX_PENDING_IMPORTS imports are
+// already queued or running, so a backlog cannot grow without bound.
+func (s *service) QueueAccountImport(ctx context.Context, imp *AccountImport) (*AccountImport, error) {
+	imp.tenantID = tenantOf(ctx)
+	pending, err := s.repo.CountPendingJobs(ctx, JobTypeAccountImport)
+	if err != nil {
+		s.log(ctx).Error("Failed to count pending imports", zap.Error(err))
+		return nil, err
+	}
+	if pending >= bulkMaxPendingImports() {
+		s.log(ctx).Warn("Account import turned away, import queue is full", zap.Int("pending", pending),
+			zap.Int("rows", imp.Total), zap.String("staffID", imp.RequestedBy))
+		return nil, ErrImportQueueFull
+	}
+
+	job, err := newJob(JobTypeAccountImport, struct{}{}, imp.RequestedBy)
+	if err != nil {
+		return nil, err
+	}
+	imp, err = s.repo.CreateAccountImport(ctx, imp, job)
+	if err != nil {
+		s.log(ctx).Error("Failed to queue account import", zap.Error(err))
+		return nil, err
+	}
+	s.log(ctx).Info("Account import queued", zap.Int("importID", imp.ID), zap.Int("jobID", imp.JobID),
+		zap.Int("rows", imp.Total), zap.String("staffID", imp.RequestedBy))
+	return imp, nil
+}
+
+// GetAccountImport returns a stored import with its report so far, or nil when it does not exist
+func (s *service) GetAccountImport(ctx context.Context, id int) (*AccountImport, error) {
+	imp, err := s.repo.GetAccountImport(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account import", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if imp == nil {
+		return nil, nil
+	}
+	if err := s.setLegacyImportAccountIDs(ctx, imp); err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// setLegacyImportAccountIDs replaces the internal account IDs in a report
+// stored before accounts had external IDs
+func (s *service) setLegacyImportAccountIDs(ctx context.Context, imp *AccountImport) error {
+	var ids []int
+	for _, result := range imp.Results {
+		if result.legacyAccountID != 0 {
+			ids = append(ids, result.legacyAccountID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	externalIDs, err := s.repo.AccountExternalIDs(ctx, ids)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account external IDs", zap.Error(err), zap.Int("importID", imp.ID))
+		return err
+	}
+	for _, result := range imp.Results {
+		if result.legacyAccountID != 0 {
+			result.AccountID, result.legacyAccountID = externalIDs[result.legacyAccountID], 0
+		}
+	}
+	return nil
+}
+
+// ImportAccounts loads the import's remaining rows as active accounts,
+// BULK_CHUNK_SIZE per transaction, and completes its report. Rows of a batch
+// that fails to insert are retried one by one so a bad row only fails itself.
+// A stored import saves its progress with every batch, so an import resumed
+// after a crash never loads a row twice. User IDs are validated; product gates
+// and account limits do not apply to deposits that already exist. Accounts
+// are loaded into the caller's tenant, at its rates.
+func (s *service) ImportAccounts(ctx context.Context, imp *AccountImport) (*AccountImport, error) {
+	now := time.Now().UTC()
+	imp.DryRun = isDryRun(ctx)
+	tenant := tenantOf(ctx)
+	rates, err := s.ratePlan(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	users := map[int]error{}
+	userExists := func(userID int) error {
+		err, ok := users[userID]
+		if !ok {
+			err = s.checkUserExists(ctx, userID)
+			users[userID] = err
+		}
+		return err
+	}
+
+	chunkSize := bulkChunkSize()
+	for start := imp.Processed; start < len(imp.rows); start += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := min(start+chunkSize, len(imp.rows))
+		results := make([]*BulkRowResult, 0, end-start)
+		var accounts []*BlockAccount
+		var created []*BulkRowResult
+		for i := start; i < end; i++ {
+			row := imp.rows[i]
+			result := &BulkRowResult{Row: i + 1, ExternalReference: row.Row.ExternalReference, Status: RowInvalid}
+			results = append(results, result)
+			if row.Error != "" {
+				result.Error = row.Error
+				continue
+			}
+			account, err := buildImportedAccount(&row.Row, rates, now)
+			if account != nil {
+				account.TenantID = tenant
+			}
+			if err == nil {
+				err = userExists(row.Row.UserID)
+			}
+			switch {
+			case errors.Is(err, ErrUnknownUser):
+				result.Error = fmt.Sprintf("user %d does not exist", row.Row.UserID)
+			case err != nil && account != nil:
+				result.Status, result.Error = RowFailed, "could not validate user_id"
+			case err != nil:
+				result.Error = err.Error()
+			default:
+				if err := s.assignExternalID(account); err != nil {
+					return nil, err
+				}
+				result.Status = RowCreated
+				accounts = append(accounts, account)
+				created = append(created, result)
+			}
+		}
+
+		done := imp.Results
+		if err := s.insertImportBatch(ctx, imp, done, results, accounts, created); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			s.log(ctx).Warn("Import batch failed, retrying rows one by one", zap.Error(err),
+				zap.Int("importID", imp.ID), zap.Int("fromRow", start+1))
+			for k, account := range accounts {
+				upTo := created[k].Row - start
+				err := s.insertImportBatch(ctx, imp, done, results[:upTo], []*BlockAccount{account}, created[k:k+1])
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					created[k].Status, created[k].Error, created[k].AccountID = RowFailed, "could not be stored", ""
+					s.log(ctx).Error("Failed to import account", zap.Error(err),
+						zap.Int("importID", imp.ID), zap.Int("row", created[k].Row))
+				}
+			}
+		}
+		imp.Results = append(done, results...)
+		imp.Processed = end
+		imp.count()
+		if imp.DryRun {
+			for k, account := range accounts {
+				if created[k].Status != RowCreated {
+					continue
+				}
+				if imp.Principal, err = addMoney(imp.Principal, account.Principal); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if imp.onBatch != nil {
+			imp.onBatch()
+		}
+	}
+
+	completed := time.Now().UTC()
+	imp.Status, imp.CompletedAt = ImportCompleted, &completed
+	imp.count()
+	if imp.ID != 0 {
+		if err := s.repo.CompleteAccountImport(ctx, imp); err != nil {
+			s.log(ctx).Error("Failed to complete account import", zap.Error(err), zap.Int("importID", imp.ID))
+			return nil, err
+		}
+	}
+	s.log(ctx).Info("Account import completed", zap.Int("importID", imp.ID), zap.Int("rows", imp.Total),
+		zap.Int("created", imp.Created), zap.Int("failed", imp.Failed), zap.Bool("dryRun", imp.DryRun))
+	return imp, nil
+}
+
+// insertImportBatch inserts accounts, sets their rows' account IDs and, for
+// stored imports, saves progress through the last of results in the same transaction
+func (s *service) insertImportBatch(ctx context.Context, imp *AccountImport, done, results []*BulkRowResult, accounts []*BlockAccount, created []*BulkRowResult) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+	_, err := s.repo.CreateAccounts(ctx, accounts, func(inserted []*BlockAccount) *AccountImport {
+		for k, a := range inserted {
+			created[k].AccountID = a.ExternalID
+		}
+		if imp.ID == 0 {
+			return nil
+		}
+		progress := *imp
+		progress.Results = append(done[:len(done):len(done)], results...)
+		progress.Processed = results[len(results)-1].Row
+		progress.count()
+		return &progress
+	})
+	return err
+}
+
+// runAccountImportJob loads an async import, resuming after the rows an
+// earlier attempt already loaded. The import is marked cancelled or failed
+// when the job stops early.
+func runAccountImportJob(ctx context.Context, s *service, job *Job, progress func(done, total int)) (any, error) {
+	imp, err := s.repo.StartAccountImport(ctx, job.ID)
+	if err != nil {
+		s.log(ctx).Error("Failed to start account import", zap.Error(err), zap.Int("jobID", job.ID))
+		return nil, err
+	}
+	if imp == nil {
+		return nil, fmt.Errorf("no import for job %d", job.ID)
+	}
+	ctx = withTenant(ctx, imp.tenantID)
+	if err := s.setLegacyImportAccountIDs(ctx, imp); err != nil {
+		return nil, err
+	}
+
+	imp.onBatch = func() { progress(imp.Processed, imp.Total) }
+	progress(imp.Processed, imp.Total)
+	if _, err := s.ImportAccounts(ctx, imp); err != nil {
+		// The import is saved as of its last loaded batch
+		imp.Status = ImportFailed
+		if errors.Is(context.Cause(ctx), ErrJobCancelled) {
+			imp.Status = ImportCancelled
+		}
+		completed := time.Now().UTC()
+		imp.CompletedAt = &completed
+		if err := s.repo.CompleteAccountImport(context.WithoutCancel(ctx), imp); err != nil {
+			s.log(ctx).Error("Failed to stop account import", zap.Error(err), zap.Int("importID", imp.ID))
+		}
+		return nil, err
+	}
+	return map[string]int{"import_id": imp.ID, "created": imp.Created, "failed": imp.Failed}, nil
+}
+
+// readBulkRows reads the rows of a bulk upload: a JSON array, a CSV file with
+// a header row, or either as the "file" field of a multipart form
+func readBulkRows(r *http.Request) ([]importRow, error) {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return decodeBulkRows(r.Body, mediaType, "")
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil || params["boundary"] == "" {
+		return nil, fmt.Errorf("invalid multipart body")
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("multipart body has no file field")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart body")
+		}
+		if part.FormName() == "file" {
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			return decodeBulkRows(part, partType, part.FileName())
+		}
+	}
+}
+
+// decodeBulkRows decodes an upload as CSV or JSON by its media type or file name
+func decodeBulkRows(body io.Reader, mediaType, fileName string) ([]importRow, error) {
+	if mediaType == "text/csv" || strings.HasSuffix(strings.ToLower(fileName), ".csv") {
+		return decodeBulkCSV(body)
+	}
+	var rows []BulkAccountRow
+	if err := json.NewDecoder(body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("body must be a JSON array of accounts or a CSV file")
+	}
+	parsed := make([]importRow, len(rows))
+	for i := range rows {
+		parsed[i].Row = rows[i]
+	}
+	return parsed, nil
+}
+
+// decodeBulkCSV decodes a CSV upload. Values that do not parse fail only their row.
+func decodeBulkCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("CSV file needs a header row")
+	}
+	columns := map[string]bool{}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !bulkCSVColumns[header[i]] {
+			return nil, fmt.Errorf("unknown CSV column: %s", name)
+		}
+		columns[header[i]] = true
+	}
+	for _, required := range []string{"user_id", "principal", "period"} {
+		if !columns[required] {
+			return nil, fmt.Errorf("CSV file is missing the %s column", required)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		if len(rows) >= maxBulkRows {
+			return nil, errTooManyBulkRows
+		}
+		rows = append(rows, parseBulkCSVRecord(header, record))
+	}
+}
+
+// errTooManyBulkRows is returned when an upload has more than maxBulkRows rows
+var errTooManyBulkRows = fmt.Errorf("an import may have at most %d rows", maxBulkRows)
+
+// parseBulkCSVRecord converts one CSV record into a row
+func parseBulkCSVRecord(header, record []string) importRow {
+	var row importRow
+	for i, name := range header {
+		v := strings.TrimSpace(record[i])
+		if v == "" {
+			continue
+		}
+		var err error
+		switch name {
+		case "user_id":
+			row.Row.UserID, err = strconv.Atoi(v)
+		case "principal":
+			row.Row.Principal, err = strconv.ParseFloat(v, 64)
+		case "interest_rate":
+			var rate float64
+			rate, err = strconv.ParseFloat(v, 64)
+			row.Row.InterestRate = &rate
+		case "period":
+			row.Row.Period = v
+		case "start_date":
+			row.Row.StartDate = v
+		case "payout_frequency":
+			row.Row.PayoutFrequency = v
+		case "maturity_instruction":
+			row.Row.MaturityInstruction = v
+		case "payout_destination":
+			row.Row.PayoutDestination = v
+		case "external_reference":
+			row.Row.ExternalReference = v
+		}
+		if err != nil && row.Error == "" {
+			row.Error = fmt.Sprintf("%s is not a number: %s", name, v)
+		}
+	}
+	return row
+}
+
+// bulkCreateHandler godoc
+// @Summary Bulk load existing deposits
+// @Description Loads existing deposits as active block accounts from a JSON array, a CSV file with a header row naming the JSON fields (sent as text/csv or as the "file" field of a multipart form), and returns a per-row report. Rows are validated independently; invalid rows are reported and skipped. Up to BULK_SYNC_MAX_ROWS rows (1000 by default) and BULK_SYNC_MAX_BYTES (1 MB) are loaded within the request. Larger uploads, or any with async=true, are queued as a job that loads them BULK_CHUNK_SIZE rows at a time, answered with 202, the import and job IDs and the job's status URL in Location. async=false refuses to queue. dry_run=true loads the upload within the request however large it is, reports what it would create, including the total principal, and rolls every row back. While BULK_MAX_PENDING_IMPORTS imports are waiting, new ones get 503 with Retry-After. Product gates and account limits do not apply.
+// @Tags block-account
+// @Accept json
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Param accounts body []BulkAccountRow true "Deposits to load"
+// @Param async query bool false "true always queues the import, false never does; by default large uploads are queued"
+// @Param dry_run query bool false "Report what the import would create without keeping anything"
+// @Param X-Staff-ID header string false "Staff member, set by the gateway"
+// @Success 200 {object} AccountImport
+// @Success 202 {object} AccountImport "Import queued"
+// @Header 202 {string} Location "Job status URL"
+// @Failure 400 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Header 503 {integer} Retry-After "Seconds to wait before trying again"
+// @Router /v2/block-account/bulk [post]
+func bulkCreateHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	mode := r.URL.Query().Get("async")
+	if mode != "" && mode != "true" && mode != "false" {
+		writeError(w, http.StatusBadRequest, "async must be true or false")
+		return
+	}
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+	if dryRun && mode == "true" {
+		writeError(w, http.StatusBadRequest, "dry runs are not queued; leave out async=true")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkBodyBytes)
+	rows, err := readBulkRows(r)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload may be at most %d MB", maxBulkBodyBytes>>20))
+		return
+	case err == errTooManyBulkRows:
+		writeAPIError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	case len(rows) == 0:
+		writeError(w, http.StatusBadRequest, "upload has no rows")
+		return
+	case len(rows) > maxBulkRows:
+		writeError(w, http.StatusRequestEntityTooLarge, errTooManyBulkRows.Error())
+		return
+	}
+
+	// Uploads too large to load within the request are queued unless the
+	// client asked for either mode. Dry runs are never queued.
+	large := !dryRun && (len(rows) > bulkSyncMaxRows() || r.ContentLength > int64(bulkSyncMaxBytes()))
+	if mode == "false" && large {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(
+			"imports of more than %d rows or %d KB are queued; leave out async=false", bulkSyncMaxRows(), bulkSyncMaxBytes()>>10))
+		return
+	}
+
+	imp := newAccountImport(rows, r.Header.Get(StaffIDHeader))
+	if mode == "true" || (mode == "" && large) {
+		ctx, cancel := withRequestTimeout(r, longRequestTimeout)
+		defer cancel()
+
+		imp, err := svc.QueueAccountImport(ctx, imp)
+		if err == ErrImportQueueFull {
+			w.Header().Set("Retry-After", strconv.Itoa(int(bulkQueueRetryAfter.Seconds())))
+			writeAPIError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Location", jobLocation(imp.JobID))
+		writeSuccessStatus(w, r, http.StatusAccepted, imp, "Import queued")
+		return
+	}
+
+	// Allow a second per chunk on top of the usual request budget
+	ctx, cancel := withRequestTimeout(r, requestTimeout(r)+time.Duration(len(rows)/bulkChunkSize()+1)*time.Second)
+	defer cancel()
+	if dryRun {
+		ctx = withDryRun(ctx)
+	}
+
+	imp, err = svc.ImportAccounts(ctx, imp)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if imp.DryRun {
+		writeSuccess(w, r, imp, fmt.Sprintf("Dry run: %d of %d accounts would be created", imp.Created, imp.Total))
+		return
+	}
+	markWrite(w)
+	writeSuccess(w, r, imp, fmt.Sprintf("%d of %d accounts created", imp.Created, imp.Total))
+}
+
+// getAccountImportHandler godoc
+// @Summary Get a bulk import
+// @Description Returns an async bulk import's status, progress and per-row report so far
+// @Tags block-account
+// @Produce json
+// @Param id path int true "Import ID" Format(int64)
+// @Success 200 {object} AccountImport
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/bulk/{id} [get]
+func getAccountImportHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid import ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	imp, err := svc.GetAccountImport(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if imp == nil {
+		writeError(w, http.StatusNotFound, "Import not found")
+		return
+	}
+
+	writeSuccess(w, r, imp, "Import retrieved successfully")
+}
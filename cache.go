@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// defaultCacheTTL is how long cached reads live when CACHE_TTL is not set
+const defaultCacheTTL = 30 * time.Second
+
+// cacheKeyPrefix namespaces every key this service writes to Redis
+const cacheKeyPrefix = "blockaccount:"
+
+// cacheTTL returns the configured cache entry lifetime
+func cacheTTL() time.Duration {
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultCacheTTL
+}
+
+// newRedisClient returns a client for REDIS_ADDR, or nil when caching is disabled
+func newRedisClient() (*redis.Client, error) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+
+	db := 0
+	if v := os.Getenv("REDIS_DB"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_DB: %s", v)
+		}
+		db = n
+	}
+
+	return redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+		DB:       db,
+	}), nil
+}
+
+// CacheStats counts cache outcomes since the process started
+// @Description Read cache counters since the process started
+type CacheStats struct {
+	Hits          uint64  `json:"hits" example:"950"`
+	Misses        uint64  `json:"misses" example:"50"`
+	Errors        uint64  `json:"errors" example:"0"`
+	Invalidations uint64  `json:"invalidations" example:"42"`
+	HitRatio      float64 `json:"hit_ratio" example:"0.95"`
+}
+
+// cachedRepository is a read-through Redis cache in front of another
+// Repository. Account and per-user list reads are cached for the TTL and
+// invalidated whenever a write touches them. Entries hold the accounts of
+// every tenant and are filtered by the caller's on the way out. Redis
+// failures are logged and fall through to the database, so the cache can
+// never take reads down.
+type cachedRepository struct {
+	Repository
+	client *redis.Client
+	ttl    time.Duration
+	logger *zap.Logger
+
+	hits, misses, errors, invalidations atomic.Uint64
+}
+
+func newCachedRepository(repo Repository, client *redis.Client, ttl time.Duration, logger *zap.Logger) *cachedRepository {
+	return &cachedRepository{Repository: repo, client: client, ttl: ttl, logger: logger}
+}
+
+func accountCacheKey(id int) string {
+	return cacheKeyPrefix + "account:" + strconv.Itoa(id)
+}
+
+func userAccountsCacheKey(userID int) string {
+	return cacheKeyPrefix + "user:" + strconv.Itoa(userID) + ":accounts"
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *cachedRepository) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Errors:        c.errors.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// lookup decodes the cached value at key into dst and reports whether it was found
+func (c *cachedRepository) lookup(ctx context.Context, key string, dst any) bool {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			c.errors.Add(1)
+			loggerFromContext(ctx, c.logger).Warn("Cache read failed", zap.Error(err), zap.String("key", key))
+		}
+		c.misses.Add(1)
+		return false
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		c.errors.Add(1)
+		c.misses.Add(1)
+		return false
+	}
+	c.hits.Add(1)
+	return true
+}
+
+func (c *cachedRepository) store(ctx context.Context, key string, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if err := c.client.Set(ctx, key, data, c.ttl).Err(); err != nil {
+		c.errors.Add(1)
+		loggerFromContext(ctx, c.logger).Warn("Cache write failed", zap.Error(err), zap.String("key", key))
+	}
+}
+
+// invalidate drops the cached account and user list keys, and the lists of
+// the accounts' secondary holders. It runs after the write has committed,
+// detached from the request's cancellation.
+func (c *cachedRepository) invalidate(ctx context.Context, accountIDs, userIDs []int) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+	defer cancel()
+
+	if len(accountIDs) > 0 {
+		coHolders, err := c.Repository.ListSecondaryHolderIDs(ctx, accountIDs)
+		if err != nil {
+			c.errors.Add(1)
+			loggerFromContext(ctx, c.logger).Error("Cache invalidation could not find co-holders", zap.Error(err))
+		}
+		userIDs = append(userIDs, coHolders...)
+	}
+
+	keys := make([]string, 0, len(accountIDs)+len(userIDs))
+	for _, id := range accountIDs {
+		keys = append(keys, accountCacheKey(id))
+	}
+	for _, id := range userIDs {
+		keys = append(keys, userAccountsCacheKey(id))
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		c.errors.Add(1)
+		loggerFromContext(ctx, c.logger).Error("Cache invalidation failed", zap.Error(err), zap.Strings("keys", keys))
+		return
+	}
+	c.invalidations.Add(uint64(len(keys)))
+}
+
+// flush drops every cached account and user list, leaving other keys under
+// cacheKeyPrefix such as rate limits alone, and returns how many it dropped
+func (c *cachedRepository) flush(ctx context.Context) (int, error) {
+	dropped := 0
+	for _, pattern := range []string{cacheKeyPrefix + "account:*", cacheKeyPrefix + "user:*"} {
+		iter := c.client.Scan(ctx, 0, pattern, 500).Iterator()
+		var keys []string
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			c.errors.Add(1)
+			return dropped, err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if err := c.client.Del(ctx, keys...).Err(); err != nil {
+			c.errors.Add(1)
+			return dropped, err
+		}
+		dropped += len(keys)
+	}
+	c.invalidations.Add(uint64(dropped))
+	return dropped, nil
+}
+
+func (c *cachedRepository) GetAccount(ctx context.Context, id int) (*BlockAccount, error) {
+	// Read-your-writes requests always go to the database
+	if primaryRequired(ctx) {
+		return c.Repository.GetAccount(ctx, id)
+	}
+
+	key := accountCacheKey(id)
+	var account BlockAccount
+	if c.lookup(ctx, key, &account) {
+		if !inTenant(ctx, account.TenantID) {
+			return nil, nil
+		}
+		return &account, nil
+	}
+
+	found, err := c.Repository.GetAccount(withTenant(ctx, ""), id)
+	if err != nil || found == nil {
+		return found, err
+	}
+	c.store(ctx, key, found)
+	if !inTenant(ctx, found.TenantID) {
+		return nil, nil
+	}
+	return found, nil
+}
+
+func (c *cachedRepository) ListAccountsByUser(ctx context.Context, userID int) ([]*BlockAccount, error) {
+	if primaryRequired(ctx) {
+		return c.Repository.ListAccountsByUser(ctx, userID)
+	}
+
+	key := userAccountsCacheKey(userID)
+	var accounts []*BlockAccount
+	if !c.lookup(ctx, key, &accounts) {
+		var err error
+		accounts, err = c.Repository.ListAccountsByUser(withTenant(ctx, ""), userID)
+		if err != nil {
+			return nil, err
+		}
+		c.store(ctx, key, accounts)
+	}
+
+	var visible []*BlockAccount
+	for _, a := range accounts {
+		if inTenant(ctx, a.TenantID) {
+			visible = append(visible, a)
+		}
+	}
+	return visible, nil
+}
+
+func (c *cachedRepository) CreateAccount(ctx context.Context, a *BlockAccount, admit func(UserExposure, *BlockAccount) error) (*BlockAccount, error) {
+	account, err := c.Repository.CreateAccount(ctx, a, admit)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(ctx, nil, []int{account.UserID})
+	return account, nil
+}
+
+func (c *cachedRepository) CreateAccounts(ctx context.Context, accounts []*BlockAccount, record func([]*BlockAccount) *AccountImport) ([]*BlockAccount, error) {
+	stored, err := c.Repository.CreateAccounts(ctx, accounts, record)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make([]int, len(stored))
+	for i, a := range stored {
+		userIDs[i] = a.UserID
+	}
+	c.invalidate(ctx, nil, userIDs)
+	return stored, nil
+}
+
+func (c *cachedRepository) DeleteAccount(ctx context.Context, id int, check func(*BlockAccount) error) error {
+	// Look the holders up first, as closing the account removes them, so
+	// their lists can be invalidated too
+	account, err := c.Repository.GetAccount(withTenant(ctx, ""), id)
+	if err != nil {
+		return err
+	}
+	coHolders, err := c.Repository.ListSecondaryHolderIDs(ctx, []int{id})
+	if err != nil {
+		return err
+	}
+	if err := c.Repository.DeleteAccount(ctx, id, check); err != nil {
+		return err
+	}
+
+	userIDs := coHolders
+	if account != nil {
+		userIDs = append(userIDs, account.UserID)
+	}
+	c.invalidate(ctx, []int{id}, userIDs)
+	return nil
+}
+
+func (c *cachedRepository) BeginClosure(ctx context.Context, id int, plan func(*BlockAccount) (*AccountClosure, error)) (*BlockAccount, error) {
+	account, err := c.Repository.BeginClosure(ctx, id, plan)
+	if err != nil || account == nil {
+		return account, err
+	}
+	c.invalidate(ctx, []int{id}, []int{account.UserID})
+	return account, nil
+}
+
+func (c *cachedRepository) ArchiveAccount(ctx context.Context, a *ArchivedAccount) error {
+	// As with DeleteAccount, the holders are gone once the account is
+	account, err := c.Repository.GetAccount(withTenant(ctx, ""), a.AccountID)
+	if err != nil {
+		return err
+	}
+	coHolders, err := c.Repository.ListSecondaryHolderIDs(ctx, []int{a.AccountID})
+	if err != nil {
+		return err
+	}
+	if err := c.Repository.ArchiveAccount(ctx, a); err != nil {
+		return err
+	}
+
+	userIDs := coHolders
+	if account != nil {
+		userIDs = append(userIDs, account.UserID)
+	}
+	c.invalidate(ctx, []int{a.AccountID}, userIDs)
+	return nil
+}
+
+func (c *cachedRepository) AddAccountHolder(ctx context.Context, h *AccountHolder) error {
+	if err := c.Repository.AddAccountHolder(ctx, h); err != nil {
+		return err
+	}
+	c.invalidate(ctx, nil, []int{h.UserID})
+	return nil
+}
+
+func (c *cachedRepository) RemoveAccountHolder(ctx context.Context, accountID, userID int) error {
+	if err := c.Repository.RemoveAccountHolder(ctx, accountID, userID); err != nil {
+		return err
+	}
+	c.invalidate(ctx, nil, []int{userID})
+	return nil
+}
+
+func (c *cachedRepository) UpdateMaturityInstruction(ctx context.Context, id int, instruction, destination string, check func(*BlockAccount) error) (*BlockAccount, error) {
+	account, err := c.Repository.UpdateMaturityInstruction(ctx, id, instruction, destination, check)
+	if err != nil || account == nil {
+		return account, err
+	}
+	c.invalidate(ctx, []int{id}, []int{account.UserID})
+	return account, nil
+}
+
+func (c *cachedRepository) UpdateAccountStatus(ctx context.Context, id int, status string, check func(*BlockAccount) error) (*BlockAccount, error) {
+	account, err := c.Repository.UpdateAccountStatus(ctx, id, status, check)
+	if err != nil || account == nil {
+		return account, err
+	}
+	c.invalidate(ctx, []int{id}, []int{account.UserID})
+	return account, nil
+}
+
+func (c *cachedRepository) SettleFunding(ctx context.Context, accountID int, plan func(*BlockAccount) (*FundingOutcome, error)) (*BlockAccount, error) {
+	account, err := c.Repository.SettleFunding(ctx, accountID, plan)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(ctx, []int{accountID}, []int{account.UserID})
+	return account, nil
+}
+
+func (c *cachedRepository) MatureDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*MaturityOutcome, error)) (int, error) {
+	var accountIDs, userIDs []int
+	n, err := c.Repository.MatureDue(ctx, now, limit, func(a *BlockAccount) (*MaturityOutcome, error) {
+		accountIDs = append(accountIDs, a.ID)
+		userIDs = append(userIDs, a.UserID)
+		return plan(a)
+	})
+	if err != nil {
+		return n, err
+	}
+	c.invalidate(ctx, accountIDs, userIDs)
+	return n, nil
+}
+
+func (c *cachedRepository) MatureAccount(ctx context.Context, id int, now time.Time, plan func(*BlockAccount) (*MaturityOutcome, error)) (bool, error) {
+	var userIDs []int
+	ok, err := c.Repository.MatureAccount(ctx, id, now, func(a *BlockAccount) (*MaturityOutcome, error) {
+		userIDs = append(userIDs, a.UserID)
+		return plan(a)
+	})
+	if err != nil || !ok {
+		return ok, err
+	}
+	c.invalidate(ctx, []int{id}, userIDs)
+	return true, nil
+}
+
+func (c *cachedRepository) PayInterestDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*InterestOutcome, error)) (int, error) {
+	var accountIDs, userIDs []int
+	n, err := c.Repository.PayInterestDue(ctx, now, limit, func(a *BlockAccount) (*InterestOutcome, error) {
+		accountIDs = append(accountIDs, a.ID)
+		userIDs = append(userIDs, a.UserID)
+		return plan(a)
+	})
+	if err != nil {
+		return n, err
+	}
+	c.invalidate(ctx, accountIDs, userIDs)
+	return n, nil
+}
+
+func (c *cachedRepository) AdjustInterest(ctx context.Context, accountID int, plan func(*BlockAccount, []*InterestPayout, []*InterestAdjustment) (*InterestAdjustment, error)) (*BlockAccount, *InterestAdjustment, error) {
+	account, adj, err := c.Repository.AdjustInterest(ctx, accountID, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.invalidate(ctx, []int{accountID}, []int{account.UserID})
+	return account, adj, nil
+}
+
+func (c *cachedRepository) ConfirmPayout(ctx context.Context, accountID int) (*Payout, bool, error) {
+	payout, closed, err := c.Repository.ConfirmPayout(ctx, accountID)
+	if err != nil {
+		return nil, false, err
+	}
+	if closed {
+		account, err := c.Repository.GetAccount(withTenant(ctx, ""), accountID)
+		if err == nil && account != nil {
+			c.invalidate(ctx, []int{accountID}, []int{account.UserID})
+		}
+	}
+	return payout, closed, nil
+}
+
+func (c *cachedRepository) FailPayout(ctx context.Context, accountID int, reason string) (*Payout, int, error) {
+	payout, userID, err := c.Repository.FailPayout(ctx, accountID, reason)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.invalidate(ctx, []int{accountID}, []int{userID})
+	return payout, userID, nil
+}
+
+func (c *cachedRepository) RetryPayout(ctx context.Context, accountID int, destination string) (*Payout, int, error) {
+	payout, userID, err := c.Repository.RetryPayout(ctx, accountID, destination)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.invalidate(ctx, []int{accountID}, []int{userID})
+	return payout, userID, nil
+}
+
+// cacheStatsHandler godoc
+// @Summary Read cache statistics
+// @Description Returns hit, miss, error and invalidation counters of the Redis read cache
+// @Tags admin
+// @Produce json
+// @Success 200 {object} CacheStats
+// @Failure 404 {object} ErrorResponse
+// @Router /v2/admin/cache/stats [get]
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	s, ok := svc.(*service)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Cache is not enabled")
+		return
+	}
+	cache, ok := s.repo.(*cachedRepository)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Cache is not enabled")
+		return
+	}
+
+	writeSuccess(w, r, cache.Stats(), "Cache statistics retrieved successfully")
+}
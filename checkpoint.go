@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Batch jobs that checkpoint their progress
+const (
+	JobMaturity = "maturity"
+)
+
+// WorkerCheckpoint records the progress of a batch job's current or last run.
+// A run that has not completed is resumed by the next run of the job.
+type WorkerCheckpoint struct {
+	Job string
+	// RunStartedAt is the run's cutoff: a resumed run keeps processing the
+	// population selected at this time rather than widening it
+	RunStartedAt time.Time
+	Processed    int
+	CompletedAt  *time.Time
+	// LastCompletedAt is when the job last finished a run. Unlike
+	// CompletedAt it survives the start of the next run.
+	LastCompletedAt *time.Time
+	UpdatedAt       time.Time
+}
+
+// startRun returns the checkpoint for a run of job starting at now, resuming
+// the job's unfinished run if there is one. A checkpoint that cannot be read
+// is logged and a fresh run started, since checkpoints only save work.
+func (s *service) startRun(ctx context.Context, job string, now time.Time) *WorkerCheckpoint {
+	cp, err := s.repo.GetCheckpoint(ctx, job)
+	if err != nil {
+		s.log(ctx).Warn("Failed to load worker checkpoint", zap.Error(err), zap.String("job", job))
+	}
+	if cp != nil && cp.CompletedAt == nil {
+		s.log(ctx).Info("Resuming interrupted run",
+			zap.String("job", job),
+			zap.Time("runStartedAt", cp.RunStartedAt),
+			zap.Int("processed", cp.Processed))
+		return cp
+	}
+	return &WorkerCheckpoint{Job: job, RunStartedAt: now}
+}
+
+// saveCheckpoint persists cp, logging rather than failing the run when it
+// cannot: the worst case is that a crash repeats work already done
+func (s *service) saveCheckpoint(ctx context.Context, cp *WorkerCheckpoint) {
+	if err := s.repo.SaveCheckpoint(ctx, cp); err != nil {
+		s.log(ctx).Warn("Failed to save worker checkpoint", zap.Error(err), zap.String("job", cp.Job))
+	}
+}
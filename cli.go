@@ -0,0 +1,1016 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"main.go/config"
+)
+
+// app holds the dependencies shared by every subcommand
+type app struct {
+	cfg     *config.Config
+	logger  *zap.Logger
+	driver  string
+	db      *sql.DB
+	replica *sql.DB // nil when reads are not routed to a replica
+	repo    Repository
+	fields  *fieldCipher    // nil when sensitive fields are stored as given
+	redis   *redis.Client   // nil when the read cache is disabled
+	fx      RateSource      // nil when display conversion is disabled
+	users   UserValidator   // nil when user IDs are not checked
+	funding FundingProvider // nil when accounts open without moving money
+	store   ObjectStore     // nil when documents are not kept
+	mailer  Mailer          // nil when email is disabled
+	sms     SMSProvider     // nil when SMS is disabled
+	// notifyHook is nil when customer notifications are not posted to a webhook
+	notifyHook NotificationChannel
+	// limiter is nil when API requests are not rate limited
+	limiter RateLimiter
+	limits  rateLimits
+	// ids makes the external IDs of new accounts
+	ids IDGenerator
+	// tokens checks bearer tokens, nil when they are not accepted
+	tokens TokenVerifier
+	// features are the configured feature flags
+	features *featureFlags
+	// clock is the deployment's clock, advanced by QA in a sandbox
+	clock Clock
+	// startedAt is when the process started
+	startedAt time.Time
+}
+
+// bootstrap loads the environment, configuration, logger and database
+// connection. configPath names a YAML configuration file, or is empty to use
+// CONFIG_FILE if set.
+func bootstrap(configPath string) (*app, error) {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, relying on environment variables")
+	}
+
+	// Fail before connecting to anything if a setting is wrong
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_FILE")
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize logger
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	if region := regionName(); region != "" {
+		logger = logger.With(zap.String("region", region))
+	}
+
+	driver := cfg.Database.Driver
+	db, err := openDatabase(cfg.Database)
+	if err != nil {
+		logger.Error("Database unavailable", zap.Error(err))
+		logger.Sync()
+		return nil, err
+	}
+
+	var replica *sql.DB
+	var router *replicaRouter
+	if cfg.Database.ReplicaDSN != "" {
+		if replica, err = openReplica(cfg.Database); err != nil {
+			db.Close()
+			logger.Sync()
+			return nil, err
+		}
+		// Reads fall back to the primary while the replica is down, so an
+		// unreachable replica only costs the primary load
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := replica.PingContext(ctx); err != nil {
+			logger.Warn("Read replica unavailable, reads will go to the primary", zap.Error(err))
+		}
+		cancel()
+		router = newReplicaRouter(replica, cfg.Database.ReplicaMaxLag, logger)
+		logger.Info("Read replica routing enabled", zap.Duration("maxLag", cfg.Database.ReplicaMaxLag))
+	}
+
+	repo, err := newRepository(driver, db, router)
+	if err != nil {
+		closeDBs(db, replica)
+		logger.Sync()
+		return nil, err
+	}
+	fields, err := newFieldCipher()
+	if err != nil {
+		closeDBs(db, replica)
+		logger.Sync()
+		return nil, err
+	}
+	if fields != nil {
+		repo = newEncryptingRepository(repo, fields)
+		logger.Info("Field encryption enabled", zap.String("provider", os.Getenv("FIELD_ENCRYPTION")))
+	}
+	// Time the database under the cache, so cache hits don't hide its latency
+	repo = newTimedRepository(repo)
+
+	client, err := newRedisClient()
+	if err != nil {
+		closeDBs(db, replica)
+		logger.Sync()
+		return nil, err
+	}
+	if client != nil {
+		// The cache falls back to the database on errors, so an unreachable
+		// Redis only costs performance
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if err := client.Ping(ctx).Err(); err != nil {
+			logger.Warn("Redis unavailable, reads will fall through to the database", zap.Error(err))
+		}
+		cancel()
+		repo = newCachedRepository(repo, client, cacheTTL(), logger)
+		logger.Info("Redis read cache enabled", zap.Duration("ttl", cacheTTL()))
+	}
+
+	a := &app{cfg: cfg, logger: logger, driver: driver, db: db, replica: replica, repo: repo, fields: fields, redis: client, startedAt: time.Now().UTC(), clock: newClock()}
+	if err := checkSandboxConfig(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if err := checkTimezoneConfig(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if err := checkOpenAPIValidationConfig(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.fx, err = newRateSource(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.users, err = newUserValidator(repo); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.funding, err = newFundingProvider(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.store, err = newObjectStore(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.mailer, err = newMailer(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.sms, err = newSMSProvider(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.notifyHook, err = newNotificationWebhook(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.ids, err = newIDGenerator(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.limits, err = newRateLimits(); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.limiter, err = newRateLimiter(client, a.limits); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.tokens, err = newTokenVerifier(logger); err != nil {
+		a.close()
+		return nil, err
+	}
+	if a.features, err = newFeatureFlags(); err != nil {
+		a.close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *app) close() {
+	if c, ok := a.users.(io.Closer); ok {
+		c.Close()
+	}
+	if a.redis != nil {
+		a.redis.Close()
+	}
+	closeDBs(a.db, a.replica)
+	a.logger.Sync()
+}
+
+// closeDBs closes the database handles that are open
+func closeDBs(dbs ...*sql.DB) {
+	for _, db := range dbs {
+		if db != nil {
+			db.Close()
+		}
+	}
+}
+
+// newService builds the BlockAccountService implementation
+func (a *app) newService() *service {
+	return &service{repo: a.repo, logger: a.logger, notifier: &logNotifier{logger: a.logger}, fx: a.fx, users: a.users, funding: a.funding, store: a.store, mailer: a.mailer, channels: newNotificationChannels(a.mailer, a.sms, a.notifyHook), stats: newStatsCache(statsCacheTTL()), ids: a.ids, tokens: a.tokens, startedAt: a.startedAt, tenants: newTenantCache(), events: newEventHub(a.repo, a.logger), features: a.features, clock: a.clock}
+}
+
+// withApp adapts a function needing the app into a cobra RunE
+func withApp(run func(ctx context.Context, a *app, args []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		configPath, _ := cmd.Flags().GetString("config")
+		a, err := bootstrap(configPath)
+		if err != nil {
+			return err
+		}
+		defer a.close()
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return run(ctx, a, args)
+	}
+}
+
+// newRootCommand builds the blockaccount CLI. Running it without a
+// subcommand starts the API server.
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "blockaccount",
+		Short:        "Block account API, workers and maintenance tools",
+		SilenceUsage: true,
+		RunE:         withApp(serve),
+	}
+	root.PersistentFlags().String("config", "", "YAML configuration file (CONFIG_FILE)")
+	root.AddCommand(newServeCommand(), newMigrateCommand(), newWorkerCommand(), newSeedCommand(), newAPIKeyCommand(), newTenantCommand())
+	return root
+}
+
+func newServeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Start the HTTP API server",
+		Args:  cobra.NoArgs,
+		RunE:  withApp(serve),
+	}
+}
+
+// serve starts the HTTP API after checking the schema is current
+func serve(ctx context.Context, a *app, _ []string) error {
+	migrator, err := newMigrator(a.db, a.driver, a.logger)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to serve against a schema this build doesn't expect
+	if err := migrator.CheckSchema(ctx); err != nil {
+		a.logger.Error("Database schema mismatch", zap.Error(err))
+		return err
+	}
+	if err := a.checkDeployment(ctx); err != nil {
+		a.logger.Error("Deployment mismatch", zap.Error(err))
+		return err
+	}
+	if err := watchProducts(ctx, a.repo, a.logger); err != nil {
+		return err
+	}
+	if err := watchClock(ctx, a.repo, a.clock, a.logger); err != nil {
+		return err
+	}
+
+	port := strconv.Itoa(a.cfg.Server.Port)
+	grpcPort := strconv.Itoa(a.cfg.Server.GRPCPort)
+	tlsConfig, err := newTLSConfig(a.cfg.Server.TLS, a.logger)
+	if err != nil {
+		a.logger.Error("Invalid TLS setup", zap.Error(err))
+		return err
+	}
+
+	// HTTP and gRPC share one service; if either listener fails both stop
+	svc := a.newService()
+	svc.schema = migrator
+	g, ctx := errgroup.WithContext(ctx)
+
+	server := newHTTPServer(":"+port, newRouter(svc, a.limiter, a.limits, a.cfg.Server, a.logger), a.cfg.Server)
+	server.TLSConfig = tlsConfig
+	g.Go(func() error {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), a.cfg.Server.ShutdownTimeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	})
+	g.Go(func() error {
+		listen := server.ListenAndServe
+		if tlsConfig != nil {
+			// The certificates come from the TLS config
+			listen = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		if err := listen(); err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	})
+	g.Go(func() error {
+		return serveGRPC(ctx, newGRPCServer(svc, a.logger), ":"+grpcPort)
+	})
+	g.Go(func() error {
+		svc.events.run(ctx)
+		return nil
+	})
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	a.logger.Info("Server starting",
+		zap.String("port", port),
+		zap.String("grpc_port", grpcPort),
+		zap.Bool("tls", tlsConfig != nil),
+		zap.Bool("mtls", tlsConfig != nil && tlsConfig.ClientCAs != nil),
+		zap.String("swagger", fmt.Sprintf("%s://localhost:%s/swagger/index.html", scheme, port)),
+	)
+	return g.Wait()
+}
+
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage database schema migrations",
+	}
+
+	migrateRun := func(run func(ctx context.Context, m *migrator, args []string) error) func(*cobra.Command, []string) error {
+		return withApp(func(ctx context.Context, a *app, args []string) error {
+			m, err := newMigrator(a.db, a.driver, a.logger)
+			if err != nil {
+				return err
+			}
+			return run(ctx, m, args)
+		})
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "Apply all pending migrations",
+			Args:  cobra.NoArgs,
+			RunE: migrateRun(func(ctx context.Context, m *migrator, _ []string) error {
+				return m.Up(ctx)
+			}),
+		},
+		&cobra.Command{
+			Use:   "down [n]",
+			Short: "Roll back the last n migrations (default 1)",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: migrateRun(func(ctx context.Context, m *migrator, args []string) error {
+				steps := 1
+				if len(args) == 1 {
+					n, err := strconv.Atoi(args[0])
+					if err != nil || n < 1 {
+						return fmt.Errorf("invalid number of steps: %s", args[0])
+					}
+					steps = n
+				}
+				return m.Down(ctx, steps)
+			}),
+		},
+		&cobra.Command{
+			Use:   "version",
+			Short: "Show the current and latest schema versions",
+			Args:  cobra.NoArgs,
+			RunE: migrateRun(func(ctx context.Context, m *migrator, _ []string) error {
+				version, err := m.Version(ctx)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("current: %d, latest: %d\n", version, m.latest())
+				return nil
+			}),
+		},
+		&cobra.Command{
+			Use:   "reencrypt",
+			Short: "Encrypt sensitive fields under the current FIELD_ENCRYPTION key",
+			Long: "Rewrites every sensitive field encrypted under an older key, or stored before field\n" +
+				"encryption was enabled, under the current key. Run it after rotating keys, before\n" +
+				"dropping the old key from FIELD_ENCRYPTION_KEYS. It is safe to run again.",
+			Args: cobra.NoArgs,
+			RunE: withApp(func(ctx context.Context, a *app, _ []string) error {
+				if a.fields == nil {
+					return fmt.Errorf("FIELD_ENCRYPTION is not set")
+				}
+				n, err := a.repo.RewriteSensitiveFields(ctx, a.fields.reencrypt)
+				a.logger.Info("Re-encrypted sensitive fields", zap.Int("count", n))
+				return err
+			}),
+		},
+	)
+	return cmd
+}
+
+func newWorkerCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "worker",
+		Short: "Run background workers",
+	}
+
+	var interval time.Duration
+	var batchSize int
+	var once bool
+	maturity := &cobra.Command{
+		Use:   "maturity",
+		Short: "Mature block accounts past their end date and queue payouts",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			svc := a.newService()
+			run := svc.reportJobFailures("maturity", svc.inActiveRegion("maturity", svc.asLeader("maturity", a.cfg.Workers.LeaseTTL, func(ctx context.Context) error {
+				n, err := svc.ProcessMaturities(ctx, svc.Now().UTC(), batchSize)
+				if n > 0 {
+					a.logger.Info("Matured block accounts", zap.Int("count", n))
+				}
+				return err
+			})))
+			if once {
+				return run(ctx)
+			}
+			interval := orConfigured(interval, a.cfg.Workers.Maturity)
+			runWorker(ctx, a.logger, "maturity", interval, svc.heartbeat("maturity", interval, run))
+			return nil
+		}),
+	}
+	maturity.Flags().DurationVar(&interval, "interval", 0, "time between maturity scans (default workers.maturity_interval)")
+	maturity.Flags().IntVar(&batchSize, "batch-size", 100, "accounts matured per transaction")
+	maturity.Flags().BoolVar(&once, "once", false, "run a single scan and exit")
+
+	var accrualInterval time.Duration
+	var accrualBatchSize int
+	var accrualOnce bool
+	accrual := &cobra.Command{
+		Use:   "accrual",
+		Short: "Pay monthly and quarterly interest that has fallen due",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			svc := a.newService()
+			run := svc.reportJobFailures("accrual", svc.inActiveRegion("accrual", svc.asLeader("accrual", a.cfg.Workers.LeaseTTL, func(ctx context.Context) error {
+				n, err := svc.ProcessInterestPayouts(ctx, svc.Now().UTC(), accrualBatchSize)
+				if n > 0 {
+					a.logger.Info("Recorded interest payouts", zap.Int("count", n))
+				}
+				return err
+			})))
+			if accrualOnce {
+				return run(ctx)
+			}
+			accrualInterval := orConfigured(accrualInterval, a.cfg.Workers.Accrual)
+			runWorker(ctx, a.logger, "accrual", accrualInterval, svc.heartbeat("accrual", accrualInterval, run))
+			return nil
+		}),
+	}
+	accrual.Flags().DurationVar(&accrualInterval, "interval", 0, "time between accrual scans (default workers.accrual_interval)")
+	accrual.Flags().IntVar(&accrualBatchSize, "batch-size", 100, "interest payments recorded per transaction")
+	accrual.Flags().BoolVar(&accrualOnce, "once", false, "run a single scan and exit")
+
+	var fundingInterval, fundingTimeout time.Duration
+	var fundingBatchSize int
+	var fundingOnce bool
+	funding := &cobra.Command{
+		Use:   "funding",
+		Short: "Settle pending account fundings and time out unfunded accounts",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			svc := a.newService()
+			run := svc.reportJobFailures("funding", svc.inActiveRegion("funding", svc.asLeader("funding", a.cfg.Workers.LeaseTTL, func(ctx context.Context) error {
+				n, err := svc.ReconcileFundings(ctx, svc.Now().UTC(), fundingTimeout, fundingBatchSize)
+				if n > 0 {
+					a.logger.Info("Settled account fundings", zap.Int("count", n))
+				}
+				return err
+			})))
+			if fundingOnce {
+				return run(ctx)
+			}
+			fundingInterval := orConfigured(fundingInterval, a.cfg.Workers.Funding)
+			runWorker(ctx, a.logger, "funding", fundingInterval, svc.heartbeat("funding", fundingInterval, run))
+			return nil
+		}),
+	}
+	funding.Flags().DurationVar(&fundingInterval, "interval", 0, "time between funding scans (default workers.funding_interval)")
+	funding.Flags().DurationVar(&fundingTimeout, "timeout", 30*time.Minute, "how long a debit may stay unconfirmed before the account fails")
+	funding.Flags().IntVar(&fundingBatchSize, "batch-size", 100, "pending fundings read per query")
+	funding.Flags().BoolVar(&fundingOnce, "once", false, "run a single scan and exit")
+
+	var jobsInterval, jobsLease time.Duration
+	var jobsConcurrency int
+	var jobsOnce bool
+	jobs := &cobra.Command{
+		Use:   "jobs",
+		Short: "Run queued asynchronous jobs such as bulk imports and maturity runs",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			if jobsConcurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			if jobsLease <= jobHeartbeatInterval {
+				return fmt.Errorf("--lease must be longer than %s", jobHeartbeatInterval)
+			}
+			svc := a.newService()
+			run := svc.reportJobFailures("jobs", func(ctx context.Context) error {
+				n, err := svc.RunJobs(ctx, jobsLease)
+				if n > 0 {
+					a.logger.Info("Finished jobs", zap.Int("count", n))
+				}
+				return err
+			})
+			if jobsOnce {
+				return run(ctx)
+			}
+
+			// Each slot claims and runs one job at a time
+			jobsInterval := orConfigured(jobsInterval, a.cfg.Workers.Jobs)
+			g, ctx := errgroup.WithContext(ctx)
+			for i := 0; i < jobsConcurrency; i++ {
+				g.Go(func() error {
+					runWorker(ctx, a.logger, "jobs", jobsInterval, svc.heartbeat("jobs", jobsInterval, run))
+					return nil
+				})
+			}
+			return g.Wait()
+		}),
+	}
+	jobs.Flags().DurationVar(&jobsInterval, "interval", 0, "time between checks for queued jobs (default workers.jobs_interval)")
+	jobs.Flags().DurationVar(&jobsLease, "lease", 5*time.Minute, "how long a job is hidden from other workers without a heartbeat")
+	jobs.Flags().IntVar(&jobsConcurrency, "concurrency", 4, "jobs run at the same time")
+	jobs.Flags().BoolVar(&jobsOnce, "once", false, "run the queued jobs one after another and exit")
+
+	var relayInterval, replayLease time.Duration
+	var relayBatchSize int
+	var relayOnce bool
+	outbox := &cobra.Command{
+		Use:   "outbox",
+		Short: "Relay domain events from the outbox to the message broker and run queued event replays",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			publisher, err := newEventPublisher(a.logger)
+			if err != nil {
+				return err
+			}
+			defer publisher.Close()
+
+			svc := a.newService()
+			run := svc.reportJobFailures("outbox", svc.inActiveRegion("outbox", func(ctx context.Context) error {
+				n, err := svc.RelayEvents(ctx, publisher, relayBatchSize)
+				if n > 0 {
+					a.logger.Info("Relayed outbox events", zap.Int("count", n))
+				}
+				if err != nil {
+					return err
+				}
+
+				publisherTo := func(topic string) (EventPublisher, error) {
+					return newEventPublisherTo(a.logger, topic)
+				}
+				n, err = svc.RunEventReplays(ctx, publisher, publisherTo, replayLease, relayBatchSize)
+				if n > 0 {
+					a.logger.Info("Completed event replays", zap.Int("count", n))
+				}
+				return err
+			}))
+			if relayOnce {
+				return run(ctx)
+			}
+			relayInterval := orConfigured(relayInterval, a.cfg.Workers.Outbox)
+			runWorker(ctx, a.logger, "outbox", relayInterval, svc.heartbeat("outbox", relayInterval, run))
+			return nil
+		}),
+	}
+	outbox.Flags().DurationVar(&relayInterval, "interval", 0, "time between outbox polls (default workers.outbox_interval)")
+	outbox.Flags().IntVar(&relayBatchSize, "batch-size", 100, "events published per transaction")
+	outbox.Flags().DurationVar(&replayLease, "replay-lease", 10*time.Minute, "how long an event replay is hidden from other workers once claimed")
+	outbox.Flags().BoolVar(&relayOnce, "once", false, "relay pending events and run queued replays once and exit")
+
+	var hookInterval time.Duration
+	var hookBatchSize int
+	var hookOnce bool
+	webhooks := &cobra.Command{
+		Use:   "webhooks",
+		Short: "Deliver pending webhook calls, retrying failures with backoff",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			svc := a.newService()
+			client := &http.Client{Timeout: webhookTimeout}
+			run := svc.reportJobFailures("webhooks", svc.inActiveRegion("webhooks", func(ctx context.Context) error {
+				n, err := svc.DeliverWebhooks(ctx, client, hookBatchSize)
+				if n > 0 {
+					a.logger.Info("Attempted webhook deliveries", zap.Int("count", n))
+				}
+				return err
+			}))
+			if hookOnce {
+				return run(ctx)
+			}
+			hookInterval := orConfigured(hookInterval, a.cfg.Workers.Webhooks)
+			runWorker(ctx, a.logger, "webhooks", hookInterval, svc.heartbeat("webhooks", hookInterval, run))
+			return nil
+		}),
+	}
+	webhooks.Flags().DurationVar(&hookInterval, "interval", 0, "time between delivery polls (default workers.webhooks_interval)")
+	webhooks.Flags().IntVar(&hookBatchSize, "batch-size", 50, "deliveries claimed per poll")
+	webhooks.Flags().BoolVar(&hookOnce, "once", false, "deliver due calls once and exit")
+
+	var criticalInterval, bulkInterval, eventsInterval, reminderInterval time.Duration
+	var notifyBatchSize int
+	var notifyOnce bool
+	notifications := &cobra.Command{
+		Use:   "notifications",
+		Short: "Queue customer notifications from account events and maturity reminders, and send them on their lanes",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			svc := a.newService()
+			events := svc.reportJobFailures("notifications-events", svc.inActiveRegion("notifications-events", svc.asLeader("notifications-events", a.cfg.Workers.LeaseTTL, func(ctx context.Context) error {
+				n, err := svc.QueueEventNotifications(ctx, notifyBatchSize)
+				if n > 0 {
+					a.logger.Info("Queued event notifications", zap.Int("count", n))
+				}
+				return err
+			})))
+			reminders := svc.reportJobFailures("notifications-reminders", svc.inActiveRegion("notifications-reminders", svc.asLeader("notifications-reminders", a.cfg.Workers.LeaseTTL, func(ctx context.Context) error {
+				n, err := svc.QueueMaturityReminders(ctx, notifyBatchSize)
+				if n > 0 {
+					a.logger.Info("Queued maturity reminders", zap.Int("count", n))
+				}
+				return err
+			})))
+			lane := func(priority string) func(context.Context) error {
+				return svc.reportJobFailures("notifications-"+priority, svc.inActiveRegion("notifications-"+priority, func(ctx context.Context) error {
+					n, err := svc.SendNotifications(ctx, priority, notifyBatchSize)
+					if n > 0 {
+						a.logger.Info("Sent notifications", zap.String("priority", priority), zap.Int("count", n))
+					}
+					return err
+				}))
+			}
+			if notifyOnce {
+				for _, run := range []func(context.Context) error{events, reminders, lane(PriorityCritical), lane(PriorityBulk)} {
+					if err := run(ctx); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			// Each lane polls independently, so a bulk backlog can't hold up critical sends
+			g, ctx := errgroup.WithContext(ctx)
+			g.Go(func() error {
+				eventsInterval := orConfigured(eventsInterval, a.cfg.Workers.NotifyEvents)
+				runWorker(ctx, a.logger, "notifications-events", eventsInterval, svc.heartbeat("notifications-events", eventsInterval, events))
+				return nil
+			})
+			g.Go(func() error {
+				reminderInterval := orConfigured(reminderInterval, a.cfg.Workers.NotifyRemind)
+				runWorker(ctx, a.logger, "notifications-reminders", reminderInterval, svc.heartbeat("notifications-reminders", reminderInterval, reminders))
+				return nil
+			})
+			g.Go(func() error {
+				criticalInterval := orConfigured(criticalInterval, a.cfg.Workers.NotifyCrit)
+				runWorker(ctx, a.logger, "notifications-critical", criticalInterval, svc.heartbeat("notifications-critical", criticalInterval, lane(PriorityCritical)))
+				return nil
+			})
+			g.Go(func() error {
+				bulkInterval := orConfigured(bulkInterval, a.cfg.Workers.NotifyBulk)
+				runWorker(ctx, a.logger, "notifications-bulk", bulkInterval, svc.heartbeat("notifications-bulk", bulkInterval, lane(PriorityBulk)))
+				return nil
+			})
+			return g.Wait()
+		}),
+	}
+	notifications.Flags().DurationVar(&criticalInterval, "critical-interval", 0, "time between critical lane polls (default workers.notifications_critical_interval)")
+	notifications.Flags().DurationVar(&bulkInterval, "bulk-interval", 0, "time between bulk lane polls (default workers.notifications_bulk_interval)")
+	notifications.Flags().DurationVar(&eventsInterval, "events-interval", 0, "time between reads of new account events (default workers.notifications_events_interval)")
+	notifications.Flags().DurationVar(&reminderInterval, "reminder-interval", 0, "time between maturity reminder scans (default workers.notifications_reminder_interval)")
+	notifications.Flags().IntVar(&notifyBatchSize, "batch-size", 100, "notifications claimed per poll")
+	notifications.Flags().BoolVar(&notifyOnce, "once", false, "queue and send notifications once and exit")
+
+	var reportCron string
+	var reportOnce bool
+	reports := &cobra.Command{
+		Use:   "reports",
+		Short: "Generate and deliver the daily reports on a cron schedule",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			sched, err := parseCron(reportCron)
+			if err != nil {
+				return err
+			}
+			if a.mailer == nil && a.store == nil {
+				a.logger.Warn("Neither SMTP_HOST nor OBJECT_STORE is set, reports are only recorded in the database")
+			}
+			svc := a.newService()
+			run := svc.reportJobFailures("reports", svc.inActiveRegion("reports", svc.asLeader("reports", a.cfg.Workers.LeaseTTL, func(ctx context.Context) error {
+				n, err := svc.RunScheduledReports(ctx, svc.Now())
+				if n > 0 {
+					a.logger.Info("Generated reports", zap.Int("count", n))
+				}
+				return err
+			})))
+			if reportOnce {
+				return run(ctx)
+			}
+			runScheduled(ctx, a.logger, "reports", sched, businessLocation(), run)
+			return nil
+		}),
+	}
+	reports.Flags().StringVar(&reportCron, "schedule", reportSchedule(), "cron expression in BUSINESS_TIMEZONE (REPORT_SCHEDULE)")
+	reports.Flags().BoolVar(&reportOnce, "once", false, "generate yesterday's reports if missing and exit")
+
+	var retentionCron string
+	var retentionBatchSize int
+	var retentionOnce bool
+	retention := &cobra.Command{
+		Use:   "retention",
+		Short: "Archive closed accounts past their retention period on a cron schedule",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			sched, err := parseCron(retentionCron)
+			if err != nil {
+				return err
+			}
+			policy, err := retentionPolicy()
+			if err != nil {
+				return err
+			}
+			svc := a.newService()
+			run := svc.reportJobFailures("retention", svc.inActiveRegion("retention", svc.asLeader("retention", a.cfg.Workers.LeaseTTL, func(ctx context.Context) error {
+				n, err := svc.ArchiveExpiredAccounts(ctx, svc.Now(), policy, retentionBatchSize)
+				if n > 0 {
+					a.logger.Info("Archived block accounts", zap.Int("count", n))
+				}
+				return err
+			})))
+			if retentionOnce {
+				return run(ctx)
+			}
+			runScheduled(ctx, a.logger, "retention", sched, businessLocation(), run)
+			return nil
+		}),
+	}
+	retention.Flags().StringVar(&retentionCron, "schedule", retentionSchedule(), "cron expression in BUSINESS_TIMEZONE (RETENTION_SCHEDULE)")
+	retention.Flags().IntVar(&retentionBatchSize, "batch-size", 100, "accounts listed for archiving at a time")
+	retention.Flags().BoolVar(&retentionOnce, "once", false, "archive the accounts due once and exit")
+
+	var reconciliationCron string
+	var reconciliationBatchSize int
+	var reconciliationOnce bool
+	reconciliation := &cobra.Command{
+		Use:   "reconciliation",
+		Short: "Reconcile account balances against their ledger on a cron schedule",
+		Args:  cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			sched, err := parseCron(reconciliationCron)
+			if err != nil {
+				return err
+			}
+			svc := a.newService()
+			run := svc.reportJobFailures("reconciliation", svc.inActiveRegion("reconciliation", svc.asLeader("reconciliation", a.cfg.Workers.LeaseTTL, func(ctx context.Context) error {
+				n, err := svc.ReconcileAccounts(ctx, svc.Now().UTC(), reconciliationBatchSize)
+				if n > 0 {
+					a.logger.Warn("Block accounts out of balance", zap.Int("count", n))
+				}
+				return err
+			})))
+			if reconciliationOnce {
+				return run(ctx)
+			}
+			runScheduled(ctx, a.logger, "reconciliation", sched, businessLocation(), run)
+			return nil
+		}),
+	}
+	reconciliation.Flags().StringVar(&reconciliationCron, "schedule", reconciliationSchedule(), "cron expression in BUSINESS_TIMEZONE (RECONCILIATION_SCHEDULE)")
+	reconciliation.Flags().IntVar(&reconciliationBatchSize, "batch-size", 500, "accounts reconciled at a time")
+	reconciliation.Flags().BoolVar(&reconciliationOnce, "once", false, "reconcile every account once and exit")
+
+	scheduler := &cobra.Command{
+		Use:   "scheduler",
+		Short: "Run the maturity, accrual, reconciliation, reports and retention jobs on their cron schedules",
+		Long: "Runs each periodic job on its cron expression from workers.schedules, in BUSINESS_TIMEZONE,\n" +
+			"in place of the maturity, accrual, reconciliation, reports and retention workers. A job\n" +
+			"still running when it falls due again is skipped. Jobs are paused, resumed and triggered\n" +
+			"through /admin/scheduler/jobs.",
+		Args: cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			schedules := a.cfg.Workers.Schedules
+			exprs := map[string]string{
+				ScheduledJobMaturity:       schedules.Maturity,
+				ScheduledJobAccrual:        schedules.Accrual,
+				ScheduledJobReconciliation: schedules.Reconciliation,
+				ScheduledJobReports:        schedules.Reports,
+				ScheduledJobRetention:      schedules.Retention,
+			}
+			policy, err := retentionPolicy()
+			if err != nil {
+				return err
+			}
+			if a.mailer == nil && a.store == nil {
+				a.logger.Warn("Neither SMTP_HOST nor OBJECT_STORE is set, reports are only recorded in the database")
+			}
+
+			svc := a.newService()
+			runs := map[string]func(context.Context) error{
+				ScheduledJobMaturity: func(ctx context.Context) error {
+					n, err := svc.ProcessMaturities(ctx, svc.Now().UTC(), 100)
+					if n > 0 {
+						a.logger.Info("Matured block accounts", zap.Int("count", n))
+					}
+					return err
+				},
+				ScheduledJobAccrual: func(ctx context.Context) error {
+					n, err := svc.ProcessInterestPayouts(ctx, svc.Now().UTC(), 100)
+					if n > 0 {
+						a.logger.Info("Recorded interest payouts", zap.Int("count", n))
+					}
+					return err
+				},
+				ScheduledJobReconciliation: func(ctx context.Context) error {
+					n, err := svc.ReconcileAccounts(ctx, svc.Now().UTC(), 500)
+					if n > 0 {
+						a.logger.Warn("Block accounts out of balance", zap.Int("count", n))
+					}
+					return err
+				},
+				ScheduledJobReports: func(ctx context.Context) error {
+					n, err := svc.RunScheduledReports(ctx, svc.Now())
+					if n > 0 {
+						a.logger.Info("Generated reports", zap.Int("count", n))
+					}
+					return err
+				},
+				ScheduledJobRetention: func(ctx context.Context) error {
+					n, err := svc.ArchiveExpiredAccounts(ctx, svc.Now(), policy, 100)
+					if n > 0 {
+						a.logger.Info("Archived block accounts", zap.Int("count", n))
+					}
+					return err
+				},
+			}
+			jobs := make([]*periodicJob, 0, len(scheduledJobNames))
+			for _, name := range scheduledJobNames {
+				sched, err := parseCron(exprs[name])
+				if err != nil {
+					return fmt.Errorf("%s schedule: %w", name, err)
+				}
+				jobs = append(jobs, &periodicJob{name: name, sched: sched, run: runs[name]})
+			}
+			sc, err := svc.newScheduler(businessLocation(), a.cfg.Workers.LeaseTTL, jobs...)
+			if err != nil {
+				return err
+			}
+			sc.Run(ctx)
+			return nil
+		}),
+	}
+
+	cmd.AddCommand(maturity, accrual, funding, jobs, outbox, webhooks, notifications, reports, retention, reconciliation, scheduler)
+	return cmd
+}
+
+func newSeedCommand() *cobra.Command {
+	plan := &seedPlan{}
+	var seed int64
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Insert randomly generated block accounts for development",
+		Long: `Insert randomly generated block accounts for development and load testing.
+Periods, statuses and payout frequencies are picked by weight, e.g.
+--periods 1y=3,3y=1 opens three 1y deposits for every 3y one. Matured and
+closed accounts matured within the last year and have no payout records;
+--due leaves active accounts past their maturity for the maturity worker.`,
+		Args: cobra.NoArgs,
+		RunE: withDeployment(func(ctx context.Context, a *app, _ []string) error {
+			start := time.Now()
+			counts, err := seedAccounts(withTenant(ctx, plan.Tenant), a.repo, a.ids, plan, rand.New(rand.NewSource(seed)))
+			if err != nil {
+				return err
+			}
+			a.logger.Info("Seeded block accounts", zap.Int("count", plan.Accounts), zap.Any("byStatus", counts),
+				zap.String("tenant", plan.Tenant), zap.Int64("seed", seed), zap.Duration("took", time.Since(start)))
+			return nil
+		}),
+	}
+	cmd.Flags().IntVar(&plan.Accounts, "accounts", 100, "number of block accounts to create")
+	cmd.Flags().IntVar(&plan.Users, "users", 20, "number of distinct user IDs to spread accounts across")
+	cmd.Flags().StringVar(&plan.Tenant, "tenant", DefaultTenant, "tenant the accounts belong to")
+	cmd.Flags().StringToIntVar(&plan.Periods, "periods", map[string]int{"3m": 1, "6m": 1, "1y": 1, "3y": 1}, "weight of each deposit period")
+	cmd.Flags().StringToIntVar(&plan.Statuses, "statuses", map[string]int{StatusActive: 1}, "weight of each status: active, frozen, matured, closed")
+	cmd.Flags().StringToIntVar(&plan.Frequencies, "frequencies", map[string]int{FrequencyAtMaturity: 1}, "weight of each interest payout frequency")
+	cmd.Flags().Float64Var(&plan.Due, "due", 0, "fraction of active accounts already past their maturity date")
+	cmd.Flags().DurationVar(&plan.MaturingWithin, "maturing-within", 0, "date the other active accounts' maturities within this long from now; unset spreads them over their term")
+	cmd.Flags().Int64Var(&seed, "seed", time.Now().UnixNano(), "random seed for reproducible data")
+	return cmd
+}
+
+func newAPIKeyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "api-key",
+		Short: "Manage API keys for service-to-service callers",
+	}
+
+	var name, issuedBy, tenant string
+	var scopes []string
+	issue := &cobra.Command{
+		Use:   "issue",
+		Short: "Issue an API key and print it; use this for the first admin key",
+		Args:  cobra.NoArgs,
+		RunE: withApp(func(ctx context.Context, a *app, _ []string) error {
+			req := &IssueAPIKeyRequest{Name: name, Scopes: scopes, TenantID: tenant}
+			if err := validateIssueAPIKeyRequest(req, time.Now()); err != nil {
+				return err
+			}
+			apiKey, err := a.newService().IssueAPIKey(ctx, issuedBy, req)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("id: %d\nprefix: %s\nkey: %s\n", apiKey.ID, apiKey.Prefix, apiKey.Key)
+			return nil
+		}),
+	}
+	issue.Flags().StringVar(&name, "name", "", "name of the caller the key is for")
+	issue.Flags().StringSliceVar(&scopes, "scopes", []string{ScopeRead}, "scopes to grant: read, write, admin")
+	issue.Flags().StringVar(&issuedBy, "issued-by", "cli", "who is recorded as having issued the key")
+	issue.Flags().StringVar(&tenant, "tenant", "", "tenant to bind the key to; unset issues a platform key")
+	issue.MarkFlagRequired("name")
+
+	cmd.AddCommand(issue)
+	return cmd
+}
+
+func newTenantCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tenant",
+		Short: "Manage the tenants accounts are isolated between",
+	}
+
+	var name string
+	create := &cobra.Command{
+		Use:   "create <id>",
+		Short: "Create a tenant with the built-in rate plan",
+		Args:  cobra.ExactArgs(1),
+		RunE: withApp(func(ctx context.Context, a *app, args []string) error {
+			req := &CreateTenantRequest{ID: args[0], Name: name}
+			if err := validateRequest(req); err != nil {
+				return err
+			}
+			tenant, err := a.newService().CreateTenant(ctx, req)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("id: %s\nname: %s\n", tenant.ID, tenant.Name)
+			return nil
+		}),
+	}
+	create.Flags().StringVar(&name, "name", "", "name of the institution")
+	create.MarkFlagRequired("name")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List tenants",
+		Args:  cobra.NoArgs,
+		RunE: withApp(func(ctx context.Context, a *app, _ []string) error {
+			tenants, err := a.newService().ListTenants(ctx)
+			if err != nil {
+				return err
+			}
+			for _, t := range tenants {
+				fmt.Printf("%s\t%s\n", t.ID, t.Name)
+			}
+			return nil
+		}),
+	}
+
+	cmd.AddCommand(create, list)
+	return cmd
+}
+
+// orConfigured returns a worker's interval flag, or the configured interval
+// when the flag is not set
+func orConfigured(flag, configured time.Duration) time.Duration {
+	if flag > 0 {
+		return flag
+	}
+	return configured
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CreateAccount opens a block account. The request carries an idempotency
+// key (see WithIdempotencyKey), so a retry after a lost response gets the
+// account the first attempt opened rather than a second one. The service
+// remembers keys for 24 hours.
+// The account comes back with status "pending_funding" when its funding debit
+// has not confirmed yet.
+func (c *Client) CreateAccount(ctx context.Context, req CreateAccountRequest) (*Account, error) {
+	var account Account
+	if err := c.do(ctx, call{method: http.MethodPost, path: "/block-account", body: req, idempotent: true, etag: &account.ETag}, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetAccount returns the block account with the external ID id. A missing
+// account is an *Error for which IsNotFound reports true.
+func (c *Client) GetAccount(ctx context.Context, id string) (*Account, error) {
+	var account Account
+	if err := c.do(ctx, call{method: http.MethodGet, path: fmt.Sprintf("/block-account/%s", url.PathEscape(id)), etag: &account.ETag}, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// ListAccountsByUser returns all of a user's block accounts
+func (c *Client) ListAccountsByUser(ctx context.Context, userID int) ([]*Account, error) {
+	return list[*Account](ctx, c, fmt.Sprintf("/user/%d/block-accounts", userID), 0)
+}
+
+// ListProducts returns the deposit products a user can open, including pilots
+// they have been let into. A userID of 0 lists generally available products.
+func (c *Client) ListProducts(ctx context.Context, userID int) ([]*Product, error) {
+	path := "/products"
+	if userID != 0 {
+		path += "?user_id=" + strconv.Itoa(userID)
+	}
+	return list[*Product](ctx, c, path, 0)
+}
+
+// CloseAccount closes a block account, paying it out to the request's
+// destination. The account comes back with status "closing" until the
+// payout is sent. Pass the account's ETag with WithIfMatch.
+func (c *Client) CloseAccount(ctx context.Context, id string, req CloseAccountRequest) (*Account, error) {
+	var account Account
+	path := fmt.Sprintf("/block-account/%s/close", url.PathEscape(id))
+	if err := c.do(ctx, call{method: http.MethodPost, path: path, body: req, etag: &account.ETag}, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// DeleteAccount removes a block account's data without paying it out. It
+// is a staff tool, which the service only accepts with the staff member's
+// identity set by the gateway; use CloseAccount to close an account. Pass
+// the account's ETag with WithIfMatch.
+func (c *Client) DeleteAccount(ctx context.Context, id string) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: fmt.Sprintf("/block-account/%s", url.PathEscape(id))}, nil)
+}
+
+// ChangeMaturityInstruction sets whether an account pays out or rolls over at
+// maturity. Pass the account's ETag with WithIfMatch.
+func (c *Client) ChangeMaturityInstruction(ctx context.Context, id string, req MaturityInstructionRequest) (*Account, error) {
+	var account Account
+	path := fmt.Sprintf("/block-account/%s/maturity-instruction", url.PathEscape(id))
+	if err := c.do(ctx, call{method: http.MethodPut, path: path, body: req, etag: &account.ETag}, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// ListCommunications returns the notifications, statements and certificates
+// sent about an account
+func (c *Client) ListCommunications(ctx context.Context, accountID string) ([]*Communication, error) {
+	path := fmt.Sprintf("/block-account/%s/communications", url.PathEscape(accountID))
+	return list[*Communication](ctx, c, path, 0)
+}
+
+// GetPayoutSchedule returns the interest paid on an account and its upcoming
+// payout dates
+func (c *Client) GetPayoutSchedule(ctx context.Context, accountID string) (*PayoutSchedule, error) {
+	var schedule PayoutSchedule
+	path := fmt.Sprintf("/block-account/%s/payout-schedule", url.PathEscape(accountID))
+	if err := c.do(ctx, call{method: http.MethodGet, path: path}, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// GetTaxCertificate returns a user's interest certificate for a tax year
+func (c *Client) GetTaxCertificate(ctx context.Context, userID, year int) (*TaxCertificate, error) {
+	var cert TaxCertificate
+	path := fmt.Sprintf("/user/%d/tax-certificate?year=%d", userID, year)
+	if err := c.do(ctx, call{method: http.MethodGet, path: path}, &cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// GetPortfolio returns the summary of all of a user's accounts
+func (c *Client) GetPortfolio(ctx context.Context, userID int) (*Portfolio, error) {
+	var portfolio Portfolio
+	path := fmt.Sprintf("/user/%d/portfolio", userID)
+	if err := c.do(ctx, call{method: http.MethodGet, path: path}, &portfolio); err != nil {
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+// ConfirmPayout reports that an account's payout was sent, which closes an
+// account that was closing
+func (c *Client) ConfirmPayout(ctx context.Context, accountID string) (*Payout, error) {
+	var payout Payout
+	path := fmt.Sprintf("/admin/block-account/%s/payout/sent", url.PathEscape(accountID))
+	if err := c.do(ctx, call{method: http.MethodPost, path: path}, &payout); err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// FailPayout reports that an account's maturity payout was rejected
+func (c *Client) FailPayout(ctx context.Context, accountID, reason string) (*Payout, error) {
+	var payout Payout
+	path := fmt.Sprintf("/admin/block-account/%s/payout/failure", url.PathEscape(accountID))
+	body := map[string]string{"reason": reason}
+	if err := c.do(ctx, call{method: http.MethodPost, path: path, body: body}, &payout); err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// RetryPayout retries a failed payout, to destination when it is not empty
+func (c *Client) RetryPayout(ctx context.Context, accountID, destination string) (*Payout, error) {
+	var payout Payout
+	path := fmt.Sprintf("/admin/block-account/%s/payout/retry", url.PathEscape(accountID))
+	body := map[string]string{}
+	if destination != "" {
+		body["destination_account"] = destination
+	}
+	if err := c.do(ctx, call{method: http.MethodPost, path: path, body: body}, &payout); err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// ListMaturingSoon returns up to limit active accounts maturing within the
+// window, soonest first. A zero within uses the service's default window
+// and a zero limit returns them all.
+func (c *Client) ListMaturingSoon(ctx context.Context, within time.Duration, limit int) ([]*Account, error) {
+	path := "/admin/block-accounts/maturing-soon"
+	if within > 0 {
+		path += "?days=" + strconv.Itoa(int(within/(24*time.Hour)))
+	}
+	return list[*Account](ctx, c, path, limit)
+}
+
+// ProjectRateScenario projects the portfolio's interest liability under a
+// proposed rate per period, e.g. {"1y": 0.055}
+func (c *Client) ProjectRateScenario(ctx context.Context, rates map[string]float64) (*RateScenarioResult, error) {
+	var result RateScenarioResult
+	body := map[string]interface{}{"rates": rates}
+	if err := c.do(ctx, call{method: http.MethodPost, path: "/admin/analysis/rate-scenario", body: body}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,417 @@
+// Package client is a typed Go client for the Block Account REST API.
+//
+// It unwraps the service's success envelope into typed results, follows list
+// pages to the end, turns error envelopes into *Error values, retries transient failures with exponential
+// backoff and attaches an idempotency key to every create so that a retried
+// request can be recognized as the same one.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Headers understood by the service
+const (
+	RequestIDHeader      = "X-Request-ID"
+	IdempotencyKeyHeader = "Idempotency-Key"
+	ConsistencyHeader    = "X-Consistency"
+)
+
+// Default retry policy: up to defaultMaxRetries retries after the first
+// attempt, backing off from defaultRetryBase and capped at defaultRetryMax
+const (
+	defaultMaxRetries = 3
+	defaultRetryBase  = 200 * time.Millisecond
+	defaultRetryMax   = 5 * time.Second
+	defaultTimeout    = 30 * time.Second
+)
+
+// apiVersion is the version prefix of the routes this client calls
+const apiVersion = "/v2"
+
+// listPageSize is the page size list methods ask for, the service's maximum
+const listPageSize = 200
+
+// Client calls the Block Account REST API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+	apiKey     string
+	maxRetries int
+	retryBase  time.Duration
+	retryMax   time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetry sets how many times a failed request is retried and the backoff
+// between attempts. maxRetries of 0 disables retries.
+func WithRetry(maxRetries int, base, max time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.retryBase = base
+		c.retryMax = max
+	}
+}
+
+// WithUserAgent sets the User-Agent sent with every request
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// WithAPIKey authenticates every request with an API key issued by the
+// service's admins
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// New returns a client for the service at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		userAgent:  "block-account-go-client",
+		maxRetries: defaultMaxRetries,
+		retryBase:  defaultRetryBase,
+		retryMax:   defaultRetryMax,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is a non-2xx response from the service
+type Error struct {
+	StatusCode int
+	// Status is the HTTP status text reported by the service, e.g. "Not Found"
+	Status    string
+	Message   string
+	RequestID string
+	// Rule is the business rule code of a 422, e.g. "max_total_principal"
+	Rule string
+	// Code is the machine-readable error code, e.g. "ACCOUNT_NOT_FOUND"
+	Code string
+	// Details are code-specific values, such as the limit a request broke
+	Details map[string]any
+	// Fields lists the request fields that failed validation
+	Fields []FieldError
+}
+
+// FieldError is a request field the service rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("block account API: %d %s", e.StatusCode, e.Status)
+	}
+	return fmt.Sprintf("block account API: %d %s: %s", e.StatusCode, e.Status, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the service
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// ViolatedRule returns the business rule code when err is a 422 from the
+// service, and "" otherwise
+func ViolatedRule(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity {
+		return apiErr.Rule
+	}
+	return ""
+}
+
+// ErrorCode returns the service's error code when err is a response from
+// the service, and "" otherwise
+func ErrorCode(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+type ctxKey string
+
+const (
+	requestIDKey      ctxKey = "requestID"
+	idempotencyKeyKey ctxKey = "idempotencyKey"
+	consistencyKey    ctxKey = "consistency"
+	ifMatchKey        ctxKey = "ifMatch"
+)
+
+// WithRequestID sends id as the X-Request-ID of requests made with ctx, so
+// the call can be traced through the service logs
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// WithIdempotencyKey sets the idempotency key for a create made with ctx.
+// Creates generate a key when none is set; pass one explicitly to keep it
+// stable across process restarts.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey, key)
+}
+
+// WithStrongConsistency asks the service to serve reads made with ctx from
+// the primary, so they observe writes made just before
+func WithStrongConsistency(ctx context.Context) context.Context {
+	return context.WithValue(ctx, consistencyKey, true)
+}
+
+// WithIfMatch sends etag as the If-Match of a change made with ctx, so the
+// change fails with a 412 if the account changed since it was read. Changes
+// to an account need one; Account.ETag holds the account's.
+func WithIfMatch(ctx context.Context, etag string) context.Context {
+	return context.WithValue(ctx, ifMatchKey, etag)
+}
+
+// envelope is the service's success and error response format
+type envelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Rule    string          `json:"rule"`
+	// ErrorCode, Details and Fields describe errors for programs
+	ErrorCode string         `json:"error_code"`
+	Details   map[string]any `json:"details"`
+	Fields    []FieldError   `json:"fields"`
+}
+
+// call describes one API request
+type call struct {
+	method string
+	path   string
+	body   interface{}
+	// idempotent requests are replayed by the service when sent again with
+	// the same Idempotency-Key. They get a key when the caller has not set
+	// one, and are the only POSTs retried.
+	idempotent bool
+	// etag, when set, receives the ETag of a successful response
+	etag *string
+}
+
+// do sends the request, retrying transient failures, and decodes the
+// envelope's data into out when out is non-nil
+func (c *Client) do(ctx context.Context, cl call, out interface{}) error {
+	var body []byte
+	if cl.body != nil {
+		var err error
+		if body, err = json.Marshal(cl.body); err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+	}
+
+	idempotencyKey, _ := ctx.Value(idempotencyKeyKey).(string)
+	if idempotencyKey == "" && cl.idempotent {
+		idempotencyKey = uuid.NewString()
+	}
+	// A POST is only safe to repeat when the service recognizes the retry
+	retryable := cl.method != http.MethodPost || cl.idempotent
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, cl, body, idempotencyKey)
+		if err == nil {
+			err = decodeResponse(resp, out)
+			if err == nil && cl.etag != nil {
+				*cl.etag = resp.Header.Get("ETag")
+			}
+			if !retryable || attempt >= c.maxRetries || !retryableStatus(resp.StatusCode) {
+				return err
+			}
+		} else if !retryable || attempt >= c.maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		wait := c.backoff(attempt)
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				wait = after
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send makes a single HTTP request
+func (c *Client) send(ctx context.Context, cl call, body []byte, idempotencyKey string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, cl.method, c.baseURL+apiVersion+cl.path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id, _ := ctx.Value(requestIDKey).(string); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	if strong, _ := ctx.Value(consistencyKey).(bool); strong {
+		req.Header.Set(ConsistencyHeader, "strong")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
+	if etag, _ := ctx.Value(ifMatchKey).(string); etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", cl.method, cl.path, err)
+	}
+	return resp, nil
+}
+
+// decodeResponse unwraps the response envelope and closes the body
+func decodeResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{
+			StatusCode: resp.StatusCode,
+			Status:     http.StatusText(resp.StatusCode),
+			RequestID:  resp.Header.Get(RequestIDHeader),
+		}
+		var env envelope
+		if json.Unmarshal(raw, &env) == nil && env.Error != "" {
+			apiErr.Status = env.Error
+			apiErr.Message = env.Message
+			apiErr.Rule = env.Rule
+			apiErr.Code, apiErr.Details, apiErr.Fields = env.ErrorCode, env.Details, env.Fields
+		}
+		return apiErr
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent || len(raw) == 0 {
+		return nil
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if len(env.Data) == 0 || string(env.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("decode response data: %w", err)
+	}
+	return nil
+}
+
+// list fetches the list at path page by page, following next_cursor, until
+// the last page or until it has max items when max is positive
+func list[T any](ctx context.Context, c *Client, path string, max int) ([]T, error) {
+	size := listPageSize
+	if max > 0 && max < size {
+		size = max
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	var items []T
+	cursor := ""
+	for {
+		pagePath := path + sep + "limit=" + strconv.Itoa(size)
+		if cursor != "" {
+			pagePath += "&cursor=" + url.QueryEscape(cursor)
+		}
+		var page struct {
+			Items      []T    `json:"items"`
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := c.do(ctx, call{method: http.MethodGet, path: pagePath}, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		if page.NextCursor == "" || (max > 0 && len(items) >= max) {
+			if max > 0 && len(items) > max {
+				items = items[:max]
+			}
+			return items, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the jittered wait before retry number attempt+1
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.retryBase << attempt
+	if wait <= 0 || wait > c.retryMax {
+		wait = c.retryMax
+	}
+	// Full jitter keeps many clients from retrying in lockstep
+	return time.Duration(rand.Int64N(int64(wait) + 1))
+}
+
+// retryAfter returns the server's requested wait, if any
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
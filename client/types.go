@@ -0,0 +1,271 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Account is a block account as returned by the API
+type Account struct {
+	// ID is the account's external ID, a UUID
+	ID string `json:"id"`
+	// ETag is the version of the account as read, for WithIfMatch
+	ETag                string    `json:"-"`
+	UserID              int       `json:"user_id"`
+	Principal           float64   `json:"principal"`
+	StartDate           time.Time `json:"start_date"`
+	EndDate             time.Time `json:"end_date"`
+	InterestRate        float64   `json:"interest_rate"`
+	Period              string    `json:"period,omitempty"`
+	Status              string    `json:"status"`
+	MaturityInstruction string    `json:"maturity_instruction"`
+	// PayoutDestination and the other account numbers the service returns
+	// are masked to their last four digits
+	PayoutDestination   string     `json:"payout_destination,omitempty"`
+	PayoutFrequency     string     `json:"payout_frequency"`
+	NextPayoutDate      *time.Time `json:"next_payout_date,omitempty"`
+	InterestPaidThrough *time.Time `json:"interest_paid_through,omitempty"`
+	InterestAdjustment  float64    `json:"interest_adjustment,omitempty"`
+	TenantID            string     `json:"tenant_id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	// Funding is set while the account's funding debit is pending or after it failed
+	Funding *Funding `json:"funding,omitempty"`
+	// Closure is set once the account's holder closed it
+	Closure *Closure `json:"closure,omitempty"`
+}
+
+// Funding is the debit moving an account's principal from the customer's settlement account
+type Funding struct {
+	SettlementAccount string     `json:"settlement_account"`
+	Reference         string     `json:"reference"`
+	Amount            float64    `json:"amount"`
+	Status            string     `json:"status"` // "pending", "confirmed", "failed" or "expired"
+	FailureReason     string     `json:"failure_reason,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	SettledAt         *time.Time `json:"settled_at,omitempty"`
+}
+
+// Closure is where and how a closed account's final payout is sent
+type Closure struct {
+	DestinationAccount string     `json:"destination_account"`
+	Method             string     `json:"method"` // "bank_transfer" or "internal_transfer"
+	Amount             float64    `json:"amount"`
+	RequestedAt        time.Time  `json:"requested_at"`
+	ClosedAt           *time.Time `json:"closed_at,omitempty"`
+}
+
+// CreateAccountRequest opens a block account
+type CreateAccountRequest struct {
+	UserID    int     `json:"user_id"`
+	Principal float64 `json:"principal"`
+	// Period is the code of the product to open, e.g. "1y"; see ListProducts.
+	// ProductCode may be set instead.
+	Period          string `json:"period,omitempty"`
+	ProductCode     string `json:"product_code,omitempty"`
+	PayoutFrequency string `json:"payout_frequency,omitempty"` // "monthly", "quarterly", "at_maturity" (default)
+	// SettlementAccount is debited for the principal when the service funds accounts
+	SettlementAccount string `json:"settlement_account,omitempty"`
+}
+
+// InterestPayout is interest paid on an account for one accrual period
+type InterestPayout struct {
+	ID          int       `json:"id"`
+	AccountID   string    `json:"account_id"`
+	Destination string    `json:"destination_account"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Amount      float64   `json:"amount"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ScheduledPayout is an upcoming interest or maturity payment
+type ScheduledPayout struct {
+	Date      time.Time `json:"date"`
+	Type      string    `json:"type"` // "interest" or "maturity"
+	Interest  float64   `json:"interest"`
+	Principal float64   `json:"principal"`
+	Amount    float64   `json:"amount"`
+}
+
+// PayoutSchedule is the interest paid on an account and its upcoming payments
+type PayoutSchedule struct {
+	AccountID       string             `json:"account_id"`
+	PayoutFrequency string             `json:"payout_frequency"`
+	Paid            []*InterestPayout  `json:"paid"`
+	Upcoming        []*ScheduledPayout `json:"upcoming"`
+}
+
+// Product is a deposit product a user can open
+type Product struct {
+	Period       string  `json:"period"` // the product code
+	Name         string  `json:"name"`
+	Months       int     `json:"months"`
+	Rate         float64 `json:"rate"`
+	MinPrincipal float64 `json:"min_principal"`
+	// EarlyWithdrawal is "allowed", "approval" or "not_allowed"
+	EarlyWithdrawal string `json:"early_withdrawal"`
+	Pilot           bool   `json:"pilot"`
+}
+
+// MaturityInstructionRequest changes what happens to an account at maturity
+type MaturityInstructionRequest struct {
+	Instruction        string `json:"instruction"` // "payout" or "rollover"
+	DestinationAccount string `json:"destination_account,omitempty"`
+}
+
+// CloseAccountRequest closes an account, saying where its final payout goes
+type CloseAccountRequest struct {
+	DestinationAccount string `json:"destination_account"`
+	Method             string `json:"method"` // "bank_transfer" or "internal_transfer"
+}
+
+// Payout is a maturity payout instruction and its delivery state
+type Payout struct {
+	ID            int       `json:"id"`
+	AccountID     string    `json:"account_id"`
+	Destination   string    `json:"destination_account"`
+	Amount        float64   `json:"amount"`
+	Status        string    `json:"status"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	Attempts      int       `json:"attempts"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Communication is something the customer was told about an account
+type Communication struct {
+	ID        int       `json:"id"`
+	AccountID string    `json:"account_id"`
+	UserID    int       `json:"user_id"`
+	Kind      string    `json:"kind"`
+	Event     string    `json:"event"`
+	Subject   string    `json:"subject"`
+	Message   string    `json:"message"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TaxCertificate summarizes a user's interest income for one tax year
+type TaxCertificate struct {
+	UserID           int                  `json:"user_id"`
+	Year             int                  `json:"year"`
+	WithholdingRate  float64              `json:"withholding_rate"`
+	Accounts         []TaxCertificateLine `json:"accounts"`
+	TotalInterest    float64              `json:"total_interest"`
+	TotalTaxWithheld float64              `json:"total_tax_withheld"`
+	NetInterest      float64              `json:"net_interest"`
+	GeneratedAt      time.Time            `json:"generated_at"`
+}
+
+// Portfolio sums up all of a user's accounts. The totals cover the active
+// and frozen accounts.
+type Portfolio struct {
+	UserID                int                        `json:"user_id"`
+	Currency              string                     `json:"currency"`
+	Accounts              int                        `json:"accounts"`
+	TotalPrincipal        float64                    `json:"total_principal"`
+	TotalAccruedInterest  float64                    `json:"total_accrued_interest"`
+	WeightedAverageRate   float64                    `json:"weighted_average_rate"`
+	NextMaturityDate      *time.Time                 `json:"next_maturity_date,omitempty"`
+	NextMaturityAccountID string                     `json:"next_maturity_account_id,omitempty"`
+	ByStatus              map[string]PortfolioStatus `json:"by_status"`
+	ValuedAt              time.Time                  `json:"valued_at"`
+}
+
+// PortfolioStatus sums a user's accounts in one status
+type PortfolioStatus struct {
+	Accounts        int     `json:"accounts"`
+	Principal       float64 `json:"principal"`
+	AccruedInterest float64 `json:"accrued_interest"`
+}
+
+// TaxCertificateLine is one account's contribution to a tax certificate
+type TaxCertificateLine struct {
+	AccountID      string        `json:"account_id"`
+	Principal      float64       `json:"principal"`
+	InterestRate   float64       `json:"interest_rate"`
+	InterestEarned float64       `json:"interest_earned"`
+	TaxWithheld    float64       `json:"tax_withheld"`
+	Beneficiaries  []Beneficiary `json:"beneficiaries,omitempty"`
+}
+
+// Beneficiary is a person named to receive a share of an account
+type Beneficiary struct {
+	Name              string    `json:"name"`
+	Relationship      string    `json:"relationship"`
+	AllocationPercent float64   `json:"allocation_percent"`
+	DesignatedAt      time.Time `json:"designated_at"`
+}
+
+// RateScenarioResult compares interest liability under current and proposed rates
+type RateScenarioResult struct {
+	Periods           []PeriodProjection `json:"periods"`
+	Accounts          int                `json:"accounts"`
+	Principal         float64            `json:"principal"`
+	CurrentLiability  float64            `json:"current_liability"`
+	ScenarioLiability float64            `json:"scenario_liability"`
+	Change            float64            `json:"change"`
+	GeneratedAt       time.Time          `json:"generated_at"`
+}
+
+// PeriodProjection is the rate scenario for the accounts of one period
+type PeriodProjection struct {
+	Period            string  `json:"period"`
+	Accounts          int     `json:"accounts"`
+	Principal         float64 `json:"principal"`
+	CurrentRate       float64 `json:"current_rate"`
+	ScenarioRate      float64 `json:"scenario_rate"`
+	CurrentLiability  float64 `json:"current_liability"`
+	ScenarioLiability float64 `json:"scenario_liability"`
+	Change            float64 `json:"change"`
+}
+
+// Webhook is a callback URL subscribed to account lifecycle events. Secret
+// is only set on the webhook returned by CreateWebhook.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Channel   string    `json:"channel"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWebhookRequest registers a webhook
+type CreateWebhookRequest struct {
+	URL     string   `json:"url"`
+	Channel string   `json:"channel,omitempty"` // "account" (default) or "operations"
+	Events  []string `json:"events"`
+}
+
+// WebhookDelivery is one event queued for one webhook
+type WebhookDelivery struct {
+	ID             int               `json:"id"`
+	WebhookID      int               `json:"webhook_id"`
+	EventID        string            `json:"event_id"`
+	EventType      string            `json:"event_type"`
+	Payload        json.RawMessage   `json:"payload"`
+	Status         string            `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at"`
+	LastStatusCode int               `json:"last_status_code,omitempty"`
+	LastError      string            `json:"last_error,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	AttemptLog     []*WebhookAttempt `json:"attempt_log"`
+}
+
+// WebhookAttempt is one HTTP call made to deliver a webhook
+type WebhookAttempt struct {
+	ID          int       `json:"id"`
+	DeliveryID  int       `json:"delivery_id"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CreateWebhook registers a webhook. The returned Secret is only available
+// here and is needed to verify delivery signatures.
+func (c *Client) CreateWebhook(ctx context.Context, req CreateWebhookRequest) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.do(ctx, call{method: http.MethodPost, path: "/webhooks", body: req}, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// DeleteWebhook unregisters a webhook
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: fmt.Sprintf("/webhooks/%d", id)}, nil)
+}
+
+// ListWebhookDeliveries returns a webhook's deliveries with their attempt logs
+func (c *Client) ListWebhookDeliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error) {
+	return list[*WebhookDelivery](ctx, c, fmt.Sprintf("/webhooks/%d/deliveries", webhookID), 0)
+}
+
+// ReplayWebhookDeliveries queues a webhook's failed deliveries for another
+// round of attempts and returns how many were queued
+func (c *Client) ReplayWebhookDeliveries(ctx context.Context, webhookID int) (int, error) {
+	var result struct {
+		Replayed int `json:"replayed"`
+	}
+	path := fmt.Sprintf("/admin/webhooks/%d/replay", webhookID)
+	if err := c.do(ctx, call{method: http.MethodPost, path: path}, &result); err != nil {
+		return 0, err
+	}
+	return result.Replayed, nil
+}
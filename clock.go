@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// clockRefreshInterval is how often a sandbox process rereads its clock, so
+// an advance made through one server reaches the others and the workers
+const clockRefreshInterval = 5 * time.Second
+
+// maxClockAdvance is the furthest one request moves the clock, enough to
+// mature the longest term at a time scale of 1
+const maxClockAdvance = 5 * 366 * 24 * time.Hour
+
+// ErrClockFixed is returned when advancing the clock outside a sandbox
+var ErrClockFixed = newAPIError(CodeClockFixed, "the clock only moves in a sandbox")
+
+// Clock tells the account lifecycle what time it is: when terms start,
+// what interest has accrued and which accounts are due to mature or pay
+// interest. Jobs, leases, caches and rate limits keep to real time.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is real time, the clock of every deployment but a sandbox
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// sandboxClock is real time moved forward by an offset QA advances to
+// fast-forward accrual and maturities. The offset is kept on the deployment
+// row so that every server and worker of the sandbox agrees on it.
+type sandboxClock struct {
+	offset atomic.Int64
+}
+
+func (c *sandboxClock) Now() time.Time {
+	return time.Now().Add(c.Offset())
+}
+
+// Offset returns how far the clock runs ahead of real time
+func (c *sandboxClock) Offset() time.Duration {
+	return time.Duration(c.offset.Load())
+}
+
+func (c *sandboxClock) set(offset time.Duration) {
+	c.offset.Store(int64(offset))
+}
+
+// newClock returns the deployment's clock: one that can be advanced in a
+// sandbox and real time everywhere else
+func newClock() Clock {
+	if sandboxMode() {
+		return &sandboxClock{}
+	}
+	return systemClock{}
+}
+
+// Now returns the time on the service's clock, or real time for a service
+// built without one
+func (s *service) Now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+// watchClock loads a sandbox clock's offset, then reloads it every
+// clockRefreshInterval until ctx ends. Like watchProducts, only the first
+// load must succeed. Other clocks need no watching.
+func watchClock(ctx context.Context, repo Repository, clock Clock, logger *zap.Logger) error {
+	c, ok := clock.(*sandboxClock)
+	if !ok {
+		return nil
+	}
+	offset, err := repo.ClockOffset(ctx)
+	if err != nil {
+		return fmt.Errorf("load clock offset: %w", err)
+	}
+	c.set(offset)
+	go func() {
+		ticker := time.NewTicker(clockRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				offset, err := repo.ClockOffset(ctx)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Warn("Failed to reload clock offset", zap.Error(err))
+					}
+					continue
+				}
+				c.set(offset)
+			}
+		}
+	}()
+	return nil
+}
+
+// SandboxClock is where a sandbox's clock stands
+// @Description The sandbox's clock, which account terms, accrual and maturities follow
+type SandboxClock struct {
+	// Now is the time on the sandbox's clock
+	Now time.Time `json:"now"`
+	// OffsetSeconds is how far it runs ahead of real time
+	OffsetSeconds int64 `json:"offset_seconds" example:"2592000"`
+}
+
+// AdvanceTimeRequest is the payload for moving the sandbox's clock forward
+// @Description Request payload for moving the sandbox's clock forward by days and hours
+type AdvanceTimeRequest struct {
+	Days  int `json:"days" example:"30" validate:"min=0,max=1830"`
+	Hours int `json:"hours" example:"0" validate:"min=0,max=43920"`
+}
+
+// AdvanceClock moves the sandbox's clock forward by d for every server and
+// worker of the deployment. The next worker runs then pay the interest and
+// mature the accounts that have fallen due.
+func (s *service) AdvanceClock(ctx context.Context, d time.Duration, staffID string) (*SandboxClock, error) {
+	c, ok := s.clock.(*sandboxClock)
+	if !ok {
+		return nil, ErrClockFixed
+	}
+	offset, err := s.repo.AdvanceClock(ctx, d)
+	if err != nil {
+		s.log(ctx).Error("Failed to advance clock", zap.Error(err), zap.Duration("by", d))
+		return nil, err
+	}
+	c.set(offset)
+	s.log(ctx).Info("Clock advanced", zap.Duration("by", d), zap.Duration("offset", offset), zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Sandbox clock advanced by %s", d),
+		map[string]any{"setting": "clock", "changed_by": staffID, "advanced_by_seconds": int64(d.Seconds()),
+			"offset_seconds": int64(offset.Seconds())})
+	return &SandboxClock{Now: c.Now().UTC(), OffsetSeconds: int64(offset.Seconds())}, nil
+}
+
+// advanceTimeHandler godoc
+// @Summary Advance the sandbox's clock
+// @Description Moves the sandbox's clock forward for every server and worker within seconds, so QA can fast-forward accrual and maturities. Accounts opened from then on start at the new time; the accrual and maturity workers pay and mature what has fallen due on their next run. The clock never moves back. Only served by sandbox deployments.
+// @Tags sandbox
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param request body AdvanceTimeRequest true "How far to move the clock"
+// @Success 200 {object} SandboxClock
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/sandbox/advance-time [post]
+func advanceTimeHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req AdvanceTimeRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	d := time.Duration(req.Days)*24*time.Hour + time.Duration(req.Hours)*time.Hour
+	if d <= 0 || d > maxClockAdvance {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidField,
+			fmt.Sprintf("the clock moves forward by at least an hour and at most %d days at a time", maxClockAdvance/(24*time.Hour)))
+		return
+	}
+
+	ctx := r.Context()
+
+	clock, err := svc.AdvanceClock(ctx, d, staffID)
+	if err == ErrClockFixed {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, clock, "Clock advanced")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAdvanceSandboxClock(t *testing.T) {
+	t.Setenv("SANDBOX", "true")
+	t.Setenv("SANDBOX_TIME_SCALE", "1")
+	api := newTestAPI(t)
+	ctx := context.Background()
+	if _, err := api.repo.ClaimDeployment(ctx, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	id := api.createAccount(1)
+
+	if n, err := api.svc.ProcessMaturities(ctx, api.svc.Now().UTC(), 10); err != nil || n != 0 {
+		t.Fatalf("matured %d, %v before the clock moved", n, err)
+	}
+	if w := api.do(http.MethodPost, "/v2/admin/sandbox/advance-time", `{"days":0}`); w.Code != http.StatusBadRequest {
+		t.Errorf("advance by nothing = %d, want 400", w.Code)
+	}
+
+	var clock SandboxClock
+	// Past the year and the business day a weekend maturity moves to
+	api.create(http.MethodPost, "/v2/admin/sandbox/advance-time", `{"days":400}`, &clock)
+	if clock.OffsetSeconds != 400*24*60*60 || clock.Now.Before(time.Now().AddDate(0, 0, 399)) {
+		t.Fatalf("clock = %+v", clock)
+	}
+	if offset, err := api.repo.ClockOffset(ctx); err != nil || offset != 400*24*time.Hour {
+		t.Errorf("stored offset = %s, %v", offset, err)
+	}
+
+	if n, err := api.svc.ProcessMaturities(ctx, api.svc.Now().UTC(), 10); err != nil || n != 1 {
+		t.Fatalf("matured %d, %v after 400 days", n, err)
+	}
+	var account BlockAccount
+	decodeData(t, api.do(http.MethodGet, "/v2/block-account/"+id, "").Body.Bytes(), &account)
+	if account.Status != StatusMatured {
+		t.Errorf("status = %s, want matured", account.Status)
+	}
+}
+
+func TestAdvanceClockOutsideSandbox(t *testing.T) {
+	api := newTestAPI(t)
+	if w := api.do(http.MethodPost, "/v2/admin/sandbox/advance-time", `{"days":1}`); w.Code != http.StatusNotFound {
+		t.Errorf("advance = %d, want 404 outside a sandbox", w.Code)
+	}
+	if _, err := api.svc.AdvanceClock(context.Background(), time.Hour, "staff-1"); err != ErrClockFixed {
+		t.Errorf("AdvanceClock = %v, want ErrClockFixed", err)
+	}
+}
+
+func TestClockMovesLifecycleTogether(t *testing.T) {
+	t.Setenv("SANDBOX", "true")
+	t.Setenv("SANDBOX_TIME_SCALE", "1")
+	api := newTestAPI(t)
+	ctx := context.Background()
+	if _, err := api.repo.ClaimDeployment(ctx, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if w := api.do(http.MethodPut, "/v2/admin/products/9m",
+		`{"name":"9-month deposit","term_months":9,"rate":0.042,"min_principal":500,"early_withdrawal":"not_allowed"}`); w.Code != http.StatusOK {
+		t.Fatalf("define: %d %s", w.Code, w.Body)
+	}
+	var account BlockAccount
+	api.create(http.MethodPost, "/v2/block-account", `{"user_id":1,"principal":1000,"product_code":"9m"}`, &account)
+	withdrawal := `{"action":"early_withdrawal","account_id":"` + account.ExternalID + `","reason":"Customer request"}`
+	if w := api.do(http.MethodPost, "/v2/admin/approvals", withdrawal); w.Code != http.StatusConflict {
+		t.Errorf("withdrawal before the end date = %d %s, want 409", w.Code, w.Body)
+	}
+
+	var clock SandboxClock
+	api.create(http.MethodPost, "/v2/admin/sandbox/advance-time", `{"days":100}`, &clock)
+	var valued BlockAccount
+	decodeData(t, api.do(http.MethodGet, "/v2/block-account/"+account.ExternalID, "").Body.Bytes(), &valued)
+	var query struct {
+		Account struct {
+			InterestAccrued float64 `json:"interestAccrued"`
+		} `json:"account"`
+	}
+	decodeData(t, api.do(http.MethodPost, GraphQLPath, `{"query":"{ account(id: \"`+account.ExternalID+`\") { interestAccrued } }"}`).Body.Bytes(), &query)
+	if valued.Valuation == nil || valued.Valuation.AccruedInterestToDate < 10 ||
+		math.Abs(query.Account.InterestAccrued-valued.Valuation.AccruedInterestToDate) > 0.01 {
+		t.Errorf("accrued after 100 days: GraphQL %v, REST %+v", query.Account.InterestAccrued, valued.Valuation)
+	}
+
+	// Past the 9 months and the business day a weekend end date moves to
+	api.create(http.MethodPost, "/v2/admin/sandbox/advance-time", `{"days":200}`, &clock)
+	var calendar MaturityCalendar
+	api.create(http.MethodGet, "/v2/admin/maturities", "", &calendar)
+	if today := api.svc.Now().In(businessLocation()).Format(reportDateLayout); calendar.From != today {
+		t.Errorf("calendar from %s, want the clock's %s", calendar.From, today)
+	}
+	if w := api.do(http.MethodPost, "/v2/admin/approvals", withdrawal); w.Code >= 300 {
+		t.Errorf("withdrawal after the end date = %d %s", w.Code, w.Body)
+	}
+	if n, err := api.svc.ProcessMaturities(ctx, api.svc.Now().UTC(), 10); err != nil || n != 1 {
+		t.Errorf("matured %d, %v after 300 days", n, err)
+	}
+	// A day past on the clock can be reported on, though the wall clock has
+	// not reached it
+	day := api.svc.Now().In(businessLocation()).AddDate(0, 0, -1).Format(reportDateLayout)
+	if w := api.do(http.MethodPost, "/v2/admin/reports/daily_summary/run?date="+day, ""); w.Code != http.StatusAccepted {
+		t.Errorf("report for %s = %d %s, want 202", day, w.Code, w.Body)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StatusClosing is an account its holder closed whose final payout has not
+// been confirmed sent yet. It becomes closed once it is, or payout_failed
+// if it fails.
+const StatusClosing = "closing"
+
+// Settlement methods of a closure's final payout
+const (
+	SettlementBankTransfer     = "bank_transfer"
+	SettlementInternalTransfer = "internal_transfer"
+)
+
+// ErrNoPayoutDestination is returned when an approved early withdrawal
+// closes an account that has no payout destination or settlement account
+// on file to settle to
+var ErrNoPayoutDestination = newAPIError(CodeSettlementAccountRequired, "block account has no payout destination or settlement account to settle its closure to")
+
+// AccountClosure is how an account its holder closed is settled
+// @Description Settlement instructions and final payout of a closed block account
+type AccountClosure struct {
+	AccountID          int    `json:"-"`
+	DestinationAccount string `json:"destination_account" example:"*********6789"`
+	// Method is "bank_transfer" or "internal_transfer"
+	Method string `json:"method" example:"bank_transfer"`
+	// Amount is the final payout: the principal with the interest accrued
+	// and not yet paid, and any adjustment
+	Amount      float64   `json:"amount" example:"1012.33"`
+	RequestedAt time.Time `json:"requested_at"`
+	// ClosedAt is when the final payout was confirmed sent
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+}
+
+// CloseAccountRequest is the payload for closing an account
+// @Description Where and how the final payout of a closed account is sent
+type CloseAccountRequest struct {
+	DestinationAccount string `json:"destination_account" example:"1000123456789" validate:"notblank,max=64"`
+	Method             string `json:"method" example:"bank_transfer" validate:"oneof=bank_transfer internal_transfer"` // "bank_transfer" or "internal_transfer"
+}
+
+// CloseBlockAccount closes an active account at its holder's request. The
+// account moves to closing and its final payout, worth its current value,
+// is queued to req's destination; it is closed once the payout is confirmed
+// sent. Closing before maturity returns ErrEarlyWithdrawalNotAllowed when
+// the product forbids it, and ErrApprovalRequired when it is large or its
+// product needs approval. A close whose If-Match (see withIfMatch) names an
+// older version of the account returns ErrPreconditionFailed, and one
+// acting for a customer other than the primary holder returns
+// ErrPrimaryHolderRequired. It returns nil, nil when the account does not
+// exist.
+func (s *service) CloseBlockAccount(ctx context.Context, id int, req *CloseAccountRequest) (*BlockAccount, error) {
+	return s.closeAccount(ctx, id, req, false)
+}
+
+// closeAccount moves the account to closing and queues its final payout,
+// skipping the early withdrawal approval check when approved
+func (s *service) closeAccount(ctx context.Context, id int, req *CloseAccountRequest, approved bool) (*BlockAccount, error) {
+	account, err := s.repo.BeginClosure(ctx, id, func(a *BlockAccount) (*AccountClosure, error) {
+		if err := checkIfMatch(ctx, a); err != nil {
+			return nil, err
+		}
+		if err := checkPrimaryHolder(ctx, a); err != nil {
+			return nil, err
+		}
+		now := s.Now()
+		switch {
+		case a.Status == StatusFrozen:
+			return nil, ErrAccountFrozen
+		case a.Status != StatusActive:
+			return nil, ErrAccountNotActive
+		case withdrawalForbidden(a, now):
+			return nil, ErrEarlyWithdrawalNotAllowed
+		case !approved && needsWithdrawalApproval(a, now):
+			return nil, ErrApprovalRequired
+		}
+		return &AccountClosure{
+			DestinationAccount: strings.TrimSpace(req.DestinationAccount),
+			Method:             req.Method,
+			Amount:             valueAccount(a, now).CurrentValue,
+			RequestedAt:        now.UTC(),
+		}, nil
+	})
+	switch err {
+	case nil:
+	case ErrAccountFrozen, ErrAccountNotActive, ErrApprovalRequired, ErrEarlyWithdrawalNotAllowed, ErrPreconditionFailed, ErrPrimaryHolderRequired:
+		return nil, err
+	default:
+		s.log(ctx).Error("Failed to close block account", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if account != nil {
+		s.log(ctx).Info("Block account closing", zap.String("accountID", account.ExternalID),
+			zap.String("method", account.Closure.Method), zap.Float64("amount", account.Closure.Amount))
+	}
+	return account, nil
+}
+
+// closeApproved closes an account whose early withdrawal was approved,
+// settling it to its payout destination, or failing that the settlement
+// account that funded it, by bank transfer
+func (s *service) closeApproved(ctx context.Context, account *BlockAccount) error {
+	destination := account.PayoutDestination
+	if destination == "" {
+		funding, err := s.repo.GetFunding(ctx, account.ID)
+		if err != nil {
+			return err
+		}
+		if funding != nil {
+			destination = funding.SettlementAccount
+		}
+	}
+	if destination == "" {
+		return ErrNoPayoutDestination
+	}
+	closed, err := s.closeAccount(ctx, account.ID, &CloseAccountRequest{DestinationAccount: destination, Method: SettlementBankTransfer}, true)
+	if err == nil && closed == nil {
+		err = ErrAccountGone
+	}
+	return err
+}
+
+// ConfirmPayout marks the account's in-flight payout as sent. A closing
+// account is closed by it.
+func (s *service) ConfirmPayout(ctx context.Context, accountID int) (*Payout, error) {
+	payout, closed, err := s.repo.ConfirmPayout(ctx, accountID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to confirm payout", zap.Error(err), zap.Int("accountID", accountID))
+		}
+		return nil, err
+	}
+	if closed {
+		s.log(ctx).Info("Block account closed", zap.String("accountID", payout.AccountExternalID),
+			zap.Int("payoutID", payout.ID), zap.Float64("amount", payout.Amount))
+	}
+	return payout, nil
+}
+
+// closeBlockAccountHandler godoc
+// @Summary Close block account
+// @Description Closes an active block account, paying it out at its current value. The account moves to closing and its final payout is queued to destination_account; once the payout is confirmed sent it is closed and account.closed is published. Frozen accounts cannot be closed. Closing before maturity is refused when the product does not allow early withdrawal, and needs an approved early_withdrawal instead when its product requires one or the principal is at least APPROVAL_EARLY_WITHDRAWAL_THRESHOLD. From v2 the account's ETag must be sent in If-Match, and a close of a changed account fails with 412. Only the primary holder of a joint account may close it; when X-User-ID is sent it must name them.
+// @Tags block-account
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param If-Match header string true "ETag of the account as last read"
+// @Param X-User-ID header int false "Customer the request acts for, set by the gateway"
+// @Param closure body CloseAccountRequest true "Settlement instructions"
+// @Success 202 {object} BlockAccount "Account closing, waiting for its final payout"
+// @Header 202 {string} ETag "Version of the closing account"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "X-User-ID is not the primary holder"
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse "The account changed since it was read"
+// @Failure 428 {object} ErrorResponse "If-Match is missing"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/close [post]
+func closeBlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	if !requireIfMatch(w, r) {
+		return
+	}
+
+	var req CloseAccountRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	account, err := svc.CloseBlockAccount(withIfMatch(ctx, r.Header.Get("If-Match")), id, &req)
+	if err != nil {
+		switch err {
+		case ErrPreconditionFailed:
+			writeAPIError(w, http.StatusPreconditionFailed, err)
+		case ErrPrimaryHolderRequired:
+			writeAPIError(w, http.StatusForbidden, err)
+		case ErrAccountFrozen, ErrAccountNotActive, ErrApprovalRequired, ErrEarlyWithdrawalNotAllowed:
+			writeAPIError(w, http.StatusConflict, err)
+		default:
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	if account == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+
+	markWrite(w)
+	w.Header().Set("ETag", accountETag(r, account))
+	writeSuccessStatus(w, r, http.StatusAccepted, account,
+		fmt.Sprintf("Block account closing; %.2f will be paid to %s", account.Closure.Amount, maskAccountNumber(account.Closure.DestinationAccount)))
+}
+
+// confirmPayoutHandler godoc
+// @Summary Confirm a payout was sent
+// @Description Marks the account's in-flight payout as sent. A closing account is closed by its final payout, publishing account.closed.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Success 200 {object} Payout
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/block-account/{id}/payout/sent [post]
+func confirmPayoutHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	payout, err := svc.ConfirmPayout(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "No payout in progress for this block account")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, payout, "Payout marked as sent")
+}
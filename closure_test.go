@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCloseAccount(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(41)
+	path := "/v2/block-account/" + id
+	const body = `{"destination_account":"1000123456789","method":"bank_transfer"}`
+
+	if w := api.do(http.MethodPost, path+"/close", body); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("without If-Match: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodPost, path+"/close", `{"destination_account":"1000123456789","method":"cash"}`, "If-Match", api.etag(id)); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown method: %d %s", w.Code, w.Body)
+	}
+
+	w := api.do(http.MethodPost, path+"/close", body, "If-Match", api.etag(id))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("close: %d %s", w.Code, w.Body)
+	}
+	var closing BlockAccount
+	decodeData(t, w.Body.Bytes(), &closing)
+	if closing.Status != StatusClosing || closing.Closure == nil || closing.Closure.Amount != 1000 || closing.Closure.Method != SettlementBankTransfer {
+		t.Fatalf("closing = %+v, closure %+v", closing, closing.Closure)
+	}
+	if w := api.do(http.MethodPost, path+"/close", body, "If-Match", api.etag(id)); w.Code != http.StatusConflict || errorCode(w) != CodeAccountNotActive {
+		t.Errorf("close again: %d %s", w.Code, w.Body)
+	}
+
+	// A failed final payout is retried back to closing
+	if w := api.do(http.MethodPost, "/v2/admin/block-account/"+id+"/payout/failure", `{"reason":"Rejected account number"}`); w.Code != http.StatusOK {
+		t.Fatalf("fail payout: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodPost, "/v2/admin/block-account/"+id+"/payout/retry", ""); w.Code != http.StatusOK {
+		t.Fatalf("retry payout: %d %s", w.Code, w.Body)
+	}
+	var account BlockAccount
+	decodeData(t, api.do(http.MethodGet, path, "").Body.Bytes(), &account)
+	if account.Status != StatusClosing || account.Closure == nil {
+		t.Fatalf("after retry = %+v, want closing with its closure", account)
+	}
+
+	// Sending the final payout closes the account
+	w = api.do(http.MethodPost, "/v2/admin/block-account/"+id+"/payout/sent", "")
+	var payout Payout
+	decodeData(t, w.Body.Bytes(), &payout)
+	if payout.Status != PayoutSent || payout.Amount != 1000 || payout.Destination != "*********6789" {
+		t.Errorf("payout = %+v", payout)
+	}
+	decodeData(t, api.do(http.MethodGet, path, "").Body.Bytes(), &account)
+	if account.Status != StatusClosed || account.Closure == nil || account.Closure.ClosedAt == nil {
+		t.Errorf("after payout = %+v, closure %+v", account, account.Closure)
+	}
+	if w := api.do(http.MethodPost, "/v2/admin/block-account/"+id+"/payout/sent", ""); w.Code != http.StatusNotFound {
+		t.Errorf("confirm again: %d %s", w.Code, w.Body)
+	}
+
+	accountID, _ := api.repo.ResolveAccountID(context.Background(), id)
+	changes, err := api.repo.ListStatusChanges(context.Background(), accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, c := range changes {
+		statuses = append(statuses, c.To)
+	}
+	want := []string{StatusActive, StatusClosing, StatusPayoutFailed, StatusClosing, StatusClosed}
+	if !slices.Equal(statuses, want) {
+		t.Errorf("history = %v, want %v", statuses, want)
+	}
+}
+
+func TestPayoutsOfOneAccount(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	id := api.createAccount(44)
+	accountID, _ := api.repo.ResolveAccountID(ctx, id)
+	// A payout the account made before, still awaiting confirmation
+	earlier := time.Now().UTC().AddDate(0, 0, -1)
+	if _, err := api.db.Exec(`INSERT INTO payouts(account_id, destination_account, amount, status, created_at, updated_at)
+         VALUES (?, '3000123456789', 25, ?, ?, ?)`, accountID, PayoutSent, earlier, earlier); err != nil {
+		t.Fatal(err)
+	}
+	if w := api.do(http.MethodPost, "/v2/block-account/"+id+"/close", `{"destination_account":"1000123456789","method":"bank_transfer"}`,
+		"If-Match", api.etag(id)); w.Code != http.StatusAccepted {
+		t.Fatalf("close: %d %s", w.Code, w.Body)
+	}
+
+	var payout Payout
+	w := api.do(http.MethodPost, "/v2/admin/block-account/"+id+"/payout/failure", `{"reason":"Rejected account number"}`)
+	decodeData(t, w.Body.Bytes(), &payout)
+	if w.Code != http.StatusOK || payout.Amount != 1000 || payout.Status != PayoutFailed {
+		t.Fatalf("fail payout: %d %+v", w.Code, payout)
+	}
+	w = api.do(http.MethodPost, "/v2/admin/block-account/"+id+"/payout/retry", "")
+	decodeData(t, w.Body.Bytes(), &payout)
+	if w.Code != http.StatusOK || payout.Amount != 1000 || payout.Status != PayoutPending {
+		t.Fatalf("retry payout: %d %+v", w.Code, payout)
+	}
+	w = api.do(http.MethodPost, "/v2/admin/block-account/"+id+"/payout/sent", "")
+	decodeData(t, w.Body.Bytes(), &payout)
+	if w.Code != http.StatusOK || payout.Amount != 1000 || payout.Status != PayoutSent {
+		t.Fatalf("confirm payout: %d %+v", w.Code, payout)
+	}
+
+	payouts, err := api.repo.ListPayouts(ctx, accountID)
+	if err != nil || len(payouts) != 2 {
+		t.Fatalf("payouts = %+v, %v", payouts, err)
+	}
+	for _, p := range payouts {
+		if p.Amount == 25 && (p.Status != PayoutSent || p.Attempts != 1 || p.Destination != "3000123456789" || p.FailureReason != "") {
+			t.Errorf("earlier payout changed: %+v", p)
+		}
+	}
+}
+
+func TestCloseAccountApproval(t *testing.T) {
+	t.Setenv("APPROVAL_EARLY_WITHDRAWAL_THRESHOLD", "500")
+	api := newTestAPI(t)
+	id := api.createAccount(42)
+	const body = `{"destination_account":"1000123456789","method":"internal_transfer"}`
+
+	w := api.do(http.MethodPost, "/v2/block-account/"+id+"/close", body, "If-Match", api.etag(id))
+	if w.Code != http.StatusConflict || errorCode(w) != CodeApprovalRequired {
+		t.Fatalf("large early close: %d %s", w.Code, w.Body)
+	}
+
+	// An approved early withdrawal settles to the payout destination
+	if w := api.do(http.MethodPut, "/v2/block-account/"+id+"/maturity-instruction",
+		`{"instruction":"payout","destination_account":"2000123456789"}`, "If-Match", api.etag(id)); w.Code != http.StatusOK {
+		t.Fatalf("set payout destination: %d %s", w.Code, w.Body)
+	}
+	var approval struct {
+		ID int `json:"id"`
+	}
+	api.create(http.MethodPost, "/v2/admin/approvals", `{"action":"early_withdrawal","account_id":"`+id+`","reason":"Hardship"}`, &approval)
+	if w := api.do(http.MethodPost, "/v2/admin/approvals/"+strconv.Itoa(approval.ID)+"/approve", `{}`, StaffIDHeader, "staff-2"); w.Code != http.StatusOK {
+		t.Fatalf("approve: %d %s", w.Code, w.Body)
+	}
+	var account BlockAccount
+	decodeData(t, api.do(http.MethodGet, "/v2/block-account/"+id, "").Body.Bytes(), &account)
+	if account.Status != StatusClosing || account.Closure == nil || account.Closure.DestinationAccount != "*********6789" {
+		t.Errorf("approved close = %+v, closure %+v", account, account.Closure)
+	}
+	accountID, _ := api.repo.ResolveAccountID(context.Background(), id)
+	if closure, err := api.repo.GetClosure(context.Background(), accountID); err != nil || closure.DestinationAccount != "2000123456789" {
+		t.Errorf("closure = %+v, %v, want it settled to 2000123456789", closure, err)
+	}
+}
+
+func TestDeleteAccountNeedsStaff(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(43)
+
+	if w := api.do(http.MethodDelete, "/v2/block-account/"+id, "", StaffIDHeader, "", "If-Match", api.etag(id)); w.Code != http.StatusUnauthorized {
+		t.Errorf("delete without staff: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodDelete, "/v2/block-account/"+id, "", "If-Match", api.etag(id)); w.Code != http.StatusNoContent {
+		t.Errorf("delete: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Communication kinds
+const (
+	CommunicationNotification = "notification"
+	CommunicationStatement    = "statement"
+	CommunicationCertificate  = "certificate"
+)
+
+// Communication delivery statuses. Notifications are queued as
+// DeliveryPending until the notification worker sends them.
+const (
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+	// DeliveryMuted marks a bulk notice withheld because its account was muted
+	DeliveryMuted = "muted"
+)
+
+// Notification priority lanes. The notification worker drains each lane on
+// its own schedule, so a large bulk backlog never delays a critical notice.
+const (
+	PriorityCritical = "critical"
+	PriorityBulk     = "bulk"
+)
+
+// notificationLease is how long a claimed notification is hidden from other
+// workers; one claimed by a worker that died is sent again after it expires
+const notificationLease = 2 * time.Minute
+
+// Events that trigger customer communications
+const (
+	EventMaturityInstructionChanged = "maturity_instruction.changed"
+	EventPayoutFailed               = "payout.failed"
+	EventPayoutRedirected           = "payout.redirected"
+	EventTaxCertificateIssued       = "tax_certificate.issued"
+)
+
+// Communication records something the customer was told about an account
+// @Description A notification, statement or certificate sent to the customer about a block account
+type Communication struct {
+	ID                int    `json:"id" example:"1"`
+	AccountID         int    `json:"-"`
+	AccountExternalID string `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	UserID            int    `json:"user_id" example:"123"`
+	Kind              string `json:"kind" example:"notification"`
+	Event             string `json:"event" example:"payout.failed"`
+	Subject           string `json:"subject" example:"Your deposit payout could not be completed"`
+	Message           string `json:"message" example:"We could not pay out block account 1: Rejected account number. Our team will contact you."`
+	Status            string `json:"status" example:"sent"`
+	Priority          string `json:"priority" example:"critical"`
+	// Channel is the notification channel it was sent on, empty for the
+	// default notifier
+	Channel   string     `json:"channel,omitempty" example:"email"`
+	LastError string     `json:"last_error,omitempty" example:"no phone number for user 123"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// DedupKey keeps a notice from being queued twice on a channel
+	DedupKey string `json:"-"`
+
+	// tenantID is the tenant of the account, whose preferences apply
+	tenantID string
+}
+
+// notificationPriority returns the lane for notifications about event:
+// confirmations of the customer's own actions and anything touching where
+// their money goes are critical, everything else is bulk
+func notificationPriority(event string) string {
+	switch event {
+	case EventMaturityInstructionChanged, EventPayoutFailed, EventPayoutRedirected:
+		return PriorityCritical
+	default:
+		return PriorityBulk
+	}
+}
+
+// SendNotifications sends the queued notifications of one priority lane in
+// batches, each on its own channel, and returns how many were attempted. A
+// notice that cannot be delivered is marked failed with the reason rather
+// than retried. Bulk notices for a muted account are withheld for good.
+func (s *service) SendNotifications(ctx context.Context, priority string, batchSize int) (int, error) {
+	total := 0
+	for {
+		pending, err := s.repo.ClaimNotifications(ctx, priority, time.Now().UTC(), notificationLease, batchSize)
+		if err != nil {
+			s.log(ctx).Error("Failed to claim notifications", zap.Error(err), zap.String("priority", priority))
+			return total, err
+		}
+
+		now := time.Now().UTC()
+		cache := preferencesCache{}
+		muted := make(map[int]bool)
+		for _, c := range pending {
+			if c.Priority != PriorityCritical {
+				m, err := s.accountMuted(ctx, c.AccountID, now, muted)
+				if err != nil {
+					s.log(ctx).Error("Failed to check notification mute", zap.Error(err), zap.Int("accountID", c.AccountID))
+					return total, err
+				}
+				if m {
+					if err := s.repo.UpdateCommunicationStatus(ctx, c.ID, DeliveryMuted, ""); err != nil {
+						s.log(ctx).Error("Failed to update notification status", zap.Error(err), zap.Int("communicationID", c.ID))
+						return total, err
+					}
+					total++
+					continue
+				}
+			}
+
+			status, lastError := DeliverySent, ""
+			if err := s.deliverNotification(ctx, c, cache); err != nil {
+				s.log(ctx).Warn("Failed to send notification", zap.Error(err),
+					zap.Int("communicationID", c.ID), zap.String("channel", c.Channel))
+				status, lastError = DeliveryFailed, err.Error()
+			}
+			if err := s.repo.UpdateCommunicationStatus(ctx, c.ID, status, lastError); err != nil {
+				s.log(ctx).Error("Failed to update notification status", zap.Error(err), zap.Int("communicationID", c.ID))
+				return total, err
+			}
+			total++
+		}
+
+		if len(pending) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// deliverNotification sends c on its channel, or through the service's
+// Notifier when it has none
+func (s *service) deliverNotification(ctx context.Context, c *Communication, cache preferencesCache) error {
+	if c.Channel == "" {
+		if s.notifier == nil {
+			return nil
+		}
+		return s.notifier.NotifyCustomer(ctx, c.UserID, c.Subject, c.Message)
+	}
+	ch := s.channels[c.Channel]
+	if ch == nil {
+		return fmt.Errorf("%w: %s", ErrChannelUnavailable, c.Channel)
+	}
+	prefs, err := s.preferencesFor(withTenant(ctx, c.tenantID), c.UserID, cache)
+	if err != nil {
+		return err
+	}
+	return ch.Deliver(ctx, c, prefs)
+}
+
+// recordCommunication appends to the communications log. The log is an
+// audit trail, so failures are logged loudly but never fail the caller.
+func (s *service) recordCommunication(ctx context.Context, c *Communication) {
+	if err := s.repo.RecordCommunication(ctx, c); err != nil {
+		s.log(ctx).Error("Failed to record communication", zap.Error(err),
+			zap.Int("accountID", c.AccountID), zap.String("event", c.Event))
+	}
+}
+
+// GetAccountCommunications returns everything sent to the customer about an
+// account, oldest first. The log outlives the account itself.
+func (s *service) GetAccountCommunications(ctx context.Context, accountID int) ([]*Communication, error) {
+	communications, err := s.repo.ListCommunications(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get communications", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	if communications == nil {
+		communications = []*Communication{}
+	}
+	return communications, nil
+}
+
+// getAccountCommunicationsHandler godoc
+// @Summary Get the communications log of a block account
+// @Description Lists every notification, statement and certificate sent about a block account in chronological order, including for accounts that have since been deleted
+// @Tags block-account
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]Communication}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/communications [get]
+func getAccountCommunicationsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	communications, err := svc.GetAccountCommunications(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, communications, "Communications retrieved successfully")
+}
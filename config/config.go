@@ -0,0 +1,586 @@
+// Package config loads the settings the service needs before it can start:
+// the database connection and pool, the listeners, their TLS, request limits
+// and the headers browsers are sent, and the worker intervals and schedules.
+//
+// Settings start from their defaults, are overridden by an optional YAML
+// file and then by environment variables, and are validated as a whole so
+// that every mistake is reported at once, before anything connects or
+// listens. The loaded Config is passed to what needs it; nothing here reads
+// the environment later.
+//
+// Feature settings such as FUNDING_PROVIDER or OBJECT_STORE are not part of
+// Config; each is read and checked by the provider it configures.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the service's startup configuration
+type Config struct {
+	Database Database `yaml:"database"`
+	Server   Server   `yaml:"server"`
+	Workers  Workers  `yaml:"workers"`
+}
+
+// Database is the database connection and its pool
+type Database struct {
+	// Driver is postgres or sqlite
+	Driver   string `yaml:"driver"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+	// SQLitePath is the database file of the sqlite driver
+	SQLitePath string `yaml:"sqlite_path"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+
+	// ReplicaDSN is the connection string of a read-only PostgreSQL replica
+	// that account reads, listings and reports are served from. Empty keeps
+	// every query on the primary.
+	ReplicaDSN string `yaml:"replica_dsn"`
+	// ReplicaMaxLag is how far behind the primary the replica may fall before
+	// reads go back to the primary until it catches up
+	ReplicaMaxLag time.Duration `yaml:"replica_max_lag"`
+}
+
+// Server is the HTTP and gRPC listeners and the limits on HTTP requests
+type Server struct {
+	Port     int `yaml:"port"`
+	GRPCPort int `yaml:"grpc_port"`
+	// ShutdownTimeout is how long in-flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// RequestTimeout is how long a request's work may take. Bulk imports and
+	// rate scenarios get longer.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// ReadHeaderTimeout is how long a client has to send the request headers,
+	// which keeps slow clients from holding connections open
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// ReadTimeout is how long a client has to send the whole request,
+	// including a bulk upload
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// WriteTimeout is how long after the headers are read the response must
+	// be written
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IdleTimeout is how long a keep-alive connection waits for its next request
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes int           `yaml:"max_header_bytes"`
+	// MaxBodyBytes caps JSON request bodies. Bulk uploads have their own limit.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+
+	TLS      TLS             `yaml:"tls"`
+	CORS     CORS            `yaml:"cors"`
+	Security SecurityHeaders `yaml:"security_headers"`
+}
+
+// Client certificate policies of mutual TLS
+const (
+	// ClientAuthRequire refuses connections without a certificate signed by
+	// the client CA
+	ClientAuthRequire = "require"
+	// ClientAuthVerifyIfGiven verifies the certificates callers present but
+	// also serves callers without one
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+// TLS is how the HTTP listener terminates TLS: with a certificate and key
+// read from files, or with certificates obtained and renewed over ACME.
+// Neither set serves plaintext HTTP, for deployments behind a proxy that
+// terminates TLS.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ACMEDomains are the host names to obtain certificates for from
+	// ACMEDirectoryURL, Let's Encrypt by default
+	ACMEDomains      []string `yaml:"acme_domains"`
+	ACMEEmail        string   `yaml:"acme_email"`
+	ACMEDirectoryURL string   `yaml:"acme_directory_url"`
+	// ACMECacheDir keeps the account key and certificates across restarts
+	ACMECacheDir string `yaml:"acme_cache_dir"`
+	// ClientCAFile turns on mutual TLS: callers' certificates are verified
+	// against the CAs in this PEM file
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth is require or verify_if_given
+	ClientAuth string `yaml:"client_auth"`
+	// MinVersion is the oldest TLS version accepted, 1.2 or 1.3
+	MinVersion string `yaml:"min_version"`
+}
+
+// Enabled reports whether the listener terminates TLS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || len(t.ACMEDomains) > 0
+}
+
+// CORS is which browser pages may call the HTTP API, such as dashboards
+// served from another origin
+type CORS struct {
+	// AllowedOrigins are the origins, such as https://dash.example.com, whose
+	// pages may call the API. "*" allows any origin. Empty turns CORS off, so
+	// browsers only let same-origin pages call.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	// AllowedHeaders are the request headers pages may send
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// ExposedHeaders are the response headers pages may read
+	ExposedHeaders []string `yaml:"exposed_headers"`
+	// AllowCredentials lets pages send cookies and HTTP authentication. It
+	// needs the origins listed; "*" cannot be combined with it.
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// MaxAge is how long browsers may cache a preflight's answer
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// SecurityHeaders are the hardening headers sent with every response
+type SecurityHeaders struct {
+	// HSTSMaxAge is how long browsers must only use HTTPS for the host once
+	// they have seen Strict-Transport-Security. 0 leaves the header out, for
+	// deployments not behind TLS.
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains"`
+	// SwaggerCSP is the Content-Security-Policy of the Swagger UI pages. API
+	// responses are data and get a policy that allows nothing.
+	SwaggerCSP string `yaml:"swagger_csp"`
+}
+
+// Workers is how often each background worker polls. A worker's --interval
+// flags override these.
+type Workers struct {
+	Maturity     time.Duration `yaml:"maturity_interval"`
+	Accrual      time.Duration `yaml:"accrual_interval"`
+	Funding      time.Duration `yaml:"funding_interval"`
+	Jobs         time.Duration `yaml:"jobs_interval"`
+	Outbox       time.Duration `yaml:"outbox_interval"`
+	Webhooks     time.Duration `yaml:"webhooks_interval"`
+	NotifyEvents time.Duration `yaml:"notifications_events_interval"`
+	NotifyRemind time.Duration `yaml:"notifications_reminder_interval"`
+	NotifyCrit   time.Duration `yaml:"notifications_critical_interval"`
+	NotifyBulk   time.Duration `yaml:"notifications_bulk_interval"`
+	// LeaseTTL is how long a worker that must run on one replica at a time
+	// keeps its lease after its last renewal
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+	// Schedules are the five-field cron expressions, in BUSINESS_TIMEZONE,
+	// on which the scheduler runs each periodic job
+	Schedules Schedules `yaml:"schedules"`
+}
+
+// Schedules is when `worker scheduler` runs each of the jobs it drives
+type Schedules struct {
+	Maturity       string `yaml:"maturity"`
+	Accrual        string `yaml:"accrual"`
+	Reconciliation string `yaml:"reconciliation"`
+	Reports        string `yaml:"reports"`
+	Retention      string `yaml:"retention"`
+}
+
+// Default returns the configuration used for settings that are not set
+func Default() *Config {
+	return &Config{
+		Database: Database{
+			Driver:          "postgres",
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "require",
+			SQLitePath:      "blockaccount.db",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ReplicaMaxLag:   10 * time.Second,
+		},
+		Server: Server{
+			Port:            8080,
+			GRPCPort:        9090,
+			ShutdownTimeout: 10 * time.Second,
+
+			RequestTimeout:    5 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       2 * time.Minute,
+			WriteTimeout:      3 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      64 << 10,
+			TLS: TLS{
+				ACMECacheDir: "acme-cache",
+				ClientAuth:   ClientAuthRequire,
+				MinVersion:   "1.2",
+			},
+			CORS: CORS{
+				AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE"},
+				AllowedHeaders: []string{"Authorization", "Content-Type", "Accept", "X-API-Key", "X-Request-ID",
+					"X-Tenant-ID", "X-User-ID", "Idempotency-Key", "If-Match", "If-None-Match", "X-Consistency",
+					"X-Consistency-Token", "Last-Event-ID"},
+				ExposedHeaders: []string{"ETag", "Location", "Link", "Retry-After", "Content-Disposition", "X-Request-ID",
+					"API-Version", "Deprecation", "Sunset", "X-RateLimit-Limit", "X-RateLimit-Remaining",
+					"X-Consistency-Token", "Idempotent-Replayed", "X-Sandbox"},
+				MaxAge: 10 * time.Minute,
+			},
+			Security: SecurityHeaders{
+				HSTSMaxAge:            365 * 24 * time.Hour,
+				HSTSIncludeSubdomains: true,
+				SwaggerCSP: "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; " +
+					"img-src 'self' data:; frame-ancestors 'none'",
+			},
+		},
+		Workers: Workers{
+			Maturity:     time.Minute,
+			Accrual:      time.Hour,
+			Funding:      time.Minute,
+			Jobs:         2 * time.Second,
+			Outbox:       time.Second,
+			Webhooks:     5 * time.Second,
+			NotifyEvents: 5 * time.Second,
+			NotifyRemind: time.Hour,
+			NotifyCrit:   time.Second,
+			NotifyBulk:   30 * time.Second,
+			LeaseTTL:     30 * time.Second,
+			// The defaults of the standalone reconciliation, reports and
+			// retention workers
+			Schedules: Schedules{
+				Maturity:       "* * * * *",
+				Accrual:        "0 * * * *",
+				Reconciliation: "0 1 * * *",
+				Reports:        "0 6 * * *",
+				Retention:      "30 2 * * *",
+			},
+		},
+	}
+}
+
+// setting ties a field to its environment variable and YAML key
+type setting struct {
+	env, key string
+	// field is a *string, *int, *int64, *bool, *time.Duration or a
+	// *[]string read from a comma-separated list
+	field any
+}
+
+// settings lists every setting of c
+func (c *Config) settings() []setting {
+	d, s, w := &c.Database, &c.Server, &c.Workers
+	tls, cors, sec, sched := &s.TLS, &s.CORS, &s.Security, &w.Schedules
+	return []setting{
+		{"DB_DRIVER", "database.driver", &d.Driver},
+		{"DB_HOST", "database.host", &d.Host},
+		{"DB_PORT", "database.port", &d.Port},
+		{"DB_USER", "database.user", &d.User},
+		{"DB_PASSWORD", "database.password", &d.Password},
+		{"DB_NAME", "database.name", &d.Name},
+		{"DB_SSLMODE", "database.sslmode", &d.SSLMode},
+		{"SQLITE_PATH", "database.sqlite_path", &d.SQLitePath},
+		{"DB_MAX_OPEN_CONNS", "database.max_open_conns", &d.MaxOpenConns},
+		{"DB_MAX_IDLE_CONNS", "database.max_idle_conns", &d.MaxIdleConns},
+		{"DB_CONN_MAX_LIFETIME", "database.conn_max_lifetime", &d.ConnMaxLifetime},
+		{"DB_REPLICA_DSN", "database.replica_dsn", &d.ReplicaDSN},
+		{"DB_REPLICA_MAX_LAG", "database.replica_max_lag", &d.ReplicaMaxLag},
+		{"PORT", "server.port", &s.Port},
+		{"GRPC_PORT", "server.grpc_port", &s.GRPCPort},
+		{"SHUTDOWN_TIMEOUT", "server.shutdown_timeout", &s.ShutdownTimeout},
+		{"REQUEST_TIMEOUT", "server.request_timeout", &s.RequestTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", "server.read_header_timeout", &s.ReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT", "server.read_timeout", &s.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", "server.write_timeout", &s.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", "server.idle_timeout", &s.IdleTimeout},
+		{"HTTP_MAX_HEADER_BYTES", "server.max_header_bytes", &s.MaxHeaderBytes},
+		{"MAX_REQUEST_BODY_BYTES", "server.max_body_bytes", &s.MaxBodyBytes},
+		{"TLS_CERT_FILE", "server.tls.cert_file", &tls.CertFile},
+		{"TLS_KEY_FILE", "server.tls.key_file", &tls.KeyFile},
+		{"TLS_ACME_DOMAINS", "server.tls.acme_domains", &tls.ACMEDomains},
+		{"TLS_ACME_EMAIL", "server.tls.acme_email", &tls.ACMEEmail},
+		{"TLS_ACME_DIRECTORY_URL", "server.tls.acme_directory_url", &tls.ACMEDirectoryURL},
+		{"TLS_ACME_CACHE_DIR", "server.tls.acme_cache_dir", &tls.ACMECacheDir},
+		{"TLS_CLIENT_CA_FILE", "server.tls.client_ca_file", &tls.ClientCAFile},
+		{"TLS_CLIENT_AUTH", "server.tls.client_auth", &tls.ClientAuth},
+		{"TLS_MIN_VERSION", "server.tls.min_version", &tls.MinVersion},
+		{"CORS_ALLOWED_ORIGINS", "server.cors.allowed_origins", &cors.AllowedOrigins},
+		{"CORS_ALLOWED_METHODS", "server.cors.allowed_methods", &cors.AllowedMethods},
+		{"CORS_ALLOWED_HEADERS", "server.cors.allowed_headers", &cors.AllowedHeaders},
+		{"CORS_EXPOSED_HEADERS", "server.cors.exposed_headers", &cors.ExposedHeaders},
+		{"CORS_ALLOW_CREDENTIALS", "server.cors.allow_credentials", &cors.AllowCredentials},
+		{"CORS_MAX_AGE", "server.cors.max_age", &cors.MaxAge},
+		{"HSTS_MAX_AGE", "server.security_headers.hsts_max_age", &sec.HSTSMaxAge},
+		{"HSTS_INCLUDE_SUBDOMAINS", "server.security_headers.hsts_include_subdomains", &sec.HSTSIncludeSubdomains},
+		{"SWAGGER_CSP", "server.security_headers.swagger_csp", &sec.SwaggerCSP},
+		{"WORKER_MATURITY_INTERVAL", "workers.maturity_interval", &w.Maturity},
+		{"WORKER_ACCRUAL_INTERVAL", "workers.accrual_interval", &w.Accrual},
+		{"WORKER_FUNDING_INTERVAL", "workers.funding_interval", &w.Funding},
+		{"WORKER_JOBS_INTERVAL", "workers.jobs_interval", &w.Jobs},
+		{"WORKER_OUTBOX_INTERVAL", "workers.outbox_interval", &w.Outbox},
+		{"WORKER_WEBHOOKS_INTERVAL", "workers.webhooks_interval", &w.Webhooks},
+		{"WORKER_NOTIFICATIONS_EVENTS_INTERVAL", "workers.notifications_events_interval", &w.NotifyEvents},
+		{"WORKER_NOTIFICATIONS_REMINDER_INTERVAL", "workers.notifications_reminder_interval", &w.NotifyRemind},
+		{"WORKER_NOTIFICATIONS_CRITICAL_INTERVAL", "workers.notifications_critical_interval", &w.NotifyCrit},
+		{"WORKER_NOTIFICATIONS_BULK_INTERVAL", "workers.notifications_bulk_interval", &w.NotifyBulk},
+		{"WORKER_LEASE_TTL", "workers.lease_ttl", &w.LeaseTTL},
+		{"MATURITY_SCHEDULE", "workers.schedules.maturity", &sched.Maturity},
+		{"ACCRUAL_SCHEDULE", "workers.schedules.accrual", &sched.Accrual},
+		{"RECONCILIATION_SCHEDULE", "workers.schedules.reconciliation", &sched.Reconciliation},
+		{"REPORT_SCHEDULE", "workers.schedules.reports", &sched.Reports},
+		{"RETENTION_SCHEDULE", "workers.schedules.retention", &sched.Retention},
+	}
+}
+
+// Load returns the configuration: the defaults, overridden by the YAML file
+// at path when path is not empty, overridden by the environment. The error
+// lists every setting that could not be read or is invalid.
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("read config file: %w", err)
+		}
+		defer f.Close()
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	var errs []error
+	for _, s := range c.settings() {
+		v, ok := os.LookupEnv(s.env)
+		if !ok || v == "" {
+			continue
+		}
+		if err := s.set(v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs = append(errs, c.problems()...); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  %w", joinLines(errs))
+	}
+	return c, nil
+}
+
+// set parses v into the setting's field
+func (s setting) set(v string) error {
+	switch f := s.field.(type) {
+	case *string:
+		*f = v
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number, not %q", s.env, v)
+		}
+		*f = n
+	case *int64:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number, not %q", s.env, v)
+		}
+		*f = n
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, not %q", s.env, v)
+		}
+		*f = b
+	case *[]string:
+		*f = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*f = append(*f, item)
+			}
+		}
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration such as 30s or 5m, not %q", s.env, v)
+		}
+		*f = d
+	}
+	return nil
+}
+
+// problems returns an error for each invalid setting, naming it by its
+// environment variable and YAML key
+func (c *Config) problems() []error {
+	names := make(map[any]string)
+	for _, s := range c.settings() {
+		names[s.field] = fmt.Sprintf("%s (%s)", s.env, s.key)
+	}
+	var errs []error
+	fail := func(field any, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s "+format, append([]any{names[field]}, args...)...))
+	}
+
+	d := &c.Database
+	switch d.Driver {
+	case "postgres":
+		if d.Host == "" {
+			fail(&d.Host, "is required for postgres")
+		}
+		if d.Port < 1 || d.Port > 65535 {
+			fail(&d.Port, "must be a port number, not %d", d.Port)
+		}
+		if d.User == "" {
+			fail(&d.User, "is required for postgres")
+		}
+		if d.Name == "" {
+			fail(&d.Name, "is required for postgres")
+		}
+		switch d.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			fail(&d.SSLMode, "must be disable, allow, prefer, require, verify-ca or verify-full, not %q", d.SSLMode)
+		}
+	case "sqlite":
+		if d.SQLitePath == "" {
+			fail(&d.SQLitePath, "is required for sqlite")
+		}
+	default:
+		fail(&d.Driver, "must be postgres or sqlite, not %q", d.Driver)
+	}
+	if d.MaxOpenConns < 1 {
+		fail(&d.MaxOpenConns, "must be at least 1")
+	}
+	if d.MaxIdleConns < 0 || d.MaxIdleConns > d.MaxOpenConns {
+		fail(&d.MaxIdleConns, "must be between 0 and the open connection limit, %d", d.MaxOpenConns)
+	}
+	if d.ConnMaxLifetime < 0 {
+		fail(&d.ConnMaxLifetime, "must not be negative")
+	}
+	if d.ReplicaDSN != "" && d.Driver != "postgres" {
+		fail(&d.ReplicaDSN, "is only supported for postgres")
+	}
+	if d.ReplicaMaxLag <= 0 {
+		fail(&d.ReplicaMaxLag, "must be positive")
+	}
+
+	s := &c.Server
+	for _, port := range []*int{&s.Port, &s.GRPCPort} {
+		if *port < 1 || *port > 65535 {
+			fail(port, "must be a port number, not %d", *port)
+		}
+	}
+	if s.GRPCPort == s.Port {
+		fail(&s.GRPCPort, "must differ from the HTTP port %d", s.Port)
+	}
+	for _, timeout := range []*time.Duration{&s.ShutdownTimeout, &s.RequestTimeout, &s.ReadHeaderTimeout,
+		&s.ReadTimeout, &s.WriteTimeout, &s.IdleTimeout} {
+		if *timeout <= 0 {
+			fail(timeout, "must be positive")
+		}
+	}
+	if s.ReadHeaderTimeout > s.ReadTimeout {
+		fail(&s.ReadHeaderTimeout, "must not exceed the read timeout %s", s.ReadTimeout)
+	}
+	if s.WriteTimeout <= s.RequestTimeout {
+		fail(&s.WriteTimeout, "must exceed the request timeout %s, or responses are cut off", s.RequestTimeout)
+	}
+	if s.MaxHeaderBytes < 4<<10 {
+		fail(&s.MaxHeaderBytes, "must be at least 4096")
+	}
+	if s.MaxBodyBytes < 1<<10 {
+		fail(&s.MaxBodyBytes, "must be at least 1024")
+	}
+
+	t := &s.TLS
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		fail(&t.KeyFile, "and the certificate file must be set together")
+	}
+	if t.CertFile != "" && len(t.ACMEDomains) > 0 {
+		fail(&t.ACMEDomains, "cannot be combined with a certificate file")
+	}
+	if len(t.ACMEDomains) > 0 && t.ACMECacheDir == "" {
+		fail(&t.ACMECacheDir, "is required with ACME, or every restart orders new certificates")
+	}
+	if t.ClientCAFile != "" && !t.Enabled() {
+		fail(&t.ClientCAFile, "needs TLS: set a certificate file or ACME domains")
+	}
+	switch t.ClientAuth {
+	case ClientAuthRequire:
+		// ACME's TLS-ALPN challenge connects without a client certificate
+		if t.ClientCAFile != "" && len(t.ACMEDomains) > 0 {
+			fail(&t.ClientAuth, "must be %s with ACME, whose challenges present no client certificate", ClientAuthVerifyIfGiven)
+		}
+	case ClientAuthVerifyIfGiven:
+	default:
+		fail(&t.ClientAuth, "must be %s or %s, not %q", ClientAuthRequire, ClientAuthVerifyIfGiven, t.ClientAuth)
+	}
+	if t.MinVersion != "1.2" && t.MinVersion != "1.3" {
+		fail(&t.MinVersion, "must be 1.2 or 1.3, not %q", t.MinVersion)
+	}
+
+	cors := &s.CORS
+	for _, origin := range cors.AllowedOrigins {
+		if origin == "*" {
+			if cors.AllowCredentials {
+				fail(&cors.AllowedOrigins, "must list the origins, not \"*\", when credentials are allowed")
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" {
+			fail(&cors.AllowedOrigins, "must list origins such as https://dash.example.com, not %q", origin)
+		}
+	}
+	if len(cors.AllowedOrigins) > 0 && len(cors.AllowedMethods) == 0 {
+		fail(&cors.AllowedMethods, "must not be empty when origins are allowed")
+	}
+	if cors.MaxAge < 0 {
+		fail(&cors.MaxAge, "must not be negative")
+	}
+	if s.Security.HSTSMaxAge < 0 {
+		fail(&s.Security.HSTSMaxAge, "must not be negative")
+	}
+
+	w := &c.Workers
+	for _, interval := range []*time.Duration{&w.Maturity, &w.Accrual, &w.Funding, &w.Jobs, &w.Outbox,
+		&w.Webhooks, &w.NotifyEvents, &w.NotifyRemind, &w.NotifyCrit, &w.NotifyBulk} {
+		if *interval <= 0 {
+			fail(interval, "must be positive")
+		}
+	}
+	if w.LeaseTTL < 3*time.Second {
+		fail(&w.LeaseTTL, "must be at least 3s, so the lease can be renewed before it lapses")
+	}
+	// The fields themselves are checked when the scheduler parses them
+	sched := &w.Schedules
+	for _, expr := range []*string{&sched.Maturity, &sched.Accrual, &sched.Reconciliation, &sched.Reports, &sched.Retention} {
+		if len(strings.Fields(*expr)) != 5 {
+			fail(expr, "must be a five-field cron expression, not %q", *expr)
+		}
+	}
+	return errs
+}
+
+// joinLines joins errs one per indented line
+func joinLines(errs []error) error {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return errors.New(strings.Join(lines, "\n  "))
+}
+
+// DSN returns the connection string for the database driver. PostgreSQL
+// sessions run in UTC so timestamps read back the same on every deployment.
+func (d Database) DSN() string {
+	if d.Driver == "sqlite" {
+		return "file:" + d.SQLitePath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite"
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s timezone=UTC",
+		quote(d.Host), d.Port, quote(d.User), quote(d.Password), quote(d.Name), d.SSLMode)
+}
+
+// quote quotes a value of a PostgreSQL connection string, so that one with
+// spaces or quotes in it reads back as written
+func quote(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
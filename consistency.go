@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consistency hint headers. A client that has just written can either ask for
+// a strong read explicitly or echo back the token returned by the write.
+const (
+	ConsistencyHeader      = "X-Consistency"
+	ConsistencyTokenHeader = "X-Consistency-Token"
+)
+
+const consistencyKey ctxKey = "consistency"
+
+// defaultReadYourWritesWindow is how long after a write a token keeps routing
+// reads to the primary when READ_YOUR_WRITES_WINDOW is not set
+const defaultReadYourWritesWindow = 5 * time.Second
+
+// readYourWritesWindow returns the configured replication lag tolerance
+func readYourWritesWindow() time.Duration {
+	if v := os.Getenv("READ_YOUR_WRITES_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return defaultReadYourWritesWindow
+}
+
+// newConsistencyToken returns a token marking a write that happened at t
+func newConsistencyToken(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// requiresPrimary reports whether the request's consistency hint asks for
+// reads to be served from the primary
+func requiresPrimary(r *http.Request, window time.Duration) bool {
+	if strings.EqualFold(r.Header.Get(ConsistencyHeader), "strong") {
+		return true
+	}
+	token := r.Header.Get(ConsistencyTokenHeader)
+	if token == "" {
+		return false
+	}
+	nanos, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		// An unreadable token still signals the client cares about freshness
+		return true
+	}
+	return time.Since(time.Unix(0, nanos)) < window
+}
+
+// ConsistencyMiddleware records the request's read consistency hint in the context
+func ConsistencyMiddleware(next http.Handler) http.Handler {
+	window := readYourWritesWindow()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requiresPrimary(r, window) {
+			r = r.WithContext(context.WithValue(r.Context(), consistencyKey, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// primaryRequired reports whether reads for ctx must go to the primary
+func primaryRequired(ctx context.Context) bool {
+	strong, _ := ctx.Value(consistencyKey).(bool)
+	return strong
+}
+
+// markWrite tells the client how to read its own write back
+func markWrite(w http.ResponseWriter) {
+	w.Header().Set(ConsistencyTokenHeader, newConsistencyToken(time.Now()))
+}
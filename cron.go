@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cronFieldBounds are the allowed values of the five cron fields: minute,
+// hour, day of month, month and day of week (0 or 7 is Sunday)
+var cronFieldBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// cronSchedule is a parsed five-field cron expression. Fields take *,
+// numbers, ranges, lists and steps ("*/15", "1-5", "0,30", "8-18/2"). As in
+// cron, when both day fields are restricted a day matching either one runs.
+type cronSchedule struct {
+	expr   string
+	fields [5]uint64
+	domAny bool
+	dowAny bool
+}
+
+// parseCron parses a cron expression such as "0 6 * * *"
+func parseCron(expr string) (*cronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: want 5 fields, got %d", expr, len(parts))
+	}
+	c := &cronSchedule{expr: expr, domAny: parts[2] == "*", dowAny: parts[4] == "*"}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFieldBounds[i][0], cronFieldBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		c.fields[i] = bits
+	}
+	// Sunday may be written as 7
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1
+	}
+	return c, nil
+}
+
+// parseCronField returns the values a field allows as a bit set
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", item)
+			}
+			rangePart, step = item[:i], n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", item)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", item)
+				}
+			} else if step > 1 {
+				// "5/15" runs from 5 to the end of the range
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", item, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// dayMatches reports whether the schedule runs on t's day
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := c.fields[2]&(1<<t.Day()) != 0, c.fields[4]&(1<<int(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// next returns the first minute after t the schedule runs in, in t's
+// location, or the zero time when it never runs (such as "0 0 30 2 *")
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every schedule repeats within four years, leap days included
+	for end := t.AddDate(4, 0, 1); t.Before(end); {
+		switch {
+		case c.fields[3]&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.fields[1]&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.fields[0]&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// runScheduled calls fn at every time the schedule runs, evaluated in loc,
+// until ctx is cancelled. Runs missed while fn was busy are skipped.
+func runScheduled(ctx context.Context, logger *zap.Logger, name string, sched *cronSchedule, loc *time.Location, fn func(context.Context) error) {
+	for {
+		next := sched.next(time.Now().In(loc))
+		if next.IsZero() {
+			logger.Error("Schedule never runs", zap.String("worker", name), zap.String("schedule", sched.expr))
+			return
+		}
+		logger.Info("Next scheduled run", zap.String("worker", name), zap.Time("at", next))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("Worker stopped", zap.String("worker", name))
+			return
+		case <-timer.C:
+		}
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Worker run failed", zap.String("worker", name), zap.Error(err))
+		}
+	}
+}
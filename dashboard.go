@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// dashboardFailedJobsWindow is how far back /admin/dashboard counts failed jobs
+const dashboardFailedJobsWindow = 24 * time.Hour
+
+// DashboardQueues are the backlogs of the background workers
+// @Description Items waiting for a worker
+type DashboardQueues struct {
+	// Outbox is events not yet published to the broker
+	Outbox int `json:"outbox" example:"3"`
+	// WebhookDeliveries is deliveries pending a first attempt or a retry
+	WebhookDeliveries int `json:"webhook_deliveries" example:"12"`
+	// Notifications is customer notifications not yet sent
+	Notifications int `json:"notifications" example:"0"`
+	JobsQueued    int `json:"jobs_queued" example:"1"`
+	JobsRunning   int `json:"jobs_running" example:"2"`
+	EventReplays  int `json:"event_replays" example:"0"`
+}
+
+// DashboardAccounts counts accounts in states that need someone to act
+// @Description Accounts in error or held states
+type DashboardAccounts struct {
+	PayoutFailed   int `json:"payout_failed" example:"1"`
+	FundingFailed  int `json:"funding_failed" example:"0"`
+	PendingFunding int `json:"pending_funding" example:"4"`
+	Frozen         int `json:"frozen" example:"0"`
+}
+
+// Dashboard is the handful of numbers the operations dashboard polls
+// @Description Operational counters for dashboards
+type Dashboard struct {
+	Queues DashboardQueues `json:"queues"`
+	// FailedJobs counts jobs that failed in the last 24 hours
+	FailedJobs       int               `json:"failed_jobs_24h" example:"0"`
+	PendingApprovals int               `json:"pending_approvals" example:"2"`
+	Accounts         DashboardAccounts `json:"accounts"`
+	// Region is set when REGION is, so dashboards show which region they poll
+	Region      *RegionStatus `json:"region,omitempty"`
+	GeneratedAt time.Time     `json:"generated_at"`
+}
+
+// GetDashboard reads the operations dashboard counters in one query
+func (s *service) GetDashboard(ctx context.Context) (*Dashboard, error) {
+	now := time.Now().UTC()
+	dashboard, err := s.repo.DashboardCounts(ctx, now.Add(-dashboardFailedJobsWindow))
+	if err != nil {
+		s.log(ctx).Error("Failed to read dashboard counters", zap.Error(err))
+		return nil, err
+	}
+	if dashboard.Region, err = s.GetRegionStatus(ctx); err != nil {
+		return nil, err
+	}
+	dashboard.GeneratedAt = now
+	return dashboard, nil
+}
+
+// dashboardHandler godoc
+// @Summary Operations dashboard counters
+// @Description Queue depths, jobs failed in the last 24 hours, pending approvals and accounts in error states, read in a single query for dashboards that poll often
+// @Tags admin
+// @Produce json
+// @Success 200 {object} Dashboard
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/dashboard [get]
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	dashboard, err := svc.GetDashboard(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeSuccess(w, r, dashboard, "Dashboard retrieved successfully")
+}
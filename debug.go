@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// DebugPath is where the profiling and runtime diagnostics endpoints are mounted
+const DebugPath = "/debug"
+
+// debugProfileSlack is how much longer than the profile it asks for a CPU
+// profile or trace request may take, to write the profile out
+const debugProfileSlack = 10 * time.Second
+
+// RuntimeMemory is the process's memory use
+// @Description Heap and memory obtained from the OS
+type RuntimeMemory struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes" example:"12582912"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes" example:"16777216"`
+	HeapObjects    uint64 `json:"heap_objects" example:"84211"`
+	// SysBytes is all the memory obtained from the OS
+	SysBytes uint64 `json:"sys_bytes" example:"33554432"`
+}
+
+// RuntimeGC summarizes the garbage collector's work since the process started
+// @Description Garbage collector statistics
+type RuntimeGC struct {
+	Cycles      uint32     `json:"cycles" example:"152"`
+	LastRunAt   *time.Time `json:"last_run_at,omitempty"`
+	PauseTotal  float64    `json:"pause_total_ms" example:"41.7"`
+	LastPause   float64    `json:"last_pause_ms" example:"0.21"`
+	NextGCBytes uint64     `json:"next_gc_bytes" example:"25165824"`
+	// CPUFraction is the share of the CPU time available to the process used by the collector
+	CPUFraction float64 `json:"cpu_fraction" example:"0.0012"`
+}
+
+// DatabasePool is the primary database's connection pool
+// @Description Database connection pool utilization
+type DatabasePool struct {
+	// MaxOpen is 0 when the pool is unbounded
+	MaxOpen int `json:"max_open" example:"25"`
+	Open    int `json:"open" example:"8"`
+	InUse   int `json:"in_use" example:"3"`
+	Idle    int `json:"idle" example:"5"`
+	// WaitCount is how many times a query waited for a free connection
+	WaitCount    int64   `json:"wait_count" example:"12"`
+	WaitDuration float64 `json:"wait_duration_ms" example:"87.5"`
+}
+
+// RuntimeDiagnostics is a snapshot of the process for profiling latency
+// @Description Goroutines, memory, garbage collection, database pool and worker queue depths of the serving process
+type RuntimeDiagnostics struct {
+	Goroutines int             `json:"goroutines" example:"57"`
+	GOMAXPROCS int             `json:"gomaxprocs" example:"4"`
+	Memory     RuntimeMemory   `json:"memory"`
+	GC         RuntimeGC       `json:"gc"`
+	Database   DatabasePool    `json:"database"`
+	Queues     DashboardQueues `json:"queues"`
+	// UptimeSeconds is how long the process has been running
+	UptimeSeconds int64     `json:"uptime_seconds" example:"86400"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+// GetDiagnostics reads the process's runtime statistics, its database pool
+// and the worker queue depths. The queues are counted with the dashboard's
+// query, so they are shared by every process.
+func (s *service) GetDiagnostics(ctx context.Context) (*RuntimeDiagnostics, error) {
+	now := time.Now().UTC()
+	counts, err := s.repo.DashboardCounts(ctx, now)
+	if err != nil {
+		s.log(ctx).Error("Failed to read queue depths", zap.Error(err))
+		return nil, err
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	gc := RuntimeGC{
+		Cycles:      mem.NumGC,
+		PauseTotal:  milliseconds(time.Duration(mem.PauseTotalNs)),
+		NextGCBytes: mem.NextGC,
+		CPUFraction: mem.GCCPUFraction,
+	}
+	if mem.NumGC > 0 {
+		last := time.Unix(0, int64(mem.LastGC)).UTC()
+		gc.LastRunAt = &last
+		gc.LastPause = milliseconds(time.Duration(mem.PauseNs[(mem.NumGC+255)%256]))
+	}
+
+	pool := s.repo.PoolStats()
+	return &RuntimeDiagnostics{
+		Goroutines: runtime.NumGoroutine(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Memory: RuntimeMemory{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapInuseBytes: mem.HeapInuse,
+			HeapObjects:    mem.HeapObjects,
+			SysBytes:       mem.Sys,
+		},
+		GC: gc,
+		Database: DatabasePool{
+			MaxOpen:      pool.MaxOpenConnections,
+			Open:         pool.OpenConnections,
+			InUse:        pool.InUse,
+			Idle:         pool.Idle,
+			WaitCount:    pool.WaitCount,
+			WaitDuration: milliseconds(pool.WaitDuration),
+		},
+		Queues:        counts.Queues,
+		UptimeSeconds: int64(now.Sub(s.startedAt).Seconds()),
+		GeneratedAt:   now,
+	}, nil
+}
+
+// milliseconds returns d in fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// DebugAuthMiddleware lets only platform callers with the admin scope
+// through. As on the admin API, credentials are required whether or not
+// AUTH_REQUIRED is set, and tenant-bound callers are refused as well:
+// profiles expose memory contents and slow the process while they run.
+func DebugAuthMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+			if !ok {
+				writeError(w, http.StatusInternalServerError, "Service not available")
+				return
+			}
+
+			principal, err := authenticate(r.Context(), svc, r.Header.Get(APIKeyHeader), r.Header.Get("Authorization"), logger)
+			var refused *credentialError
+			switch {
+			case errors.As(err, &refused):
+				writeError(w, http.StatusUnauthorized, refused.Message)
+				return
+			case errors.Is(err, ErrIdentityProviderUnavailable):
+				writeErrorCode(w, http.StatusServiceUnavailable, CodeIdentityProviderDown, "Bearer tokens cannot be checked right now")
+				return
+			case err != nil:
+				writeAPIError(w, http.StatusInternalServerError, err)
+				return
+			case principal == nil:
+				w.Header().Set("WWW-Authenticate", `Bearer realm="block-account"`)
+				writeError(w, http.StatusUnauthorized, "Credentials required: send X-API-Key or a bearer token")
+				return
+			case !principal.grants(ScopeAdmin):
+				writeError(w, http.StatusForbidden, "This route needs the "+ScopeAdmin+" scope")
+				return
+			case principal.Tenant != "":
+				writeErrorCode(w, http.StatusForbidden, CodePlatformOnly, "This route is only open to platform operators")
+				return
+			}
+
+			ctx := withPrincipal(r.Context(), principal, logger)
+			loggerFromContext(ctx, logger).Info("Debug endpoint requested", zap.String("path", r.URL.Path),
+				zap.String("query", r.URL.RawQuery))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// mountDebug serves net/http/pprof and the runtime diagnostics under
+// DebugPath for platform admins
+func mountDebug(r chi.Router, logger *zap.Logger) {
+	r.Route(DebugPath, func(r chi.Router) {
+		r.Use(DebugAuthMiddleware(logger))
+		r.Get("/runtime", diagnosticsHandler)
+		r.Get("/pprof/cmdline", pprof.Cmdline)
+		r.Get("/pprof/symbol", pprof.Symbol)
+		r.Post("/pprof/symbol", pprof.Symbol)
+		r.Get("/pprof/profile", longProfile(pprof.Profile))
+		r.Get("/pprof/trace", longProfile(pprof.Trace))
+		// The index, and the named profiles such as heap and goroutine
+		r.Get("/pprof/*", pprof.Index)
+	})
+}
+
+// longProfile lets a CPU profile or trace run for the seconds it asks for,
+// 30 by default, past the usual request timeout. pprof itself refuses
+// profiles longer than the server's write timeout.
+func longProfile(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if err != nil || seconds <= 0 {
+			seconds = 30
+		}
+		ctx, cancel := withRequestTimeout(r, time.Duration(seconds)*time.Second+debugProfileSlack)
+		defer cancel()
+		h(w, r.WithContext(ctx))
+	}
+}
+
+// diagnosticsHandler godoc
+// @Summary Runtime diagnostics
+// @Description Goroutine count, memory and garbage collector statistics, database connection pool utilization and worker queue depths of the process that answers, for tracking down latency spikes. Needs a platform API key or token with the admin scope, even when AUTH_REQUIRED is not set. CPU profiles, traces and the other net/http/pprof profiles are served under /debug/pprof/ with the same protection.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} RuntimeDiagnostics
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /debug/runtime [get]
+func diagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	diagnostics, err := svc.GetDiagnostics(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeSuccess(w, r, diagnostics, "Runtime diagnostics retrieved successfully")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	api := newTestAPI(t)
+	var admin, reader, tenantAdmin APIKey
+	api.create(http.MethodPost, "/v2/admin/api-keys", `{"name":"ops","scopes":["admin"]}`, &admin)
+	api.create(http.MethodPost, "/v2/admin/api-keys", `{"name":"batch","scopes":["read"]}`, &reader)
+	var tenant Tenant
+	api.create(http.MethodPost, "/v2/admin/tenants", `{"id":"acme","name":"Acme"}`, &tenant)
+	api.create(http.MethodPost, "/v2/admin/api-keys", `{"name":"acme-ops","scopes":["admin"],"tenant_id":"acme"}`, &tenantAdmin)
+
+	// Credentials are required even though AUTH_REQUIRED is not set
+	for _, c := range []struct {
+		name, key string
+		status    int
+	}{
+		{"no credentials", "", http.StatusUnauthorized},
+		{"unknown key", "bak_00000000_x", http.StatusUnauthorized},
+		{"read scope", reader.Key, http.StatusForbidden},
+		{"tenant admin", tenantAdmin.Key, http.StatusForbidden},
+	} {
+		for _, path := range []string{"/debug/runtime", "/debug/pprof/"} {
+			if w := api.do(http.MethodGet, path, "", APIKeyHeader, c.key); w.Code != c.status {
+				t.Errorf("%s %s: %d %s, want %d", c.name, path, w.Code, w.Body, c.status)
+			}
+		}
+	}
+
+	api.createAccount(51)
+	w := api.do(http.MethodGet, "/debug/runtime", "", APIKeyHeader, admin.Key)
+	if w.Code != http.StatusOK {
+		t.Fatalf("runtime: %d %s", w.Code, w.Body)
+	}
+	var diagnostics RuntimeDiagnostics
+	decodeData(t, w.Body.Bytes(), &diagnostics)
+	if diagnostics.Goroutines == 0 || diagnostics.GOMAXPROCS == 0 || diagnostics.Memory.SysBytes == 0 || diagnostics.Database.Open == 0 {
+		t.Errorf("diagnostics = %+v", diagnostics)
+	}
+	if diagnostics.Queues.Outbox == 0 {
+		t.Errorf("queues = %+v, want the account's events in the outbox", diagnostics.Queues)
+	}
+
+	w = api.do(http.MethodGet, "/debug/pprof/", "", APIKeyHeader, admin.Key)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("pprof index: %d %s", w.Code, w.Body)
+	}
+	w = api.do(http.MethodGet, "/debug/pprof/goroutine?debug=1", "", APIKeyHeader, admin.Key)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine profile") {
+		t.Errorf("goroutine profile: %d %s", w.Code, w.Body)
+	}
+}
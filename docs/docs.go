@@ -24,9 +24,47 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/block-account": {
+        "/debug/runtime": {
+            "get": {
+                "description": "Goroutine count, memory and garbage collector statistics, database connection pool utilization and worker queue depths of the process that answers, for tracking down latency spikes. Needs a platform API key or token with the admin scope, even when AUTH_REQUIRED is not set. CPU profiles, traces and the other net/http/pprof profiles are served under /debug/pprof/ with the same protection.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Runtime diagnostics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.RuntimeDiagnostics"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/graphql": {
             "post": {
-                "description": "Creates a new block account with specified user ID, principal, and period",
+                "description": "Runs a GraphQL query over block accounts, their funding, status history, interest and maturity payouts, and upcoming payments, in one round trip. Fields asked of many accounts are loaded with one query per field, not one per account. The schema has no mutations, so the read scope is enough. The response is a standard GraphQL response: errors in fields are reported in its errors array with a 200; a body that is not a GraphQL request gets a 400 in the usual error format.",
                 "consumes": [
                     "application/json"
                 ],
@@ -34,17 +72,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "block-account"
+                    "graphql"
                 ],
-                "summary": "Create a new block account",
+                "summary": "Query accounts with GraphQL",
                 "parameters": [
                     {
-                        "description": "Create account request",
-                        "name": "account",
+                        "description": "GraphQL query",
+                        "name": "query",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/main.CreateAccountRequest"
+                            "$ref": "#/definitions/main.GraphQLRequest"
                         }
                     }
                 ],
@@ -52,7 +90,8 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.SuccessResponse"
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     },
                     "400": {
@@ -61,6 +100,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "GraphQL is not enabled for the caller",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -70,58 +115,133 @@ const docTemplate = `{
                 }
             }
         },
-        "/block-account/{id}": {
+        "/health": {
             "get": {
-                "description": "Retrieve a block account by its ID",
-                "consumes": [
+                "description": "Check if the service is healthy and database is reachable. Kept for existing monitors; Kubernetes probes should use /healthz and /readyz.",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health check endpoint",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Answers 200 while the process is running and able to serve HTTP. It checks no dependencies, so a database outage doesn't get healthy instances restarted; use /readyz to take an instance out of rotation.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "block-account"
+                    "health"
                 ],
-                "summary": "Get block account by ID",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "format": "int64",
-                        "description": "Account ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Reports whether the instance should receive traffic, with the status of each dependency. The database must be reachable, the schema migrated to at least this build's version and the replica within MAX_REPLICATION_LAG of the primary. The cache and worker heartbeats are reported without affecting readiness. Includes the region status in a multi-region deployment. Also served at /ready.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
                 ],
+                "summary": "Readiness probe",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.BlockAccount"
+                            "$ref": "#/definitions/main.Readiness"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Readiness"
                         }
-                    },
-                    "404": {
-                        "description": "Not Found",
+                    }
+                }
+            }
+        },
+        "/status": {
+            "get": {
+                "description": "Sanitized operational summary for the public status page: uptime, whether each dependency is reachable and when maturities last ran. Always answers 200 so pollers can tell a degraded service from an unreachable one.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Public service status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.ServiceStatus"
+                        }
+                    }
+                }
+            }
+        },
+        "/swagger/doc.hash": {
+            "get": {
+                "description": "Returns the SHA-256 of the document served at /swagger/doc.json with its ETag and modification time. API gateways poll this and re-import the spec only when the digest changes.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "OpenAPI document hash",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.SpecDigest"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes a block account by its ID",
+            }
+        },
+        "/v2/admin/analysis/rate-scenario": {
+            "post": {
+                "description": "Recomputes the full-term interest liability of the active portfolio under a hypothetical rate table, per period and in total, without persisting anything",
                 "consumes": [
                     "application/json"
                 ],
@@ -129,24 +249,32 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "block-account"
+                    "admin"
                 ],
-                "summary": "Delete block account by ID",
+                "summary": "Project interest liability under a rate scenario",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "format": "int64",
-                        "description": "Account ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Proposed rates per period",
+                        "name": "scenario",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.RateScenarioRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "example": "EUR",
+                        "description": "ISO 4217 currency to also present the totals in",
+                        "name": "display_currency",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.RateScenarioResult"
                         }
                     },
                     "400": {
@@ -155,14 +283,14 @@ const docTemplate = `{
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "502": {
+                        "description": "Bad Gateway",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
@@ -170,38 +298,69 @@ const docTemplate = `{
                 }
             }
         },
-        "/health": {
+        "/v2/admin/api-keys": {
             "get": {
-                "description": "Check if the service is healthy and database is reachable",
+                "description": "Every API key, newest first, with its scopes, last use and revocation: all of them for platform callers, the tenant's own for callers bound to a tenant. Secrets are never returned.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "health"
+                    "admin"
+                ],
+                "summary": "List API keys",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Health check endpoint",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.APIKey"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
                             }
                         }
                     },
-                    "503": {
-                        "description": "Service Unavailable",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/user/{userID}/block-accounts": {
-            "get": {
-                "description": "Retrieve all block accounts for a specific user",
+            },
+            "post": {
+                "description": "Issues an API key with read, write or admin scope for a service-to-service caller, which sends it in X-API-Key. A key with a tenant_id acts for that tenant only. The key is returned only in this response.",
                 "consumes": [
                     "application/json"
                 ],
@@ -209,26 +368,37 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "block-account"
+                    "admin"
                 ],
-                "summary": "Get all block accounts for a user",
+                "summary": "Issue an API key",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "format": "int64",
-                        "description": "User ID",
-                        "name": "userID",
-                        "in": "path",
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
                         "required": true
+                    },
+                    {
+                        "description": "Name and scopes",
+                        "name": "key",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.IssueAPIKeyRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/main.BlockAccount"
+                            "$ref": "#/definitions/main.APIKey"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the key"
                             }
                         }
                     },
@@ -238,6 +408,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/main.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -246,101 +428,9963 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "main.BlockAccount": {
-            "description": "Block account information with interest calculations",
-            "type": "object",
-            "properties": {
-                "created_at": {
-                    "type": "string"
-                },
-                "end_date": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "integer",
-                    "example": 1
-                },
-                "interest_rate": {
-                    "type": "number",
-                    "example": 0.05
-                },
-                "principal": {
-                    "type": "number",
-                    "example": 1000
-                },
-                "start_date": {
-                    "type": "string"
-                },
-                "status": {
-                    "type": "string",
-                    "example": "active"
-                },
-                "updated_at": {
-                    "type": "string"
-                },
-                "user_id": {
-                    "type": "integer",
-                    "example": 123
-                }
+        },
+        "/v2/admin/api-keys/{id}": {
+            "delete": {
+                "description": "Stops the key, and any old secret still in its rotation grace period, from authenticating. The key stays listed as revoked.",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Revoke an API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "API key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/api-keys/{id}/rotate": {
+            "post": {
+                "description": "Replaces the key's secret, keeping its prefix and scopes. The old secret keeps working for the grace period so callers can roll out the new one. The new key is returned only in this response.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Rotate an API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "API key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Grace period for the old secret",
+                        "name": "rotation",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.RotateAPIKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.APIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/approvals": {
+            "get": {
+                "description": "Lists the latest 200 approvals, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List approvals",
+                "parameters": [
+                    {
+                        "enum": [
+                            "pending",
+                            "approved",
+                            "rejected",
+                            "failed"
+                        ],
+                        "type": "string",
+                        "description": "Only approvals in this status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.Approval"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Holds an early withdrawal, freeze or unfreeze of a block account until a second staff member approves it. Approvers are notified with approval.requested on the operations webhook channel.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Request a sensitive operation",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Action, account and reason",
+                        "name": "approval",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ApprovalRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.Approval"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the approval"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/approvals/{id}": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get an approval",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Approval ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Approval"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/approvals/{id}/approve": {
+            "post": {
+                "description": "Approves a pending request and carries out its action. The approver must be a different staff member from the requester. When the action can no longer be carried out, for example because the account matured meanwhile, the approval is recorded as failed and 409 is returned.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Approve a sensitive operation",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Approval ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Approver's comment",
+                        "name": "decision",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.ApprovalDecisionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Approval"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/approvals/{id}/reject": {
+            "post": {
+                "description": "Rejects a pending request so its action is never carried out. A note explaining the rejection is required.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reject a sensitive operation",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Approval ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Reason for rejecting",
+                        "name": "decision",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ApprovalDecisionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Approval"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/archive/block-account/{id}": {
+            "get": {
+                "description": "Returns an account the retention worker moved out of the live tables once it had been closed for longer than its status's retention period, with the account, its history, holders and beneficiaries as they were archived. Archived accounts are no longer served by the other account routes.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get an archived block account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ArchivedAccount"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/block-account": {
+            "post": {
+                "description": "Books an active block account that opened before it is booked, for migrations and corrections. Its start date is value_date, from which its term is counted and its interest accrues; its created_at is when it was booked, and its history shows both. Interest payments that fell due since value_date are paid by the next interest payout run. No funding is debited, and product gates, minimum principals and account limits do not apply. value_date may not be in the future, nor so far back that the deposit would already have matured.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Book a value-dated block account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Account and its value date",
+                        "name": "account",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ValueDatedAccountRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.BlockAccount"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the account"
+                            },
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the new account"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "value_date is in the future or too far back, or the user does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "The user service's circuit breaker is open",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/block-account/{id}/adjust": {
+            "post": {
+                "description": "Requests a manual credit, or a debit when amount is negative, of the account's interest, paid with the interest at maturity. A debit may not take the maturity payout below the principal. A value_date in the past is recorded with the adjustment as when it took effect, apart from when it was booked. The adjustment is held until a second staff member approves it with POST /admin/approvals/{id}/approve.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Adjust a block account's interest",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Amount and reason",
+                        "name": "adjustment",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.AdjustInterestRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.Approval"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the approval"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Account not active",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Debit exceeds the interest still to be paid, or value_date is in the future or outside the term",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/block-account/{id}/payout/failure": {
+            "post": {
+                "description": "Marks the account's in-flight maturity payout as failed, moves the account to payout_failed and notifies operations and the customer",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Report a failed payout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Failure details",
+                        "name": "failure",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.PayoutFailureRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/block-account/{id}/payout/retry": {
+            "post": {
+                "description": "Re-queues a failed maturity payout, optionally to a different destination account",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Retry or redirect a failed payout",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Optional new destination",
+                        "name": "retry",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.RetryPayoutRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/block-account/{id}/payout/sent": {
+            "post": {
+                "description": "Marks the account's in-flight payout as sent. A closing account is closed by its final payout, publishing account.closed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Confirm a payout was sent",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Payout"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/block-account/{id}/recalculate": {
+            "post": {
+                "description": "Requests that the account's rate be re-derived from the rate plan for its period, with the interest already paid recomputed at that rate and the difference credited or debited at maturity. The recalculation is held until a second staff member approves it with POST /admin/approvals/{id}/approve, and is derived again then; the returned approval shows the adjustment as of the request. With a value_date the plan's rate applies from that date only, for corrections that take effect part way through the term: interest before it keeps the account's rate. With dry_run=true the recalculation is carried out at once and rolled back, and the response shows what it would change without requesting an approval.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Recalculate a block account's interest",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Why the interest is recalculated",
+                        "name": "recalculation",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.RecalculateInterestRequest"
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Show what the recalculation would change without keeping anything",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Dry run",
+                        "schema": {
+                            "$ref": "#/definitions/main.RecalculationPreview"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.Approval"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the approval"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Account not active, interest already follows the rate plan, or no period to take a rate from",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Recalculated debit exceeds the interest still to be paid, or value_date is in the future or outside the term",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/block-accounts/batch-action": {
+            "post": {
+                "description": "Queues a job that freezes, unfreezes or matures a set of accounts, given as account_ids or selected by a filter, and returns 202 with the job. Freezes and unfreezes take effect at once, without the second approver a single account's needs, so the reason is kept with the job. Maturing only applies to accounts past their end date. Poll the job: its result lists the outcome for every account, and one account failing does not stop the rest. Requires the X-Staff-ID header.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Act on many accounts at once",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Action, accounts and reason",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.BatchActionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.Job"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Job status URL"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/block-accounts/maturing-soon": {
+            "get": {
+                "description": "Lists active block accounts maturing within the next days, soonest first, for liquidity planning",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List accounts maturing soon",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 7,
+                        "description": "Window in days (1-366)",
+                        "name": "days",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.BlockAccount"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/cache/stats": {
+            "get": {
+                "description": "Returns hit, miss, error and invalidation counters of the Redis read cache",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Read cache statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.CacheStats"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/compliance/flags": {
+            "get": {
+                "description": "Lists the latest 200 flags raised by the anomaly detector, newest first. Filter on status=open for the review queue.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List compliance flags",
+                "parameters": [
+                    {
+                        "enum": [
+                            "open",
+                            "cleared",
+                            "escalated"
+                        ],
+                        "type": "string",
+                        "description": "Only flags in this status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.ComplianceFlag"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/compliance/flags/{id}/review": {
+            "post": {
+                "description": "Closes an open flag, clearing the activity as legitimate or escalating it to a case. A note is required.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Review a compliance flag",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Flag ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Review outcome",
+                        "name": "review",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ReviewComplianceFlagRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ComplianceFlag"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/dashboard": {
+            "get": {
+                "description": "Queue depths, jobs failed in the last 24 hours, pending approvals and accounts in error states, read in a single query for dashboards that poll often",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Operations dashboard counters",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Dashboard"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/events": {
+            "get": {
+                "description": "Lists domain events from the append-only event log in sequence order: every account creation, funding, interest payment, status change, maturity and closure, as published. Follow the log by passing the last sequence read as after.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Read the event log",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Only events after this sequence",
+                        "name": "after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only this account's events",
+                        "name": "account_id",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "account.created",
+                            "account.funded",
+                            "account.funding_failed",
+                            "account.status_changed",
+                            "interest.paid",
+                            "account.matured",
+                            "account.closed"
+                        ],
+                        "type": "string",
+                        "description": "Only events of this type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.LoggedEvent"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/events/rebuild": {
+            "post": {
+                "description": "Rebuilds state derived from the event log after an outage or a consumer bug. notifications rewinds the notification worker's cursor to after_sequence; the worker queues the notices the later events should have produced, skipping any already queued. read_cache drops every cached account and user list so reads go back to the database. To re-emit events to the broker or a webhook, use POST /admin/events/replay.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Rebuild a projection from the event log",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member requesting the rebuild",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Projection to rebuild",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ProjectionRebuildRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.ProjectionRebuild"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/events/replay": {
+            "post": {
+                "description": "Queues a replay of stored outbox events, published or not, for a time range and/or account set to the broker (optionally on another topic) or one webhook subscription. Events keep their IDs, so consumers that deduplicate on them only process what they missed. The outbox worker runs the replay; poll GET /admin/events/replay/{id} for progress.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Replay stored events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member requesting the replay",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Events to replay and their destination",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.EventReplayRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.EventReplay"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the replay's progress"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/events/replay/{id}": {
+            "get": {
+                "description": "Returns a replay's status and how many events it has replayed so far",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get an event replay",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Replay ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.EventReplay"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/export/block-accounts": {
+            "get": {
+                "description": "Streams every block account updated at or after since, in (updated_at, id) order, as NDJSON (one ExportedAccount per line) or as a Parquet file. The accounts are read in chunks of EXPORT_CHUNK_SIZE (1000 by default), each with its own short query, and written as they are read. For incremental loads, pass the largest updated_at of the previous export as since; accounts updated at that instant are sent again, so merge on id. Deleted accounts are not exported. An error after the first chunk aborts the response, so a truncated export never looks complete. Without X-Tenant-ID every tenant's accounts are exported. Platform operators only.",
+                "produces": [
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Export block accounts for analytics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "2025-06-01T00:00:00Z",
+                        "description": "RFC 3339 time; only accounts updated at or after it are exported",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "ndjson",
+                        "description": "ndjson or parquet",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.ExportedAccount"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/feature-flags": {
+            "get": {
+                "description": "Lists every feature that can be flagged with who it is enabled for, from FEATURE_FLAGS and the built-in defaults unless set through this API",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List feature flags",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.FeatureFlag"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/feature-flags/{name}": {
+            "put": {
+                "description": "Enables a feature for everyone, or for the listed tenants plus a stable percentage of other traffic, without redeploying. Replaces the feature's configured flag; every instance applies the change within 30 seconds.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Flag a feature",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Feature name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Who the feature is on for",
+                        "name": "flag",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.FeatureFlagRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.FeatureFlag"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes the flag set through the admin API, putting the feature back on FEATURE_FLAGS or its built-in default",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reset a feature flag",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Feature name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/impersonations": {
+            "post": {
+                "description": "Issues a time-limited, read-only session token with which a support agent sees the API exactly as the customer does, by sending it in X-Impersonation-Token. Requires a staff role allowed by IMPERSONATION_ROLES. The token is returned only in this response.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Start an impersonation session",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff role, set by the gateway",
+                        "name": "X-Staff-Role",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Customer and reason",
+                        "name": "session",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.StartImpersonationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.ImpersonationSession"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the session"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/impersonations/{id}": {
+            "get": {
+                "description": "Returns an impersonation session with the audit trail of every request made with it",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get an impersonation session",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Session ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ImpersonationSession"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Ends an impersonation session before it expires; its token stops working immediately",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "End an impersonation session",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Session ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/limits": {
+            "get": {
+                "description": "Lists the business rules enforced when block accounts are opened",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List account limits",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.AccountLimit"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/limits/{rule}": {
+            "put": {
+                "description": "Sets a business rule enforced when block accounts are opened, taking effect immediately. max_open_accounts and max_total_principal cap what each user holds in active accounts; min_principal and max_principal bound the principal of one period's accounts.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Set an account limit",
+                "parameters": [
+                    {
+                        "enum": [
+                            "max_open_accounts",
+                            "max_total_principal",
+                            "min_principal",
+                            "max_principal"
+                        ],
+                        "type": "string",
+                        "description": "Rule code",
+                        "name": "rule",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Limit value",
+                        "name": "limit",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.AccountLimitRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AccountLimit"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stops enforcing a business rule. Per-period rules name the period in the query.",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Remove an account limit",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Rule code",
+                        "name": "rule",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Period, for min_principal and max_principal",
+                        "name": "period",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/maturities": {
+            "get": {
+                "description": "Aggregates the active accounts maturing between two business dates per day, week or month of their maturity date in BUSINESS_TIMEZONE: how many mature, the principal they return, the interest they still pay and how much of it rolls over rather than pays out. Amounts are at current rates. format=csv returns one row per bucket and format=ics an iCalendar file with an all-day event per bucket with maturities. The window is at most five years.",
+                "produces": [
+                    "application/json",
+                    "text/csv",
+                    "text/calendar"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get the maturity calendar",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First business date, YYYY-MM-DD; today by default",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last business date, inclusive, YYYY-MM-DD; 90 days after from by default",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "day",
+                            "week",
+                            "month"
+                        ],
+                        "type": "string",
+                        "default": "day",
+                        "description": "Bucket size",
+                        "name": "group_by",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "csv",
+                            "ics"
+                        ],
+                        "type": "string",
+                        "default": "json",
+                        "description": "Response format",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.MaturityCalendar"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/maturity/run": {
+            "post": {
+                "description": "Queues a job that matures every active account past its end date, as the maturity worker does on its schedule, and returns 202 with the job. Poll the job for progress. With dry_run=true nothing is queued: the due accounts, up to 5000, are matured within the request and rolled back, and the response shows how many would mature, the payouts and rollovers, and their IDs.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Start a maturity run",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member starting the run",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Show what the run would do without keeping anything",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Dry run",
+                        "schema": {
+                            "$ref": "#/definitions/main.MaturityRunPreview"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.Job"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Job status URL"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/product-gates": {
+            "get": {
+                "description": "Lists the products in soft launch with their allowlists and rollout percentages",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List product gates",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.ProductGate"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/product-gates/{product}": {
+            "put": {
+                "description": "Restricts a deposit product to the allowlisted users plus a stable percentage of all other users. Other users neither see it nor can open it. Replaces any existing gate.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Gate a product for a pilot launch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product period code",
+                        "name": "product",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Pilot group",
+                        "name": "gate",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ProductGateRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ProductGate"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a product's gate so every user can see and open it",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Launch a gated product to all users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product period code",
+                        "name": "product",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/products": {
+            "get": {
+                "description": "Lists every deposit product with its term, built-in rate, minimum principal and early withdrawal rule, retired ones included. Platform operators only.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List product definitions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.ProductDefinition"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/products/{code}": {
+            "put": {
+                "description": "Creates a deposit product, or replaces its definition, and offers it again if it was retired. Accounts already open keep their rate and maturity date. Every process offers the change within a minute. Platform operators only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Define a product",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product code, stored as the period of its accounts",
+                        "name": "code",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Product",
+                        "name": "product",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ProductDefinitionRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ProductDefinition"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stops a deposit product being opened. Accounts already open on it keep maturing and rolling over. Defining the product again offers it again. Platform operators only.",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Retire a product",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product code",
+                        "name": "code",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/rates": {
+            "get": {
+                "description": "Lists the interest rate new accounts of each period open at in the caller's tenant: the tenant's own where it set one, the built-in rate otherwise",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List the rate plan",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant, for platform callers",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.TenantRate"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/rates/{period}": {
+            "put": {
+                "description": "Sets the interest rate new accounts of a period open and roll over at in the caller's tenant. Accounts already open keep their rate.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Set a rate",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product code",
+                        "name": "period",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Rate, as a fraction",
+                        "name": "rate",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.TenantRateRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant, for platform callers",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.TenantRate"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Puts a period back on its built-in rate in the caller's tenant",
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Reset a rate",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Period",
+                        "name": "period",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tenant, for platform callers",
+                        "name": "X-Tenant-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/reconciliation/breaks": {
+            "get": {
+                "description": "Lists the latest 200 accounts the nightly reconciliation found out of balance, newest first: those whose principal plus posted interest less payouts differs from the balance their stored fields give. Filter on status=open for the work queue.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List reconciliation breaks",
+                "parameters": [
+                    {
+                        "enum": [
+                            "open",
+                            "acknowledged",
+                            "resolved"
+                        ],
+                        "type": "string",
+                        "description": "Only breaks in this status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.ReconciliationBreak"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/reconciliation/breaks/{id}/acknowledge": {
+            "post": {
+                "description": "Marks an open break as being worked on, with a note. The break stays acknowledged until a reconciliation run finds the account back in balance and resolves it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Acknowledge a reconciliation break",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Break ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Acknowledgement",
+                        "name": "acknowledgement",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.AcknowledgeBreakRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReconciliationBreak"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/region": {
+            "get": {
+                "description": "Reports this instance's region, whether it is the active or a standby region, the failover epoch and the replication lag of its replica",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get this instance's region",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.RegionStatus"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/region/promote": {
+            "post": {
+                "description": "Queues a failover job that makes this instance's region the active one and fences the workers of the previous active region, which stop within seconds and leave their saved progress to this region. Promote the region's database first. Poll GET /jobs/{id} for progress.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Promote this region to active",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member requesting the failover",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Why the region is being promoted",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.PromoteRegionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.Job"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Job status URL"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/reports/{type}/run": {
+            "post": {
+                "description": "Queues a job that generates a report for a business day and delivers it like a scheduled run: by email to REPORT_EMAIL_TO and to the object store, where configured. Generating a day again replaces its report. Requires the X-Staff-ID header.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Generate a report",
+                "parameters": [
+                    {
+                        "enum": [
+                            "daily_summary"
+                        ],
+                        "type": "string",
+                        "description": "Report type",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Business day, YYYY-MM-DD (default yesterday)",
+                        "name": "date",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member requesting the report",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.Job"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Job status URL"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/reports/{type}/{date}": {
+            "get": {
+                "description": "Returns a generated report for a business day with where it was delivered",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get a report",
+                "parameters": [
+                    {
+                        "enum": [
+                            "daily_summary"
+                        ],
+                        "type": "string",
+                        "description": "Report type",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Business day, YYYY-MM-DD",
+                        "name": "date",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/sandbox/advance-time": {
+            "post": {
+                "description": "Moves the sandbox's clock forward for every server and worker within seconds, so QA can fast-forward accrual and maturities. Accounts opened from then on start at the new time; the accrual and maturity workers pay and mature what has fallen due on their next run. The clock never moves back. Only served by sandbox deployments.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sandbox"
+                ],
+                "summary": "Advance the sandbox's clock",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "How far to move the clock",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.AdvanceTimeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.SandboxClock"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/scheduler/jobs": {
+            "get": {
+                "description": "Lists the jobs ` + "`" + `worker scheduler` + "`" + ` runs on cron schedules (maturity, accrual, reconciliation, reports and retention) with their schedules, whether they are paused or triggered, whether they are running, and their last and next runs",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List scheduled jobs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.ScheduledJob"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/scheduler/jobs/{job}/pause": {
+            "post": {
+                "description": "Stops the scheduler running the job on its schedule until it is resumed. A run under way finishes, and the job can still be triggered.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Pause a scheduled job",
+                "parameters": [
+                    {
+                        "enum": [
+                            "maturity",
+                            "accrual",
+                            "reconciliation",
+                            "reports",
+                            "retention"
+                        ],
+                        "type": "string",
+                        "description": "Job",
+                        "name": "job",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ScheduledJob"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/scheduler/jobs/{job}/resume": {
+            "post": {
+                "description": "Puts a paused job back on its schedule. Runs missed while it was paused are not made up; the next one is at its next scheduled time.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Resume a scheduled job",
+                "parameters": [
+                    {
+                        "enum": [
+                            "maturity",
+                            "accrual",
+                            "reconciliation",
+                            "reports",
+                            "retention"
+                        ],
+                        "type": "string",
+                        "description": "Job",
+                        "name": "job",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ScheduledJob"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/scheduler/jobs/{job}/trigger": {
+            "post": {
+                "description": "Asks the scheduler to run the job now, even if it is paused. The run starts within 5 seconds, or when a run under way ends; triggering again before it starts asks for the same run. Poll GET /admin/scheduler/jobs for its progress.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Trigger a scheduled job",
+                "parameters": [
+                    {
+                        "enum": [
+                            "maturity",
+                            "accrual",
+                            "reconciliation",
+                            "reports",
+                            "retention"
+                        ],
+                        "type": "string",
+                        "description": "Job",
+                        "name": "job",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/main.ScheduledJob"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/stats": {
+            "get": {
+                "description": "Counts and summed principal by status, period and currency, upcoming maturities in the next 7, 30 and 90 days and the average rate of active accounts. Aggregated in the database and cached for STATS_CACHE_TTL (30s by default); computed_at tells how fresh the figures are.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Portfolio statistics",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.PortfolioStats"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/tenants": {
+            "get": {
+                "description": "Lists every tenant. Platform operators only.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List tenants",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.Tenant"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a tenant, on the built-in rate plan and without limits or product gates. Platform operators only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Create a tenant",
+                "parameters": [
+                    {
+                        "description": "Tenant",
+                        "name": "tenant",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.CreateTenantRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.Tenant"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the tenant list"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/admin/webhooks/{id}/replay": {
+            "post": {
+                "description": "Re-queues every failed delivery of the webhook for immediate delivery with a fresh retry budget",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Replay failed webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account": {
+            "post": {
+                "description": "Creates a new block account with specified user ID, principal, and period. Interest is paid at maturity unless a monthly or quarterly payout_frequency is given. When funding is enabled the principal is debited from settlement_account; the account is returned with 202 and status pending_funding until the debit confirms.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Create a new block account",
+                "parameters": [
+                    {
+                        "description": "Create account request",
+                        "name": "account",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.CreateAccountRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unique per create; a retry sending it again gets the account the first attempt opened, for 24 hours",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.BlockAccount"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the account"
+                            },
+                            "Idempotent-Replayed": {
+                                "type": "string",
+                                "description": "true when the account was opened by an earlier request with the Idempotency-Key"
+                            },
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the new account"
+                            },
+                            "X-Consistency-Token": {
+                                "type": "string",
+                                "description": "Echo on reads to see this write immediately"
+                            }
+                        }
+                    },
+                    "202": {
+                        "description": "Account created, waiting for its funding debit",
+                        "schema": {
+                            "$ref": "#/definitions/main.BlockAccount"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the account"
+                            },
+                            "Idempotent-Replayed": {
+                                "type": "string",
+                                "description": "true when the account was opened by an earlier request with the Idempotency-Key"
+                            },
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the new account"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "An identical account was opened moments ago; details name it",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "A limit was broken, the user does not exist (no rule) or the Idempotency-Key was sent with another request (no rule)",
+                        "schema": {
+                            "$ref": "#/definitions/main.RuleViolationResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many accounts opened recently by the user or from the client's address",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "The user service's circuit breaker is open",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/bulk": {
+            "post": {
+                "description": "Loads existing deposits as active block accounts from a JSON array, a CSV file with a header row naming the JSON fields (sent as text/csv or as the \"file\" field of a multipart form), and returns a per-row report. Rows are validated independently; invalid rows are reported and skipped. Up to BULK_SYNC_MAX_ROWS rows (1000 by default) and BULK_SYNC_MAX_BYTES (1 MB) are loaded within the request. Larger uploads, or any with async=true, are queued as a job that loads them BULK_CHUNK_SIZE rows at a time, answered with 202, the import and job IDs and the job's status URL in Location. async=false refuses to queue. dry_run=true loads the upload within the request however large it is, reports what it would create, including the total principal, and rolls every row back. While BULK_MAX_PENDING_IMPORTS imports are waiting, new ones get 503 with Retry-After. Product gates and account limits do not apply.",
+                "consumes": [
+                    "application/json",
+                    "text/csv",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Bulk load existing deposits",
+                "parameters": [
+                    {
+                        "description": "Deposits to load",
+                        "name": "accounts",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.BulkAccountRow"
+                            }
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "true always queues the import, false never does; by default large uploads are queued",
+                        "name": "async",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Report what the import would create without keeping anything",
+                        "name": "dry_run",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AccountImport"
+                        }
+                    },
+                    "202": {
+                        "description": "Import queued",
+                        "schema": {
+                            "$ref": "#/definitions/main.AccountImport"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Job status URL"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before trying again"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/bulk/{id}": {
+            "get": {
+                "description": "Returns an async bulk import's status, progress and per-row report so far",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Get a bulk import",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Import ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AccountImport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}": {
+            "get": {
+                "description": "Retrieve a block account by its ID. Active and frozen accounts carry a valuation computed at read time: days elapsed, interest accrued to date, current value and projected maturity value, as of the start of the business day. The response carries a strong ETag that changes whenever the account or its valuation does; send it in If-None-Match to get a 304 while both are unchanged.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Get block account by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the copy the client holds",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Set to 'strong' to read from the primary",
+                        "name": "X-Consistency",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token returned by a previous write",
+                        "name": "X-Consistency-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.BlockAccount"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the account"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a block account and everything recorded against it for good, keeping only its status history, and publishes account.closed. This is a staff tool for removing data, which pays nothing out; holders close accounts with POST /block-account/{id}/close. Frozen accounts cannot be deleted. From v2 the account's ETag must be sent in If-Match, and a delete of a changed account fails with 412.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Delete block account data",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the account as last read",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "X-Staff-ID is missing",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "The account changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "If-Match is missing",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/agreement": {
+            "get": {
+                "description": "Returns the deposit agreement issued when the account was opened, as a PDF. X-Agreement-Version names the template it was issued from and X-Content-SHA256 the digest recorded at issue.",
+                "produces": [
+                    "application/pdf"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Download the deposit agreement",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        },
+                        "headers": {
+                            "X-Agreement-Version": {
+                                "type": "string",
+                                "description": "Template version the agreement was issued from"
+                            },
+                            "X-Content-SHA256": {
+                                "type": "string",
+                                "description": "SHA-256 of the issued document"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/beneficiaries": {
+            "get": {
+                "description": "The people the account passes to, in the order they were named, with their share of it. An account without beneficiaries lists none.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "List an account's beneficiaries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.Beneficiary"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replaces the account's beneficiaries with up to 10 people whose allocation percentages add up to 100. Beneficiaries carry over when the account rolls over and are listed on the holder's interest certificate. When X-User-ID is sent it must name the primary holder.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Name an account's beneficiaries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Customer the request acts for, set by the gateway",
+                        "name": "X-User-ID",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Every beneficiary of the account",
+                        "name": "beneficiaries",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.BeneficiariesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.Beneficiary"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid beneficiary, or allocations do not add up to 100",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "X-User-ID is not the primary holder",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Clears every beneficiary of the account. When X-User-ID is sent it must name the primary holder.",
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Remove an account's beneficiaries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Customer the request acts for, set by the gateway",
+                        "name": "X-User-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "X-User-ID is not the primary holder",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/close": {
+            "post": {
+                "description": "Closes an active block account, paying it out at its current value. The account moves to closing and its final payout is queued to destination_account; once the payout is confirmed sent it is closed and account.closed is published. Frozen accounts cannot be closed. Closing before maturity is refused when the product does not allow early withdrawal, and needs an approved early_withdrawal instead when its product requires one or the principal is at least APPROVAL_EARLY_WITHDRAWAL_THRESHOLD. From v2 the account's ETag must be sent in If-Match, and a close of a changed account fails with 412. Only the primary holder of a joint account may close it; when X-User-ID is sent it must name them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Close block account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the account as last read",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Customer the request acts for, set by the gateway",
+                        "name": "X-User-ID",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Settlement instructions",
+                        "name": "closure",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.CloseAccountRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Account closing, waiting for its final payout",
+                        "schema": {
+                            "$ref": "#/definitions/main.BlockAccount"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the closing account"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "X-User-ID is not the primary holder",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "The account changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "If-Match is missing",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/communications": {
+            "get": {
+                "description": "Lists every notification, statement and certificate sent about a block account in chronological order, including for accounts that have since been deleted",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Get the communications log of a block account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.Communication"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/history": {
+            "get": {
+                "description": "Lists what happened to a block account, oldest first by when it was booked: its status changes, principal changes, funding, interest payments, interest adjustments and maturity payout, each with the principal, interest paid and interest accrued once it happened. Entries that took effect before they were booked, such as the opening of a value-dated account, carry their value_date. Accounts since closed keep their history.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Get the history of a block account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AccountHistory"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/holders": {
+            "get": {
+                "description": "The users who own the account: its primary holder, the user it was opened for, then its secondary holders in the order they were added",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "List an account's holders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.AccountHolder"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Makes a user a secondary holder of the account, turning it into a joint account. The account then appears among the user's accounts, but only the primary holder may close it or change where it pays out. When X-User-ID is sent it must name the primary holder.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Add a holder to an account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Customer the request acts for, set by the gateway",
+                        "name": "X-User-ID",
+                        "in": "header"
+                    },
+                    {
+                        "description": "User to add",
+                        "name": "holder",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.AddAccountHolderRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.AccountHolder"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the account's holders"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "X-User-ID is not the primary holder",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The user already holds the account",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "The user does not exist",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "The user service's circuit breaker is open",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/holders/{userID}": {
+            "delete": {
+                "description": "Removes a secondary holder from the account; the account leaves their list of accounts. The primary holder cannot be removed. When X-User-ID is sent it must name the primary holder or the holder being removed.",
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Remove a holder from an account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "User ID of the holder",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Customer the request acts for, set by the gateway",
+                        "name": "X-User-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "X-User-ID is neither the primary holder nor the holder removed",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The user is the primary holder",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/maturity-instruction": {
+            "put": {
+                "description": "Choose whether an active block account is paid out or rolled over at maturity. Changes are accepted until the configured cutoff before end_date. From v2 the account's ETag must be sent in If-Match, and a change to a changed account fails with 412. Only the primary holder of a joint account may change it; when X-User-ID is sent it must name them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Change maturity instruction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the account as last read",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Customer the request acts for, set by the gateway",
+                        "name": "X-User-ID",
+                        "in": "header"
+                    },
+                    {
+                        "description": "New maturity instruction",
+                        "name": "instruction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.MaturityInstructionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.BlockAccount"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the changed account"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "X-User-ID is not the primary holder",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "The account changed since it was read",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "If-Match is missing",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/notification-mute": {
+            "put": {
+                "description": "Withholds the account's non-critical notifications, such as maturity reminders, until the given time (at most 90 days ahead), replacing any mute in effect. Critical notices about maturity instructions and payouts are still sent. The mute lifts by itself and is kept as an audit record.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "notifications"
+                ],
+                "summary": "Mute an account's notifications",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Mute period",
+                        "name": "mute",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.MuteNotificationsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.NotificationMute"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Lifts the mute in effect on the account before it runs out. Notifications withheld while it was muted are not sent.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "notifications"
+                ],
+                "summary": "Unmute an account's notifications",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.NotificationMute"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/notification-mutes": {
+            "get": {
+                "description": "Every mute set on the account, newest first, with who set it, until when and whether it was lifted early",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "notifications"
+                ],
+                "summary": "List an account's notification mutes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.NotificationMute"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/block-account/{id}/payout-schedule": {
+            "get": {
+                "description": "Lists the interest paid on a block account and its upcoming interest and maturity payments with their expected amounts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Get the payout schedule of a block account",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.PayoutSchedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/features": {
+            "get": {
+                "description": "Names the flagged features that are on for the caller's tenant and, when X-User-ID is sent, that customer. Without X-User-ID percentage rollouts are evaluated per request.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "meta"
+                ],
+                "summary": "List the features enabled for the caller",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Customer the request acts for, set by the gateway",
+                        "name": "X-User-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/jobs/{id}": {
+            "get": {
+                "description": "Returns an asynchronous job's status, progress and, once it succeeded, its result",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "Get a job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/jobs/{id}/cancel": {
+            "post": {
+                "description": "Cancels a queued job at once. A running job is asked to stop and does so within a few seconds, keeping the work it already saved; poll GET /jobs/{id} until its status is cancelled.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "jobs"
+                ],
+                "summary": "Cancel a job",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Staff member, set by the gateway",
+                        "name": "X-Staff-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Queued job cancelled",
+                        "schema": {
+                            "$ref": "#/definitions/main.Job"
+                        }
+                    },
+                    "202": {
+                        "description": "Running job asked to stop",
+                        "schema": {
+                            "$ref": "#/definitions/main.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/products": {
+            "get": {
+                "description": "Lists the deposit products the user can open, including pilots they have been let into. Without user_id only generally available products are listed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "List deposit products",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.Product"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/products/compare": {
+            "get": {
+                "description": "Quotes a principal on every deposit product the user can open: its rate, the maturity date of an account opened now, and the gross and net interest over the full term after withholding tax at TAX_WITHHOLDING_RATE. Products the principal is below the minimum of are listed with eligible false. user_id works as it does for GET /products.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Compare deposit products",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "description": "Amount to deposit",
+                        "name": "principal",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ProductComparison"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/sandbox/keys": {
+            "post": {
+                "description": "Issues a read and write API key that works for 30 days, without credentials. Only served by sandbox deployments.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sandbox"
+                ],
+                "summary": "Issue a sandbox API key",
+                "parameters": [
+                    {
+                        "description": "Key name",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.SandboxKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.APIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/user/{userID}/block-accounts": {
+            "get": {
+                "description": "Retrieve all block accounts for a specific user, including joint accounts of which they are a secondary holder. With display_currency, each account also carries its principal converted at the current rate.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Get all block accounts for a user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "example": "EUR",
+                        "description": "ISO 4217 currency to also present amounts in",
+                        "name": "display_currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Set to 'strong' to read from the primary",
+                        "name": "X-Consistency",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Token returned by a previous write",
+                        "name": "X-Consistency-Token",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.BlockAccount"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/user/{userID}/block-accounts/events": {
+            "get": {
+                "description": "Server-sent events for the user's block accounts: every change of status (account.created, account.funded, account.funding_failed, account.status_changed for a freeze or unfreeze, account.matured, account.closed) and every interest payment (interest.paid). Each event's id is its position in the event log, its event field the event type and its data the AccountEvent JSON of the published event schema. Events reach the stream a few seconds after they happen. A reconnecting client sends the last id it received in Last-Event-ID (or last_event_id, for clients that can't set headers) and is sent everything it missed; without it the stream starts at the newest event. A heartbeat comment is sent after 15 seconds without an event. Streams close after an hour, or when the client falls too far behind, and the client reconnects.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Stream a user's account events",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "id of the last event received",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "id of the last event received, when the header can't be sent",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "text/event-stream of AccountEvent",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/user/{userID}/notification-preferences": {
+            "get": {
+                "description": "Returns the channels, contact details, maturity reminder lead time and opt-outs used for the customer's notifications, or the defaults when none were set",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "notifications"
+                ],
+                "summary": "Get a customer's notification preferences",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.NotificationPreferences"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replaces the customer's notification preferences. Notices go to every listed channel; email needs an address and sms a phone number in international format. Critical notices (maturity instruction changes, payout failures and redirects) cannot be disabled.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "notifications"
+                ],
+                "summary": "Set a customer's notification preferences",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Notification preferences",
+                        "name": "preferences",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.NotificationPreferencesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.NotificationPreferences"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/user/{userID}/portfolio": {
+            "get": {
+                "description": "Sums up all of a user's block accounts, including joint accounts of which they are a secondary holder, so clients need not page through and add up the accounts themselves. Total principal, total interest accrued to date, the principal-weighted average rate and the next maturity date cover the active and frozen accounts; by_status counts every account by status. Interest is accrued to the start of the business day, as in an account's valuation. With display_currency, the totals are also presented converted at the current rate.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Get a user's portfolio summary",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "example": "EUR",
+                        "description": "ISO 4217 currency to also present amounts in",
+                        "name": "display_currency",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.UserPortfolio"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/user/{userID}/tax-certificate": {
+            "get": {
+                "description": "Summarizes interest earned and tax withheld across all of a user's block accounts for a tax year, with each account's beneficiaries, as JSON or PDF (format=pdf or Accept: application/pdf). With an object store configured, the PDF for a closed tax year is archived when first issued and served unchanged afterwards.",
+                "produces": [
+                    "application/json",
+                    "application/pdf"
+                ],
+                "tags": [
+                    "block-account"
+                ],
+                "summary": "Get annual interest certificate",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "User ID",
+                        "name": "userID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "example": 2024,
+                        "description": "Tax year",
+                        "name": "year",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "pdf"
+                        ],
+                        "type": "string",
+                        "description": "Response format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "EUR",
+                        "description": "ISO 4217 currency to also present the JSON totals in",
+                        "name": "display_currency",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.TaxCertificate"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/webhooks": {
+            "post": {
+                "description": "Subscribes a callback URL to account lifecycle events, or with channel \"operations\" to operational events (job.failed, reconciliation.break, webhook.dead_lettered, config.changed, approval.requested, region.failover). Deliveries are POSTed as JSON and signed with HMAC-SHA256 over \"\u003cX-Webhook-Timestamp\u003e.\u003cbody\u003e\" in X-Webhook-Signature; the secret is returned only in this response.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Register a webhook",
+                "parameters": [
+                    {
+                        "description": "Webhook registration",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.CreateWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.Webhook"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the webhook"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/webhooks/{id}": {
+            "delete": {
+                "description": "Unsubscribes a webhook and discards its pending deliveries",
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete a webhook",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Lists the webhook's 100 most recent deliveries, newest first, each with its log of delivery attempts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "format": "int64",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size (1-200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/main.Page"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "items": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/main.WebhookDelivery"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "URL of the next page, rel=next"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/versions": {
+            "get": {
+                "description": "Every mounted API version with its deprecation date, sunset date and successor. Routes without a version prefix are deprecated aliases of v1.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "meta"
+                ],
+                "summary": "List API versions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.APIVersionInfo"
+                            }
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "main.APIKey": {
+            "description": "An API key for service-to-service callers",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "key": {
+                    "description": "Key is only set in the responses that issue or rotate the key",
+                    "type": "string",
+                    "example": "bak_3f9a1c2e_5d41402abc4b2a76b9719d911017c592"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "core-banking-batch"
+                },
+                "prefix": {
+                    "description": "Prefix identifies the key in logs and is the part of it after \"bak_\"",
+                    "type": "string",
+                    "example": "3f9a1c2e"
+                },
+                "previous_key_expires_at": {
+                    "description": "PreviousKeyExpiresAt is when the secret replaced by the last rotation stops working",
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "revoked_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                },
+                "rotated_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "read",
+                        "write"
+                    ]
+                },
+                "tenant_id": {
+                    "description": "TenantID is the tenant the key acts for, empty for a platform key that\nmay act for any tenant",
+                    "type": "string",
+                    "example": "acme"
+                }
+            }
+        },
+        "main.APIVersionInfo": {
+            "description": "An API version and its deprecation schedule",
+            "type": "object",
+            "properties": {
+                "deprecated_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status is \"current\" or \"deprecated\"",
+                    "type": "string",
+                    "example": "current"
+                },
+                "successor": {
+                    "type": "string",
+                    "example": "v2"
+                },
+                "sunset": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string",
+                    "example": "v1"
+                }
+            }
+        },
+        "main.AccountClosure": {
+            "description": "Settlement instructions and final payout of a closed block account",
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Amount is the final payout: the principal with the interest accrued\nand not yet paid, and any adjustment",
+                    "type": "number",
+                    "example": 1012.33
+                },
+                "closed_at": {
+                    "description": "ClosedAt is when the final payout was confirmed sent",
+                    "type": "string"
+                },
+                "destination_account": {
+                    "type": "string",
+                    "example": "*********6789"
+                },
+                "method": {
+                    "description": "Method is \"bank_transfer\" or \"internal_transfer\"",
+                    "type": "string",
+                    "example": "bank_transfer"
+                },
+                "requested_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.AccountHistory": {
+            "description": "Chronological history of a block account's status, principal, interest and payouts",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.HistoryEntry"
+                    }
+                },
+                "status": {
+                    "description": "Status is the account's current status, \"closed\" once deleted",
+                    "type": "string",
+                    "example": "active"
+                }
+            }
+        },
+        "main.AccountHolder": {
+            "description": "A user who owns a block account. Every account has one primary holder, the user it was opened for, who alone may withdraw from it; secondary holders see it among their accounts.",
+            "type": "object",
+            "properties": {
+                "added_by": {
+                    "description": "AddedBy is the staff ID that added a secondary holder, or \"customer\"",
+                    "type": "string",
+                    "example": "customer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "role": {
+                    "description": "Role is \"primary\" or \"secondary\"",
+                    "type": "string",
+                    "example": "secondary"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 456
+                }
+            }
+        },
+        "main.AccountImport": {
+            "description": "Progress and per-row report of a bulk account import",
+            "type": "object",
+            "properties": {
+                "completed_at": {
+                    "type": "string"
+                },
+                "created": {
+                    "type": "integer",
+                    "example": 2497
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "dry_run": {
+                    "description": "DryRun is set when nothing was kept: the report shows what loading the\nupload would do, and its account IDs were never stored",
+                    "type": "boolean"
+                },
+                "failed": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 7
+                },
+                "job_id": {
+                    "description": "JobID is the job loading an async import",
+                    "type": "integer",
+                    "example": 12
+                },
+                "principal": {
+                    "description": "Principal is the total principal of the accounts a dry run would\ncreate",
+                    "type": "number",
+                    "example": 2497000
+                },
+                "processed": {
+                    "type": "integer",
+                    "example": 2500
+                },
+                "requested_by": {
+                    "type": "string",
+                    "example": "ops-17"
+                },
+                "results": {
+                    "description": "Results has one entry per processed row, in upload order",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.BulkRowResult"
+                    }
+                },
+                "status": {
+                    "type": "string",
+                    "example": "completed"
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 2500
+                }
+            }
+        },
+        "main.AccountLimit": {
+            "description": "Configurable limit on the accounts a user can open",
+            "type": "object",
+            "properties": {
+                "period": {
+                    "description": "Period is set for min_principal and max_principal and empty otherwise",
+                    "type": "string",
+                    "example": "3y"
+                },
+                "rule": {
+                    "type": "string",
+                    "example": "max_total_principal"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "updated_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                },
+                "value": {
+                    "type": "number",
+                    "example": 250000
+                }
+            }
+        },
+        "main.AccountLimitRequest": {
+            "description": "Request payload for setting an account limit",
+            "type": "object",
+            "properties": {
+                "period": {
+                    "description": "Period is required for min_principal and max_principal",
+                    "type": "string",
+                    "example": "3y"
+                },
+                "value": {
+                    "type": "number",
+                    "example": 250000
+                }
+            }
+        },
+        "main.AccountValuation": {
+            "description": "The account's interest and value, computed when it is read. Interest accrues by whole business days outside the sandbox, so the valuation changes once a day.",
+            "type": "object",
+            "properties": {
+                "accrued_interest_to_date": {
+                    "description": "AccruedInterestToDate is the interest earned since the start date,\npaid out periodically or not, before interest adjustments",
+                    "type": "number",
+                    "example": 12.47
+                },
+                "current_value": {
+                    "description": "CurrentValue is what the account holds: its principal, the interest\naccrued since the last periodic payment and its interest adjustment",
+                    "type": "number",
+                    "example": 1012.47
+                },
+                "days_elapsed": {
+                    "description": "DaysElapsed is the whole days of the term that have passed",
+                    "type": "integer",
+                    "example": 91
+                },
+                "projected_maturity_value": {
+                    "description": "ProjectedMaturityValue is what the account pays at maturity at its\ncurrent rate, as the maturity worker computes it",
+                    "type": "number",
+                    "example": 1050
+                },
+                "valued_at": {
+                    "description": "ValuedAt is the instant the figures are computed for: the start of the\ncurrent business day in BUSINESS_TIMEZONE, or the read itself in the\nsandbox",
+                    "type": "string"
+                }
+            }
+        },
+        "main.AcknowledgeBreakRequest": {
+            "description": "Acknowledgement of a reconciliation break being worked on",
+            "type": "object",
+            "properties": {
+                "note": {
+                    "type": "string",
+                    "maxLength": 1000,
+                    "example": "Adjustment posted twice, reversal requested"
+                }
+            }
+        },
+        "main.AddAccountHolderRequest": {
+            "description": "Request payload for adding a secondary holder to a block account",
+            "type": "object",
+            "properties": {
+                "user_id": {
+                    "type": "integer",
+                    "example": 456
+                }
+            }
+        },
+        "main.AdjustInterestRequest": {
+            "description": "Request payload for crediting or debiting an account's interest",
+            "type": "object",
+            "required": [
+                "amount"
+            ],
+            "properties": {
+                "amount": {
+                    "description": "Amount is credited, or debited when negative",
+                    "type": "number",
+                    "example": 12.5
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "Goodwill credit for delayed payout, case 3112"
+                },
+                "value_date": {
+                    "description": "ValueDate is when the credit or debit takes effect, when earlier than\nits booking",
+                    "type": "string",
+                    "example": "2026-03-01T00:00:00Z"
+                }
+            }
+        },
+        "main.AdvanceTimeRequest": {
+            "description": "Request payload for moving the sandbox's clock forward by days and hours",
+            "type": "object",
+            "properties": {
+                "days": {
+                    "type": "integer",
+                    "maximum": 1830,
+                    "minimum": 0,
+                    "example": 30
+                },
+                "hours": {
+                    "type": "integer",
+                    "maximum": 43920,
+                    "minimum": 0,
+                    "example": 0
+                }
+            }
+        },
+        "main.Approval": {
+            "description": "Sensitive operation waiting for, or decided by, a second staff member",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "action": {
+                    "description": "Action is early_withdrawal, freeze, unfreeze, interest_recalculation\nor interest_adjustment",
+                    "type": "string",
+                    "example": "freeze"
+                },
+                "adjustment": {
+                    "description": "Adjustment is the interest credited, or debited when negative, by an\ninterest adjustment, or by a recalculation as of its request",
+                    "type": "number",
+                    "example": 12.5
+                },
+                "amount": {
+                    "description": "Amount is the account's principal when the approval was requested",
+                    "type": "number",
+                    "example": 75000
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "decided_at": {
+                    "type": "string"
+                },
+                "decided_by": {
+                    "type": "string",
+                    "example": "ops-4"
+                },
+                "decision_note": {
+                    "description": "DecisionNote is the approver's comment, required when rejecting",
+                    "type": "string",
+                    "example": "Confirmed with compliance"
+                },
+                "failure_reason": {
+                    "description": "FailureReason explains why an approved action could not be carried out",
+                    "type": "string",
+                    "example": "block account is not active"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "Sanctions screening match, case 2291"
+                },
+                "requested_by": {
+                    "type": "string",
+                    "example": "ops-17"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "pending"
+                },
+                "value_date": {
+                    "description": "ValueDate is when a value-dated interest adjustment or recalculation\ntakes effect",
+                    "type": "string"
+                }
+            }
+        },
+        "main.ApprovalDecisionRequest": {
+            "description": "Approver's comment on a decision",
+            "type": "object",
+            "properties": {
+                "note": {
+                    "type": "string",
+                    "example": "Confirmed with compliance"
+                }
+            }
+        },
+        "main.ApprovalRequest": {
+            "description": "Request payload for a sensitive operation needing a second approver",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "action": {
+                    "description": "\"early_withdrawal\", \"freeze\" or \"unfreeze\"",
+                    "type": "string",
+                    "enum": [
+                        "early_withdrawal",
+                        "freeze",
+                        "unfreeze"
+                    ],
+                    "example": "freeze"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "Sanctions screening match, case 2291"
+                }
+            }
+        },
+        "main.ArchivedAccount": {
+            "description": "A block account archived after its retention period, with everything recorded about it when it was archived",
+            "type": "object",
+            "properties": {
+                "archived_at": {
+                    "type": "string"
+                },
+                "closed_at": {
+                    "description": "ClosedAt is when the account reached Status",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "record": {
+                    "description": "Record is an ArchiveRecord",
+                    "type": "object"
+                },
+                "status": {
+                    "description": "Status is the status the account ended in: \"matured\", \"rolled_over\",\n\"funding_failed\" or \"closed\"",
+                    "type": "string",
+                    "example": "matured"
+                },
+                "tenant_id": {
+                    "type": "string",
+                    "example": "default"
+                }
+            }
+        },
+        "main.BatchActionFilter": {
+            "description": "Criteria selecting the accounts of a batch action; at least one is required",
+            "type": "object",
+            "properties": {
+                "matures_before": {
+                    "description": "MaturesBefore selects accounts with an end date before it",
+                    "type": "string",
+                    "example": "2026-01-01T00:00:00Z"
+                },
+                "period": {
+                    "type": "string",
+                    "example": "1y"
+                },
+                "tenant_id": {
+                    "type": "string",
+                    "example": "acme"
+                },
+                "user_ids": {
+                    "type": "array",
+                    "maxItems": 1000,
+                    "items": {
+                        "type": "integer"
+                    },
+                    "example": [
+                        123,
+                        456
+                    ]
+                }
+            }
+        },
+        "main.BatchActionRequest": {
+            "description": "Action and the accounts to apply it to, listed or selected by a filter",
+            "type": "object",
+            "properties": {
+                "account_ids": {
+                    "type": "array",
+                    "maxItems": 10000,
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                    ]
+                },
+                "action": {
+                    "description": "\"freeze\", \"unfreeze\" or \"mature\"",
+                    "type": "string",
+                    "enum": [
+                        "freeze",
+                        "unfreeze",
+                        "mature"
+                    ],
+                    "example": "freeze"
+                },
+                "filter": {
+                    "$ref": "#/definitions/main.BatchActionFilter"
+                },
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500,
+                    "example": "Sanctions list match, case 2291"
+                }
+            }
+        },
+        "main.BeneficiariesRequest": {
+            "description": "Request payload naming every beneficiary of a block account. Allocations are percentages with at most two decimals and must add up to 100.",
+            "type": "object",
+            "required": [
+                "beneficiaries"
+            ],
+            "properties": {
+                "beneficiaries": {
+                    "type": "array",
+                    "maxItems": 10,
+                    "minItems": 1,
+                    "items": {
+                        "$ref": "#/definitions/main.BeneficiaryRequest"
+                    }
+                }
+            }
+        },
+        "main.Beneficiary": {
+            "description": "A person named to receive a share of a block account, a regulatory requirement for term deposits. An account's beneficiaries' allocations add up to 100%.",
+            "type": "object",
+            "properties": {
+                "allocation_percent": {
+                    "description": "AllocationPercent is the beneficiary's share of the account, in percent",
+                    "type": "number",
+                    "example": 60
+                },
+                "designated_at": {
+                    "type": "string"
+                },
+                "designated_by": {
+                    "description": "DesignatedBy is the staff ID that named the beneficiaries, or \"customer\"",
+                    "type": "string",
+                    "example": "customer"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Almaz Tesfaye"
+                },
+                "relationship": {
+                    "type": "string",
+                    "example": "spouse"
+                }
+            }
+        },
+        "main.BeneficiaryRequest": {
+            "description": "A beneficiary to name on a block account",
+            "type": "object",
+            "properties": {
+                "allocation_percent": {
+                    "type": "number",
+                    "maximum": 100,
+                    "example": 60
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 200,
+                    "example": "Almaz Tesfaye"
+                },
+                "relationship": {
+                    "type": "string",
+                    "maxLength": 50,
+                    "example": "spouse"
+                }
+            }
+        },
+        "main.BlockAccount": {
+            "description": "Block account information with interest calculations",
+            "type": "object",
+            "properties": {
+                "agreement_url": {
+                    "description": "AgreementURL is where the deposit agreement can be downloaded. It is\nreturned when the account is created.",
+                    "type": "string",
+                    "example": "/v2/block-account/01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f/agreement"
+                },
+                "closure": {
+                    "description": "Closure is how the account is settled once its holder closed it",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.AccountClosure"
+                        }
+                    ]
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "display": {
+                    "description": "Display is set when a display_currency was requested",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.DisplayAmounts"
+                        }
+                    ]
+                },
+                "end_date": {
+                    "type": "string"
+                },
+                "funding": {
+                    "description": "Funding is the debit that funded the account, if one was needed",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.Funding"
+                        }
+                    ]
+                },
+                "id": {
+                    "description": "ExternalID identifies the account in the API and in events",
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "interest_adjustment": {
+                    "description": "InterestAdjustment is the net of the approved corrections to the\naccount's interest, paid with the interest at maturity",
+                    "type": "number",
+                    "example": 12.5
+                },
+                "interest_paid_through": {
+                    "description": "InterestPaidThrough is the end of the last interest period paid out",
+                    "type": "string"
+                },
+                "interest_rate": {
+                    "type": "number",
+                    "example": 0.05
+                },
+                "maturity_instruction": {
+                    "description": "MaturityInstruction is what happens at end_date: \"payout\" or \"rollover\"",
+                    "type": "string",
+                    "example": "payout"
+                },
+                "next_payout_date": {
+                    "description": "NextPayoutDate is when the next interest payment before maturity is due",
+                    "type": "string"
+                },
+                "payout_destination": {
+                    "description": "PayoutDestination, like every account number in a response, is masked\nto its last four digits",
+                    "type": "string",
+                    "example": "*********6789"
+                },
+                "payout_frequency": {
+                    "description": "PayoutFrequency is how often interest is paid: \"monthly\", \"quarterly\" or \"at_maturity\"",
+                    "type": "string",
+                    "example": "at_maturity"
+                },
+                "period": {
+                    "type": "string",
+                    "example": "1y"
+                },
+                "possible_duplicate_of": {
+                    "description": "PossibleDuplicateOf is the ID of an identical account the user opened\nmoments before. It is returned when the account is created and\nDUPLICATE_ACCOUNT_ACTION is warn.",
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3e"
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 1000
+                },
+                "start_date": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "active"
+                },
+                "tenant_id": {
+                    "description": "TenantID is the tenant the account belongs to",
+                    "type": "string",
+                    "example": "default"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                },
+                "valuation": {
+                    "description": "Valuation is computed when an active or frozen account is read",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.AccountValuation"
+                        }
+                    ]
+                }
+            }
+        },
+        "main.BulkAccountRow": {
+            "description": "Existing deposit to load into a block account",
+            "type": "object",
+            "properties": {
+                "external_reference": {
+                    "description": "ExternalReference identifies the deposit in the source system and is echoed in the report",
+                    "type": "string",
+                    "example": "LEGACY-000412"
+                },
+                "interest_rate": {
+                    "description": "InterestRate is the rate the deposit was opened at. Defaults to the period's current rate.",
+                    "type": "number",
+                    "example": 0.045
+                },
+                "maturity_instruction": {
+                    "description": "MaturityInstruction defaults to \"payout\"",
+                    "type": "string",
+                    "example": "payout"
+                },
+                "payout_destination": {
+                    "type": "string",
+                    "example": "1000123456789"
+                },
+                "payout_frequency": {
+                    "description": "PayoutFrequency defaults to \"at_maturity\"",
+                    "type": "string",
+                    "example": "monthly"
+                },
+                "period": {
+                    "description": "\"3m\", \"6m\", \"1y\", \"3y\"",
+                    "type": "string",
+                    "example": "1y"
+                },
+                "principal": {
+                    "type": "number",
+                    "maximum": 1000000000000,
+                    "example": 25000
+                },
+                "start_date": {
+                    "description": "StartDate is when the deposit opened, as RFC 3339 or YYYY-MM-DD. Defaults to now.",
+                    "type": "string",
+                    "example": "2025-03-01"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                }
+            }
+        },
+        "main.BulkRowResult": {
+            "description": "Outcome of one row of a bulk import",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "invalid period: 2y"
+                },
+                "external_reference": {
+                    "type": "string",
+                    "example": "LEGACY-000412"
+                },
+                "row": {
+                    "description": "Row is the 1-based position of the row in the upload, not counting a CSV header",
+                    "type": "integer",
+                    "example": 1
+                },
+                "status": {
+                    "description": "Status is \"created\", \"invalid\" (the row was rejected) or \"failed\" (it could not be stored)",
+                    "type": "string",
+                    "example": "created"
+                }
+            }
+        },
+        "main.CacheStats": {
+            "description": "Read cache counters since the process started",
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "hit_ratio": {
+                    "type": "number",
+                    "example": 0.95
+                },
+                "hits": {
+                    "type": "integer",
+                    "example": 950
+                },
+                "invalidations": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "misses": {
+                    "type": "integer",
+                    "example": 50
+                }
+            }
+        },
+        "main.CloseAccountRequest": {
+            "description": "Where and how the final payout of a closed account is sent",
+            "type": "object",
+            "properties": {
+                "destination_account": {
+                    "type": "string",
+                    "maxLength": 64,
+                    "example": "1000123456789"
+                },
+                "method": {
+                    "description": "\"bank_transfer\" or \"internal_transfer\"",
+                    "type": "string",
+                    "enum": [
+                        "bank_transfer",
+                        "internal_transfer"
+                    ],
+                    "example": "bank_transfer"
+                }
+            }
+        },
+        "main.Communication": {
+            "description": "A notification, statement or certificate sent to the customer about a block account",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "channel": {
+                    "description": "Channel is the notification channel it was sent on, empty for the\ndefault notifier",
+                    "type": "string",
+                    "example": "email"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string",
+                    "example": "payout.failed"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "kind": {
+                    "type": "string",
+                    "example": "notification"
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "no phone number for user 123"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "We could not pay out block account 1: Rejected account number. Our team will contact you."
+                },
+                "priority": {
+                    "type": "string",
+                    "example": "critical"
+                },
+                "sent_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "sent"
+                },
+                "subject": {
+                    "type": "string",
+                    "example": "Your deposit payout could not be completed"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                }
+            }
+        },
+        "main.ComplianceFlag": {
+            "description": "Suspicious account activity awaiting or after compliance review",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "action": {
+                    "description": "Action is \"flagged\" when the activity went ahead and \"blocked\" when refused",
+                    "type": "string",
+                    "example": "blocked"
+                },
+                "client_ip": {
+                    "type": "string",
+                    "example": "203.0.113.7"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "user 123 tried to open 11 accounts within an hour; the limit is 10"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "last_seen_at": {
+                    "type": "string"
+                },
+                "occurrences": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "review_note": {
+                    "type": "string",
+                    "example": "Payroll batch from the employer portal"
+                },
+                "reviewed_at": {
+                    "type": "string"
+                },
+                "reviewed_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                },
+                "rule": {
+                    "type": "string",
+                    "example": "user_velocity"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "open"
+                },
+                "subject": {
+                    "description": "Subject is who tripped the rule, \"user:\u003cid\u003e\" or \"ip:\u003caddress\u003e\"",
+                    "type": "string",
+                    "example": "user:123"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                }
+            }
+        },
+        "main.CreateAccountRequest": {
+            "description": "Request payload for creating a new block account",
+            "type": "object",
+            "properties": {
+                "payout_frequency": {
+                    "description": "PayoutFrequency defaults to \"at_maturity\"",
+                    "type": "string",
+                    "example": "monthly"
+                },
+                "period": {
+                    "description": "Period is the code of the product to open, as listed by GET /products.\nProductCode may be sent in its place.",
+                    "type": "string",
+                    "example": "1y"
+                },
+                "principal": {
+                    "type": "number",
+                    "maximum": 1000000000000,
+                    "example": 1000
+                },
+                "product_code": {
+                    "type": "string",
+                    "example": "9m"
+                },
+                "settlement_account": {
+                    "description": "SettlementAccount is debited for the principal. Required when a funding provider is configured.",
+                    "type": "string",
+                    "example": "1000123456789"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                }
+            }
+        },
+        "main.CreateTenantRequest": {
+            "description": "Request payload for creating a tenant",
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string",
+                    "example": "acme"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "Acme Savings Bank"
+                }
+            }
+        },
+        "main.CreateWebhookRequest": {
+            "description": "Request payload for registering a webhook",
+            "type": "object",
+            "properties": {
+                "channel": {
+                    "description": "Channel defaults to \"account\"",
+                    "type": "string",
+                    "enum": [
+                        "account",
+                        "operations"
+                    ],
+                    "example": "account"
+                },
+                "events": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "account.created",
+                        "account.matured",
+                        "account.closed"
+                    ]
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/block-account"
+                }
+            }
+        },
+        "main.DailySummary": {
+            "description": "Accounts opened and matured and interest accrued during a business day",
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string",
+                    "example": "USD"
+                },
+                "date": {
+                    "type": "string",
+                    "example": "2025-06-30"
+                },
+                "interest_accrued": {
+                    "description": "InterestAccrued is what funded accounts earned during the day, paid or not",
+                    "type": "number",
+                    "example": 131.51
+                },
+                "matured_accounts": {
+                    "description": "MaturedAccounts reached their end date during the day and were matured",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.ReportTotals"
+                        }
+                    ]
+                },
+                "new_accounts": {
+                    "description": "NewAccounts were opened during the day, excluding failed fundings",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.ReportTotals"
+                        }
+                    ]
+                },
+                "timezone": {
+                    "type": "string",
+                    "example": "Africa/Addis_Ababa"
+                }
+            }
+        },
+        "main.Dashboard": {
+            "description": "Operational counters for dashboards",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "$ref": "#/definitions/main.DashboardAccounts"
+                },
+                "failed_jobs_24h": {
+                    "description": "FailedJobs counts jobs that failed in the last 24 hours",
+                    "type": "integer",
+                    "example": 0
+                },
+                "generated_at": {
+                    "type": "string"
+                },
+                "pending_approvals": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "queues": {
+                    "$ref": "#/definitions/main.DashboardQueues"
+                },
+                "region": {
+                    "description": "Region is set when REGION is, so dashboards show which region they poll",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.RegionStatus"
+                        }
+                    ]
+                }
+            }
+        },
+        "main.DashboardAccounts": {
+            "description": "Accounts in error or held states",
+            "type": "object",
+            "properties": {
+                "frozen": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "funding_failed": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "payout_failed": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "pending_funding": {
+                    "type": "integer",
+                    "example": 4
+                }
+            }
+        },
+        "main.DashboardQueues": {
+            "description": "Items waiting for a worker",
+            "type": "object",
+            "properties": {
+                "event_replays": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "jobs_queued": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "jobs_running": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "notifications": {
+                    "description": "Notifications is customer notifications not yet sent",
+                    "type": "integer",
+                    "example": 0
+                },
+                "outbox": {
+                    "description": "Outbox is events not yet published to the broker",
+                    "type": "integer",
+                    "example": 3
+                },
+                "webhook_deliveries": {
+                    "description": "WebhookDeliveries is deliveries pending a first attempt or a retry",
+                    "type": "integer",
+                    "example": 12
+                }
+            }
+        },
+        "main.DatabasePool": {
+            "description": "Database connection pool utilization",
+            "type": "object",
+            "properties": {
+                "idle": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "in_use": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "max_open": {
+                    "description": "MaxOpen is 0 when the pool is unbounded",
+                    "type": "integer",
+                    "example": 25
+                },
+                "open": {
+                    "type": "integer",
+                    "example": 8
+                },
+                "wait_count": {
+                    "description": "WaitCount is how many times a query waited for a free connection",
+                    "type": "integer",
+                    "example": 12
+                },
+                "wait_duration_ms": {
+                    "type": "number",
+                    "example": 87.5
+                }
+            }
+        },
+        "main.DependencyCheck": {
+            "description": "Status of one dependency of the instance",
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string",
+                    "example": "schema version 29"
+                },
+                "latency_ms": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "required": {
+                    "description": "Required checks make the instance unready when they fail; the others\nare reported only",
+                    "type": "boolean",
+                    "example": true
+                },
+                "status": {
+                    "description": "Status is \"ok\" or \"failing\"",
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
+        "main.DisplayAmounts": {
+            "description": "Amounts converted to a display currency, with the rate used",
+            "type": "object",
+            "properties": {
+                "amounts": {
+                    "description": "Amounts maps each converted field of the response to its converted value",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number",
+                        "format": "float64"
+                    }
+                },
+                "base_currency": {
+                    "type": "string",
+                    "example": "USD"
+                },
+                "currency": {
+                    "type": "string",
+                    "example": "EUR"
+                },
+                "rate": {
+                    "type": "number",
+                    "example": 0.92
+                },
+                "rate_as_of": {
+                    "type": "string"
+                },
+                "rate_source": {
+                    "type": "string",
+                    "example": "static"
+                }
+            }
+        },
+        "main.ErrorResponse": {
+            "description": "Standard error response format",
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code is the HTTP status",
+                    "type": "integer",
+                    "example": 400
+                },
+                "details": {
+                    "description": "Details are code-specific values, such as the limit a request broke",
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "error": {
+                    "type": "string",
+                    "example": "Bad Request"
+                },
+                "error_code": {
+                    "description": "ErrorCode is the machine-readable error from the catalog, e.g. ACCOUNT_NOT_FOUND",
+                    "type": "string",
+                    "example": "INVALID_PERIOD"
+                },
+                "fields": {
+                    "description": "Fields lists the request fields that failed validation",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.FieldError"
+                    }
+                },
+                "message": {
+                    "type": "string",
+                    "example": "invalid period: 5y. Valid options are: 3m, 6m, 1y, 3y"
+                }
+            }
+        },
+        "main.EventReplay": {
+            "description": "Progress of a replay of stored outbox events",
+            "type": "object",
+            "properties": {
+                "account_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                    ]
+                },
+                "completed_at": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "destination": {
+                    "$ref": "#/definitions/main.ReplayDestination"
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_outbox_id": {
+                    "description": "LastOutboxID is the replay's position; events up to it have been replayed",
+                    "type": "integer",
+                    "example": 99120
+                },
+                "replayed": {
+                    "description": "Replayed counts the events handed to the destination so far. Webhook\nreplays skip events the subscription does not listen to.",
+                    "type": "integer",
+                    "example": 1840
+                },
+                "requested_by": {
+                    "type": "string",
+                    "example": "ops-17"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "completed"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.EventReplayRequest": {
+            "description": "Request payload for replaying stored events. At least one of from, after_sequence or account_ids is required.",
+            "type": "object",
+            "properties": {
+                "account_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                    ]
+                },
+                "after_sequence": {
+                    "description": "AfterSequence starts the replay after this position in the event log,\nsuch as the last sequence a consumer processed before an outage",
+                    "type": "integer",
+                    "minimum": 0,
+                    "example": 98000
+                },
+                "destination": {
+                    "$ref": "#/definitions/main.ReplayDestination"
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "account.created",
+                        "account.matured"
+                    ]
+                },
+                "from": {
+                    "description": "From (inclusive) and To (exclusive) bound the events' creation time.\nTo defaults to, and is capped at, now.",
+                    "type": "string",
+                    "example": "2026-10-01T00:00:00Z"
+                },
+                "to": {
+                    "type": "string",
+                    "example": "2026-10-02T00:00:00Z"
+                }
+            }
+        },
+        "main.ExportedAccount": {
+            "description": "Block account as exported for analytics, one per NDJSON line",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "end_date": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "interest_adjustment": {
+                    "type": "number",
+                    "example": 0
+                },
+                "interest_paid_through": {
+                    "type": "string"
+                },
+                "interest_rate": {
+                    "type": "number",
+                    "example": 0.05
+                },
+                "maturity_instruction": {
+                    "type": "string",
+                    "example": "payout"
+                },
+                "next_payout_date": {
+                    "type": "string"
+                },
+                "payout_frequency": {
+                    "type": "string",
+                    "example": "at_maturity"
+                },
+                "period": {
+                    "type": "string",
+                    "example": "1y"
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 1000
+                },
+                "start_date": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "active"
+                },
+                "tenant_id": {
+                    "type": "string",
+                    "example": "default"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                }
+            }
+        },
+        "main.FeatureFlag": {
+            "description": "Who a feature is enabled for: everyone, listed tenants and a stable percentage of other traffic",
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string",
+                    "example": "The GraphQL endpoint"
+                },
+                "enabled": {
+                    "description": "Enabled turns the feature on for everyone",
+                    "type": "boolean",
+                    "example": false
+                },
+                "name": {
+                    "type": "string",
+                    "example": "graphql"
+                },
+                "rollout_percent": {
+                    "description": "RolloutPercent turns the feature on for a stable share of other\ntraffic, bucketed by tenant and X-User-ID, or by request without one",
+                    "type": "integer",
+                    "example": 10
+                },
+                "source": {
+                    "description": "Source is \"config\" for FEATURE_FLAGS or the built-in default and\n\"database\" when set through the admin API",
+                    "type": "string",
+                    "example": "database"
+                },
+                "tenants": {
+                    "description": "Tenants the feature is on for when it is not enabled for everyone",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "updated_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                }
+            }
+        },
+        "main.FeatureFlagRequest": {
+            "description": "Request payload setting who a feature is enabled for",
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "rollout_percent": {
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 0,
+                    "example": 10
+                },
+                "tenants": {
+                    "type": "array",
+                    "maxItems": 100,
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.FieldError": {
+            "description": "A request field that failed validation",
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "INVALID_PERIOD"
+                },
+                "field": {
+                    "type": "string",
+                    "example": "period"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "invalid period: 5y. Valid options are: 3m, 6m, 1y, 3y"
+                }
+            }
+        },
+        "main.Funding": {
+            "description": "Debit funding a block account from the customer's settlement account",
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "example": 1000
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "failure_reason": {
+                    "type": "string",
+                    "example": "insufficient funds"
+                },
+                "reference": {
+                    "type": "string",
+                    "example": "2f1c9a6e-8a0e-4d55-9a57-1d2a4c7f9b10"
+                },
+                "settled_at": {
+                    "type": "string"
+                },
+                "settlement_account": {
+                    "type": "string",
+                    "example": "*********6789"
+                },
+                "status": {
+                    "description": "Status is \"pending\", \"confirmed\", \"failed\" or \"expired\"",
+                    "type": "string",
+                    "example": "pending"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.GraphQLRequest": {
+            "description": "GraphQL query, with its operation name and variables",
+            "type": "object",
+            "properties": {
+                "operationName": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string",
+                    "example": "{ userAccounts(userId: 123) { id status upcomingPayouts { date amount } } }"
+                },
+                "variables": {
+                    "type": "object",
+                    "additionalProperties": {}
+                }
+            }
+        },
+        "main.HistoryEntry": {
+            "description": "An event in the life of a block account",
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "Amount is the money moved by a funding or payout, or credited by an\ninterest adjustment",
+                    "type": "number",
+                    "example": 4.11
+                },
+                "at": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "funding confirmed"
+                },
+                "from_status": {
+                    "type": "string",
+                    "example": "pending_funding"
+                },
+                "interest_accrued": {
+                    "description": "InterestAccrued is the interest earned so far, paid or not. It is\nomitted once the account has been closed.",
+                    "type": "number",
+                    "example": 4.25
+                },
+                "interest_paid": {
+                    "type": "number",
+                    "example": 4.11
+                },
+                "principal": {
+                    "description": "Principal and InterestPaid are the account's principal and the\ninterest paid on it so far",
+                    "type": "number",
+                    "example": 1000
+                },
+                "status": {
+                    "description": "Status is the account's status once the event happened",
+                    "type": "string",
+                    "example": "active"
+                },
+                "to_status": {
+                    "type": "string",
+                    "example": "active"
+                },
+                "type": {
+                    "description": "Type is \"status_change\", \"principal_change\", \"funding\",\n\"interest_payout\", \"interest_adjustment\" or \"maturity_payout\"",
+                    "type": "string",
+                    "example": "status_change"
+                },
+                "value_date": {
+                    "description": "ValueDate is when the event took effect, set when that was before the\nday it was booked on, At: the start date of an account value-dated or\nimported, or the value date of an interest adjustment",
+                    "type": "string"
+                }
+            }
+        },
+        "main.ImpersonationAccess": {
+            "description": "One request made with an impersonation session",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "method": {
+                    "type": "string",
+                    "example": "GET"
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/user/123/block-accounts"
+                },
+                "session_id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 200
+                }
+            }
+        },
+        "main.ImpersonationSession": {
+            "description": "Time-limited, read-only session in which support staff see the API as a customer. The token is only returned when the session starts.",
+            "type": "object",
+            "properties": {
+                "audit": {
+                    "description": "Audit lists the requests made with the session, oldest first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.ImpersonationAccess"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "ended_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "Ticket 8812: customer cannot see matured deposit"
+                },
+                "staff_id": {
+                    "type": "string",
+                    "example": "agent-42"
+                },
+                "staff_role": {
+                    "type": "string",
+                    "example": "support"
+                },
+                "tenant_id": {
+                    "description": "TenantID is the tenant whose customer is impersonated",
+                    "type": "string",
+                    "example": "default"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "9b1f0c..."
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                }
+            }
+        },
+        "main.InterestPayout": {
+            "description": "Interest paid on a block account for one accrual period",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "amount": {
+                    "type": "number",
+                    "example": 4.11
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "destination_account": {
+                    "type": "string",
+                    "example": "*********6789"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "period_end": {
+                    "type": "string"
+                },
+                "period_start": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "pending"
+                }
+            }
+        },
+        "main.IssueAPIKeyRequest": {
+            "description": "Request payload for issuing an API key",
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "core-banking-batch"
+                },
+                "scopes": {
+                    "description": "Scopes are any of read, write and admin. write includes read and admin includes both.",
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "read",
+                        "write"
+                    ]
+                },
+                "tenant_id": {
+                    "description": "TenantID ties the key to a tenant. Callers bound to a tenant can only\nissue keys for it; platform callers leave it empty for a platform key.",
+                    "type": "string",
+                    "example": "acme"
+                }
+            }
+        },
+        "main.Job": {
+            "description": "Status and progress of an asynchronous job",
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "cancel_requested": {
+                    "description": "CancelRequested is set while a running job winds down after a cancellation",
+                    "type": "boolean"
+                },
+                "completed_at": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "payload": {
+                    "description": "Payload is the job's input, specific to its type",
+                    "type": "object"
+                },
+                "progress": {
+                    "$ref": "#/definitions/main.JobProgress"
+                },
+                "region": {
+                    "description": "Region is set on a job only the workers of that region may run",
+                    "type": "string",
+                    "example": "eu-west"
+                },
+                "requested_by": {
+                    "type": "string",
+                    "example": "ops-17"
+                },
+                "result": {
+                    "description": "Result is set once the job succeeded, specific to its type",
+                    "type": "object"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "running"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "account_import"
+                }
+            }
+        },
+        "main.JobProgress": {
+            "type": "object",
+            "properties": {
+                "done": {
+                    "type": "integer",
+                    "example": 1500
+                },
+                "total": {
+                    "type": "integer",
+                    "example": 2500
+                }
+            }
+        },
+        "main.LoggedEvent": {
+            "description": "A domain event as stored in the event log, numbered by its position in it",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "0192a3b4-5c6d-7e8f-9a0b-1c2d3e4f5a6b"
+                },
+                "occurred_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "Payload is the event exactly as it was published",
+                    "type": "object"
+                },
+                "schema_version": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "sequence": {
+                    "description": "Sequence is the event's position in the log. It only grows, though a\ntransaction committing late can leave a gap that fills in later.",
+                    "type": "integer",
+                    "example": 99120
+                },
+                "tenant_id": {
+                    "type": "string",
+                    "example": "default"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "account.funded"
+                }
+            }
+        },
+        "main.MaturityBucket": {
+            "description": "Active accounts maturing in one day, week or month, with what they pay at maturity at their current rates",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "description": "Accounts is the number of accounts maturing in the bucket",
+                    "type": "integer",
+                    "example": 12
+                },
+                "end": {
+                    "description": "End is the bucket's last day, inclusive",
+                    "type": "string",
+                    "example": "2026-10-18"
+                },
+                "interest": {
+                    "description": "Interest is the interest they still pay at maturity, after interest\nadjustments and what periodic payouts already paid",
+                    "type": "number",
+                    "example": 6000
+                },
+                "payout_amount": {
+                    "description": "PayoutAmount is their principal plus interest: what maturity pays out",
+                    "type": "number",
+                    "example": 126000
+                },
+                "principal": {
+                    "description": "Principal is the principal they return",
+                    "type": "number",
+                    "example": 120000
+                },
+                "rollover_amount": {
+                    "description": "RolloverAmount is the part of PayoutAmount that rolls over into new\naccounts instead of leaving",
+                    "type": "number",
+                    "example": 42000
+                },
+                "start": {
+                    "description": "Start is the bucket's first day: the date itself, the Monday of the\nweek or the first of the month",
+                    "type": "string",
+                    "example": "2026-10-12"
+                }
+            }
+        },
+        "main.MaturityCalendar": {
+            "description": "Upcoming maturities of active accounts between two business dates, per day, week or month, for treasury planning",
+            "type": "object",
+            "properties": {
+                "buckets": {
+                    "description": "Buckets covers the window without gaps, earliest first; the first\nand last may start before From or end after To",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.MaturityBucket"
+                    }
+                },
+                "from": {
+                    "type": "string",
+                    "example": "2026-10-16"
+                },
+                "group_by": {
+                    "type": "string",
+                    "example": "week"
+                },
+                "to": {
+                    "type": "string",
+                    "example": "2027-01-14"
+                },
+                "total": {
+                    "description": "Total sums the buckets over the window",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.MaturityBucket"
+                        }
+                    ]
+                }
+            }
+        },
+        "main.MaturityInstructionRequest": {
+            "description": "Request payload for changing what happens to a block account at maturity",
+            "type": "object",
+            "properties": {
+                "destination_account": {
+                    "type": "string",
+                    "example": "1000123456789"
+                },
+                "instruction": {
+                    "description": "\"payout\" or \"rollover\"",
+                    "type": "string",
+                    "enum": [
+                        "payout",
+                        "rollover"
+                    ],
+                    "example": "payout"
+                }
+            }
+        },
+        "main.MaturityRunPreview": {
+            "description": "Dry run of a maturity run; nothing it shows was kept",
+            "type": "object",
+            "properties": {
+                "account_ids": {
+                    "description": "AccountIDs are the accounts that would mature, soonest due first",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "dry_run": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "matured": {
+                    "description": "Matured is how many accounts would mature, RolledOver of them into a\nnew deposit",
+                    "type": "integer",
+                    "example": 120
+                },
+                "payout_amount": {
+                    "description": "PayoutAmount is the total of the payouts that would be queued",
+                    "type": "number",
+                    "example": 254310.55
+                },
+                "rolled_over": {
+                    "type": "integer",
+                    "example": 35
+                },
+                "rollover_principal": {
+                    "description": "RolloverPrincipal is the total principal of the deposits that would\nbe opened",
+                    "type": "number",
+                    "example": 90422.1
+                },
+                "truncated": {
+                    "description": "Truncated is set when more accounts are due than a dry run evaluates;\nthe totals cover the first maturityDryRunLimit",
+                    "type": "boolean"
+                }
+            }
+        },
+        "main.MaturityWindow": {
+            "description": "Active accounts maturing within the next days",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "days": {
+                    "type": "integer",
+                    "example": 30
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 36000
+                }
+            }
+        },
+        "main.MuteNotificationsRequest": {
+            "description": "Request payload for muting an account's notifications",
+            "type": "object",
+            "required": [
+                "until"
+            ],
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500,
+                    "example": "Travelling until the end of the month"
+                },
+                "until": {
+                    "type": "string",
+                    "example": "2026-11-01T00:00:00Z"
+                }
+            }
+        },
+        "main.NotificationMute": {
+            "description": "A period in which an account's non-critical notifications are withheld",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "ended_at": {
+                    "description": "EndedAt is set when the mute was lifted before MutedUntil",
+                    "type": "string"
+                },
+                "ended_by": {
+                    "type": "string",
+                    "example": "customer"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "muted_by": {
+                    "description": "MutedBy is the staff ID that set the mute, or \"customer\"",
+                    "type": "string",
+                    "example": "customer"
+                },
+                "muted_until": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "Travelling until the end of the month"
+                }
+            }
+        },
+        "main.NotificationPreferences": {
+            "description": "A customer's notification channels, contact details and opt-outs",
+            "type": "object",
+            "properties": {
+                "channels": {
+                    "description": "Channels are delivered to in addition to each other; empty leaves\nnotices to the service's default notifier",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "email",
+                        "sms"
+                    ]
+                },
+                "disabled_events": {
+                    "description": "DisabledEvents are events the customer opted out of. Critical notices\ncannot be turned off.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "account.created"
+                    ]
+                },
+                "email": {
+                    "type": "string",
+                    "example": "customer@example.com"
+                },
+                "locale": {
+                    "description": "Locale is the language notices are written in, \"en\" or \"am\"",
+                    "type": "string",
+                    "example": "am"
+                },
+                "phone": {
+                    "type": "string",
+                    "example": "+251911000000"
+                },
+                "reminder_days": {
+                    "description": "ReminderDays is how many days before maturity the reminder is sent",
+                    "type": "integer",
+                    "example": 7
+                },
+                "updated_at": {
+                    "description": "UpdatedAt is omitted for customers who never set preferences",
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                }
+            }
+        },
+        "main.NotificationPreferencesRequest": {
+            "description": "Request payload for setting notification preferences",
+            "type": "object",
+            "properties": {
+                "channels": {
+                    "description": "\"email\", \"sms\", \"webhook\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "email",
+                        "sms"
+                    ]
+                },
+                "disabled_events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "account.created"
+                    ]
+                },
+                "email": {
+                    "type": "string",
+                    "example": "customer@example.com"
+                },
+                "locale": {
+                    "description": "Locale defaults to DEFAULT_LOCALE when omitted",
+                    "type": "string",
+                    "enum": [
+                        "en",
+                        "am"
+                    ],
+                    "example": "am"
+                },
+                "phone": {
+                    "type": "string",
+                    "example": "+251911000000"
+                },
+                "reminder_days": {
+                    "description": "ReminderDays defaults to the service default when omitted",
+                    "type": "integer",
+                    "example": 7
+                }
+            }
+        },
+        "main.Page": {
+            "description": "One page of a list. Pass next_cursor as the cursor query parameter for the next page.",
+            "type": "object",
+            "properties": {
+                "items": {},
+                "limit": {
+                    "type": "integer",
+                    "example": 50
+                },
+                "next_cursor": {
+                    "description": "NextCursor is left out on the last page",
+                    "type": "string",
+                    "example": "NTA"
+                }
+            }
+        },
+        "main.Payout": {
+            "description": "Maturity payout instruction and its delivery state",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "amount": {
+                    "type": "number",
+                    "example": 1050
+                },
+                "attempts": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "destination_account": {
+                    "type": "string",
+                    "example": "*********6789"
+                },
+                "failure_reason": {
+                    "type": "string",
+                    "example": "Rejected account number"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "status": {
+                    "type": "string",
+                    "example": "failed"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.PayoutFailureRequest": {
+            "description": "Request payload for reporting a failed payout",
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "example": "Rejected account number"
+                }
+            }
+        },
+        "main.PayoutSchedule": {
+            "description": "Interest paid so far and the upcoming payout dates of a block account",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "paid": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.InterestPayout"
+                    }
+                },
+                "payout_frequency": {
+                    "type": "string",
+                    "example": "monthly"
+                },
+                "upcoming": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.ScheduledPayout"
+                    }
+                }
+            }
+        },
+        "main.PeriodProjection": {
+            "description": "Interest liability of the active accounts of one period",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "change": {
+                    "type": "number",
+                    "example": 2500
+                },
+                "current_liability": {
+                    "type": "number",
+                    "example": 25000
+                },
+                "current_rate": {
+                    "description": "principal and term weighted average",
+                    "type": "number",
+                    "example": 0.05
+                },
+                "period": {
+                    "type": "string",
+                    "example": "1y"
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 500000
+                },
+                "scenario_liability": {
+                    "type": "number",
+                    "example": 27500
+                },
+                "scenario_rate": {
+                    "type": "number",
+                    "example": 0.055
+                }
+            }
+        },
+        "main.PortfolioStats": {
+            "description": "Aggregate portfolio statistics",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer",
+                    "example": 420
+                },
+                "average_rate": {
+                    "description": "AverageRate and WeightedAverageRate are over active accounts; the\nweighted average weighs each rate by the account's principal",
+                    "type": "number",
+                    "example": 0.052
+                },
+                "by_currency": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/main.StatsBucket"
+                    }
+                },
+                "by_period": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/main.StatsBucket"
+                    }
+                },
+                "by_status": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/main.StatsBucket"
+                    }
+                },
+                "computed_at": {
+                    "type": "string"
+                },
+                "currency": {
+                    "description": "Currency is the currency every amount is held in",
+                    "type": "string",
+                    "example": "USD"
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 1250000
+                },
+                "upcoming_maturities": {
+                    "description": "UpcomingMaturities covers the next 7, 30 and 90 days",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.MaturityWindow"
+                    }
+                },
+                "weighted_average_rate": {
+                    "type": "number",
+                    "example": 0.055
+                }
+            }
+        },
+        "main.PortfolioStatus": {
+            "description": "Accounts of a user in one status, with their principal and interest accrued",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "accrued_interest": {
+                    "description": "AccruedInterest is the interest earned to date by those accounts that\nstill earn it, active and frozen ones; 0 for other statuses",
+                    "type": "number",
+                    "example": 312.45
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 15000
+                }
+            }
+        },
+        "main.Product": {
+            "description": "Deposit product offered to a user",
+            "type": "object",
+            "properties": {
+                "early_withdrawal": {
+                    "description": "EarlyWithdrawal is \"allowed\", \"approval\" or \"not_allowed\"",
+                    "type": "string",
+                    "example": "allowed"
+                },
+                "min_principal": {
+                    "type": "number",
+                    "example": 500
+                },
+                "months": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "name": {
+                    "type": "string",
+                    "example": "1-year deposit"
+                },
+                "period": {
+                    "description": "Period is the product code, sent as period or product_code to open it",
+                    "type": "string",
+                    "example": "1y"
+                },
+                "pilot": {
+                    "description": "Pilot is set while the product is gated and only open to some users",
+                    "type": "boolean"
+                },
+                "rate": {
+                    "type": "number",
+                    "example": 0.05
+                }
+            }
+        },
+        "main.ProductComparison": {
+            "description": "Interest a principal would earn on each deposit product, shortest term first",
+            "type": "object",
+            "properties": {
+                "currency": {
+                    "type": "string",
+                    "example": "ETB"
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 10000
+                },
+                "products": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.ProductQuote"
+                    }
+                },
+                "quoted_at": {
+                    "description": "QuotedAt is the start date the maturities and interest are worked out from",
+                    "type": "string"
+                },
+                "withholding_rate": {
+                    "type": "number",
+                    "example": 0.05
+                }
+            }
+        },
+        "main.ProductDefinition": {
+            "description": "Deposit product definition: its term, built-in rate, minimum principal and early withdrawal rule",
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code is stored as the period of the accounts opened as the product",
+                    "type": "string",
+                    "example": "9m"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "early_withdrawal": {
+                    "description": "EarlyWithdrawal is \"allowed\", \"approval\" or \"not_allowed\"",
+                    "type": "string",
+                    "example": "allowed"
+                },
+                "min_principal": {
+                    "type": "number",
+                    "example": 500
+                },
+                "name": {
+                    "type": "string",
+                    "example": "9-month deposit"
+                },
+                "rate": {
+                    "description": "Rate is the built-in rate, offered unless a tenant sets its own",
+                    "type": "number",
+                    "example": 0.042
+                },
+                "retired_at": {
+                    "description": "RetiredAt is set once the product can no longer be opened",
+                    "type": "string"
+                },
+                "term_months": {
+                    "type": "integer",
+                    "example": 9
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "updated_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                }
+            }
+        },
+        "main.ProductDefinitionRequest": {
+            "description": "Request payload for creating or changing a deposit product",
+            "type": "object",
+            "properties": {
+                "early_withdrawal": {
+                    "description": "EarlyWithdrawal defaults to \"allowed\"",
+                    "type": "string",
+                    "enum": [
+                        "allowed",
+                        "approval",
+                        "not_allowed"
+                    ],
+                    "example": "approval"
+                },
+                "min_principal": {
+                    "type": "number",
+                    "minimum": 0,
+                    "example": 500
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "9-month deposit"
+                },
+                "rate": {
+                    "type": "number",
+                    "minimum": 0,
+                    "example": 0.042
+                },
+                "term_months": {
+                    "type": "integer",
+                    "maximum": 120,
+                    "minimum": 1,
+                    "example": 9
+                }
+            }
+        },
+        "main.ProductGate": {
+            "description": "Pilot gate restricting a deposit product to allowlisted users and a percentage rollout",
+            "type": "object",
+            "properties": {
+                "allowed_user_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "product": {
+                    "type": "string",
+                    "example": "3y"
+                },
+                "rollout_percent": {
+                    "description": "RolloutPercent opens the product to a stable share of all other users",
+                    "type": "integer",
+                    "example": 10
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "updated_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                }
+            }
+        },
+        "main.ProductGateRequest": {
+            "description": "Request payload for gating a deposit product",
+            "type": "object",
+            "properties": {
+                "allowed_user_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "rollout_percent": {
+                    "type": "integer",
+                    "maximum": 100,
+                    "minimum": 0,
+                    "example": 10
+                }
+            }
+        },
+        "main.ProductQuote": {
+            "description": "Rate, maturity date and interest of one deposit product for the compared principal",
+            "type": "object",
+            "properties": {
+                "early_withdrawal": {
+                    "description": "EarlyWithdrawal is \"allowed\", \"approval\" or \"not_allowed\"",
+                    "type": "string",
+                    "example": "allowed"
+                },
+                "eligible": {
+                    "description": "Eligible is false when the principal is below the product's minimum",
+                    "type": "boolean",
+                    "example": true
+                },
+                "gross_interest": {
+                    "description": "GrossInterest is the interest over the full term, before tax",
+                    "type": "number",
+                    "example": 500
+                },
+                "maturity_date": {
+                    "description": "MaturityDate is when an account opened now would mature",
+                    "type": "string"
+                },
+                "maturity_value": {
+                    "description": "MaturityValue is the principal with the net interest",
+                    "type": "number",
+                    "example": 10475
+                },
+                "min_principal": {
+                    "type": "number",
+                    "example": 500
+                },
+                "months": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "name": {
+                    "type": "string",
+                    "example": "1-year deposit"
+                },
+                "net_interest": {
+                    "type": "number",
+                    "example": 475
+                },
+                "period": {
+                    "description": "Period is the product code, sent as period or product_code to open it",
+                    "type": "string",
+                    "example": "1y"
+                },
+                "pilot": {
+                    "description": "Pilot is set while the product is gated and only open to some users",
+                    "type": "boolean"
+                },
+                "rate": {
+                    "type": "number",
+                    "example": 0.05
+                },
+                "tax_withheld": {
+                    "type": "number",
+                    "example": 25
+                }
+            }
+        },
+        "main.ProjectionRebuild": {
+            "description": "Outcome of a projection rebuild",
+            "type": "object",
+            "properties": {
+                "after_sequence": {
+                    "type": "integer",
+                    "example": 98000
+                },
+                "keys_dropped": {
+                    "description": "KeysDropped counts the read cache entries dropped",
+                    "type": "integer",
+                    "example": 1520
+                },
+                "previous_sequence": {
+                    "description": "PreviousSequence is where the notification cursor stood, and\nAfterSequence where it stands now; a cursor already behind\nafter_sequence is not moved",
+                    "type": "integer",
+                    "example": 99120
+                },
+                "projection": {
+                    "type": "string",
+                    "example": "notifications"
+                },
+                "requested_at": {
+                    "type": "string"
+                },
+                "requested_by": {
+                    "type": "string",
+                    "example": "ops-17"
+                }
+            }
+        },
+        "main.ProjectionRebuildRequest": {
+            "description": "Request payload for rebuilding a projection from the event log",
+            "type": "object",
+            "properties": {
+                "after_sequence": {
+                    "description": "AfterSequence is the last event the rebuilt notifications keep; later\nevents are read again. The read cache is always dropped whole.",
+                    "type": "integer",
+                    "minimum": 0,
+                    "example": 98000
+                },
+                "projection": {
+                    "type": "string",
+                    "enum": [
+                        "notifications",
+                        "read_cache"
+                    ],
+                    "example": "notifications"
+                }
+            }
+        },
+        "main.PromoteRegionRequest": {
+            "description": "Request payload for promoting this region to active",
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "example": "eu-west database unavailable"
+                }
+            }
+        },
+        "main.RateScenarioRequest": {
+            "description": "Hypothetical rate table to price against the current active portfolio",
+            "type": "object",
+            "properties": {
+                "rates": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number",
+                        "format": "float64"
+                    },
+                    "example": {
+                        "1y": 0.055
+                    }
+                }
+            }
+        },
+        "main.RateScenarioResult": {
+            "description": "Portfolio-wide interest liability under current and hypothetical rates",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer",
+                    "example": 1200
+                },
+                "change": {
+                    "type": "number",
+                    "example": 7500
+                },
+                "current_liability": {
+                    "type": "number",
+                    "example": 75000
+                },
+                "display": {
+                    "description": "Display is set when a display_currency was requested",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.DisplayAmounts"
+                        }
+                    ]
+                },
+                "generated_at": {
+                    "type": "string"
+                },
+                "periods": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.PeriodProjection"
+                    }
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 1500000
+                },
+                "scenario_liability": {
+                    "type": "number",
+                    "example": 82500
+                }
+            }
+        },
+        "main.Readiness": {
+            "description": "Whether the instance is ready to serve, with the status of each dependency and its region",
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "description": "Checks holds the result of each dependency check by name: database,\nmigrations, replication, and cache and workers when they apply",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/main.DependencyCheck"
+                    }
+                },
+                "ready": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "reason": {
+                    "description": "Reason is set when the instance is not ready",
+                    "type": "string",
+                    "example": "replication lag 45s exceeds 30s"
+                },
+                "region": {
+                    "$ref": "#/definitions/main.RegionStatus"
+                },
+                "workers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.WorkerStatus"
+                    }
+                }
+            }
+        },
+        "main.RecalculateInterestRequest": {
+            "description": "Request payload for re-deriving an account's interest from the rate plan",
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "example": "1y rate entered as 0.5% instead of 5%, case 3107"
+                },
+                "value_date": {
+                    "description": "ValueDate is when the plan's rate takes effect. Interest before it\nkeeps the account's rate. Defaults to the account's start date.",
+                    "type": "string",
+                    "example": "2026-03-01T00:00:00Z"
+                }
+            }
+        },
+        "main.RecalculationPreview": {
+            "description": "Dry run of an interest recalculation; nothing it shows was kept",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "adjustment": {
+                    "description": "Adjustment would be credited with the interest at maturity, or\ndebited when negative",
+                    "type": "number",
+                    "example": 41.1
+                },
+                "dry_run": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "interest_adjustment": {
+                    "description": "InterestAdjustment is the account's total adjustment afterwards",
+                    "type": "number",
+                    "example": 41.1
+                },
+                "previous_rate": {
+                    "type": "number",
+                    "example": 0.005
+                },
+                "rate": {
+                    "type": "number",
+                    "example": 0.05
+                }
+            }
+        },
+        "main.ReconciliationBreak": {
+            "description": "An account found out of balance by the nightly reconciliation",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "acknowledged_at": {
+                    "type": "string"
+                },
+                "acknowledged_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                },
+                "detected_at": {
+                    "type": "string"
+                },
+                "difference": {
+                    "description": "Difference is LedgerBalance - StoredBalance",
+                    "type": "number",
+                    "example": 5
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "last_seen_at": {
+                    "type": "string"
+                },
+                "ledger_balance": {
+                    "description": "LedgerBalance is Principal + PostedInterest - PaidOut",
+                    "type": "number",
+                    "example": 1050
+                },
+                "note": {
+                    "type": "string",
+                    "example": "Adjustment posted twice, reversal requested"
+                },
+                "occurrences": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "paid_out": {
+                    "description": "PaidOut is the periodic interest payments and the maturity payout\nunless it failed",
+                    "type": "number",
+                    "example": 0
+                },
+                "posted_interest": {
+                    "description": "PostedInterest is the interest paid out periodically, the interest\nadjustments recorded and, once the account matured, the interest it\naccrued since its last periodic payment",
+                    "type": "number",
+                    "example": 50
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 1000
+                },
+                "resolved_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "open"
+                },
+                "stored_balance": {
+                    "description": "StoredBalance is what the account's fields say it holds: its principal\nand interest adjustment, and nothing once its maturity payout is sent",
+                    "type": "number",
+                    "example": 1045
+                }
+            }
+        },
+        "main.RegionStatus": {
+            "description": "This instance's region, its role and how far its replica lags",
+            "type": "object",
+            "properties": {
+                "active_region": {
+                    "type": "string",
+                    "example": "eu-west"
+                },
+                "epoch": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "promoted_at": {
+                    "type": "string"
+                },
+                "promoted_by": {
+                    "type": "string",
+                    "example": "ops-17"
+                },
+                "region": {
+                    "type": "string",
+                    "example": "eu-west"
+                },
+                "replication_lag_seconds": {
+                    "type": "number",
+                    "example": 0.4
+                },
+                "role": {
+                    "description": "Role is \"active\" or \"standby\"",
+                    "type": "string",
+                    "example": "active"
+                }
+            }
+        },
+        "main.ReplayDestination": {
+            "description": "Where replayed events are sent: the broker, optionally on another topic, or one webhook subscription",
+            "type": "object",
+            "properties": {
+                "topic": {
+                    "description": "Topic overrides KAFKA_TOPIC, or NATS_SUBJECT on NATS, for a broker replay",
+                    "type": "string",
+                    "example": "block-account-events-replay"
+                },
+                "type": {
+                    "type": "string",
+                    "enum": [
+                        "broker",
+                        "webhook"
+                    ],
+                    "example": "broker"
+                },
+                "webhook_id": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "main.Report": {
+            "description": "A generated operations report",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "date": {
+                    "type": "string",
+                    "example": "2025-06-30"
+                },
+                "document_key": {
+                    "description": "DocumentKey is where the rendered report was kept in the object store",
+                    "type": "string",
+                    "example": "reports/daily_summary/2025-06-30.txt"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "recipients": {
+                    "description": "Recipients were emailed the report",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "requested_by": {
+                    "type": "string",
+                    "example": "scheduler"
+                },
+                "summary": {
+                    "$ref": "#/definitions/main.DailySummary"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "daily_summary"
+                }
+            }
+        },
+        "main.ReportTotals": {
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 48000
+                }
+            }
+        },
+        "main.RetryPayoutRequest": {
+            "description": "Request payload for retrying or redirecting a failed payout",
+            "type": "object",
+            "properties": {
+                "destination_account": {
+                    "type": "string",
+                    "example": "1000987654321"
+                }
+            }
+        },
+        "main.ReviewComplianceFlagRequest": {
+            "description": "Outcome of a compliance review",
+            "type": "object",
+            "properties": {
+                "note": {
+                    "type": "string",
+                    "maxLength": 1000,
+                    "example": "Payroll batch from the employer portal"
+                },
+                "status": {
+                    "description": "Status is \"cleared\" for legitimate activity or \"escalated\" for a case",
+                    "type": "string",
+                    "enum": [
+                        "cleared",
+                        "escalated"
+                    ],
+                    "example": "cleared"
+                }
+            }
+        },
+        "main.RotateAPIKeyRequest": {
+            "description": "Request payload for rotating an API key",
+            "type": "object",
+            "properties": {
+                "grace_period": {
+                    "description": "GracePeriod is how long the old secret keeps working, up to 168h. Defaults to 24h; \"0s\" ends it at once.",
+                    "type": "string",
+                    "example": "24h"
+                }
+            }
+        },
+        "main.RuleViolationResponse": {
+            "description": "Error response naming the business rule a request broke",
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer",
+                    "example": 422
+                },
+                "details": {
+                    "type": "object",
+                    "additionalProperties": {}
+                },
+                "error": {
+                    "type": "string",
+                    "example": "Unprocessable Entity"
+                },
+                "error_code": {
+                    "description": "ErrorCode is always LIMIT_EXCEEDED; Details repeat the rule and limit",
+                    "type": "string",
+                    "example": "LIMIT_EXCEEDED"
+                },
+                "limit": {
+                    "type": "number",
+                    "example": 250000
+                },
+                "message": {
+                    "type": "string",
+                    "example": "principal would bring the user's total above 250000.00"
+                },
+                "rule": {
+                    "type": "string",
+                    "example": "max_total_principal"
+                }
+            }
+        },
+        "main.RuntimeDiagnostics": {
+            "description": "Goroutines, memory, garbage collection, database pool and worker queue depths of the serving process",
+            "type": "object",
+            "properties": {
+                "database": {
+                    "$ref": "#/definitions/main.DatabasePool"
+                },
+                "gc": {
+                    "$ref": "#/definitions/main.RuntimeGC"
+                },
+                "generated_at": {
+                    "type": "string"
+                },
+                "gomaxprocs": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "goroutines": {
+                    "type": "integer",
+                    "example": 57
+                },
+                "memory": {
+                    "$ref": "#/definitions/main.RuntimeMemory"
+                },
+                "queues": {
+                    "$ref": "#/definitions/main.DashboardQueues"
+                },
+                "uptime_seconds": {
+                    "description": "UptimeSeconds is how long the process has been running",
+                    "type": "integer",
+                    "example": 86400
+                }
+            }
+        },
+        "main.RuntimeGC": {
+            "description": "Garbage collector statistics",
+            "type": "object",
+            "properties": {
+                "cpu_fraction": {
+                    "description": "CPUFraction is the share of the CPU time available to the process used by the collector",
+                    "type": "number",
+                    "example": 0.0012
+                },
+                "cycles": {
+                    "type": "integer",
+                    "example": 152
+                },
+                "last_pause_ms": {
+                    "type": "number",
+                    "example": 0.21
+                },
+                "last_run_at": {
+                    "type": "string"
+                },
+                "next_gc_bytes": {
+                    "type": "integer",
+                    "example": 25165824
+                },
+                "pause_total_ms": {
+                    "type": "number",
+                    "example": 41.7
+                }
+            }
+        },
+        "main.RuntimeMemory": {
+            "description": "Heap and memory obtained from the OS",
+            "type": "object",
+            "properties": {
+                "heap_alloc_bytes": {
+                    "type": "integer",
+                    "example": 12582912
+                },
+                "heap_inuse_bytes": {
+                    "type": "integer",
+                    "example": 16777216
+                },
+                "heap_objects": {
+                    "type": "integer",
+                    "example": 84211
+                },
+                "sys_bytes": {
+                    "description": "SysBytes is all the memory obtained from the OS",
+                    "type": "integer",
+                    "example": 33554432
+                }
+            }
+        },
+        "main.SandboxClock": {
+            "description": "The sandbox's clock, which account terms, accrual and maturities follow",
+            "type": "object",
+            "properties": {
+                "now": {
+                    "description": "Now is the time on the sandbox's clock",
+                    "type": "string"
+                },
+                "offset_seconds": {
+                    "description": "OffsetSeconds is how far it runs ahead of real time",
+                    "type": "integer",
+                    "example": 2592000
+                }
+            }
+        },
+        "main.SandboxKeyRequest": {
+            "description": "Request payload for a self-service sandbox API key",
+            "type": "object",
+            "properties": {
+                "name": {
+                    "description": "Name identifies the integration, e.g. the partner and app",
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "acme-payroll-dev"
+                }
+            }
+        },
+        "main.ScheduledJob": {
+            "description": "A periodic job run by ` + "`" + `worker scheduler` + "`" + `: its cron schedule, whether it is paused, and its last and next runs",
+            "type": "object",
+            "properties": {
+                "job": {
+                    "type": "string",
+                    "example": "maturity"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_finished_at": {
+                    "type": "string"
+                },
+                "last_started_at": {
+                    "type": "string"
+                },
+                "last_status": {
+                    "type": "string",
+                    "enum": [
+                        "succeeded",
+                        "failed"
+                    ],
+                    "example": "succeeded"
+                },
+                "next_run_at": {
+                    "type": "string"
+                },
+                "paused": {
+                    "description": "Paused jobs are not run on their schedule, only when triggered",
+                    "type": "boolean",
+                    "example": false
+                },
+                "paused_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                },
+                "running_since": {
+                    "description": "RunningSince is set while the job runs",
+                    "type": "string"
+                },
+                "schedule": {
+                    "description": "Schedule is the cron expression, in BUSINESS_TIMEZONE, the scheduler\nlast started with; empty until a scheduler has run",
+                    "type": "string",
+                    "example": "* * * * *"
+                },
+                "trigger_requested_at": {
+                    "description": "TriggerRequestedAt is set while a triggered run waits to start",
+                    "type": "string"
+                },
+                "trigger_requested_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.ScheduledPayout": {
+            "description": "Upcoming interest or maturity payment",
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number",
+                    "example": 4.11
+                },
+                "date": {
+                    "type": "string"
+                },
+                "interest": {
+                    "type": "number",
+                    "example": 4.11
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 0
+                },
+                "type": {
+                    "description": "Type is \"interest\" for a periodic payment or \"maturity\" for the final one",
+                    "type": "string",
+                    "example": "interest"
+                }
+            }
+        },
+        "main.ServiceStatus": {
+            "description": "Public operational summary of the service",
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "dependencies": {
+                    "description": "Dependencies reports whether each dependency is reachable. The cache is\nonly listed when it is enabled.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "boolean"
+                    }
+                },
+                "last_maturity_run_at": {
+                    "description": "LastMaturityRunAt is when the maturity worker last completed a run",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status is \"operational\", \"degraded\" or \"major_outage\"",
+                    "type": "string",
+                    "example": "operational"
+                },
+                "uptime_seconds": {
+                    "type": "integer",
+                    "example": 86400
+                }
+            }
+        },
+        "main.SpecDigest": {
+            "description": "Content hash of the OpenAPI document",
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string",
+                    "example": "sha256"
+                },
+                "digest": {
+                    "description": "Digest is the hex-encoded hash of the document's bytes",
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "etag": {
+                    "description": "ETag is the entity tag /swagger/doc.json is served with",
+                    "type": "string",
+                    "example": "\"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\""
+                },
+                "last_modified": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 48213
+                }
             }
         },
-        "main.CreateAccountRequest": {
-            "description": "Request payload for creating a new block account",
+        "main.StartImpersonationRequest": {
+            "description": "Request payload for starting a read-only impersonation session",
+            "type": "object",
+            "properties": {
+                "duration_minutes": {
+                    "description": "1-60, default 15",
+                    "type": "integer",
+                    "example": 15
+                },
+                "reason": {
+                    "type": "string",
+                    "example": "Ticket 8812: customer cannot see matured deposit"
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                }
+            }
+        },
+        "main.StatsBucket": {
+            "description": "Count, principal and average rate of a group of accounts",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "average_rate": {
+                    "description": "AverageRate is the plain mean of the accounts' interest rates",
+                    "type": "number",
+                    "example": 0.05
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 125000
+                }
+            }
+        },
+        "main.SuccessResponse": {
+            "description": "Standard success response format",
+            "type": "object",
+            "properties": {
+                "data": {},
+                "message": {
+                    "type": "string",
+                    "example": "Operation completed successfully"
+                },
+                "success": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "main.TaxCertificate": {
+            "description": "Annual summary of interest earned and tax withheld across a user's block accounts",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.TaxCertificateLine"
+                    }
+                },
+                "display": {
+                    "description": "Display is set when a display_currency was requested",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.DisplayAmounts"
+                        }
+                    ]
+                },
+                "generated_at": {
+                    "type": "string"
+                },
+                "net_interest": {
+                    "type": "number",
+                    "example": 47.5
+                },
+                "total_interest": {
+                    "type": "number",
+                    "example": 50
+                },
+                "total_tax_withheld": {
+                    "type": "number",
+                    "example": 2.5
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                },
+                "withholding_rate": {
+                    "type": "number",
+                    "example": 0.05
+                },
+                "year": {
+                    "type": "integer",
+                    "example": 2024
+                }
+            }
+        },
+        "main.TaxCertificateLine": {
+            "description": "Interest earned and tax withheld on one block account within the tax year",
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "beneficiaries": {
+                    "description": "Beneficiaries are the account's beneficiaries as the certificate is issued",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.Beneficiary"
+                    }
+                },
+                "interest_earned": {
+                    "type": "number",
+                    "example": 50
+                },
+                "interest_rate": {
+                    "type": "number",
+                    "example": 0.05
+                },
+                "principal": {
+                    "type": "number",
+                    "example": 1000
+                },
+                "tax_withheld": {
+                    "type": "number",
+                    "example": 2.5
+                }
+            }
+        },
+        "main.Tenant": {
+            "description": "Institution whose accounts, configuration and requests are isolated from other tenants",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "acme"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Acme Savings Bank"
+                }
+            }
+        },
+        "main.TenantRate": {
+            "description": "Interest rate of a period in the caller's tenant's rate plan",
+            "type": "object",
+            "properties": {
+                "custom": {
+                    "description": "Custom is set when the tenant set its own rate",
+                    "type": "boolean"
+                },
+                "default_rate": {
+                    "description": "DefaultRate is the period's built-in rate, offered unless the tenant\nsets its own",
+                    "type": "number",
+                    "example": 0.05
+                },
+                "period": {
+                    "type": "string",
+                    "example": "1y"
+                },
+                "rate": {
+                    "type": "number",
+                    "example": 0.045
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "updated_by": {
+                    "type": "string",
+                    "example": "staff-42"
+                }
+            }
+        },
+        "main.TenantRateRequest": {
+            "description": "Request payload for setting the interest rate of a period",
+            "type": "object",
+            "properties": {
+                "rate": {
+                    "type": "number",
+                    "minimum": 0,
+                    "example": 0.045
+                }
+            }
+        },
+        "main.UserPortfolio": {
+            "description": "A user's block accounts summed up: what they hold, earn and when the next one matures",
+            "type": "object",
+            "properties": {
+                "accounts": {
+                    "description": "Accounts counts every account of the user, in any status",
+                    "type": "integer",
+                    "example": 3
+                },
+                "by_status": {
+                    "description": "ByStatus sums the accounts in each status the user has one in",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/main.PortfolioStatus"
+                    }
+                },
+                "currency": {
+                    "type": "string",
+                    "example": "ETB"
+                },
+                "display": {
+                    "description": "Display is set when a display_currency was requested",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.DisplayAmounts"
+                        }
+                    ]
+                },
+                "next_maturity_account_id": {
+                    "type": "string",
+                    "example": "01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"
+                },
+                "next_maturity_date": {
+                    "description": "NextMaturityDate is the earliest end date among them, omitted when\nthere are none",
+                    "type": "string"
+                },
+                "total_accrued_interest": {
+                    "type": "number",
+                    "example": 312.45
+                },
+                "total_principal": {
+                    "description": "TotalPrincipal, TotalAccruedInterest and WeightedAverageRate cover the\naccounts still earning interest, active and frozen ones",
+                    "type": "number",
+                    "example": 15000
+                },
+                "user_id": {
+                    "type": "integer",
+                    "example": 123
+                },
+                "valued_at": {
+                    "description": "ValuedAt is the instant the interest is accrued to, as for an\naccount's valuation",
+                    "type": "string"
+                },
+                "weighted_average_rate": {
+                    "description": "WeightedAverageRate is the rate of those accounts weighted by principal",
+                    "type": "number",
+                    "example": 0.0567
+                }
+            }
+        },
+        "main.ValueDatedAccountRequest": {
+            "description": "Request payload for booking a block account with a value date in the past, for migrations and corrections",
             "type": "object",
             "required": [
                 "period",
-                "principal",
-                "user_id"
+                "value_date"
             ],
             "properties": {
+                "payout_frequency": {
+                    "description": "PayoutFrequency defaults to \"at_maturity\"",
+                    "type": "string",
+                    "example": "monthly"
+                },
                 "period": {
-                    "description": "\"3m\", \"6m\", \"1y\", \"3y\"",
                     "type": "string",
                     "example": "1y"
                 },
                 "principal": {
                     "type": "number",
+                    "maximum": 1000000000000,
                     "example": 1000
                 },
+                "reason": {
+                    "type": "string",
+                    "example": "Deposit opened at branch 12 during the outage, case 3120"
+                },
                 "user_id": {
                     "type": "integer",
                     "example": 123
+                },
+                "value_date": {
+                    "description": "ValueDate is when the deposit opened: its start date, from which\ninterest accrues and its term is counted",
+                    "type": "string",
+                    "example": "2026-03-01T00:00:00Z"
                 }
             }
         },
-        "main.ErrorResponse": {
-            "description": "Standard error response format",
+        "main.Webhook": {
+            "description": "Callback URL subscribed to account lifecycle or operational events. The secret is only returned on creation.",
             "type": "object",
             "properties": {
-                "code": {
+                "active": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "channel": {
+                    "description": "Channel is \"account\" for lifecycle events or \"operations\" for operational events",
+                    "type": "string",
+                    "example": "account"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "account.created",
+                        "account.matured"
+                    ]
+                },
+                "id": {
                     "type": "integer",
-                    "example": 400
+                    "example": 1
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "4f1c9e0b..."
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/block-account"
+                }
+            }
+        },
+        "main.WebhookAttempt": {
+            "description": "One HTTP call made to deliver a webhook",
+            "type": "object",
+            "properties": {
+                "attempt": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "attempted_at": {
+                    "type": "string"
+                },
+                "delivery_id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "duration_ms": {
+                    "type": "integer",
+                    "example": 120
                 },
                 "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "status_code": {
+                    "type": "integer",
+                    "example": 200
+                }
+            }
+        },
+        "main.WebhookDelivery": {
+            "description": "Delivery of one event to one webhook and its attempts so far",
+            "type": "object",
+            "properties": {
+                "attempt_log": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.WebhookAttempt"
+                    }
+                },
+                "attempts": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "event_id": {
                     "type": "string",
-                    "example": "Bad Request"
+                    "example": "0b0e0a52-1f7b-4a1f-9a56-3c3f0f1f2a6b"
                 },
-                "message": {
+                "event_type": {
+                    "type": "string",
+                    "example": "account.created"
+                },
+                "id": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "unexpected status 503 Service Unavailable"
+                },
+                "last_status_code": {
+                    "type": "integer",
+                    "example": 503
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "status": {
                     "type": "string",
-                    "example": "Invalid request body"
+                    "example": "failed"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "webhook_id": {
+                    "type": "integer",
+                    "example": 1
                 }
             }
         },
-        "main.SuccessResponse": {
-            "description": "Standard success response format",
+        "main.WorkerStatus": {
+            "description": "When a background worker last finished a run",
             "type": "object",
             "properties": {
-                "data": {},
-                "message": {
+                "instance": {
                     "type": "string",
-                    "example": "Operation completed successfully"
+                    "example": "worker-6f9c7/1"
                 },
-                "success": {
+                "interval_seconds": {
+                    "type": "number",
+                    "example": 60
+                },
+                "last_beat_at": {
+                    "type": "string"
+                },
+                "last_run_failed": {
                     "type": "boolean",
-                    "example": true
+                    "example": false
+                },
+                "stale": {
+                    "description": "Stale is set when the worker has not finished a run for three of its\nintervals and a minute",
+                    "type": "boolean",
+                    "example": false
+                },
+                "worker": {
+                    "type": "string",
+                    "example": "maturity"
                 }
             }
         }
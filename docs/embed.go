@@ -0,0 +1,10 @@
+package docs
+
+import _ "embed"
+
+// SwaggerJSON is the OpenAPI document swag generates next to this file,
+// compiled into the binary so it is served whatever the working directory.
+// `go generate` in the module root regenerates it.
+//
+//go:embed swagger.json
+var SwaggerJSON []byte
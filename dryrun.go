@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+)
+
+// dryRunKey marks a context whose repository writes are rolled back
+const dryRunKey ctxKey = "dryRun"
+
+// withDryRun returns ctx marked as a dry run. The repository methods that
+// serve dry runs, CreateAccounts, MatureDue and AdjustInterest, then do
+// everything they would and roll back instead of committing.
+func withDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey, true)
+}
+
+// isDryRun reports whether ctx is a dry run
+func isDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey).(bool)
+	return dryRun
+}
+
+// commit commits tx, or rolls it back when ctx is a dry run
+func commit(ctx context.Context, tx *sql.Tx) error {
+	if isDryRun(ctx) {
+		return tx.Rollback()
+	}
+	return tx.Commit()
+}
+
+// dryRunParam reads r's dry_run query parameter. It writes a 400 and
+// returns false when the parameter is not true or false.
+func dryRunParam(w http.ResponseWriter, r *http.Request) (dryRun, ok bool) {
+	switch r.URL.Query().Get("dry_run") {
+	case "", "false":
+		return false, true
+	case "true":
+		return true, true
+	}
+	writeError(w, http.StatusBadRequest, "dry_run must be true or false")
+	return false, false
+}
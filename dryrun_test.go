@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// decodeData decodes the data of a success response into out
+func decodeData(t *testing.T, body []byte, out any) {
+	t.Helper()
+	var env struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &env); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		t.Fatalf("decode data: %v", err)
+	}
+}
+
+func TestBulkCreateDryRun(t *testing.T) {
+	api := newTestAPI(t)
+
+	w := api.do(http.MethodPost, "/v2/block-account/bulk?dry_run=true",
+		`[{"user_id":9,"principal":100,"period":"3m"},{"user_id":9,"principal":250.5,"period":"1y"},{"user_id":9,"principal":10,"period":"2y"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run: %d %s", w.Code, w.Body)
+	}
+	var imp AccountImport
+	decodeData(t, w.Body.Bytes(), &imp)
+	if !imp.DryRun || imp.Created != 2 || imp.Failed != 1 || imp.Principal != 350.5 {
+		t.Errorf("dry run = %+v, want 2 of 3 created for 350.50", imp)
+	}
+	if imp.Results[0].AccountID == "" {
+		t.Error("dry run reports no account IDs")
+	}
+
+	accounts, err := api.repo.ListAccountsByUser(context.Background(), 9)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(accounts) != 0 {
+		t.Errorf("dry run kept %d accounts", len(accounts))
+	}
+}
+
+func TestRecalculateDryRun(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(10)
+	if w := api.do(http.MethodPut, "/v2/admin/rates/1y", `{"rate":0.045}`); w.Code != http.StatusOK {
+		t.Fatalf("set rate: %d %s", w.Code, w.Body)
+	}
+
+	w := api.do(http.MethodPost, "/v2/admin/block-account/"+id+"/recalculate?dry_run=true", `{"reason":"Rate plan changed"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run: %d %s", w.Code, w.Body)
+	}
+	var preview RecalculationPreview
+	decodeData(t, w.Body.Bytes(), &preview)
+	if !preview.DryRun || preview.AccountID != id || preview.PreviousRate != 0.05 || preview.Rate != 0.045 {
+		t.Errorf("preview = %+v, want %s going from 5%% to 4.5%%", preview, id)
+	}
+
+	var account BlockAccount
+	decodeData(t, api.do(http.MethodGet, "/v2/block-account/"+id, "").Body.Bytes(), &account)
+	if account.InterestRate != 0.05 {
+		t.Errorf("rate after the dry run = %v, want 0.05", account.InterestRate)
+	}
+	var approvals struct {
+		Items []*Approval `json:"items"`
+	}
+	decodeData(t, api.do(http.MethodGet, "/v2/admin/approvals", "").Body.Bytes(), &approvals)
+	if len(approvals.Items) != 0 {
+		t.Errorf("dry run requested %d approvals", len(approvals.Items))
+	}
+}
+
+func TestMaturityRunDryRun(t *testing.T) {
+	api := newTestAPI(t)
+	start := time.Now().UTC().AddDate(-1, 0, -1)
+	payout := mustCreate(t, api.repo, testAccount(11, start))
+	rollover := testAccount(11, start)
+	rollover.MaturityInstruction = InstructionRollover
+	rollover = mustCreate(t, api.repo, rollover)
+	mustCreate(t, api.repo, testAccount(11, time.Now().UTC()))
+
+	w := api.do(http.MethodPost, "/v2/admin/maturity/run?dry_run=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run: %d %s", w.Code, w.Body)
+	}
+	var preview MaturityRunPreview
+	decodeData(t, w.Body.Bytes(), &preview)
+	if !preview.DryRun || preview.Matured != 2 || preview.RolledOver != 1 || preview.Truncated {
+		t.Errorf("preview = %+v, want 2 matured, 1 rolled over", preview)
+	}
+	if preview.PayoutAmount <= payout.Principal || preview.RolloverPrincipal <= rollover.Principal {
+		t.Errorf("preview = %+v, want the principal and interest paid out and rolled over", preview)
+	}
+	for _, a := range []*BlockAccount{payout, rollover} {
+		if !slices.Contains(preview.AccountIDs, a.ExternalID) {
+			t.Errorf("preview leaves out %s", a.ExternalID)
+		}
+		got, err := api.repo.GetAccount(context.Background(), a.ID)
+		if err != nil || got.Status != StatusActive {
+			t.Errorf("account %d after the dry run = %+v, %v; want active", a.ID, got, err)
+		}
+	}
+	accounts, _ := api.repo.ListAccountsByUser(context.Background(), 11)
+	if len(accounts) != 3 {
+		t.Errorf("user has %d accounts after the dry run, want the 3 it had", len(accounts))
+	}
+}
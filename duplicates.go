@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DuplicateAccountWarn opens a duplicate account, pointing the response at
+// the account it repeats, rather than refusing it
+const DuplicateAccountWarn = "warn"
+
+// DuplicateAccount is returned when a user opens an account with the same
+// principal and product as one they opened within the duplicate window,
+// usually because a form was submitted twice
+type DuplicateAccount struct {
+	Existing *BlockAccount
+}
+
+func (d *DuplicateAccount) Error() string {
+	return fmt.Sprintf("an identical account %s was opened at %s; a second one can be opened from %s",
+		d.Existing.ExternalID, d.Existing.CreatedAt.UTC().Format(time.RFC3339),
+		d.Existing.CreatedAt.Add(duplicateAccountWindow()).UTC().Format(time.RFC3339))
+}
+
+// apiError returns the refusal with the existing account in its details
+func (d *DuplicateAccount) apiError() *APIError {
+	return &APIError{Code: CodeDuplicateAccount, Message: d.Error(), Details: map[string]any{
+		"account_id": d.Existing.ExternalID,
+		"location":   accountLocation(d.Existing.ExternalID),
+		"created_at": d.Existing.CreatedAt.UTC().Format(time.RFC3339),
+	}}
+}
+
+// duplicateAccountWindow returns DUPLICATE_ACCOUNT_WINDOW, how long after
+// opening an account an identical one is taken for a duplicate. It is 0,
+// and the check off, when unset.
+func duplicateAccountWindow() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("DUPLICATE_ACCOUNT_WINDOW")); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// duplicatesSince returns how far back to look for an account the new one
+// duplicates, or the zero time when the check is off. Windows are on the
+// deployment's clock, as are the accounts' creation times.
+func (s *service) duplicatesSince() time.Time {
+	window := duplicateAccountWindow()
+	if window == 0 {
+		return time.Time{}
+	}
+	return s.Now().Add(-window)
+}
+
+// checkDuplicateAccount is passed the account CreateAccount found the user
+// opened within the window with the same principal and product, under the
+// lock on the user, so of two identical creates racing the second sees the
+// first. It returns a *DuplicateAccount for one, unless
+// DUPLICATE_ACCOUNT_ACTION is warn, in which case it returns the account so
+// the new one can point at it.
+func (s *service) checkDuplicateAccount(ctx context.Context, existing *BlockAccount) (*BlockAccount, error) {
+	if existing == nil {
+		return nil, nil
+	}
+	s.log(ctx).Warn("Duplicate account creation", zap.Int("userID", existing.UserID), zap.String("existing", existing.ExternalID),
+		zap.Float64("principal", existing.Principal), zap.String("period", existing.Period))
+	if os.Getenv("DUPLICATE_ACCOUNT_ACTION") == DuplicateAccountWarn {
+		return existing, nil
+	}
+	return nil, &DuplicateAccount{Existing: existing}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestDuplicateAccounts(t *testing.T) {
+	t.Setenv("DUPLICATE_ACCOUNT_WINDOW", "1m")
+	api := newTestAPI(t)
+	const body = `{"user_id":31,"principal":500,"period":"6m"}`
+
+	api.createAccount(31)
+	w := api.do(http.MethodPost, "/v2/block-account", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("different principal: %d %s", w.Code, w.Body)
+	}
+	var opened struct {
+		ID string `json:"id"`
+	}
+	decodeData(t, w.Body.Bytes(), &opened)
+
+	// The same principal and product again is refused, naming the account
+	w = api.do(http.MethodPost, "/v2/block-account", body)
+	if w.Code != http.StatusConflict || errorCode(w) != CodeDuplicateAccount {
+		t.Fatalf("duplicate: %d %s", w.Code, w.Body)
+	}
+	var resp ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Details["account_id"] != opened.ID {
+		t.Errorf("details = %v, want account %s", resp.Details, opened.ID)
+	}
+
+	// Other users and products are not duplicates
+	for _, other := range []string{`{"user_id":32,"principal":500,"period":"6m"}`, `{"user_id":31,"principal":500,"period":"3m"}`} {
+		if w := api.do(http.MethodPost, "/v2/block-account", other); w.Code != http.StatusCreated {
+			t.Errorf("%s: %d %s", other, w.Code, w.Body)
+		}
+	}
+
+	// With warn the account is opened and points at the other
+	t.Setenv("DUPLICATE_ACCOUNT_ACTION", DuplicateAccountWarn)
+	var warned struct {
+		ID                  string `json:"id"`
+		PossibleDuplicateOf string `json:"possible_duplicate_of"`
+	}
+	api.create(http.MethodPost, "/v2/block-account", body, &warned)
+	if warned.PossibleDuplicateOf != opened.ID {
+		t.Errorf("possible_duplicate_of = %q, want %s", warned.PossibleDuplicateOf, opened.ID)
+	}
+
+	// With no window nothing is checked
+	t.Setenv("DUPLICATE_ACCOUNT_WINDOW", "")
+	t.Setenv("DUPLICATE_ACCOUNT_ACTION", "")
+	var again struct {
+		PossibleDuplicateOf string `json:"possible_duplicate_of"`
+	}
+	api.create(http.MethodPost, "/v2/block-account", body, &again)
+	if again.PossibleDuplicateOf != "" {
+		t.Errorf("check off: possible_duplicate_of = %q", again.PossibleDuplicateOf)
+	}
+}
+
+func TestConcurrentDuplicateAccounts(t *testing.T) {
+	t.Setenv("DUPLICATE_ACCOUNT_WINDOW", "1m")
+	api := newTestAPI(t)
+
+	// Of identical creates racing, one opens the account and the rest are
+	// refused as its duplicates
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			codes[i] = api.do(http.MethodPost, "/v2/block-account", `{"user_id":33,"principal":750,"period":"1y"}`).Code
+		}()
+	}
+	close(start)
+	wg.Wait()
+	created := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("concurrent create: %d", code)
+		}
+	}
+	var n int
+	if err := api.db.QueryRow(`SELECT COUNT(*) FROM block_accounts WHERE user_id = 33`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || n != 1 {
+		t.Errorf("%d creates succeeded and %d accounts opened, want 1", created, n)
+	}
+}
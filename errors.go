@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Error codes sent in error_code. Clients branch on these; messages are for
+// people and may change. Every error response carries a code: the specific
+// one below when the service knows it, else the generic one for its status.
+const (
+	// Generic codes, one per status
+	CodeInvalidRequest       = "INVALID_REQUEST"
+	CodeUnauthenticated      = "UNAUTHENTICATED"
+	CodeForbidden            = "FORBIDDEN"
+	CodeNotFound             = "NOT_FOUND"
+	CodeConflict             = "CONFLICT"
+	CodePreconditionFailed   = "PRECONDITION_FAILED"
+	CodePreconditionRequired = "PRECONDITION_REQUIRED"
+	CodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	CodeUnprocessable        = "UNPROCESSABLE"
+	CodeRateLimited          = "RATE_LIMITED"
+	CodeInternal             = "INTERNAL_ERROR"
+	CodeUpstreamFailed       = "UPSTREAM_FAILED"
+	CodeUnavailable          = "SERVICE_UNAVAILABLE"
+
+	// Requests
+	CodeMalformedBody         = "MALFORMED_BODY"
+	CodeValidationFailed      = "VALIDATION_FAILED"
+	CodeStaffIdentityRequired = "STAFF_IDENTITY_REQUIRED"
+	CodeIdentityProviderDown  = "IDENTITY_PROVIDER_UNAVAILABLE"
+	CodeInvalidCursor         = "INVALID_CURSOR"
+
+	// Fields, in field errors
+	CodeFieldRequired          = "FIELD_REQUIRED"
+	CodeInvalidField           = "INVALID_FIELD"
+	CodeUnknownField           = "UNKNOWN_FIELD"
+	CodeInvalidType            = "INVALID_TYPE"
+	CodeInvalidPeriod          = "INVALID_PERIOD"
+	CodeInvalidPayoutFrequency = "INVALID_PAYOUT_FREQUENCY"
+	CodeInvalidUserID          = "INVALID_USER_ID"
+	CodeInvalidAmount          = "INVALID_AMOUNT"
+	CodeAmountTooLarge         = "AMOUNT_TOO_LARGE"
+
+	// Accounts
+	CodeInvalidAccountID          = "INVALID_ACCOUNT_ID"
+	CodeAccountNotFound           = "ACCOUNT_NOT_FOUND"
+	CodeAccountNotActive          = "ACCOUNT_NOT_ACTIVE"
+	CodeAccountFrozen             = "ACCOUNT_FROZEN"
+	CodeAccountNotFrozen          = "ACCOUNT_NOT_FROZEN"
+	CodeAccountNotDue             = "ACCOUNT_NOT_DUE"
+	CodeUserNotFound              = "USER_NOT_FOUND"
+	CodeProductUnavailable        = "PRODUCT_UNAVAILABLE"
+	CodeSettlementAccountRequired = "SETTLEMENT_ACCOUNT_REQUIRED"
+	CodeFundingDeclined           = "FUNDING_DECLINED"
+	CodeLimitExceeded             = "LIMIT_EXCEEDED"
+	CodeActivityThrottled         = "ACTIVITY_THROTTLED"
+	CodeDuplicateAccount          = "DUPLICATE_ACCOUNT"
+	CodeIdempotencyKeyReused      = "IDEMPOTENCY_KEY_REUSED"
+	CodeInstructionCutoff         = "INSTRUCTION_CUTOFF_PASSED"
+	CodePayoutNotFailed           = "PAYOUT_NOT_FAILED"
+	CodeEarlyWithdrawalNotAllowed = "EARLY_WITHDRAWAL_NOT_ALLOWED"
+	CodePrimaryHolderRequired     = "PRIMARY_HOLDER_REQUIRED"
+	CodeAlreadyHolder             = "ALREADY_HOLDER"
+	CodePrimaryHolderFixed        = "PRIMARY_HOLDER_FIXED"
+	CodeHolderNotFound            = "HOLDER_NOT_FOUND"
+	CodeInvalidAllocation         = "INVALID_ALLOCATION"
+
+	// Back office
+	CodeApprovalRequired          = "APPROVAL_REQUIRED"
+	CodeApprovalNotPending        = "APPROVAL_NOT_PENDING"
+	CodeSelfApproval              = "SELF_APPROVAL"
+	CodeApprovalFailed            = "APPROVAL_FAILED"
+	CodeImpersonationForbidden    = "IMPERSONATION_FORBIDDEN"
+	CodeFlagReviewed              = "FLAG_ALREADY_REVIEWED"
+	CodeBreakNotOpen              = "BREAK_NOT_OPEN"
+	CodeAPIKeyRevoked             = "API_KEY_REVOKED"
+	CodeJobFinished               = "JOB_FINISHED"
+	CodeImportQueueFull           = "IMPORT_QUEUE_FULL"
+	CodeUnknownReport             = "UNKNOWN_REPORT_TYPE"
+	CodeWebhookChannelMismatch    = "WEBHOOK_CHANNEL_MISMATCH"
+	CodeRegionNotConfigured       = "REGION_NOT_CONFIGURED"
+	CodeUnknownFeature            = "UNKNOWN_FEATURE"
+	CodeFeatureDisabled           = "FEATURE_DISABLED"
+	CodeClockFixed                = "CLOCK_FIXED"
+	CodeRegionAlreadyActive       = "REGION_ALREADY_ACTIVE"
+	CodeFXNotConfigured           = "FX_NOT_CONFIGURED"
+	CodeUnknownCurrency           = "UNKNOWN_CURRENCY"
+	CodeFXUnavailable             = "FX_UNAVAILABLE"
+	CodeChannelUnavailable        = "CHANNEL_UNAVAILABLE"
+	CodeAgreementMismatch         = "AGREEMENT_MISMATCH"
+	CodeNotificationsNotMuted     = "NOTIFICATIONS_NOT_MUTED"
+	CodeAccountChanged            = "ACCOUNT_CHANGED"
+	CodeImpersonationOutOfScope   = "IMPERSONATION_OUT_OF_SCOPE"
+	CodeInterestUpToDate          = "INTEREST_UP_TO_DATE"
+	CodeNoRatePlan                = "NO_RATE_PLAN"
+	CodeAdjustmentExceedsInterest = "ADJUSTMENT_EXCEEDS_INTEREST"
+	CodeInvalidValueDate          = "INVALID_VALUE_DATE"
+	CodeUnknownScheduledJob       = "UNKNOWN_SCHEDULED_JOB"
+	CodeProjectionUnavailable     = "PROJECTION_UNAVAILABLE"
+
+	// Tenants
+	CodeUnknownTenant  = "UNKNOWN_TENANT"
+	CodeTenantMismatch = "TENANT_MISMATCH"
+	CodeTenantExists   = "TENANT_EXISTS"
+	CodePlatformOnly   = "PLATFORM_ONLY"
+)
+
+// statusCodes are the generic codes of each status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeInvalidRequest,
+	http.StatusUnauthorized:          CodeUnauthenticated,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusPreconditionRequired:  CodePreconditionRequired,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusBadGateway:            CodeUpstreamFailed,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+// genericCode returns the generic code of status
+func genericCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status < http.StatusInternalServerError {
+		return CodeInvalidRequest
+	}
+	return CodeInternal
+}
+
+// APIError is an error with a code from the catalog, raised by the service
+// so handlers can pass the code on. The handler still picks the status.
+type APIError struct {
+	Code    string
+	Message string
+	// Details are code-specific values, such as the limit a request broke
+	Details map[string]any
+	// Fields lists the fields of the request that failed validation
+	Fields []FieldError
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// newAPIError returns an error with code, for the sentinel errors of the service
+func newAPIError(code, message string) *APIError {
+	return &APIError{Code: code, Message: message}
+}
+
+// FieldError is a request field that failed validation
+// @Description A request field that failed validation
+type FieldError struct {
+	Field   string `json:"field" example:"period"`
+	Code    string `json:"code" example:"INVALID_PERIOD"`
+	Message string `json:"message" example:"invalid period: 5y. Valid options are: 3m, 6m, 1y, 3y"`
+}
+
+// validationErrors collects the field errors of a request
+type validationErrors []FieldError
+
+// add records that field failed with code
+func (v *validationErrors) add(field, code, message string) {
+	*v = append(*v, FieldError{Field: field, Code: code, Message: message})
+}
+
+// err returns the collected field errors as one error, or nil when there
+// are none. A single failure keeps its own code and message.
+func (v validationErrors) err() error {
+	switch len(v) {
+	case 0:
+		return nil
+	case 1:
+		return &APIError{Code: v[0].Code, Message: v[0].Message, Fields: v}
+	}
+	return &APIError{Code: CodeValidationFailed, Message: v[0].Message + " (and more)", Fields: v}
+}
+
+// writeErrorCode writes an error response with a specific code
+func writeErrorCode(w http.ResponseWriter, statusCode int, code, message string) {
+	writeErrorResponse(w, statusCode, ErrorResponse{Message: message, ErrorCode: code})
+}
+
+// writeAPIError writes err as an error response, with its code when it is
+// or wraps an APIError and the status's generic code otherwise
+func writeAPIError(w http.ResponseWriter, statusCode int, err error) {
+	resp := ErrorResponse{Message: err.Error(), ErrorCode: genericCode(statusCode)}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		resp.ErrorCode, resp.Details, resp.Fields = apiErr.Code, apiErr.Details, apiErr.Fields
+	}
+	writeErrorResponse(w, statusCode, resp)
+}
+
+// writeErrorResponse fills in the status of resp and writes it, its
+// messages in the language the client asked for in Accept-Language
+func writeErrorResponse(w http.ResponseWriter, statusCode int, resp ErrorResponse) {
+	resp.Error, resp.Code = http.StatusText(statusCode), statusCode
+	if resp.ErrorCode == "" {
+		resp.ErrorCode = genericCode(statusCode)
+	}
+	if locale, ok := responseLocale(w); ok {
+		w.Header().Add("Vary", "Accept-Language")
+		if locale != "" {
+			w.Header().Set("Content-Language", localizeError(&resp, locale))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrPreconditionFailed is returned for a change whose If-Match names a
+// version of the account that is no longer current
+var ErrPreconditionFailed = newAPIError(CodeAccountChanged, "block account has changed since it was read; fetch it again")
+
+// ifMatchKey stores the If-Match header of a change to an account
+const ifMatchKey ctxKey = "ifMatch"
+
+// accountVersion identifies the account's state. Every change to an account
+// moves its updated_at.
+func accountVersion(a *BlockAccount) string {
+	return strconv.FormatInt(a.UpdatedAt.UnixNano(), 36)
+}
+
+// accountETag returns the strong ETag of the account as served to r. Each
+// response format has its own tags, and a valuation is part of the
+// representation, so the tag moves with its time too.
+func accountETag(r *http.Request, a *BlockAccount) string {
+	tag := accountVersion(a)
+	if a.Valuation != nil {
+		tag += "." + strconv.FormatInt(a.Valuation.ValuedAt.Unix(), 36)
+	}
+	if format := responseFormat(r); format != formatJSON {
+		tag += "-" + format
+	}
+	return `"` + tag + `"`
+}
+
+// etagVersion returns the account version a strong tag from accountETag
+// names, or "" for any other tag
+func etagVersion(tag string) string {
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return ""
+	}
+	version, _, _ := strings.Cut(tag[1:len(tag)-1], "-")
+	version, _, _ = strings.Cut(version, ".")
+	return version
+}
+
+// splitETags splits an If-Match or If-None-Match header into its tags
+func splitETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// notModified reports whether r's If-None-Match names etag. The comparison
+// is weak, as RFC 9110 has it for If-None-Match.
+func notModified(r *http.Request, etag string) bool {
+	for _, tag := range splitETags(r.Header.Get("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIfMatch writes a 428 and returns false when a v2 change to an
+// account comes without If-Match. v1 clients may leave it out.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("If-Match") != "" || requestAPIVersion(r) == "v1" {
+		return true
+	}
+	writeError(w, http.StatusPreconditionRequired, "send the account's ETag in If-Match to change it")
+	return false
+}
+
+// withIfMatch returns ctx carrying the If-Match header of a change, for the
+// service to check against the account once it is locked
+func withIfMatch(ctx context.Context, header string) context.Context {
+	return context.WithValue(ctx, ifMatchKey, header)
+}
+
+// checkIfMatch returns ErrPreconditionFailed unless ctx has no If-Match or
+// it names the account's current version, in any representation and as
+// valued at any time, or is "*". The comparison is strong: weak tags never
+// match.
+func checkIfMatch(ctx context.Context, a *BlockAccount) error {
+	header, _ := ctx.Value(ifMatchKey).(string)
+	if header == "" {
+		return nil
+	}
+	version := accountVersion(a)
+	for _, tag := range splitETags(header) {
+		if tag == "*" || etagVersion(tag) == version {
+			return nil
+		}
+	}
+	return ErrPreconditionFailed
+}
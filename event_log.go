@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Projections an event log rebuild can target. Notifications are queued
+// from the log through their event cursor; the read cache holds accounts
+// and user lists as of the events behind them.
+const (
+	ProjectionNotifications = "notifications"
+	ProjectionReadCache     = "read_cache"
+)
+
+// ErrProjectionUnavailable is returned when a rebuild targets the read
+// cache of a deployment without one
+var ErrProjectionUnavailable = newAPIError(CodeProjectionUnavailable, "the read cache is not enabled")
+
+// LoggedEvent is one domain event in the append-only event log
+// @Description A domain event as stored in the event log, numbered by its position in it
+type LoggedEvent struct {
+	// Sequence is the event's position in the log. It only grows, though a
+	// transaction committing late can leave a gap that fills in later.
+	Sequence      int64     `json:"sequence" example:"99120"`
+	ID            string    `json:"id" example:"0192a3b4-5c6d-7e8f-9a0b-1c2d3e4f5a6b"`
+	Type          string    `json:"type" example:"account.funded"`
+	SchemaVersion int       `json:"schema_version" example:"2"`
+	AccountID     string    `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	TenantID      string    `json:"tenant_id" example:"default"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	// Payload is the event exactly as it was published
+	Payload json.RawMessage `json:"payload" swaggertype:"object"`
+}
+
+// ProjectionRebuildRequest selects the projection to rebuild
+// @Description Request payload for rebuilding a projection from the event log
+type ProjectionRebuildRequest struct {
+	Projection string `json:"projection" example:"notifications" enums:"notifications,read_cache" validate:"oneof=notifications read_cache"`
+	// AfterSequence is the last event the rebuilt notifications keep; later
+	// events are read again. The read cache is always dropped whole.
+	AfterSequence int64 `json:"after_sequence,omitempty" example:"98000" validate:"gte=0"`
+}
+
+// ProjectionRebuild reports a rebuild started from the event log
+// @Description Outcome of a projection rebuild
+type ProjectionRebuild struct {
+	Projection string `json:"projection" example:"notifications"`
+	// PreviousSequence is where the notification cursor stood, and
+	// AfterSequence where it stands now; a cursor already behind
+	// after_sequence is not moved
+	PreviousSequence *int64 `json:"previous_sequence,omitempty" example:"99120"`
+	AfterSequence    *int64 `json:"after_sequence,omitempty" example:"98000"`
+	// KeysDropped counts the read cache entries dropped
+	KeysDropped *int      `json:"keys_dropped,omitempty" example:"1520"`
+	RequestedBy string    `json:"requested_by" example:"ops-17"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// newLoggedEvent returns e as the event log presents it
+func newLoggedEvent(e *OutboxEvent) *LoggedEvent {
+	return &LoggedEvent{
+		Sequence:      e.ID,
+		ID:            e.EventID,
+		Type:          e.Type,
+		SchemaVersion: e.SchemaVersion,
+		AccountID:     e.AggregateKey,
+		TenantID:      e.TenantID,
+		OccurredAt:    e.CreatedAt,
+		Payload:       e.Payload,
+	}
+}
+
+// ListEventLog returns up to limit events after afterSequence, oldest first,
+// optionally for one account and one event type
+func (s *service) ListEventLog(ctx context.Context, afterSequence int64, accountID, eventType string, limit int) ([]*LoggedEvent, error) {
+	events, err := s.repo.ListEventLog(ctx, afterSequence, accountID, eventType, limit)
+	if err != nil {
+		s.log(ctx).Error("Failed to list event log", zap.Error(err))
+		return nil, err
+	}
+	logged := make([]*LoggedEvent, len(events))
+	for i, e := range events {
+		logged[i] = newLoggedEvent(e)
+	}
+	return logged, nil
+}
+
+// RebuildProjection rebuilds a projection from the event log. Notifications
+// rewind their cursor to after_sequence and the notification worker reads
+// the later events again; notices already queued for an event are skipped,
+// so only missing ones are sent. The read cache is dropped and refills from
+// the database on the next reads.
+func (s *service) RebuildProjection(ctx context.Context, staffID string, req *ProjectionRebuildRequest) (*ProjectionRebuild, error) {
+	rebuild := &ProjectionRebuild{Projection: req.Projection, RequestedBy: staffID, RequestedAt: time.Now().UTC()}
+	switch req.Projection {
+	case ProjectionNotifications:
+		previous, err := s.repo.EventCursor(ctx, notificationConsumer)
+		if err != nil {
+			s.log(ctx).Error("Failed to read notification cursor", zap.Error(err))
+			return nil, err
+		}
+		if err := s.repo.RewindEventCursor(ctx, notificationConsumer, req.AfterSequence); err != nil {
+			s.log(ctx).Error("Failed to rewind notification cursor", zap.Error(err))
+			return nil, err
+		}
+		after := min(previous, req.AfterSequence)
+		rebuild.PreviousSequence, rebuild.AfterSequence = &previous, &after
+	case ProjectionReadCache:
+		cache, ok := s.repo.(*cachedRepository)
+		if !ok {
+			return nil, ErrProjectionUnavailable
+		}
+		dropped, err := cache.flush(ctx)
+		if err != nil {
+			s.log(ctx).Error("Failed to drop read cache", zap.Error(err), zap.Int("dropped", dropped))
+			return nil, err
+		}
+		rebuild.KeysDropped = &dropped
+	default:
+		return nil, fmt.Errorf("unknown projection: %s", req.Projection)
+	}
+	s.log(ctx).Info("Projection rebuild started", zap.String("projection", req.Projection),
+		zap.Int64("afterSequence", req.AfterSequence), zap.String("staffID", staffID))
+	return rebuild, nil
+}
+
+// listEventLogHandler godoc
+// @Summary Read the event log
+// @Description Lists domain events from the append-only event log in sequence order: every account creation, funding, interest payment, status change, maturity and closure, as published. Follow the log by passing the last sequence read as after.
+// @Tags admin
+// @Produce json
+// @Param after query int false "Only events after this sequence" default(0)
+// @Param account_id query string false "Only this account's events"
+// @Param type query string false "Only events of this type" Enums(account.created, account.funded, account.funding_failed, account.status_changed, interest.paid, account.matured, account.closed)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]LoggedEvent}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/events [get]
+func listEventLogHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	query := r.URL.Query()
+	var after int64
+	if v := query.Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "after must be a sequence number")
+			return
+		}
+		after = n
+	}
+	accountID := query.Get("account_id")
+	if accountID != "" {
+		externalID, ok := parseExternalID(accountID)
+		if !ok {
+			writeErrorCode(w, http.StatusBadRequest, CodeInvalidAccountID, "Invalid block account ID")
+			return
+		}
+		accountID = externalID
+	}
+	eventType := query.Get("type")
+	if eventType != "" && !webhookEvents[ChannelAccount][eventType] {
+		writeError(w, http.StatusBadRequest, "Invalid event type: "+eventType)
+		return
+	}
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	events, err := svc.ListEventLog(ctx, after, accountID, eventType, page.end()+1)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, events, "Event log retrieved successfully")
+}
+
+// rebuildProjectionHandler godoc
+// @Summary Rebuild a projection from the event log
+// @Description Rebuilds state derived from the event log after an outage or a consumer bug. notifications rewinds the notification worker's cursor to after_sequence; the worker queues the notices the later events should have produced, skipping any already queued. read_cache drops every cached account and user list so reads go back to the database. To re-emit events to the broker or a webhook, use POST /admin/events/replay.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member requesting the rebuild"
+// @Param request body ProjectionRebuildRequest true "Projection to rebuild"
+// @Success 202 {object} ProjectionRebuild
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/events/rebuild [post]
+func rebuildProjectionHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req ProjectionRebuildRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	rebuild, err := svc.RebuildProjection(ctx, staffID, &req)
+	if err != nil {
+		if err == ErrProjectionUnavailable {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	markWrite(w)
+
+	writeSuccessStatus(w, r, http.StatusAccepted, rebuild, "Projection rebuild started")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestEventLog(t *testing.T) {
+	api := newTestAPI(t)
+	first := api.createAccount(71)
+	second := api.createAccount(72)
+
+	list := func(query string) []LoggedEvent {
+		t.Helper()
+		var page struct{ Items []LoggedEvent }
+		api.create(http.MethodGet, "/v2/admin/events"+query, "", &page)
+		return page.Items
+	}
+	events := list("")
+	if len(events) < 2 {
+		t.Fatalf("events = %+v", events)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Sequence <= events[i-1].Sequence {
+			t.Errorf("sequence %d follows %d", events[i].Sequence, events[i-1].Sequence)
+		}
+	}
+	var payload AccountEvent
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil || payload.ID != events[0].ID ||
+		payload.Account.ID != first || events[0].AccountID != first || events[0].Type != EventAccountCreated {
+		t.Errorf("first event = %+v, payload %+v (%v)", events[0], payload, err)
+	}
+
+	if got := list("?account_id=" + second); len(got) != 1 || got[0].AccountID != second {
+		t.Errorf("second account's events = %+v", got)
+	}
+	if got := list("?type=" + EventAccountMatured); len(got) != 0 {
+		t.Errorf("matured events = %+v", got)
+	}
+	if got := list("?after=" + strconv.FormatInt(events[0].Sequence, 10)); len(got) != len(events)-1 || got[0].Sequence != events[1].Sequence {
+		t.Errorf("events after the first = %+v", got)
+	}
+	if w := api.do(http.MethodGet, "/v2/admin/events?type=account.deleted", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown type: %d", w.Code)
+	}
+
+	// The log is append-only; the relay may still mark events published
+	if _, err := api.db.Exec(`UPDATE outbox SET payload='{}' WHERE id=?`, events[0].Sequence); err == nil {
+		t.Error("event payload rewritten")
+	}
+	if _, err := api.db.Exec(`DELETE FROM outbox WHERE id=?`, events[0].Sequence); err == nil {
+		t.Error("event deleted")
+	}
+	if _, err := api.db.Exec(`UPDATE outbox SET published_at=CURRENT_TIMESTAMP WHERE id=?`, events[0].Sequence); err != nil {
+		t.Errorf("mark published: %v", err)
+	}
+	var logged int
+	if err := api.db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&logged); err != nil || logged != len(events) {
+		t.Errorf("events view has %d rows, want %d (%v)", logged, len(events), err)
+	}
+}
+
+func TestRebuildProjection(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	if _, err := api.svc.repo.QueueNotifications(ctx, nil, notificationConsumer, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	var rebuild ProjectionRebuild
+	api.create(http.MethodPost, "/v2/admin/events/rebuild", `{"projection":"notifications","after_sequence":20}`, &rebuild)
+	if rebuild.PreviousSequence == nil || *rebuild.PreviousSequence != 50 || rebuild.AfterSequence == nil ||
+		*rebuild.AfterSequence != 20 || rebuild.RequestedBy != "staff-1" {
+		t.Errorf("rebuild = %+v", rebuild)
+	}
+	if cursor, _ := api.svc.repo.EventCursor(ctx, notificationConsumer); cursor != 20 {
+		t.Errorf("cursor = %d, want 20", cursor)
+	}
+
+	// A rebuild never moves the cursor forward
+	var again ProjectionRebuild
+	api.create(http.MethodPost, "/v2/admin/events/rebuild", `{"projection":"notifications","after_sequence":40}`, &again)
+	if cursor, _ := api.svc.repo.EventCursor(ctx, notificationConsumer); cursor != 20 || *again.AfterSequence != 20 {
+		t.Errorf("cursor = %d, rebuild %+v", cursor, again)
+	}
+
+	if w := api.do(http.MethodPost, "/v2/admin/events/rebuild", `{"projection":"read_cache"}`); w.Code != http.StatusNotFound {
+		t.Errorf("read cache without Redis: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// eventStreamLag keeps the event hub this far behind the newest outbox
+	// events, so that a transaction committing after one that took a later
+	// outbox ID is not skipped
+	eventStreamLag = 2 * time.Second
+	// eventStreamPollInterval is how often the event hub reads the outbox
+	eventStreamPollInterval = time.Second
+	// eventStreamHeartbeat is how long a stream may go without an event
+	// before a heartbeat comment is sent, so proxies keep it open
+	eventStreamHeartbeat = 15 * time.Second
+	// eventStreamTimeout is how long one stream stays open. Clients
+	// reconnect with Last-Event-ID and miss nothing.
+	eventStreamTimeout = time.Hour
+	// eventStreamWriteTimeout is how long writing one event may take
+	eventStreamWriteTimeout = 10 * time.Second
+	// eventStreamRetry is the reconnection delay sent to clients
+	eventStreamRetry = 5 * time.Second
+	// eventStreamBuffer is how many events a stream may fall behind the hub
+	// before it is dropped
+	eventStreamBuffer = 64
+	// eventStreamBatch is how many outbox events are read per query
+	eventStreamBatch = 100
+	// defaultMaxEventStreams caps the streams open on one instance
+	defaultMaxEventStreams = 1000
+)
+
+// streamFromNow starts a stream at the newest event, for clients without a
+// Last-Event-ID
+const streamFromNow = -1
+
+// ErrEventStreamsFull is returned when the instance has as many event
+// streams open as EVENT_STREAM_MAX allows
+var ErrEventStreamsFull = newAPIError(CodeUnavailable, "too many event streams are open; retry later")
+
+// errEventStreamClosed is returned for a stream opened while the server
+// shuts down
+var errEventStreamClosed = newAPIError(CodeUnavailable, "the server is shutting down; retry later")
+
+// streamedEvents are the events sent on a user's event stream: every change
+// of an account's status, and interest payments
+var streamedEvents = map[string]bool{
+	EventAccountCreated:       true,
+	EventAccountFunded:        true,
+	EventAccountFundingFailed: true,
+	EventAccountStatusChanged: true,
+	EventAccountMatured:       true,
+	EventAccountClosed:        true,
+	EventInterestPaid:         true,
+}
+
+// UserEvent is an account event on its holder's event stream
+type UserEvent struct {
+	// ID is the event's position in the outbox, sent as the SSE event ID
+	ID int64
+	*AccountEvent
+}
+
+// newUserEvent decodes e for a user's event stream
+func newUserEvent(e *OutboxEvent) (*UserEvent, error) {
+	event, err := decodeAccountEvent(e)
+	if err != nil {
+		return nil, err
+	}
+	if event.Account.ID == "" {
+		event.Account.ID = e.AggregateKey
+	}
+	return &UserEvent{ID: e.ID, AccountEvent: event}, nil
+}
+
+// maxEventStreams returns how many event streams one instance keeps open
+func maxEventStreams() int {
+	return bulkSetting("EVENT_STREAM_MAX", defaultMaxEventStreams)
+}
+
+// eventStreamKey names the streams an outbox event is sent to
+type eventStreamKey struct {
+	tenant string
+	userID int
+}
+
+// eventSubscription is one open event stream
+type eventSubscription struct {
+	key    eventStreamKey
+	events chan *UserEvent
+}
+
+// eventHub reads the outbox once for the whole instance and hands each
+// streamed event to the open streams of its account holder
+type eventHub struct {
+	repo   Repository
+	logger *zap.Logger
+	// ready is closed once cursor has been read
+	ready chan struct{}
+
+	mu sync.Mutex
+	// cursor is the ID of the last outbox event handed out
+	cursor int64
+	subs   map[eventStreamKey]map[*eventSubscription]bool
+	count  int
+	closed bool
+}
+
+func newEventHub(repo Repository, logger *zap.Logger) *eventHub {
+	return &eventHub{repo: repo, logger: logger, ready: make(chan struct{}), subs: map[eventStreamKey]map[*eventSubscription]bool{}}
+}
+
+// run polls the outbox until ctx ends, then closes every open stream
+func (h *eventHub) run(ctx context.Context) {
+	defer h.closeAll()
+
+	ticker := time.NewTicker(eventStreamPollInterval)
+	defer ticker.Stop()
+	started := false
+	for {
+		if started {
+			h.poll(ctx)
+		} else if cursor, err := h.repo.LastOutboxID(ctx, time.Now().UTC().Add(-eventStreamLag)); err != nil {
+			if ctx.Err() == nil {
+				h.logger.Warn("Failed to read outbox position for event streams", zap.Error(err))
+			}
+		} else {
+			h.mu.Lock()
+			h.cursor = cursor
+			h.mu.Unlock()
+			close(h.ready)
+			started = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll hands out the outbox events written since the last poll
+func (h *eventHub) poll(ctx context.Context) {
+	for {
+		events, err := h.repo.ListOutboxAfter(ctx, h.cursor, time.Now().UTC().Add(-eventStreamLag), eventStreamBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				h.logger.Warn("Failed to read outbox for event streams", zap.Error(err))
+			}
+			return
+		}
+		for _, e := range events {
+			h.dispatch(e)
+		}
+		if len(events) < eventStreamBatch {
+			return
+		}
+	}
+}
+
+// dispatch hands e to the streams of its account holder. A stream too far
+// behind to take it is dropped; its client reconnects and catches up.
+func (h *eventHub) dispatch(e *OutboxEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cursor = e.ID
+
+	subs := h.subs[eventStreamKey{tenant: e.TenantID, userID: e.UserID}]
+	if len(subs) == 0 || !streamedEvents[e.Type] {
+		return
+	}
+	event, err := newUserEvent(e)
+	if err != nil {
+		h.logger.Warn("Skipping unreadable event", zap.Error(err), zap.String("eventID", e.EventID))
+		return
+	}
+	for sub := range subs {
+		select {
+		case sub.events <- event:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// subscribe opens a stream for key. It returns the outbox position the hub
+// has reached: events after it arrive on the subscription, those up to it
+// must be read from the outbox.
+func (h *eventHub) subscribe(ctx context.Context, key eventStreamKey) (*eventSubscription, int64, error) {
+	select {
+	case <-h.ready:
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, 0, errEventStreamClosed
+	}
+	if h.count >= maxEventStreams() {
+		return nil, 0, ErrEventStreamsFull
+	}
+	sub := &eventSubscription{key: key, events: make(chan *UserEvent, eventStreamBuffer)}
+	if h.subs[key] == nil {
+		h.subs[key] = map[*eventSubscription]bool{}
+	}
+	h.subs[key][sub] = true
+	h.count++
+	return sub, h.cursor, nil
+}
+
+// unsubscribe closes sub, unless the hub already dropped it
+func (h *eventHub) unsubscribe(sub *eventSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// remove closes sub and forgets it. h.mu must be held.
+func (h *eventHub) remove(sub *eventSubscription) {
+	subs := h.subs[sub.key]
+	if !subs[sub] {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.key)
+	}
+	h.count--
+	close(sub.events)
+}
+
+// closeAll ends every open stream and refuses new ones
+func (h *eventHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// StreamUserEvents passes send the streamed events of userID's accounts
+// after lastEventID, or from now when it is streamFromNow: first those
+// already in the outbox, then each as the hub reads it. heartbeat is called
+// once the stream is open and whenever eventStreamHeartbeat passes without
+// an event. It returns when ctx ends, when the stream falls too far behind,
+// or with the first error of send or heartbeat.
+func (s *service) StreamUserEvents(ctx context.Context, userID int, lastEventID int64, send func(*UserEvent) error, heartbeat func() error) error {
+	if s.events == nil {
+		return errEventStreamClosed
+	}
+	sub, through, err := s.events.subscribe(ctx, eventStreamKey{tenant: tenantOf(ctx), userID: userID})
+	if err != nil {
+		return err
+	}
+	defer s.events.unsubscribe(sub)
+	if err := heartbeat(); err != nil {
+		return err
+	}
+
+	last := lastEventID
+	if last == streamFromNow {
+		last = through
+	}
+	// Catch up on the events the client missed from the outbox, as far as
+	// the hub had read when the stream opened
+	for last < through {
+		events, err := s.repo.ListUserOutboxAfter(ctx, userID, last, through, eventStreamBatch)
+		if err != nil {
+			s.log(ctx).Error("Failed to read missed events", zap.Error(err), zap.Int("userID", userID))
+			return err
+		}
+		for _, e := range events {
+			last = e.ID
+			if !streamedEvents[e.Type] {
+				continue
+			}
+			event, err := newUserEvent(e)
+			if err != nil {
+				s.log(ctx).Warn("Skipping unreadable event", zap.Error(err), zap.String("eventID", e.EventID))
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+		if len(events) < eventStreamBatch {
+			break
+		}
+	}
+
+	idle := time.NewTicker(eventStreamHeartbeat)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.events:
+			if !ok {
+				s.log(ctx).Info("Event stream closed", zap.Int("userID", userID), zap.Int64("lastEventID", last))
+				return nil
+			}
+			if event.ID <= last {
+				continue
+			}
+			last = event.ID
+			if err := send(event); err != nil {
+				return err
+			}
+			idle.Reset(eventStreamHeartbeat)
+		case <-idle.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// streamUserEventsHandler godoc
+// @Summary Stream a user's account events
+// @Description Server-sent events for the user's block accounts: every change of status (account.created, account.funded, account.funding_failed, account.status_changed for a freeze or unfreeze, account.matured, account.closed) and every interest payment (interest.paid). Each event's id is its position in the event log, its event field the event type and its data the AccountEvent JSON of the published event schema. Events reach the stream a few seconds after they happen. A reconnecting client sends the last id it received in Last-Event-ID (or last_event_id, for clients that can't set headers) and is sent everything it missed; without it the stream starts at the newest event. A heartbeat comment is sent after 15 seconds without an event. Streams close after an hour, or when the client falls too far behind, and the client reconnects.
+// @Tags block-account
+// @Produce text/event-stream
+// @Param userID path int true "User ID" Format(int64)
+// @Param Last-Event-ID header string false "id of the last event received"
+// @Param last_event_id query string false "id of the last event received, when the header can't be sent"
+// @Success 200 {string} string "text/event-stream of AccountEvent"
+// @Failure 400 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /v2/user/{userID}/block-accounts/events [get]
+func streamUserEventsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID")
+		return
+	}
+	lastEventID := int64(streamFromNow)
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			writeErrorCode(w, http.StatusBadRequest, CodeInvalidField, "Last-Event-ID must be an event id")
+			return
+		}
+		lastEventID = id
+	}
+
+	ctx, cancel := withRequestTimeout(r, eventStreamTimeout)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	started := false
+	write := func(format string, args ...any) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry.Milliseconds())
+			started = true
+		}
+		rc.SetWriteDeadline(time.Now().Add(eventStreamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	err = svc.StreamUserEvents(ctx, userID, lastEventID, func(e *UserEvent) error {
+		data, err := json.Marshal(e.AccountEvent)
+		if err != nil {
+			return err
+		}
+		return write("id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	}, func() error {
+		return write(": heartbeat\n\n")
+	})
+	if err != nil && !started {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrEventStreamsFull) || errors.Is(err, errEventStreamClosed) {
+			status = http.StatusServiceUnavailable
+			w.Header().Set("Retry-After", strconv.Itoa(int(eventStreamRetry.Seconds())))
+		}
+		writeAPIError(w, status, err)
+	}
+}
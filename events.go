@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventSchemaVersion is the version of the event payloads this build
+// publishes. The JSON schema for each version lives in schemas/events; bump
+// the version and add a new schema for any change consumers could notice.
+const EventSchemaVersion = 2
+
+// Domain event types
+const (
+	EventAccountCreated = "account.created"
+	EventAccountMatured = "account.matured"
+	EventAccountClosed  = "account.closed"
+	// EventAccountFunded and EventAccountFundingFailed settle an account
+	// created pending_funding
+	EventAccountFunded        = "account.funded"
+	EventAccountFundingFailed = "account.funding_failed"
+	// EventAccountStatusChanged is a freeze, an unfreeze or a holder closing
+	// the account, which account.closed follows once it is paid out
+	EventAccountStatusChanged = "account.status_changed"
+	// EventInterestPaid is a scheduled interest payment before maturity
+	EventInterestPaid = "interest.paid"
+)
+
+// AccountEvent is the payload published for account lifecycle events
+type AccountEvent struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Account       AccountSnapshot `json:"account"`
+	// PreviousStatus is the status before an account.status_changed event
+	PreviousStatus string `json:"previous_status,omitempty"`
+	// Interest is the payment an interest.paid event reports
+	Interest *InterestSnapshot `json:"interest,omitempty"`
+	// Region is the region the event was raised in, when REGION is set
+	Region string `json:"region,omitempty"`
+	// accountID is the account's internal ID, which the outbox stores the
+	// event under so it can be replayed by account
+	accountID int
+	// tenantID is the account's tenant, whose webhooks receive the event
+	tenantID string
+}
+
+// AccountSnapshot is the account's state as of the event. It is decoupled
+// from BlockAccount so API changes don't silently change the event schema.
+type AccountSnapshot struct {
+	// ID is the account's external ID, as the API reports it
+	ID                  string    `json:"id"`
+	UserID              int       `json:"user_id"`
+	Principal           float64   `json:"principal"`
+	InterestRate        float64   `json:"interest_rate"`
+	Period              string    `json:"period,omitempty"`
+	StartDate           time.Time `json:"start_date"`
+	EndDate             time.Time `json:"end_date"`
+	Status              string    `json:"status"`
+	MaturityInstruction string    `json:"maturity_instruction"`
+}
+
+// InterestSnapshot is an interest payment as of the event
+type InterestSnapshot struct {
+	Amount      float64   `json:"amount"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+}
+
+// newAccountEvent builds an event of eventType for the account's current state
+func newAccountEvent(eventType string, a *BlockAccount) *AccountEvent {
+	return &AccountEvent{
+		ID:            uuid.NewString(),
+		Type:          eventType,
+		SchemaVersion: EventSchemaVersion,
+		OccurredAt:    time.Now().UTC(),
+		Account:       newAccountSnapshot(a),
+		Region:        regionName(),
+		accountID:     a.ID,
+		tenantID:      a.TenantID,
+	}
+}
+
+// newStatusChangedEvent builds an account.status_changed event for an
+// account that was in status from
+func newStatusChangedEvent(a *BlockAccount, from string) *AccountEvent {
+	e := newAccountEvent(EventAccountStatusChanged, a)
+	e.PreviousStatus = from
+	return e
+}
+
+// newInterestPaidEvent builds an interest.paid event for payment p
+func newInterestPaidEvent(a *BlockAccount, p *InterestPayout) *AccountEvent {
+	e := newAccountEvent(EventInterestPaid, a)
+	e.Interest = &InterestSnapshot{Amount: p.Amount, PeriodStart: p.PeriodStart.UTC(), PeriodEnd: p.PeriodEnd.UTC()}
+	return e
+}
+
+// newAccountSnapshot captures the account's current state
+func newAccountSnapshot(a *BlockAccount) AccountSnapshot {
+	return AccountSnapshot{
+		ID:                  a.ExternalID,
+		UserID:              a.UserID,
+		Principal:           a.Principal,
+		InterestRate:        a.InterestRate,
+		Period:              a.Period,
+		StartDate:           a.StartDate.UTC(),
+		EndDate:             a.EndDate.UTC(),
+		Status:              a.Status,
+		MaturityInstruction: a.MaturityInstruction,
+	}
+}
+
+// Payload encodes the event as it is stored in the outbox and published
+func (e *AccountEvent) Payload() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// decodeAccountEvent reads an account event back from the outbox. Version 1
+// payloads carried the internal account ID, which the outbox row keeps, so
+// their snapshot is returned without an external ID.
+func decodeAccountEvent(e *OutboxEvent) (*AccountEvent, error) {
+	var event AccountEvent
+	if e.SchemaVersion < 2 {
+		var v1 struct {
+			AccountEvent
+			Account struct {
+				AccountSnapshot
+				ID int `json:"id"`
+			} `json:"account"`
+		}
+		if err := json.Unmarshal(e.Payload, &v1); err != nil {
+			return nil, err
+		}
+		event, event.Account = v1.AccountEvent, v1.Account.AccountSnapshot
+	} else if err := json.Unmarshal(e.Payload, &event); err != nil {
+		return nil, err
+	}
+	event.accountID = e.AggregateID
+	return &event, nil
+}
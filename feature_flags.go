@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// Features that can be flagged
+const (
+	FeatureGraphQL       = "graphql"
+	FeatureBareResponses = "bare_responses"
+)
+
+// Where a flag's setting comes from
+const (
+	FeatureSourceConfig   = "config"
+	FeatureSourceDatabase = "database"
+)
+
+// featureFlagCacheTTL is how long a process evaluates requests against the
+// flags it read before reading them again, so a change made through the
+// admin API reaches every instance within it
+const featureFlagCacheTTL = 30 * time.Second
+
+const featuresKey ctxKey = "features"
+
+var (
+	// ErrUnknownFeature is returned when setting a flag for a feature that
+	// does not exist
+	ErrUnknownFeature = newAPIError(CodeUnknownFeature, "feature does not exist")
+	// ErrFeatureDisabled is returned for a request to a feature that is off
+	// for it
+	ErrFeatureDisabled = newAPIError(CodeFeatureDisabled, "feature is not enabled")
+)
+
+// feature is a feature that can be flagged
+type feature struct {
+	description string
+	// on is whether the feature is on for everyone unless FEATURE_FLAGS or
+	// the admin API say otherwise
+	on bool
+}
+
+// knownFeatures are the features that can be flagged. A feature is flagged
+// by adding it here and checking featureOn where it is served.
+var knownFeatures = map[string]feature{
+	FeatureGraphQL:       {description: "The GraphQL endpoint", on: true},
+	FeatureBareResponses: {description: "Responses without the success envelope for Accept: " + BareMediaType, on: true},
+}
+
+// FeatureFlag says who a feature is on for
+// @Description Who a feature is enabled for: everyone, listed tenants and a stable percentage of other traffic
+type FeatureFlag struct {
+	Name        string `json:"name" example:"graphql"`
+	Description string `json:"description" example:"The GraphQL endpoint"`
+	// Enabled turns the feature on for everyone
+	Enabled bool `json:"enabled" example:"false"`
+	// Tenants the feature is on for when it is not enabled for everyone
+	Tenants []string `json:"tenants"`
+	// RolloutPercent turns the feature on for a stable share of other
+	// traffic, bucketed by tenant and X-User-ID, or by request without one
+	RolloutPercent int `json:"rollout_percent" example:"10"`
+	// Source is "config" for FEATURE_FLAGS or the built-in default and
+	// "database" when set through the admin API
+	Source    string     `json:"source" example:"database"`
+	UpdatedBy string     `json:"updated_by,omitempty" example:"staff-42"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// FeatureFlagRequest is the payload for flagging a feature
+// @Description Request payload setting who a feature is enabled for
+type FeatureFlagRequest struct {
+	Enabled        bool     `json:"enabled" example:"false"`
+	Tenants        []string `json:"tenants" validate:"max=100,dive,tenant_id"`
+	RolloutPercent int      `json:"rollout_percent" example:"10" validate:"gte=0,lte=100"`
+}
+
+// enabledFor reports whether the flag turns its feature on for subject in
+// tenant. Rollout buckets are a hash of the feature, tenant and subject, so
+// raising the percentage only ever adds traffic and each feature samples
+// different traffic.
+func (f *FeatureFlag) enabledFor(tenant, subject string) bool {
+	if f.Enabled || slices.Contains(f.Tenants, tenant) {
+		return true
+	}
+	if f.RolloutPercent <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%s:%s", f.Name, tenant, subject)
+	return int(h.Sum32()%100) < f.RolloutPercent
+}
+
+// featureDefaults returns the flags of every known feature as
+// FEATURE_FLAGS and the built-in defaults set them. FEATURE_FLAGS is
+// comma-separated name=value pairs, the value on, off or a rollout
+// percentage.
+func featureDefaults() (map[string]*FeatureFlag, error) {
+	flags := make(map[string]*FeatureFlag, len(knownFeatures))
+	for name, f := range knownFeatures {
+		flags[name] = &FeatureFlag{Name: name, Description: f.description, Enabled: f.on, Tenants: []string{},
+			Source: FeatureSourceConfig}
+	}
+	spec := strings.TrimSpace(os.Getenv("FEATURE_FLAGS"))
+	if spec == "" {
+		return flags, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		flag := flags[name]
+		if !ok || flag == nil {
+			return nil, fmt.Errorf("invalid FEATURE_FLAGS entry %q: want feature=on|off|percent, feature one of %s",
+				pair, strings.Join(knownFeatureNames(), ", "))
+		}
+		switch value {
+		case "on":
+			flag.Enabled, flag.RolloutPercent = true, 0
+		case "off":
+			flag.Enabled, flag.RolloutPercent = false, 0
+		default:
+			n, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+			if err != nil || n < 0 || n > 100 {
+				return nil, fmt.Errorf("FEATURE_FLAGS for %s must be on, off or a percentage, not %q", name, value)
+			}
+			flag.Enabled, flag.RolloutPercent = false, n
+		}
+	}
+	return flags, nil
+}
+
+// knownFeatureNames returns the names of the known features, sorted
+func knownFeatureNames() []string {
+	names := make([]string, 0, len(knownFeatures))
+	for name := range knownFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// featureFlags holds the flags a process evaluates requests against: the
+// configured defaults and, for featureFlagCacheTTL, the flags last read
+// from the database
+type featureFlags struct {
+	defaults map[string]*FeatureFlag
+
+	mu       sync.Mutex
+	flags    map[string]*FeatureFlag
+	loadedAt time.Time
+}
+
+// newFeatureFlags returns the flags FEATURE_FLAGS configures
+func newFeatureFlags() (*featureFlags, error) {
+	defaults, err := featureDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &featureFlags{defaults: defaults}, nil
+}
+
+// featureFlags returns every known feature's flag, those set through the
+// admin API in place of the configured ones. When the flags cannot be read
+// it returns the configured ones along with the error.
+func (s *service) featureFlags(ctx context.Context) (map[string]*FeatureFlag, error) {
+	var defaults map[string]*FeatureFlag
+	if s.features != nil {
+		s.features.mu.Lock()
+		defer s.features.mu.Unlock()
+		if s.features.flags != nil && time.Since(s.features.loadedAt) < featureFlagCacheTTL {
+			return s.features.flags, nil
+		}
+		defaults = s.features.defaults
+	} else {
+		var err error
+		if defaults, err = featureDefaults(); err != nil {
+			return map[string]*FeatureFlag{}, err
+		}
+	}
+
+	set, err := s.repo.ListFeatureFlags(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to list feature flags", zap.Error(err))
+		return defaults, err
+	}
+	flags := make(map[string]*FeatureFlag, len(defaults))
+	for name, f := range defaults {
+		flags[name] = f
+	}
+	for _, f := range set {
+		// Flags of features since removed are ignored
+		if known, ok := knownFeatures[f.Name]; ok {
+			f.Description = known.description
+			flags[f.Name] = f
+		}
+	}
+	if s.features != nil {
+		s.features.flags, s.features.loadedAt = flags, time.Now()
+	}
+	return flags, nil
+}
+
+// forgetFeatureFlags makes the next evaluation read the flags again
+func (s *service) forgetFeatureFlags() {
+	if s.features != nil {
+		s.features.mu.Lock()
+		s.features.flags = nil
+		s.features.mu.Unlock()
+	}
+}
+
+// EvaluateFeatures returns the features that are on for subject in the
+// caller's tenant. When the flags cannot be read it evaluates the
+// configured ones, so an unreachable database does not fail requests.
+func (s *service) EvaluateFeatures(ctx context.Context, subject string) map[string]bool {
+	flags, _ := s.featureFlags(ctx)
+	tenant := tenantOf(ctx)
+	on := make(map[string]bool, len(flags))
+	for name, f := range flags {
+		on[name] = f.enabledFor(tenant, subject)
+	}
+	return on
+}
+
+// featureOn reports whether feature is on for the request ctx belongs to.
+// Outside a request evaluated by FeatureFlagsMiddleware it reports the
+// feature's built-in default.
+func featureOn(ctx context.Context, name string) bool {
+	if on, ok := ctx.Value(featuresKey).(map[string]bool); ok {
+		return on[name]
+	}
+	return knownFeatures[name].on
+}
+
+// FeatureFlagsMiddleware evaluates the feature flags for the request's
+// tenant and customer, or for the request itself when it acts for none
+func FeatureFlagsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "Service not available")
+			return
+		}
+
+		subject := strings.TrimSpace(r.Header.Get(UserIDHeader))
+		if subject == "" {
+			subject = middleware.GetReqID(r.Context())
+		}
+		on := svc.EvaluateFeatures(r.Context(), subject)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), featuresKey, on)))
+	})
+}
+
+// ListFeatureFlags returns every known feature's flag, by name
+func (s *service) ListFeatureFlags(ctx context.Context) ([]*FeatureFlag, error) {
+	flags, err := s.featureFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*FeatureFlag, 0, len(flags))
+	for _, name := range knownFeatureNames() {
+		list = append(list, flags[name])
+	}
+	return list, nil
+}
+
+// SetFeatureFlag sets who a feature is on for, in place of its configured
+// flag. Other instances pick the change up within featureFlagCacheTTL.
+func (s *service) SetFeatureFlag(ctx context.Context, name, staffID string, req *FeatureFlagRequest) (*FeatureFlag, error) {
+	known, ok := knownFeatures[name]
+	if !ok {
+		return nil, ErrUnknownFeature
+	}
+	tenants := req.Tenants
+	if tenants == nil {
+		tenants = []string{}
+	}
+	flag := &FeatureFlag{
+		Name:           name,
+		Description:    known.description,
+		Enabled:        req.Enabled,
+		Tenants:        tenants,
+		RolloutPercent: req.RolloutPercent,
+		Source:         FeatureSourceDatabase,
+		UpdatedBy:      staffID,
+	}
+	if err := s.repo.SaveFeatureFlag(ctx, flag); err != nil {
+		s.log(ctx).Error("Failed to save feature flag", zap.Error(err), zap.String("feature", name))
+		return nil, err
+	}
+	s.forgetFeatureFlags()
+	s.log(ctx).Info("Feature flag updated", zap.String("feature", name), zap.String("staffID", staffID),
+		zap.Bool("enabled", flag.Enabled), zap.Strings("tenants", flag.Tenants), zap.Int("rolloutPercent", flag.RolloutPercent))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Feature %s flagged", name),
+		map[string]any{"setting": "feature_flag", "feature": name, "changed_by": staffID, "enabled": flag.Enabled,
+			"tenants": flag.Tenants, "rollout_percent": flag.RolloutPercent})
+	return flag, nil
+}
+
+// DeleteFeatureFlag puts a feature back on its configured flag. It returns
+// sql.ErrNoRows when the feature's flag was not set through the admin API.
+func (s *service) DeleteFeatureFlag(ctx context.Context, name string) error {
+	if err := s.repo.DeleteFeatureFlag(ctx, name); err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to delete feature flag", zap.Error(err), zap.String("feature", name))
+		}
+		return err
+	}
+	s.forgetFeatureFlags()
+	s.log(ctx).Info("Feature flag reset to its configured default", zap.String("feature", name))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Feature %s reset to its configured default", name),
+		map[string]any{"setting": "feature_flag", "feature": name})
+	return nil
+}
+
+// listFeaturesHandler godoc
+// @Summary List the features enabled for the caller
+// @Description Names the flagged features that are on for the caller's tenant and, when X-User-ID is sent, that customer. Without X-User-ID percentage rollouts are evaluated per request.
+// @Tags meta
+// @Produce json
+// @Param X-User-ID header int false "Customer the request acts for, set by the gateway"
+// @Success 200 {array} string
+// @Router /v2/features [get]
+func listFeaturesHandler(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for _, name := range knownFeatureNames() {
+		if featureOn(r.Context(), name) {
+			names = append(names, name)
+		}
+	}
+	writeSuccess(w, r, names, "Features retrieved successfully")
+}
+
+// listFeatureFlagsHandler godoc
+// @Summary List feature flags
+// @Description Lists every feature that can be flagged with who it is enabled for, from FEATURE_FLAGS and the built-in defaults unless set through this API
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]FeatureFlag}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/feature-flags [get]
+func listFeatureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	flags, err := svc.ListFeatureFlags(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, flags, "Feature flags retrieved successfully")
+}
+
+// setFeatureFlagHandler godoc
+// @Summary Flag a feature
+// @Description Enables a feature for everyone, or for the listed tenants plus a stable percentage of other traffic, without redeploying. Replaces the feature's configured flag; every instance applies the change within 30 seconds.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Feature name"
+// @Param flag body FeatureFlagRequest true "Who the feature is on for"
+// @Param X-Staff-ID header string false "Staff member, set by the gateway"
+// @Success 200 {object} FeatureFlag
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/feature-flags/{name} [put]
+func setFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+
+	var req FeatureFlagRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	flag, err := svc.SetFeatureFlag(ctx, name, r.Header.Get(StaffIDHeader), &req)
+	if err == ErrUnknownFeature {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, flag, "Feature flag saved successfully")
+}
+
+// deleteFeatureFlagHandler godoc
+// @Summary Reset a feature flag
+// @Description Removes the flag set through the admin API, putting the feature back on FEATURE_FLAGS or its built-in default
+// @Tags admin
+// @Param name path string true "Feature name"
+// @Success 204 {string} string "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/feature-flags/{name} [delete]
+func deleteFeatureFlagHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+
+	ctx := r.Context()
+
+	if err := svc.DeleteFeatureFlag(ctx, name); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Feature flag is not set")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	markWrite(w)
+	w.WriteHeader(http.StatusNoContent)
+}
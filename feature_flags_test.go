@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	api := newTestAPI(t)
+	query := `{"query":"{ __typename }"}`
+
+	var features []string
+	decodeData(t, api.do(http.MethodGet, "/v2/features", "").Body.Bytes(), &features)
+	if len(features) != 2 {
+		t.Errorf("features = %v, want every built-in feature on", features)
+	}
+
+	if w := api.do(http.MethodPut, "/v2/admin/feature-flags/graphql", `{"enabled":false,"tenants":["acme"]}`); w.Code != http.StatusOK {
+		t.Fatalf("flag graphql: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodPost, GraphQLPath, query); w.Code != http.StatusNotFound || errorCode(w) != CodeFeatureDisabled {
+		t.Errorf("graphql off for the tenant = %d %s, want 404 %s", w.Code, w.Body, CodeFeatureDisabled)
+	}
+	if w := api.do(http.MethodPut, "/v2/admin/feature-flags/graphql", `{"tenants":["default"]}`); w.Code != http.StatusOK {
+		t.Fatalf("flag graphql: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodPost, GraphQLPath, query); w.Code != http.StatusOK {
+		t.Errorf("graphql on for the tenant = %d %s, want 200", w.Code, w.Body)
+	}
+
+	if w := api.do(http.MethodPut, "/v2/admin/feature-flags/bare_responses", `{"enabled":false}`); w.Code != http.StatusOK {
+		t.Fatalf("flag bare_responses: %d %s", w.Code, w.Body)
+	}
+	w := api.do(http.MethodGet, "/v2/products", "", "Accept", BareMediaType)
+	if w.Header().Get("Content-Type") == BareMediaType {
+		t.Error("bare response served with the feature off")
+	}
+
+	var flags struct {
+		Items []*FeatureFlag `json:"items"`
+	}
+	decodeData(t, api.do(http.MethodGet, "/v2/admin/feature-flags", "").Body.Bytes(), &flags)
+	if len(flags.Items) != 2 || flags.Items[0].Name != FeatureBareResponses || flags.Items[0].Source != FeatureSourceDatabase ||
+		flags.Items[1].UpdatedBy != "staff-1" {
+		t.Errorf("flags = %+v, want both set through the API", flags.Items)
+	}
+
+	if w := api.do(http.MethodPut, "/v2/admin/feature-flags/compound_interest", `{"enabled":true}`); w.Code != http.StatusNotFound || errorCode(w) != CodeUnknownFeature {
+		t.Errorf("flag unknown feature = %d %s, want 404 %s", w.Code, w.Body, CodeUnknownFeature)
+	}
+	if w := api.do(http.MethodPut, "/v2/admin/feature-flags/graphql", `{"rollout_percent":101}`); w.Code != http.StatusBadRequest {
+		t.Errorf("rollout over 100%% = %d, want 400", w.Code)
+	}
+
+	if w := api.do(http.MethodDelete, "/v2/admin/feature-flags/bare_responses", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("reset: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodDelete, "/v2/admin/feature-flags/bare_responses", ""); w.Code != http.StatusNotFound {
+		t.Errorf("reset again = %d, want 404", w.Code)
+	}
+	w = api.do(http.MethodGet, "/v2/products", "", "Accept", BareMediaType)
+	if w.Header().Get("Content-Type") != BareMediaType {
+		t.Error("bare response not served once the flag was reset")
+	}
+}
+
+func TestFeatureFlagRollout(t *testing.T) {
+	flag := &FeatureFlag{Name: FeatureGraphQL, RolloutPercent: 10}
+	on := 0
+	for user := 1; user <= 1000; user++ {
+		if flag.enabledFor(DefaultTenant, strconv.Itoa(user)) {
+			on++
+			// Raising the percentage keeps everyone already in
+			wider := &FeatureFlag{Name: FeatureGraphQL, RolloutPercent: 50}
+			if !wider.enabledFor(DefaultTenant, strconv.Itoa(user)) {
+				t.Fatalf("user %d dropped out when the rollout widened", user)
+			}
+		}
+	}
+	if on < 50 || on > 150 {
+		t.Errorf("10%% rollout let in %d of 1000 users", on)
+	}
+}
+
+func TestFeatureDefaults(t *testing.T) {
+	t.Setenv("FEATURE_FLAGS", "graphql=off, bare_responses=25%")
+	flags, err := featureDefaults()
+	if err != nil || flags[FeatureGraphQL].Enabled || flags[FeatureBareResponses].Enabled || flags[FeatureBareResponses].RolloutPercent != 25 {
+		t.Errorf("defaults = %+v, %v", flags, err)
+	}
+	for _, spec := range []string{"compound_interest=on", "graphql", "graphql=101", "graphql=maybe"} {
+		t.Setenv("FEATURE_FLAGS", spec)
+		if _, err := featureDefaults(); err == nil {
+			t.Errorf("FEATURE_FLAGS=%s accepted, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,775 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported FIELD_ENCRYPTION values. Sensitive fields are stored in the
+// clear when FIELD_ENCRYPTION is not set.
+const FieldEncryptionLocal = "local"
+
+// encryptedPrefix starts every encrypted field value. Values without it were
+// stored before encryption was enabled and are read as they are.
+const encryptedPrefix = "enc:v1:"
+
+// errNotEncrypted is returned when decrypting a value that is malformed
+var errNotEncrypted = errors.New("malformed encrypted field")
+
+// KeyEncrypter wraps the data keys that sensitive fields are encrypted with
+// under key encryption keys it holds, each named by a key ID. A KMS is used
+// by implementing it with the KMS's encrypt and decrypt calls. Rotating adds
+// a new current key; older keys must stay available to unwrap what they
+// wrapped until the re-encryption command has moved every field off them.
+type KeyEncrypter interface {
+	// CurrentKeyID names the key new data keys are wrapped under
+	CurrentKeyID() string
+	// WrapKey encrypts dek under the key keyID
+	WrapKey(ctx context.Context, keyID string, dek []byte) ([]byte, error)
+	// UnwrapKey decrypts a data key that WrapKey wrapped under keyID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// newFieldCipher builds the cipher selected by FIELD_ENCRYPTION, or nil when
+// sensitive fields are not encrypted
+func newFieldCipher() (*fieldCipher, error) {
+	switch v := os.Getenv("FIELD_ENCRYPTION"); v {
+	case "":
+		return nil, nil
+	case FieldEncryptionLocal:
+		keys, err := newLocalKeyEncrypter(os.Getenv("FIELD_ENCRYPTION_KEYS"))
+		if err != nil {
+			return nil, err
+		}
+		return newFieldCipherWith(keys), nil
+	default:
+		return nil, fmt.Errorf("unsupported FIELD_ENCRYPTION: %s", v)
+	}
+}
+
+// localKeyEncrypter holds key encryption keys given in the environment
+type localKeyEncrypter struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// newLocalKeyEncrypter parses FIELD_ENCRYPTION_KEYS: comma-separated
+// id:key pairs, each key 32 base64-encoded bytes. The first is current.
+func newLocalKeyEncrypter(spec string) (*localKeyEncrypter, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("FIELD_ENCRYPTION_KEYS is required when FIELD_ENCRYPTION=%s", FieldEncryptionLocal)
+	}
+	k := &localKeyEncrypter{keys: map[string]cipher.AEAD{}}
+	for _, pair := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid FIELD_ENCRYPTION_KEYS entry: want id:base64key")
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("FIELD_ENCRYPTION_KEYS repeats key %s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("FIELD_ENCRYPTION_KEYS key %s must be 32 base64-encoded bytes", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+		if k.current == "" {
+			k.current = id
+		}
+	}
+	return k, nil
+}
+
+func (k *localKeyEncrypter) CurrentKeyID() string {
+	return k.current
+}
+
+func (k *localKeyEncrypter) WrapKey(_ context.Context, keyID string, dek []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key encryption key %s", keyID)
+	}
+	return sealAEAD(aead, dek, []byte(keyID))
+}
+
+func (k *localKeyEncrypter) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key encryption key %s", keyID)
+	}
+	return openAEAD(aead, wrapped, []byte(keyID))
+}
+
+// fieldCipher envelope-encrypts field values with AES-256-GCM. Each process
+// encrypts under one data key per key encryption key, generated when first
+// needed, and stores it wrapped alongside every value. The field's name is
+// authenticated with its value, so a value copied into another column does
+// not decrypt.
+type fieldCipher struct {
+	keys KeyEncrypter
+
+	mu      sync.Mutex
+	current map[string]*dataKey // by key encryption key ID
+	unwraps map[string]cipher.AEAD
+}
+
+// dataKey is a data key and its wrapped form
+type dataKey struct {
+	aead    cipher.AEAD
+	wrapped string
+}
+
+func newFieldCipherWith(keys KeyEncrypter) *fieldCipher {
+	return &fieldCipher{keys: keys, current: map[string]*dataKey{}, unwraps: map[string]cipher.AEAD{}}
+}
+
+// encrypt returns value encrypted for field, leaving empty values empty
+func (c *fieldCipher) encrypt(ctx context.Context, field, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	keyID := c.keys.CurrentKeyID()
+	dk, err := c.dataKey(ctx, keyID)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := sealAEAD(dk.aead, []byte(value), []byte(field))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + keyID + ":" + dk.wrapped + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns the plaintext of a value encrypt returned for field.
+// Values stored before encryption was enabled are returned as they are.
+func (c *fieldCipher) decrypt(ctx context.Context, field, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", errNotEncrypted
+	}
+	aead, err := c.unwrap(ctx, parts[0], parts[1])
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errNotEncrypted
+	}
+	plain, err := openAEAD(aead, sealed, []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", field, err)
+	}
+	return string(plain), nil
+}
+
+// reencrypt returns value encrypted under the current key encryption key.
+// Values already under it are returned unchanged.
+func (c *fieldCipher) reencrypt(ctx context.Context, field, value string) (string, error) {
+	if value == "" || strings.HasPrefix(value, encryptedPrefix+c.keys.CurrentKeyID()+":") {
+		return value, nil
+	}
+	plain, err := c.decrypt(ctx, field, value)
+	if err != nil {
+		return "", err
+	}
+	return c.encrypt(ctx, field, plain)
+}
+
+// dataKey returns this process's data key under keyID, generating and
+// wrapping it the first time
+func (c *fieldCipher) dataKey(ctx context.Context, keyID string) (*dataKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if dk, ok := c.current[keyID]; ok {
+		return dk, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := c.keys.WrapKey(ctx, keyID, key)
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	dk := &dataKey{aead: aead, wrapped: base64.RawStdEncoding.EncodeToString(wrapped)}
+	c.current[keyID] = dk
+	c.unwraps[keyID+":"+dk.wrapped] = aead
+	return dk, nil
+}
+
+// unwrap returns the data key wrapped under keyID, asking the KeyEncrypter
+// only the first time each is seen
+func (c *fieldCipher) unwrap(ctx context.Context, keyID, wrapped string) (cipher.AEAD, error) {
+	c.mu.Lock()
+	aead, ok := c.unwraps[keyID+":"+wrapped]
+	c.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	raw, err := base64.RawStdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, errNotEncrypted
+	}
+	key, err := c.keys.UnwrapKey(ctx, keyID, raw)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	if aead, err = newAEAD(key); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.unwraps[keyID+":"+wrapped] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealAEAD encrypts plaintext under a random nonce, which it prepends
+func sealAEAD(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// openAEAD decrypts what sealAEAD returned
+func openAEAD(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errNotEncrypted
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// encryptingRepository encrypts sensitive fields on their way into another
+// Repository and decrypts them on the way out, so the service only ever
+// sees plaintext. The fields are the ones listed in sensitiveColumns.
+type encryptingRepository struct {
+	Repository
+	cipher *fieldCipher
+}
+
+func newEncryptingRepository(repo Repository, c *fieldCipher) *encryptingRepository {
+	return &encryptingRepository{Repository: repo, cipher: c}
+}
+
+func (e *encryptingRepository) ListBeneficiaries(ctx context.Context, accountIDs []int) ([]*Beneficiary, error) {
+	beneficiaries, err := e.Repository.ListBeneficiaries(ctx, accountIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range beneficiaries {
+		if b.Name, err = e.cipher.decrypt(ctx, "account_beneficiaries.name", b.Name); err != nil {
+			return nil, err
+		}
+		if b.Relationship, err = e.cipher.decrypt(ctx, "account_beneficiaries.relationship", b.Relationship); err != nil {
+			return nil, err
+		}
+	}
+	return beneficiaries, nil
+}
+
+func (e *encryptingRepository) ReplaceBeneficiaries(ctx context.Context, accountID int, beneficiaries []*Beneficiary) error {
+	// Encrypt copies, as the caller goes on to return its own
+	stored := make([]*Beneficiary, len(beneficiaries))
+	for i, b := range beneficiaries {
+		enc := *b
+		var err error
+		if enc.Name, err = e.cipher.encrypt(ctx, "account_beneficiaries.name", b.Name); err != nil {
+			return err
+		}
+		if enc.Relationship, err = e.cipher.encrypt(ctx, "account_beneficiaries.relationship", b.Relationship); err != nil {
+			return err
+		}
+		stored[i] = &enc
+	}
+	return e.Repository.ReplaceBeneficiaries(ctx, accountID, stored)
+}
+
+func (e *encryptingRepository) GetNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	prefs, err := e.Repository.GetNotificationPreferences(ctx, userID)
+	if err != nil || prefs == nil {
+		return prefs, err
+	}
+	return e.decryptPreferences(ctx, prefs)
+}
+
+func (e *encryptingRepository) SaveNotificationPreferences(ctx context.Context, prefs *NotificationPreferences) (*NotificationPreferences, error) {
+	enc := *prefs
+	var err error
+	if enc.Email, err = e.cipher.encrypt(ctx, "notification_preferences.email", prefs.Email); err != nil {
+		return nil, err
+	}
+	if enc.Phone, err = e.cipher.encrypt(ctx, "notification_preferences.phone", prefs.Phone); err != nil {
+		return nil, err
+	}
+	saved, err := e.Repository.SaveNotificationPreferences(ctx, &enc)
+	if err != nil {
+		return nil, err
+	}
+	return e.decryptPreferences(ctx, saved)
+}
+
+func (e *encryptingRepository) decryptPreferences(ctx context.Context, prefs *NotificationPreferences) (*NotificationPreferences, error) {
+	var err error
+	if prefs.Email, err = e.cipher.decrypt(ctx, "notification_preferences.email", prefs.Email); err != nil {
+		return nil, err
+	}
+	if prefs.Phone, err = e.cipher.decrypt(ctx, "notification_preferences.phone", prefs.Phone); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func (e *encryptingRepository) ArchiveAccount(ctx context.Context, a *ArchivedAccount) error {
+	record, err := e.cipher.encrypt(ctx, "archived_accounts.record", string(a.Record))
+	if err != nil {
+		return err
+	}
+	// The repository stores the record as given, so the ciphertext can stand
+	// in for it
+	enc := *a
+	enc.Record = json.RawMessage(record)
+	if err := e.Repository.ArchiveAccount(ctx, &enc); err != nil {
+		return err
+	}
+	a.ExternalID, a.TenantID = enc.ExternalID, enc.TenantID
+	return nil
+}
+
+func (e *encryptingRepository) GetArchivedAccount(ctx context.Context, accountID int) (*ArchivedAccount, error) {
+	archived, err := e.Repository.GetArchivedAccount(ctx, accountID)
+	if err != nil || archived == nil {
+		return archived, err
+	}
+	record, err := e.cipher.decrypt(ctx, "archived_accounts.record", string(archived.Record))
+	if err != nil {
+		return nil, err
+	}
+	archived.Record = json.RawMessage(record)
+	return archived, nil
+}
+
+// accountNumberField is the field every account number is encrypted for,
+// whichever column holds it, as the repository copies them between tables:
+// a closure's destination becomes its payout's
+const accountNumberField = "account_number"
+
+func (e *encryptingRepository) CreateAccount(ctx context.Context, a *BlockAccount, admit func(UserExposure, *BlockAccount) error) (*BlockAccount, error) {
+	enc, err := e.encryptAccount(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	if admit != nil {
+		check := admit
+		admit = func(exposure UserExposure, duplicate *BlockAccount) error {
+			if err := e.decryptAccount(ctx, duplicate); err != nil {
+				return err
+			}
+			return check(exposure, duplicate)
+		}
+	}
+	account, err := e.Repository.CreateAccount(ctx, enc, admit)
+	if err != nil {
+		return nil, err
+	}
+	return account, e.decryptAccount(ctx, account)
+}
+
+func (e *encryptingRepository) CreateAccounts(ctx context.Context, accounts []*BlockAccount, record func([]*BlockAccount) *AccountImport) ([]*BlockAccount, error) {
+	stored := make([]*BlockAccount, len(accounts))
+	for i, a := range accounts {
+		var err error
+		if stored[i], err = e.encryptAccount(ctx, a); err != nil {
+			return nil, err
+		}
+	}
+	return e.decryptAccounts(ctx)(e.Repository.CreateAccounts(ctx, stored, record))
+}
+
+func (e *encryptingRepository) GetAccount(ctx context.Context, id int) (*BlockAccount, error) {
+	account, err := e.Repository.GetAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return account, e.decryptAccount(ctx, account)
+}
+
+func (e *encryptingRepository) GetAccountsByExternalID(ctx context.Context, externalIDs []string) ([]*BlockAccount, error) {
+	return e.decryptAccounts(ctx)(e.Repository.GetAccountsByExternalID(ctx, externalIDs))
+}
+
+func (e *encryptingRepository) ListAccountsByUser(ctx context.Context, userID int) ([]*BlockAccount, error) {
+	return e.decryptAccounts(ctx)(e.Repository.ListAccountsByUser(ctx, userID))
+}
+
+func (e *encryptingRepository) ListAccountsOverlapping(ctx context.Context, userID int, from, to time.Time) ([]*BlockAccount, error) {
+	return e.decryptAccounts(ctx)(e.Repository.ListAccountsOverlapping(ctx, userID, from, to))
+}
+
+func (e *encryptingRepository) ListMaturingBetween(ctx context.Context, from, to time.Time, limit int) ([]*BlockAccount, error) {
+	return e.decryptAccounts(ctx)(e.Repository.ListMaturingBetween(ctx, from, to, limit))
+}
+
+func (e *encryptingRepository) ListAccountsUpdatedAfter(ctx context.Context, updatedAt time.Time, id, limit int) ([]*BlockAccount, error) {
+	return e.decryptAccounts(ctx)(e.Repository.ListAccountsUpdatedAfter(ctx, updatedAt, id, limit))
+}
+
+func (e *encryptingRepository) ListAccountsAfter(ctx context.Context, afterID int, statuses []string, limit int) ([]*BlockAccount, error) {
+	return e.decryptAccounts(ctx)(e.Repository.ListAccountsAfter(ctx, afterID, statuses, limit))
+}
+
+func (e *encryptingRepository) ListDueMaturityReminders(ctx context.Context, now time.Time, defaultDays, limit int) ([]*BlockAccount, error) {
+	return e.decryptAccounts(ctx)(e.Repository.ListDueMaturityReminders(ctx, now, defaultDays, limit))
+}
+
+func (e *encryptingRepository) DeleteAccount(ctx context.Context, id int, check func(*BlockAccount) error) error {
+	return e.Repository.DeleteAccount(ctx, id, e.decryptingCheck(ctx, check))
+}
+
+func (e *encryptingRepository) UpdateAccountStatus(ctx context.Context, id int, status string, check func(*BlockAccount) error) (*BlockAccount, error) {
+	account, err := e.Repository.UpdateAccountStatus(ctx, id, status, e.decryptingCheck(ctx, check))
+	if err != nil {
+		return nil, err
+	}
+	return account, e.decryptAccount(ctx, account)
+}
+
+func (e *encryptingRepository) UpdateMaturityInstruction(ctx context.Context, id int, instruction, destination string, check func(*BlockAccount) error) (*BlockAccount, error) {
+	destination, err := e.cipher.encrypt(ctx, accountNumberField, destination)
+	if err != nil {
+		return nil, err
+	}
+	account, err := e.Repository.UpdateMaturityInstruction(ctx, id, instruction, destination, e.decryptingCheck(ctx, check))
+	if err != nil {
+		return nil, err
+	}
+	return account, e.decryptAccount(ctx, account)
+}
+
+func (e *encryptingRepository) BeginClosure(ctx context.Context, id int, plan func(*BlockAccount) (*AccountClosure, error)) (*BlockAccount, error) {
+	account, err := e.Repository.BeginClosure(ctx, id, func(a *BlockAccount) (*AccountClosure, error) {
+		if err := e.decryptAccount(ctx, a); err != nil {
+			return nil, err
+		}
+		closure, err := plan(a)
+		if err != nil {
+			return nil, err
+		}
+		enc := *closure
+		if enc.DestinationAccount, err = e.cipher.encrypt(ctx, accountNumberField, closure.DestinationAccount); err != nil {
+			return nil, err
+		}
+		return &enc, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, e.decryptAccount(ctx, account)
+}
+
+func (e *encryptingRepository) GetClosure(ctx context.Context, accountID int) (*AccountClosure, error) {
+	closure, err := e.Repository.GetClosure(ctx, accountID)
+	if err != nil || closure == nil {
+		return closure, err
+	}
+	if closure.DestinationAccount, err = e.cipher.decrypt(ctx, accountNumberField, closure.DestinationAccount); err != nil {
+		return nil, err
+	}
+	return closure, nil
+}
+
+func (e *encryptingRepository) GetFunding(ctx context.Context, accountID int) (*Funding, error) {
+	funding, err := e.Repository.GetFunding(ctx, accountID)
+	if err != nil || funding == nil {
+		return funding, err
+	}
+	if funding.SettlementAccount, err = e.cipher.decrypt(ctx, accountNumberField, funding.SettlementAccount); err != nil {
+		return nil, err
+	}
+	return funding, nil
+}
+
+func (e *encryptingRepository) ListFundingsOf(ctx context.Context, accountIDs []int) ([]*Funding, error) {
+	return e.decryptFundings(ctx)(e.Repository.ListFundingsOf(ctx, accountIDs))
+}
+
+func (e *encryptingRepository) ListPendingFundings(ctx context.Context, afterAccountID, limit int) ([]*Funding, error) {
+	return e.decryptFundings(ctx)(e.Repository.ListPendingFundings(ctx, afterAccountID, limit))
+}
+
+func (e *encryptingRepository) SettleFunding(ctx context.Context, accountID int, plan func(*BlockAccount) (*FundingOutcome, error)) (*BlockAccount, error) {
+	account, err := e.Repository.SettleFunding(ctx, accountID, func(a *BlockAccount) (*FundingOutcome, error) {
+		if err := e.decryptAccount(ctx, a); err != nil {
+			return nil, err
+		}
+		return plan(a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, e.decryptAccount(ctx, account)
+}
+
+func (e *encryptingRepository) MatureDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*MaturityOutcome, error)) (int, error) {
+	return e.Repository.MatureDue(ctx, now, limit, e.encryptingMaturityPlan(ctx, plan))
+}
+
+func (e *encryptingRepository) MatureAccount(ctx context.Context, id int, now time.Time, plan func(*BlockAccount) (*MaturityOutcome, error)) (bool, error) {
+	return e.Repository.MatureAccount(ctx, id, now, e.encryptingMaturityPlan(ctx, plan))
+}
+
+// encryptingMaturityPlan passes plan the account decrypted and encrypts the
+// destinations of the rollover and payout it returns
+func (e *encryptingRepository) encryptingMaturityPlan(ctx context.Context, plan func(*BlockAccount) (*MaturityOutcome, error)) func(*BlockAccount) (*MaturityOutcome, error) {
+	return func(a *BlockAccount) (*MaturityOutcome, error) {
+		if err := e.decryptAccount(ctx, a); err != nil {
+			return nil, err
+		}
+		outcome, err := plan(a)
+		if err != nil {
+			return nil, err
+		}
+		enc := *outcome
+		if outcome.Rollover != nil {
+			if enc.Rollover, err = e.encryptAccount(ctx, outcome.Rollover); err != nil {
+				return nil, err
+			}
+		}
+		if outcome.Payout != nil {
+			payout := *outcome.Payout
+			if payout.Destination, err = e.cipher.encrypt(ctx, accountNumberField, payout.Destination); err != nil {
+				return nil, err
+			}
+			enc.Payout = &payout
+		}
+		return &enc, nil
+	}
+}
+
+func (e *encryptingRepository) PayInterestDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*InterestOutcome, error)) (int, error) {
+	return e.Repository.PayInterestDue(ctx, now, limit, func(a *BlockAccount) (*InterestOutcome, error) {
+		if err := e.decryptAccount(ctx, a); err != nil {
+			return nil, err
+		}
+		outcome, err := plan(a)
+		if err != nil {
+			return nil, err
+		}
+		enc, payout := *outcome, *outcome.Payout
+		if payout.Destination, err = e.cipher.encrypt(ctx, accountNumberField, payout.Destination); err != nil {
+			return nil, err
+		}
+		enc.Payout = &payout
+		return &enc, nil
+	})
+}
+
+func (e *encryptingRepository) ListInterestPayouts(ctx context.Context, accountID int) ([]*InterestPayout, error) {
+	return e.decryptInterestPayouts(ctx)(e.Repository.ListInterestPayouts(ctx, accountID))
+}
+
+func (e *encryptingRepository) ListInterestPayoutsOf(ctx context.Context, accountIDs []int) ([]*InterestPayout, error) {
+	return e.decryptInterestPayouts(ctx)(e.Repository.ListInterestPayoutsOf(ctx, accountIDs))
+}
+
+func (e *encryptingRepository) AdjustInterest(ctx context.Context, accountID int, plan func(*BlockAccount, []*InterestPayout, []*InterestAdjustment) (*InterestAdjustment, error)) (*BlockAccount, *InterestAdjustment, error) {
+	account, adj, err := e.Repository.AdjustInterest(ctx, accountID, func(a *BlockAccount, paid []*InterestPayout, prior []*InterestAdjustment) (*InterestAdjustment, error) {
+		if err := e.decryptAccount(ctx, a); err != nil {
+			return nil, err
+		}
+		if _, err := e.decryptInterestPayouts(ctx)(paid, nil); err != nil {
+			return nil, err
+		}
+		return plan(a, paid, prior)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, adj, e.decryptAccount(ctx, account)
+}
+
+func (e *encryptingRepository) ListPayouts(ctx context.Context, accountID int) ([]*Payout, error) {
+	return e.decryptPayouts(ctx)(e.Repository.ListPayouts(ctx, accountID))
+}
+
+func (e *encryptingRepository) ListPayoutsOf(ctx context.Context, accountIDs []int) ([]*Payout, error) {
+	return e.decryptPayouts(ctx)(e.Repository.ListPayoutsOf(ctx, accountIDs))
+}
+
+func (e *encryptingRepository) ConfirmPayout(ctx context.Context, accountID int) (*Payout, bool, error) {
+	payout, closed, err := e.Repository.ConfirmPayout(ctx, accountID)
+	if err != nil || payout == nil {
+		return payout, closed, err
+	}
+	return payout, closed, e.decryptPayout(ctx, payout)
+}
+
+func (e *encryptingRepository) FailPayout(ctx context.Context, accountID int, reason string) (*Payout, int, error) {
+	payout, userID, err := e.Repository.FailPayout(ctx, accountID, reason)
+	if err != nil || payout == nil {
+		return payout, userID, err
+	}
+	return payout, userID, e.decryptPayout(ctx, payout)
+}
+
+func (e *encryptingRepository) RetryPayout(ctx context.Context, accountID int, destination string) (*Payout, int, error) {
+	destination, err := e.cipher.encrypt(ctx, accountNumberField, destination)
+	if err != nil {
+		return nil, 0, err
+	}
+	payout, userID, err := e.Repository.RetryPayout(ctx, accountID, destination)
+	if err != nil || payout == nil {
+		return payout, userID, err
+	}
+	return payout, userID, e.decryptPayout(ctx, payout)
+}
+
+// encryptAccount returns a copy of a with its account numbers encrypted, as
+// the caller goes on to use its own
+func (e *encryptingRepository) encryptAccount(ctx context.Context, a *BlockAccount) (*BlockAccount, error) {
+	enc := *a
+	var err error
+	if enc.PayoutDestination, err = e.cipher.encrypt(ctx, accountNumberField, a.PayoutDestination); err != nil {
+		return nil, err
+	}
+	if a.Funding != nil {
+		funding := *a.Funding
+		if funding.SettlementAccount, err = e.cipher.encrypt(ctx, accountNumberField, a.Funding.SettlementAccount); err != nil {
+			return nil, err
+		}
+		enc.Funding = &funding
+	}
+	return &enc, nil
+}
+
+// decryptAccount decrypts the account numbers of a, which may be nil, in
+// place
+func (e *encryptingRepository) decryptAccount(ctx context.Context, a *BlockAccount) error {
+	if a == nil {
+		return nil
+	}
+	var err error
+	if a.PayoutDestination, err = e.cipher.decrypt(ctx, accountNumberField, a.PayoutDestination); err != nil {
+		return err
+	}
+	if a.Funding != nil {
+		if a.Funding.SettlementAccount, err = e.cipher.decrypt(ctx, accountNumberField, a.Funding.SettlementAccount); err != nil {
+			return err
+		}
+	}
+	if a.Closure != nil {
+		if a.Closure.DestinationAccount, err = e.cipher.decrypt(ctx, accountNumberField, a.Closure.DestinationAccount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptingCheck passes check the account decrypted
+func (e *encryptingRepository) decryptingCheck(ctx context.Context, check func(*BlockAccount) error) func(*BlockAccount) error {
+	return func(a *BlockAccount) error {
+		if err := e.decryptAccount(ctx, a); err != nil {
+			return err
+		}
+		return check(a)
+	}
+}
+
+// decryptAccounts returns a function decrypting the accounts a repository
+// call returned, so the call's results can be passed straight to it
+func (e *encryptingRepository) decryptAccounts(ctx context.Context) func([]*BlockAccount, error) ([]*BlockAccount, error) {
+	return func(accounts []*BlockAccount, err error) ([]*BlockAccount, error) {
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range accounts {
+			if err := e.decryptAccount(ctx, a); err != nil {
+				return nil, err
+			}
+		}
+		return accounts, nil
+	}
+}
+
+// decryptFundings is decryptAccounts for fundings
+func (e *encryptingRepository) decryptFundings(ctx context.Context) func([]*Funding, error) ([]*Funding, error) {
+	return func(fundings []*Funding, err error) ([]*Funding, error) {
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fundings {
+			if f.SettlementAccount, err = e.cipher.decrypt(ctx, accountNumberField, f.SettlementAccount); err != nil {
+				return nil, err
+			}
+		}
+		return fundings, nil
+	}
+}
+
+func (e *encryptingRepository) decryptPayout(ctx context.Context, p *Payout) error {
+	var err error
+	p.Destination, err = e.cipher.decrypt(ctx, accountNumberField, p.Destination)
+	return err
+}
+
+// decryptPayouts is decryptAccounts for payouts
+func (e *encryptingRepository) decryptPayouts(ctx context.Context) func([]*Payout, error) ([]*Payout, error) {
+	return func(payouts []*Payout, err error) ([]*Payout, error) {
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range payouts {
+			if err := e.decryptPayout(ctx, p); err != nil {
+				return nil, err
+			}
+		}
+		return payouts, nil
+	}
+}
+
+// decryptInterestPayouts is decryptAccounts for interest payouts
+func (e *encryptingRepository) decryptInterestPayouts(ctx context.Context) func([]*InterestPayout, error) ([]*InterestPayout, error) {
+	return func(payouts []*InterestPayout, err error) ([]*InterestPayout, error) {
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range payouts {
+			if p.Destination, err = e.cipher.decrypt(ctx, accountNumberField, p.Destination); err != nil {
+				return nil, err
+			}
+		}
+		return payouts, nil
+	}
+}
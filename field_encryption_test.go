@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKeys returns FIELD_ENCRYPTION_KEYS naming fresh keys with ids, the
+// first current
+func testKeys(t *testing.T, ids ...string) string {
+	t.Helper()
+	var pairs []string
+	for _, id := range ids {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		pairs = append(pairs, id+":"+base64.StdEncoding.EncodeToString(key))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func testFieldCipher(t *testing.T, spec string) *fieldCipher {
+	t.Helper()
+	keys, err := newLocalKeyEncrypter(spec)
+	if err != nil {
+		t.Fatalf("keys: %v", err)
+	}
+	return newFieldCipherWith(keys)
+}
+
+func TestFieldCipher(t *testing.T) {
+	ctx := context.Background()
+	spec := testKeys(t, "k1")
+	c := testFieldCipher(t, spec)
+
+	sealed, err := c.encrypt(ctx, "account_beneficiaries.name", "Almaz Tesfaye")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, encryptedPrefix+"k1:") || strings.Contains(sealed, "Almaz") {
+		t.Fatalf("encrypted = %q, want ciphertext under k1", sealed)
+	}
+	if plain, err := c.decrypt(ctx, "account_beneficiaries.name", sealed); err != nil || plain != "Almaz Tesfaye" {
+		t.Errorf("decrypt = %q, %v, want Almaz Tesfaye", plain, err)
+	}
+	if _, err := c.decrypt(ctx, "account_beneficiaries.relationship", sealed); err == nil {
+		t.Error("decrypting as another field succeeded, want an error")
+	}
+	if plain, err := c.decrypt(ctx, "account_beneficiaries.name", "stored before encryption"); err != nil || plain != "stored before encryption" {
+		t.Errorf("decrypt plaintext = %q, %v, want it unchanged", plain, err)
+	}
+	if empty, _ := c.encrypt(ctx, "notification_preferences.email", ""); empty != "" {
+		t.Errorf("encrypt empty = %q, want empty", empty)
+	}
+
+	// After rotation the old key still decrypts, and reencrypt moves values
+	// onto the new one
+	rotated := testFieldCipher(t, testKeys(t, "k2")+","+spec)
+	if plain, err := rotated.decrypt(ctx, "account_beneficiaries.name", sealed); err != nil || plain != "Almaz Tesfaye" {
+		t.Errorf("decrypt after rotation = %q, %v", plain, err)
+	}
+	moved, err := rotated.reencrypt(ctx, "account_beneficiaries.name", sealed)
+	if err != nil || !strings.HasPrefix(moved, encryptedPrefix+"k2:") {
+		t.Fatalf("reencrypt = %q, %v, want ciphertext under k2", moved, err)
+	}
+	if again, _ := rotated.reencrypt(ctx, "account_beneficiaries.name", moved); again != moved {
+		t.Error("reencrypt rewrote a value already under the current key")
+	}
+}
+
+func TestEncryptingRepository(t *testing.T) {
+	ctx := context.Background()
+	base, db := testRepository(t, testDatabase(t, DriverSQLite))
+	account := mustCreate(t, base, testAccount(1, time.Now().UTC()))
+
+	// A beneficiary named before encryption was enabled
+	if err := base.ReplaceBeneficiaries(ctx, account.ID, []*Beneficiary{
+		{AccountID: account.ID, Name: "Almaz", Relationship: "spouse", AllocationPercent: 100, DesignatedAt: time.Now().UTC()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := testFieldCipher(t, testKeys(t, "k1"))
+	repo := newEncryptingRepository(base, c)
+	if _, err := repo.SaveNotificationPreferences(ctx, &NotificationPreferences{UserID: 1, Email: "almaz@example.com", ReminderDays: 7}); err != nil {
+		t.Fatal(err)
+	}
+	var email string
+	if err := db.QueryRow(`SELECT email FROM notification_preferences WHERE user_id=1`).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(email, encryptedPrefix) {
+		t.Errorf("stored email = %q, want it encrypted", email)
+	}
+	if prefs, err := repo.GetNotificationPreferences(ctx, 1); err != nil || prefs.Email != "almaz@example.com" {
+		t.Errorf("preferences = %+v, %v, want the email decrypted", prefs, err)
+	}
+
+	n, err := repo.RewriteSensitiveFields(ctx, c.reencrypt)
+	if err != nil || n != 1 {
+		t.Fatalf("reencrypt = %d, %v, want the beneficiary rewritten", n, err)
+	}
+	var name string
+	if err := db.QueryRow(`SELECT name FROM account_beneficiaries WHERE account_id=?`, account.ID).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(name, encryptedPrefix) {
+		t.Errorf("stored name = %q, want it encrypted", name)
+	}
+	beneficiaries, err := repo.ListBeneficiaries(ctx, []int{account.ID})
+	if err != nil || len(beneficiaries) != 1 || beneficiaries[0].Name != "Almaz" || beneficiaries[0].Relationship != "spouse" {
+		t.Errorf("beneficiaries = %+v, %v, want Almaz decrypted", beneficiaries, err)
+	}
+}
+
+func TestEncryptingRepositoryAccountNumbers(t *testing.T) {
+	ctx := context.Background()
+	base, db := testRepository(t, testDatabase(t, DriverSQLite))
+	stored := func(query string, id int) string {
+		t.Helper()
+		var value string
+		if err := db.QueryRow(query, id).Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	// An account opened before encryption was enabled
+	earlier := testAccount(2, time.Now().UTC())
+	earlier.PayoutDestination = "3000123456789"
+	earlier = mustCreate(t, base, earlier)
+
+	c := testFieldCipher(t, testKeys(t, "k1"))
+	repo := newEncryptingRepository(base, c)
+	a := testAccount(2, time.Now().UTC())
+	a.PayoutDestination = "1000123456789"
+	a.Funding = newFunding("2000123456789", a.Principal)
+	created := mustCreate(t, repo, a)
+	if created.PayoutDestination != "1000123456789" || created.Funding.SettlementAccount != "2000123456789" ||
+		a.PayoutDestination != "1000123456789" {
+		t.Errorf("created = %+v, funding %+v, want the account numbers returned in plaintext", created, created.Funding)
+	}
+	if v := stored(`SELECT payout_destination FROM block_accounts WHERE id=?`, created.ID); !strings.HasPrefix(v, encryptedPrefix) {
+		t.Errorf("stored payout destination = %q, want it encrypted", v)
+	}
+	if v := stored(`SELECT settlement_account FROM account_fundings WHERE account_id=?`, created.ID); !strings.HasPrefix(v, encryptedPrefix) {
+		t.Errorf("stored settlement account = %q, want it encrypted", v)
+	}
+
+	// Closing copies the destination into the final payout, where it still
+	// decrypts
+	_, err := repo.BeginClosure(ctx, created.ID, func(account *BlockAccount) (*AccountClosure, error) {
+		if account.PayoutDestination != "1000123456789" {
+			t.Errorf("closure planned with destination %q, want it decrypted", account.PayoutDestination)
+		}
+		return &AccountClosure{DestinationAccount: "4000123456789", Method: SettlementBankTransfer, Amount: 1000, RequestedAt: time.Now().UTC()}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := stored(`SELECT destination_account FROM payouts WHERE account_id=?`, created.ID); !strings.HasPrefix(v, encryptedPrefix) {
+		t.Errorf("stored payout destination = %q, want it encrypted", v)
+	}
+	if closure, err := repo.GetClosure(ctx, created.ID); err != nil || closure.DestinationAccount != "4000123456789" {
+		t.Errorf("closure = %+v, %v, want its destination decrypted", closure, err)
+	}
+	if payouts, err := repo.ListPayouts(ctx, created.ID); err != nil || len(payouts) != 1 || payouts[0].Destination != "4000123456789" {
+		t.Errorf("payouts = %+v, %v, want the destination decrypted", payouts, err)
+	}
+
+	// Re-encryption moves the earlier account's destination off plaintext
+	n, err := repo.RewriteSensitiveFields(ctx, c.reencrypt)
+	if err != nil || n != 1 {
+		t.Fatalf("reencrypt = %d, %v, want the earlier account rewritten", n, err)
+	}
+	if v := stored(`SELECT payout_destination FROM block_accounts WHERE id=?`, earlier.ID); !strings.HasPrefix(v, encryptedPrefix) {
+		t.Errorf("stored earlier destination = %q, want it encrypted", v)
+	}
+	if account, err := repo.GetAccount(ctx, earlier.ID); err != nil || account.PayoutDestination != "3000123456789" {
+		t.Errorf("earlier account = %+v, %v, want its destination decrypted", account, err)
+	}
+}
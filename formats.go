@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Formats a success response can be written in. JSON is the default; the
+// others are chosen through Accept.
+const (
+	formatJSON = "json"
+	formatBare = "bare"
+	formatXML  = "xml"
+	formatCSV  = "csv"
+)
+
+// formatMediaTypes maps the media types a client may list in Accept to the
+// format they select. Wildcards select JSON.
+var formatMediaTypes = map[string]string{
+	"application/json": formatJSON,
+	"application/*":    formatJSON,
+	"*/*":              formatJSON,
+	BareMediaType:      formatBare,
+	"application/xml":  formatXML,
+	"text/xml":         formatXML,
+	"text/csv":         formatCSV,
+}
+
+// formatContentTypes is the Content-Type each format is written with
+var formatContentTypes = map[string]string{
+	formatJSON: "application/json",
+	formatBare: BareMediaType,
+	formatXML:  "application/xml; charset=utf-8",
+	formatCSV:  "text/csv; charset=utf-8",
+}
+
+// responseFormat returns the format r's Accept header prefers: the
+// supported media type with the highest q, the first listed on a tie. Bare
+// responses count only while they are enabled for the caller, and requests
+// accepting nothing supported get JSON.
+func responseFormat(r *http.Request) string {
+	best, bestQ := formatJSON, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		format, ok := formatMediaTypes[mediaType]
+		if !ok || format == formatBare && !featureOn(r.Context(), FeatureBareResponses) {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// jsonNode is a decoded JSON value that keeps the order of object keys, so
+// XML elements and CSV columns come out in the order of the JSON fields
+type jsonNode struct {
+	// kind is '{' for an object, '[' for an array, 's' for a string, 'n'
+	// for a number, 'b' for a boolean and 0 for null
+	kind byte
+	// keys are an object's keys and values its values, or an array's items
+	keys   []string
+	values []*jsonNode
+	// text is a scalar as written in the JSON
+	text string
+}
+
+// toJSONNode encodes v as the JSON responses carry and decodes it again
+func toJSONNode(v any) (*jsonNode, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return readJSONNode(dec)
+}
+
+// readJSONNode reads the next JSON value from dec
+func readJSONNode(dec *json.Decoder) (*jsonNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		node := &jsonNode{kind: byte(v)}
+		for dec.More() {
+			if node.kind == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, key.(string))
+			}
+			value, err := readJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.values = append(node.values, value)
+		}
+		// The closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &jsonNode{kind: 's', text: v}, nil
+	case json.Number:
+		return &jsonNode{kind: 'n', text: v.String()}, nil
+	case bool:
+		return &jsonNode{kind: 'b', text: strconv.FormatBool(v)}, nil
+	}
+	return &jsonNode{}, nil
+}
+
+// MarshalJSON writes the node back as JSON, for arrays in a CSV cell
+func (n *jsonNode) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	switch n.kind {
+	case '{', '[':
+		b.WriteByte(n.kind)
+		for i, value := range n.values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if n.kind == '{' {
+				key, _ := json.Marshal(n.keys[i])
+				b.Write(key)
+				b.WriteByte(':')
+			}
+			data, _ := value.MarshalJSON()
+			b.Write(data)
+		}
+		b.WriteByte(n.kind + 2) // '{'+2 is '}' and '['+2 is ']'
+	case 's':
+		data, _ := json.Marshal(n.text)
+		b.Write(data)
+	case 'n', 'b':
+		b.WriteString(n.text)
+	default:
+		b.WriteString("null")
+	}
+	return b.Bytes(), nil
+}
+
+// xmlName reports whether key can be used as an XML element name as it is
+func xmlName(key string) bool {
+	if key == "" || strings.HasPrefix(strings.ToLower(key), "xml") {
+		return false
+	}
+	for i, c := range key {
+		letter := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || c != '-' && c != '.' && (c < '0' || c > '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeXMLNode writes node as an element named name. Object keys become
+// child elements, or entry elements with a key attribute when the key is
+// no XML name, and array items become item elements. Null is an empty
+// element.
+func encodeXMLNode(enc *xml.Encoder, name string, node *jsonNode) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlName(name) {
+		start = xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}}}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch node.kind {
+	case '{':
+		for i, value := range node.values {
+			if err := encodeXMLNode(enc, node.keys[i], value); err != nil {
+				return err
+			}
+		}
+	case '[':
+		for _, value := range node.values {
+			if err := encodeXMLNode(enc, "item", value); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := enc.EncodeToken(xml.CharData(node.text)); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// encodeXML renders v, as it is written in JSON, as an XML document whose
+// root element is named root
+func encodeXML(root string, v any) ([]byte, error) {
+	node, err := toJSONNode(v)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	enc := xml.NewEncoder(&b)
+	if err := encodeXMLNode(enc, root, node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// csvRow is one CSV row by column name
+type csvRow map[string]string
+
+// flattenCSV adds node to row under column name. Nested objects spread into
+// columns named by their path, joined with dots; arrays are written as JSON
+// in one cell.
+func flattenCSV(row csvRow, columns *[]string, name string, node *jsonNode) {
+	if node.kind == '{' && len(node.values) > 0 {
+		for i, value := range node.values {
+			key := node.keys[i]
+			if name != "" {
+				key = name + "." + key
+			}
+			flattenCSV(row, columns, key, value)
+		}
+		return
+	}
+	if name == "" {
+		name = "value"
+	}
+	if _, seen := row[name]; !seen {
+		*columns = append(*columns, name)
+	}
+	switch node.kind {
+	case '{', '[':
+		data, _ := node.MarshalJSON()
+		row[name] = string(data)
+	case 's':
+		row[name] = csvSafe(node.text)
+	default:
+		row[name] = node.text
+	}
+}
+
+// csvSafe keeps a spreadsheet from reading a text cell as a formula
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// encodeCSV renders v as CSV with a header row. A list, or the items of a
+// Page, is one row per item; anything else is a single row. Columns are the
+// JSON fields in the order they first appear.
+func encodeCSV(v any) ([]byte, error) {
+	if page, ok := v.(Page); ok {
+		v = page.Items
+	}
+	node, err := toJSONNode(v)
+	if err != nil {
+		return nil, err
+	}
+	items := []*jsonNode{node}
+	if node.kind == '[' {
+		items = node.values
+	}
+
+	var columns []string
+	seen := map[string]bool{}
+	rows := make([]csvRow, len(items))
+	for i, item := range items {
+		var added []string
+		rows[i] = csvRow{}
+		flattenCSV(rows[i], &added, "", item)
+		for _, column := range added {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	out := csv.NewWriter(&b)
+	if len(columns) > 0 {
+		out.Write(columns)
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		out.Write(record)
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return nil, fmt.Errorf("write CSV: %w", err)
+	}
+	return b.Bytes(), nil
+}
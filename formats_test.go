@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResponseFormat(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                  formatJSON,
+		"text/html":                         formatJSON,
+		"*/*":                               formatJSON,
+		"application/xml":                   formatXML,
+		"text/xml; charset=utf-8":           formatXML,
+		"text/csv":                          formatCSV,
+		"application/json, text/csv":        formatJSON,
+		"application/json;q=0.5, text/csv":  formatCSV,
+		"text/csv;q=0, application/xml;q=1": formatXML,
+		BareMediaType:                       formatBare,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/v2/products", nil)
+		r.Header.Set("Accept", accept)
+		if got := responseFormat(r); got != want {
+			t.Errorf("Accept %q: format %s, want %s", accept, got, want)
+		}
+	}
+}
+
+func TestXMLAndCSVResponses(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(81)
+	api.createAccount(81)
+
+	w := api.do(http.MethodGet, "/v2/block-account/"+id, "", "Accept", "application/xml")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("XML account: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var doc struct {
+		XMLName xml.Name `xml:"response"`
+		Success bool     `xml:"success"`
+		Data    struct {
+			ID        string  `xml:"id"`
+			UserID    int     `xml:"user_id"`
+			Principal float64 `xml:"principal"`
+		} `xml:"data"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil || !doc.Success || doc.Data.ID != id ||
+		doc.Data.UserID != 81 || doc.Data.Principal != 1000 {
+		t.Errorf("XML account = %+v (%v)\n%s", doc, err, w.Body)
+	}
+	if etag := w.Header().Get("ETag"); etag == api.etag(id) || etagVersion(etag) == "" {
+		t.Errorf("XML ETag %s, JSON ETag %s", etag, api.etag(id))
+	}
+
+	w = api.do(http.MethodGet, "/v2/user/81/block-accounts?limit=1", "", "Accept", "text/csv")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" ||
+		!strings.Contains(w.Header().Get("Link"), "cursor=") {
+		t.Fatalf("CSV list: %d %s %s", w.Code, w.Header(), w.Body)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("CSV list = %q (%v)", records, err)
+	}
+	header := records[0]
+	for _, column := range []string{"id", "user_id", "principal", "status"} {
+		if !slices.Contains(header, column) {
+			t.Errorf("CSV header %q lacks %s", header, column)
+		}
+	}
+
+	// Errors keep their JSON format
+	w = api.do(http.MethodGet, "/v2/block-account/not-an-id", "", "Accept", "text/csv")
+	if w.Code != http.StatusBadRequest || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("CSV error: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	type nested struct {
+		Code string `json:"code"`
+	}
+	type row struct {
+		Name   string   `json:"name"`
+		Amount float64  `json:"amount"`
+		Tags   []string `json:"tags"`
+		Plan   *nested  `json:"plan,omitempty"`
+	}
+	body, err := encodeCSV(Page{Items: []row{
+		{Name: "=SUM(A1)", Amount: -5, Tags: []string{"a", "b"}},
+		{Name: "plain", Amount: 2.5, Plan: &nested{Code: "1y"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "name,amount,tags,plan.code\n'=SUM(A1),-5,\"[\"\"a\"\",\"\"b\"\"]\",\nplain,2.5,,1y\n"
+	if string(body) != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", body, want)
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// StatusPendingFunding is an account waiting for its principal to be debited
+// from the customer's settlement account. It becomes active once the debit is
+// confirmed, or funding_failed if the debit is declined or times out.
+const (
+	StatusPendingFunding = "pending_funding"
+	StatusFundingFailed  = "funding_failed"
+)
+
+// Funding and debit statuses
+const (
+	FundingPending   = "pending"
+	FundingConfirmed = "confirmed"
+	FundingFailed    = "failed"
+	FundingExpired   = "expired"
+	// FundingUnknown is reported by a provider that has no record of the debit
+	FundingUnknown = "unknown"
+)
+
+// Supported FUNDING_PROVIDER values. Accounts open active without moving money
+// when FUNDING_PROVIDER is not set.
+const (
+	FundingProviderSandbox = "sandbox"
+	FundingProviderHTTP    = "http"
+)
+
+var (
+	// ErrSettlementAccountRequired is returned when funding is enabled and no settlement account was given
+	ErrSettlementAccountRequired = newAPIError(CodeSettlementAccountRequired, "settlement_account is required")
+	// ErrFundingDeclined is returned when the provider declines the debit outright
+	ErrFundingDeclined = newAPIError(CodeFundingDeclined, "funding declined")
+)
+
+// Funding is the debit that moves an account's principal from the customer's
+// settlement account
+// @Description Debit funding a block account from the customer's settlement account
+type Funding struct {
+	AccountID         int     `json:"-"`
+	AccountExternalID string  `json:"-"`
+	SettlementAccount string  `json:"settlement_account" example:"*********6789"`
+	Reference         string  `json:"reference" example:"2f1c9a6e-8a0e-4d55-9a57-1d2a4c7f9b10"`
+	Amount            float64 `json:"amount" example:"1000.00"`
+	// Status is "pending", "confirmed", "failed" or "expired"
+	Status        string     `json:"status" example:"pending"`
+	FailureReason string     `json:"failure_reason,omitempty" example:"insufficient funds"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	SettledAt     *time.Time `json:"settled_at,omitempty"`
+}
+
+// FundingResult is a provider's answer about a debit
+type FundingResult struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// FundingOutcome is how a pending funding settles. A confirmed funding
+// activates the account with its term restarted at the confirmation time.
+type FundingOutcome struct {
+	Status         string
+	Reason         string
+	StartDate      time.Time
+	EndDate        time.Time
+	NextPayoutDate *time.Time
+}
+
+// FundingProvider moves money from customers' settlement accounts through the
+// payments or core-banking API. Every call is keyed by the funding's
+// reference, so repeating one is safe.
+type FundingProvider interface {
+	// Debit asks for the funding's amount to be taken from its settlement
+	// account and reports whether it is confirmed, pending or failed
+	Debit(ctx context.Context, f *Funding) (*FundingResult, error)
+	// DebitStatus reports a debit's current status, or unknown when the
+	// provider never received it
+	DebitStatus(ctx context.Context, f *Funding) (*FundingResult, error)
+	// CancelDebit stops a pending debit. It fails if the debit has already
+	// been confirmed.
+	CancelDebit(ctx context.Context, f *Funding) error
+}
+
+// newFundingProvider builds the provider selected by FUNDING_PROVIDER, or nil
+// when accounts are not funded
+func newFundingProvider() (FundingProvider, error) {
+	p := os.Getenv("FUNDING_PROVIDER")
+	if sandboxMode() {
+		// A sandbox always fakes funding, so partners exercise the flow
+		p = FundingProviderSandbox
+	}
+	switch p {
+	case "":
+		return nil, nil
+	case FundingProviderSandbox:
+		return sandboxFundingProvider{}, nil
+	case FundingProviderHTTP:
+		return newHTTPFundingProvider()
+	default:
+		return nil, fmt.Errorf("unsupported FUNDING_PROVIDER: %s", p)
+	}
+}
+
+// sandboxFundingProvider fakes a core-banking API for local development. The
+// last digit of the settlement account picks the outcome: 0 is declined for
+// insufficient funds, 9 stays pending until the debit times out, and anything
+// else is confirmed immediately.
+type sandboxFundingProvider struct{}
+
+func (sandboxFundingProvider) result(f *Funding) *FundingResult {
+	switch {
+	case strings.HasSuffix(f.SettlementAccount, "0"):
+		return &FundingResult{Status: FundingFailed, Reason: "insufficient funds"}
+	case strings.HasSuffix(f.SettlementAccount, "9"):
+		return &FundingResult{Status: FundingPending}
+	default:
+		return &FundingResult{Status: FundingConfirmed}
+	}
+}
+
+func (p sandboxFundingProvider) Debit(_ context.Context, f *Funding) (*FundingResult, error) {
+	return p.result(f), nil
+}
+
+func (p sandboxFundingProvider) DebitStatus(_ context.Context, f *Funding) (*FundingResult, error) {
+	return p.result(f), nil
+}
+
+func (p sandboxFundingProvider) CancelDebit(_ context.Context, f *Funding) error {
+	if p.result(f).Status == FundingConfirmed {
+		return fmt.Errorf("debit %s is already confirmed", f.Reference)
+	}
+	return nil
+}
+
+// httpFundingProvider calls the payments API at FUNDING_API_URL:
+//
+//	POST {url}/debits                       {"reference", "account", "amount", "currency"} -> {"status", "reason"}
+//	GET  {url}/debits/{reference}           -> {"status", "reason"}, 404 when unknown
+//	POST {url}/debits/{reference}/cancel    -> 2xx once cancelled, an error when already confirmed
+//
+// FUNDING_API_TOKEN, when set, is sent as a bearer token.
+type httpFundingProvider struct {
+	client *http.Client
+	dep    *dependency
+	url    string
+	token  string
+}
+
+// fundingDefaults is how the payments API is called unless its FUNDING_*
+// settings say otherwise. Only status lookups are retried: a debit or
+// cancellation that failed is followed up by the funding job.
+var fundingDefaults = ResiliencePolicy{Timeout: 10 * time.Second, MaxAttempts: 3, Backoff: 200 * time.Millisecond,
+	BreakerThreshold: 5, BreakerCooldown: 30 * time.Second}
+
+// fundingDebitRequest is the payments API's debit request
+type fundingDebitRequest struct {
+	Reference string  `json:"reference"`
+	Account   string  `json:"account"`
+	Amount    float64 `json:"amount"`
+	Currency  string  `json:"currency"`
+}
+
+func newHTTPFundingProvider() (*httpFundingProvider, error) {
+	u := os.Getenv("FUNDING_API_URL")
+	if u == "" {
+		return nil, fmt.Errorf("FUNDING_API_URL is required when FUNDING_PROVIDER=%s", FundingProviderHTTP)
+	}
+	dep, err := newDependency(DependencyFunding, fundingDefaults)
+	if err != nil {
+		return nil, err
+	}
+	return &httpFundingProvider{
+		client: &http.Client{},
+		dep:    dep,
+		url:    strings.TrimRight(u, "/"),
+		token:  os.Getenv("FUNDING_API_TOKEN"),
+	}, nil
+}
+
+// do sends a request to the payments API and decodes a 2xx response into
+// out when it is not nil. It returns the status code so callers can handle
+// 404. GETs are retried.
+func (p *httpFundingProvider) do(ctx context.Context, method, path string, body any, out *FundingResult) (int, error) {
+	var payload []byte
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		payload = b
+	}
+	call := p.dep.callOnce
+	if method == http.MethodGet {
+		call = p.dep.call
+	}
+	var code int
+	err := call(ctx, func(ctx context.Context) (err error) {
+		code, err = p.send(ctx, method, path, payload, out)
+		return err
+	})
+	return code, err
+}
+
+// send makes one request to the payments API. Answers other than 5xx and
+// 429 are permanent.
+func (p *httpFundingProvider) send(ctx context.Context, method, path string, payload []byte, out *FundingResult) (int, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.url+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("payments API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("payments API: %s", resp.Status)
+		if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			err = permanent(err)
+		}
+		return resp.StatusCode, err
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, permanent(fmt.Errorf("decode payments API response: %w", err))
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (p *httpFundingProvider) Debit(ctx context.Context, f *Funding) (*FundingResult, error) {
+	var result FundingResult
+	_, err := p.do(ctx, http.MethodPost, "/debits", fundingDebitRequest{
+		Reference: f.Reference,
+		Account:   f.SettlementAccount,
+		Amount:    f.Amount,
+		Currency:  accountCurrency(),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (p *httpFundingProvider) DebitStatus(ctx context.Context, f *Funding) (*FundingResult, error) {
+	var result FundingResult
+	code, err := p.do(ctx, http.MethodGet, "/debits/"+url.PathEscape(f.Reference), nil, &result)
+	if code == http.StatusNotFound {
+		return &FundingResult{Status: FundingUnknown}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (p *httpFundingProvider) CancelDebit(ctx context.Context, f *Funding) error {
+	_, err := p.do(ctx, http.MethodPost, "/debits/"+url.PathEscape(f.Reference)+"/cancel", nil, nil)
+	return err
+}
+
+// newFunding prepares the debit funding a new account
+func newFunding(settlementAccount string, principal float64) *Funding {
+	return &Funding{
+		SettlementAccount: settlementAccount,
+		Reference:         uuid.NewString(),
+		Amount:            principal,
+		Status:            FundingPending,
+	}
+}
+
+// settleFunding applies a provider's final answer to a pending funding. A
+// confirmed debit activates the account with its term starting now, since no
+// interest accrues before the money arrives.
+func (s *service) settleFunding(ctx context.Context, accountID int, result *FundingResult) (*BlockAccount, error) {
+	account, err := s.repo.SettleFunding(ctx, accountID, func(a *BlockAccount) (*FundingOutcome, error) {
+		outcome := &FundingOutcome{Status: result.Status, Reason: result.Reason}
+		if result.Status != FundingConfirmed {
+			return outcome, nil
+		}
+		term, err := periodTerms(a.Period)
+		if err != nil {
+			return nil, err
+		}
+		funded := *a
+		funded.StartDate = s.Now().UTC()
+		funded.EndDate = term.maturityDate(funded.StartDate)
+		outcome.StartDate, outcome.EndDate = funded.StartDate, funded.EndDate
+		outcome.NextPayoutDate = nextInterestPayoutDate(&funded, funded.StartDate)
+		return outcome, nil
+	})
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to settle funding", zap.Error(err), zap.Int("accountID", accountID))
+		}
+		return nil, err
+	}
+	s.log(ctx).Info("Funding settled", zap.Int("accountID", accountID), zap.String("status", result.Status))
+	return account, nil
+}
+
+// fundAccount debits a newly created pending account. Provider errors leave
+// the account pending for the funding job to follow up.
+func (s *service) fundAccount(ctx context.Context, account *BlockAccount) (*BlockAccount, error) {
+	result, err := s.funding.Debit(ctx, account.Funding)
+	if err != nil {
+		s.log(ctx).Warn("Debit not confirmed, leaving account pending", zap.Error(err), zap.Int("accountID", account.ID))
+		return account, nil
+	}
+	if result.Status != FundingConfirmed && result.Status != FundingFailed {
+		return account, nil
+	}
+	settled, err := s.settleFunding(ctx, account.ID, result)
+	if err == sql.ErrNoRows {
+		// The funding job settled it first
+		return s.GetBlockAccount(ctx, account.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Status == FundingFailed {
+		return nil, fmt.Errorf("%w: %s", ErrFundingDeclined, result.Reason)
+	}
+	return settled, nil
+}
+
+// ReconcileFundings follows up every funding still pending at now, up to
+// batchSize per query. Debits the provider never received are sent again.
+// Debits still pending after timeout are cancelled and their accounts fail;
+// a debit that cannot be cancelled is reported as a reconciliation break and
+// retried on the next run. It returns the number of fundings settled.
+func (s *service) ReconcileFundings(ctx context.Context, now time.Time, timeout time.Duration, batchSize int) (int, error) {
+	if s.funding == nil {
+		return 0, fmt.Errorf("FUNDING_PROVIDER is not set")
+	}
+	settled, after := 0, 0
+	for {
+		pending, err := s.repo.ListPendingFundings(ctx, after, batchSize)
+		if err != nil {
+			s.log(ctx).Error("Failed to list pending fundings", zap.Error(err))
+			return settled, err
+		}
+		if len(pending) == 0 {
+			return settled, nil
+		}
+		for _, f := range pending {
+			after = f.AccountID
+			ok, err := s.reconcileFunding(ctx, f, now.Sub(f.CreatedAt) >= timeout)
+			if err != nil {
+				return settled, err
+			}
+			if ok {
+				settled++
+			}
+		}
+	}
+}
+
+// reconcileFunding follows up one pending funding and reports whether it settled
+func (s *service) reconcileFunding(ctx context.Context, f *Funding, timedOut bool) (bool, error) {
+	result, err := s.funding.DebitStatus(ctx, f)
+	if err != nil {
+		s.log(ctx).Warn("Failed to get debit status", zap.Error(err), zap.Int("accountID", f.AccountID))
+		return false, nil
+	}
+	if result.Status == FundingUnknown && !timedOut {
+		if result, err = s.funding.Debit(ctx, f); err != nil {
+			s.log(ctx).Warn("Failed to resend debit", zap.Error(err), zap.Int("accountID", f.AccountID))
+			return false, nil
+		}
+	}
+
+	switch {
+	case result.Status == FundingConfirmed || result.Status == FundingFailed:
+	case timedOut:
+		if result.Status != FundingUnknown {
+			if err := s.funding.CancelDebit(ctx, f); err != nil {
+				s.log(ctx).Error("Failed to cancel timed out debit", zap.Error(err), zap.Int("accountID", f.AccountID))
+				s.emitOperational(ctx, EventReconciliationBreak, SeverityCritical,
+					fmt.Sprintf("Funding debit for account %s could not be cancelled after timing out", f.AccountExternalID),
+					map[string]any{"account_id": f.AccountExternalID, "reference": f.Reference, "amount": f.Amount, "error": err.Error()})
+				return false, nil
+			}
+		}
+		result = &FundingResult{Status: FundingExpired, Reason: "debit not confirmed in time"}
+	default:
+		return false, nil
+	}
+
+	if _, err := s.settleFunding(ctx, f.AccountID, result); err != nil {
+		if err == sql.ErrNoRows {
+			// Settled by the create request in the meantime
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
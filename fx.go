@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supported FX_RATE_SOURCE values. Display conversion is disabled when
+// FX_RATE_SOURCE is not set.
+const (
+	RateSourceStatic = "static"
+	RateSourceHTTP   = "http"
+)
+
+// defaultAccountCurrency is the currency accounts are held in when ACCOUNT_CURRENCY is not set
+const defaultAccountCurrency = "USD"
+
+// defaultFXRatesTTL is how long rates fetched over HTTP are reused
+const defaultFXRatesTTL = 10 * time.Minute
+
+var (
+	// ErrFXNotConfigured is returned when a display currency is requested but no rate source is set
+	ErrFXNotConfigured = newAPIError(CodeFXNotConfigured, "currency conversion is not configured")
+	// ErrUnknownCurrency is returned when the rate source has no rate for a currency
+	ErrUnknownCurrency = newAPIError(CodeUnknownCurrency, "no exchange rate for currency")
+)
+
+// accountCurrency returns the ISO 4217 code every account amount is held in
+func accountCurrency() string {
+	if v := os.Getenv("ACCOUNT_CURRENCY"); v != "" {
+		return strings.ToUpper(v)
+	}
+	return defaultAccountCurrency
+}
+
+// FXRate converts account currency amounts into another currency
+type FXRate struct {
+	From   string
+	To     string
+	Rate   float64
+	AsOf   time.Time
+	Source string
+}
+
+// RateSource quotes exchange rates from the account currency. Rate returns
+// ErrUnknownCurrency when it has no rate for the currency.
+type RateSource interface {
+	Rate(ctx context.Context, currency string) (*FXRate, error)
+}
+
+// newRateSource builds the rate source selected by FX_RATE_SOURCE, or nil
+// when display conversion is disabled
+func newRateSource() (RateSource, error) {
+	switch source := os.Getenv("FX_RATE_SOURCE"); source {
+	case "":
+		return nil, nil
+	case RateSourceStatic:
+		return newStaticRateSource(os.Getenv("FX_RATES"))
+	case RateSourceHTTP:
+		return newHTTPRateSource()
+	default:
+		return nil, fmt.Errorf("unsupported FX_RATE_SOURCE: %s", source)
+	}
+}
+
+// staticRateSource serves fixed rates from configuration, as of process start
+type staticRateSource struct {
+	rates map[string]float64
+	asOf  time.Time
+}
+
+// newStaticRateSource parses rates like "EUR=0.92,GBP=0.79"
+func newStaticRateSource(spec string) (*staticRateSource, error) {
+	rates := map[string]float64{}
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		code, v, ok := strings.Cut(entry, "=")
+		rate, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if !ok || err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid FX_RATES entry: %s", entry)
+		}
+		rates[strings.ToUpper(strings.TrimSpace(code))] = rate
+	}
+	return &staticRateSource{rates: rates, asOf: time.Now().UTC()}, nil
+}
+
+func (s *staticRateSource) Rate(_ context.Context, currency string) (*FXRate, error) {
+	rate, ok := s.rates[currency]
+	if !ok {
+		return nil, ErrUnknownCurrency
+	}
+	return &FXRate{From: accountCurrency(), To: currency, Rate: rate, AsOf: s.asOf, Source: RateSourceStatic}, nil
+}
+
+// httpRateSource fetches a rate table from FX_RATES_URL and reuses it for
+// FX_RATES_TTL. The endpoint answers with the base currency, the Unix time the
+// rates were published and the rates themselves:
+//
+//	{"base": "USD", "timestamp": 1718000000, "rates": {"EUR": 0.92}}
+type httpRateSource struct {
+	client *http.Client
+	url    string
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	table     *fxRateTable
+	fetchedAt time.Time
+}
+
+// fxRateTable is the rate table served by FX_RATES_URL
+type fxRateTable struct {
+	Base      string             `json:"base"`
+	Timestamp int64              `json:"timestamp"`
+	Rates     map[string]float64 `json:"rates"`
+}
+
+func newHTTPRateSource() (*httpRateSource, error) {
+	url := os.Getenv("FX_RATES_URL")
+	if url == "" {
+		return nil, fmt.Errorf("FX_RATES_URL is required when FX_RATE_SOURCE=%s", RateSourceHTTP)
+	}
+	ttl := defaultFXRatesTTL
+	if v := os.Getenv("FX_RATES_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid FX_RATES_TTL: %s", v)
+		}
+		ttl = d
+	}
+	return &httpRateSource{client: &http.Client{Timeout: 5 * time.Second}, url: url, ttl: ttl}, nil
+}
+
+func (s *httpRateSource) Rate(ctx context.Context, currency string) (*FXRate, error) {
+	table, err := s.rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rate, ok := table.Rates[currency]
+	if !ok || rate <= 0 {
+		return nil, ErrUnknownCurrency
+	}
+	return &FXRate{
+		From:   table.Base,
+		To:     currency,
+		Rate:   rate,
+		AsOf:   time.Unix(table.Timestamp, 0).UTC(),
+		Source: RateSourceHTTP,
+	}, nil
+}
+
+// rates returns the cached rate table, fetching it again once it is older than the TTL
+func (s *httpRateSource) rates(ctx context.Context) (*fxRateTable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.table != nil && time.Since(s.fetchedAt) < s.ttl {
+		return s.table, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch exchange rates: %s", resp.Status)
+	}
+	var table fxRateTable
+	if err := json.NewDecoder(resp.Body).Decode(&table); err != nil {
+		return nil, fmt.Errorf("decode exchange rates: %w", err)
+	}
+	if !strings.EqualFold(table.Base, accountCurrency()) {
+		return nil, fmt.Errorf("exchange rates are based on %s, not %s", table.Base, accountCurrency())
+	}
+	table.Base = accountCurrency()
+	s.table, s.fetchedAt = &table, time.Now()
+	return s.table, nil
+}
+
+// DisplayAmounts presents a response's amounts in another currency. The
+// amounts stored and returned elsewhere in the response stay in the account currency.
+// @Description Amounts converted to a display currency, with the rate used
+type DisplayAmounts struct {
+	Currency     string    `json:"currency" example:"EUR"`
+	BaseCurrency string    `json:"base_currency" example:"USD"`
+	Rate         float64   `json:"rate" example:"0.92"`
+	RateAsOf     time.Time `json:"rate_as_of"`
+	RateSource   string    `json:"rate_source" example:"static"`
+	// Amounts maps each converted field of the response to its converted value
+	Amounts map[string]float64 `json:"amounts"`
+}
+
+// display converts the named account currency amounts
+func (r *FXRate) display(amounts map[string]float64) *DisplayAmounts {
+	converted := make(map[string]float64, len(amounts))
+	for k, v := range amounts {
+		converted[k] = roundMoney(v * r.Rate)
+	}
+	return &DisplayAmounts{
+		Currency:     r.To,
+		BaseCurrency: r.From,
+		Rate:         r.Rate,
+		RateAsOf:     r.AsOf,
+		RateSource:   r.Source,
+		Amounts:      converted,
+	}
+}
+
+// GetDisplayRate returns the rate for presenting amounts in currency
+func (s *service) GetDisplayRate(ctx context.Context, currency string) (*FXRate, error) {
+	currency = strings.ToUpper(currency)
+	if currency == accountCurrency() {
+		return &FXRate{From: currency, To: currency, Rate: 1, AsOf: time.Now().UTC(), Source: "identity"}, nil
+	}
+	if s.fx == nil {
+		return nil, ErrFXNotConfigured
+	}
+	rate, err := s.fx.Rate(ctx, currency)
+	if err != nil && !errors.Is(err, ErrUnknownCurrency) {
+		s.log(ctx).Error("Failed to get exchange rate", zap.Error(err), zap.String("currency", currency))
+	}
+	return rate, err
+}
+
+// displayRate reads the display_currency query parameter and returns its
+// rate, or nil when none was asked for. It writes the error response and
+// returns false when the currency cannot be shown.
+func displayRate(ctx context.Context, w http.ResponseWriter, r *http.Request, svc BlockAccountService) (*FXRate, bool) {
+	currency := r.URL.Query().Get("display_currency")
+	if currency == "" {
+		return nil, true
+	}
+	if len(currency) != 3 {
+		writeError(w, http.StatusBadRequest, "display_currency must be an ISO 4217 code")
+		return nil, false
+	}
+	rate, err := svc.GetDisplayRate(ctx, currency)
+	switch {
+	case errors.Is(err, ErrFXNotConfigured):
+		writeAPIError(w, http.StatusBadRequest, err)
+		return nil, false
+	case errors.Is(err, ErrUnknownCurrency):
+		writeErrorCode(w, http.StatusBadRequest, CodeUnknownCurrency, fmt.Sprintf("%s: %s", err.Error(), strings.ToUpper(currency)))
+		return nil, false
+	case err != nil:
+		writeErrorCode(w, http.StatusBadGateway, CodeFXUnavailable, "Exchange rates unavailable")
+		return nil, false
+	}
+	return rate, true
+}
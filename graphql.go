@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+)
+
+// GraphQLPath is where the GraphQL endpoint is served. It is not versioned:
+// the schema grows by adding fields instead.
+const GraphQLPath = "/graphql"
+
+const (
+	// graphQLMaxDepth bounds how deeply a query may nest
+	graphQLMaxDepth = 6
+	// graphQLLoadWait is how long a loader collects keys before loading them
+	graphQLLoadWait = 2 * time.Millisecond
+)
+
+const graphQLLoadersKey ctxKey = "graphQLLoaders"
+
+// errGraphQLInternal is what a query is told when a resolver fails; the
+// failure itself is logged
+var errGraphQLInternal = errors.New("internal error")
+
+// graphQLSchema is read-only: there are no mutations, so queries only need
+// the read scope
+const graphQLSchema = `
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	# A block account by ID, or null when there is none
+	account(id: ID!): Account
+	# Block accounts by ID, in the order asked for, with null for an ID that names none
+	accounts(ids: [ID!]!): [Account]!
+	# A user's block accounts, newest first
+	userAccounts(userId: Int!): [Account!]!
+}
+
+type Account {
+	id: ID!
+	userId: Int!
+	tenantId: String!
+	principal: Float!
+	interestRate: Float!
+	period: String
+	status: String!
+	startDate: Time!
+	endDate: Time!
+	maturityInstruction: String!
+	payoutDestination: String
+	payoutFrequency: String!
+	nextPayoutDate: Time
+	interestPaidThrough: Time
+	interestAdjustment: Float!
+	createdAt: Time!
+	updatedAt: Time!
+	# Interest earned so far, paid or not
+	interestAccrued: Float!
+	# The debit that funded the account, if one was needed
+	funding: Funding
+	# Every status the account has had, oldest first
+	statusHistory: [StatusChange!]!
+	# Interest paid before maturity, oldest first
+	interestPayouts: [InterestPayout!]!
+	# Maturity payouts, oldest first
+	payouts: [Payout!]!
+	# Interest and maturity payments still to come; empty unless the account is active
+	upcomingPayouts: [ScheduledPayout!]!
+}
+
+type Funding {
+	settlementAccount: String!
+	reference: String!
+	amount: Float!
+	status: String!
+	failureReason: String
+	createdAt: Time!
+	settledAt: Time
+}
+
+type StatusChange {
+	from: String
+	to: String!
+	principal: Float!
+	note: String
+	changedAt: Time!
+}
+
+type InterestPayout {
+	id: Int!
+	destinationAccount: String!
+	periodStart: Time!
+	periodEnd: Time!
+	amount: Float!
+	status: String!
+	createdAt: Time!
+}
+
+type Payout {
+	id: Int!
+	destinationAccount: String!
+	amount: Float!
+	status: String!
+	failureReason: String
+	attempts: Int!
+	createdAt: Time!
+	updatedAt: Time!
+}
+
+type ScheduledPayout {
+	date: Time!
+	type: String!
+	interest: Float!
+	principal: Float!
+	amount: Float!
+}
+`
+
+// schema is graphQLSchema bound to its resolvers. Parsing it at start-up
+// catches a resolver that no longer matches the schema.
+var schema = graphql.MustParseSchema(graphQLSchema, &queryResolver{},
+	graphql.MaxDepth(graphQLMaxDepth), graphql.UseFieldResolvers())
+
+// GraphQLRequest is a GraphQL query sent over HTTP
+// @Description GraphQL query, with its operation name and variables
+type GraphQLRequest struct {
+	Query         string         `json:"query" example:"{ userAccounts(userId: 123) { id status upcomingPayouts { date amount } } }" validate:"notblank"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	// Extensions is accepted for clients that always send it, and ignored
+	Extensions map[string]any `json:"extensions,omitempty" swaggerignore:"true"`
+}
+
+// GetAccountsByExternalID returns the accounts, of those with externalIDs,
+// that exist, by external ID. IDs that are not UUIDs name no account.
+func (s *service) GetAccountsByExternalID(ctx context.Context, externalIDs []string) (map[string]*BlockAccount, error) {
+	ids := make([]string, 0, len(externalIDs))
+	for _, id := range externalIDs {
+		if id, ok := parseExternalID(id); ok {
+			ids = append(ids, id)
+		}
+	}
+	accounts, err := s.repo.GetAccountsByExternalID(ctx, ids)
+	if err != nil {
+		s.log(ctx).Error("Failed to get block accounts", zap.Error(err), zap.Int("count", len(ids)))
+		return nil, err
+	}
+	byID := make(map[string]*BlockAccount, len(accounts))
+	for _, a := range accounts {
+		byID[a.ExternalID] = a
+	}
+	return byID, nil
+}
+
+// GetFundingsOf returns the fundings of the accounts in accountIDs, by account
+func (s *service) GetFundingsOf(ctx context.Context, accountIDs []int) (map[int]*Funding, error) {
+	fundings, err := s.repo.ListFundingsOf(ctx, accountIDs)
+	if err != nil {
+		s.log(ctx).Error("Failed to list fundings", zap.Error(err), zap.Int("accounts", len(accountIDs)))
+		return nil, err
+	}
+	byAccount := make(map[int]*Funding, len(fundings))
+	for _, f := range fundings {
+		byAccount[f.AccountID] = f
+	}
+	return byAccount, nil
+}
+
+// GetStatusChangesOf returns the status changes of the accounts in
+// accountIDs, by account, oldest first
+func (s *service) GetStatusChangesOf(ctx context.Context, accountIDs []int) (map[int][]*StatusChange, error) {
+	changes, err := s.repo.ListStatusChangesOf(ctx, accountIDs)
+	if err != nil {
+		s.log(ctx).Error("Failed to list status changes", zap.Error(err), zap.Int("accounts", len(accountIDs)))
+		return nil, err
+	}
+	return groupByAccount(changes, func(c *StatusChange) int { return c.AccountID }), nil
+}
+
+// GetInterestPayoutsOf returns the interest paid on the accounts in
+// accountIDs, by account, oldest first
+func (s *service) GetInterestPayoutsOf(ctx context.Context, accountIDs []int) (map[int][]*InterestPayout, error) {
+	payouts, err := s.repo.ListInterestPayoutsOf(ctx, accountIDs)
+	if err != nil {
+		s.log(ctx).Error("Failed to list interest payouts", zap.Error(err), zap.Int("accounts", len(accountIDs)))
+		return nil, err
+	}
+	return groupByAccount(payouts, func(p *InterestPayout) int { return p.AccountID }), nil
+}
+
+// GetPayoutsOf returns the maturity payouts of the accounts in accountIDs,
+// by account, oldest first
+func (s *service) GetPayoutsOf(ctx context.Context, accountIDs []int) (map[int][]*Payout, error) {
+	payouts, err := s.repo.ListPayoutsOf(ctx, accountIDs)
+	if err != nil {
+		s.log(ctx).Error("Failed to list payouts", zap.Error(err), zap.Int("accounts", len(accountIDs)))
+		return nil, err
+	}
+	return groupByAccount(payouts, func(p *Payout) int { return p.AccountID }), nil
+}
+
+// groupByAccount groups items by the account accountID returns for each,
+// keeping their order
+func groupByAccount[T any](items []T, accountID func(T) int) map[int][]T {
+	byAccount := make(map[int][]T)
+	for _, item := range items {
+		id := accountID(item)
+		byAccount[id] = append(byAccount[id], item)
+	}
+	return byAccount
+}
+
+// graphQLLoaders batch what one GraphQL request reads, so that a field
+// asked of many accounts is loaded with one query instead of one per
+// account. Loaders cache what they load, so they last a single request.
+type graphQLLoaders struct {
+	accounts        *dataloader.Loader[string, *BlockAccount]
+	fundings        *dataloader.Loader[int, *Funding]
+	statusChanges   *dataloader.Loader[int, []*StatusChange]
+	interestPayouts *dataloader.Loader[int, []*InterestPayout]
+	payouts         *dataloader.Loader[int, []*Payout]
+}
+
+// newGraphQLLoaders returns the loaders of one request, reading through svc
+func newGraphQLLoaders(svc BlockAccountService) *graphQLLoaders {
+	return &graphQLLoaders{
+		accounts:        newLoader(svc.GetAccountsByExternalID),
+		fundings:        newLoader(svc.GetFundingsOf),
+		statusChanges:   newLoader(svc.GetStatusChangesOf),
+		interestPayouts: newLoader(svc.GetInterestPayoutsOf),
+		payouts:         newLoader(svc.GetPayoutsOf),
+	}
+}
+
+// newLoader returns a loader that loads the keys collected together with
+// one call to load. A key load leaves out gets the zero value.
+func newLoader[K comparable, V any](load func(ctx context.Context, keys []K) (map[K]V, error)) *dataloader.Loader[K, V] {
+	return dataloader.NewBatchedLoader(func(ctx context.Context, keys []K) []*dataloader.Result[V] {
+		values, err := load(ctx, keys)
+		results := make([]*dataloader.Result[V], len(keys))
+		for i, key := range keys {
+			results[i] = &dataloader.Result[V]{Data: values[key], Error: err}
+		}
+		return results
+	}, dataloader.WithWait[K, V](graphQLLoadWait))
+}
+
+// loadersFromContext returns the loaders of the request
+func loadersFromContext(ctx context.Context) *graphQLLoaders {
+	return ctx.Value(graphQLLoadersKey).(*graphQLLoaders)
+}
+
+// queryResolver resolves the fields of Query
+type queryResolver struct{}
+
+func (q *queryResolver) Account(ctx context.Context, args struct{ ID graphql.ID }) (*accountResolver, error) {
+	account, err := loadersFromContext(ctx).accounts.Load(ctx, canonicalID(args.ID))()
+	if err != nil {
+		return nil, errGraphQLInternal
+	}
+	if account == nil {
+		return nil, nil
+	}
+	return newAccountResolvers([]*BlockAccount{account})[0], nil
+}
+
+func (q *queryResolver) Accounts(ctx context.Context, args struct{ IDs []graphql.ID }) ([]*accountResolver, error) {
+	keys := make([]string, len(args.IDs))
+	for i, id := range args.IDs {
+		keys[i] = canonicalID(id)
+	}
+	accounts, errs := loadersFromContext(ctx).accounts.LoadMany(ctx, keys)()
+	if len(errs) > 0 {
+		return nil, errGraphQLInternal
+	}
+
+	var found []*BlockAccount
+	for _, a := range accounts {
+		if a != nil {
+			found = append(found, a)
+		}
+	}
+	resolvers := newAccountResolvers(found)
+	byID := make(map[string]*accountResolver, len(resolvers))
+	for _, r := range resolvers {
+		byID[r.account.ExternalID] = r
+	}
+	list := make([]*accountResolver, len(keys))
+	for i, key := range keys {
+		list[i] = byID[key]
+	}
+	return list, nil
+}
+
+func (q *queryResolver) UserAccounts(ctx context.Context, args struct{ UserID int32 }) ([]*accountResolver, error) {
+	if args.UserID < 1 {
+		return nil, errors.New("userId must be positive")
+	}
+	svc, ok := ctx.Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		return nil, errGraphQLInternal
+	}
+	accounts, err := svc.GetUserBlockAccounts(ctx, int(args.UserID))
+	if err != nil {
+		return nil, errGraphQLInternal
+	}
+	return newAccountResolvers(accounts), nil
+}
+
+// canonicalID returns id as external IDs are stored, or as it is when it is
+// not a UUID, which then loads no account
+func canonicalID(id graphql.ID) string {
+	if canonical, ok := parseExternalID(string(id)); ok {
+		return canonical
+	}
+	return string(id)
+}
+
+// accountResolver resolves the fields of Account
+type accountResolver struct {
+	account *BlockAccount
+	// siblings are the accounts resolved along with this one. The first of
+	// them to load a field loads it for all of them.
+	siblings []int
+}
+
+// newAccountResolvers returns the resolvers of accounts resolved together
+func newAccountResolvers(accounts []*BlockAccount) []*accountResolver {
+	siblings := make([]int, len(accounts))
+	for i, a := range accounts {
+		siblings[i] = a.ID
+	}
+	resolvers := make([]*accountResolver, len(accounts))
+	for i, a := range accounts {
+		resolvers[i] = &accountResolver{account: a, siblings: siblings}
+	}
+	return resolvers
+}
+
+// loadForAccount loads the account's value from loader, queueing its
+// siblings' with it
+func loadForAccount[V any](ctx context.Context, loader *dataloader.Loader[int, V], r *accountResolver) (V, error) {
+	loader.LoadMany(ctx, r.siblings)
+	value, err := loader.Load(ctx, r.account.ID)()
+	if err != nil {
+		return value, errGraphQLInternal
+	}
+	return value, nil
+}
+
+func (r *accountResolver) ID() graphql.ID        { return graphql.ID(r.account.ExternalID) }
+func (r *accountResolver) UserID() int32         { return int32(r.account.UserID) }
+func (r *accountResolver) TenantID() string      { return r.account.TenantID }
+func (r *accountResolver) Principal() float64    { return r.account.Principal }
+func (r *accountResolver) InterestRate() float64 { return r.account.InterestRate }
+func (r *accountResolver) Period() *string       { return optionalString(r.account.Period) }
+func (r *accountResolver) Status() string        { return r.account.Status }
+func (r *accountResolver) StartDate() graphql.Time {
+	return graphql.Time{Time: r.account.StartDate}
+}
+func (r *accountResolver) EndDate() graphql.Time { return graphql.Time{Time: r.account.EndDate} }
+func (r *accountResolver) MaturityInstruction() string {
+	return r.account.MaturityInstruction
+}
+func (r *accountResolver) PayoutDestination() *string {
+	return optionalString(maskAccountNumber(r.account.PayoutDestination))
+}
+func (r *accountResolver) PayoutFrequency() string { return r.account.PayoutFrequency }
+func (r *accountResolver) NextPayoutDate() *graphql.Time {
+	return optionalTime(r.account.NextPayoutDate)
+}
+func (r *accountResolver) InterestPaidThrough() *graphql.Time {
+	return optionalTime(r.account.InterestPaidThrough)
+}
+func (r *accountResolver) InterestAdjustment() float64 { return r.account.InterestAdjustment }
+func (r *accountResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.account.CreatedAt}
+}
+func (r *accountResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: r.account.UpdatedAt}
+}
+
+func (r *accountResolver) InterestAccrued(ctx context.Context) float64 {
+	now := time.Now()
+	if svc, ok := ctx.Value(ServiceKey).(BlockAccountService); ok {
+		now = svc.Now()
+	}
+	return roundMoney(interestBetween(r.account, r.account.StartDate, now))
+}
+
+func (r *accountResolver) Funding(ctx context.Context) (*fundingResolver, error) {
+	funding, err := loadForAccount(ctx, loadersFromContext(ctx).fundings, r)
+	if err != nil || funding == nil {
+		return nil, err
+	}
+	return &fundingResolver{*funding}, nil
+}
+
+func (r *accountResolver) StatusHistory(ctx context.Context) ([]*statusChangeResolver, error) {
+	changes, err := loadForAccount(ctx, loadersFromContext(ctx).statusChanges, r)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*statusChangeResolver, len(changes))
+	for i, c := range changes {
+		resolvers[i] = &statusChangeResolver{*c}
+	}
+	return resolvers, nil
+}
+
+func (r *accountResolver) InterestPayouts(ctx context.Context) ([]*interestPayoutResolver, error) {
+	payouts, err := loadForAccount(ctx, loadersFromContext(ctx).interestPayouts, r)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*interestPayoutResolver, len(payouts))
+	for i, p := range payouts {
+		resolvers[i] = &interestPayoutResolver{*p}
+	}
+	return resolvers, nil
+}
+
+func (r *accountResolver) Payouts(ctx context.Context) ([]*payoutResolver, error) {
+	payouts, err := loadForAccount(ctx, loadersFromContext(ctx).payouts, r)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*payoutResolver, len(payouts))
+	for i, p := range payouts {
+		resolvers[i] = &payoutResolver{*p}
+	}
+	return resolvers, nil
+}
+
+func (r *accountResolver) UpcomingPayouts() []*scheduledPayoutResolver {
+	if r.account.Status != StatusActive {
+		return []*scheduledPayoutResolver{}
+	}
+	upcoming := upcomingPayouts(r.account)
+	resolvers := make([]*scheduledPayoutResolver, len(upcoming))
+	for i, p := range upcoming {
+		resolvers[i] = &scheduledPayoutResolver{*p}
+	}
+	return resolvers
+}
+
+// The resolvers below resolve fields from a copy of the struct they embed,
+// where the field's Go type is the one GraphQL needs, and with methods where
+// it is not
+
+type fundingResolver struct{ Funding }
+
+func (r *fundingResolver) SettlementAccount() string {
+	return maskAccountNumber(r.Funding.SettlementAccount)
+}
+func (r *fundingResolver) FailureReason() *string { return optionalString(r.Funding.FailureReason) }
+func (r *fundingResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.Funding.CreatedAt}
+}
+func (r *fundingResolver) SettledAt() *graphql.Time { return optionalTime(r.Funding.SettledAt) }
+
+type statusChangeResolver struct{ StatusChange }
+
+func (r *statusChangeResolver) From() *string { return optionalString(r.StatusChange.From) }
+func (r *statusChangeResolver) Note() *string { return optionalString(r.StatusChange.Note) }
+func (r *statusChangeResolver) ChangedAt() graphql.Time {
+	return graphql.Time{Time: r.StatusChange.ChangedAt}
+}
+
+type interestPayoutResolver struct{ InterestPayout }
+
+func (r *interestPayoutResolver) ID() int32 { return int32(r.InterestPayout.ID) }
+func (r *interestPayoutResolver) DestinationAccount() string {
+	return maskAccountNumber(r.InterestPayout.Destination)
+}
+func (r *interestPayoutResolver) PeriodStart() graphql.Time {
+	return graphql.Time{Time: r.InterestPayout.PeriodStart}
+}
+func (r *interestPayoutResolver) PeriodEnd() graphql.Time {
+	return graphql.Time{Time: r.InterestPayout.PeriodEnd}
+}
+func (r *interestPayoutResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.InterestPayout.CreatedAt}
+}
+
+type payoutResolver struct{ Payout }
+
+func (r *payoutResolver) ID() int32                  { return int32(r.Payout.ID) }
+func (r *payoutResolver) DestinationAccount() string { return maskAccountNumber(r.Payout.Destination) }
+func (r *payoutResolver) FailureReason() *string     { return optionalString(r.Payout.FailureReason) }
+func (r *payoutResolver) Attempts() int32            { return int32(r.Payout.Attempts) }
+func (r *payoutResolver) CreatedAt() graphql.Time    { return graphql.Time{Time: r.Payout.CreatedAt} }
+func (r *payoutResolver) UpdatedAt() graphql.Time    { return graphql.Time{Time: r.Payout.UpdatedAt} }
+
+type scheduledPayoutResolver struct{ ScheduledPayout }
+
+func (r *scheduledPayoutResolver) Date() graphql.Time {
+	return graphql.Time{Time: r.ScheduledPayout.Date}
+}
+
+// optionalString returns s, or nil when it is empty
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// optionalTime returns t as a GraphQL time, or nil when it is not set
+func optionalTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+// graphQLHandler godoc
+// @Summary Query accounts with GraphQL
+// @Description Runs a GraphQL query over block accounts, their funding, status history, interest and maturity payouts, and upcoming payments, in one round trip. Fields asked of many accounts are loaded with one query per field, not one per account. The schema has no mutations, so the read scope is enough. The response is a standard GraphQL response: errors in fields are reported in its errors array with a 200; a body that is not a GraphQL request gets a 400 in the usual error format.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param query body GraphQLRequest true "GraphQL query"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse "GraphQL is not enabled for the caller"
+// @Failure 500 {object} ErrorResponse
+// @Router /graphql [post]
+func graphQLHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	if !featureOn(r.Context(), FeatureGraphQL) {
+		writeAPIError(w, http.StatusNotFound, ErrFeatureDisabled)
+		return
+	}
+
+	var req GraphQLRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphQLLoadersKey, newGraphQLLoaders(svc))
+
+	resp := schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
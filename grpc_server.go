@@ -0,0 +1,304 @@
+package main
+
+//go:generate protoc -I proto --go_out=proto --go_opt=paths=source_relative --go-grpc_out=proto --go-grpc_opt=paths=source_relative blockaccount/v1/block_account.proto
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	blockaccountv1 "main.go/proto/blockaccount/v1"
+)
+
+// grpcRequestIDKey is the metadata key carrying the request ID, mirroring X-Request-ID
+const grpcRequestIDKey = "x-request-id"
+
+// grpcTenantKey is the metadata key naming the tenant a platform caller
+// acts for, mirroring X-Tenant-ID
+const grpcTenantKey = "x-tenant-id"
+
+// grpcServer exposes BlockAccountService over gRPC. It validates and maps
+// errors the same way as the HTTP handlers and delegates to the same service.
+// It serves internal callers only, so accounts keep their serial IDs here
+// rather than the external IDs the HTTP API and events use.
+type grpcServer struct {
+	blockaccountv1.UnimplementedBlockAccountServiceServer
+	svc BlockAccountService
+}
+
+// newGRPCServer builds the gRPC server with request logging and reflection
+func newGRPCServer(svc BlockAccountService, logger *zap.Logger) *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(grpcLoggingInterceptor(logger), grpcAuthInterceptor(svc, logger)))
+	blockaccountv1.RegisterBlockAccountServiceServer(server, &grpcServer{svc: svc})
+	reflection.Register(server)
+	return server
+}
+
+// serveGRPC serves gRPC on addr until ctx is cancelled
+func serveGRPC(ctx context.Context, server *grpc.Server, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	return server.Serve(lis)
+}
+
+// grpcLoggingInterceptor is the gRPC counterpart of RequestIDMiddleware and
+// AccessLogMiddleware: it reuses or assigns a request ID, stores the
+// request-scoped logger in the context and logs one line per call
+func grpcLoggingInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+
+		reqID := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md.Get(grpcRequestIDKey); len(ids) > 0 {
+				reqID = ids[0]
+			}
+		}
+		if reqID == "" {
+			reqID = uuid.NewString()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, reqID))
+
+		reqLogger := logger.With(zap.String("request_id", reqID))
+		resp, err := handler(context.WithValue(ctx, loggerKey, reqLogger), req)
+
+		reqLogger.Info("grpc request",
+			zap.String("method", info.FullMethod),
+			zap.String("code", status.Code(err).String()),
+			zap.Duration("duration", time.Since(start)),
+		)
+		return resp, err
+	}
+}
+
+// grpcAuthInterceptor is the gRPC counterpart of AuthMiddleware and
+// TenantMiddleware. It reads the x-api-key or authorization metadata; Get
+// and List calls need the read scope and the rest write. Only reads may come
+// without credentials. Calls act for the caller's tenant, or for the one in
+// x-tenant-id as TenantMiddleware allows.
+func grpcAuthInterceptor(svc BlockAccountService, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		first := func(key string) string {
+			if v := md.Get(key); len(v) > 0 {
+				return v[0]
+			}
+			return ""
+		}
+
+		principal, err := authenticate(ctx, svc, first("x-api-key"), first("authorization"), logger)
+		var refused *credentialError
+		switch {
+		case errors.As(err, &refused):
+			return nil, status.Error(codes.Unauthenticated, refused.Message)
+		case errors.Is(err, ErrIdentityProviderUnavailable):
+			return nil, status.Error(codes.Unavailable, "bearer tokens cannot be checked right now")
+		case err != nil:
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		scope := ScopeWrite
+		method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+		if strings.HasPrefix(method, "Get") || strings.HasPrefix(method, "List") {
+			scope = ScopeRead
+		}
+		switch {
+		case principal == nil && !authRequired() && scope == ScopeRead:
+		case principal == nil:
+			return nil, status.Error(codes.Unauthenticated, "credentials required: send x-api-key or a bearer token")
+		case !principal.grants(scope):
+			return nil, status.Error(codes.PermissionDenied, "this call needs the "+scope+" scope")
+		default:
+			ctx = withPrincipal(ctx, principal, logger)
+		}
+
+		tenant, err := resolveTenant(ctx, svc, strings.TrimSpace(first(grpcTenantKey)))
+		switch err {
+		case nil:
+		case ErrTenantMismatch, ErrTenantPlatformOnly:
+			return nil, grpcStatus(codes.PermissionDenied, err)
+		case ErrUnknownTenant:
+			return nil, grpcStatus(codes.InvalidArgument, err)
+		default:
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return handler(withTenantScope(ctx, tenant), req)
+	}
+}
+
+// grpcError maps service errors onto gRPC status codes
+func grpcError(err error) error {
+	var violation *LimitViolation
+	var block *AnomalyBlock
+	var duplicate *DuplicateAccount
+	switch {
+	case errors.As(err, &violation):
+		return grpcStatus(codes.FailedPrecondition, &APIError{
+			Code:    CodeLimitExceeded,
+			Message: violation.Rule + ": " + violation.Message,
+			Details: map[string]any{"rule": violation.Rule, "limit": violation.Limit},
+		})
+	case errors.As(err, &block):
+		return grpcStatus(codes.ResourceExhausted, &APIError{Code: CodeActivityThrottled, Message: block.Message, Details: map[string]any{"rule": block.Rule}})
+	case errors.As(err, &duplicate):
+		return grpcStatus(codes.AlreadyExists, duplicate.apiError())
+	case errors.Is(err, sql.ErrNoRows):
+		return grpcStatus(codes.NotFound, newAPIError(CodeAccountNotFound, "block account not found"))
+	case errors.Is(err, ErrUnknownUser), errors.Is(err, ErrFundingDeclined):
+		return grpcStatus(codes.FailedPrecondition, err)
+	case errors.Is(err, ErrProductUnavailable), errors.Is(err, ErrProductMismatch), errors.Is(err, ErrSettlementAccountRequired):
+		return grpcStatus(codes.InvalidArgument, err)
+	case errors.Is(err, ErrAccountNotActive), errors.Is(err, ErrInstructionCutoff),
+		errors.Is(err, ErrAccountFrozen), errors.Is(err, ErrApprovalRequired), errors.Is(err, ErrEarlyWithdrawalNotAllowed):
+		return grpcStatus(codes.FailedPrecondition, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, ErrCircuitOpen):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// grpcStatus returns err as a status with code c. The error code of an
+// APIError is attached as an ErrorInfo detail, its reason the catalog code
+// and its metadata the error's details.
+func grpcStatus(c codes.Code, err error) error {
+	st := status.New(c, err.Error())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return st.Err()
+	}
+	info := &errdetails.ErrorInfo{Reason: apiErr.Code, Domain: "block-account"}
+	if n := len(apiErr.Details) + len(apiErr.Fields); n > 0 {
+		info.Metadata = make(map[string]string, n)
+	}
+	for k, v := range apiErr.Details {
+		info.Metadata[k] = fmt.Sprint(v)
+	}
+	for _, f := range apiErr.Fields {
+		info.Metadata["field."+f.Field] = f.Code
+	}
+	if withInfo, err := st.WithDetails(info); err == nil {
+		return withInfo.Err()
+	}
+	return st.Err()
+}
+
+// grpcClientIP returns the caller's address: the first x-forwarded-for entry
+// set by the gateway, or the peer address
+func grpcClientIP(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if fwd := md.Get("x-forwarded-for"); len(fwd) > 0 {
+		if ip := strings.TrimSpace(strings.Split(fwd[0], ",")[0]); ip != "" {
+			return ip
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// toProtoAccount converts an account to its protobuf message
+func toProtoAccount(a *BlockAccount) *blockaccountv1.BlockAccount {
+	return &blockaccountv1.BlockAccount{
+		Id:                  int64(a.ID),
+		UserId:              int64(a.UserID),
+		Principal:           a.Principal,
+		StartDate:           timestamppb.New(a.StartDate),
+		EndDate:             timestamppb.New(a.EndDate),
+		InterestRate:        a.InterestRate,
+		Period:              a.Period,
+		Status:              a.Status,
+		MaturityInstruction: a.MaturityInstruction,
+		PayoutDestination:   maskAccountNumber(a.PayoutDestination),
+		CreatedAt:           timestamppb.New(a.CreatedAt),
+		UpdatedAt:           timestamppb.New(a.UpdatedAt),
+	}
+}
+
+func (g *grpcServer) CreateBlockAccount(ctx context.Context, req *blockaccountv1.CreateBlockAccountRequest) (*blockaccountv1.BlockAccount, error) {
+	create := CreateAccountRequest{UserID: int(req.GetUserId()), Principal: req.GetPrincipal(), Period: req.GetPeriod()}
+	if err := validateRequest(&create); err != nil {
+		return nil, grpcStatus(codes.InvalidArgument, err)
+	}
+
+	account, err := g.svc.CreateBlockAccount(withClientIP(ctx, grpcClientIP(ctx)), &create)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProtoAccount(account), nil
+}
+
+func (g *grpcServer) GetBlockAccount(ctx context.Context, req *blockaccountv1.GetBlockAccountRequest) (*blockaccountv1.BlockAccount, error) {
+	account, err := g.svc.GetBlockAccount(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if account == nil {
+		return nil, status.Error(codes.NotFound, "block account not found")
+	}
+	return toProtoAccount(account), nil
+}
+
+func (g *grpcServer) ListUserBlockAccounts(ctx context.Context, req *blockaccountv1.ListUserBlockAccountsRequest) (*blockaccountv1.ListUserBlockAccountsResponse, error) {
+	accounts, err := g.svc.GetUserBlockAccounts(ctx, int(req.GetUserId()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &blockaccountv1.ListUserBlockAccountsResponse{Accounts: make([]*blockaccountv1.BlockAccount, 0, len(accounts))}
+	for _, account := range accounts {
+		resp.Accounts = append(resp.Accounts, toProtoAccount(account))
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) DeleteBlockAccount(ctx context.Context, req *blockaccountv1.DeleteBlockAccountRequest) (*blockaccountv1.DeleteBlockAccountResponse, error) {
+	if err := g.svc.DeleteBlockAccount(ctx, int(req.GetId())); err != nil {
+		return nil, grpcError(err)
+	}
+	return &blockaccountv1.DeleteBlockAccountResponse{}, nil
+}
+
+func (g *grpcServer) ChangeMaturityInstruction(ctx context.Context, req *blockaccountv1.ChangeMaturityInstructionRequest) (*blockaccountv1.BlockAccount, error) {
+	change := MaturityInstructionRequest{Instruction: req.GetInstruction(), DestinationAccount: req.GetDestinationAccount()}
+	if err := validateRequest(&change); err != nil {
+		return nil, grpcStatus(codes.InvalidArgument, err)
+	}
+
+	account, err := g.svc.ChangeMaturityInstruction(ctx, int(req.GetId()), change.Instruction, change.DestinationAccount)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if account == nil {
+		return nil, status.Error(codes.NotFound, "block account not found")
+	}
+	return toProtoAccount(account), nil
+}
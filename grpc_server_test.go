@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	blockaccountv1 "main.go/proto/blockaccount/v1"
+)
+
+func TestGRPCTenantIsolation(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	var tenant Tenant
+	api.create(http.MethodPost, "/v2/admin/tenants", `{"id":"acme","name":"Acme Savings Bank"}`, &tenant)
+	var writer, bound APIKey
+	api.create(http.MethodPost, "/v2/admin/api-keys", `{"name":"batch","scopes":["write"]}`, &writer)
+	api.create(http.MethodPost, "/v2/admin/api-keys", `{"name":"acme-batch","scopes":["write"],"tenant_id":"acme"}`, &bound)
+
+	var own BlockAccount
+	w := api.do(http.MethodPost, "/v2/block-account", `{"user_id":1,"principal":1000,"period":"1y"}`, APIKeyHeader, bound.Key)
+	decodeData(t, w.Body.Bytes(), &own)
+	if w.Code != http.StatusCreated || own.TenantID != "acme" {
+		t.Fatalf("create for acme: %d %s", w.Code, w.Body)
+	}
+	ownID, _ := api.repo.ResolveAccountID(withTenant(ctx, ""), own.ExternalID)
+	otherID, _ := api.repo.ResolveAccountID(withTenant(ctx, ""), api.createAccount(2))
+
+	g := &grpcServer{svc: api.svc}
+	interceptor := grpcAuthInterceptor(api.svc, zap.NewNop())
+	get := func(id int, md ...string) codes.Code {
+		t.Helper()
+		_, err := interceptor(metadata.NewIncomingContext(ctx, metadata.Pairs(md...)), &blockaccountv1.GetBlockAccountRequest{Id: int64(id)},
+			&grpc.UnaryServerInfo{FullMethod: blockaccountv1.BlockAccountService_GetBlockAccount_FullMethodName},
+			func(ctx context.Context, req any) (any, error) {
+				return g.GetBlockAccount(ctx, req.(*blockaccountv1.GetBlockAccountRequest))
+			})
+		return status.Code(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		id   int
+		md   []string
+		want codes.Code
+	}{
+		{"bound key, own tenant's account", ownID, []string{"x-api-key", bound.Key}, codes.OK},
+		{"bound key, other tenant's account", otherID, []string{"x-api-key", bound.Key}, codes.NotFound},
+		{"bound key naming another tenant", otherID, []string{"x-api-key", bound.Key, grpcTenantKey, DefaultTenant}, codes.PermissionDenied},
+		{"no credentials, other tenant's account", ownID, nil, codes.NotFound},
+		{"no credentials naming a tenant", ownID, []string{grpcTenantKey, "acme"}, codes.PermissionDenied},
+		{"unbound key naming a tenant", ownID, []string{"x-api-key", writer.Key, grpcTenantKey, "acme"}, codes.PermissionDenied},
+		{"platform admin naming the tenant", ownID, []string{"x-api-key", api.adminKey, grpcTenantKey, "acme"}, codes.OK},
+		{"platform admin naming no tenant", ownID, []string{"x-api-key", api.adminKey}, codes.NotFound},
+		{"unknown tenant", ownID, []string{"x-api-key", api.adminKey, grpcTenantKey, "nowhere"}, codes.InvalidArgument},
+	} {
+		if got := get(c.id, c.md...); got != c.want {
+			t.Errorf("%s: %s, want %s", c.name, got, c.want)
+		}
+	}
+}
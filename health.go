@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Dependency check statuses
+const (
+	CheckOK      = "ok"
+	CheckFailing = "failing"
+)
+
+const (
+	// readinessCheckTimeout bounds each dependency check, so one hanging
+	// dependency can't hold up the others or the probe
+	readinessCheckTimeout = 2 * time.Second
+	// workerStaleIntervals is how many of its intervals a worker may go
+	// without finishing a run before it counts as stalled, on top of
+	// workerStaleGrace for runs that take a while
+	workerStaleIntervals = 3
+	workerStaleGrace     = time.Minute
+)
+
+// WorkerHeartbeat records that a background worker finished a run
+type WorkerHeartbeat struct {
+	Worker string
+	// Instance is the host and process that recorded the heartbeat
+	Instance      string
+	Interval      time.Duration
+	LastRunFailed bool
+	BeatAt        time.Time
+}
+
+// staleAt returns when the worker counts as stalled if it records no other
+// heartbeat
+func (hb *WorkerHeartbeat) staleAt() time.Time {
+	return hb.BeatAt.Add(workerStaleIntervals*hb.Interval + workerStaleGrace)
+}
+
+// DependencyCheck is the result of checking one dependency
+// @Description Status of one dependency of the instance
+type DependencyCheck struct {
+	// Status is "ok" or "failing"
+	Status string `json:"status" example:"ok"`
+	// Required checks make the instance unready when they fail; the others
+	// are reported only
+	Required  bool   `json:"required" example:"true"`
+	Detail    string `json:"detail,omitempty" example:"schema version 29"`
+	LatencyMS int64  `json:"latency_ms" example:"3"`
+}
+
+// WorkerStatus is the last heartbeat of a background worker
+// @Description When a background worker last finished a run
+type WorkerStatus struct {
+	Worker          string    `json:"worker" example:"maturity"`
+	Instance        string    `json:"instance" example:"worker-6f9c7/1"`
+	IntervalSeconds float64   `json:"interval_seconds" example:"60"`
+	LastRunFailed   bool      `json:"last_run_failed" example:"false"`
+	LastBeatAt      time.Time `json:"last_beat_at"`
+	// Stale is set when the worker has not finished a run for three of its
+	// intervals and a minute
+	Stale bool `json:"stale" example:"false"`
+}
+
+// Readiness reports whether this instance should receive traffic
+// @Description Whether the instance is ready to serve, with the status of each dependency and its region
+type Readiness struct {
+	Ready bool `json:"ready" example:"true"`
+	// Reason is set when the instance is not ready
+	Reason string `json:"reason,omitempty" example:"replication lag 45s exceeds 30s"`
+	// Checks holds the result of each dependency check by name: database,
+	// migrations, replication, and cache and workers when they apply
+	Checks  map[string]*DependencyCheck `json:"checks"`
+	Workers []*WorkerStatus             `json:"workers,omitempty"`
+	Region  *RegionStatus               `json:"region,omitempty"`
+}
+
+// readinessCheck checks one dependency. It returns a detail to report with
+// its status, and the error when it fails; errors are logged rather than
+// reported, since probes answer without credentials.
+type readinessCheck struct {
+	name     string
+	required bool
+	check    func(ctx context.Context) (string, error)
+}
+
+// GetReadiness reports whether this instance can serve. Its database must
+// be reachable, its schema at least as new as this build expects and the
+// replica its reads come from no further behind than MAX_REPLICATION_LAG, in
+// the active region and in a standby alike. The cache and worker heartbeats
+// are reported but don't affect readiness: reads fall back to the database
+// without the cache, and workers run in deployments of their own.
+func (s *service) GetReadiness(ctx context.Context) *Readiness {
+	var workers []*WorkerStatus
+	checks := []readinessCheck{
+		{"database", true, func(ctx context.Context) (string, error) {
+			if err := s.repo.Ping(ctx); err != nil {
+				return "unreachable", err
+			}
+			return "", nil
+		}},
+		{"replication", true, func(ctx context.Context) (string, error) {
+			lag, err := s.repo.ReplicationLag(ctx)
+			if err != nil {
+				return "replication lag unknown", err
+			}
+			if max := maxReplicationLag(); lag > max {
+				detail := fmt.Sprintf("replication lag %s exceeds %s", lag.Round(time.Second), max)
+				return detail, errors.New(detail)
+			}
+			return fmt.Sprintf("lag %s", lag.Round(time.Millisecond)), nil
+		}},
+		{"workers", false, func(ctx context.Context) (string, error) {
+			var err error
+			workers, err = s.workerStatuses(ctx)
+			if err != nil {
+				return "heartbeats unavailable", err
+			}
+			var stale []string
+			for _, w := range workers {
+				if w.Stale {
+					stale = append(stale, w.Worker)
+				}
+			}
+			if len(stale) > 0 {
+				detail := "no recent run: " + strings.Join(stale, ", ")
+				return detail, errors.New(detail)
+			}
+			return fmt.Sprintf("%d reporting", len(workers)), nil
+		}},
+	}
+	if s.schema != nil {
+		checks = append(checks, readinessCheck{"migrations", true, s.checkMigrations})
+	}
+	if cache, ok := s.repo.(*cachedRepository); ok {
+		checks = append(checks, readinessCheck{"cache", false, func(ctx context.Context) (string, error) {
+			if err := cache.client.Ping(ctx).Err(); err != nil {
+				return "unreachable", err
+			}
+			return "", nil
+		}})
+	}
+
+	// Checks run at once, each with its own deadline
+	results := make([]*DependencyCheck, len(checks))
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+			defer cancel()
+			started := time.Now()
+			detail, err := c.check(checkCtx)
+			results[i] = &DependencyCheck{Status: CheckOK, Required: c.required, Detail: detail, LatencyMS: time.Since(started).Milliseconds()}
+			if err != nil {
+				results[i].Status, errs[i] = CheckFailing, err
+			}
+		}()
+	}
+	wg.Wait()
+
+	readiness := &Readiness{Ready: true, Checks: make(map[string]*DependencyCheck, len(checks)), Workers: workers}
+	for i, c := range checks {
+		readiness.Checks[c.name] = results[i]
+		if errs[i] == nil {
+			continue
+		}
+		s.log(ctx).Warn("Readiness check failed", zap.String("check", c.name), zap.Error(errs[i]))
+		if c.required && readiness.Ready {
+			readiness.Ready, readiness.Reason = false, c.name+": "+results[i].Detail
+		}
+	}
+	if readiness.Checks["database"].Status == CheckOK {
+		if region, err := s.GetRegionStatus(ctx); err == nil {
+			readiness.Region = region
+		}
+	}
+	return readiness
+}
+
+// checkMigrations fails while the database schema is behind this build. A
+// newer schema passes: during a rolling deploy the new release migrates
+// first, and the old one must keep serving until it is replaced.
+func (s *service) checkMigrations(ctx context.Context) (string, error) {
+	current, err := s.schema.Version(ctx)
+	if err != nil {
+		return "schema version unknown", err
+	}
+	latest := s.schema.latest()
+	switch {
+	case current < latest:
+		detail := fmt.Sprintf("schema version %d is behind version %d; run `migrate up`", current, latest)
+		return detail, errors.New(detail)
+	case current > latest:
+		return fmt.Sprintf("schema version %d, ahead of this build's %d", current, latest), nil
+	}
+	return fmt.Sprintf("schema version %d", current), nil
+}
+
+// workerStatuses returns the last heartbeat of every worker
+func (s *service) workerStatuses(ctx context.Context) ([]*WorkerStatus, error) {
+	heartbeats, err := s.repo.ListWorkerHeartbeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	statuses := make([]*WorkerStatus, len(heartbeats))
+	for i, hb := range heartbeats {
+		statuses[i] = &WorkerStatus{
+			Worker:          hb.Worker,
+			Instance:        hb.Instance,
+			IntervalSeconds: hb.Interval.Seconds(),
+			LastRunFailed:   hb.LastRunFailed,
+			LastBeatAt:      hb.BeatAt,
+			Stale:           now.After(hb.staleAt()),
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Worker < statuses[j].Worker })
+	return statuses, nil
+}
+
+// workerInstance names this process in worker heartbeats
+func workerInstance() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
+// heartbeat wraps a worker run so every finished run records the worker's
+// heartbeat, which readiness reports. Runs cut short because the worker is
+// stopping are not recorded. A heartbeat that cannot be written is logged:
+// it only affects what readiness reports.
+func (s *service) heartbeat(worker string, interval time.Duration, run func(context.Context) error) func(context.Context) error {
+	instance := workerInstance()
+	return func(ctx context.Context) error {
+		err := run(ctx)
+		if ctx.Err() != nil {
+			return err
+		}
+		hb := &WorkerHeartbeat{Worker: worker, Instance: instance, Interval: interval, LastRunFailed: err != nil, BeatAt: time.Now().UTC()}
+		if herr := s.repo.RecordWorkerHeartbeat(ctx, hb); herr != nil {
+			s.log(ctx).Warn("Failed to record worker heartbeat", zap.String("worker", worker), zap.Error(herr))
+		}
+		return err
+	}
+}
+
+// livenessHandler godoc
+// @Summary Liveness probe
+// @Description Answers 200 while the process is running and able to serve HTTP. It checks no dependencies, so a database outage doesn't get healthy instances restarted; use /readyz to take an instance out of rotation.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "timestamp": time.Now().UTC().Format(time.RFC3339)})
+}
+
+// readyHandler godoc
+// @Summary Readiness probe
+// @Description Reports whether the instance should receive traffic, with the status of each dependency. The database must be reachable, the schema migrated to at least this build's version and the replica within MAX_REPLICATION_LAG of the primary. The cache and worker heartbeats are reported without affecting readiness. Includes the region status in a multi-region deployment. Also served at /ready.
+// @Tags health
+// @Produce json
+// @Success 200 {object} Readiness
+// @Failure 503 {object} Readiness
+// @Router /readyz [get]
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, "Service not available")
+		return
+	}
+
+	ctx := r.Context()
+
+	readiness := svc.GetReadiness(ctx)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(readiness)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StatusClosed is an account its holder closed once its final payout was
+// sent. It is also recorded in an account's history when staff delete it.
+const StatusClosed = "closed"
+
+// Account history entry types
+const (
+	HistoryStatusChange    = "status_change"
+	HistoryPrincipalChange = "principal_change"
+	HistoryFunding         = "funding"
+	HistoryInterestPayout  = "interest_payout"
+	HistoryMaturityPayout  = "maturity_payout"
+	HistoryAdjustment      = "interest_adjustment"
+)
+
+// StatusChange records an account moving from one status to another
+type StatusChange struct {
+	AccountID int
+	// From is empty for the status the account opened with
+	From      string
+	To        string
+	Principal float64
+	Note      string
+	ChangedAt time.Time
+}
+
+// maturedChange returns the status change of an account that matures at at
+func maturedChange(a *BlockAccount, outcome *MaturityOutcome, at time.Time) *StatusChange {
+	c := &StatusChange{AccountID: a.ID, From: a.Status, To: outcome.Status, Principal: a.Principal, ChangedAt: at}
+	if outcome.Rollover != nil {
+		c.Note = "rolled over into " + outcome.Rollover.ExternalID
+	}
+	return c
+}
+
+// HistoryEntry is one event in the life of a block account, with what the
+// deposit was worth once it happened
+// @Description An event in the life of a block account
+type HistoryEntry struct {
+	At time.Time `json:"at"`
+	// Type is "status_change", "principal_change", "funding",
+	// "interest_payout", "interest_adjustment" or "maturity_payout"
+	Type string `json:"type" example:"status_change"`
+	// Status is the account's status once the event happened
+	Status     string `json:"status" example:"active"`
+	FromStatus string `json:"from_status,omitempty" example:"pending_funding"`
+	ToStatus   string `json:"to_status,omitempty" example:"active"`
+	// Amount is the money moved by a funding or payout, or credited by an
+	// interest adjustment
+	Amount float64 `json:"amount,omitempty" example:"4.11"`
+	// Principal and InterestPaid are the account's principal and the
+	// interest paid on it so far
+	Principal    float64 `json:"principal" example:"1000.00"`
+	InterestPaid float64 `json:"interest_paid" example:"4.11"`
+	// InterestAccrued is the interest earned so far, paid or not. It is
+	// omitted once the account has been closed.
+	InterestAccrued *float64 `json:"interest_accrued,omitempty" example:"4.25"`
+	Detail          string   `json:"detail,omitempty" example:"funding confirmed"`
+	// ValueDate is when the event took effect, set when that was before the
+	// day it was booked on, At: the start date of an account value-dated or
+	// imported, or the value date of an interest adjustment
+	ValueDate *time.Time `json:"value_date,omitempty"`
+}
+
+// AccountHistory is what happened to a block account, oldest first
+// @Description Chronological history of a block account's status, principal, interest and payouts
+type AccountHistory struct {
+	AccountExternalID string `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	// Status is the account's current status, "closed" once deleted
+	Status  string          `json:"status" example:"active"`
+	Entries []*HistoryEntry `json:"entries"`
+}
+
+// GetAccountHistory returns the history of an account, including one since
+// closed, from its status changes, funding and payouts. It returns nil when
+// nothing was ever recorded for the account.
+func (s *service) GetAccountHistory(ctx context.Context, id int) (*AccountHistory, error) {
+	changes, err := s.repo.ListStatusChanges(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to list status changes", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	account, err := s.repo.GetAccount(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	funding, err := s.repo.GetFunding(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get funding", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	interest, err := s.repo.ListInterestPayouts(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to list interest payouts", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	payouts, err := s.repo.ListPayouts(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to list payouts", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	adjustments, err := s.repo.ListInterestAdjustments(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to list interest adjustments", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+
+	var entries []*HistoryEntry
+	for _, c := range changes {
+		e := &HistoryEntry{
+			At: c.ChangedAt, Type: HistoryStatusChange, FromStatus: c.From, ToStatus: c.To,
+			Principal: c.Principal, Detail: c.Note,
+		}
+		if account != nil && c.From == "" && c.To == StatusActive {
+			e.ValueDate = earlierValueDate(account.StartDate, c.ChangedAt)
+		}
+		entries = append(entries, e)
+	}
+	if funding != nil && funding.SettledAt != nil {
+		detail := "funding " + funding.Status
+		if funding.FailureReason != "" {
+			detail += ": " + funding.FailureReason
+		}
+		entries = append(entries, &HistoryEntry{At: *funding.SettledAt, Type: HistoryFunding, Amount: funding.Amount, Detail: detail})
+	}
+	for _, p := range interest {
+		entries = append(entries, &HistoryEntry{
+			At: p.CreatedAt, Type: HistoryInterestPayout, Amount: p.Amount,
+			Detail: "interest for " + p.PeriodStart.Format(time.DateOnly) + " to " + p.PeriodEnd.Format(time.DateOnly),
+		})
+	}
+	for _, adj := range adjustments {
+		detail := fmt.Sprintf("%s adjustment approved by %s: %s", adj.Kind, adj.ApprovedBy, adj.Reason)
+		if adj.Rate != adj.PreviousRate {
+			detail += fmt.Sprintf(" (rate %g to %g)", adj.PreviousRate, adj.Rate)
+		}
+		entries = append(entries, &HistoryEntry{At: adj.CreatedAt, Type: HistoryAdjustment, Amount: adj.Amount, Detail: detail, ValueDate: adj.ValueDate})
+	}
+	for _, p := range payouts {
+		detail := "payout " + p.Status
+		if p.FailureReason != "" {
+			detail += ": " + p.FailureReason
+		}
+		entries = append(entries, &HistoryEntry{At: p.CreatedAt, Type: HistoryMaturityPayout, Amount: p.Amount, Detail: detail})
+	}
+	// Status changes come first among events at the same time, so that
+	// what they lead to follows them
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].At.Equal(entries[j].At) {
+			return entries[i].At.Before(entries[j].At)
+		}
+		return entries[i].Type == HistoryStatusChange && entries[j].Type != HistoryStatusChange
+	})
+
+	history := &AccountHistory{Status: StatusClosed}
+	if account != nil {
+		history.AccountExternalID, history.Status = account.ExternalID, account.Status
+	} else if ids, err := s.repo.AccountExternalIDs(ctx, []int{id}); err == nil {
+		history.AccountExternalID = ids[id]
+	}
+
+	// Carry the account's state forward through its history, noting where
+	// its principal changed
+	var status string
+	var principal, paid float64
+	for _, e := range entries {
+		if e.Type == HistoryStatusChange {
+			if e.Principal != principal && principal != 0 {
+				history.Entries = append(history.Entries, &HistoryEntry{
+					At: e.At, Type: HistoryPrincipalChange, Status: status, Amount: roundMoney(e.Principal - principal),
+					Principal: e.Principal, InterestPaid: paid, InterestAccrued: accruedAt(account, e.At),
+				})
+			}
+			status, principal = e.ToStatus, e.Principal
+		}
+		if e.Type == HistoryInterestPayout {
+			paid = roundMoney(paid + e.Amount)
+		}
+		e.Status, e.Principal, e.InterestPaid, e.InterestAccrued = status, principal, paid, accruedAt(account, e.At)
+		history.Entries = append(history.Entries, e)
+	}
+	return history, nil
+}
+
+// accruedAt returns the interest the account had earned by at, or nil once
+// the account has been closed and its terms are gone
+func accruedAt(account *BlockAccount, at time.Time) *float64 {
+	if account == nil {
+		return nil
+	}
+	accrued := roundMoney(interestBetween(account, account.StartDate, at))
+	return &accrued
+}
+
+// getAccountHistoryHandler godoc
+// @Summary Get the history of a block account
+// @Description Lists what happened to a block account, oldest first by when it was booked: its status changes, principal changes, funding, interest payments, interest adjustments and maturity payout, each with the principal, interest paid and interest accrued once it happened. Entries that took effect before they were booked, such as the opening of a value-dated account, carry their value_date. Accounts since closed keep their history.
+// @Tags block-account
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Success 200 {object} AccountHistory
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/history [get]
+func getAccountHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	history, err := svc.GetAccountHistory(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if history == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+
+	writeSuccess(w, r, history, "Account history retrieved successfully")
+}
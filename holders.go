@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Account holder roles. The primary holder is the user an account was opened
+// for, its user_id; secondary holders are added to it later.
+const (
+	HolderPrimary   = "primary"
+	HolderSecondary = "secondary"
+)
+
+// UserIDHeader names the customer a request acts for. Like the staff
+// identity headers it is set by the authenticating gateway in front of
+// customer traffic, which must strip it from what clients send. Requests
+// without it, such as the back office's, act for no customer.
+const UserIDHeader = "X-User-ID"
+
+const actingUserKey ctxKey = "actingUser"
+
+var (
+	// ErrPrimaryHolderRequired is returned when a customer other than the
+	// account's primary holder withdraws from it or adds a holder to it
+	ErrPrimaryHolderRequired = newAPIError(CodePrimaryHolderRequired, "only the account's primary holder may do this")
+	// ErrAlreadyHolder is returned when a user is added to an account they already hold
+	ErrAlreadyHolder = newAPIError(CodeAlreadyHolder, "user already holds the account")
+	// ErrPrimaryHolderFixed is returned when the primary holder is removed from an account
+	ErrPrimaryHolderFixed = newAPIError(CodePrimaryHolderFixed, "the primary holder cannot be removed from the account")
+	// ErrHolderNotFound is returned when a user removed from an account is not its secondary holder
+	ErrHolderNotFound = newAPIError(CodeHolderNotFound, "user is not a secondary holder of the account")
+)
+
+// AccountHolder is a user who owns a block account
+// @Description A user who owns a block account. Every account has one primary holder, the user it was opened for, who alone may withdraw from it; secondary holders see it among their accounts.
+type AccountHolder struct {
+	AccountID int `json:"-"`
+	UserID    int `json:"user_id" example:"456"`
+	// Role is "primary" or "secondary"
+	Role string `json:"role" example:"secondary"`
+	// AddedBy is the staff ID that added a secondary holder, or "customer"
+	AddedBy   string    `json:"added_by,omitempty" example:"customer"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddAccountHolderRequest adds a secondary holder to an account
+// @Description Request payload for adding a secondary holder to a block account
+type AddAccountHolderRequest struct {
+	UserID int `json:"user_id" example:"456" validate:"gt=0"`
+}
+
+// withActingUser returns ctx carrying the customer the request acts for
+func withActingUser(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, actingUserKey, userID)
+}
+
+// actingUserFromContext returns the customer recorded by withActingUser, or
+// 0 when the request acts for none
+func actingUserFromContext(ctx context.Context) int {
+	userID, _ := ctx.Value(actingUserKey).(int)
+	return userID
+}
+
+// ActingUserMiddleware records the customer named by X-User-ID, if any, for
+// the service's holder checks
+func ActingUserMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := strings.TrimSpace(r.Header.Get(UserIDHeader))
+		if v == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, err := strconv.Atoi(v)
+		if err != nil || userID <= 0 {
+			writeErrorCode(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid "+UserIDHeader+" header")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withActingUser(r.Context(), userID)))
+	})
+}
+
+// checkPrimaryHolder returns ErrPrimaryHolderRequired when the request acts
+// for a customer other than the account's primary holder
+func checkPrimaryHolder(ctx context.Context, a *BlockAccount) error {
+	if userID := actingUserFromContext(ctx); userID != 0 && userID != a.UserID {
+		return ErrPrimaryHolderRequired
+	}
+	return nil
+}
+
+// holdsAccount reports whether userID is among holders
+func holdsAccount(holders []*AccountHolder, userID int) bool {
+	return slices.ContainsFunc(holders, func(h *AccountHolder) bool { return h.UserID == userID })
+}
+
+// ListAccountHolders returns the account's holders, primary first. It
+// returns nil when the account does not exist.
+func (s *service) ListAccountHolders(ctx context.Context, accountID int) ([]*AccountHolder, error) {
+	account, err := s.repo.GetAccount(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+	holders, err := s.repo.ListAccountHolders(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to list account holders", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	return holders, nil
+}
+
+// AddAccountHolder makes the user a secondary holder of the account. Only
+// its primary holder may add one. It returns nil when the account does not
+// exist.
+func (s *service) AddAccountHolder(ctx context.Context, accountID int, actor string, req *AddAccountHolderRequest) (*AccountHolder, error) {
+	account, err := s.repo.GetAccount(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+	if err := checkPrimaryHolder(ctx, account); err != nil {
+		return nil, err
+	}
+	if req.UserID == account.UserID {
+		return nil, ErrAlreadyHolder
+	}
+	if err := s.checkUserExists(ctx, req.UserID); err != nil {
+		return nil, err
+	}
+
+	holder := &AccountHolder{AccountID: accountID, UserID: req.UserID, Role: HolderSecondary, AddedBy: actor}
+	if err := s.repo.AddAccountHolder(ctx, holder); err != nil {
+		if err != ErrAlreadyHolder {
+			s.log(ctx).Error("Failed to add account holder", zap.Error(err), zap.Int("accountID", accountID))
+		}
+		return nil, err
+	}
+	s.log(ctx).Info("Account holder added", zap.Int("accountID", accountID),
+		zap.Int("userID", req.UserID), zap.String("by", actor))
+	return holder, nil
+}
+
+// RemoveAccountHolder removes a secondary holder from the account. The
+// primary holder may remove anyone else, and a secondary holder themselves.
+// It returns sql.ErrNoRows when the account does not exist.
+func (s *service) RemoveAccountHolder(ctx context.Context, accountID, userID int) error {
+	account, err := s.repo.GetAccount(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account", zap.Error(err), zap.Int("accountID", accountID))
+		return err
+	}
+	if account == nil {
+		return sql.ErrNoRows
+	}
+	if userID == account.UserID {
+		return ErrPrimaryHolderFixed
+	}
+	if acting := actingUserFromContext(ctx); acting != 0 && acting != userID {
+		if err := checkPrimaryHolder(ctx, account); err != nil {
+			return err
+		}
+	}
+
+	err = s.repo.RemoveAccountHolder(ctx, accountID, userID)
+	if err == sql.ErrNoRows {
+		return ErrHolderNotFound
+	}
+	if err != nil {
+		s.log(ctx).Error("Failed to remove account holder", zap.Error(err), zap.Int("accountID", accountID))
+		return err
+	}
+	s.log(ctx).Info("Account holder removed", zap.Int("accountID", accountID), zap.Int("userID", userID))
+	return nil
+}
+
+// listAccountHoldersHandler godoc
+// @Summary List an account's holders
+// @Description The users who own the account: its primary holder, the user it was opened for, then its secondary holders in the order they were added
+// @Tags block-account
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]AccountHolder}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/holders [get]
+func listAccountHoldersHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	holders, err := svc.ListAccountHolders(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if holders == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+	writeList(w, r, page, holders, "Account holders retrieved successfully")
+}
+
+// addAccountHolderHandler godoc
+// @Summary Add a holder to an account
+// @Description Makes a user a secondary holder of the account, turning it into a joint account. The account then appears among the user's accounts, but only the primary holder may close it or change where it pays out. When X-User-ID is sent it must name the primary holder.
+// @Tags block-account
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param X-User-ID header int false "Customer the request acts for, set by the gateway"
+// @Param holder body AddAccountHolderRequest true "User to add"
+// @Success 201 {object} AccountHolder
+// @Header 201 {string} Location "URL of the account's holders"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "X-User-ID is not the primary holder"
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The user already holds the account"
+// @Failure 422 {object} ErrorResponse "The user does not exist"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse "The user service's circuit breaker is open"
+// @Router /v2/block-account/{id}/holders [post]
+func addAccountHolderHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	var req AddAccountHolderRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	holder, err := svc.AddAccountHolder(ctx, id, requestActor(r), &req)
+	switch err {
+	case nil:
+	case ErrPrimaryHolderRequired:
+		writeAPIError(w, http.StatusForbidden, err)
+		return
+	case ErrAlreadyHolder:
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	case ErrUnknownUser:
+		writeErrorCode(w, http.StatusUnprocessableEntity, CodeUserNotFound, fmt.Sprintf("user %d does not exist", req.UserID))
+		return
+	default:
+		if errors.Is(err, ErrCircuitOpen) {
+			writeAPIError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if holder == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+
+	markWrite(w)
+	writeCreated(w, r, apiPath("/block-account/"+chi.URLParam(r, "id")+"/holders"), holder, "Account holder added successfully")
+}
+
+// removeAccountHolderHandler godoc
+// @Summary Remove a holder from an account
+// @Description Removes a secondary holder from the account; the account leaves their list of accounts. The primary holder cannot be removed. When X-User-ID is sent it must name the primary holder or the holder being removed.
+// @Tags block-account
+// @Param id path string true "Account ID" Format(uuid)
+// @Param userID path int true "User ID of the holder" Format(int64)
+// @Param X-User-ID header int false "Customer the request acts for, set by the gateway"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "X-User-ID is neither the primary holder nor the holder removed"
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The user is the primary holder"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/holders/{userID} [delete]
+func removeAccountHolderHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	switch err := svc.RemoveAccountHolder(ctx, id, userID); err {
+	case nil:
+	case sql.ErrNoRows:
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	case ErrHolderNotFound:
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	case ErrPrimaryHolderRequired:
+		writeAPIError(w, http.StatusForbidden, err)
+		return
+	case ErrPrimaryHolderFixed:
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	default:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestJointAccount(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(1)
+	holders := "/v2/block-account/" + id + "/holders"
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		headers []string
+		status  int
+		code    string
+	}{
+		{"add by a non-holder", http.MethodPost, holders, `{"user_id":2}`, []string{UserIDHeader, "2"}, http.StatusForbidden, CodePrimaryHolderRequired},
+		{"add by the primary holder", http.MethodPost, holders, `{"user_id":2}`, []string{UserIDHeader, "1"}, http.StatusCreated, ""},
+		{"add again", http.MethodPost, holders, `{"user_id":2}`, nil, http.StatusConflict, CodeAlreadyHolder},
+		{"add the primary holder", http.MethodPost, holders, `{"user_id":1}`, nil, http.StatusConflict, CodeAlreadyHolder},
+		{"add user 0", http.MethodPost, holders, `{"user_id":0}`, nil, http.StatusBadRequest, CodeInvalidUserID},
+		{"invalid acting user", http.MethodPost, holders, `{"user_id":3}`, []string{UserIDHeader, "me"}, http.StatusBadRequest, CodeInvalidUserID},
+		{"change instruction as co-holder", http.MethodPut, "/v2/block-account/" + id + "/maturity-instruction", `{"instruction":"rollover"}`,
+			[]string{UserIDHeader, "2", "If-Match", api.etag(id)}, http.StatusForbidden, CodePrimaryHolderRequired},
+		{"close as co-holder", http.MethodPost, "/v2/block-account/" + id + "/close", `{"destination_account":"1000123456789","method":"bank_transfer"}`,
+			[]string{UserIDHeader, "2", "If-Match", api.etag(id)}, http.StatusForbidden, CodePrimaryHolderRequired},
+		{"remove the primary holder", http.MethodDelete, holders + "/1", "", nil, http.StatusConflict, CodePrimaryHolderFixed},
+		{"remove by another customer", http.MethodDelete, holders + "/2", "", []string{UserIDHeader, "3"}, http.StatusForbidden, CodePrimaryHolderRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := api.do(tt.method, tt.path, tt.body, tt.headers...)
+			if w.Code != tt.status || errorCode(w) != tt.code {
+				t.Errorf("%s %s = %d %s, want %d %s", tt.method, tt.path, w.Code, w.Body, tt.status, tt.code)
+			}
+		})
+	}
+
+	var listed struct {
+		Items []*AccountHolder `json:"items"`
+	}
+	decodeData(t, api.do(http.MethodGet, holders, "").Body.Bytes(), &listed)
+	if len(listed.Items) != 2 || listed.Items[0].Role != HolderPrimary || listed.Items[1].UserID != 2 {
+		t.Errorf("holders = %+v, want 1 primary then 2", listed.Items)
+	}
+
+	var accounts struct {
+		Items []*BlockAccount `json:"items"`
+	}
+	decodeData(t, api.do(http.MethodGet, "/v2/user/2/block-accounts", "").Body.Bytes(), &accounts)
+	if len(accounts.Items) != 1 || accounts.Items[0].ExternalID != id {
+		t.Errorf("co-holder's accounts = %+v, want %s", accounts.Items, id)
+	}
+
+	// Secondary holders may leave on their own
+	if w := api.do(http.MethodDelete, holders+"/2", "", UserIDHeader, "2"); w.Code != http.StatusNoContent {
+		t.Fatalf("leave: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodDelete, holders+"/2", ""); w.Code != http.StatusNotFound || errorCode(w) != CodeHolderNotFound {
+		t.Errorf("leave again = %d %s, want 404 %s", w.Code, w.Body, CodeHolderNotFound)
+	}
+	decodeData(t, api.do(http.MethodGet, "/v2/user/2/block-accounts", "").Body.Bytes(), &accounts)
+	if len(accounts.Items) != 0 {
+		t.Errorf("former co-holder's accounts = %+v, want none", accounts.Items)
+	}
+}
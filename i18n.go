@@ -0,0 +1,168 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"text/template"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// Locales error messages and notifications are written in. English is the
+// language of the service; the other catalogs are translated from it.
+const (
+	LocaleEnglish = "en"
+	LocaleAmharic = "am"
+)
+
+// locales are the supported locales, in the order localeMatcher matches them
+var locales = []string{LocaleEnglish, LocaleAmharic}
+
+// localeMatcher matches Accept-Language against the supported locales
+var localeMatcher = language.NewMatcher([]language.Tag{language.English, language.Amharic})
+
+//go:embed messages/*.json
+var messageCatalogFiles embed.FS
+
+// messageCatalogs hold the error messages of each locale, keyed by the
+// error code they explain
+var messageCatalogs = loadMessageCatalogs()
+
+// loadMessageCatalogs reads messages/<locale>.json for each locale
+func loadMessageCatalogs() map[string]map[string]string {
+	catalogs := map[string]map[string]string{}
+	for _, locale := range locales {
+		data, err := messageCatalogFiles.ReadFile("messages/" + locale + ".json")
+		if err != nil {
+			panic(fmt.Sprintf("message catalog %s: %v", locale, err))
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("message catalog %s: %v", locale, err))
+		}
+		catalogs[locale] = messages
+	}
+	return catalogs
+}
+
+// supportedLocale reports whether locale is one messages are written in
+func supportedLocale(locale string) bool {
+	return slices.Contains(locales, locale)
+}
+
+// defaultLocale returns DEFAULT_LOCALE, the locale of customers who did
+// not choose one, English when it is unset or not supported
+func defaultLocale() string {
+	if locale := os.Getenv("DEFAULT_LOCALE"); supportedLocale(locale) {
+		return locale
+	}
+	return LocaleEnglish
+}
+
+// negotiateLocale returns the supported locale that best matches an
+// Accept-Language header, or "" when the header names none of them
+func negotiateLocale(acceptLanguage string) string {
+	if acceptLanguage == "" {
+		return ""
+	}
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	_, i, confidence := localeMatcher.Match(tags...)
+	if confidence == language.No {
+		return ""
+	}
+	return locales[i]
+}
+
+// localeWriter carries the locale negotiated for a request to the error
+// writers, which are not handed the request
+type localeWriter struct {
+	http.ResponseWriter
+	// locale is empty when the client did not ask for a supported one
+	locale string
+}
+
+// Unwrap lets http.ResponseController reach the writer underneath
+func (w *localeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// responseLocale returns the locale negotiated for the response w writes,
+// looking through the writers middlewares wrapped it in. ok is false when
+// the request did not pass LocaleMiddleware.
+func responseLocale(w http.ResponseWriter) (locale string, ok bool) {
+	for {
+		switch t := w.(type) {
+		case *localeWriter:
+			return t.locale, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return "", false
+		}
+	}
+}
+
+// LocaleMiddleware negotiates the language of error messages from
+// Accept-Language
+func LocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&localeWriter{ResponseWriter: w, locale: negotiateLocale(r.Header.Get("Accept-Language"))}, r)
+	})
+}
+
+// localizeError translates the messages of resp into locale by their codes
+// and returns the language they are then in. English messages are kept as
+// the service wrote them, with their particulars; codes a catalog has no
+// message for keep theirs too.
+func localizeError(resp *ErrorResponse, locale string) string {
+	messages := messageCatalogs[locale]
+	if locale == LocaleEnglish || messages == nil {
+		return LocaleEnglish
+	}
+	translated := LocaleEnglish
+	if message, ok := messages[resp.ErrorCode]; ok {
+		resp.Message, translated = message, locale
+	}
+	if len(resp.Fields) > 0 {
+		fields := slices.Clone(resp.Fields)
+		for i, f := range fields {
+			if message, ok := messages[f.Code]; ok {
+				fields[i].Message = message
+			}
+		}
+		resp.Fields = fields
+	}
+	return translated
+}
+
+// localeTemplateFuncs replace the formatting functions of
+// documentTemplateFuncs in notifications of each non-English locale
+var localeTemplateFuncs = map[string]template.FuncMap{
+	LocaleAmharic: {
+		"date": func(t time.Time) string { return t.In(businessLocation()).Format("02/01/2006") },
+		"term": func(period string) string {
+			p, ok := catalog.get(period)
+			switch {
+			case !ok:
+				return period
+			case p.TermMonths%12 == 0:
+				return fmt.Sprintf("%d ዓመት", p.TermMonths/12)
+			}
+			return fmt.Sprintf("%d ወር", p.TermMonths)
+		},
+		"instruction": func(i string) string {
+			if i == InstructionRollover {
+				return "ተቀማጩን በወቅቱ ተመን ለተመሳሳይ ጊዜ እናድሳለን"
+			}
+			return "ዋናውን ገንዘብና ወለዱን እንከፍላለን"
+		},
+	},
+}
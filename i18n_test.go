@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageCatalogsCoverErrorCodes(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "errors.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		spec, ok := n.(*ast.ValueSpec)
+		if !ok || !strings.HasPrefix(spec.Names[0].Name, "Code") || len(spec.Values) != 1 {
+			return true
+		}
+		if lit, ok := spec.Values[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			code, _ := strconv.Unquote(lit.Value)
+			codes = append(codes, code)
+		}
+		return true
+	})
+	if len(codes) == 0 {
+		t.Fatal("no error codes found in errors.go")
+	}
+
+	for _, locale := range locales {
+		messages := messageCatalogs[locale]
+		for _, code := range codes {
+			if strings.TrimSpace(messages[code]) == "" {
+				t.Errorf("%s catalog has no message for %s", locale, code)
+			}
+		}
+		for code := range messages {
+			if !slices.Contains(codes, code) {
+				t.Errorf("%s catalog has a message for unknown code %s", locale, code)
+			}
+		}
+	}
+}
+
+func TestNotificationTemplatesPerLocale(t *testing.T) {
+	data := notificationData{AccountID: 7, UserID: 1, Currency: "ETB", DaysLeft: 3, Destination: "1000123456789",
+		Reason: "Rejected account number", Account: &AccountSnapshot{Principal: 1000, InterestRate: 0.07, Period: "1y",
+			EndDate: time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC), MaturityInstruction: InstructionPayout}}
+	for event := range customerEvents {
+		for _, locale := range locales {
+			subject, body, err := renderNotification(event, locale, data)
+			if err != nil || subject == "" || body == "" {
+				t.Errorf("%s in %s: %q %q %v", event, locale, subject, body, err)
+			}
+		}
+	}
+	_, body, _ := renderNotification(EventAccountCreated, LocaleAmharic, data)
+	if !strings.Contains(body, "1 ዓመት") || !strings.Contains(body, "01/03/2027") {
+		t.Errorf("Amharic body = %q", body)
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	api := newTestAPI(t)
+
+	// Amharic, asked for by region, is translated by the error code
+	w := api.do(http.MethodGet, "/v2/block-account/not-a-uuid", "", "Accept-Language", "am-ET, en;q=0.5")
+	var resp ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ErrorCode != CodeInvalidAccountID || resp.Message != messageCatalogs[LocaleAmharic][CodeInvalidAccountID] {
+		t.Errorf("Amharic error = %+v", resp)
+	}
+	if w.Header().Get("Content-Language") != LocaleAmharic || !slices.Contains(w.Header().Values("Vary"), "Accept-Language") {
+		t.Errorf("headers = %v", w.Header())
+	}
+
+	// Field errors are translated too
+	w = api.do(http.MethodPost, "/v2/block-account", `{"user_id":1,"principal":-5,"period":"5y"}`, "Accept-Language", "am")
+	resp = ErrorResponse{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ErrorCode != CodeValidationFailed || len(resp.Fields) < 2 {
+		t.Fatalf("validation error = %d %s", w.Code, w.Body)
+	}
+	for _, f := range resp.Fields {
+		if f.Message != messageCatalogs[LocaleAmharic][f.Code] {
+			t.Errorf("field %s message = %q", f.Field, f.Message)
+		}
+	}
+
+	// English and unsupported languages keep the service's own message
+	for _, accept := range []string{"en-US", "fr", ""} {
+		w := api.do(http.MethodGet, "/v2/block-account/not-a-uuid", "", "Accept-Language", accept)
+		resp := ErrorResponse{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Message == messageCatalogs[LocaleAmharic][CodeInvalidAccountID] || resp.Message == "" {
+			t.Errorf("%q: message = %q", accept, resp.Message)
+		}
+		if want := map[string]string{"en-US": LocaleEnglish}[accept]; w.Header().Get("Content-Language") != want {
+			t.Errorf("%q: Content-Language = %q, want %q", accept, w.Header().Get("Content-Language"), want)
+		}
+	}
+}
+
+func TestNotificationsInCustomerLocale(t *testing.T) {
+	api := newTestAPI(t)
+	var prefs NotificationPreferences
+	api.create(http.MethodGet, "/v2/user/61/notification-preferences", "", &prefs)
+	if prefs.Locale != LocaleEnglish {
+		t.Errorf("default locale = %q", prefs.Locale)
+	}
+	if w := api.do(http.MethodPut, "/v2/user/61/notification-preferences", `{"channels":[],"locale":"fr"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported locale: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodPut, "/v2/user/61/notification-preferences", `{"channels":[],"locale":"am"}`); w.Code != http.StatusOK {
+		t.Fatalf("set locale: %d %s", w.Code, w.Body)
+	}
+
+	id := api.createAccount(61)
+	if w := api.do(http.MethodPut, "/v2/block-account/"+id+"/maturity-instruction", `{"instruction":"rollover"}`,
+		"If-Match", api.etag(id)); w.Code != http.StatusOK {
+		t.Fatalf("change instruction: %d %s", w.Code, w.Body)
+	}
+	var comms struct {
+		Items []Communication `json:"items"`
+	}
+	api.create(http.MethodGet, "/v2/block-account/"+id+"/communications", "", &comms)
+	i := slices.IndexFunc(comms.Items, func(c Communication) bool { return c.Event == EventMaturityInstructionChanged })
+	if i < 0 || comms.Items[i].Subject != "የጊዜ ማብቂያ መመሪያዎ ተቀይሯል" {
+		t.Errorf("communications = %+v", comms.Items)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// IdempotencyKeyHeader lets a client retry a create: a repeat with the
+	// same key gets the account the first request opened instead of a new one
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on the response to a repeated create
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key accepted
+const maxIdempotencyKeyLength = 255
+
+// idempotencyKeyTTL is how long a key keeps replaying the account it
+// opened. A key used again after that opens a new one.
+const idempotencyKeyTTL = 24 * time.Hour
+
+const idempotencyKeyKey ctxKey = "idempotencyKey"
+
+// ErrIdempotencyKeyReused is returned when an Idempotency-Key comes back
+// with a request other than the one it was first sent with
+var ErrIdempotencyKeyReused = newAPIError(CodeIdempotencyKeyReused, "the Idempotency-Key was sent before with a different request")
+
+// errIdempotencyKeyTaken is returned by CreateAccount when a create with the
+// same idempotency key committed first
+var errIdempotencyKeyTaken = errors.New("idempotency key already used")
+
+// withIdempotencyKey records the create's Idempotency-Key
+func withIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey, key)
+}
+
+// idempotencyKeyFromContext returns the key recorded by withIdempotencyKey, or ""
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey).(string)
+	return key
+}
+
+// requestFingerprint identifies a request body, so that a key sent again
+// with another body is told apart from a retry
+func requestFingerprint(req any) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// replayCreate returns the account an earlier create with key opened in the
+// last idempotencyKeyTTL, or nil when none did. It returns
+// ErrIdempotencyKeyReused when that create was for another request.
+func (s *service) replayCreate(ctx context.Context, key, fingerprint string) (*BlockAccount, error) {
+	// Keys expire on the wall clock they are stored by, not the deployment's:
+	// a retry window is real time even in a sandbox
+	accountID, stored, err := s.repo.FindIdempotentCreate(ctx, key, time.Now().Add(-idempotencyKeyTTL))
+	if err != nil {
+		s.log(ctx).Error("Failed to look up idempotency key", zap.Error(err))
+		return nil, err
+	}
+	if accountID == 0 {
+		return nil, nil
+	}
+	if stored != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	account, err := s.GetBlockAccount(ctx, accountID)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	account.AgreementURL = agreementLocation(account.ExternalID)
+	account.replayed = true
+	s.log(ctx).Info("Replayed create", zap.String("account", account.ExternalID))
+	return account, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestIdempotentCreate(t *testing.T) {
+	api := newTestAPI(t)
+	const body = `{"user_id":41,"principal":1000,"period":"1y"}`
+	accounts := func() (n int) {
+		t.Helper()
+		if err := api.db.QueryRow(`SELECT COUNT(*) FROM block_accounts WHERE user_id = 41`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	var first struct {
+		ID string `json:"id"`
+	}
+	w := api.do(http.MethodPost, "/v2/block-account", body, IdempotencyKeyHeader, "order-1")
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("first create: %d %s", w.Code, w.Body)
+	}
+	decodeData(t, w.Body.Bytes(), &first)
+
+	// A retry gets the same account and opens nothing
+	var retried struct {
+		ID string `json:"id"`
+	}
+	w = api.do(http.MethodPost, "/v2/block-account", body, IdempotencyKeyHeader, "order-1")
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("retry: %d %s", w.Code, w.Body)
+	}
+	decodeData(t, w.Body.Bytes(), &retried)
+	if retried.ID != first.ID {
+		t.Errorf("retry opened %s, want %s", retried.ID, first.ID)
+	}
+	if n := accounts(); n != 1 {
+		t.Errorf("%d accounts after a retry, want 1", n)
+	}
+
+	// The key cannot be used for another request
+	w = api.do(http.MethodPost, "/v2/block-account", `{"user_id":41,"principal":2000,"period":"1y"}`, IdempotencyKeyHeader, "order-1")
+	if w.Code != http.StatusUnprocessableEntity || errorCode(w) != CodeIdempotencyKeyReused {
+		t.Errorf("reused key: %d %s", w.Code, w.Body)
+	}
+
+	// Creates racing with one key open one account, and are not refused as
+	// each other's duplicates
+	t.Setenv("DUPLICATE_ACCOUNT_WINDOW", "1m")
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	ids := make([]string, 4)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			w := api.do(http.MethodPost, "/v2/block-account", `{"user_id":41,"principal":1500,"period":"1y"}`, IdempotencyKeyHeader, "order-2")
+			var account struct {
+				ID string `json:"id"`
+			}
+			if w.Code != http.StatusCreated {
+				t.Errorf("concurrent create: %d %s", w.Code, w.Body)
+				return
+			}
+			decodeData(t, w.Body.Bytes(), &account)
+			ids[i] = account.ID
+		}()
+	}
+	close(start)
+	wg.Wait()
+	for _, id := range ids[1:] {
+		if id != ids[0] {
+			t.Errorf("concurrent creates opened %v, want one account", ids)
+			break
+		}
+	}
+	if n := accounts(); n != 2 {
+		t.Errorf("%d accounts after concurrent creates, want 2", n)
+	}
+
+	// Without a key every create opens an account
+	t.Setenv("DUPLICATE_ACCOUNT_WINDOW", "")
+	api.createAccount(41)
+	api.createAccount(41)
+	if n := accounts(); n != 4 {
+		t.Errorf("%d accounts without keys, want 4", n)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Supported ID_GENERATOR values
+const (
+	IDGeneratorUUIDv7 = "uuidv7"
+	IDGeneratorUUIDv4 = "uuidv4"
+)
+
+// errNoExternalID is returned when an account is stored without an external ID
+var errNoExternalID = errors.New("block account has no external ID")
+
+// IDGenerator makes the external identifiers of new block accounts. External
+// IDs are what the API and events call an account; the serial ID stays
+// internal to the database.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// uuidV7Generator makes time-ordered UUIDs, which are globally unique across
+// regions and keep inserts into the external ID index close together
+type uuidV7Generator struct{}
+
+func (uuidV7Generator) NewID() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// uuidV4Generator makes random UUIDs, for deployments that would rather not
+// reveal when an account was created
+type uuidV4Generator struct{}
+
+func (uuidV4Generator) NewID() (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// newIDGenerator returns the generator selected by ID_GENERATOR
+func newIDGenerator() (IDGenerator, error) {
+	switch v := os.Getenv("ID_GENERATOR"); v {
+	case "", IDGeneratorUUIDv7:
+		return uuidV7Generator{}, nil
+	case IDGeneratorUUIDv4:
+		return uuidV4Generator{}, nil
+	default:
+		return nil, fmt.Errorf("invalid ID_GENERATOR: %s. Valid options are: uuidv7, uuidv4", v)
+	}
+}
+
+// parseExternalID returns id in the canonical lower-case form external IDs
+// are stored in, or false when it is not a UUID
+func parseExternalID(id string) (string, bool) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// assignExternalID gives the account a new external ID
+func (s *service) assignExternalID(account *BlockAccount) error {
+	id, err := s.ids.NewID()
+	if err != nil {
+		return fmt.Errorf("generate external ID: %w", err)
+	}
+	account.ExternalID = id
+	return nil
+}
+
+// ResolveAccountID returns the internal ID of the account with externalID,
+// or 0 when there is none. Accounts stay resolvable after they are deleted,
+// so the records that outlive them can still be looked up.
+func (s *service) ResolveAccountID(ctx context.Context, externalID string) (int, error) {
+	externalID, ok := parseExternalID(externalID)
+	if !ok {
+		return 0, nil
+	}
+	id, err := s.repo.ResolveAccountID(ctx, externalID)
+	if err != nil {
+		s.log(ctx).Error("Failed to resolve account ID", zap.Error(err), zap.String("externalID", externalID))
+		return 0, err
+	}
+	return id, nil
+}
+
+// accountIDParam resolves the {id} path parameter, an account's external ID,
+// to its internal ID. When it cannot, it writes the error response and
+// returns false.
+func accountIDParam(w http.ResponseWriter, r *http.Request, svc BlockAccountService) (int, bool) {
+	externalID, ok := parseExternalID(chi.URLParam(r, "id"))
+	if !ok {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidAccountID, "Invalid block account ID")
+		return 0, false
+	}
+	id, err := svc.ResolveAccountID(r.Context(), externalID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return 0, false
+	}
+	if id == 0 {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// Staff identity headers. They are set by the authenticating gateway in
+// front of the admin API and must be stripped from customer traffic.
+const (
+	StaffIDHeader   = "X-Staff-ID"
+	StaffRoleHeader = "X-Staff-Role"
+)
+
+// Impersonation headers: the session token a support agent sends to view the
+// API as the customer, and the markers added to every impersonated response
+const (
+	ImpersonationTokenHeader   = "X-Impersonation-Token"
+	ImpersonationSessionHeader = "X-Impersonation-Session"
+	ImpersonatedByHeader       = "X-Impersonated-By"
+)
+
+// Impersonation session lifetime, in minutes
+const (
+	defaultImpersonationMinutes = 15
+	maxImpersonationMinutes     = 60
+)
+
+const impersonationKey ctxKey = "impersonation"
+
+// defaultImpersonationRoles may start impersonation sessions when
+// IMPERSONATION_ROLES is not set
+var defaultImpersonationRoles = []string{"support", "admin"}
+
+// ErrImpersonationForbidden is returned when the staff member's role may not impersonate
+var ErrImpersonationForbidden = newAPIError(CodeImpersonationForbidden, "role may not impersonate customers")
+
+// ImpersonationSession lets a support agent see the API as one customer, read-only
+// @Description Time-limited, read-only session in which support staff see the API as a customer. The token is only returned when the session starts.
+type ImpersonationSession struct {
+	ID        int        `json:"id" example:"1"`
+	Token     string     `json:"token,omitempty" example:"9b1f0c..."`
+	StaffID   string     `json:"staff_id" example:"agent-42"`
+	StaffRole string     `json:"staff_role" example:"support"`
+	UserID    int        `json:"user_id" example:"123"`
+	Reason    string     `json:"reason" example:"Ticket 8812: customer cannot see matured deposit"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// TenantID is the tenant whose customer is impersonated
+	TenantID string `json:"tenant_id" example:"default"`
+	// Audit lists the requests made with the session, oldest first
+	Audit []*ImpersonationAccess `json:"audit,omitempty"`
+
+	tokenHash string
+}
+
+// ImpersonationAccess records one request made with an impersonation session
+// @Description One request made with an impersonation session
+type ImpersonationAccess struct {
+	ID        int       `json:"id" example:"1"`
+	SessionID int       `json:"session_id" example:"1"`
+	Method    string    `json:"method" example:"GET"`
+	Path      string    `json:"path" example:"/user/123/block-accounts"`
+	Status    int       `json:"status" example:"200"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StartImpersonationRequest is the payload for starting an impersonation session
+// @Description Request payload for starting a read-only impersonation session
+type StartImpersonationRequest struct {
+	UserID          int    `json:"user_id" example:"123" validate:"gt=0"`
+	Reason          string `json:"reason" example:"Ticket 8812: customer cannot see matured deposit" validate:"notblank"`
+	DurationMinutes int    `json:"duration_minutes,omitempty" example:"15"` // 1-60, default 15
+}
+
+// active reports whether the session can still be used at now
+func (s *ImpersonationSession) active(now time.Time) bool {
+	return s.EndedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// impersonationRoles returns the staff roles allowed to impersonate customers
+func impersonationRoles() []string {
+	if v := os.Getenv("IMPERSONATION_ROLES"); v != "" {
+		var roles []string
+		for _, role := range strings.Split(v, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+	return defaultImpersonationRoles
+}
+
+// canImpersonate reports whether a staff role may start impersonation sessions
+func canImpersonate(role string) bool {
+	for _, allowed := range impersonationRoles() {
+		if strings.EqualFold(role, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashImpersonationToken returns the stored form of a session token
+func hashImpersonationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// validateStartImpersonationRequest validates an impersonation request
+func validateStartImpersonationRequest(req *StartImpersonationRequest) error {
+	if req.DurationMinutes < 0 || req.DurationMinutes > maxImpersonationMinutes {
+		return fmt.Errorf("duration_minutes must be between 1 and %d", maxImpersonationMinutes)
+	}
+	return nil
+}
+
+// StartImpersonation opens a read-only session for staffID to view the API
+// as the customer. The returned session carries the only copy of its token.
+func (s *service) StartImpersonation(ctx context.Context, staffID, staffRole string, req *StartImpersonationRequest) (*ImpersonationSession, error) {
+	if !canImpersonate(staffRole) {
+		s.log(ctx).Warn("Impersonation refused",
+			zap.String("staffID", staffID), zap.String("staffRole", staffRole), zap.Int("userID", req.UserID))
+		return nil, ErrImpersonationForbidden
+	}
+
+	token, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	minutes := req.DurationMinutes
+	if minutes == 0 {
+		minutes = defaultImpersonationMinutes
+	}
+
+	session, err := s.repo.CreateImpersonation(ctx, &ImpersonationSession{
+		StaffID:   staffID,
+		StaffRole: staffRole,
+		UserID:    req.UserID,
+		Reason:    req.Reason,
+		ExpiresAt: time.Now().UTC().Add(time.Duration(minutes) * time.Minute),
+		TenantID:  tenantOf(ctx),
+		tokenHash: hashImpersonationToken(token),
+	})
+	if err != nil {
+		s.log(ctx).Error("Failed to start impersonation", zap.Error(err))
+		return nil, err
+	}
+	session.Token = token
+
+	s.log(ctx).Warn("Impersonation started",
+		zap.Int("sessionID", session.ID), zap.String("staffID", staffID),
+		zap.Int("userID", req.UserID), zap.String("reason", req.Reason), zap.Time("expiresAt", session.ExpiresAt))
+	return session, nil
+}
+
+// EndImpersonation ends a session before it expires
+func (s *service) EndImpersonation(ctx context.Context, id int) error {
+	if err := s.repo.EndImpersonation(ctx, id, time.Now().UTC()); err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to end impersonation", zap.Error(err), zap.Int("id", id))
+		}
+		return err
+	}
+	s.log(ctx).Warn("Impersonation ended", zap.Int("sessionID", id))
+	return nil
+}
+
+// GetImpersonation returns a session with its audit trail, or nil when it does not exist
+func (s *service) GetImpersonation(ctx context.Context, id int) (*ImpersonationSession, error) {
+	session, err := s.repo.GetImpersonation(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get impersonation", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if session == nil {
+		return nil, nil
+	}
+	if session.Audit, err = s.repo.ListImpersonationAudit(ctx, id); err != nil {
+		s.log(ctx).Error("Failed to get impersonation audit", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	return session, nil
+}
+
+// ResolveImpersonation returns the active session for token, or nil when the
+// token is unknown, expired or ended
+func (s *service) ResolveImpersonation(ctx context.Context, token string) (*ImpersonationSession, error) {
+	session, err := s.repo.GetImpersonationByTokenHash(ctx, hashImpersonationToken(token))
+	if err != nil {
+		s.log(ctx).Error("Failed to resolve impersonation", zap.Error(err))
+		return nil, err
+	}
+	if session == nil || !session.active(time.Now()) {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// AuditImpersonation records a request made with an impersonation session.
+// Failures are logged loudly but never fail the request.
+func (s *service) AuditImpersonation(ctx context.Context, access *ImpersonationAccess) {
+	if err := s.repo.RecordImpersonationAccess(ctx, access); err != nil {
+		s.log(ctx).Error("Failed to record impersonation access", zap.Error(err),
+			zap.Int("sessionID", access.SessionID), zap.String("path", access.Path))
+	}
+}
+
+// impersonationFromContext returns the impersonation session of the request, if any
+func impersonationFromContext(ctx context.Context) *ImpersonationSession {
+	session, _ := ctx.Value(impersonationKey).(*ImpersonationSession)
+	return session
+}
+
+// ImpersonationMiddleware resolves X-Impersonation-Token into a session and
+// enforces its safeguards: the session must be active, requests are read-only
+// and limited to customer routes, responses and log lines are marked, and
+// every request is audited, including refused ones.
+func ImpersonationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(ImpersonationTokenHeader)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "Service not available")
+			return
+		}
+		session, err := svc.ResolveImpersonation(r.Context(), token)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if session == nil {
+			writeError(w, http.StatusUnauthorized, "Impersonation session is invalid or has expired")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), impersonationKey, session)
+		ctx = withCallerFields(ctx, zap.NewNop(),
+			zap.Int("impersonation_session", session.ID),
+			zap.String("impersonator", session.StaffID),
+			zap.Int("impersonated_user_id", session.UserID))
+		r = r.WithContext(ctx)
+
+		w.Header().Set(ImpersonationSessionHeader, strconv.Itoa(session.ID))
+		w.Header().Set(ImpersonatedByHeader, session.StaffID)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			loggerFromContext(ctx, zap.NewNop()).Warn("Impersonated request",
+				zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Int("status", status))
+			svc.AuditImpersonation(context.WithoutCancel(ctx), &ImpersonationAccess{
+				SessionID: session.ID,
+				Method:    r.Method,
+				Path:      r.URL.RequestURI(),
+				Status:    status,
+			})
+		}()
+
+		path := unversionedPath(r.URL.Path)
+		switch {
+		case r.Method != http.MethodGet && r.Method != http.MethodHead:
+			writeErrorCode(ww, http.StatusForbidden, CodeImpersonationOutOfScope, "Impersonation sessions are read-only")
+		case strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/webhooks") ||
+			strings.HasPrefix(path, "/block-account/bulk") || strings.HasPrefix(path, "/jobs") || path == GraphQLPath:
+			writeErrorCode(ww, http.StatusForbidden, CodeImpersonationOutOfScope, "Impersonation sessions are limited to customer routes")
+		default:
+			next.ServeHTTP(ww, r)
+		}
+	})
+}
+
+// ImpersonationScopeMiddleware keeps an impersonation session to the
+// impersonated customer's own user and account routes
+func ImpersonationScopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := impersonationFromContext(r.Context())
+		if session == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if v := chi.URLParam(r, "userID"); v != "" && v != strconv.Itoa(session.UserID) {
+			writeErrorCode(w, http.StatusForbidden, CodeImpersonationOutOfScope, "Impersonation session does not cover this user")
+			return
+		}
+		if v := chi.URLParam(r, "id"); v != "" {
+			svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+			if !ok {
+				writeError(w, http.StatusInternalServerError, "Service not available")
+				return
+			}
+			// IDs that never named an account are left to the route to reject
+			id, err := svc.ResolveAccountID(r.Context(), v)
+			if err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if id == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			account, err := svc.GetBlockAccount(r.Context(), id)
+			if err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err)
+				return
+			}
+			// Communications and agreements outlive their account, so a missing
+			// account is only let through to routes that report it as not found
+			if account == nil && (strings.HasSuffix(r.URL.Path, "/communications") ||
+				strings.HasSuffix(r.URL.Path, "/agreement")) {
+				writeErrorCode(w, http.StatusForbidden, CodeImpersonationOutOfScope, "Impersonation session does not cover this account")
+				return
+			}
+			// The customer's joint accounts are theirs to see as well
+			if account != nil && account.UserID != session.UserID {
+				holders, err := svc.ListAccountHolders(r.Context(), id)
+				if err != nil {
+					writeAPIError(w, http.StatusInternalServerError, err)
+					return
+				}
+				if !holdsAccount(holders, session.UserID) {
+					writeErrorCode(w, http.StatusForbidden, CodeImpersonationOutOfScope, "Impersonation session does not cover this account")
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startImpersonationHandler godoc
+// @Summary Start an impersonation session
+// @Description Issues a time-limited, read-only session token with which a support agent sees the API exactly as the customer does, by sending it in X-Impersonation-Token. Requires a staff role allowed by IMPERSONATION_ROLES. The token is returned only in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param X-Staff-Role header string true "Staff role, set by the gateway"
+// @Param session body StartImpersonationRequest true "Customer and reason"
+// @Success 201 {object} ImpersonationSession
+// @Header 201 {string} Location "URL of the session"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/impersonations [post]
+func startImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID, staffRole := r.Header.Get(StaffIDHeader), r.Header.Get(StaffRoleHeader)
+	if staffID == "" || staffRole == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req StartImpersonationRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := validateStartImpersonationRequest(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	session, err := svc.StartImpersonation(ctx, staffID, staffRole, &req)
+	if err == ErrImpersonationForbidden {
+		writeAPIError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeCreated(w, r, apiPath("/admin/impersonations/"+strconv.Itoa(session.ID)), session, "Impersonation session started")
+}
+
+// getImpersonationHandler godoc
+// @Summary Get an impersonation session
+// @Description Returns an impersonation session with the audit trail of every request made with it
+// @Tags admin
+// @Produce json
+// @Param id path int true "Session ID" Format(int64)
+// @Success 200 {object} ImpersonationSession
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/impersonations/{id} [get]
+func getImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid impersonation session ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	session, err := svc.GetImpersonation(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if session == nil {
+		writeError(w, http.StatusNotFound, "Impersonation session not found")
+		return
+	}
+
+	writeSuccess(w, r, session, "Impersonation session retrieved successfully")
+}
+
+// endImpersonationHandler godoc
+// @Summary End an impersonation session
+// @Description Ends an impersonation session before it expires; its token stops working immediately
+// @Tags admin
+// @Param id path int true "Session ID" Format(int64)
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/impersonations/{id} [delete]
+func endImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid impersonation session ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := svc.EndImpersonation(ctx, id); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Impersonation session not found or already ended")
+			return
+		}
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
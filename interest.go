@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// daysPerYear is the day count basis for simple interest (Actual/365)
+const daysPerYear = 365
+
+// roundMoney rounds an amount to cents
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// interestBetween returns the simple interest an account earns between from
+// and to, clipped to the account's term
+func interestBetween(a *BlockAccount, from, to time.Time) float64 {
+	if a.StartDate.After(from) {
+		from = a.StartDate
+	}
+	if a.EndDate.Before(to) {
+		to = a.EndDate
+	}
+	if !to.After(from) {
+		return 0
+	}
+	return a.Principal * a.InterestRate * yearsBetween(from, to)
+}
+
+// yearsBetween returns the length of [from, to) in years on the Actual/365
+// basis, on the sandbox's clock in a sandbox
+func yearsBetween(from, to time.Time) float64 {
+	return to.Sub(from).Hours() / 24 / daysPerYear * sandboxTimeScale()
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Job types run by the jobs worker
+const (
+	// JobTypeAccountImport loads a bulk import queued with async=true
+	JobTypeAccountImport = "account_import"
+	// JobTypeMaturityRun matures every account past its end date, like a
+	// maturity worker run started on demand
+	JobTypeMaturityRun = "maturity_run"
+	// JobTypeReport generates and delivers a report on demand
+	JobTypeReport = "report"
+	// JobTypeRegionFailover promotes the region it is pinned to and fences
+	// the workers of the region it takes over from
+	JobTypeRegionFailover = "region_failover"
+	// JobTypeBatchAction freezes, unfreezes or matures a set of accounts
+	JobTypeBatchAction = "batch_action"
+)
+
+// Job statuses. A running job whose worker dies is picked up again once its
+// lease runs out; its runner resumes from its own saved progress.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+const (
+	// maxJobAttempts is how many workers may pick up a job before it is
+	// failed, so a job that keeps crashing its worker is not retried forever
+	maxJobAttempts = 3
+	// jobHeartbeatInterval is how often a running job renews its lease and
+	// checks whether it was cancelled
+	jobHeartbeatInterval = 5 * time.Second
+	// maturityJobBatchSize is the accounts matured per transaction by a maturity run job
+	maturityJobBatchSize = 100
+)
+
+var (
+	// ErrJobCancelled is the cause of a running job's context being cancelled
+	// after a cancellation was requested
+	ErrJobCancelled = errors.New("job was cancelled")
+	// ErrJobFinished is returned when cancelling a job that already finished
+	ErrJobFinished = newAPIError(CodeJobFinished, "job has already finished")
+)
+
+// Job is a long-running operation queued for the jobs worker
+// @Description Status and progress of an asynchronous job
+type Job struct {
+	ID     int    `json:"id" example:"12"`
+	Type   string `json:"type" example:"account_import"`
+	Status string `json:"status" example:"running"`
+	// Payload is the job's input, specific to its type
+	Payload  json.RawMessage `json:"payload" swaggertype:"object"`
+	Progress JobProgress     `json:"progress"`
+	// Result is set once the job succeeded, specific to its type
+	Result json.RawMessage `json:"result,omitempty" swaggertype:"object"`
+	Error  string          `json:"error,omitempty"`
+	// CancelRequested is set while a running job winds down after a cancellation
+	CancelRequested bool   `json:"cancel_requested"`
+	Attempts        int    `json:"attempts" example:"1"`
+	RequestedBy     string `json:"requested_by,omitempty" example:"ops-17"`
+	// Region is set on a job only the workers of that region may run
+	Region      string     `json:"region,omitempty" example:"eu-west"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// JobProgress counts the units of work done. Total is 0 while unknown.
+type JobProgress struct {
+	Done  int `json:"done" example:"1500"`
+	Total int `json:"total" example:"2500"`
+}
+
+// jobRunner carries out a job of one type and returns its result. ctx is
+// cancelled with ErrJobCancelled as the cause when the job is cancelled.
+// progress saves how far the job got.
+type jobRunner func(ctx context.Context, s *service, job *Job, progress func(done, total int)) (any, error)
+
+// jobRunners maps each job type to its runner
+var jobRunners = map[string]jobRunner{
+	JobTypeAccountImport:  runAccountImportJob,
+	JobTypeMaturityRun:    runMaturityJob,
+	JobTypeReport:         runReportJob,
+	JobTypeRegionFailover: runRegionFailoverJob,
+	JobTypeBatchAction:    runBatchActionJob,
+}
+
+// newJob builds a queued job of jobType with payload as its input
+func newJob(jobType string, payload any, staffID string) (*Job, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{Type: jobType, Status: JobQueued, Payload: b, RequestedBy: staffID}, nil
+}
+
+// enqueueJob stores a job for the jobs worker
+func (s *service) enqueueJob(ctx context.Context, jobType string, payload any, staffID string) (*Job, error) {
+	job, err := newJob(jobType, payload, staffID)
+	if err != nil {
+		return nil, err
+	}
+	if job, err = s.repo.CreateJob(ctx, job); err != nil {
+		s.log(ctx).Error("Failed to queue job", zap.Error(err), zap.String("type", jobType))
+		return nil, err
+	}
+	s.log(ctx).Info("Job queued", zap.Int("jobID", job.ID), zap.String("type", jobType), zap.String("staffID", staffID))
+	return job, nil
+}
+
+// GetJob returns a job, or nil when it does not exist
+func (s *service) GetJob(ctx context.Context, id int) (*Job, error) {
+	job, err := s.repo.GetJob(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get job", zap.Error(err), zap.Int("jobID", id))
+	}
+	return job, err
+}
+
+// CancelJob cancels a queued job at once and asks a running one to stop,
+// which it does within jobHeartbeatInterval. It returns nil when the job does
+// not exist and ErrJobFinished when it has already finished.
+func (s *service) CancelJob(ctx context.Context, id int, staffID string) (*Job, error) {
+	job, err := s.repo.CancelJob(ctx, id, time.Now().UTC())
+	if err != nil {
+		if err != ErrJobFinished {
+			s.log(ctx).Error("Failed to cancel job", zap.Error(err), zap.Int("jobID", id))
+		}
+		return nil, err
+	}
+	if job != nil {
+		s.log(ctx).Info("Job cancellation requested", zap.Int("jobID", id), zap.String("status", job.Status),
+			zap.String("staffID", staffID))
+	}
+	return job, nil
+}
+
+// QueueMaturityRun queues a job that matures every account past its end date
+func (s *service) QueueMaturityRun(ctx context.Context, staffID string) (*Job, error) {
+	return s.enqueueJob(ctx, JobTypeMaturityRun, struct{}{}, staffID)
+}
+
+// RunJobs runs queued jobs, and those whose worker's lease ran out, one at a
+// time until none is left, and returns how many it finished. A standby
+// region only runs the jobs pinned to it, such as its own failover.
+func (s *service) RunJobs(ctx context.Context, lease time.Duration) (int, error) {
+	finished := 0
+	for {
+		active, err := s.regionActive(ctx)
+		if err != nil {
+			s.log(ctx).Error("Failed to check region", zap.Error(err))
+			return finished, err
+		}
+		job, err := s.repo.ClaimJob(ctx, time.Now().UTC(), lease, regionName(), !active)
+		if err != nil {
+			s.log(ctx).Error("Failed to claim job", zap.Error(err))
+			return finished, err
+		}
+		if job == nil {
+			return finished, nil
+		}
+		if err := s.runJob(ctx, job, lease); err != nil {
+			return finished, err
+		}
+		finished++
+	}
+}
+
+// runJob runs a claimed job and saves how it ended. It only returns an error
+// when the outcome could not be saved or the worker is shutting down, in
+// which case the job is left running for another worker to pick up. A job
+// stopped because its region was fenced is likewise left for the promoted
+// region's workers once its lease runs out.
+func (s *service) runJob(ctx context.Context, job *Job, lease time.Duration) error {
+	runner, ok := jobRunners[job.Type]
+	switch {
+	case !ok:
+		return s.finishJob(ctx, job, JobFailed, nil, fmt.Errorf("unknown job type: %s", job.Type))
+	case job.Attempts > maxJobAttempts:
+		return s.finishJob(ctx, job, JobFailed, nil, fmt.Errorf("gave up after %d attempts", maxJobAttempts))
+	}
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go s.heartbeatJob(jobCtx, job, lease, cancel)
+
+	progress := func(done, total int) {
+		job.Progress = JobProgress{Done: done, Total: total}
+		if err := s.repo.SaveJobProgress(ctx, job.ID, job.Progress); err != nil {
+			s.log(ctx).Warn("Failed to save job progress", zap.Error(err), zap.Int("jobID", job.ID))
+		}
+	}
+
+	s.log(ctx).Info("Job started", zap.Int("jobID", job.ID), zap.String("type", job.Type), zap.Int("attempt", job.Attempts))
+	result, err := runner(jobCtx, s, job, progress)
+	switch {
+	case err == nil:
+		return s.finishJob(ctx, job, JobSucceeded, result, nil)
+	case errors.Is(context.Cause(jobCtx), ErrJobCancelled):
+		return s.finishJob(ctx, job, JobCancelled, nil, nil)
+	case errors.Is(context.Cause(jobCtx), errRegionFenced):
+		s.log(ctx).Warn("Job stopped by failover", zap.Int("jobID", job.ID), zap.String("type", job.Type))
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		return s.finishJob(ctx, job, JobFailed, nil, err)
+	}
+}
+
+// heartbeatJob renews a running job's lease until ctx is done, and cancels
+// the job with ErrJobCancelled once a cancellation is requested, or with
+// errRegionFenced once another region is promoted unless the job is pinned
+// to this one
+func (s *service) heartbeatJob(ctx context.Context, job *Job, lease time.Duration, cancel context.CancelCauseFunc) {
+	id := job.ID
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cancelRequested, err := s.repo.RenewJob(ctx, id, time.Now().UTC().Add(lease))
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log(ctx).Warn("Failed to renew job lease", zap.Error(err), zap.Int("jobID", id))
+			}
+			continue
+		}
+		if cancelRequested {
+			cancel(ErrJobCancelled)
+			return
+		}
+		if job.Region == "" {
+			if active, err := s.regionActive(ctx); err == nil && !active {
+				cancel(errRegionFenced)
+				return
+			}
+		}
+	}
+}
+
+// finishJob saves a job's final status with its result or error. Failed jobs
+// are reported on the operations channel.
+func (s *service) finishJob(ctx context.Context, job *Job, status string, result any, jobErr error) error {
+	completed := time.Now().UTC()
+	job.Status, job.CompletedAt = status, &completed
+	if result != nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		job.Result = b
+	}
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+	}
+
+	if err := s.repo.FinishJob(ctx, job); err != nil {
+		s.log(ctx).Error("Failed to finish job", zap.Error(err), zap.Int("jobID", job.ID))
+		return err
+	}
+
+	if status == JobFailed {
+		s.log(ctx).Error("Job failed", zap.Error(jobErr), zap.Int("jobID", job.ID), zap.String("type", job.Type))
+		s.emitOperational(ctx, EventJobFailed, SeverityCritical, fmt.Sprintf("Job %d (%s) failed", job.ID, job.Type),
+			map[string]any{"job": job.Type, "job_id": job.ID, "error": job.Error})
+		return nil
+	}
+	s.log(ctx).Info("Job finished", zap.Int("jobID", job.ID), zap.String("type", job.Type), zap.String("status", status))
+	return nil
+}
+
+// runMaturityJob matures every account past its end date, reporting the
+// accounts matured so far as progress
+func runMaturityJob(ctx context.Context, s *service, job *Job, progress func(done, total int)) (any, error) {
+	n, err := s.processMaturities(ctx, s.Now().UTC(), maturityJobBatchSize, func(matured int) {
+		progress(matured, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	progress(n, n)
+	return map[string]int{"matured": n}, nil
+}
+
+// jobLocation is the status URL of a job, sent with 202 responses
+func jobLocation(id int) string {
+	return apiPath("/jobs/" + strconv.Itoa(id))
+}
+
+// getJobHandler godoc
+// @Summary Get a job
+// @Description Returns an asynchronous job's status, progress and, once it succeeded, its result
+// @Tags jobs
+// @Produce json
+// @Param id path int true "Job ID" Format(int64)
+// @Success 200 {object} Job
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/jobs/{id} [get]
+func getJobHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := svc.GetJob(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if job == nil {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	writeSuccess(w, r, job, "Job retrieved successfully")
+}
+
+// cancelJobHandler godoc
+// @Summary Cancel a job
+// @Description Cancels a queued job at once. A running job is asked to stop and does so within a few seconds, keeping the work it already saved; poll GET /jobs/{id} until its status is cancelled.
+// @Tags jobs
+// @Produce json
+// @Param id path int true "Job ID" Format(int64)
+// @Param X-Staff-ID header string false "Staff member, set by the gateway"
+// @Success 200 {object} Job "Queued job cancelled"
+// @Success 202 {object} Job "Running job asked to stop"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/jobs/{id}/cancel [post]
+func cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := svc.CancelJob(ctx, id, r.Header.Get(StaffIDHeader))
+	if err != nil {
+		if err == ErrJobFinished {
+			writeAPIError(w, http.StatusConflict, err)
+			return
+		}
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if job == nil {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	markWrite(w)
+
+	if job.Status == JobCancelled {
+		writeSuccess(w, r, job, "Job cancelled")
+		return
+	}
+	writeSuccessStatus(w, r, http.StatusAccepted, job, "Job cancellation requested")
+}
+
+// runMaturityHandler godoc
+// @Summary Start a maturity run
+// @Description Queues a job that matures every active account past its end date, as the maturity worker does on its schedule, and returns 202 with the job. Poll the job for progress. With dry_run=true nothing is queued: the due accounts, up to 5000, are matured within the request and rolled back, and the response shows how many would mature, the payouts and rollovers, and their IDs.
+// @Tags admin
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member starting the run"
+// @Param dry_run query bool false "Show what the run would do without keeping anything"
+// @Success 200 {object} MaturityRunPreview "Dry run"
+// @Success 202 {object} Job
+// @Header 202 {string} Location "Job status URL"
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/maturity/run [post]
+func runMaturityHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	dryRun, ok := dryRunParam(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	if dryRun {
+		ctx, cancel := withRequestTimeout(r, longRequestTimeout)
+		defer cancel()
+
+		preview, err := svc.PreviewMaturities(ctx)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeSuccess(w, r, preview, fmt.Sprintf("Dry run: %d accounts would mature, nothing was changed", preview.Matured))
+		return
+	}
+
+	job, err := svc.QueueMaturityRun(ctx, staffID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	markWrite(w)
+
+	w.Header().Set("Location", jobLocation(job.ID))
+	writeSuccessStatus(w, r, http.StatusAccepted, job, "Maturity run queued")
+}
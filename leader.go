@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errLeaseLost cancels a worker run whose lease another replica has taken,
+// or that could not be renewed before it lapsed
+var errLeaseLost = errors.New("worker lease lost")
+
+// asLeader wraps a worker run so only one replica of the worker runs at a
+// time. Each run first takes or renews the worker's lease in worker_leases;
+// a replica that doesn't get it stays idle until the lease lapses. The lease
+// is renewed every third of lease while the run goes on, and the run is
+// cancelled if that stops working before the lease lapses. Workers save
+// their progress as they go, so whichever replica leads next carries on.
+// A worker stopped mid-run gives the lease up so another replica takes over
+// on its next run; one stopped between runs leaves it to lapse.
+func (s *service) asLeader(worker string, lease time.Duration, run func(context.Context) error) func(context.Context) error {
+	holder := workerInstance()
+	// leading is whether the last run led, nil before the first
+	var leading *bool
+	return func(ctx context.Context) error {
+		ok, err := s.repo.AcquireWorkerLease(ctx, worker, holder, time.Now().UTC(), lease)
+		if err != nil {
+			return fmt.Errorf("acquire worker lease: %w", err)
+		}
+		if leading == nil || *leading != ok {
+			leading = &ok
+			if ok {
+				s.log(ctx).Info("Worker took the lead", zap.String("worker", worker), zap.String("instance", holder))
+			} else {
+				s.log(ctx).Info("Worker is on standby, another replica leads", zap.String("worker", worker))
+			}
+		}
+		if !ok {
+			return nil
+		}
+
+		runCtx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		go s.renewLease(runCtx, worker, holder, lease, cancel)
+		err = run(runCtx)
+		if ctx.Err() != nil {
+			s.releaseLease(ctx, worker, holder)
+			leading = nil
+		}
+		if errors.Is(context.Cause(runCtx), errLeaseLost) {
+			s.log(ctx).Warn("Worker stopped, its lease was lost", zap.String("worker", worker))
+			leading = nil
+			return nil
+		}
+		return err
+	}
+}
+
+// renewLease extends holder's lease on worker until ctx ends, and cancels
+// ctx with errLeaseLost once another replica holds it or it is about to
+// lapse without a successful renewal
+func (s *service) renewLease(ctx context.Context, worker, holder string, lease time.Duration, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(lease / 3)
+	defer ticker.Stop()
+
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, err := s.repo.AcquireWorkerLease(ctx, worker, holder, time.Now().UTC(), lease)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			s.log(ctx).Warn("Failed to renew worker lease", zap.String("worker", worker), zap.Error(err))
+			// Stop a renewal short of the lease lapsing, before another
+			// replica can take it
+			if time.Since(renewedAt) >= lease-lease/3 {
+				cancel(errLeaseLost)
+				return
+			}
+		case !ok:
+			cancel(errLeaseLost)
+			return
+		default:
+			renewedAt = time.Now()
+		}
+	}
+}
+
+// releaseLease gives up holder's lease on worker as the worker stops
+func (s *service) releaseLease(ctx context.Context, worker, holder string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.repo.ReleaseWorkerLease(ctx, worker, holder); err != nil {
+		s.log(ctx).Warn("Failed to release worker lease", zap.String("worker", worker), zap.Error(err))
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Account limit rule codes, returned with every violation
+const (
+	RuleMaxOpenAccounts   = "max_open_accounts"
+	RuleMaxTotalPrincipal = "max_total_principal"
+	RuleMinPrincipal      = "min_principal"
+	RuleMaxPrincipal      = "max_principal"
+)
+
+// periodRules are the rules set per period rather than per user
+var periodRules = map[string]bool{
+	RuleMinPrincipal: true,
+	RuleMaxPrincipal: true,
+}
+
+// isValidLimitRule validates a rule code
+func isValidLimitRule(rule string) bool {
+	return periodRules[rule] || rule == RuleMaxOpenAccounts || rule == RuleMaxTotalPrincipal
+}
+
+// AccountLimit is a business rule enforced when a block account is opened
+// @Description Configurable limit on the accounts a user can open
+type AccountLimit struct {
+	Rule string `json:"rule" example:"max_total_principal"`
+	// Period is set for min_principal and max_principal and empty otherwise
+	Period    string    `json:"period,omitempty" example:"3y"`
+	Value     float64   `json:"value" example:"250000"`
+	UpdatedBy string    `json:"updated_by,omitempty" example:"staff-42"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AccountLimitRequest is the payload for setting a limit
+// @Description Request payload for setting an account limit
+type AccountLimitRequest struct {
+	// Period is required for min_principal and max_principal
+	Period string  `json:"period,omitempty" example:"3y" validate:"omitempty,period"`
+	Value  float64 `json:"value" example:"250000"`
+}
+
+// UserExposure is what a user already holds in open block accounts
+type UserExposure struct {
+	OpenAccounts int
+	Principal    float64
+}
+
+// LimitViolation is returned when opening an account would break a limit
+type LimitViolation struct {
+	Rule    string
+	Message string
+	Limit   float64
+}
+
+func (v *LimitViolation) Error() string {
+	return v.Message
+}
+
+// RuleViolationResponse is the error response for a broken business rule
+// @Description Error response naming the business rule a request broke
+type RuleViolationResponse struct {
+	Error   string  `json:"error" example:"Unprocessable Entity"`
+	Code    int     `json:"code" example:"422"`
+	Message string  `json:"message" example:"principal would bring the user's total above 250000.00"`
+	Rule    string  `json:"rule" example:"max_total_principal"`
+	Limit   float64 `json:"limit" example:"250000"`
+	// ErrorCode is always LIMIT_EXCEEDED; Details repeat the rule and limit
+	ErrorCode string         `json:"error_code" example:"LIMIT_EXCEEDED"`
+	Details   map[string]any `json:"details"`
+}
+
+// writeRuleViolation writes a 422 naming the violated rule
+func writeRuleViolation(w http.ResponseWriter, v *LimitViolation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(RuleViolationResponse{
+		Error:     http.StatusText(http.StatusUnprocessableEntity),
+		Code:      http.StatusUnprocessableEntity,
+		Message:   v.Message,
+		Rule:      v.Rule,
+		Limit:     v.Limit,
+		ErrorCode: CodeLimitExceeded,
+		Details:   map[string]any{"rule": v.Rule, "limit": v.Limit},
+	})
+}
+
+// validateAccountLimitRequest validates the limit payload for rule
+func validateAccountLimitRequest(rule string, req *AccountLimitRequest) error {
+	if !isValidLimitRule(rule) {
+		return fmt.Errorf("invalid rule: %s. Valid options are: max_open_accounts, max_total_principal, min_principal, max_principal", rule)
+	}
+	if periodRules[rule] && !isValidPeriod(req.Period) {
+		return fmt.Errorf("%s needs a period. Valid options are: %s", rule, validPeriods())
+	}
+	if !periodRules[rule] && req.Period != "" {
+		return fmt.Errorf("%s applies to all periods and takes no period", rule)
+	}
+	if math.IsNaN(req.Value) || req.Value <= 0 {
+		return fmt.Errorf("value must be positive")
+	}
+	if periodRules[rule] && req.Value > MaxPrincipal {
+		return fmt.Errorf("%s must be at most %.2f, the largest principal an account can hold", rule, float64(MaxPrincipal))
+	}
+	if req.Value > maxExactMoney {
+		return fmt.Errorf("value must be at most %.2f", maxExactMoney)
+	}
+	if rule == RuleMaxOpenAccounts && req.Value != math.Trunc(req.Value) {
+		return fmt.Errorf("max_open_accounts must be a whole number")
+	}
+	return nil
+}
+
+// checkAccountLimits returns a *LimitViolation when an account of principal
+// for period would break a per-period limit. Otherwise it returns the limits
+// on what each user holds, for checkUserLimits to check against the user's
+// exposure under the lock CreateAccount takes on the user, so two creates
+// racing for the last of a user's allowance cannot both succeed.
+func (s *service) checkAccountLimits(ctx context.Context, principal float64, period string) ([]*AccountLimit, error) {
+	limits, err := s.repo.ListAccountLimits(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to list account limits", zap.Error(err))
+		return nil, err
+	}
+
+	var userLimits []*AccountLimit
+	for _, l := range limits {
+		switch {
+		case l.Rule == RuleMinPrincipal && l.Period == period && principal < l.Value:
+			return nil, &LimitViolation{Rule: l.Rule, Limit: l.Value,
+				Message: fmt.Sprintf("principal must be at least %.2f for %s accounts", l.Value, period)}
+		case l.Rule == RuleMaxPrincipal && l.Period == period && principal > l.Value:
+			return nil, &LimitViolation{Rule: l.Rule, Limit: l.Value,
+				Message: fmt.Sprintf("principal must be at most %.2f for %s accounts", l.Value, period)}
+		case !periodRules[l.Rule]:
+			userLimits = append(userLimits, l)
+		}
+	}
+	return userLimits, nil
+}
+
+// checkUserLimits returns a *LimitViolation when an account of principal on
+// top of what the user holds would break one of limits
+func checkUserLimits(limits []*AccountLimit, exposure UserExposure, principal float64) error {
+	for _, l := range limits {
+		switch {
+		case l.Rule == RuleMaxOpenAccounts && float64(exposure.OpenAccounts+1) > l.Value:
+			return &LimitViolation{Rule: l.Rule, Limit: l.Value,
+				Message: fmt.Sprintf("user already has %d open block accounts, the most allowed", exposure.OpenAccounts)}
+		case l.Rule == RuleMaxTotalPrincipal && exceedsTotal(exposure.Principal, principal, l.Value):
+			return &LimitViolation{Rule: l.Rule, Limit: l.Value,
+				Message: fmt.Sprintf("principal would bring the user's total above %.2f", l.Value)}
+		}
+	}
+	return nil
+}
+
+// exceedsTotal reports whether principal on top of what the user holds is
+// above limit. A total too large to add up to the cent is above any limit.
+func exceedsTotal(held, principal, limit float64) bool {
+	total, err := addMoney(held, principal)
+	return err != nil || total > limit
+}
+
+// ListAccountLimits returns every configured limit
+func (s *service) ListAccountLimits(ctx context.Context) ([]*AccountLimit, error) {
+	limits, err := s.repo.ListAccountLimits(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to list account limits", zap.Error(err))
+		return nil, err
+	}
+	if limits == nil {
+		limits = []*AccountLimit{}
+	}
+	return limits, nil
+}
+
+// SetAccountLimit sets a limit, replacing any value it already has
+func (s *service) SetAccountLimit(ctx context.Context, rule, staffID string, req *AccountLimitRequest) (*AccountLimit, error) {
+	limit := &AccountLimit{
+		Rule:      rule,
+		Period:    req.Period,
+		Value:     req.Value,
+		UpdatedBy: staffID,
+	}
+	if err := s.repo.SaveAccountLimit(ctx, limit); err != nil {
+		s.log(ctx).Error("Failed to save account limit", zap.Error(err), zap.String("rule", rule))
+		return nil, err
+	}
+	s.log(ctx).Info("Account limit updated", zap.String("rule", rule), zap.String("period", req.Period),
+		zap.Float64("value", req.Value), zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Account limit %s set to %g", rule, req.Value),
+		map[string]any{"setting": "account_limit", "rule": rule, "period": req.Period, "value": req.Value, "changed_by": staffID})
+	return limit, nil
+}
+
+// DeleteAccountLimit removes a limit so it is no longer enforced
+func (s *service) DeleteAccountLimit(ctx context.Context, rule, period string) error {
+	if err := s.repo.DeleteAccountLimit(ctx, rule, period); err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to delete account limit", zap.Error(err), zap.String("rule", rule))
+		}
+		return err
+	}
+	s.log(ctx).Info("Account limit removed", zap.String("rule", rule), zap.String("period", period))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Account limit %s removed", rule),
+		map[string]any{"setting": "account_limit", "rule": rule, "period": period})
+	return nil
+}
+
+// listAccountLimitsHandler godoc
+// @Summary List account limits
+// @Description Lists the business rules enforced when block accounts are opened
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]AccountLimit}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/limits [get]
+func listAccountLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	limits, err := svc.ListAccountLimits(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, limits, "Account limits retrieved successfully")
+}
+
+// setAccountLimitHandler godoc
+// @Summary Set an account limit
+// @Description Sets a business rule enforced when block accounts are opened, taking effect immediately. max_open_accounts and max_total_principal cap what each user holds in active accounts; min_principal and max_principal bound the principal of one period's accounts.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param rule path string true "Rule code" Enums(max_open_accounts, max_total_principal, min_principal, max_principal)
+// @Param limit body AccountLimitRequest true "Limit value"
+// @Param X-Staff-ID header string false "Staff member, set by the gateway"
+// @Success 200 {object} AccountLimit
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/limits/{rule} [put]
+func setAccountLimitHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	rule := chi.URLParam(r, "rule")
+
+	var req AccountLimitRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := validateAccountLimitRequest(rule, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	limit, err := svc.SetAccountLimit(ctx, rule, r.Header.Get(StaffIDHeader), &req)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, r, limit, "Account limit saved successfully")
+}
+
+// deleteAccountLimitHandler godoc
+// @Summary Remove an account limit
+// @Description Stops enforcing a business rule. Per-period rules name the period in the query.
+// @Tags admin
+// @Param rule path string true "Rule code"
+// @Param period query string false "Period, for min_principal and max_principal"
+// @Success 204 {string} string "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/limits/{rule} [delete]
+func deleteAccountLimitHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	rule := chi.URLParam(r, "rule")
+	period := r.URL.Query().Get("period")
+
+	ctx := r.Context()
+
+	if err := svc.DeleteAccountLimit(ctx, rule, period); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Limit is not set")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader is echoed on every response so clients can quote it in support requests
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	loggerKey       ctxKey = "logger"
+	accessFieldsKey ctxKey = "accessFields"
+)
+
+// accessFields collects what the middleware behind AccessLogMiddleware learn
+// about the caller, such as the principal and the tenant, for the request's
+// access log line
+type accessFields struct {
+	fields []zap.Field
+}
+
+// RequestIDMiddleware assigns a request ID (reusing the caller's X-Request-ID
+// when present), echoes it on the response and stores a request-scoped logger
+// in the context for downstream service and database logging
+func RequestIDMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqID := middleware.GetReqID(r.Context())
+			w.Header().Set(RequestIDHeader, reqID)
+			ctx := context.WithValue(r.Context(), loggerKey, logger.With(zap.String("request_id", reqID)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}))
+	}
+}
+
+// loggerFromContext returns the request-scoped logger, falling back to base
+func loggerFromContext(ctx context.Context, base *zap.Logger) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return l
+	}
+	return base
+}
+
+// withCallerFields adds fields identifying the caller to the request-scoped
+// logger of ctx and to the request's access log line
+func withCallerFields(ctx context.Context, base *zap.Logger, fields ...zap.Field) context.Context {
+	if access, ok := ctx.Value(accessFieldsKey).(*accessFields); ok {
+		access.fields = append(access.fields, fields...)
+	}
+	return context.WithValue(ctx, loggerKey, loggerFromContext(ctx, base).With(fields...))
+}
+
+// log returns the service logger annotated with the request ID of ctx
+func (s *service) log(ctx context.Context) *zap.Logger {
+	return loggerFromContext(ctx, s.logger)
+}
+
+// AccessLogMiddleware writes one structured log line per request
+func AccessLogMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			access := &accessFields{}
+			r = r.WithContext(context.WithValue(r.Context(), accessFieldsKey, access))
+
+			next.ServeHTTP(ww, r)
+
+			route := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			fields := []zap.Field{
+				zap.String("method", r.Method),
+				zap.String("route", route),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", status),
+				zap.Int("bytes", ww.BytesWritten()),
+				zap.Duration("latency", time.Since(start)),
+			}
+			fields = append(fields, callerFields(r)...)
+			fields = append(fields, access.fields...)
+
+			l := loggerFromContext(r.Context(), logger)
+			switch {
+			case status >= 500:
+				l.Error("request completed", fields...)
+			case status >= 400:
+				l.Warn("request completed", fields...)
+			default:
+				l.Info("request completed", fields...)
+			}
+		})
+	}
+}
+
+// callerFields identifies where the request came from; who made it is
+// added by the auth, impersonation and tenant middleware
+func callerFields(r *http.Request) []zap.Field {
+	return []zap.Field{
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("user_agent", r.UserAgent()),
+	}
+}
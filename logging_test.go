@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"main.go/config"
+)
+
+func TestAccessLogNamesCaller(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(91)
+	core, logs := observer.New(zap.InfoLevel)
+	api.handler = newRouter(api.svc, nil, rateLimits{}, config.Default().Server, zap.New(core))
+
+	if w := api.do(http.MethodGet, "/v2/block-account/"+id, ""); w.Code != http.StatusOK {
+		t.Fatalf("get: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodGet, "/v2/block-account/"+id, "", APIKeyHeader, ""); w.Code != http.StatusOK {
+		t.Fatalf("anonymous get: %d %s", w.Code, w.Body)
+	}
+
+	lines := logs.FilterMessage("request completed").All()
+	if len(lines) != 2 {
+		t.Fatalf("access log = %+v", lines)
+	}
+	fields := lines[0].ContextMap()
+	if principal, _ := fields["principal"].(string); principal == "" || fields["tenant"] != DefaultTenant {
+		t.Errorf("access log of an authenticated read = %v", fields)
+	}
+	fields = lines[1].ContextMap()
+	if _, ok := fields["principal"]; ok || fields["tenant"] != DefaultTenant {
+		t.Errorf("access log of an anonymous read = %v", fields)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds a whole SMTP conversation when ctx has no earlier deadline
+const smtpTimeout = 30 * time.Second
+
+// smtpDefaults is how the relay is called unless its SMTP_* settings say
+// otherwise. A message is sent once: a relay that fails after taking it
+// would deliver a retry twice.
+var smtpDefaults = ResiliencePolicy{Timeout: smtpTimeout, MaxAttempts: 1, Backoff: 500 * time.Millisecond,
+	BreakerThreshold: 5, BreakerCooldown: time.Minute}
+
+// Mailer sends plain-text email
+type Mailer interface {
+	Send(ctx context.Context, to []string, subject, body string) error
+}
+
+// newMailer returns an SMTP mailer for SMTP_HOST, or nil when email is disabled
+func newMailer() (Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, nil
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		return nil, fmt.Errorf("SMTP_FROM is required when SMTP_HOST is set")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	dep, err := newDependency(DependencySMTP, smtpDefaults)
+	if err != nil {
+		return nil, err
+	}
+	m := &smtpMailer{addr: net.JoinHostPort(host, port), host: host, from: from, dep: dep}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m, nil
+}
+
+// smtpMailer delivers through an SMTP relay, upgrading to TLS when the
+// server offers STARTTLS. net/smtp refuses to send credentials in the clear
+// to anything but localhost.
+type smtpMailer struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+	dep  *dependency
+}
+
+func (m *smtpMailer) Send(ctx context.Context, to []string, subject, body string) error {
+	return m.dep.call(ctx, func(ctx context.Context) error {
+		err := m.send(ctx, to, subject, body)
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			// The relay refused the message for good
+			return permanent(err)
+		}
+		return err
+	})
+}
+
+// send delivers one message in one SMTP conversation
+func (m *smtpMailer) send(ctx context.Context, to []string, subject, body string) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.auth != nil {
+		if err := client.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.message(to, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message formats a plain-text message with CRLF line endings
+func (m *smtpMailer) message(to []string, subject, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -13,9 +13,8 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+	"main.go/config"
 
 	_ "main.go/docs"
 
@@ -25,31 +24,90 @@ import (
 // BlockAccount represents the account data model
 // @Description Block account information with interest calculations
 type BlockAccount struct {
-	ID           int       `json:"id" example:"1"`
+	// ID is the internal serial ID, never exposed by the API
+	ID int `json:"-"`
+	// ExternalID identifies the account in the API and in events
+	ExternalID   string    `json:"id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
 	UserID       int       `json:"user_id" example:"123"`
 	Principal    float64   `json:"principal" example:"1000.00"`
 	StartDate    time.Time `json:"start_date"`
 	EndDate      time.Time `json:"end_date"`
 	InterestRate float64   `json:"interest_rate" example:"0.05"`
+	Period       string    `json:"period,omitempty" example:"1y"`
 	Status       string    `json:"status" example:"active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// MaturityInstruction is what happens at end_date: "payout" or "rollover"
+	MaturityInstruction string `json:"maturity_instruction" example:"payout"`
+	// PayoutDestination, like every account number in a response, is masked
+	// to its last four digits
+	PayoutDestination string `json:"payout_destination,omitempty" example:"*********6789"`
+	// PayoutFrequency is how often interest is paid: "monthly", "quarterly" or "at_maturity"
+	PayoutFrequency string `json:"payout_frequency" example:"at_maturity"`
+	// NextPayoutDate is when the next interest payment before maturity is due
+	NextPayoutDate *time.Time `json:"next_payout_date,omitempty"`
+	// InterestPaidThrough is the end of the last interest period paid out
+	InterestPaidThrough *time.Time `json:"interest_paid_through,omitempty"`
+	// InterestAdjustment is the net of the approved corrections to the
+	// account's interest, paid with the interest at maturity
+	InterestAdjustment float64 `json:"interest_adjustment,omitempty" example:"12.50"`
+	// TenantID is the tenant the account belongs to
+	TenantID  string    `json:"tenant_id" example:"default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Funding is the debit that funded the account, if one was needed
+	Funding *Funding `json:"funding,omitempty"`
+	// Closure is how the account is settled once its holder closed it
+	Closure *AccountClosure `json:"closure,omitempty"`
+	// Valuation is computed when an active or frozen account is read
+	Valuation *AccountValuation `json:"valuation,omitempty"`
+	// Display is set when a display_currency was requested
+	Display *DisplayAmounts `json:"display,omitempty"`
+	// AgreementURL is where the deposit agreement can be downloaded. It is
+	// returned when the account is created.
+	AgreementURL string `json:"agreement_url,omitempty" example:"/v2/block-account/01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f/agreement"`
+	// PossibleDuplicateOf is the ID of an identical account the user opened
+	// moments before. It is returned when the account is created and
+	// DUPLICATE_ACCOUNT_ACTION is warn.
+	PossibleDuplicateOf string `json:"possible_duplicate_of,omitempty" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3e"`
+	// bookingNote is recorded with the status the account is created in
+	bookingNote string
+	// idempotencyKey and fingerprint, when set, are stored with the account
+	// so that a repeat of the create request replays it
+	idempotencyKey, fingerprint string
+	// replayed is set on an account returned for a repeated create
+	replayed bool
+	// duplicatesSince, when set, is how far back CreateAccount looks for an
+	// identical account of the user to pass to admit
+	duplicatesSince time.Time
 }
 
 // CreateAccountRequest is the payload for creating accounts
 // @Description Request payload for creating a new block account
 type CreateAccountRequest struct {
-	UserID    int     `json:"user_id" example:"123" binding:"required"`
-	Principal float64 `json:"principal" example:"1000.00" binding:"required,gt=0"`
-	Period    string  `json:"period" example:"1y" binding:"required"` // "3m", "6m", "1y", "3y"
+	UserID    int     `json:"user_id" example:"123" validate:"gt=0"`
+	Principal float64 `json:"principal" example:"1000.00" validate:"gt=0,max_principal" maximum:"1000000000000"`
+	// Period is the code of the product to open, as listed by GET /products.
+	// ProductCode may be sent in its place.
+	Period      string `json:"period,omitempty" example:"1y" validate:"required_without=ProductCode,omitempty,period"`
+	ProductCode string `json:"product_code,omitempty" example:"9m" validate:"omitempty,period"`
+	// PayoutFrequency defaults to "at_maturity"
+	PayoutFrequency string `json:"payout_frequency,omitempty" example:"monthly" validate:"omitempty,payout_frequency"` // "monthly", "quarterly", "at_maturity"
+	// SettlementAccount is debited for the principal. Required when a funding provider is configured.
+	SettlementAccount string `json:"settlement_account,omitempty" example:"1000123456789"`
 }
 
 // ErrorResponse represents a standardized error response
 // @Description Standard error response format
 type ErrorResponse struct {
-	Error   string `json:"error" example:"Bad Request"`
+	Error string `json:"error" example:"Bad Request"`
+	// Code is the HTTP status
 	Code    int    `json:"code" example:"400"`
-	Message string `json:"message,omitempty" example:"Invalid request body"`
+	Message string `json:"message,omitempty" example:"invalid period: 5y. Valid options are: 3m, 6m, 1y, 3y"`
+	// ErrorCode is the machine-readable error from the catalog, e.g. ACCOUNT_NOT_FOUND
+	ErrorCode string `json:"error_code" example:"INVALID_PERIOD"`
+	// Details are code-specific values, such as the limit a request broke
+	Details map[string]any `json:"details,omitempty"`
+	// Fields lists the request fields that failed validation
+	Fields []FieldError `json:"fields,omitempty"`
 }
 
 // SuccessResponse represents a standardized success response
@@ -62,16 +120,155 @@ type SuccessResponse struct {
 
 // BlockAccountService interface abstracts business logic
 type BlockAccountService interface {
-	CreateBlockAccount(ctx context.Context, userID int, principal float64, period string) (*BlockAccount, error)
+	CreateBlockAccount(ctx context.Context, req *CreateAccountRequest) (*BlockAccount, error)
+	CreateValueDatedAccount(ctx context.Context, staffID string, req *ValueDatedAccountRequest) (*BlockAccount, error)
 	GetBlockAccount(ctx context.Context, id int) (*BlockAccount, error)
+	GetPayoutSchedule(ctx context.Context, id int) (*PayoutSchedule, error)
+	GetAccountHistory(ctx context.Context, id int) (*AccountHistory, error)
+	ListProducts(ctx context.Context, userID int) ([]*Product, error)
+	CompareProducts(ctx context.Context, userID int, principal float64) (*ProductComparison, error)
+	ListProductGates(ctx context.Context) ([]*ProductGate, error)
+	SetProductGate(ctx context.Context, product, staffID string, req *ProductGateRequest) (*ProductGate, error)
+	DeleteProductGate(ctx context.Context, product string) error
+	ListAccountLimits(ctx context.Context) ([]*AccountLimit, error)
+	SetAccountLimit(ctx context.Context, rule, staffID string, req *AccountLimitRequest) (*AccountLimit, error)
+	DeleteAccountLimit(ctx context.Context, rule, period string) error
 	GetUserBlockAccounts(ctx context.Context, userID int) ([]*BlockAccount, error)
+	GetUserPortfolio(ctx context.Context, userID int) (*UserPortfolio, error)
+	StreamUserEvents(ctx context.Context, userID int, lastEventID int64, send func(*UserEvent) error, heartbeat func() error) error
+	GetAccountsByExternalID(ctx context.Context, externalIDs []string) (map[string]*BlockAccount, error)
+	GetFundingsOf(ctx context.Context, accountIDs []int) (map[int]*Funding, error)
+	GetStatusChangesOf(ctx context.Context, accountIDs []int) (map[int][]*StatusChange, error)
+	GetInterestPayoutsOf(ctx context.Context, accountIDs []int) (map[int][]*InterestPayout, error)
+	GetPayoutsOf(ctx context.Context, accountIDs []int) (map[int][]*Payout, error)
+	CloseBlockAccount(ctx context.Context, id int, req *CloseAccountRequest) (*BlockAccount, error)
 	DeleteBlockAccount(ctx context.Context, id int) error
+	ConfirmPayout(ctx context.Context, accountID int) (*Payout, error)
+	FailPayout(ctx context.Context, accountID int, reason string) (*Payout, error)
+	RetryPayout(ctx context.Context, accountID int, destination string) (*Payout, error)
+	ChangeMaturityInstruction(ctx context.Context, id int, instruction, destination string) (*BlockAccount, error)
+	GetTaxCertificate(ctx context.Context, userID, year int) (*TaxCertificate, error)
+	GetTaxCertificatePDF(ctx context.Context, userID, year int) ([]byte, error)
+	ProjectRateScenario(ctx context.Context, rates map[string]float64) (*RateScenarioResult, error)
+	ExportAccounts(ctx context.Context, since time.Time, write func([]*BlockAccount) error) error
+	GetAccountCommunications(ctx context.Context, accountID int) ([]*Communication, error)
+	GetMaturingSoon(ctx context.Context, within time.Duration, limit int) ([]*BlockAccount, error)
+	GetMaturityCalendar(ctx context.Context, from, to time.Time, groupBy string) (*MaturityCalendar, error)
+	GetPortfolioStats(ctx context.Context) (*PortfolioStats, error)
+	GetDashboard(ctx context.Context) (*Dashboard, error)
+	GetDiagnostics(ctx context.Context) (*RuntimeDiagnostics, error)
+	QueueReport(ctx context.Context, reportType, date, staffID string) (*Job, error)
+	GetReport(ctx context.Context, reportType, date string) (*Report, error)
+	GetAgreement(ctx context.Context, accountID int) (*Agreement, []byte, error)
+	CreateWebhook(ctx context.Context, req *CreateWebhookRequest) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, id int) error
+	GetWebhookDeliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error)
+	ReplayWebhookDeliveries(ctx context.Context, webhookID int) (int, error)
+	StartImpersonation(ctx context.Context, staffID, staffRole string, req *StartImpersonationRequest) (*ImpersonationSession, error)
+	EndImpersonation(ctx context.Context, id int) error
+	GetImpersonation(ctx context.Context, id int) (*ImpersonationSession, error)
+	ResolveImpersonation(ctx context.Context, token string) (*ImpersonationSession, error)
+	GetDisplayRate(ctx context.Context, currency string) (*FXRate, error)
+	GetStatus(ctx context.Context) *ServiceStatus
+	AuditImpersonation(ctx context.Context, access *ImpersonationAccess)
+	RequestApproval(ctx context.Context, staffID string, req *ApprovalRequest) (*Approval, error)
+	GetApproval(ctx context.Context, id int) (*Approval, error)
+	ListApprovals(ctx context.Context, status string) ([]*Approval, error)
+	DecideApproval(ctx context.Context, id int, approve bool, staffID, note string) (*Approval, error)
+	RequestRecalculation(ctx context.Context, id int, staffID string, req *RecalculateInterestRequest) (*Approval, error)
+	PreviewRecalculation(ctx context.Context, id int, req *RecalculateInterestRequest) (*RecalculationPreview, error)
+	RequestAdjustment(ctx context.Context, id int, staffID string, req *AdjustInterestRequest) (*Approval, error)
+	ImportAccounts(ctx context.Context, imp *AccountImport) (*AccountImport, error)
+	QueueAccountImport(ctx context.Context, imp *AccountImport) (*AccountImport, error)
+	GetAccountImport(ctx context.Context, id int) (*AccountImport, error)
+	QueueEventReplay(ctx context.Context, staffID string, req *EventReplayRequest) (*EventReplay, error)
+	GetEventReplay(ctx context.Context, id int) (*EventReplay, error)
+	ListEventLog(ctx context.Context, afterSequence int64, accountID, eventType string, limit int) ([]*LoggedEvent, error)
+	RebuildProjection(ctx context.Context, staffID string, req *ProjectionRebuildRequest) (*ProjectionRebuild, error)
+	GetJob(ctx context.Context, id int) (*Job, error)
+	CancelJob(ctx context.Context, id int, staffID string) (*Job, error)
+	QueueMaturityRun(ctx context.Context, staffID string) (*Job, error)
+	QueueBatchAction(ctx context.Context, req *BatchActionRequest, staffID string) (*Job, error)
+	PreviewMaturities(ctx context.Context) (*MaturityRunPreview, error)
+	GetNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error)
+	SetNotificationPreferences(ctx context.Context, userID int, req *NotificationPreferencesRequest) (*NotificationPreferences, error)
+	MuteNotifications(ctx context.Context, accountID int, actor string, req *MuteNotificationsRequest) (*NotificationMute, error)
+	UnmuteNotifications(ctx context.Context, accountID int, actor string) (*NotificationMute, error)
+	GetNotificationMutes(ctx context.Context, accountID int) ([]*NotificationMute, error)
+	ListAccountHolders(ctx context.Context, accountID int) ([]*AccountHolder, error)
+	AddAccountHolder(ctx context.Context, accountID int, actor string, req *AddAccountHolderRequest) (*AccountHolder, error)
+	RemoveAccountHolder(ctx context.Context, accountID, userID int) error
+	GetBeneficiaries(ctx context.Context, accountID int) ([]*Beneficiary, error)
+	SetBeneficiaries(ctx context.Context, accountID int, actor string, req *BeneficiariesRequest) ([]*Beneficiary, error)
+	RemoveBeneficiaries(ctx context.Context, accountID int) error
+	GetArchivedAccount(ctx context.Context, accountID int) (*ArchivedAccount, error)
+	ListComplianceFlags(ctx context.Context, status string) ([]*ComplianceFlag, error)
+	ReviewComplianceFlag(ctx context.Context, id int, staffID string, req *ReviewComplianceFlagRequest) (*ComplianceFlag, error)
+	EvaluateFeatures(ctx context.Context, subject string) map[string]bool
+	ListFeatureFlags(ctx context.Context) ([]*FeatureFlag, error)
+	SetFeatureFlag(ctx context.Context, name, staffID string, req *FeatureFlagRequest) (*FeatureFlag, error)
+	DeleteFeatureFlag(ctx context.Context, name string) error
+	ListScheduledJobs(ctx context.Context) ([]*ScheduledJob, error)
+	PauseScheduledJob(ctx context.Context, job, staffID string, paused bool) (*ScheduledJob, error)
+	TriggerScheduledJob(ctx context.Context, job, staffID string) (*ScheduledJob, error)
+	ListReconciliationBreaks(ctx context.Context, status string) ([]*ReconciliationBreak, error)
+	AcknowledgeReconciliationBreak(ctx context.Context, id int, staffID string, req *AcknowledgeBreakRequest) (*ReconciliationBreak, error)
+	AdvanceClock(ctx context.Context, d time.Duration, staffID string) (*SandboxClock, error)
+	Now() time.Time
+	ResolveAccountID(ctx context.Context, externalID string) (int, error)
+	IssueAPIKey(ctx context.Context, staffID string, req *IssueAPIKeyRequest) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]*APIKey, error)
+	RotateAPIKey(ctx context.Context, id int, staffID string, grace time.Duration) (*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int, staffID string) error
+	AuthenticateAPIKey(ctx context.Context, key string) (*APIKey, error)
+	VerifyToken(ctx context.Context, token string) (*Principal, error)
+	GetRegionStatus(ctx context.Context) (*RegionStatus, error)
+	GetReadiness(ctx context.Context) *Readiness
+	PromoteRegion(ctx context.Context, staffID string, req *PromoteRegionRequest) (*Job, error)
+	TenantExists(ctx context.Context, tenant string) (bool, error)
+	ListTenants(ctx context.Context) ([]*Tenant, error)
+	CreateTenant(ctx context.Context, req *CreateTenantRequest) (*Tenant, error)
+	ListTenantRates(ctx context.Context) ([]*TenantRate, error)
+	SetTenantRate(ctx context.Context, period, staffID string, req *TenantRateRequest) (*TenantRate, error)
+	DeleteTenantRate(ctx context.Context, period string) error
+	ListProductDefinitions(ctx context.Context) ([]*ProductDefinition, error)
+	SaveProductDefinition(ctx context.Context, code, staffID string, req *ProductDefinitionRequest) (*ProductDefinition, error)
+	RetireProduct(ctx context.Context, code, staffID string) error
 }
 
 // service struct is our implementation of BlockAccountService
 type service struct {
-	db     *sql.DB
-	logger *zap.Logger
+	repo     Repository
+	logger   *zap.Logger
+	notifier Notifier
+	fx       RateSource      // nil when display conversion is disabled
+	users    UserValidator   // nil when user IDs are not checked
+	funding  FundingProvider // nil when accounts open without moving money
+	store    ObjectStore     // nil when documents are not kept
+	stats    *statsCache     // nil when portfolio statistics are not cached
+	mailer   Mailer          // nil when email is disabled
+	// ids makes the external IDs of new accounts
+	ids IDGenerator
+	// tokens checks bearer tokens, nil when they are not accepted
+	tokens TokenVerifier
+	// channels are the customer notification channels that are configured
+	channels map[string]NotificationChannel
+	// startedAt is when the process started, for uptime reporting
+	startedAt time.Time
+	// schema reports the database schema version, nil when readiness
+	// doesn't check migrations
+	schema *migrator
+	// tenants remembers which tenants exist, nil when every lookup reads
+	// the database
+	tenants *tenantCache
+	// events hands outbox events to open event streams, nil when the
+	// process serves none
+	events *eventHub
+	// clock is the time the account lifecycle follows
+	clock Clock
+	// features caches the feature flags, nil when every evaluation reads
+	// the database
+	features *featureFlags
 }
 
 // Context key type for storing service in context
@@ -79,165 +276,216 @@ type ctxKey string
 
 const ServiceKey ctxKey = "blockAccountService"
 
-// isValidPeriod validates the period parameter
+// isValidPeriod reports whether period is the code of a product that can
+// be opened
 func isValidPeriod(period string) bool {
-	validPeriods := map[string]bool{
-		"3m": true, "6m": true, "1y": true, "3y": true,
-	}
-	return validPeriods[period]
+	p, ok := catalog.get(period)
+	return ok && p.RetiredAt == nil
 }
 
-// validateCreateRequest validates the create account request
-func validateCreateRequest(req *CreateAccountRequest) error {
-	if req.UserID <= 0 {
-		return fmt.Errorf("user_id must be positive")
-	}
-	if req.Principal <= 0 {
-		return fmt.Errorf("principal must be positive")
-	}
-	if !isValidPeriod(req.Period) {
-		return fmt.Errorf("invalid period: %s. Valid options are: 3m, 6m, 1y, 3y", req.Period)
-	}
-	return nil
-}
-
-// writeError writes a standardized error response
+// writeError writes a standardized error response with the generic code
+// of its status
 func writeError(w http.ResponseWriter, statusCode int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(ErrorResponse{
-		Error:   http.StatusText(statusCode),
-		Code:    statusCode,
-		Message: message,
-	})
+	writeErrorResponse(w, statusCode, ErrorResponse{Message: message})
 }
 
-// writeSuccess writes a standardized success response
-func writeSuccess(w http.ResponseWriter, data interface{}, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(SuccessResponse{
-		Success: true,
-		Data:    data,
-		Message: message,
-	})
+// writeSuccess writes a standardized success response, or the bare data
+// when the client asked for BareMediaType
+func writeSuccess(w http.ResponseWriter, r *http.Request, data interface{}, message string) {
+	writeSuccessStatus(w, r, http.StatusOK, data, message)
 }
 
-// CreateBlockAccount creates a block account with calculated interest and dates
-func (s *service) CreateBlockAccount(ctx context.Context, userID int, principal float64, period string) (*BlockAccount, error) {
-	var duration time.Duration
-	var interestRate float64
-
-	switch period {
-	case "3m":
-		duration = time.Hour * 24 * 30 * 3
-		interestRate = 0.02
-	case "6m":
-		duration = time.Hour * 24 * 30 * 6
-		interestRate = 0.035
-	case "1y":
-		duration = time.Hour * 24 * 365
-		interestRate = 0.05
-	case "3y":
-		duration = time.Hour * 24 * 365 * 3
-		interestRate = 0.10
-	default:
-		return nil, fmt.Errorf("invalid period: %s", period)
+// CreateBlockAccount creates a block account with calculated interest and
+// dates. When a funding provider is configured the account starts
+// pending_funding and is returned active only if the debit confirms at once.
+// A create repeating the idempotency key of ctx gets the account the first
+// one opened, as it stands, without being checked or funded again.
+func (s *service) CreateBlockAccount(ctx context.Context, req *CreateAccountRequest) (*BlockAccount, error) {
+	key, fingerprint := idempotencyKeyFromContext(ctx), ""
+	if key != "" {
+		fingerprint = requestFingerprint(req)
+		if account, err := s.replayCreate(ctx, key, fingerprint); account != nil || err != nil {
+			return account, err
+		}
 	}
 
-	startDate := time.Now()
-	endDate := startDate.Add(duration)
-
-	var id int
-	err := s.db.QueryRowContext(ctx,
-		`INSERT INTO block_accounts(user_id, principal, start_date, end_date, interest_rate, status)
-         VALUES ($1, $2, $3, $4, $5, 'active') RETURNING id`,
-		userID, principal, startDate, endDate, interestRate).Scan(&id)
+	userID, principal, period, payoutFrequency := req.UserID, req.Principal, req.Period, req.PayoutFrequency
+	if req.ProductCode != "" {
+		if period != "" && period != req.ProductCode {
+			return nil, ErrProductMismatch
+		}
+		period = req.ProductCode
+	}
+	if payoutFrequency == "" {
+		payoutFrequency = FrequencyAtMaturity
+	}
+	rates, err := s.ratePlan(ctx, tenantOf(ctx))
 	if err != nil {
-		s.logger.Error("Failed to create block account", zap.Error(err))
 		return nil, err
 	}
-
-	// Retrieve the full account details
-	var account BlockAccount
-	err = s.db.QueryRowContext(ctx,
-		`SELECT id, user_id, principal, start_date, end_date, interest_rate, status, created_at, updated_at
-         FROM block_accounts WHERE id=$1`, id).
-		Scan(&account.ID, &account.UserID, &account.Principal, &account.StartDate, &account.EndDate,
-			&account.InterestRate, &account.Status, &account.CreatedAt, &account.UpdatedAt)
+	term, err := rates.terms(period)
 	if err != nil {
-		s.logger.Error("Failed to retrieve created block account", zap.Error(err))
+		return nil, err
+	}
+	if s.funding != nil && req.SettlementAccount == "" {
+		return nil, ErrSettlementAccountRequired
+	}
+	if err := s.checkUserExists(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.checkProductAvailable(ctx, period, userID); err != nil {
+		return nil, err
+	}
+	if err := checkMinPrincipal(period, principal); err != nil {
+		return nil, err
+	}
+	userLimits, err := s.checkAccountLimits(ctx, principal, period)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkCreationVelocity(ctx, userID); err != nil {
 		return nil, err
 	}
 
-	return &account, nil
-}
+	startDate := s.Now().UTC()
+	endDate := term.maturityDate(startDate)
 
-// GetBlockAccount retrieves a block account by ID
-func (s *service) GetBlockAccount(ctx context.Context, id int) (*BlockAccount, error) {
-	var account BlockAccount
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, user_id, principal, start_date, end_date, interest_rate, status, created_at, updated_at
-         FROM block_accounts WHERE id=$1`, id).
-		Scan(&account.ID, &account.UserID, &account.Principal, &account.StartDate, &account.EndDate,
-			&account.InterestRate, &account.Status, &account.CreatedAt, &account.UpdatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		s.logger.Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+	account := &BlockAccount{
+		UserID:              userID,
+		Principal:           principal,
+		StartDate:           startDate,
+		EndDate:             endDate,
+		InterestRate:        term.Rate,
+		Period:              period,
+		Status:              StatusActive,
+		MaturityInstruction: InstructionPayout,
+		PayoutFrequency:     payoutFrequency,
+		TenantID:            tenantOf(ctx),
+	}
+	account.NextPayoutDate = nextInterestPayoutDate(account, startDate)
+	if err := s.assignExternalID(account); err != nil {
 		return nil, err
 	}
-	return &account, nil
-}
+	if s.funding != nil {
+		account.Status = StatusPendingFunding
+		account.Funding = newFunding(req.SettlementAccount, principal)
+	}
+	account.idempotencyKey, account.fingerprint = key, fingerprint
+	account.duplicatesSince = s.duplicatesSince()
 
-// GetUserBlockAccounts retrieves all block accounts for a user
-func (s *service) GetUserBlockAccounts(ctx context.Context, userID int) ([]*BlockAccount, error) {
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, user_id, principal, start_date, end_date, interest_rate, status, created_at, updated_at
-         FROM block_accounts WHERE user_id=$1 ORDER BY created_at DESC`, userID)
+	var duplicate *BlockAccount
+	account, err = s.repo.CreateAccount(ctx, account, func(exposure UserExposure, existing *BlockAccount) error {
+		var refused error
+		if duplicate, refused = s.checkDuplicateAccount(ctx, existing); refused != nil {
+			return refused
+		}
+		return checkUserLimits(userLimits, exposure, principal)
+	})
+	if err == errIdempotencyKeyTaken {
+		// A retry overtook this create while it was being checked
+		return s.replayCreate(ctx, key, fingerprint)
+	}
+	var violation *LimitViolation
+	var refused *DuplicateAccount
+	if errors.As(err, &violation) || errors.As(err, &refused) {
+		// A retry refused for the account its first attempt opened while
+		// it waited for the user's lock gets that account
+		if key != "" {
+			if replay, replayErr := s.replayCreate(ctx, key, fingerprint); replay != nil || replayErr != nil {
+				return replay, replayErr
+			}
+		}
+		return nil, err
+	}
 	if err != nil {
-		s.logger.Error("Failed to get user block accounts", zap.Error(err), zap.Int("userID", userID))
+		s.log(ctx).Error("Failed to create block account", zap.Error(err))
 		return nil, err
 	}
-	defer rows.Close()
+	// The account stands without the agreement document; one that failed to
+	// issue here is issued on its first download
+	if _, err := s.issueAgreement(ctx, account); err != nil {
+		s.log(ctx).Error("Failed to issue agreement", zap.Error(err), zap.Int("account_id", account.ID))
+	}
+	s.recordAccountCreation(ctx, account)
 
-	var accounts []*BlockAccount
-	for rows.Next() {
-		var account BlockAccount
-		err := rows.Scan(&account.ID, &account.UserID, &account.Principal, &account.StartDate, &account.EndDate,
-			&account.InterestRate, &account.Status, &account.CreatedAt, &account.UpdatedAt)
-		if err != nil {
-			s.logger.Error("Failed to scan block account", zap.Error(err))
+	if account.Funding != nil {
+		if account, err = s.fundAccount(ctx, account); err != nil {
 			return nil, err
 		}
-		accounts = append(accounts, &account)
 	}
-
-	if err = rows.Err(); err != nil {
-		s.logger.Error("Error iterating block accounts", zap.Error(err))
-		return nil, err
+	account.AgreementURL = agreementLocation(account.ExternalID)
+	if duplicate != nil {
+		account.PossibleDuplicateOf = duplicate.ExternalID
 	}
-
-	return accounts, nil
+	return account, nil
 }
 
-// DeleteBlockAccount deletes a block account by ID
-func (s *service) DeleteBlockAccount(ctx context.Context, id int) error {
-	result, err := s.db.ExecContext(ctx, `DELETE FROM block_accounts WHERE id=$1`, id)
+// GetBlockAccount retrieves a block account by ID, with its funding while
+// the funding is pending or has failed, its closure once its holder closed
+// it and its valuation while it is active or frozen
+func (s *service) GetBlockAccount(ctx context.Context, id int) (*BlockAccount, error) {
+	account, err := s.repo.GetAccount(ctx, id)
 	if err != nil {
-		s.logger.Error("Failed to delete block account", zap.Error(err), zap.Int("id", id))
-		return err
+		s.log(ctx).Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if account != nil && (account.Status == StatusPendingFunding || account.Status == StatusFundingFailed) {
+		if account.Funding, err = s.repo.GetFunding(ctx, id); err != nil {
+			s.log(ctx).Error("Failed to get funding", zap.Error(err), zap.Int("id", id))
+			return nil, err
+		}
 	}
+	if account != nil && (account.Status == StatusClosing || account.Status == StatusClosed || account.Status == StatusPayoutFailed) {
+		if account.Closure, err = s.repo.GetClosure(ctx, id); err != nil {
+			s.log(ctx).Error("Failed to get closure", zap.Error(err), zap.Int("id", id))
+			return nil, err
+		}
+	}
+	if account != nil {
+		account.Valuation = valueAccount(account, s.Now())
+	}
+	return account, nil
+}
 
-	rowsAffected, err := result.RowsAffected()
+// GetUserBlockAccounts retrieves all block accounts for a user, valued like
+// GetBlockAccount
+func (s *service) GetUserBlockAccounts(ctx context.Context, userID int) ([]*BlockAccount, error) {
+	accounts, err := s.repo.ListAccountsByUser(ctx, userID)
 	if err != nil {
-		s.logger.Error("Failed to get rows affected", zap.Error(err))
-		return err
+		s.log(ctx).Error("Failed to get user block accounts", zap.Error(err), zap.Int("userID", userID))
+		return nil, err
 	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	now := s.Now()
+	for _, a := range accounts {
+		a.Valuation = valueAccount(a, now)
 	}
-	return nil
+	return accounts, nil
+}
+
+// DeleteBlockAccount removes an account and everything recorded against it
+// for good, leaving only its status history. It is a staff tool for
+// removing data; holders close accounts with CloseBlockAccount, which pays
+// them out. Frozen accounts cannot be deleted, and a delete whose If-Match
+// (see withIfMatch) names an older version of the account returns
+// ErrPreconditionFailed.
+func (s *service) DeleteBlockAccount(ctx context.Context, id int) error {
+	err := s.repo.DeleteAccount(ctx, id, func(a *BlockAccount) error {
+		if err := checkIfMatch(ctx, a); err != nil {
+			return err
+		}
+		if a.Status == StatusFrozen {
+			return ErrAccountFrozen
+		}
+		return nil
+	})
+	switch err {
+	case nil:
+		s.log(ctx).Warn("Block account deleted", zap.Int("id", id))
+	case sql.ErrNoRows, ErrAccountFrozen, ErrPreconditionFailed:
+	default:
+		s.log(ctx).Error("Failed to delete block account", zap.Error(err), zap.Int("id", id))
+	}
+	return err
 }
 
 // Middleware to inject the BlockAccountService into request context
@@ -250,17 +498,32 @@ func ServiceMiddleware(svc BlockAccountService) func(http.Handler) http.Handler
 	}
 }
 
+// accountLocation returns the URL of the account with the external ID
+func accountLocation(externalID string) string {
+	return apiPath("/block-account/" + externalID)
+}
+
 // createBlockAccountHandler godoc
 // @Summary Create a new block account
-// @Description Creates a new block account with specified user ID, principal, and period
+// @Description Creates a new block account with specified user ID, principal, and period. Interest is paid at maturity unless a monthly or quarterly payout_frequency is given. When funding is enabled the principal is debited from settlement_account; the account is returned with 202 and status pending_funding until the debit confirms.
 // @Tags block-account
 // @Accept json
 // @Produce json
 // @Param account body CreateAccountRequest true "Create account request"
-// @Success 200 {object} SuccessResponse
+// @Param Idempotency-Key header string false "Unique per create; a retry sending it again gets the account the first attempt opened, for 24 hours"
+// @Success 201 {object} BlockAccount
+// @Success 202 {object} BlockAccount "Account created, waiting for its funding debit"
+// @Header 201,202 {string} Location "URL of the new account"
+// @Header 201,202 {string} ETag "Version of the account"
+// @Header 201,202 {string} Idempotent-Replayed "true when the account was opened by an earlier request with the Idempotency-Key"
+// @Header 201 {string} X-Consistency-Token "Echo on reads to see this write immediately"
 // @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "An identical account was opened moments ago; details name it"
+// @Failure 422 {object} RuleViolationResponse "A limit was broken, the user does not exist (no rule) or the Idempotency-Key was sent with another request (no rule)"
+// @Failure 429 {object} ErrorResponse "Too many accounts opened recently by the user or from the client's address"
 // @Failure 500 {object} ErrorResponse
-// @Router /block-account [post]
+// @Failure 503 {object} ErrorResponse "The user service's circuit breaker is open"
+// @Router /v2/block-account [post]
 func createBlockAccountHandler(w http.ResponseWriter, r *http.Request) {
 	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
 	if !ok {
@@ -269,40 +532,90 @@ func createBlockAccountHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req CreateAccountRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeRequest(w, r, &req) {
 		return
 	}
-
-	if err := validateCreateRequest(&req); err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if len(key) > maxIdempotencyKeyLength {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidField,
+			fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	ctx := withIdempotencyKey(withClientIP(r.Context(), clientIP(r)), key)
 
-	account, err := svc.CreateBlockAccount(ctx, req.UserID, req.Principal, req.Period)
+	account, err := svc.CreateBlockAccount(ctx, &req)
+	if err == ErrProductUnavailable || err == ErrProductMismatch || err == ErrSettlementAccountRequired {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == ErrIdempotencyKeyReused {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, ErrFundingDeclined) {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == ErrUnknownUser {
+		writeErrorCode(w, http.StatusUnprocessableEntity, CodeUserNotFound, fmt.Sprintf("user %d does not exist", req.UserID))
+		return
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	var violation *LimitViolation
+	if errors.As(err, &violation) {
+		writeRuleViolation(w, violation)
+		return
+	}
+	var block *AnomalyBlock
+	if errors.As(err, &block) {
+		writeAnomalyBlock(w, block)
+		return
+	}
+	var duplicate *DuplicateAccount
+	if errors.As(err, &duplicate) {
+		writeAPIError(w, http.StatusConflict, duplicate.apiError())
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeAPIError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	writeSuccess(w, account, "Block account created successfully")
+	markWrite(w)
+	if account.replayed {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+	if account.Status == StatusPendingFunding {
+		w.Header().Set("Location", accountLocation(account.ExternalID))
+		w.Header().Set("ETag", accountETag(r, account))
+		writeSuccessStatus(w, r, http.StatusAccepted, account, "Block account created, waiting for funding")
+		return
+	}
+	w.Header().Set("ETag", accountETag(r, account))
+	writeCreated(w, r, accountLocation(account.ExternalID), account, "Block account created successfully")
 }
 
 // getBlockAccountHandler godoc
 // @Summary Get block account by ID
-// @Description Retrieve a block account by its ID
+// @Description Retrieve a block account by its ID. Active and frozen accounts carry a valuation computed at read time: days elapsed, interest accrued to date, current value and projected maturity value, as of the start of the business day. The response carries a strong ETag that changes whenever the account or its valuation does; send it in If-None-Match to get a 304 while both are unchanged.
 // @Tags block-account
 // @Accept json
 // @Produce json
-// @Param id path int true "Account ID" Format(int64)
+// @Param id path string true "Account ID" Format(uuid)
+// @Param If-None-Match header string false "ETag of the copy the client holds"
+// @Param X-Consistency header string false "Set to 'strong' to read from the primary"
+// @Param X-Consistency-Token header string false "Token returned by a previous write"
 // @Success 200 {object} BlockAccount
+// @Header 200 {string} ETag "Version of the account"
+// @Success 304 "Not Modified"
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /block-account/{id} [get]
+// @Router /v2/block-account/{id} [get]
 func getBlockAccountHandler(w http.ResponseWriter, r *http.Request) {
 	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
 	if !ok {
@@ -310,40 +623,50 @@ func getBlockAccountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid block account ID")
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	ctx := r.Context()
 
 	account, err := svc.GetBlockAccount(ctx, id)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeAPIError(w, http.StatusInternalServerError, err)
 		return
 	}
 	if account == nil {
-		writeError(w, http.StatusNotFound, "Block account not found")
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
 		return
 	}
 
-	writeSuccess(w, account, "Block account retrieved successfully")
+	etag := accountETag(r, account)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeSuccess(w, r, account, "Block account retrieved successfully")
 }
 
 // getUserBlockAccountsHandler godoc
 // @Summary Get all block accounts for a user
-// @Description Retrieve all block accounts for a specific user
+// @Description Retrieve all block accounts for a specific user, including joint accounts of which they are a secondary holder. With display_currency, each account also carries its principal converted at the current rate.
 // @Tags block-account
 // @Accept json
 // @Produce json
 // @Param userID path int true "User ID" Format(int64)
-// @Success 200 {array} BlockAccount
+// @Param display_currency query string false "ISO 4217 currency to also present amounts in" example(EUR)
+// @Param X-Consistency header string false "Set to 'strong' to read from the primary"
+// @Param X-Consistency-Token header string false "Token returned by a previous write"
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]BlockAccount}
+// @Header 200 {string} Link "URL of the next page, rel=next"
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
-// @Router /user/{userID}/block-accounts [get]
+// @Failure 502 {object} ErrorResponse
+// @Router /v2/user/{userID}/block-accounts [get]
 func getUserBlockAccountsHandler(w http.ResponseWriter, r *http.Request) {
 	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
 	if !ok {
@@ -351,37 +674,56 @@ func getUserBlockAccountsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
 	userIDStr := chi.URLParam(r, "userID")
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	ctx := r.Context()
+
+	rate, ok := displayRate(ctx, w, r, svc)
+	if !ok {
+		return
+	}
 
 	accounts, err := svc.GetUserBlockAccounts(ctx, userID)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
+		writeAPIError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if rate != nil {
+		for _, a := range accounts {
+			a.Display = rate.display(map[string]float64{"principal": a.Principal})
+		}
+	}
 
-	writeSuccess(w, accounts, "User block accounts retrieved successfully")
+	writeList(w, r, page, accounts, "User block accounts retrieved successfully")
 }
 
 // deleteBlockAccountHandler godoc
-// @Summary Delete block account by ID
-// @Description Deletes a block account by its ID
-// @Tags block-account
-// @Accept json
+// @Summary Delete block account data
+// @Description Removes a block account and everything recorded against it for good, keeping only its status history, and publishes account.closed. This is a staff tool for removing data, which pays nothing out; holders close accounts with POST /block-account/{id}/close. Frozen accounts cannot be deleted. From v2 the account's ETag must be sent in If-Match, and a delete of a changed account fails with 412.
+// @Tags admin
 // @Produce json
-// @Param id path int true "Account ID" Format(int64)
+// @Param id path string true "Account ID" Format(uuid)
+// @Param If-Match header string true "ETag of the account as last read"
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
 // @Success 204 {string} string "No Content"
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse "X-Staff-ID is missing"
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse "The account changed since it was read"
+// @Failure 428 {object} ErrorResponse "If-Match is missing"
 // @Failure 500 {object} ErrorResponse
-// @Router /block-account/{id} [delete]
+// @Router /v2/block-account/{id} [delete]
 func deleteBlockAccountHandler(w http.ResponseWriter, r *http.Request) {
 	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
 	if !ok {
@@ -389,32 +731,44 @@ func deleteBlockAccountHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "Invalid block account ID")
+	if r.Header.Get(StaffIDHeader) == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
 
-	err = svc.DeleteBlockAccount(ctx, id)
+	if !requireIfMatch(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+
+	err := svc.DeleteBlockAccount(withIfMatch(ctx, r.Header.Get("If-Match")), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			writeError(w, http.StatusNotFound, "Block account not found")
-		} else {
-			writeError(w, http.StatusInternalServerError, err.Error())
+		switch err {
+		case sql.ErrNoRows:
+			writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		case ErrPreconditionFailed:
+			writeAPIError(w, http.StatusPreconditionFailed, err)
+		case ErrAccountFrozen:
+			writeAPIError(w, http.StatusConflict, err)
+		default:
+			writeAPIError(w, http.StatusInternalServerError, err)
 		}
 		return
 	}
 
+	markWrite(w)
 	w.WriteHeader(http.StatusNoContent) // 204 No Content
 }
 
 // healthHandler godoc
 // @Summary Health check endpoint
-// @Description Check if the service is healthy and database is reachable
+// @Description Check if the service is healthy and database is reachable. Kept for existing monitors; Kubernetes probes should use /healthz and /readyz.
 // @Tags health
 // @Produce json
 // @Success 200 {object} map[string]string
@@ -429,37 +783,14 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Try to get the service with database connection
 	if s, ok := svc.(*service); ok {
-		if err := s.db.PingContext(r.Context()); err != nil {
+		if err := s.repo.Ping(r.Context()); err != nil {
 			writeError(w, http.StatusServiceUnavailable, "Database unavailable")
 			return
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "timestamp": time.Now().Format(time.RFC3339)})
-}
-
-// initDatabase initializes the database schema
-func initDatabase(db *sql.DB) error {
-	query := `
-	CREATE TABLE IF NOT EXISTS block_accounts (
-		id SERIAL PRIMARY KEY,
-		user_id INTEGER NOT NULL,
-		principal DECIMAL(15,2) NOT NULL,
-		start_date TIMESTAMP NOT NULL,
-		end_date TIMESTAMP NOT NULL,
-		interest_rate DECIMAL(5,4) NOT NULL,
-		status VARCHAR(20) DEFAULT 'active',
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-	
-	CREATE INDEX IF NOT EXISTS idx_block_accounts_user_id ON block_accounts(user_id);
-	CREATE INDEX IF NOT EXISTS idx_block_accounts_status ON block_accounts(status);
-	CREATE INDEX IF NOT EXISTS idx_block_accounts_end_date ON block_accounts(end_date);
-	`
-	_, err := db.Exec(query)
-	return err
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "timestamp": time.Now().UTC().Format(time.RFC3339)})
 }
 
 // @title Block Account API
@@ -478,61 +809,80 @@ func initDatabase(db *sql.DB) error {
 // @BasePath /
 // @schemes http
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, relying on environment variables")
-	}
-
-	// Initialize logger
-	logger, err := zap.NewProduction()
-	if err != nil {
-		log.Fatalf("Failed to initialize logger: %v", err)
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
 	}
-	defer logger.Sync()
-
-	// Construct the PostgreSQL DSN from environment variables
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_SSLMODE"),
-	)
+}
 
-	db, err := sql.Open("postgres", dsn)
+// openDatabase connects to the configured database
+func openDatabase(cfg config.Database) (*sql.DB, error) {
+	db, err := sql.Open(cfg.Driver, cfg.DSN())
 	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
-	defer db.Close()
 
 	// Configure connection pool
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	// Test DB connection
 	if err := db.Ping(); err != nil {
-		logger.Fatal("Cannot reach database", zap.Error(err))
+		db.Close()
+		return nil, fmt.Errorf("cannot reach database: %w", err)
 	}
+	return db, nil
+}
 
-	// Initialize database schema
-	if err := initDatabase(db); err != nil {
-		logger.Fatal("Failed to initialize database", zap.Error(err))
+// openReplica connects to the configured read replica, pooled like the
+// primary. Unlike the primary it need not be reachable yet: reads stay on
+// the primary until it is.
+func openReplica(cfg config.Database) (*sql.DB, error) {
+	db, err := sql.Open(cfg.Driver, cfg.ReplicaDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to replica: %w", err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
 
-	// Create service with logger
-	svc := &service{db: db, logger: logger}
-
+// newRouter wires middleware and routes for the HTTP API
+func newRouter(svc BlockAccountService, limiter RateLimiter, limits rateLimits, server config.Server, logger *zap.Logger) http.Handler {
 	r := chi.NewRouter()
 
-	// Use middlewares for logging and recovery
-	r.Use(middleware.Logger)
+	// Use middlewares for request IDs, structured access logging and recovery
+	r.Use(RequestIDMiddleware(logger))
+	r.Use(AccessLogMiddleware(logger))
 	r.Use(middleware.Recoverer)
 
+	// Write error messages in the language the client asks for
+	r.Use(LocaleMiddleware)
+
+	// Harden every response, and let configured browser origins call the
+	// API, answering their preflights before authentication
+	r.Use(SecurityHeadersMiddleware(server.Security))
+	r.Use(CORSMiddleware(server.CORS))
+
+	// Bound every request's work and JSON body
+	r.Use(RequestLimitsMiddleware(server))
+
 	// Inject service into context via middleware
 	r.Use(ServiceMiddleware(svc))
 
+	// Honor read-your-writes consistency hints
+	r.Use(ConsistencyMiddleware)
+
+	// Enforce read-only, audited support impersonation sessions
+	r.Use(ImpersonationMiddleware)
+
+	// Mark sandbox responses; partners sign themselves up there
+	if sandboxMode() {
+		r.Use(sandboxHeaders)
+		r.Post(apiPath("/sandbox/keys"), issueSandboxKeyHandler)
+	}
+
 	// Swagger UI route - configure it properly
 	r.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"), // The url pointing to API definition
@@ -541,30 +891,38 @@ func main() {
 		httpSwagger.DomID("swagger-ui"),
 	))
 
-	// Serve Swagger JSON
-	r.Get("/swagger/doc.json", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		http.ServeFile(w, r, "./docs/swagger.json")
-	})
+	// Serve Swagger JSON with validators and its content hash
+	r.Get("/swagger/doc.json", specHandler)
+	r.Head("/swagger/doc.json", specHandler)
+	r.Get("/swagger/doc.hash", specDigestHandler)
 
-	// Health check route
+	// Liveness and readiness probes. /health and /ready predate them and
+	// are kept for existing monitors.
+	r.Get("/healthz", livenessHandler)
+	r.Get("/readyz", readyHandler)
 	r.Get("/health", healthHandler)
+	r.Get("/ready", readyHandler)
+	r.Get("/status", statusHandler)
 
-	// API routes
-	r.Post("/block-account", createBlockAccountHandler)
-	r.Get("/block-account/{id}", getBlockAccountHandler)
-	r.Get("/user/{userID}/block-accounts", getUserBlockAccountsHandler)
-	r.Delete("/block-account/{id}", deleteBlockAccountHandler)
+	// Prometheus metrics, scraped like the probes without credentials
+	r.Get(MetricsPath, metricsHandler.ServeHTTP)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	// Profiling and runtime diagnostics, for platform admins only
+	mountDebug(r, logger)
 
-	logger.Info("Server starting",
-		zap.String("port", port),
-		zap.String("swagger", fmt.Sprintf("http://localhost:%s/swagger/index.html", port)),
-	)
+	// Versioned API routes, and the unversioned aliases kept for existing
+	// clients, for authenticated callers within their rate limits
+	r.Group(func(r chi.Router) {
+		r.Use(AuthMiddleware(logger))
+		if limiter != nil {
+			r.Use(RateLimitMiddleware(limiter, limits, logger))
+		}
+		r.Use(TenantMiddleware)
+		r.Use(FeatureFlagsMiddleware)
+		r.Use(OpenAPIValidationMiddleware(openAPIValidationMode(), logger))
+		mountAPIVersions(r)
+		r.Post(GraphQLPath, graphQLHandler)
+	})
 
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	return r
 }
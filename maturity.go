@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maturityDryRunLimit is the most due accounts a maturity dry run evaluates.
+// They are matured in one transaction that is rolled back.
+const maturityDryRunLimit = 5000
+
+// MaturityRunPreview is what a maturity run would do now, found by maturing
+// the due accounts and rolling it back
+// @Description Dry run of a maturity run; nothing it shows was kept
+type MaturityRunPreview struct {
+	DryRun bool `json:"dry_run" example:"true"`
+	// Matured is how many accounts would mature, RolledOver of them into a
+	// new deposit
+	Matured    int `json:"matured" example:"120"`
+	RolledOver int `json:"rolled_over" example:"35"`
+	// PayoutAmount is the total of the payouts that would be queued
+	PayoutAmount float64 `json:"payout_amount" example:"254310.55"`
+	// RolloverPrincipal is the total principal of the deposits that would
+	// be opened
+	RolloverPrincipal float64 `json:"rollover_principal" example:"90422.10"`
+	// AccountIDs are the accounts that would mature, soonest due first
+	AccountIDs []string `json:"account_ids"`
+	// Truncated is set when more accounts are due than a dry run evaluates;
+	// the totals cover the first maturityDryRunLimit
+	Truncated bool `json:"truncated"`
+}
+
+// ProcessMaturities matures active accounts whose end date has passed,
+// in batches. It returns the number of accounts matured.
+//
+// Progress is checkpointed after every batch. A run interrupted by a crash
+// or deploy is resumed with its original cutoff; accounts matured before the
+// interruption are no longer active, so they are not evaluated again.
+func (s *service) ProcessMaturities(ctx context.Context, now time.Time, batchSize int) (int, error) {
+	return s.processMaturities(ctx, now, batchSize, nil)
+}
+
+// processMaturities is ProcessMaturities calling onBatch, when set, with the
+// accounts matured so far after every batch
+func (s *service) processMaturities(ctx context.Context, now time.Time, batchSize int, onBatch func(matured int)) (int, error) {
+	cp := s.startRun(ctx, JobMaturity, now)
+	plan, err := s.maturityPlan(ctx)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for {
+		n, err := s.repo.MatureDue(ctx, cp.RunStartedAt, batchSize, plan)
+		total += n
+		if err != nil {
+			s.log(ctx).Error("Failed to mature block accounts", zap.Error(err))
+			return total, err
+		}
+		cp.Processed += n
+		if n < batchSize {
+			completed := time.Now().UTC()
+			cp.CompletedAt = &completed
+			s.saveCheckpoint(ctx, cp)
+			return total, nil
+		}
+		s.saveCheckpoint(ctx, cp)
+		if onBatch != nil {
+			onBatch(total)
+		}
+	}
+}
+
+// PreviewMaturities matures the accounts due now, up to
+// maturityDryRunLimit of them, and rolls it back, reporting what the run
+// would have done. No checkpoint is kept.
+func (s *service) PreviewMaturities(ctx context.Context) (*MaturityRunPreview, error) {
+	now := s.Now().UTC()
+	plan, err := s.maturityPlan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	preview := &MaturityRunPreview{DryRun: true, AccountIDs: []string{}}
+	n, err := s.repo.MatureDue(withDryRun(ctx), now, maturityDryRunLimit, func(a *BlockAccount) (*MaturityOutcome, error) {
+		outcome, err := plan(a)
+		if err != nil {
+			return nil, err
+		}
+		preview.AccountIDs = append(preview.AccountIDs, a.ExternalID)
+		if outcome.Rollover != nil {
+			preview.RolledOver++
+			preview.RolloverPrincipal, err = addMoney(preview.RolloverPrincipal, outcome.Rollover.Principal)
+		}
+		if err == nil && outcome.Payout != nil {
+			preview.PayoutAmount, err = addMoney(preview.PayoutAmount, outcome.Payout.Amount)
+		}
+		return outcome, err
+	})
+	if err != nil {
+		s.log(ctx).Error("Failed to preview maturities", zap.Error(err))
+		return nil, err
+	}
+	preview.Matured = n
+	preview.Truncated = n == maturityDryRunLimit
+	return preview, nil
+}
+
+// maturityPlan returns how a run starting now matures each account.
+// Rollovers open at the rate their tenant offers when the run starts.
+func (s *service) maturityPlan(ctx context.Context) (func(*BlockAccount) (*MaturityOutcome, error), error) {
+	plans, err := s.ratePlans(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return func(a *BlockAccount) (*MaturityOutcome, error) {
+		outcome, err := planMaturity(a)
+		if err == nil && outcome.Rollover != nil {
+			if rate, ok := plans[a.TenantID][a.Period]; ok {
+				outcome.Rollover.InterestRate = rate
+			}
+			err = s.assignExternalID(outcome.Rollover)
+		}
+		return outcome, err
+	}, nil
+}
+
+// planMaturity carries out an account's maturity instruction: rollover
+// reinvests the maturity value into a new deposit for the same period,
+// anything else queues a payout. Interest already paid out before maturity
+// is not paid again; approved interest adjustments are paid with the rest.
+// A maturity value above MaxPrincipal is paid out rather than rolled over.
+func planMaturity(a *BlockAccount) (*MaturityOutcome, error) {
+	amount, err := addMoney(a.Principal, interestBetween(a, interestPaidFrom(a), a.EndDate))
+	if err == nil {
+		amount, err = addMoney(amount, a.InterestAdjustment)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("maturity value of account %d: %w", a.ID, err)
+	}
+
+	if a.MaturityInstruction == InstructionRollover && a.Period != "" && amount <= MaxPrincipal {
+		term, err := periodTerms(a.Period)
+		if err != nil {
+			return nil, err
+		}
+		rollover := &BlockAccount{
+			UserID:              a.UserID,
+			Principal:           amount,
+			StartDate:           a.EndDate,
+			EndDate:             term.maturityDate(a.EndDate),
+			InterestRate:        term.Rate,
+			Period:              a.Period,
+			Status:              StatusActive,
+			MaturityInstruction: InstructionRollover,
+			PayoutFrequency:     a.PayoutFrequency,
+			TenantID:            a.TenantID,
+		}
+		rollover.NextPayoutDate = nextInterestPayoutDate(rollover, rollover.StartDate)
+		return &MaturityOutcome{Status: StatusRolledOver, Rollover: rollover}, nil
+	}
+
+	return &MaturityOutcome{
+		Status: StatusMatured,
+		Payout: &Payout{Destination: a.PayoutDestination, Amount: amount, Status: PayoutPending},
+	}, nil
+}
+
+// GetMaturingSoon lists active accounts maturing within the given window,
+// soonest first
+func (s *service) GetMaturingSoon(ctx context.Context, within time.Duration, limit int) ([]*BlockAccount, error) {
+	now := s.Now().UTC()
+	accounts, err := s.repo.ListMaturingBetween(ctx, now, now.Add(within), limit)
+	if err != nil {
+		s.log(ctx).Error("Failed to list maturing accounts", zap.Error(err))
+		return nil, err
+	}
+	if accounts == nil {
+		accounts = []*BlockAccount{}
+	}
+	return accounts, nil
+}
+
+// getMaturingSoonHandler godoc
+// @Summary List accounts maturing soon
+// @Description Lists active block accounts maturing within the next days, soonest first, for liquidity planning
+// @Tags admin
+// @Produce json
+// @Param days query int false "Window in days (1-366)" default(7)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]BlockAccount}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/block-accounts/maturing-soon [get]
+func getMaturingSoonHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 366 {
+			writeError(w, http.StatusBadRequest, "days must be between 1 and 366")
+			return
+		}
+		days = n
+	}
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	// v2 fetches one account past the page to know whether another follows;
+	// v1 takes a limit of its own
+	limit := page.end() + 1
+	if page.all {
+		limit = 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 1000 {
+				writeError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+				return
+			}
+			limit = n
+		}
+	}
+
+	ctx := r.Context()
+
+	accounts, err := svc.GetMaturingSoon(ctx, time.Duration(days)*24*time.Hour, limit)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, accounts, "Maturing accounts retrieved successfully")
+}
+
+// runWorker calls fn immediately and then every interval until ctx is cancelled
+func runWorker(ctx context.Context, logger *zap.Logger, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Worker run failed", zap.String("worker", name), zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("Worker stopped", zap.String("worker", name))
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Maturity calendar groupings
+const (
+	GroupByDay   = "day"
+	GroupByWeek  = "week"
+	GroupByMonth = "month"
+)
+
+const (
+	// defaultMaturityCalendarDays is the calendar's window when no end date is given
+	defaultMaturityCalendarDays = 90
+	// maxMaturityCalendarDays is the longest window the calendar covers,
+	// enough for the longest term
+	maxMaturityCalendarDays = 5*366 + 1
+)
+
+const (
+	calendarJSON = "json"
+	calendarCSV  = "csv"
+	calendarICal = "ics"
+)
+
+// calendarContentTypes is the media type of each maturity calendar format
+var calendarContentTypes = map[string]string{
+	calendarJSON: "application/json",
+	calendarCSV:  "text/csv; charset=utf-8",
+	calendarICal: "text/calendar; charset=utf-8",
+}
+
+// MaturityBucket is one day, week or month of the maturity calendar
+// @Description Active accounts maturing in one day, week or month, with what they pay at maturity at their current rates
+type MaturityBucket struct {
+	// Start is the bucket's first day: the date itself, the Monday of the
+	// week or the first of the month
+	Start string `json:"start" example:"2026-10-12"`
+	// End is the bucket's last day, inclusive
+	End string `json:"end" example:"2026-10-18"`
+	// Accounts is the number of accounts maturing in the bucket
+	Accounts int `json:"accounts" example:"12"`
+	// Principal is the principal they return
+	Principal float64 `json:"principal" example:"120000.00"`
+	// Interest is the interest they still pay at maturity, after interest
+	// adjustments and what periodic payouts already paid
+	Interest float64 `json:"interest" example:"6000.00"`
+	// PayoutAmount is their principal plus interest: what maturity pays out
+	PayoutAmount float64 `json:"payout_amount" example:"126000.00"`
+	// RolloverAmount is the part of PayoutAmount that rolls over into new
+	// accounts instead of leaving
+	RolloverAmount float64 `json:"rollover_amount" example:"42000.00"`
+}
+
+// MaturityCalendar is the schedule of upcoming maturities
+// @Description Upcoming maturities of active accounts between two business dates, per day, week or month, for treasury planning
+type MaturityCalendar struct {
+	From    string `json:"from" example:"2026-10-16"`
+	To      string `json:"to" example:"2027-01-14"`
+	GroupBy string `json:"group_by" example:"week"`
+	// Buckets covers the window without gaps, earliest first; the first
+	// and last may start before From or end after To
+	Buckets []*MaturityBucket `json:"buckets"`
+	// Total sums the buckets over the window
+	Total *MaturityBucket `json:"total"`
+}
+
+// bucketStart returns the first day of the bucket holding day
+func bucketStart(day time.Time, groupBy string) time.Time {
+	switch groupBy {
+	case GroupByWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case GroupByMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	}
+	return day
+}
+
+// nextBucket returns the first day of the bucket after the one starting at start
+func nextBucket(start time.Time, groupBy string) time.Time {
+	switch groupBy {
+	case GroupByWeek:
+		return start.AddDate(0, 0, 7)
+	case GroupByMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// GetMaturityCalendar aggregates the active accounts maturing from the
+// business date from through to, inclusive, per day, week or month
+func (s *service) GetMaturityCalendar(ctx context.Context, from, to time.Time, groupBy string) (*MaturityCalendar, error) {
+	found, err := s.repo.MaturityCalendar(ctx, from, to.AddDate(0, 0, 1), groupBy, businessLocation())
+	if err != nil {
+		s.log(ctx).Error("Failed to aggregate the maturity calendar", zap.Error(err))
+		return nil, err
+	}
+	byStart := make(map[string]*MaturityBucket, len(found))
+	for _, b := range found {
+		byStart[b.Start] = b
+	}
+
+	calendar := &MaturityCalendar{
+		From:    from.Format(reportDateLayout),
+		To:      to.Format(reportDateLayout),
+		GroupBy: groupBy,
+		Buckets: []*MaturityBucket{},
+		Total:   &MaturityBucket{Start: from.Format(reportDateLayout), End: to.Format(reportDateLayout)},
+	}
+	for start := bucketStart(from, groupBy); !start.After(to); start = nextBucket(start, groupBy) {
+		b := byStart[start.Format(reportDateLayout)]
+		if b == nil {
+			b = &MaturityBucket{Start: start.Format(reportDateLayout)}
+		}
+		b.End = nextBucket(start, groupBy).AddDate(0, 0, -1).Format(reportDateLayout)
+		b.Principal = roundMoney(b.Principal)
+		b.Interest = roundMoney(b.Interest)
+		b.PayoutAmount = roundMoney(b.Principal + b.Interest)
+		b.RolloverAmount = roundMoney(b.RolloverAmount)
+		calendar.Buckets = append(calendar.Buckets, b)
+
+		calendar.Total.Accounts += b.Accounts
+		calendar.Total.Principal = roundMoney(calendar.Total.Principal + b.Principal)
+		calendar.Total.Interest = roundMoney(calendar.Total.Interest + b.Interest)
+		calendar.Total.PayoutAmount = roundMoney(calendar.Total.PayoutAmount + b.PayoutAmount)
+		calendar.Total.RolloverAmount = roundMoney(calendar.Total.RolloverAmount + b.RolloverAmount)
+	}
+	return calendar, nil
+}
+
+// formatAmount renders a money amount for the CSV and iCal calendars
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// writeMaturityCalendarCSV writes one row per bucket under a header row
+func writeMaturityCalendarCSV(w io.Writer, calendar *MaturityCalendar) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"start", "end", "accounts", "principal", "interest", "payout_amount", "rollover_amount"})
+	for _, b := range calendar.Buckets {
+		out.Write([]string{b.Start, b.End, strconv.Itoa(b.Accounts), formatAmount(b.Principal),
+			formatAmount(b.Interest), formatAmount(b.PayoutAmount), formatAmount(b.RolloverAmount)})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// icalDate renders a business date as an iCalendar DATE
+func icalDate(date string) string {
+	return strings.ReplaceAll(date, "-", "")
+}
+
+// writeMaturityCalendarICal writes an all-day event for each bucket with
+// maturities, so treasury can subscribe to the schedule. Event UIDs are
+// stable per tenant, grouping and bucket, so refreshed calendars update
+// their events rather than duplicate them.
+func writeMaturityCalendarICal(w io.Writer, calendar *MaturityCalendar, tenant string, now time.Time) error {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format+"\r\n", args...)
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Block Account//Maturity Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:Block account maturities")
+	for _, bucket := range calendar.Buckets {
+		if bucket.Accounts == 0 {
+			continue
+		}
+		end, _ := time.Parse(reportDateLayout, bucket.End)
+		line("BEGIN:VEVENT")
+		line("UID:maturities-%s-%s-%s@block-account", tenant, calendar.GroupBy, icalDate(bucket.Start))
+		line("DTSTAMP:%s", now.UTC().Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE:%s", icalDate(bucket.Start))
+		line("DTEND;VALUE=DATE:%s", end.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:%d block accounts mature\\, %s to pay out", bucket.Accounts, formatAmount(bucket.PayoutAmount))
+		line("DESCRIPTION:Principal %s\\, interest %s\\, rolling over %s", formatAmount(bucket.Principal),
+			formatAmount(bucket.Interest), formatAmount(bucket.RolloverAmount))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// getMaturityCalendarHandler godoc
+// @Summary Get the maturity calendar
+// @Description Aggregates the active accounts maturing between two business dates per day, week or month of their maturity date in BUSINESS_TIMEZONE: how many mature, the principal they return, the interest they still pay and how much of it rolls over rather than pays out. Amounts are at current rates. format=csv returns one row per bucket and format=ics an iCalendar file with an all-day event per bucket with maturities. The window is at most five years.
+// @Tags admin
+// @Produce json,text/csv,text/calendar
+// @Param from query string false "First business date, YYYY-MM-DD; today by default"
+// @Param to query string false "Last business date, inclusive, YYYY-MM-DD; 90 days after from by default"
+// @Param group_by query string false "Bucket size" Enums(day, week, month) default(day)
+// @Param format query string false "Response format" Enums(json, csv, ics) default(json)
+// @Success 200 {object} MaturityCalendar
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/maturities [get]
+func getMaturityCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	query := r.URL.Query()
+	now := svc.Now().In(businessLocation())
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if v := query.Get("from"); v != "" {
+		day, err := parseReportDate(v)
+		if err != nil {
+			writeErrorCode(w, http.StatusBadRequest, CodeInvalidField, "from must be YYYY-MM-DD")
+			return
+		}
+		from = day
+	}
+	to := from.AddDate(0, 0, defaultMaturityCalendarDays)
+	if v := query.Get("to"); v != "" {
+		day, err := parseReportDate(v)
+		if err != nil {
+			writeErrorCode(w, http.StatusBadRequest, CodeInvalidField, "to must be YYYY-MM-DD")
+			return
+		}
+		to = day
+	}
+	if to.Before(from) {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidField, "to must not be before from")
+		return
+	}
+	if to.After(from.AddDate(0, 0, maxMaturityCalendarDays)) {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidField,
+			fmt.Sprintf("the window must be at most %d days", maxMaturityCalendarDays))
+		return
+	}
+	groupBy := query.Get("group_by")
+	switch groupBy {
+	case "":
+		groupBy = GroupByDay
+	case GroupByDay, GroupByWeek, GroupByMonth:
+	default:
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidField, "group_by must be day, week or month")
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = calendarJSON
+	}
+	contentType, ok := calendarContentTypes[format]
+	if !ok {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidField, "format must be json, csv or ics")
+		return
+	}
+
+	ctx := r.Context()
+
+	calendar, err := svc.GetMaturityCalendar(ctx, from, to, groupBy)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if format == calendarJSON {
+		writeSuccess(w, r, calendar, "Maturity calendar retrieved successfully")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="maturities-%s-%s.%s"`, calendar.From, calendar.To, format))
+	if format == calendarCSV {
+		writeMaturityCalendarCSV(w, calendar)
+	} else {
+		writeMaturityCalendarICal(w, calendar, tenantOf(ctx), svc.Now())
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC) // a Sunday
+	for groupBy, want := range map[string]string{GroupByDay: "2026-10-18", GroupByWeek: "2026-10-12", GroupByMonth: "2026-10-01"} {
+		if got := bucketStart(day, groupBy).Format(reportDateLayout); got != want {
+			t.Errorf("bucketStart(%s) = %s, want %s", groupBy, got, want)
+		}
+	}
+}
+
+func TestMaturityCalendar(t *testing.T) {
+	api := newTestAPI(t)
+	api.createAccount(1)
+	api.createAccount(2)
+
+	from := time.Now().Format(reportDateLayout)
+	to := time.Now().AddDate(1, 1, 0).Format(reportDateLayout)
+	var calendar MaturityCalendar
+	w := api.do(http.MethodGet, "/v2/admin/maturities?group_by=month&from="+from+"&to="+to, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("calendar = %d %s", w.Code, w.Body)
+	}
+	decodeData(t, w.Body.Bytes(), &calendar)
+	if len(calendar.Buckets) != 14 || calendar.Total.Accounts != 2 || calendar.Total.Principal != 2000 ||
+		calendar.Total.PayoutAmount <= 2000 || calendar.Total.RolloverAmount != 0 {
+		t.Fatalf("calendar = %+v, total %+v", calendar, calendar.Total)
+	}
+
+	w = api.do(http.MethodGet, "/v2/admin/maturities?group_by=week&format=csv&from="+from+"&to="+to, "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "start,end,accounts,principal") {
+		t.Errorf("csv = %d %s", w.Code, w.Body)
+	}
+	w = api.do(http.MethodGet, "/v2/admin/maturities?format=ics&from="+from+"&to="+to, "")
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "BEGIN:VEVENT") != 1 ||
+		!strings.Contains(w.Body.String(), "SUMMARY:2 block accounts mature") {
+		t.Errorf("ics = %d %s", w.Code, w.Body)
+	}
+
+	for _, query := range []string{"group_by=year", "format=xml", "from=" + to + "&to=" + from} {
+		if w := api.do(http.MethodGet, "/v2/admin/maturities?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", query, w.Code)
+		}
+	}
+}
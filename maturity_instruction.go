@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Maturity instructions
+const (
+	InstructionPayout   = "payout"
+	InstructionRollover = "rollover"
+)
+
+// defaultInstructionCutoff is how long before end_date instructions freeze
+// when MATURITY_INSTRUCTION_CUTOFF is not set
+const defaultInstructionCutoff = 48 * time.Hour
+
+var (
+	// ErrAccountNotActive is returned for changes that require an active account
+	ErrAccountNotActive = newAPIError(CodeAccountNotActive, "block account is not active")
+	// ErrInstructionCutoff is returned when the change window has closed
+	ErrInstructionCutoff = newAPIError(CodeInstructionCutoff, "maturity instruction can no longer be changed this close to maturity")
+)
+
+// MaturityInstructionRequest is the payload for changing a maturity instruction
+// @Description Request payload for changing what happens to a block account at maturity
+type MaturityInstructionRequest struct {
+	Instruction        string `json:"instruction" example:"payout" validate:"oneof=payout rollover"` // "payout" or "rollover"
+	DestinationAccount string `json:"destination_account,omitempty" example:"1000123456789" validate:"required_if=Instruction payout"`
+}
+
+// maturityInstructionCutoff returns how long before maturity instructions freeze
+func maturityInstructionCutoff() time.Duration {
+	if v := os.Getenv("MATURITY_INSTRUCTION_CUTOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return defaultInstructionCutoff
+}
+
+// ChangeMaturityInstruction updates what happens to an active account at
+// maturity, up to the configured cutoff before its end date. A change whose
+// If-Match names an older version of the account returns
+// ErrPreconditionFailed. Where the account pays out is the primary holder's
+// to choose, so a change acting for another customer returns
+// ErrPrimaryHolderRequired.
+func (s *service) ChangeMaturityInstruction(ctx context.Context, id int, instruction, destination string) (*BlockAccount, error) {
+	cutoff := maturityInstructionCutoff()
+	account, err := s.repo.UpdateMaturityInstruction(ctx, id, instruction, destination, func(a *BlockAccount) error {
+		if err := checkIfMatch(ctx, a); err != nil {
+			return err
+		}
+		if err := checkPrimaryHolder(ctx, a); err != nil {
+			return err
+		}
+		if a.Status != StatusActive {
+			return ErrAccountNotActive
+		}
+		if !s.Now().Before(a.EndDate.Add(-cutoff)) {
+			return ErrInstructionCutoff
+		}
+		return nil
+	})
+	if err != nil {
+		if err != ErrAccountNotActive && err != ErrInstructionCutoff && err != ErrPreconditionFailed && err != ErrPrimaryHolderRequired {
+			s.log(ctx).Error("Failed to update maturity instruction", zap.Error(err), zap.Int("id", id))
+		}
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+
+	snapshot := newAccountSnapshot(account)
+	s.notifyCustomer(ctx, EventMaturityInstructionChanged, notificationData{
+		AccountID:   account.ID,
+		UserID:      account.UserID,
+		Account:     &snapshot,
+		Destination: maskAccountNumber(destination),
+	})
+
+	return account, nil
+}
+
+// changeMaturityInstructionHandler godoc
+// @Summary Change maturity instruction
+// @Description Choose whether an active block account is paid out or rolled over at maturity. Changes are accepted until the configured cutoff before end_date. From v2 the account's ETag must be sent in If-Match, and a change to a changed account fails with 412. Only the primary holder of a joint account may change it; when X-User-ID is sent it must name them.
+// @Tags block-account
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param If-Match header string true "ETag of the account as last read"
+// @Param X-User-ID header int false "Customer the request acts for, set by the gateway"
+// @Param instruction body MaturityInstructionRequest true "New maturity instruction"
+// @Success 200 {object} BlockAccount
+// @Header 200 {string} ETag "Version of the changed account"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "X-User-ID is not the primary holder"
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse "The account changed since it was read"
+// @Failure 428 {object} ErrorResponse "If-Match is missing"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/maturity-instruction [put]
+func changeMaturityInstructionHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	if !requireIfMatch(w, r) {
+		return
+	}
+
+	var req MaturityInstructionRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	account, err := svc.ChangeMaturityInstruction(withIfMatch(ctx, r.Header.Get("If-Match")), id, req.Instruction, req.DestinationAccount)
+	if err != nil {
+		switch err {
+		case ErrPreconditionFailed:
+			writeAPIError(w, http.StatusPreconditionFailed, err)
+		case ErrPrimaryHolderRequired:
+			writeAPIError(w, http.StatusForbidden, err)
+		case ErrAccountNotActive, ErrInstructionCutoff:
+			writeAPIError(w, http.StatusConflict, err)
+		default:
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	if account == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+
+	markWrite(w)
+	w.Header().Set("ETag", accountETag(r, account))
+	writeSuccess(w, r, account, "Maturity instruction updated successfully")
+}
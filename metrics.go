@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath serves the Prometheus metrics of the process
+const MetricsPath = "/metrics"
+
+// Read targets, the target label of dbReads
+const (
+	readPrimary = "primary"
+	readReplica = "replica"
+)
+
+var (
+	// dbReads counts the reads that could be served from the replica by
+	// where they went
+	dbReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockaccount_db_reads_total",
+		Help: "Reads eligible for the replica, by the database that served them.",
+	}, []string{"target"})
+	// replicaUp is 1 while reads go to the replica
+	replicaUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "blockaccount_db_replica_up",
+		Help: "1 while the read replica is reachable and within the allowed lag, so reads go to it.",
+	})
+	// replicaLag is the replica's lag at its last check
+	replicaLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "blockaccount_db_replica_lag_seconds",
+		Help: "How far the read replica was behind the primary at its last check.",
+	})
+	// replicaCheckFailures counts the checks that got no answer from the
+	// replica
+	replicaCheckFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "blockaccount_db_replica_check_failures_total",
+		Help: "Checks of the read replica that could not reach it.",
+	})
+	// queryDuration is the latency of the repository queries timedRepository
+	// measures, by query. Buckets run from half a millisecond to a few
+	// seconds, so the p99 of the read path can be read off them.
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blockaccount_db_query_duration_seconds",
+		Help:    "Latency of repository queries, by query, including reading their rows.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"query"})
+)
+
+// metricsHandler serves the metrics in the Prometheus text format
+var metricsHandler = promhttp.Handler()
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Versioned schema migrations per storage driver, named
+// migrations/<driver>/<version>_<name>.up.sql / .down.sql
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// migration is one versioned schema change with its rollback
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// loadMigrations reads the driver's embedded migration files ordered by version
+func loadMigrations(driver string) ([]migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		file := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(file, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", file)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", file, err)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// migrator applies and rolls back migrations, tracking the current version
+// in the schema_migrations table
+type migrator struct {
+	db         *sql.DB
+	driver     string
+	logger     *zap.Logger
+	migrations []migration
+}
+
+func newMigrator(db *sql.DB, driver string, logger *zap.Logger) (*migrator, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, driver: driver, logger: logger, migrations: migrations}, nil
+}
+
+// latest returns the version the code expects the database to be at
+func (m *migrator) latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].version
+}
+
+func (m *migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// Version returns the currently applied schema version, 0 when none
+func (m *migrator) Version(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	err := m.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// Up applies all pending migrations
+func (m *migrator) Up(ctx context.Context) error {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mig := range m.migrations {
+		if mig.version <= current {
+			continue
+		}
+		if err := m.apply(ctx, mig.up, func(tx *sql.Tx) error {
+			// Versions are formatted in rather than bound so the statement works for every driver
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO schema_migrations(version) VALUES (%d)`, mig.version))
+			return err
+		}); err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", mig.version, mig.name, err)
+		}
+		m.logger.Info("Applied migration", zap.Int("version", mig.version), zap.String("name", mig.name))
+	}
+	return nil
+}
+
+// Down rolls back the given number of applied migrations
+func (m *migrator) Down(ctx context.Context, steps int) error {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		mig := m.migrations[i]
+		if mig.version > current {
+			continue
+		}
+		if err := m.apply(ctx, mig.down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM schema_migrations WHERE version >= %d`, mig.version))
+			return err
+		}); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", mig.version, mig.name, err)
+		}
+		m.logger.Info("Rolled back migration", zap.Int("version", mig.version), zap.String("name", mig.name))
+		steps--
+	}
+	return nil
+}
+
+// apply runs a migration script and its bookkeeping in a single transaction.
+// On PostgreSQL the transaction carries LEGACY_TIMESTAMP_ZONE in the
+// blockaccount.legacy_time_zone setting for scripts converting naive
+// timestamps.
+func (m *migrator) apply(ctx context.Context, script string, record func(*sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.driver == DriverPostgres {
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('blockaccount.legacy_time_zone', $1, true)`, legacyTimestampZone()); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckSchema returns an error unless the database is at the latest version
+func (m *migrator) CheckSchema(ctx context.Context) error {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if current != m.latest() {
+		return fmt.Errorf("database schema is at version %d but version %d is required; run `migrate up`", current, m.latest())
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+-- Baseline schema. IF NOT EXISTS lets databases created by the old
+-- runtime initializer adopt the migration history without changes.
+CREATE TABLE IF NOT EXISTS block_accounts (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	principal DECIMAL(15,2) NOT NULL,
+	start_date TIMESTAMP NOT NULL,
+	end_date TIMESTAMP NOT NULL,
+	interest_rate DECIMAL(5,4) NOT NULL,
+	status VARCHAR(20) DEFAULT 'active',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_block_accounts_user_id ON block_accounts(user_id);
+CREATE INDEX IF NOT EXISTS idx_block_accounts_status ON block_accounts(status);
+CREATE INDEX IF NOT EXISTS idx_block_accounts_end_date ON block_accounts(end_date);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS payouts (
+	id SERIAL PRIMARY KEY,
+	account_id INTEGER NOT NULL REFERENCES block_accounts(id) ON DELETE CASCADE,
+	destination_account VARCHAR(64) NOT NULL DEFAULT '',
+	amount DECIMAL(15,2) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	failure_reason TEXT,
+	attempts INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payouts_account_id ON payouts(account_id);
+CREATE INDEX IF NOT EXISTS idx_payouts_status ON payouts(status);
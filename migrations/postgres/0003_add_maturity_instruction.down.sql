@@ -0,0 +1,3 @@
+ALTER TABLE block_accounts DROP COLUMN payout_destination;
+ALTER TABLE block_accounts DROP COLUMN maturity_instruction;
+ALTER TABLE block_accounts DROP COLUMN period;
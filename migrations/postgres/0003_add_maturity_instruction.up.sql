@@ -0,0 +1,11 @@
+ALTER TABLE block_accounts ADD COLUMN period VARCHAR(8);
+ALTER TABLE block_accounts ADD COLUMN maturity_instruction VARCHAR(20) NOT NULL DEFAULT 'payout';
+ALTER TABLE block_accounts ADD COLUMN payout_destination VARCHAR(64);
+
+-- Recover the period of existing accounts from their term length
+UPDATE block_accounts SET period = CASE
+	WHEN end_date - start_date = INTERVAL '90 days' THEN '3m'
+	WHEN end_date - start_date = INTERVAL '180 days' THEN '6m'
+	WHEN end_date - start_date = INTERVAL '365 days' THEN '1y'
+	WHEN end_date - start_date = INTERVAL '1095 days' THEN '3y'
+END;
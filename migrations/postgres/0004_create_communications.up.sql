@@ -0,0 +1,15 @@
+-- Communications are an audit trail of what the customer was told. There is
+-- deliberately no foreign key: the log must survive the account's deletion.
+CREATE TABLE IF NOT EXISTS communications (
+	id SERIAL PRIMARY KEY,
+	account_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	kind VARCHAR(20) NOT NULL,
+	event VARCHAR(64) NOT NULL,
+	subject TEXT NOT NULL,
+	message TEXT NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_communications_account_id ON communications(account_id, created_at);
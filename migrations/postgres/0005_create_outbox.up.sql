@@ -0,0 +1,16 @@
+-- Domain events written in the same transaction as the state change and
+-- relayed to the message broker by the outbox worker
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGSERIAL PRIMARY KEY,
+	event_id UUID NOT NULL UNIQUE,
+	aggregate_id INTEGER NOT NULL,
+	event_type VARCHAR(64) NOT NULL,
+	schema_version INTEGER NOT NULL,
+	payload JSONB NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL;
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS idx_block_accounts_end_date ON block_accounts(end_date);
+CREATE INDEX IF NOT EXISTS idx_block_accounts_status ON block_accounts(status);
+
+DROP INDEX IF EXISTS idx_block_accounts_active_period;
+DROP INDEX IF EXISTS idx_block_accounts_active_end_date;
@@ -0,0 +1,10 @@
+-- Most rows are historical (matured, rolled over), so a plain status index
+-- barely narrows the maturity and maturing-soon scans. Index only the active
+-- rows instead; queries must use the literal status='active' to match.
+CREATE INDEX IF NOT EXISTS idx_block_accounts_active_end_date
+	ON block_accounts(end_date) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_block_accounts_active_period
+	ON block_accounts(period) WHERE status = 'active';
+
+DROP INDEX IF EXISTS idx_block_accounts_status;
+DROP INDEX IF EXISTS idx_block_accounts_end_date;
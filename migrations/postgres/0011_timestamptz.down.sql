@@ -0,0 +1,46 @@
+-- Back to naive timestamps in the zone they were migrated from
+CREATE OR REPLACE FUNCTION pg_temp.legacy_time_zone() RETURNS TEXT AS $$
+	SELECT COALESCE(NULLIF(current_setting('blockaccount.legacy_time_zone', true), ''), current_setting('TimeZone'))
+$$ LANGUAGE SQL STABLE;
+
+ALTER TABLE block_accounts
+	ALTER COLUMN start_date TYPE TIMESTAMP USING start_date AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN end_date TYPE TIMESTAMP USING end_date AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE payouts
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE communications
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN next_attempt_at TYPE TIMESTAMP USING next_attempt_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE outbox
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN published_at TYPE TIMESTAMP USING published_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE webhooks
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE webhook_deliveries
+	ALTER COLUMN next_attempt_at TYPE TIMESTAMP USING next_attempt_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE webhook_delivery_attempts
+	ALTER COLUMN attempted_at TYPE TIMESTAMP USING attempted_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE worker_checkpoints
+	ALTER COLUMN run_started_at TYPE TIMESTAMP USING run_started_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN completed_at TYPE TIMESTAMP USING completed_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE impersonation_sessions
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN expires_at TYPE TIMESTAMP USING expires_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN ended_at TYPE TIMESTAMP USING ended_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE impersonation_audit
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE pg_temp.legacy_time_zone();
@@ -0,0 +1,51 @@
+-- Store every instant as TIMESTAMPTZ so values no longer depend on the
+-- server's or session's time zone. Existing naive values are the wall-clock
+-- time of the service's hosts, which wrote time.Now() in their local zone.
+-- The migrator passes that zone, LEGACY_TIMESTAMP_ZONE, in the
+-- blockaccount.legacy_time_zone setting; run by hand, the session's TimeZone
+-- is used instead.
+CREATE OR REPLACE FUNCTION pg_temp.legacy_time_zone() RETURNS TEXT AS $$
+	SELECT COALESCE(NULLIF(current_setting('blockaccount.legacy_time_zone', true), ''), current_setting('TimeZone'))
+$$ LANGUAGE SQL STABLE;
+
+ALTER TABLE block_accounts
+	ALTER COLUMN start_date TYPE TIMESTAMPTZ USING start_date AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN end_date TYPE TIMESTAMPTZ USING end_date AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE payouts
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE communications
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN next_attempt_at TYPE TIMESTAMPTZ USING next_attempt_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE outbox
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN published_at TYPE TIMESTAMPTZ USING published_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE webhooks
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE webhook_deliveries
+	ALTER COLUMN next_attempt_at TYPE TIMESTAMPTZ USING next_attempt_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE webhook_delivery_attempts
+	ALTER COLUMN attempted_at TYPE TIMESTAMPTZ USING attempted_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE worker_checkpoints
+	ALTER COLUMN run_started_at TYPE TIMESTAMPTZ USING run_started_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN completed_at TYPE TIMESTAMPTZ USING completed_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE impersonation_sessions
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN expires_at TYPE TIMESTAMPTZ USING expires_at AT TIME ZONE pg_temp.legacy_time_zone(),
+	ALTER COLUMN ended_at TYPE TIMESTAMPTZ USING ended_at AT TIME ZONE pg_temp.legacy_time_zone();
+
+ALTER TABLE impersonation_audit
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE pg_temp.legacy_time_zone();
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS interest_payouts;
+DROP INDEX IF EXISTS idx_block_accounts_next_payout;
+ALTER TABLE block_accounts DROP COLUMN IF EXISTS interest_paid_through;
+ALTER TABLE block_accounts DROP COLUMN IF EXISTS next_payout_date;
+ALTER TABLE block_accounts DROP COLUMN IF EXISTS payout_frequency;
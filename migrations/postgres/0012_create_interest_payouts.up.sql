@@ -0,0 +1,22 @@
+-- Interest can be paid monthly or quarterly instead of only at maturity. The
+-- accrual worker pays accounts whose next_payout_date has passed and records
+-- each payment in interest_payouts; interest_paid_through is where the next
+-- accrual period (or the maturity payout) starts.
+ALTER TABLE block_accounts ADD COLUMN IF NOT EXISTS payout_frequency VARCHAR(16) NOT NULL DEFAULT 'at_maturity';
+ALTER TABLE block_accounts ADD COLUMN IF NOT EXISTS next_payout_date TIMESTAMPTZ;
+ALTER TABLE block_accounts ADD COLUMN IF NOT EXISTS interest_paid_through TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_block_accounts_next_payout
+	ON block_accounts(next_payout_date) WHERE status = 'active' AND next_payout_date IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS interest_payouts (
+	id SERIAL PRIMARY KEY,
+	account_id INTEGER NOT NULL REFERENCES block_accounts(id) ON DELETE CASCADE,
+	destination_account VARCHAR(64) NOT NULL DEFAULT '',
+	period_start TIMESTAMPTZ NOT NULL,
+	period_end TIMESTAMPTZ NOT NULL,
+	amount DECIMAL(15,2) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (account_id, period_end)
+);
@@ -0,0 +1 @@
+ALTER TABLE webhooks DROP COLUMN IF EXISTS channel;
@@ -0,0 +1,3 @@
+-- Webhooks subscribe either to account lifecycle events or, on the operations
+-- channel, to operational events for incident tooling. The two never mix.
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS channel VARCHAR(16) NOT NULL DEFAULT 'account';
@@ -0,0 +1,12 @@
+-- Business rules enforced when an account is opened. max_open_accounts and
+-- max_total_principal apply to every user and have an empty period;
+-- min_principal and max_principal are set per period. A rule without a row
+-- is not enforced.
+CREATE TABLE IF NOT EXISTS account_limits (
+	rule VARCHAR(32) NOT NULL,
+	period VARCHAR(16) NOT NULL DEFAULT '',
+	value DECIMAL(15,2) NOT NULL CHECK (value > 0),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (rule, period)
+);
@@ -0,0 +1,7 @@
+-- Users known to this service, for deployments that validate user IDs
+-- locally (USER_VALIDATOR=local). The table is kept in step with the user
+-- service by whatever owns user provisioning.
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE worker_checkpoints DROP COLUMN IF EXISTS last_completed_at;
@@ -0,0 +1,4 @@
+-- completed_at is cleared when a job starts its next run; last_completed_at
+-- keeps the time of the last successful run for status reporting.
+ALTER TABLE worker_checkpoints ADD COLUMN IF NOT EXISTS last_completed_at TIMESTAMPTZ;
+UPDATE worker_checkpoints SET last_completed_at = completed_at;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_outbox_created_at;
+DROP TABLE IF EXISTS event_replays;
@@ -0,0 +1,25 @@
+-- Replays of stored outbox events to a broker topic or webhook, run by the
+-- outbox worker. last_outbox_id is the replay's cursor: everything up to it
+-- has been handed to the destination, so a resumed replay carries on after it.
+-- account_ids and event_types are comma-separated; empty matches everything.
+CREATE TABLE IF NOT EXISTS event_replays (
+	id SERIAL PRIMARY KEY,
+	status VARCHAR(16) NOT NULL DEFAULT 'queued',
+	destination VARCHAR(16) NOT NULL,
+	topic VARCHAR(255) NOT NULL DEFAULT '',
+	webhook_id INTEGER REFERENCES webhooks(id) ON DELETE CASCADE,
+	from_time TIMESTAMPTZ,
+	to_time TIMESTAMPTZ NOT NULL,
+	account_ids TEXT NOT NULL DEFAULT '',
+	event_types TEXT NOT NULL DEFAULT '',
+	last_outbox_id BIGINT NOT NULL DEFAULT 0,
+	replayed INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	requested_by VARCHAR(64) NOT NULL DEFAULT '',
+	lease_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_replays_open ON event_replays(id) WHERE status IN ('queued', 'running');
+CREATE INDEX IF NOT EXISTS idx_outbox_created_at ON outbox(created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE account_imports ADD COLUMN IF NOT EXISTS lease_until TIMESTAMPTZ;
+DROP INDEX IF EXISTS idx_account_imports_job_id;
+ALTER TABLE account_imports DROP COLUMN IF EXISTS job_id;
+DROP TABLE IF EXISTS jobs;
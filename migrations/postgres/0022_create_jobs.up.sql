@@ -0,0 +1,37 @@
+-- Long-running operations run by the jobs worker. Jobs save their progress as
+-- they go; cancel_requested asks a running job to stop at its next heartbeat.
+CREATE TABLE IF NOT EXISTS jobs (
+	id SERIAL PRIMARY KEY,
+	type VARCHAR(32) NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'queued',
+	payload JSONB NOT NULL DEFAULT '{}',
+	progress_done INTEGER NOT NULL DEFAULT 0,
+	progress_total INTEGER NOT NULL DEFAULT 0,
+	result JSONB,
+	error TEXT,
+	cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	requested_by VARCHAR(64) NOT NULL DEFAULT '',
+	lease_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	started_at TIMESTAMPTZ,
+	completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_open ON jobs(id) WHERE status IN ('queued', 'running');
+
+-- Async bulk imports are now loaded by a job instead of being claimed by the
+-- imports worker. Unfinished imports get a job so they are not stranded.
+ALTER TABLE account_imports ADD COLUMN IF NOT EXISTS job_id INTEGER REFERENCES jobs(id);
+ALTER TABLE account_imports DROP COLUMN IF EXISTS lease_until;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_imports_job_id ON account_imports(job_id);
+
+INSERT INTO jobs(type, payload, requested_by, created_at)
+SELECT 'account_import', json_build_object('import_id', id), requested_by, created_at
+FROM account_imports WHERE status IN ('queued', 'running') ORDER BY id;
+
+UPDATE account_imports a SET job_id = j.id
+FROM jobs j
+WHERE j.type = 'account_import' AND (j.payload->>'import_id')::int = a.id;
+
+UPDATE jobs SET payload = '{}' WHERE type = 'account_import';
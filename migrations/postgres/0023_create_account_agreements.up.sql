@@ -0,0 +1,11 @@
+-- The deposit agreement issued when an account is opened. The terms it was
+-- rendered with are kept so the document can be reproduced exactly, and
+-- the row outlives the account as the legal record.
+CREATE TABLE IF NOT EXISTS account_agreements (
+	account_id INTEGER PRIMARY KEY,
+	template_version VARCHAR(32) NOT NULL,
+	terms JSONB NOT NULL,
+	sha256 CHAR(64) NOT NULL,
+	document_key TEXT,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,15 @@
+-- Periods in which an account's bulk notifications are withheld. Rows are
+-- never deleted: a mute runs out by itself at muted_until, ended_at records
+-- one lifted early, and the rows are the audit trail of both.
+CREATE TABLE IF NOT EXISTS notification_mutes (
+	id SERIAL PRIMARY KEY,
+	account_id INTEGER NOT NULL,
+	muted_until TIMESTAMPTZ NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	muted_by VARCHAR(128) NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	ended_at TIMESTAMPTZ,
+	ended_by VARCHAR(128)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_mutes_account_id ON notification_mutes(account_id, muted_until);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS compliance_flags;
+DROP TABLE IF EXISTS account_creations;
@@ -0,0 +1,36 @@
+-- Who opened each account and from where, kept for the velocity checks'
+-- window only
+CREATE TABLE IF NOT EXISTS account_creations (
+	id SERIAL PRIMARY KEY,
+	account_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_creations_user_id ON account_creations(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_account_creations_client_ip ON account_creations(client_ip, created_at);
+CREATE INDEX IF NOT EXISTS idx_account_creations_created_at ON account_creations(created_at);
+
+-- Suspicious activity raised by the anomaly detector, queued for compliance
+-- review. Repeats of a rule for the same subject add to the open flag.
+CREATE TABLE IF NOT EXISTS compliance_flags (
+	id SERIAL PRIMARY KEY,
+	rule VARCHAR(32) NOT NULL,
+	subject VARCHAR(128) NOT NULL,
+	user_id INTEGER NOT NULL,
+	account_id INTEGER,
+	client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	detail TEXT NOT NULL,
+	action VARCHAR(16) NOT NULL,
+	occurrences INTEGER NOT NULL DEFAULT 1,
+	status VARCHAR(16) NOT NULL DEFAULT 'open',
+	created_at TIMESTAMPTZ NOT NULL,
+	last_seen_at TIMESTAMPTZ NOT NULL,
+	reviewed_by VARCHAR(128),
+	reviewed_at TIMESTAMPTZ,
+	review_note TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_compliance_flags_open ON compliance_flags(rule, subject) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_compliance_flags_status ON compliance_flags(status, id);
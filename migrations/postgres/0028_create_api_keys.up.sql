@@ -0,0 +1,19 @@
+-- Keys for service-to-service callers. Only a SHA-256 hash of each key is
+-- kept; prefix is the part of the key it is looked up by. After a rotation
+-- the replaced key keeps working until previous_expires_at.
+CREATE TABLE IF NOT EXISTS api_keys (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	prefix VARCHAR(16) NOT NULL UNIQUE,
+	key_hash CHAR(64) NOT NULL,
+	scopes VARCHAR(64) NOT NULL,
+	created_by VARCHAR(128) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	rotated_at TIMESTAMPTZ,
+	previous_hash CHAR(64),
+	previous_expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	revoked_by VARCHAR(128)
+);
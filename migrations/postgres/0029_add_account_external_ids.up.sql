@@ -0,0 +1,27 @@
+-- External IDs name accounts in the API and events; the serial id stays
+-- internal. Accounts opened before this migration get a random UUID.
+ALTER TABLE block_accounts ADD COLUMN IF NOT EXISTS external_id UUID;
+UPDATE block_accounts SET external_id = gen_random_uuid() WHERE external_id IS NULL;
+ALTER TABLE block_accounts ALTER COLUMN external_id SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_block_accounts_external_id ON block_accounts(external_id);
+
+-- account_ids keeps every account's external ID after the account is
+-- deleted, so the communications, agreements and payouts that outlive it
+-- can still be looked up and reported by it
+CREATE TABLE IF NOT EXISTS account_ids (
+	account_id INTEGER PRIMARY KEY,
+	external_id UUID NOT NULL UNIQUE
+);
+INSERT INTO account_ids(account_id, external_id)
+SELECT id, external_id FROM block_accounts
+ON CONFLICT DO NOTHING;
+-- Accounts already deleted get one too, for the records they left behind
+INSERT INTO account_ids(account_id, external_id)
+SELECT account_id, gen_random_uuid()
+FROM (SELECT account_id FROM communications UNION SELECT account_id FROM account_agreements
+      UNION SELECT account_id FROM payouts) AS orphaned
+ON CONFLICT DO NOTHING;
+
+-- The broker message key: the account's external ID. Empty for events
+-- queued before this migration, which are keyed by aggregate_id.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS aggregate_key VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS region;
+DROP TABLE IF EXISTS region_state;
@@ -0,0 +1,10 @@
+-- worker_heartbeats records when each background worker last finished a run,
+-- so readiness checks can tell a stalled worker from an idle one. Replicas of
+-- a worker share its row; any of them keeps it fresh.
+CREATE TABLE IF NOT EXISTS worker_heartbeats (
+	worker TEXT PRIMARY KEY,
+	instance TEXT NOT NULL,
+	interval_ms BIGINT NOT NULL,
+	last_run_failed BOOLEAN NOT NULL,
+	beat_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,19 @@
+-- account_status_history records every status an account has had, for the
+-- account history support staff read. It has no foreign key so that the
+-- history of a closed account outlives its row. Accounts opened before it
+-- start with their status at the time, dated by their last update.
+CREATE TABLE IF NOT EXISTS account_status_history (
+	id SERIAL PRIMARY KEY,
+	account_id INTEGER NOT NULL,
+	from_status VARCHAR(20),
+	to_status VARCHAR(20) NOT NULL,
+	principal DECIMAL(15,2) NOT NULL,
+	note TEXT,
+	changed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_status_history_account ON account_status_history(account_id, id);
+
+INSERT INTO account_status_history(account_id, to_status, principal, note, changed_at)
+SELECT id, status, principal, 'status when history began', COALESCE(updated_at, created_at)
+FROM block_accounts;
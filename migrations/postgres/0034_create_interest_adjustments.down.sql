@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS interest_adjustments;
+ALTER TABLE approvals DROP COLUMN IF EXISTS adjustment;
+ALTER TABLE block_accounts DROP COLUMN IF EXISTS interest_adjustment;
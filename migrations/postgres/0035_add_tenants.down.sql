@@ -0,0 +1,27 @@
+DELETE FROM notification_preferences WHERE tenant_id <> 'default';
+ALTER TABLE notification_preferences DROP CONSTRAINT IF EXISTS notification_preferences_pkey;
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE notification_preferences ADD PRIMARY KEY (user_id);
+DELETE FROM account_limits WHERE tenant_id <> 'default';
+ALTER TABLE account_limits DROP CONSTRAINT IF EXISTS account_limits_pkey;
+ALTER TABLE account_limits DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE account_limits ADD PRIMARY KEY (rule, period);
+DELETE FROM product_gates WHERE tenant_id <> 'default';
+ALTER TABLE product_gates DROP CONSTRAINT IF EXISTS product_gates_pkey;
+ALTER TABLE product_gates DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE product_gates ADD PRIMARY KEY (product);
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE account_creations DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE jobs DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE account_imports DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE impersonation_sessions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE compliance_flags DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE approvals DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE webhooks DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE outbox DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE account_ids DROP COLUMN IF EXISTS tenant_id;
+DROP INDEX IF EXISTS idx_block_accounts_tenant_user;
+ALTER TABLE block_accounts DROP COLUMN IF EXISTS tenant_id;
+DROP TABLE IF EXISTS tenant_rates;
+DROP TABLE IF EXISTS tenants;
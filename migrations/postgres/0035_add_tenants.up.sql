@@ -0,0 +1,46 @@
+-- Tenants share one database. Every account, and everything configured or
+-- requested for it, belongs to one tenant, and reads made for a tenant only
+-- see its rows. Rows from before tenants belong to the default tenant. Rows
+-- keyed by account (payouts, communications, status history and the like)
+-- belong to their account's tenant. API keys with an empty tenant_id are
+-- platform keys, which may act for any tenant.
+CREATE TABLE IF NOT EXISTS tenants (
+	id VARCHAR(64) PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO tenants(id, name) VALUES ('default', 'Default') ON CONFLICT (id) DO NOTHING;
+
+-- A tenant's rate plan: the rates it sets in place of a period's built-in rate
+CREATE TABLE IF NOT EXISTS tenant_rates (
+	tenant_id VARCHAR(64) NOT NULL REFERENCES tenants(id),
+	period VARCHAR(16) NOT NULL,
+	rate DECIMAL(5,4) NOT NULL CHECK (rate >= 0 AND rate < 1),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (tenant_id, period)
+);
+
+ALTER TABLE block_accounts ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS idx_block_accounts_tenant_user ON block_accounts(tenant_id, user_id);
+ALTER TABLE account_ids ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE approvals ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE compliance_flags ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE impersonation_sessions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE account_imports ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE account_creations ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Product gates, limits and notification preferences are set per tenant
+ALTER TABLE product_gates ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE product_gates DROP CONSTRAINT IF EXISTS product_gates_pkey;
+ALTER TABLE product_gates ADD PRIMARY KEY (tenant_id, product);
+ALTER TABLE account_limits ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE account_limits DROP CONSTRAINT IF EXISTS account_limits_pkey;
+ALTER TABLE account_limits ADD PRIMARY KEY (tenant_id, rule, period);
+ALTER TABLE notification_preferences ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE notification_preferences DROP CONSTRAINT IF EXISTS notification_preferences_pkey;
+ALTER TABLE notification_preferences ADD PRIMARY KEY (tenant_id, user_id);
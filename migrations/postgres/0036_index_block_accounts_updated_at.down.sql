@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_block_accounts_updated_at;
@@ -0,0 +1,4 @@
+-- The analytics export reads accounts in (updated_at, id) order, one chunk
+-- after another, starting from the time of the previous export
+CREATE INDEX IF NOT EXISTS idx_block_accounts_updated_at
+	ON block_accounts(updated_at, id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_payouts_maturity;
+ALTER TABLE payouts DROP COLUMN IF EXISTS maturity_date;
+DROP TABLE IF EXISTS worker_leases;
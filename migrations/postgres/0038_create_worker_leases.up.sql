@@ -0,0 +1,17 @@
+-- Workers that must run on one replica at a time take a lease here before
+-- each run. A lease that is not renewed lapses at expires_at, so a replica
+-- that dies hands the work to another.
+CREATE TABLE IF NOT EXISTS worker_leases (
+	worker VARCHAR(64) PRIMARY KEY,
+	holder VARCHAR(255) NOT NULL,
+	acquired_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- A maturity payout is keyed by the account and the end date it matured on,
+-- so an account can't be paid out twice for one maturity
+ALTER TABLE payouts ADD COLUMN IF NOT EXISTS maturity_date TIMESTAMPTZ;
+UPDATE payouts SET maturity_date = block_accounts.end_date
+FROM block_accounts WHERE block_accounts.id = payouts.account_id AND payouts.maturity_date IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payouts_maturity ON payouts(account_id, maturity_date)
+	WHERE maturity_date IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_compliance_flags_tenant_status;
+DROP INDEX IF EXISTS idx_approvals_tenant_status;
+DROP INDEX IF EXISTS idx_block_accounts_tenant_updated_at;
+DROP INDEX IF EXISTS idx_block_accounts_tenant_maturing;
@@ -0,0 +1,24 @@
+-- Deposit products replace the fixed 3m/6m/1y/3y periods. An account's
+-- period is the code of the product it was opened as. A product's rate is
+-- its built-in rate, which tenant_rates overrides per tenant. Retired
+-- products cannot be opened; accounts already open on them keep maturing
+-- and rolling over.
+CREATE TABLE IF NOT EXISTS products (
+	code VARCHAR(16) PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	term_months INTEGER NOT NULL CHECK (term_months BETWEEN 1 AND 120),
+	rate DECIMAL(5,4) NOT NULL CHECK (rate >= 0 AND rate < 1),
+	min_principal DECIMAL(15,2) NOT NULL DEFAULT 0 CHECK (min_principal >= 0),
+	early_withdrawal VARCHAR(16) NOT NULL DEFAULT 'allowed'
+		CHECK (early_withdrawal IN ('allowed', 'approval', 'not_allowed')),
+	retired_at TIMESTAMPTZ,
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO products(code, name, term_months, rate) VALUES
+	('3m', '3-month deposit', 3, 0.02),
+	('6m', '6-month deposit', 6, 0.035),
+	('1y', '1-year deposit', 12, 0.05),
+	('3y', '3-year deposit', 36, 0.10)
+ON CONFLICT (code) DO NOTHING;
@@ -0,0 +1,22 @@
+-- account_holders lists the users who own each account. An account has one
+-- primary holder, the user it was opened for and the only one who may
+-- withdraw from it, and any number of secondary holders, who see it among
+-- their own accounts. Holders go with their account, and carry over to its
+-- rollover. Accounts opened before joint accounts get their user as primary
+-- holder.
+CREATE TABLE IF NOT EXISTS account_holders (
+	account_id INTEGER NOT NULL REFERENCES block_accounts(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL,
+	role VARCHAR(16) NOT NULL CHECK (role IN ('primary', 'secondary')),
+	added_by VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (account_id, user_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_holders_primary ON account_holders(account_id) WHERE role = 'primary';
+-- the per-user listing finds a user's accounts through their holdings
+CREATE INDEX IF NOT EXISTS idx_account_holders_user ON account_holders(user_id, account_id);
+
+INSERT INTO account_holders(account_id, user_id, role, created_at)
+SELECT id, user_id, 'primary', COALESCE(created_at, CURRENT_TIMESTAMP) FROM block_accounts
+ON CONFLICT (account_id, user_id) DO NOTHING;
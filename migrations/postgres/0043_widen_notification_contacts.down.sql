@@ -0,0 +1,4 @@
+-- Fails while any contact is stored encrypted; run with FIELD_ENCRYPTION
+-- unset only after decrypting them
+ALTER TABLE notification_preferences ALTER COLUMN email TYPE VARCHAR(254);
+ALTER TABLE notification_preferences ALTER COLUMN phone TYPE VARCHAR(32);
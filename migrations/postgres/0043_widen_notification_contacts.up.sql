@@ -0,0 +1,4 @@
+-- Encrypted email addresses and phone numbers are longer than the columns
+-- sized for them in plaintext
+ALTER TABLE notification_preferences ALTER COLUMN email TYPE TEXT;
+ALTER TABLE notification_preferences ALTER COLUMN phone TYPE TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE approvals DROP COLUMN IF EXISTS value_date;
+ALTER TABLE interest_adjustments DROP COLUMN IF EXISTS value_date;
@@ -0,0 +1,6 @@
+-- When an interest adjustment, or the approval requesting it, takes effect,
+-- when it was value-dated before it was booked; NULL when it takes effect as
+-- booked. Value-dated accounts need no column: start_date is their value
+-- date and created_at their booking date.
+ALTER TABLE interest_adjustments ADD COLUMN IF NOT EXISTS value_date TIMESTAMPTZ;
+ALTER TABLE approvals ADD COLUMN IF NOT EXISTS value_date TIMESTAMPTZ;
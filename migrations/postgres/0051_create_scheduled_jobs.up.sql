@@ -0,0 +1,18 @@
+-- The state of each job `worker scheduler` drives: its schedule, whether it
+-- is paused or a run was asked for through the admin API, and its last and
+-- next runs
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+	job VARCHAR(64) PRIMARY KEY,
+	schedule VARCHAR(128) NOT NULL DEFAULT '',
+	paused BOOLEAN NOT NULL DEFAULT FALSE,
+	paused_by VARCHAR(255) NOT NULL DEFAULT '',
+	trigger_requested_at TIMESTAMPTZ,
+	trigger_requested_by VARCHAR(255) NOT NULL DEFAULT '',
+	running_since TIMESTAMPTZ,
+	last_started_at TIMESTAMPTZ,
+	last_finished_at TIMESTAMPTZ,
+	last_status VARCHAR(16) NOT NULL DEFAULT '',
+	last_error TEXT NOT NULL DEFAULT '',
+	next_run_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
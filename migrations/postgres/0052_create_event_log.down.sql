@@ -0,0 +1,5 @@
+DROP VIEW IF EXISTS events;
+DROP INDEX IF EXISTS idx_outbox_aggregate_key;
+DROP TRIGGER IF EXISTS outbox_events_undeletable ON outbox;
+DROP TRIGGER IF EXISTS outbox_events_immutable ON outbox;
+DROP FUNCTION IF EXISTS outbox_append_only();
@@ -0,0 +1,7 @@
+-- Fails while any account number is stored encrypted; run with
+-- FIELD_ENCRYPTION unset only after decrypting them
+ALTER TABLE block_accounts ALTER COLUMN payout_destination TYPE VARCHAR(64);
+ALTER TABLE account_fundings ALTER COLUMN settlement_account TYPE VARCHAR(34);
+ALTER TABLE account_closures ALTER COLUMN destination_account TYPE VARCHAR(64);
+ALTER TABLE payouts ALTER COLUMN destination_account TYPE VARCHAR(64);
+ALTER TABLE interest_payouts ALTER COLUMN destination_account TYPE VARCHAR(64);
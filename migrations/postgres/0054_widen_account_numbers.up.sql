@@ -0,0 +1,7 @@
+-- Encrypted account numbers are longer than the columns sized for them in
+-- plaintext
+ALTER TABLE block_accounts ALTER COLUMN payout_destination TYPE TEXT;
+ALTER TABLE account_fundings ALTER COLUMN settlement_account TYPE TEXT;
+ALTER TABLE account_closures ALTER COLUMN destination_account TYPE TEXT;
+ALTER TABLE payouts ALTER COLUMN destination_account TYPE TEXT;
+ALTER TABLE interest_payouts ALTER COLUMN destination_account TYPE TEXT;
@@ -0,0 +1,35 @@
+-- SQLite schema for local development and tests. It mirrors the PostgreSQL
+-- schema; add a matching migration here whenever one is added there.
+CREATE TABLE block_accounts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	principal DECIMAL(15,2) NOT NULL,
+	start_date TIMESTAMP NOT NULL,
+	end_date TIMESTAMP NOT NULL,
+	interest_rate DECIMAL(5,4) NOT NULL,
+	period VARCHAR(8),
+	status VARCHAR(20) DEFAULT 'active',
+	maturity_instruction VARCHAR(20) NOT NULL DEFAULT 'payout',
+	payout_destination VARCHAR(64),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_block_accounts_user_id ON block_accounts(user_id);
+CREATE INDEX idx_block_accounts_status ON block_accounts(status);
+CREATE INDEX idx_block_accounts_end_date ON block_accounts(end_date);
+
+CREATE TABLE payouts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL REFERENCES block_accounts(id) ON DELETE CASCADE,
+	destination_account VARCHAR(64) NOT NULL DEFAULT '',
+	amount DECIMAL(15,2) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	failure_reason TEXT,
+	attempts INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payouts_account_id ON payouts(account_id);
+CREATE INDEX idx_payouts_status ON payouts(status);
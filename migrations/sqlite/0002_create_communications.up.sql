@@ -0,0 +1,13 @@
+CREATE TABLE communications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	kind VARCHAR(20) NOT NULL,
+	event VARCHAR(64) NOT NULL,
+	subject TEXT NOT NULL,
+	message TEXT NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_communications_account_id ON communications(account_id, created_at);
@@ -0,0 +1,40 @@
+CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL,
+	secret VARCHAR(64) NOT NULL,
+	events TEXT NOT NULL, -- comma-separated event types
+	active BOOLEAN NOT NULL DEFAULT 1,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per event per subscribed webhook, fanned out with the outbox write
+CREATE TABLE webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_id TEXT NOT NULL,
+	event_type VARCHAR(64) NOT NULL,
+	payload TEXT NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	last_status_code INTEGER,
+	last_error TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+CREATE INDEX idx_webhook_deliveries_due
+	ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE webhook_delivery_attempts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+	attempt INTEGER NOT NULL,
+	status_code INTEGER,
+	error TEXT,
+	duration_ms BIGINT NOT NULL,
+	attempted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_webhook_delivery_attempts_delivery_id ON webhook_delivery_attempts(delivery_id);
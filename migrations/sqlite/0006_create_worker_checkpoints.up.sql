@@ -0,0 +1,9 @@
+-- Progress of the current or last run of each batch job, so a job
+-- interrupted mid-run resumes instead of starting over
+CREATE TABLE worker_checkpoints (
+	job VARCHAR(64) PRIMARY KEY,
+	run_started_at TIMESTAMP NOT NULL,
+	processed INTEGER NOT NULL DEFAULT 0,
+	completed_at TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
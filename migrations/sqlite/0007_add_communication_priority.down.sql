@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_communications_pending;
+ALTER TABLE communications DROP COLUMN next_attempt_at;
+ALTER TABLE communications DROP COLUMN priority;
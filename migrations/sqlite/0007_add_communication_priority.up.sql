@@ -0,0 +1,8 @@
+-- Customer notifications are queued and sent by the notification worker,
+-- which drains each priority lane separately so bulk sends cannot delay
+-- time-critical ones. next_attempt_at hides a claimed row from other workers.
+ALTER TABLE communications ADD COLUMN priority VARCHAR(10) NOT NULL DEFAULT 'bulk';
+ALTER TABLE communications ADD COLUMN next_attempt_at TIMESTAMP;
+
+CREATE INDEX idx_communications_pending
+	ON communications(priority, next_attempt_at) WHERE status = 'pending';
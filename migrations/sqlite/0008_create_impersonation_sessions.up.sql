@@ -0,0 +1,27 @@
+-- Read-only sessions in which support staff see the API as a customer does.
+-- Only a hash of the session token is stored.
+CREATE TABLE impersonation_sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	staff_id VARCHAR(128) NOT NULL,
+	staff_role VARCHAR(64) NOT NULL,
+	user_id INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	ended_at TIMESTAMP
+);
+
+CREATE INDEX idx_impersonation_sessions_user_id ON impersonation_sessions(user_id);
+
+-- Every request made with an impersonation session, including refused ones
+CREATE TABLE impersonation_audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id INTEGER NOT NULL REFERENCES impersonation_sessions(id),
+	method VARCHAR(10) NOT NULL,
+	path TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_impersonation_audit_session_id ON impersonation_audit(session_id);
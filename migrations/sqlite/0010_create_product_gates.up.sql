@@ -0,0 +1,10 @@
+-- A gated product is only shown to and sold to the allowlisted users plus a
+-- stable percentage of everyone else. Products without a gate are generally
+-- available.
+CREATE TABLE product_gates (
+	product VARCHAR(16) PRIMARY KEY,
+	allowed_user_ids TEXT NOT NULL DEFAULT '',
+	rollout_percent INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percent BETWEEN 0 AND 100),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,16 @@
+-- The debit that moves a new account's principal from the customer's
+-- settlement account. Accounts opened while a funding provider is configured
+-- start pending_funding and only become active once the debit is confirmed.
+CREATE TABLE account_fundings (
+	account_id INTEGER PRIMARY KEY REFERENCES block_accounts(id) ON DELETE CASCADE,
+	settlement_account VARCHAR(34) NOT NULL,
+	reference VARCHAR(64) NOT NULL UNIQUE,
+	amount DECIMAL(15,2) NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	failure_reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	settled_at TIMESTAMP
+);
+
+CREATE INDEX idx_account_fundings_pending ON account_fundings(account_id) WHERE status = 'pending';
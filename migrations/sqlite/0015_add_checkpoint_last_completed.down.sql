@@ -0,0 +1 @@
+ALTER TABLE worker_checkpoints DROP COLUMN last_completed_at;
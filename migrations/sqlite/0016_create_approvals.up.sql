@@ -0,0 +1,18 @@
+-- Sensitive operations held for a second staff member's approval. The action
+-- is only carried out once someone other than the requester approves it.
+CREATE TABLE approvals (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	action VARCHAR(32) NOT NULL,
+	account_id INTEGER NOT NULL,
+	amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+	reason TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	requested_by VARCHAR(64) NOT NULL,
+	decided_by VARCHAR(64) NOT NULL DEFAULT '',
+	decision_note TEXT NOT NULL DEFAULT '',
+	failure_reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	decided_at TIMESTAMP
+);
+
+CREATE INDEX idx_approvals_pending ON approvals(id) WHERE status = 'pending';
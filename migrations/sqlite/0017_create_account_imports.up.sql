@@ -0,0 +1,19 @@
+-- Bulk imports of existing deposits queued with async=true. rows holds the
+-- upload; processed_rows and results are saved with every inserted batch so
+-- an import resumed by another worker never loads a row twice.
+CREATE TABLE account_imports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	status VARCHAR(16) NOT NULL DEFAULT 'queued',
+	total_rows INTEGER NOT NULL,
+	processed_rows INTEGER NOT NULL DEFAULT 0,
+	created_rows INTEGER NOT NULL DEFAULT 0,
+	failed_rows INTEGER NOT NULL DEFAULT 0,
+	requested_by VARCHAR(64) NOT NULL DEFAULT '',
+	rows TEXT NOT NULL,
+	results TEXT NOT NULL DEFAULT '[]',
+	lease_until TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP
+);
+
+CREATE INDEX idx_account_imports_open ON account_imports(id) WHERE status IN ('queued', 'running');
@@ -0,0 +1,38 @@
+-- Long-running operations run by the jobs worker. Jobs save their progress as
+-- they go; cancel_requested asks a running job to stop at its next heartbeat.
+CREATE TABLE jobs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type VARCHAR(32) NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'queued',
+	payload TEXT NOT NULL DEFAULT '{}',
+	progress_done INTEGER NOT NULL DEFAULT 0,
+	progress_total INTEGER NOT NULL DEFAULT 0,
+	result TEXT,
+	error TEXT,
+	cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	requested_by VARCHAR(64) NOT NULL DEFAULT '',
+	lease_until TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	started_at TIMESTAMP,
+	completed_at TIMESTAMP
+);
+
+CREATE INDEX idx_jobs_open ON jobs(id) WHERE status IN ('queued', 'running');
+
+-- Async bulk imports are now loaded by a job instead of being claimed by the
+-- imports worker. Unfinished imports get a job so they are not stranded.
+ALTER TABLE account_imports ADD COLUMN job_id INTEGER REFERENCES jobs(id);
+ALTER TABLE account_imports DROP COLUMN lease_until;
+CREATE UNIQUE INDEX idx_account_imports_job_id ON account_imports(job_id);
+
+INSERT INTO jobs(type, payload, requested_by, created_at)
+SELECT 'account_import', json_object('import_id', id), requested_by, created_at
+FROM account_imports WHERE status IN ('queued', 'running') ORDER BY id;
+
+UPDATE account_imports SET job_id = (
+	SELECT j.id FROM jobs j
+	WHERE j.type = 'account_import' AND json_extract(j.payload, '$.import_id') = account_imports.id)
+WHERE status IN ('queued', 'running');
+
+UPDATE jobs SET payload = '{}' WHERE type = 'account_import';
@@ -0,0 +1,12 @@
+-- Generated operations reports, one per type and business day
+CREATE TABLE reports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type VARCHAR(32) NOT NULL,
+	report_date VARCHAR(10) NOT NULL,
+	summary TEXT NOT NULL,
+	recipients TEXT NOT NULL DEFAULT '', -- comma-separated addresses emailed
+	document_key TEXT,
+	requested_by VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (type, report_date)
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS event_cursors;
+DROP TABLE IF EXISTS notification_preferences;
+DROP INDEX IF EXISTS idx_communications_dedup;
+ALTER TABLE communications DROP COLUMN sent_at;
+ALTER TABLE communications DROP COLUMN last_error;
+ALTER TABLE communications DROP COLUMN dedup_key;
+ALTER TABLE communications DROP COLUMN channel;
@@ -0,0 +1,32 @@
+-- Customer notifications fan out to one communication per channel the user
+-- chose. dedup_key names the event a notification is for (an outbox event ID
+-- or a maturity reminder), so a notice is queued once per channel however
+-- often the source is read.
+ALTER TABLE communications ADD COLUMN channel VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE communications ADD COLUMN dedup_key VARCHAR(128);
+ALTER TABLE communications ADD COLUMN last_error TEXT;
+ALTER TABLE communications ADD COLUMN sent_at TIMESTAMP;
+
+CREATE UNIQUE INDEX idx_communications_dedup
+	ON communications(dedup_key, channel) WHERE dedup_key IS NOT NULL;
+
+CREATE TABLE notification_preferences (
+	user_id INTEGER PRIMARY KEY,
+	channels VARCHAR(64) NOT NULL DEFAULT '', -- comma-separated
+	email VARCHAR(254) NOT NULL DEFAULT '',
+	phone VARCHAR(32) NOT NULL DEFAULT '',
+	reminder_days INTEGER NOT NULL,
+	disabled_events TEXT NOT NULL DEFAULT '', -- comma-separated
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- How far each outbox consumer has read. The notification consumer starts
+-- at the current end of the outbox rather than notifying for past events.
+CREATE TABLE event_cursors (
+	consumer VARCHAR(64) PRIMARY KEY,
+	last_outbox_id INTEGER NOT NULL,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO event_cursors(consumer, last_outbox_id)
+SELECT 'notifications', COALESCE(MAX(id), 0) FROM outbox;
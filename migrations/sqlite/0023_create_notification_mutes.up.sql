@@ -0,0 +1,15 @@
+-- Periods in which an account's bulk notifications are withheld. Rows are
+-- never deleted: a mute runs out by itself at muted_until, ended_at records
+-- one lifted early, and the rows are the audit trail of both.
+CREATE TABLE notification_mutes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL,
+	muted_until TIMESTAMP NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	muted_by VARCHAR(128) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	ended_at TIMESTAMP,
+	ended_by VARCHAR(128)
+);
+
+CREATE INDEX idx_notification_mutes_account_id ON notification_mutes(account_id, muted_until);
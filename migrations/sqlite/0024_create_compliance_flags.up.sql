@@ -0,0 +1,36 @@
+-- Who opened each account and from where, kept for the velocity checks'
+-- window only
+CREATE TABLE account_creations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_account_creations_user_id ON account_creations(user_id, created_at);
+CREATE INDEX idx_account_creations_client_ip ON account_creations(client_ip, created_at);
+CREATE INDEX idx_account_creations_created_at ON account_creations(created_at);
+
+-- Suspicious activity raised by the anomaly detector, queued for compliance
+-- review. Repeats of a rule for the same subject add to the open flag.
+CREATE TABLE compliance_flags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	rule VARCHAR(32) NOT NULL,
+	subject VARCHAR(128) NOT NULL,
+	user_id INTEGER NOT NULL,
+	account_id INTEGER,
+	client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	detail TEXT NOT NULL,
+	action VARCHAR(16) NOT NULL,
+	occurrences INTEGER NOT NULL DEFAULT 1,
+	status VARCHAR(16) NOT NULL DEFAULT 'open',
+	created_at TIMESTAMP NOT NULL,
+	last_seen_at TIMESTAMP NOT NULL,
+	reviewed_by VARCHAR(128),
+	reviewed_at TIMESTAMP,
+	review_note TEXT
+);
+
+CREATE INDEX idx_compliance_flags_open ON compliance_flags(rule, subject) WHERE status = 'open';
+CREATE INDEX idx_compliance_flags_status ON compliance_flags(status, id);
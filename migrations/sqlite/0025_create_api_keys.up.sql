@@ -0,0 +1,19 @@
+-- Keys for service-to-service callers. Only a SHA-256 hash of each key is
+-- kept; prefix is the part of the key it is looked up by. After a rotation
+-- the replaced key keeps working until previous_expires_at.
+CREATE TABLE api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(100) NOT NULL,
+	prefix VARCHAR(16) NOT NULL UNIQUE,
+	key_hash CHAR(64) NOT NULL,
+	scopes VARCHAR(64) NOT NULL,
+	created_by VARCHAR(128) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	rotated_at TIMESTAMP,
+	previous_hash CHAR(64),
+	previous_expires_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	revoked_by VARCHAR(128)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE outbox DROP COLUMN aggregate_key;
+DROP TABLE IF EXISTS account_ids;
+DROP INDEX IF EXISTS idx_block_accounts_external_id;
+ALTER TABLE block_accounts DROP COLUMN external_id;
@@ -0,0 +1,29 @@
+-- External IDs name accounts in the API and events; the serial id stays
+-- internal. Accounts opened before this migration get a random UUID.
+ALTER TABLE block_accounts ADD COLUMN external_id VARCHAR(36) NOT NULL DEFAULT '';
+UPDATE block_accounts SET external_id = lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' ||
+	substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+	substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))
+WHERE external_id = '';
+CREATE UNIQUE INDEX idx_block_accounts_external_id ON block_accounts(external_id);
+
+-- account_ids keeps every account's external ID after the account is
+-- deleted, so the communications, agreements and payouts that outlive it
+-- can still be looked up and reported by it
+CREATE TABLE account_ids (
+	account_id INTEGER PRIMARY KEY,
+	external_id VARCHAR(36) NOT NULL UNIQUE
+);
+INSERT INTO account_ids(account_id, external_id) SELECT id, external_id FROM block_accounts;
+-- Accounts already deleted get one too, for the records they left behind
+INSERT INTO account_ids(account_id, external_id)
+SELECT account_id, lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' ||
+	substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+	substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))
+FROM (SELECT account_id FROM communications UNION SELECT account_id FROM account_agreements
+      UNION SELECT account_id FROM payouts)
+WHERE account_id NOT IN (SELECT account_id FROM account_ids);
+
+-- The broker message key: the account's external ID. Empty for events
+-- queued before this migration, which are keyed by aggregate_id.
+ALTER TABLE outbox ADD COLUMN aggregate_key VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN region;
+DROP TABLE IF EXISTS region_state;
@@ -0,0 +1,14 @@
+-- region_state names the region whose workers may run. Its single row is
+-- written by a failover; epoch counts failovers so a promotion requested
+-- against a stale view of the state is refused. Without a row every region
+-- is active, as a single-region deployment is.
+CREATE TABLE region_state (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	active_region VARCHAR(64) NOT NULL,
+	epoch INTEGER NOT NULL,
+	promoted_at TIMESTAMP NOT NULL,
+	promoted_by VARCHAR(128) NOT NULL
+);
+
+-- Jobs pinned to a region, such as a failover, are only run by its workers
+ALTER TABLE jobs ADD COLUMN region VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- deployment records whether the database belongs to a sandbox. Its single
+-- row is written by the first server or worker to start against the
+-- database; a sandbox's accelerated clock and fake funding must never run on
+-- production data, nor production on sandbox data.
+CREATE TABLE deployment (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	sandbox BOOLEAN NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,24 @@
+-- Corrections to the interest of an account, each approved by a second staff
+-- member. A recalculation re-derives the rate from the rate plan and credits
+-- or debits the difference on interest already paid; a manual adjustment
+-- credits or debits an amount. block_accounts.interest_adjustment is their
+-- net, paid with the interest at maturity. Rows outlive the account, like
+-- its status history.
+ALTER TABLE block_accounts ADD COLUMN interest_adjustment DECIMAL(15,2) NOT NULL DEFAULT 0;
+ALTER TABLE approvals ADD COLUMN adjustment DECIMAL(15,2) NOT NULL DEFAULT 0;
+
+CREATE TABLE interest_adjustments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL,
+	kind VARCHAR(16) NOT NULL,
+	amount DECIMAL(15,2) NOT NULL,
+	previous_rate DECIMAL(5,4) NOT NULL,
+	rate DECIMAL(5,4) NOT NULL,
+	reason TEXT NOT NULL,
+	approval_id INTEGER NOT NULL,
+	requested_by VARCHAR(64) NOT NULL,
+	approved_by VARCHAR(64) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_interest_adjustments_account ON interest_adjustments(account_id, id);
@@ -0,0 +1,54 @@
+CREATE TABLE notification_preferences_old (
+	user_id INTEGER PRIMARY KEY,
+	channels VARCHAR(64) NOT NULL DEFAULT '', -- comma-separated
+	email VARCHAR(254) NOT NULL DEFAULT '',
+	phone VARCHAR(32) NOT NULL DEFAULT '',
+	reminder_days INTEGER NOT NULL,
+	disabled_events TEXT NOT NULL DEFAULT '', -- comma-separated
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO notification_preferences_old(user_id, channels, email, phone, reminder_days, disabled_events, updated_at)
+SELECT user_id, channels, email, phone, reminder_days, disabled_events, updated_at FROM notification_preferences
+WHERE tenant_id = 'default';
+DROP TABLE notification_preferences;
+ALTER TABLE notification_preferences_old RENAME TO notification_preferences;
+
+CREATE TABLE account_limits_old (
+	rule VARCHAR(32) NOT NULL,
+	period VARCHAR(16) NOT NULL DEFAULT '',
+	value DECIMAL(15,2) NOT NULL CHECK (value > 0),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (rule, period)
+);
+INSERT INTO account_limits_old(rule, period, value, updated_by, updated_at)
+SELECT rule, period, value, updated_by, updated_at FROM account_limits WHERE tenant_id = 'default';
+DROP TABLE account_limits;
+ALTER TABLE account_limits_old RENAME TO account_limits;
+
+CREATE TABLE product_gates_old (
+	product VARCHAR(16) PRIMARY KEY,
+	allowed_user_ids TEXT NOT NULL DEFAULT '',
+	rollout_percent INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percent BETWEEN 0 AND 100),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO product_gates_old(product, allowed_user_ids, rollout_percent, updated_by, updated_at)
+SELECT product, allowed_user_ids, rollout_percent, updated_by, updated_at FROM product_gates WHERE tenant_id = 'default';
+DROP TABLE product_gates;
+ALTER TABLE product_gates_old RENAME TO product_gates;
+
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+ALTER TABLE account_creations DROP COLUMN tenant_id;
+ALTER TABLE jobs DROP COLUMN tenant_id;
+ALTER TABLE account_imports DROP COLUMN tenant_id;
+ALTER TABLE impersonation_sessions DROP COLUMN tenant_id;
+ALTER TABLE compliance_flags DROP COLUMN tenant_id;
+ALTER TABLE approvals DROP COLUMN tenant_id;
+ALTER TABLE webhooks DROP COLUMN tenant_id;
+ALTER TABLE outbox DROP COLUMN tenant_id;
+ALTER TABLE account_ids DROP COLUMN tenant_id;
+DROP INDEX IF EXISTS idx_block_accounts_tenant_user;
+ALTER TABLE block_accounts DROP COLUMN tenant_id;
+DROP TABLE IF EXISTS tenant_rates;
+DROP TABLE IF EXISTS tenants;
@@ -0,0 +1,81 @@
+-- Tenants share one database. Every account, and everything configured or
+-- requested for it, belongs to one tenant, and reads made for a tenant only
+-- see its rows. Rows from before tenants belong to the default tenant. Rows
+-- keyed by account (payouts, communications, status history and the like)
+-- belong to their account's tenant. API keys with an empty tenant_id are
+-- platform keys, which may act for any tenant.
+CREATE TABLE tenants (
+	id VARCHAR(64) PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO tenants(id, name) VALUES ('default', 'Default');
+
+-- A tenant's rate plan: the rates it sets in place of a period's built-in rate
+CREATE TABLE tenant_rates (
+	tenant_id VARCHAR(64) NOT NULL,
+	period VARCHAR(16) NOT NULL,
+	rate DECIMAL(5,4) NOT NULL CHECK (rate >= 0 AND rate < 1),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (tenant_id, period)
+);
+
+ALTER TABLE block_accounts ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX idx_block_accounts_tenant_user ON block_accounts(tenant_id, user_id);
+ALTER TABLE account_ids ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE outbox ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE webhooks ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE approvals ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE compliance_flags ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE impersonation_sessions ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE account_imports ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE jobs ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE account_creations ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Product gates, limits and notification preferences are set per tenant,
+-- which SQLite can only add to a primary key by rebuilding the table
+CREATE TABLE product_gates_new (
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	product VARCHAR(16) NOT NULL,
+	allowed_user_ids TEXT NOT NULL DEFAULT '',
+	rollout_percent INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percent BETWEEN 0 AND 100),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (tenant_id, product)
+);
+INSERT INTO product_gates_new(product, allowed_user_ids, rollout_percent, updated_by, updated_at)
+SELECT product, allowed_user_ids, rollout_percent, updated_by, updated_at FROM product_gates;
+DROP TABLE product_gates;
+ALTER TABLE product_gates_new RENAME TO product_gates;
+
+CREATE TABLE account_limits_new (
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	rule VARCHAR(32) NOT NULL,
+	period VARCHAR(16) NOT NULL DEFAULT '',
+	value DECIMAL(15,2) NOT NULL CHECK (value > 0),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (tenant_id, rule, period)
+);
+INSERT INTO account_limits_new(rule, period, value, updated_by, updated_at)
+SELECT rule, period, value, updated_by, updated_at FROM account_limits;
+DROP TABLE account_limits;
+ALTER TABLE account_limits_new RENAME TO account_limits;
+
+CREATE TABLE notification_preferences_new (
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	user_id INTEGER NOT NULL,
+	channels VARCHAR(64) NOT NULL DEFAULT '', -- comma-separated
+	email VARCHAR(254) NOT NULL DEFAULT '',
+	phone VARCHAR(32) NOT NULL DEFAULT '',
+	reminder_days INTEGER NOT NULL,
+	disabled_events TEXT NOT NULL DEFAULT '', -- comma-separated
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (tenant_id, user_id)
+);
+INSERT INTO notification_preferences_new(user_id, channels, email, phone, reminder_days, disabled_events, updated_at)
+SELECT user_id, channels, email, phone, reminder_days, disabled_events, updated_at FROM notification_preferences;
+DROP TABLE notification_preferences;
+ALTER TABLE notification_preferences_new RENAME TO notification_preferences;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_outbox_user;
+ALTER TABLE outbox DROP COLUMN user_id;
@@ -0,0 +1,5 @@
+-- The account event stream reads one user's events in outbox order. The
+-- user is kept on the event itself because closed accounts are deleted.
+ALTER TABLE outbox ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0;
+UPDATE outbox SET user_id = COALESCE(json_extract(payload, '$.account.user_id'), 0);
+CREATE INDEX IF NOT EXISTS idx_outbox_user ON outbox(tenant_id, user_id, id);
@@ -0,0 +1,16 @@
+-- Workers that must run on one replica at a time take a lease here before
+-- each run. A lease that is not renewed lapses at expires_at, so a replica
+-- that dies hands the work to another.
+CREATE TABLE IF NOT EXISTS worker_leases (
+	worker VARCHAR(64) PRIMARY KEY,
+	holder VARCHAR(255) NOT NULL,
+	acquired_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+-- A maturity payout is keyed by the account and the end date it matured on,
+-- so an account can't be paid out twice for one maturity
+ALTER TABLE payouts ADD COLUMN maturity_date TIMESTAMP;
+UPDATE payouts SET maturity_date = (SELECT end_date FROM block_accounts WHERE block_accounts.id = payouts.account_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payouts_maturity ON payouts(account_id, maturity_date)
+	WHERE maturity_date IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Composite indexes for the filtered listings, led by tenant_id since every
+-- query is scoped to the caller's tenant:
+-- the maturing listing and its totals read active accounts by end date
+CREATE INDEX IF NOT EXISTS idx_block_accounts_tenant_maturing
+	ON block_accounts(tenant_id, end_date) WHERE status = 'active';
+-- the analytics export pages through a tenant's accounts in (updated_at, id) order
+CREATE INDEX IF NOT EXISTS idx_block_accounts_tenant_updated_at
+	ON block_accounts(tenant_id, updated_at, id);
+-- the approval queue and flagged activity list newest first, by status
+CREATE INDEX IF NOT EXISTS idx_approvals_tenant_status ON approvals(tenant_id, status, id);
+CREATE INDEX IF NOT EXISTS idx_compliance_flags_tenant_status ON compliance_flags(tenant_id, status, id);
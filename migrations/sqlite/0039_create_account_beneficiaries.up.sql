@@ -0,0 +1,14 @@
+-- account_beneficiaries names who a term deposit passes to. An account's
+-- beneficiaries are designated as a set whose allocations add up to 100%,
+-- in the order of position. They go with their account, and carry over to
+-- its rollover. name and relationship are free text about third parties.
+CREATE TABLE account_beneficiaries (
+	account_id INTEGER NOT NULL REFERENCES block_accounts(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	relationship TEXT NOT NULL,
+	allocation_percent DECIMAL(5,2) NOT NULL CHECK (allocation_percent > 0 AND allocation_percent <= 100),
+	designated_by VARCHAR(64) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (account_id, position)
+);
@@ -0,0 +1,16 @@
+-- archived_accounts keeps closed accounts whose retention period ran out,
+-- after the retention worker purged them from the live tables. record is
+-- the account, its history, holders and beneficiaries as JSON, encrypted
+-- when field encryption is enabled. external_id and tenant_id are copied
+-- from account_ids, which keeps resolving the account's external ID.
+CREATE TABLE archived_accounts (
+	account_id INTEGER PRIMARY KEY,
+	external_id VARCHAR(36) NOT NULL,
+	tenant_id VARCHAR(64) NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	closed_at TIMESTAMP NOT NULL,
+	archived_at TIMESTAMP NOT NULL,
+	record TEXT NOT NULL
+);
+
+CREATE INDEX idx_archived_accounts_tenant ON archived_accounts(tenant_id, archived_at);
@@ -0,0 +1,27 @@
+-- reconciliation_breaks records accounts whose balance by their ledger,
+-- principal + posted interest - payouts, differs from the balance their
+-- stored fields give, found by the nightly reconciliation. An account has
+-- at most one unresolved break, which later runs update; it resolves once a
+-- run finds the account in balance. Staff acknowledge breaks they are
+-- working on.
+CREATE TABLE reconciliation_breaks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL,
+	tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+	principal DECIMAL(15,2) NOT NULL,
+	posted_interest DECIMAL(15,2) NOT NULL,
+	paid_out DECIMAL(15,2) NOT NULL,
+	ledger_balance DECIMAL(15,2) NOT NULL,
+	stored_balance DECIMAL(15,2) NOT NULL,
+	status VARCHAR(16) NOT NULL DEFAULT 'open',
+	occurrences INTEGER NOT NULL DEFAULT 1,
+	detected_at TIMESTAMP NOT NULL,
+	last_seen_at TIMESTAMP NOT NULL,
+	acknowledged_by VARCHAR(128),
+	acknowledged_at TIMESTAMP,
+	note TEXT,
+	resolved_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_reconciliation_breaks_unresolved ON reconciliation_breaks(account_id) WHERE status <> 'resolved';
+CREATE INDEX idx_reconciliation_breaks_status ON reconciliation_breaks(status, id);
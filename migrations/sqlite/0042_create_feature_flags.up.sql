@@ -0,0 +1,12 @@
+-- feature_flags overrides FEATURE_FLAGS and the built-in defaults for a
+-- feature: it is on for everyone when enabled, otherwise for the listed
+-- tenants plus a stable percentage of other traffic. Flags span tenants, so
+-- the table is not scoped to one.
+CREATE TABLE feature_flags (
+	name VARCHAR(64) PRIMARY KEY,
+	enabled BOOLEAN NOT NULL DEFAULT 0,
+	tenants TEXT NOT NULL DEFAULT '',
+	rollout_percent INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percent BETWEEN 0 AND 100),
+	updated_by VARCHAR(64) NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE deployment DROP COLUMN clock_offset_ms;
@@ -0,0 +1,3 @@
+-- A sandbox's clock runs ahead of real time by clock_offset_ms once QA
+-- advances it; servers and workers of the deployment all read it here.
+ALTER TABLE deployment ADD COLUMN clock_offset_ms INTEGER NOT NULL DEFAULT 0;
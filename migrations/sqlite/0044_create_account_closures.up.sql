@@ -0,0 +1,12 @@
+-- account_closures holds the settlement instructions given when a holder
+-- closes an account: where the final payout goes, how, and how much it is.
+-- The account is closing from requested_at until the payout is confirmed
+-- sent, when closed_at is set and the account becomes closed.
+CREATE TABLE account_closures (
+	account_id INTEGER PRIMARY KEY REFERENCES block_accounts(id) ON DELETE CASCADE,
+	destination_account VARCHAR(64) NOT NULL,
+	method VARCHAR(20) NOT NULL,
+	amount DECIMAL(15,2) NOT NULL,
+	requested_at TIMESTAMP NOT NULL,
+	closed_at TIMESTAMP
+);
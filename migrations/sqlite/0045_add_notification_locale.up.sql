@@ -0,0 +1,3 @@
+-- The language a customer's notices are written in; blank until they
+-- choose one, when DEFAULT_LOCALE applies.
+ALTER TABLE notification_preferences ADD COLUMN locale TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE approvals DROP COLUMN value_date;
+ALTER TABLE interest_adjustments DROP COLUMN value_date;
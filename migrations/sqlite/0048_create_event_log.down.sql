@@ -0,0 +1,4 @@
+DROP VIEW IF EXISTS events;
+DROP INDEX IF EXISTS idx_outbox_aggregate_key;
+DROP TRIGGER IF EXISTS outbox_events_undeletable;
+DROP TRIGGER IF EXISTS outbox_events_immutable;
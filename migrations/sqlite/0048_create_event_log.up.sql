@@ -0,0 +1,24 @@
+-- The outbox is the domain event log: every account event is written to it
+-- in the transaction that made the change, numbered by its id. The relay
+-- only marks events published, so an event's content can never change and
+-- no event is ever deleted.
+CREATE TRIGGER IF NOT EXISTS outbox_events_immutable
+BEFORE UPDATE OF event_id, aggregate_id, aggregate_key, event_type, schema_version, payload, tenant_id, user_id, created_at
+ON outbox
+BEGIN
+	SELECT RAISE(ABORT, 'outbox events are append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS outbox_events_undeletable
+BEFORE DELETE ON outbox
+BEGIN
+	SELECT RAISE(ABORT, 'outbox events are append-only');
+END;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_aggregate_key ON outbox(aggregate_key, id);
+
+-- events is the log as consumers read it, without the relay's bookkeeping
+CREATE VIEW IF NOT EXISTS events AS
+SELECT id AS sequence, event_id, event_type, schema_version, aggregate_id, aggregate_key, tenant_id, user_id,
+	payload, created_at AS occurred_at
+FROM outbox;
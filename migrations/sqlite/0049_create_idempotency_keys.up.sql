@@ -0,0 +1,11 @@
+-- idempotency_keys remembers the account each Idempotency-Key opened, so a
+-- repeated create replays that account instead of opening another. A key
+-- stored more than a day ago is taken over by the next create that sends it.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	tenant_id VARCHAR(64) NOT NULL,
+	idempotency_key VARCHAR(255) NOT NULL,
+	fingerprint CHAR(64) NOT NULL,
+	account_id INTEGER NOT NULL REFERENCES block_accounts(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (tenant_id, idempotency_key)
+);
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// MaxPrincipal is the largest principal an account can be opened or rolled
+// over with. Principal plus three years of interest at any rate below 100%
+// stays under maxStoredMoney, and so within maxExactMoney.
+const MaxPrincipal = 1_000_000_000_000
+
+// maxStoredMoney is the largest amount the DECIMAL(15,2) money columns hold
+const maxStoredMoney = 9_999_999_999_999.99
+
+// maxExactMoney is the largest amount a float64 holds to the exact cent.
+// Above 2^53 cents consecutive cents are no longer distinct, so sums and
+// products silently drop or invent cents.
+const maxExactMoney = float64(maxExactCents) / 100
+
+// maxExactCents is maxExactMoney in whole cents
+const maxExactCents = 1 << 53
+
+// ErrMoneyOverflow is returned when an amount is beyond maxExactMoney
+var ErrMoneyOverflow = newAPIError(CodeAmountTooLarge, "amount is too large to be held to the cent")
+
+// validatePrincipal checks a requested principal is positive, finite and at
+// most MaxPrincipal
+func validatePrincipal(principal float64) error {
+	if math.IsNaN(principal) || principal <= 0 {
+		return newAPIError(CodeInvalidAmount, "principal must be positive")
+	}
+	if principal > MaxPrincipal {
+		return newAPIError(CodeAmountTooLarge, fmt.Sprintf("principal must be at most %.2f", float64(MaxPrincipal)))
+	}
+	return nil
+}
+
+// toCents converts amount to whole cents, failing when it is not finite or
+// is beyond maxExactMoney
+func toCents(amount float64) (int64, error) {
+	if math.IsNaN(amount) || math.Abs(amount) > maxExactMoney {
+		return 0, ErrMoneyOverflow
+	}
+	return int64(math.Round(amount * 100)), nil
+}
+
+// fromCents converts whole cents back to an amount
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// addMoney returns a+b rounded to the cent. The sum is taken in whole cents,
+// so it is exact, and fails rather than losing cents when an operand or the
+// result is beyond maxExactMoney.
+func addMoney(a, b float64) (float64, error) {
+	ac, err := toCents(a)
+	if err != nil {
+		return 0, err
+	}
+	bc, err := toCents(b)
+	if err != nil {
+		return 0, err
+	}
+	sum := ac + bc
+	if sum > maxExactCents || sum < -maxExactCents {
+		return 0, ErrMoneyOverflow
+	}
+	return fromCents(sum), nil
+}
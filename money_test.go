@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestValidatePrincipal(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal float64
+		ok        bool
+	}{
+		{"smallest", 0.01, true},
+		{"maximum", MaxPrincipal, true},
+		{"maximum with cents", MaxPrincipal - 0.01, true},
+		{"a cent over the maximum", MaxPrincipal + 0.01, false},
+		{"beyond exact cents", maxExactMoney * 2, false},
+		{"zero", 0, false},
+		{"negative", -1, false},
+		{"NaN", math.NaN(), false},
+		{"infinity", math.Inf(1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePrincipal(tt.principal)
+			if (err == nil) != tt.ok {
+				t.Errorf("validatePrincipal(%v) = %v, want ok=%v", tt.principal, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateCreateRequestBoundsPrincipal(t *testing.T) {
+	req := CreateAccountRequest{UserID: 1, Principal: MaxPrincipal, Period: "3y"}
+	if err := validateRequest(&req); err != nil {
+		t.Fatalf("principal at the maximum rejected: %v", err)
+	}
+	req.Principal = MaxPrincipal * 10
+	if err := validateRequest(&req); err == nil {
+		t.Fatal("principal above the maximum accepted")
+	}
+}
+
+func TestAddMoney(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b float64
+		want float64
+		ok   bool
+	}{
+		{"cents", 0.1, 0.2, 0.3, true},
+		{"maximum principal and a cent", MaxPrincipal, 0.01, 1_000_000_000_000.01, true},
+		{"up to the exact limit", maxExactMoney - 0.01, 0.01, maxExactMoney, true},
+		{"past the exact limit", maxExactMoney, 0.01, 0, false},
+		{"operand past the exact limit", maxExactMoney * 2, -maxExactMoney, 0, false},
+		{"NaN", math.NaN(), 1, 0, false},
+		{"infinity", math.Inf(1), 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addMoney(tt.a, tt.b)
+			if (err == nil) != tt.ok {
+				t.Fatalf("addMoney(%v, %v) error = %v, want ok=%v", tt.a, tt.b, err, tt.ok)
+			}
+			if tt.ok && got != tt.want {
+				t.Errorf("addMoney(%v, %v) = %.2f, want %.2f", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFloatLosesCentsPastExactLimit pins down why the bound exists: past
+// 2^53 cents a float64 can no longer tell neighbouring cents apart
+func TestFloatLosesCentsPastExactLimit(t *testing.T) {
+	cents := float64(1 << 53)
+	if cents+1 != cents {
+		t.Fatal("expected float64 to drop a cent at 2^53 cents")
+	}
+	if MaxPrincipal*100 >= cents || maxStoredMoney >= maxExactMoney {
+		t.Fatal("money bounds must stay below the exact float64 range")
+	}
+}
+
+func TestPlanMaturityAtMaximumPrincipal(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	account := &BlockAccount{
+		ID:                  1,
+		Principal:           MaxPrincipal,
+		StartDate:           start,
+		EndDate:             start.AddDate(3, 0, 0),
+		InterestRate:        0.99,
+		Period:              "3y",
+		Status:              StatusActive,
+		MaturityInstruction: InstructionPayout,
+		PayoutFrequency:     FrequencyAtMaturity,
+	}
+
+	outcome, err := planMaturity(account)
+	if err != nil {
+		t.Fatalf("planMaturity: %v", err)
+	}
+	amount := outcome.Payout.Amount
+	if amount > maxStoredMoney {
+		t.Errorf("maturity value %.2f does not fit the money columns (max %.2f)", amount, maxStoredMoney)
+	}
+	cents, err := toCents(amount)
+	if err != nil {
+		t.Fatalf("toCents(%.2f): %v", amount, err)
+	}
+	if fromCents(cents) != amount {
+		t.Errorf("maturity value %.2f is not a whole number of cents", amount)
+	}
+	days := account.EndDate.Sub(account.StartDate).Hours() / 24
+	want := roundMoney(MaxPrincipal + MaxPrincipal*0.99*days/daysPerYear)
+	if amount != want {
+		t.Errorf("maturity value = %.2f, want %.2f", amount, want)
+	}
+}
+
+func TestPlanMaturityPaysOutRolloverAboveMaximum(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	account := &BlockAccount{
+		ID:                  1,
+		Principal:           MaxPrincipal,
+		StartDate:           start,
+		EndDate:             start.AddDate(1, 0, 0),
+		InterestRate:        0.05,
+		Period:              "1y",
+		Status:              StatusActive,
+		MaturityInstruction: InstructionRollover,
+		PayoutFrequency:     FrequencyAtMaturity,
+	}
+
+	outcome, err := planMaturity(account)
+	if err != nil {
+		t.Fatalf("planMaturity: %v", err)
+	}
+	if outcome.Rollover != nil || outcome.Payout == nil {
+		t.Fatalf("rollover above MaxPrincipal was not paid out: %+v", outcome)
+	}
+
+	account.Principal = 1000
+	if outcome, err = planMaturity(account); err != nil || outcome.Rollover == nil {
+		t.Fatalf("ordinary rollover not rolled over: %+v, %v", outcome, err)
+	}
+}
+
+func TestExceedsTotal(t *testing.T) {
+	if exceedsTotal(MaxPrincipal, MaxPrincipal, 2*MaxPrincipal) {
+		t.Error("total equal to the limit reported as above it")
+	}
+	if !exceedsTotal(MaxPrincipal, 0.01, MaxPrincipal) {
+		t.Error("total a cent over the limit not reported")
+	}
+	if !exceedsTotal(maxExactMoney, MaxPrincipal, math.MaxFloat64) {
+		t.Error("total beyond exact cents not reported as above the limit")
+	}
+}
+
+func TestValidateAccountLimitRequestBounds(t *testing.T) {
+	if err := validateAccountLimitRequest(RuleMaxPrincipal, &AccountLimitRequest{Period: "1y", Value: MaxPrincipal}); err != nil {
+		t.Errorf("max_principal at MaxPrincipal rejected: %v", err)
+	}
+	if err := validateAccountLimitRequest(RuleMaxPrincipal, &AccountLimitRequest{Period: "1y", Value: MaxPrincipal + 1}); err == nil {
+		t.Error("max_principal above MaxPrincipal accepted")
+	}
+	if err := validateAccountLimitRequest(RuleMaxTotalPrincipal, &AccountLimitRequest{Value: maxExactMoney * 2}); err == nil {
+		t.Error("max_total_principal beyond exact cents accepted")
+	}
+	if err := validateAccountLimitRequest(RuleMaxTotalPrincipal, &AccountLimitRequest{Value: math.NaN()}); err == nil {
+		t.Error("NaN limit accepted")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// notificationChannelTimeout bounds one SMS or webhook notification call
+const notificationChannelTimeout = 10 * time.Second
+
+// Notification channels are called this way unless their SMS_* or
+// NOTIFY_WEBHOOK_* settings say otherwise. Webhook calls carry their
+// delivery ID for the receiver to drop repeats, so they are retried; a text
+// message is sent once unless SMS_MAX_ATTEMPTS allows more.
+var (
+	smsDefaults = ResiliencePolicy{Timeout: notificationChannelTimeout, MaxAttempts: 1, Backoff: 500 * time.Millisecond,
+		BreakerThreshold: 5, BreakerCooldown: time.Minute}
+	notifyWebhookDefaults = ResiliencePolicy{Timeout: notificationChannelTimeout, MaxAttempts: 3, Backoff: 500 * time.Millisecond,
+		BreakerThreshold: 5, BreakerCooldown: time.Minute}
+)
+
+// ErrChannelUnavailable is returned when a customer picks a notification
+// channel this deployment has not configured
+var ErrChannelUnavailable = newAPIError(CodeChannelUnavailable, "notification channel is not configured")
+
+// NotificationChannel delivers a rendered notification to a customer using
+// the contact details in their preferences
+type NotificationChannel interface {
+	Deliver(ctx context.Context, c *Communication, prefs *NotificationPreferences) error
+}
+
+// SMSProvider sends text messages through an SMS gateway
+type SMSProvider interface {
+	SendSMS(ctx context.Context, to, message string) error
+}
+
+// newNotificationChannels returns the channels that are configured, keyed by
+// name. mailer, sms and hook are each nil when their channel is disabled.
+func newNotificationChannels(mailer Mailer, sms SMSProvider, hook NotificationChannel) map[string]NotificationChannel {
+	channels := make(map[string]NotificationChannel)
+	if mailer != nil {
+		channels[NotifyEmail] = &emailChannel{mailer: mailer}
+	}
+	if sms != nil {
+		channels[NotifySMS] = &smsChannel{provider: sms}
+	}
+	if hook != nil {
+		channels[NotifyWebhook] = hook
+	}
+	return channels
+}
+
+// emailChannel sends notifications to the customer's email address
+type emailChannel struct {
+	mailer Mailer
+}
+
+func (ch *emailChannel) Deliver(ctx context.Context, c *Communication, prefs *NotificationPreferences) error {
+	if prefs.Email == "" {
+		return fmt.Errorf("no email address for user %d", c.UserID)
+	}
+	return ch.mailer.Send(ctx, []string{prefs.Email}, c.Subject, c.Message)
+}
+
+// smsChannel texts the message, without the subject, to the customer's phone
+type smsChannel struct {
+	provider SMSProvider
+}
+
+func (ch *smsChannel) Deliver(ctx context.Context, c *Communication, prefs *NotificationPreferences) error {
+	if prefs.Phone == "" {
+		return fmt.Errorf("no phone number for user %d", c.UserID)
+	}
+	return ch.provider.SendSMS(ctx, prefs.Phone, c.Message)
+}
+
+// newSMSProvider returns an HTTP SMS gateway for SMS_PROVIDER_URL, or nil
+// when SMS is disabled
+func newSMSProvider() (SMSProvider, error) {
+	endpoint := os.Getenv("SMS_PROVIDER_URL")
+	if endpoint == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("SMS_PROVIDER_URL must be an absolute http or https URL")
+	}
+	dep, err := newDependency(DependencySMS, smsDefaults)
+	if err != nil {
+		return nil, err
+	}
+	return &httpSMSProvider{
+		endpoint: endpoint,
+		token:    os.Getenv("SMS_PROVIDER_TOKEN"),
+		from:     os.Getenv("SMS_FROM"),
+		client:   &http.Client{},
+		dep:      dep,
+	}, nil
+}
+
+// httpSMSProvider POSTs {"to", "from", "message"} as JSON to a gateway,
+// authenticating with a bearer token when one is set. Any 2xx is taken as
+// accepted for delivery.
+type httpSMSProvider struct {
+	endpoint string
+	token    string
+	from     string
+	client   *http.Client
+	dep      *dependency
+}
+
+func (p *httpSMSProvider) SendSMS(ctx context.Context, to, message string) error {
+	body, err := json.Marshal(map[string]string{"to": to, "from": p.from, "message": message})
+	if err != nil {
+		return err
+	}
+	return p.dep.call(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if p.token != "" {
+			req.Header.Set("Authorization", "Bearer "+p.token)
+		}
+		return doNotificationRequest(p.client, req)
+	})
+}
+
+// newNotificationWebhook returns the webhook channel for NOTIFY_WEBHOOK_URL,
+// or nil when notifications are not posted to a webhook. Calls are signed
+// with NOTIFY_WEBHOOK_SECRET the same way as account webhooks.
+func newNotificationWebhook() (NotificationChannel, error) {
+	endpoint := os.Getenv("NOTIFY_WEBHOOK_URL")
+	if endpoint == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL must be an absolute http or https URL")
+	}
+	secret := os.Getenv("NOTIFY_WEBHOOK_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("NOTIFY_WEBHOOK_SECRET is required when NOTIFY_WEBHOOK_URL is set")
+	}
+	dep, err := newDependency(DependencyNotifyWebhook, notifyWebhookDefaults)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookChannel{endpoint: endpoint, secret: secret, client: &http.Client{}, dep: dep}, nil
+}
+
+// webhookChannel posts notifications to a messaging service, such as a push
+// or in-app inbox, which knows how to reach the customer
+type webhookChannel struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+	dep      *dependency
+}
+
+// notificationWebhookPayload is the body of a notification webhook call
+type notificationWebhookPayload struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	AccountID string    `json:"account_id"`
+	Event     string    `json:"event"`
+	Priority  string    `json:"priority"`
+	Subject   string    `json:"subject"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ch *webhookChannel) Deliver(ctx context.Context, c *Communication, _ *NotificationPreferences) error {
+	body, err := json.Marshal(notificationWebhookPayload{
+		ID:        c.ID,
+		UserID:    c.UserID,
+		AccountID: c.AccountExternalID,
+		Event:     c.Event,
+		Priority:  c.Priority,
+		Subject:   c.Subject,
+		Message:   c.Message,
+		CreatedAt: c.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	return ch.dep.call(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		// Each attempt is signed afresh, so a retry is not refused as stale
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "block-account-webhooks/1")
+		req.Header.Set(WebhookEventHeader, c.Event)
+		req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(c.ID))
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, signWebhook(ch.secret, timestamp, body))
+		return doNotificationRequest(ch.client, req)
+	})
+}
+
+// doNotificationRequest makes req and fails on anything but a 2xx response.
+// Answers other than 5xx and 429 are permanent.
+func doNotificationRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("unexpected status %s", resp.Status)
+		if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			return permanent(err)
+		}
+		return err
+	}
+	return nil
+}
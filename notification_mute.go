@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxNotificationMute is the longest an account's notifications can be muted for
+const maxNotificationMute = 90 * 24 * time.Hour
+
+// NotificationMute silences an account's bulk notifications until MutedUntil.
+// Mutes are never deleted, so the account's mutes are its audit trail.
+// @Description A period in which an account's non-critical notifications are withheld
+type NotificationMute struct {
+	ID                int       `json:"id" example:"1"`
+	AccountID         int       `json:"-"`
+	AccountExternalID string    `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	MutedUntil        time.Time `json:"muted_until"`
+	Reason            string    `json:"reason,omitempty" example:"Travelling until the end of the month"`
+	// MutedBy is the staff ID that set the mute, or "customer"
+	MutedBy   string    `json:"muted_by" example:"customer"`
+	CreatedAt time.Time `json:"created_at"`
+	// EndedAt is set when the mute was lifted before MutedUntil
+	EndedAt *time.Time `json:"ended_at,omitempty"`
+	EndedBy string     `json:"ended_by,omitempty" example:"customer"`
+}
+
+// MuteNotificationsRequest mutes an account's notifications
+// @Description Request payload for muting an account's notifications
+type MuteNotificationsRequest struct {
+	Until  time.Time `json:"until" example:"2026-11-01T00:00:00Z" validate:"required"`
+	Reason string    `json:"reason,omitempty" example:"Travelling until the end of the month" validate:"max=500"`
+}
+
+// active reports whether the mute silences notifications at now
+func (m *NotificationMute) active(now time.Time) bool {
+	return m.EndedAt == nil && now.Before(m.MutedUntil)
+}
+
+// validateMuteNotificationsRequest validates a mute request
+func validateMuteNotificationsRequest(req *MuteNotificationsRequest, now time.Time) error {
+	if !req.Until.After(now) {
+		return fmt.Errorf("until must be in the future")
+	}
+	if req.Until.Sub(now) > maxNotificationMute {
+		return fmt.Errorf("notifications can be muted for at most %d days", int(maxNotificationMute.Hours()/24))
+	}
+	return nil
+}
+
+// requestActor names who made a request for audit records: the staff ID
+// set by the gateway, or "customer"
+func requestActor(r *http.Request) string {
+	if staffID := strings.TrimSpace(r.Header.Get(StaffIDHeader)); staffID != "" {
+		return staffID
+	}
+	return "customer"
+}
+
+// MuteNotifications mutes the account's notifications until req.Until,
+// replacing any mute in effect. It returns nil when the account does not exist.
+func (s *service) MuteNotifications(ctx context.Context, accountID int, actor string, req *MuteNotificationsRequest) (*NotificationMute, error) {
+	account, err := s.repo.GetAccount(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+
+	mute, err := s.repo.MuteNotifications(ctx, &NotificationMute{
+		AccountID:  accountID,
+		MutedUntil: req.Until.UTC(),
+		Reason:     strings.TrimSpace(req.Reason),
+		MutedBy:    actor,
+	}, time.Now().UTC())
+	if err != nil {
+		s.log(ctx).Error("Failed to mute notifications", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	s.log(ctx).Info("Notifications muted", zap.Int("accountID", accountID),
+		zap.Time("until", mute.MutedUntil), zap.String("by", actor))
+	return mute, nil
+}
+
+// UnmuteNotifications lifts the account's mute before it runs out. It
+// returns nil when no mute is in effect.
+func (s *service) UnmuteNotifications(ctx context.Context, accountID int, actor string) (*NotificationMute, error) {
+	mute, err := s.repo.UnmuteNotifications(ctx, accountID, time.Now().UTC(), actor)
+	if err != nil {
+		s.log(ctx).Error("Failed to unmute notifications", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	if mute != nil {
+		s.log(ctx).Info("Notifications unmuted", zap.Int("accountID", accountID), zap.String("by", actor))
+	}
+	return mute, nil
+}
+
+// GetNotificationMutes returns every mute set on the account, newest first
+func (s *service) GetNotificationMutes(ctx context.Context, accountID int) ([]*NotificationMute, error) {
+	mutes, err := s.repo.ListNotificationMutes(ctx, accountID)
+	if err != nil {
+		s.log(ctx).Error("Failed to list notification mutes", zap.Error(err), zap.Int("accountID", accountID))
+		return nil, err
+	}
+	if mutes == nil {
+		mutes = []*NotificationMute{}
+	}
+	return mutes, nil
+}
+
+// accountMuted reports whether the account's notifications are muted at
+// now. Answers are kept in cache for the rest of a batch.
+func (s *service) accountMuted(ctx context.Context, accountID int, now time.Time, cache map[int]bool) (bool, error) {
+	if muted, ok := cache[accountID]; ok {
+		return muted, nil
+	}
+	mute, err := s.repo.ActiveNotificationMute(ctx, accountID, now)
+	if err != nil {
+		return false, err
+	}
+	cache[accountID] = mute != nil
+	return mute != nil, nil
+}
+
+// muteNotificationsHandler godoc
+// @Summary Mute an account's notifications
+// @Description Withholds the account's non-critical notifications, such as maturity reminders, until the given time (at most 90 days ahead), replacing any mute in effect. Critical notices about maturity instructions and payouts are still sent. The mute lifts by itself and is kept as an audit record.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param mute body MuteNotificationsRequest true "Mute period"
+// @Success 200 {object} NotificationMute
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/notification-mute [put]
+func muteNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	var req MuteNotificationsRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if err := validateMuteNotificationsRequest(&req, time.Now()); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	mute, err := svc.MuteNotifications(ctx, id, requestActor(r), &req)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if mute == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+	markWrite(w)
+	writeSuccess(w, r, mute, "Notifications muted successfully")
+}
+
+// unmuteNotificationsHandler godoc
+// @Summary Unmute an account's notifications
+// @Description Lifts the mute in effect on the account before it runs out. Notifications withheld while it was muted are not sent.
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Success 200 {object} NotificationMute
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/notification-mute [delete]
+func unmuteNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	mute, err := svc.UnmuteNotifications(ctx, id, requestActor(r))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if mute == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeNotificationsNotMuted, "Notifications are not muted")
+		return
+	}
+	markWrite(w)
+	writeSuccess(w, r, mute, "Notifications unmuted successfully")
+}
+
+// getNotificationMutesHandler godoc
+// @Summary List an account's notification mutes
+// @Description Every mute set on the account, newest first, with who set it, until when and whether it was lifted early
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]NotificationMute}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/notification-mutes [get]
+func getNotificationMutesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	mutes, err := svc.GetNotificationMutes(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeList(w, r, page, mutes, "Notification mutes retrieved successfully")
+}
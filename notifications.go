@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Notification channels a customer can choose. A notification without a
+// channel goes to the service's Notifier, which is how customers who never
+// set preferences are told.
+const (
+	NotifyEmail   = "email"
+	NotifySMS     = "sms"
+	NotifyWebhook = "webhook"
+)
+
+// EventMaturityReminder is the notice sent the customer's chosen number of
+// days before an account matures
+const EventMaturityReminder = "maturity.reminder"
+
+// notificationConsumer names the notification engine's outbox cursor
+const notificationConsumer = "notifications"
+
+// notificationEventLag keeps the outbox consumer this far behind the newest
+// events. Outbox IDs are handed out before commit, so a transaction that
+// commits late can land behind one already read; the lag gives it time to.
+const notificationEventLag = 10 * time.Second
+
+// Maturity reminder bounds. Customers without preferences are reminded
+// NOTIFY_REMINDER_DAYS before maturity, defaultReminderDays when unset.
+const (
+	defaultReminderDays = 7
+	maxReminderDays     = 90
+)
+
+//go:embed templates/notifications
+var notificationTemplateFiles embed.FS
+
+// customerEvents are the events customers are notified about. Each has a
+// template in templates/notifications named after it, and a translation
+// in the directory of each other locale.
+var customerEvents = map[string]bool{
+	EventAccountCreated:             true,
+	EventAccountFunded:              true,
+	EventAccountFundingFailed:       true,
+	EventAccountMatured:             true,
+	EventAccountClosed:              true,
+	EventMaturityReminder:           true,
+	EventMaturityInstructionChanged: true,
+	EventPayoutFailed:               true,
+	EventPayoutRedirected:           true,
+}
+
+// NotificationPreferences are how a customer wants to be told about their accounts
+// @Description A customer's notification channels, contact details and opt-outs
+type NotificationPreferences struct {
+	UserID int `json:"user_id" example:"123"`
+	// Channels are delivered to in addition to each other; empty leaves
+	// notices to the service's default notifier
+	Channels []string `json:"channels" example:"email,sms"`
+	Email    string   `json:"email,omitempty" example:"customer@example.com"`
+	Phone    string   `json:"phone,omitempty" example:"+251911000000"`
+	// ReminderDays is how many days before maturity the reminder is sent
+	ReminderDays int `json:"reminder_days" example:"7"`
+	// DisabledEvents are events the customer opted out of. Critical notices
+	// cannot be turned off.
+	DisabledEvents []string `json:"disabled_events" example:"account.created"`
+	// Locale is the language notices are written in, "en" or "am"
+	Locale string `json:"locale" example:"am"`
+	// UpdatedAt is omitted for customers who never set preferences
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// NotificationPreferencesRequest replaces a customer's notification preferences
+// @Description Request payload for setting notification preferences
+type NotificationPreferencesRequest struct {
+	Channels []string `json:"channels" example:"email,sms" validate:"dive,oneof=email sms webhook"` // "email", "sms", "webhook"
+	Email    string   `json:"email,omitempty" example:"customer@example.com" validate:"omitempty,email"`
+	Phone    string   `json:"phone,omitempty" example:"+251911000000"`
+	// ReminderDays defaults to the service default when omitted
+	ReminderDays   int      `json:"reminder_days,omitempty" example:"7"`
+	DisabledEvents []string `json:"disabled_events,omitempty" example:"account.created"`
+	// Locale defaults to DEFAULT_LOCALE when omitted
+	Locale string `json:"locale,omitempty" example:"am" validate:"omitempty,oneof=en am"`
+}
+
+// notificationData is what notification templates are filled from
+type notificationData struct {
+	AccountID int
+	UserID    int
+	// Account is the account as of the event, nil for notices raised
+	// outside the event stream
+	Account     *AccountSnapshot
+	Currency    string
+	DaysLeft    int
+	Destination string
+	Reason      string
+}
+
+// reminderDays returns NOTIFY_REMINDER_DAYS, the reminder lead time for
+// customers who did not choose one
+func reminderDays() int {
+	if v := os.Getenv("NOTIFY_REMINDER_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= maxReminderDays {
+			return n
+		}
+	}
+	return defaultReminderDays
+}
+
+// validateNotificationPreferencesRequest validates preferences and fills in defaults
+func validateNotificationPreferencesRequest(req *NotificationPreferencesRequest) error {
+	for _, ch := range req.Channels {
+		switch ch {
+		case NotifyEmail:
+			if req.Email == "" {
+				return fmt.Errorf("email is required for the email channel")
+			}
+		case NotifySMS:
+			if req.Phone == "" {
+				return fmt.Errorf("phone is required for the sms channel")
+			}
+		}
+	}
+	if req.Phone != "" && !validPhone(req.Phone) {
+		return fmt.Errorf("phone must be in international format, such as +251911000000")
+	}
+	if req.ReminderDays == 0 {
+		req.ReminderDays = reminderDays()
+	}
+	if req.Locale == "" {
+		req.Locale = defaultLocale()
+	}
+	if req.ReminderDays < 1 || req.ReminderDays > maxReminderDays {
+		return fmt.Errorf("reminder_days must be between 1 and %d", maxReminderDays)
+	}
+	for _, event := range req.DisabledEvents {
+		if !customerEvents[event] {
+			return fmt.Errorf("invalid event: %s", event)
+		}
+		if notificationPriority(event) == PriorityCritical {
+			return fmt.Errorf("%s notifications cannot be turned off", event)
+		}
+	}
+	return nil
+}
+
+// validPhone reports whether phone is an E.164 number
+func validPhone(phone string) bool {
+	if len(phone) < 8 || len(phone) > 16 || phone[0] != '+' || phone[1] == '0' {
+		return false
+	}
+	for _, c := range phone[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultNotificationPreferences are the preferences of a customer who never set any
+func defaultNotificationPreferences(userID int) *NotificationPreferences {
+	return &NotificationPreferences{UserID: userID, Channels: []string{}, ReminderDays: reminderDays(), DisabledEvents: []string{},
+		Locale: defaultLocale()}
+}
+
+// renderNotification fills the event's template in locale
+func renderNotification(event, locale string, data notificationData) (string, string, error) {
+	path := "templates/notifications/" + event + ".tmpl"
+	if locale != LocaleEnglish {
+		path = "templates/notifications/" + locale + "/" + event + ".tmpl"
+	}
+	tmpl, err := template.New(event+".tmpl").Funcs(documentTemplateFuncs).Funcs(localeTemplateFuncs[locale]).
+		ParseFS(notificationTemplateFiles, path)
+	if err != nil {
+		return "", "", fmt.Errorf("notification template %s: %w", event, err)
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return "", "", fmt.Errorf("notification template %s: %w", event, err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return "", "", fmt.Errorf("notification template %s: %w", event, err)
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()), nil
+}
+
+// preferencesCache holds the preferences a worker read during one batch
+type preferencesCache map[preferencesKey]*NotificationPreferences
+
+// preferencesKey identifies a customer's preferences within a tenant
+type preferencesKey struct {
+	tenant string
+	userID int
+}
+
+// preferencesFor returns the customer's preferences in the tenant of ctx,
+// or the defaults when they never set any. Preferences read are kept in
+// cache when it is not nil.
+func (s *service) preferencesFor(ctx context.Context, userID int, cache preferencesCache) (*NotificationPreferences, error) {
+	key := preferencesKey{tenant: tenantOf(ctx), userID: userID}
+	if prefs, ok := cache[key]; ok {
+		return prefs, nil
+	}
+	prefs, err := s.repo.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		prefs = defaultNotificationPreferences(userID)
+	}
+	if cache != nil {
+		cache[key] = prefs
+	}
+	return prefs, nil
+}
+
+// notificationsFor renders the notice for event and returns one pending
+// communication per channel the customer chose, or none when they opted
+// out of the event. dedupKey, when set, keeps the notice from being queued
+// twice on a channel.
+func (s *service) notificationsFor(ctx context.Context, event, dedupKey string, data notificationData,
+	cache preferencesCache) ([]*Communication, error) {
+	prefs, err := s.preferencesFor(ctx, data.UserID, cache)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(prefs.DisabledEvents, event) {
+		return nil, nil
+	}
+	if data.Currency == "" {
+		data.Currency = accountCurrency()
+	}
+	subject, message, err := renderNotification(event, prefs.Locale, data)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := prefs.Channels
+	if len(channels) == 0 {
+		channels = []string{""}
+	}
+	comms := make([]*Communication, 0, len(channels))
+	for _, ch := range channels {
+		comms = append(comms, &Communication{
+			AccountID: data.AccountID,
+			UserID:    data.UserID,
+			Kind:      CommunicationNotification,
+			Event:     event,
+			Subject:   subject,
+			Message:   message,
+			Status:    DeliveryPending,
+			Priority:  notificationPriority(event),
+			Channel:   ch,
+			DedupKey:  dedupKey,
+		})
+	}
+	return comms, nil
+}
+
+// QueueEventNotifications reads the outbox past the notification cursor in
+// batches and queues a notice for each customer event, on the channels the
+// customer chose. The cursor moves in the same transaction the notices are
+// queued in, and returns how many were queued.
+func (s *service) QueueEventNotifications(ctx context.Context, batchSize int) (int, error) {
+	cursor, err := s.repo.EventCursor(ctx, notificationConsumer)
+	if err != nil {
+		s.log(ctx).Error("Failed to read notification cursor", zap.Error(err))
+		return 0, err
+	}
+
+	total := 0
+	for {
+		events, err := s.repo.ListOutboxAfter(ctx, cursor, time.Now().UTC().Add(-notificationEventLag), batchSize)
+		if err != nil {
+			s.log(ctx).Error("Failed to read outbox", zap.Error(err))
+			return total, err
+		}
+		if len(events) == 0 {
+			return total, nil
+		}
+
+		var comms []*Communication
+		cache := preferencesCache{}
+		for _, e := range events {
+			cursor = e.ID
+			if !customerEvents[e.Type] {
+				continue
+			}
+			event, err := decodeAccountEvent(e)
+			if err != nil {
+				s.log(ctx).Warn("Skipping unreadable event", zap.Error(err), zap.String("eventID", e.EventID))
+				continue
+			}
+			c, err := s.notificationsFor(withTenant(ctx, e.TenantID), e.Type, e.EventID, notificationData{
+				AccountID: e.AggregateID,
+				UserID:    event.Account.UserID,
+				Account:   &event.Account,
+			}, cache)
+			if err != nil {
+				s.log(ctx).Error("Failed to prepare notification", zap.Error(err), zap.String("eventID", e.EventID))
+				return total, err
+			}
+			comms = append(comms, c...)
+		}
+
+		n, err := s.repo.QueueNotifications(ctx, comms, notificationConsumer, cursor)
+		if err != nil {
+			s.log(ctx).Error("Failed to queue notifications", zap.Error(err))
+			return total, err
+		}
+		total += n
+		if len(events) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// QueueMaturityReminders queues a reminder for every active account within
+// its customer's reminder lead time of maturity that was not reminded yet,
+// and returns how many were queued
+func (s *service) QueueMaturityReminders(ctx context.Context, batchSize int) (int, error) {
+	total := 0
+	for {
+		now := time.Now().UTC()
+		accounts, err := s.repo.ListDueMaturityReminders(ctx, now, reminderDays(), batchSize)
+		if err != nil {
+			s.log(ctx).Error("Failed to list due maturity reminders", zap.Error(err))
+			return total, err
+		}
+
+		var comms []*Communication
+		cache := preferencesCache{}
+		for _, a := range accounts {
+			snapshot := newAccountSnapshot(a)
+			c, err := s.notificationsFor(withTenant(ctx, a.TenantID), EventMaturityReminder, fmt.Sprintf("%s:%d", EventMaturityReminder, a.ID),
+				notificationData{
+					AccountID: a.ID,
+					UserID:    a.UserID,
+					Account:   &snapshot,
+					DaysLeft:  int(a.EndDate.Sub(now).Hours()/24) + 1,
+				}, cache)
+			if err != nil {
+				s.log(ctx).Error("Failed to prepare maturity reminder", zap.Error(err), zap.Int("accountID", a.ID))
+				return total, err
+			}
+			comms = append(comms, c...)
+		}
+		if len(comms) == 0 {
+			return total, nil
+		}
+
+		n, err := s.repo.QueueNotifications(ctx, comms, "", 0)
+		if err != nil {
+			s.log(ctx).Error("Failed to queue maturity reminders", zap.Error(err))
+			return total, err
+		}
+		total += n
+		// Every account read is reminded now, so a short page is the last;
+		// nothing new means another worker is queueing the same accounts
+		if len(accounts) < batchSize || n == 0 {
+			return total, nil
+		}
+	}
+}
+
+// notifyCustomer queues a notice about an account for the notification
+// worker to send, on each channel the customer chose and in the lane for
+// event. Failures are logged but never fail the caller.
+func (s *service) notifyCustomer(ctx context.Context, event string, data notificationData) {
+	comms, err := s.notificationsFor(ctx, event, "", data, nil)
+	if err == nil {
+		_, err = s.repo.QueueNotifications(ctx, comms, "", 0)
+	}
+	if err != nil {
+		s.log(ctx).Error("Failed to queue notification", zap.Error(err),
+			zap.Int("accountID", data.AccountID), zap.String("event", event))
+	}
+}
+
+// GetNotificationPreferences returns the customer's preferences, or the
+// defaults when they never set any
+func (s *service) GetNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	prefs, err := s.preferencesFor(ctx, userID, nil)
+	if err != nil {
+		s.log(ctx).Error("Failed to get notification preferences", zap.Error(err), zap.Int("userID", userID))
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// SetNotificationPreferences replaces the customer's preferences. Channels
+// that are not configured in this deployment are rejected with
+// ErrChannelUnavailable.
+func (s *service) SetNotificationPreferences(ctx context.Context, userID int, req *NotificationPreferencesRequest) (*NotificationPreferences, error) {
+	for _, ch := range req.Channels {
+		if s.channels[ch] == nil {
+			return nil, fmt.Errorf("%w: %s", ErrChannelUnavailable, ch)
+		}
+	}
+	channels := slices.Compact(slices.Sorted(slices.Values(req.Channels)))
+	disabled := slices.Compact(slices.Sorted(slices.Values(req.DisabledEvents)))
+	if channels == nil {
+		channels = []string{}
+	}
+	if disabled == nil {
+		disabled = []string{}
+	}
+	prefs, err := s.repo.SaveNotificationPreferences(ctx, &NotificationPreferences{
+		UserID:         userID,
+		Channels:       channels,
+		Email:          req.Email,
+		Phone:          req.Phone,
+		ReminderDays:   req.ReminderDays,
+		DisabledEvents: disabled,
+		Locale:         req.Locale,
+	})
+	if err != nil {
+		s.log(ctx).Error("Failed to save notification preferences", zap.Error(err), zap.Int("userID", userID))
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// getNotificationPreferencesHandler godoc
+// @Summary Get a customer's notification preferences
+// @Description Returns the channels, contact details, maturity reminder lead time and opt-outs used for the customer's notifications, or the defaults when none were set
+// @Tags notifications
+// @Produce json
+// @Param userID path int true "User ID" Format(int64)
+// @Success 200 {object} NotificationPreferences
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/user/{userID}/notification-preferences [get]
+func getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	prefs, err := svc.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeSuccess(w, r, prefs, "Notification preferences retrieved successfully")
+}
+
+// setNotificationPreferencesHandler godoc
+// @Summary Set a customer's notification preferences
+// @Description Replaces the customer's notification preferences. Notices go to every listed channel; email needs an address and sms a phone number in international format. Critical notices (maturity instruction changes, payout failures and redirects) cannot be disabled.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param userID path int true "User ID" Format(int64)
+// @Param preferences body NotificationPreferencesRequest true "Notification preferences"
+// @Success 200 {object} NotificationPreferences
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/user/{userID}/notification-preferences [put]
+func setNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID")
+		return
+	}
+
+	var req NotificationPreferencesRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if err := validateNotificationPreferencesRequest(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	prefs, err := svc.SetNotificationPreferences(ctx, userID, &req)
+	if errors.Is(err, ErrChannelUnavailable) {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	markWrite(w)
+	writeSuccess(w, r, prefs, "Notification preferences saved successfully")
+}
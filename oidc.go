@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha512" // SHA-384 and SHA-512 for the RS384, ES384 and similar algorithms
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultJWKSCacheTTL is how long the provider's signing keys are reused
+	// when OIDC_JWKS_CACHE_TTL is not set
+	defaultJWKSCacheTTL = time.Hour
+	// jwksMinRefreshInterval is the least time between fetches of the
+	// signing keys, so tokens naming unknown keys cannot flood the provider
+	jwksMinRefreshInterval = time.Minute
+	// maxOIDCResponseSize caps the discovery document and key set read
+	maxOIDCResponseSize = 1 << 20
+)
+
+// ErrIdentityProviderUnavailable is returned when a token cannot be checked
+// because the OIDC provider's signing keys could not be fetched
+var ErrIdentityProviderUnavailable = errors.New("identity provider unavailable")
+
+// jwsAlgorithms are the asymmetric signing algorithms accepted from an OIDC
+// provider, each with its signature check
+var jwsAlgorithms = map[string]func(key crypto.PublicKey, signed, sig []byte) bool{
+	"RS256": verifyRSA(crypto.SHA256, false),
+	"RS384": verifyRSA(crypto.SHA384, false),
+	"RS512": verifyRSA(crypto.SHA512, false),
+	"PS256": verifyRSA(crypto.SHA256, true),
+	"PS384": verifyRSA(crypto.SHA384, true),
+	"PS512": verifyRSA(crypto.SHA512, true),
+	"ES256": verifyECDSA(crypto.SHA256, elliptic.P256()),
+	"ES384": verifyECDSA(crypto.SHA384, elliptic.P384()),
+	"ES512": verifyECDSA(crypto.SHA512, elliptic.P521()),
+}
+
+// oidcProvider checks tokens issued by the OIDC provider at OIDC_ISSUER,
+// such as a Keycloak realm or an Auth0 tenant. The provider's key set is
+// found through its discovery document, or at OIDC_JWKS_URL, and cached for
+// OIDC_JWKS_CACHE_TTL. A token signed with a key not in the cache fetches
+// the set again, so key rotation needs no restart. While the provider is
+// unreachable the keys already fetched keep being used.
+type oidcProvider struct {
+	issuer   string
+	audience string
+	// scopePrefix is stripped from the token's scopes, so a provider shared
+	// by many APIs can name ours e.g. "block-account:write"
+	scopePrefix string
+	client      *http.Client
+	ttl         time.Duration
+	logger      *zap.Logger
+
+	mu      sync.Mutex
+	jwksURL string
+	keys    map[string]*jsonWebKey
+	// fetchedAt is when keys were last fetched and attemptedAt when a fetch
+	// was last tried
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// jsonWebKey is a public signing key from the provider's key set
+type jsonWebKey struct {
+	ID  string
+	Alg string // empty when the key does not restrict its algorithm
+	Key crypto.PublicKey
+}
+
+// newOIDCProvider builds the provider configured by OIDC_ISSUER, or nil when
+// tokens are not checked against an OIDC provider
+func newOIDCProvider(logger *zap.Logger) (*oidcProvider, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	audience := os.Getenv("OIDC_AUDIENCE")
+	if audience == "" {
+		return nil, errors.New("OIDC_AUDIENCE is required when OIDC_ISSUER is set")
+	}
+	ttl := defaultJWKSCacheTTL
+	if v := os.Getenv("OIDC_JWKS_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid OIDC_JWKS_CACHE_TTL: %s", v)
+		}
+		ttl = d
+	}
+	return &oidcProvider{
+		issuer:      issuer,
+		audience:    audience,
+		scopePrefix: os.Getenv("OIDC_SCOPE_PREFIX"),
+		client:      &http.Client{Timeout: 5 * time.Second},
+		ttl:         ttl,
+		logger:      logger,
+		jwksURL:     os.Getenv("OIDC_JWKS_URL"),
+	}, nil
+}
+
+// verifySignature checks that sig is the provider's signature of signed
+// with the token's algorithm and key
+func (p *oidcProvider) verifySignature(ctx context.Context, header *jwtHeader, signed, sig []byte, now time.Time) error {
+	verify, ok := jwsAlgorithms[header.Alg]
+	if !ok {
+		return fmt.Errorf("tokens signed with %q are not accepted", header.Alg)
+	}
+	key, err := p.key(ctx, header.Kid, now)
+	if err != nil {
+		return err
+	}
+	if (key.Alg != "" && key.Alg != header.Alg) || !verify(key.Key, signed, sig) {
+		return errInvalidToken
+	}
+	return nil
+}
+
+// key returns the signing key kid, fetching the key set again when the
+// cached one has expired or does not have the key
+func (p *oidcProvider) key(ctx context.Context, kid string, now time.Time) (*jsonWebKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookup(kid); key != nil && now.Sub(p.fetchedAt) < p.ttl {
+		return key, nil
+	}
+
+	if now.Sub(p.attemptedAt) >= jwksMinRefreshInterval {
+		p.attemptedAt = now
+		keys, err := p.fetchKeys(ctx)
+		switch {
+		case err == nil:
+			p.keys, p.fetchedAt = keys, now
+		case p.keys == nil:
+			return nil, fmt.Errorf("%w: %v", ErrIdentityProviderUnavailable, err)
+		default:
+			p.logger.Warn("Failed to refresh OIDC signing keys, using the cached ones", zap.Error(err))
+		}
+	}
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	if p.keys == nil {
+		return nil, ErrIdentityProviderUnavailable
+	}
+	return nil, fmt.Errorf("token is signed with unknown key %q", kid)
+}
+
+// lookup returns the cached key kid. A token without a key ID may only be
+// signed by a provider with a single key.
+func (p *oidcProvider) lookup(kid string) *jsonWebKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// fetchKeys fetches the provider's key set, finding it through the
+// discovery document the first time
+func (p *oidcProvider) fetchKeys(ctx context.Context) (map[string]*jsonWebKey, error) {
+	if p.jwksURL == "" {
+		var doc struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := p.getJSON(ctx, strings.TrimSuffix(p.issuer, "/")+"/.well-known/openid-configuration", &doc); err != nil {
+			return nil, fmt.Errorf("discover provider: %w", err)
+		}
+		switch {
+		case doc.Issuer != p.issuer:
+			return nil, fmt.Errorf("discovery document is for issuer %s, not %s", doc.Issuer, p.issuer)
+		case doc.JWKSURI == "":
+			return nil, errors.New("discovery document has no jwks_uri")
+		}
+		p.jwksURL = doc.JWKSURI
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("fetch signing keys: %w", err)
+	}
+	keys := make(map[string]*jsonWebKey, len(set.Keys))
+	for _, raw := range set.Keys {
+		// Encryption keys and key types we cannot use are skipped
+		if key, err := parseJSONWebKey(raw); err == nil {
+			keys[key.ID] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("key set has no usable signing keys")
+	}
+	return keys, nil
+}
+
+// getJSON decodes the JSON document at url into v
+func (p *oidcProvider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxOIDCResponseSize)).Decode(v)
+}
+
+// parseJSONWebKey reads an RSA or EC public signing key in JWK form
+func parseJSONWebKey(raw json.RawMessage) (*jsonWebKey, error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return nil, fmt.Errorf("key %s is not a signing key", jwk.Kid)
+	}
+
+	key := &jsonWebKey{ID: jwk.Kid, Alg: jwk.Alg}
+	switch jwk.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key %s", jwk.Kid)
+		}
+		key.Key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if !ok || errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid EC key %s", jwk.Kid)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("invalid EC key %s", jwk.Kid)
+		}
+		key.Key = pub
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+	return key, nil
+}
+
+// verifyRSA checks RSASSA-PKCS1-v1_5 signatures, or RSASSA-PSS ones when pss is set
+func verifyRSA(hash crypto.Hash, pss bool) func(crypto.PublicKey, []byte, []byte) bool {
+	return func(key crypto.PublicKey, signed, sig []byte) bool {
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		h := hash.New()
+		h.Write(signed)
+		if pss {
+			return rsa.VerifyPSS(pub, hash, h.Sum(nil), sig, nil) == nil
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig) == nil
+	}
+}
+
+// verifyECDSA checks ECDSA signatures on curve, which JWS encodes as r
+// followed by s, each padded to the curve's size
+func verifyECDSA(hash crypto.Hash, curve elliptic.Curve) func(crypto.PublicKey, []byte, []byte) bool {
+	size := (curve.Params().BitSize + 7) / 8
+	return func(key crypto.PublicKey, signed, sig []byte) bool {
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != curve || len(sig) != 2*size {
+			return false
+		}
+		h := hash.New()
+		h.Write(signed)
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, h.Sum(nil), r, s)
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"main.go/docs"
+)
+
+// OpenAPI validation modes, set by OPENAPI_VALIDATION
+const (
+	// OpenAPIValidationOff validates nothing
+	OpenAPIValidationOff = "off"
+	// OpenAPIValidationRequests rejects requests the document does not allow
+	OpenAPIValidationRequests = "requests"
+	// OpenAPIValidationAll also checks responses, logging those the document
+	// does not describe. It is meant for development and CI.
+	OpenAPIValidationAll = "all"
+)
+
+// maxValidatedResponseBytes is the largest response body checked against
+// the document; larger ones, such as exports, are passed through unchecked
+const maxValidatedResponseBytes = 1 << 20
+
+// openAPIValidationMode returns OPENAPI_VALIDATION, requests by default
+func openAPIValidationMode() string {
+	if v := os.Getenv("OPENAPI_VALIDATION"); v != "" {
+		return v
+	}
+	return OpenAPIValidationRequests
+}
+
+// checkOpenAPIValidationConfig refuses an OPENAPI_VALIDATION it does not know
+func checkOpenAPIValidationConfig() error {
+	switch mode := openAPIValidationMode(); mode {
+	case OpenAPIValidationOff, OpenAPIValidationRequests, OpenAPIValidationAll:
+		return nil
+	default:
+		return fmt.Errorf("invalid OPENAPI_VALIDATION: %s", mode)
+	}
+}
+
+// jsonSchema is the part of a Swagger 2.0 schema or parameter the
+// validator checks
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Format               string                 `json:"format"`
+	Enum                 []any                  `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	MaxLength            *int                   `json:"maxLength"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+}
+
+// openAPIParameter is an operation's parameter
+type openAPIParameter struct {
+	jsonSchema
+	Name          string      `json:"name"`
+	In            string      `json:"in"`
+	ParamRequired bool        `json:"required"`
+	Schema        *jsonSchema `json:"schema"`
+}
+
+// openAPIOperation is one method of a documented path
+type openAPIOperation struct {
+	Parameters []*openAPIParameter `json:"parameters"`
+	Responses  map[string]*struct {
+		Schema *jsonSchema `json:"schema"`
+	} `json:"responses"`
+}
+
+// openAPIRoute is a documented path template split into segments, with its
+// operations
+type openAPIRoute struct {
+	template   string
+	segments   []string
+	operations map[string]*openAPIOperation
+}
+
+// openAPIDocument is the published contract the validator checks against
+type openAPIDocument struct {
+	definitions map[string]*jsonSchema
+	routes      []*openAPIRoute
+}
+
+// loadOpenAPIDocument parses the document the server publishes. Only the
+// versioned API is documented, so only its paths are kept.
+func loadOpenAPIDocument(raw []byte) (*openAPIDocument, error) {
+	var spec struct {
+		Paths       map[string]map[string]*openAPIOperation `json:"paths"`
+		Definitions map[string]*jsonSchema                  `json:"definitions"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	doc := &openAPIDocument{definitions: spec.Definitions}
+	for template, operations := range spec.Paths {
+		if !strings.HasPrefix(template, "/"+currentAPIVersion+"/") {
+			continue
+		}
+		byMethod := make(map[string]*openAPIOperation, len(operations))
+		for method, op := range operations {
+			byMethod[strings.ToUpper(method)] = op
+		}
+		doc.routes = append(doc.routes, &openAPIRoute{
+			template:   template,
+			segments:   strings.Split(strings.Trim(template, "/"), "/"),
+			operations: byMethod,
+		})
+	}
+	return doc, nil
+}
+
+// match returns the route documenting path, or nil when the path is not
+// documented. A literal segment wins over a parameter, as it does in the
+// router.
+func (d *openAPIDocument) match(path string) *openAPIRoute {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var best *openAPIRoute
+	bestLiterals := -1
+	for _, route := range d.routes {
+		if len(route.segments) != len(segments) {
+			continue
+		}
+		literals := 0
+		for i, s := range route.segments {
+			if strings.HasPrefix(s, "{") {
+				if segments[i] == "" {
+					literals = -1
+					break
+				}
+				continue
+			}
+			if s != segments[i] {
+				literals = -1
+				break
+			}
+			literals++
+		}
+		if literals > bestLiterals {
+			best, bestLiterals = route, literals
+		}
+	}
+	return best
+}
+
+// validateRequest checks r's query parameters and JSON body against op.
+// Path parameters and headers are left to the handlers, which answer an
+// unknown resource or a missing identity with their own errors.
+func (d *openAPIDocument) validateRequest(op *openAPIOperation, r *http.Request, body []byte) validationErrors {
+	var errs validationErrors
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "query":
+			values, ok := query[p.Name]
+			if !ok || len(values) == 0 {
+				if p.ParamRequired {
+					errs.add(p.Name, CodeFieldRequired, fmt.Sprintf("%s is required", p.Name))
+				}
+				continue
+			}
+			for _, v := range values {
+				d.validateParameter(p, v, &errs)
+			}
+		case "body":
+			if body == nil {
+				continue
+			}
+			// The handler reports a body it cannot decode at all
+			var v any
+			if err := json.Unmarshal(body, &v); err != nil || !hasJSONType(v, d.resolve(p.Schema)) {
+				continue
+			}
+			d.validate(p.Schema, v, "", &errs)
+		}
+	}
+	return errs
+}
+
+// resolve follows s's reference to the definition it names
+func (d *openAPIDocument) resolve(s *jsonSchema) *jsonSchema {
+	for s != nil && s.Ref != "" {
+		s = d.definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	return s
+}
+
+// hasJSONType reports whether v is the object or array s requires, if any
+func hasJSONType(v any, s *jsonSchema) bool {
+	if s == nil {
+		return true
+	}
+	switch s.Type {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	}
+	return true
+}
+
+// validateParameter checks a query parameter's raw value against
+// its type, format and enum
+func (d *openAPIDocument) validateParameter(p *openAPIParameter, raw string, errs *validationErrors) {
+	var v any = raw
+	switch p.Type {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			errs.add(p.Name, CodeInvalidType, fmt.Sprintf("%s must be an integer", p.Name))
+			return
+		}
+		v = float64(n)
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			errs.add(p.Name, CodeInvalidType, fmt.Sprintf("%s must be a number", p.Name))
+			return
+		}
+		v = n
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			errs.add(p.Name, CodeInvalidType, fmt.Sprintf("%s must be true or false", p.Name))
+			return
+		}
+		v = b
+	}
+	d.validate(&p.jsonSchema, v, p.Name, errs)
+}
+
+// validate checks the decoded JSON value v, found at field, against s. Null
+// is accepted anywhere, as the handlers treat it as absent.
+func (d *openAPIDocument) validate(s *jsonSchema, v any, field string, errs *validationErrors) {
+	if s == nil || v == nil {
+		return
+	}
+	if s.Ref != "" {
+		d.validate(d.resolve(s), v, field, errs)
+		return
+	}
+	for _, part := range s.AllOf {
+		d.validate(part, v, field, errs)
+	}
+	name := field
+	if name == "" {
+		name = "body"
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			errs.add(field, CodeInvalidType, fmt.Sprintf("%s must be an object", name))
+			return
+		}
+		for _, key := range s.Required {
+			if _, ok := obj[key]; !ok {
+				errs.add(joinField(field, key), CodeFieldRequired, fmt.Sprintf("%s is required", joinField(field, key)))
+			}
+		}
+		var additional *jsonSchema
+		if len(s.AdditionalProperties) > 0 && s.AdditionalProperties[0] == '{' {
+			json.Unmarshal(s.AdditionalProperties, &additional)
+		}
+		for key, value := range obj {
+			if prop, ok := s.Properties[key]; ok {
+				d.validate(prop, value, joinField(field, key), errs)
+			} else if additional != nil {
+				d.validate(additional, value, joinField(field, key), errs)
+			}
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			errs.add(field, CodeInvalidType, fmt.Sprintf("%s must be an array", name))
+			return
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			if *s.MinItems == 1 {
+				errs.add(field, CodeInvalidField, fmt.Sprintf("%s must not be empty", name))
+			} else {
+				errs.add(field, CodeInvalidField, fmt.Sprintf("%s must have at least %d items", name, *s.MinItems))
+			}
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			errs.add(field, CodeInvalidField, fmt.Sprintf("%s must have at most %d items", name, *s.MaxItems))
+		}
+		for i, item := range items {
+			d.validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i), errs)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			errs.add(field, CodeInvalidType, fmt.Sprintf("%s must be a string", name))
+			return
+		}
+		if s.MaxLength != nil && utf8.RuneCountInString(str) > *s.MaxLength {
+			errs.add(field, CodeInvalidField, fmt.Sprintf("%s must be at most %d characters", name, *s.MaxLength))
+		}
+		switch s.Format {
+		case "uuid":
+			if uuid.Validate(str) != nil {
+				errs.add(field, CodeInvalidField, fmt.Sprintf("%s must be a UUID", name))
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				errs.add(field, CodeInvalidField, fmt.Sprintf("%s must be an RFC 3339 time", name))
+			}
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok {
+			errs.add(field, CodeInvalidType, fmt.Sprintf("%s must be a number", name))
+			return
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			errs.add(field, CodeInvalidType, fmt.Sprintf("%s must be an integer", name))
+			return
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			errs.add(field, CodeInvalidField, fmt.Sprintf("%s must be at least %v", name, *s.Minimum))
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			errs.add(field, CodeInvalidField, fmt.Sprintf("%s must be at most %v", name, *s.Maximum))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs.add(field, CodeInvalidType, fmt.Sprintf("%s must be true or false", name))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, v) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			allowed[i] = fmt.Sprint(e)
+		}
+		errs.add(field, CodeInvalidField, fmt.Sprintf("%s must be one of %s", name, strings.Join(allowed, ", ")))
+	}
+}
+
+// joinField names key within the field holding it
+func joinField(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+// isJSONMediaType reports whether a Content-Type names a JSON body
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// validatingWriter keeps a copy of a JSON response for checking once the
+// handler is done. The response itself goes out unchanged.
+type validatingWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *validatingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *validatingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.overflow {
+		if w.body.Len()+len(b) > maxValidatedResponseBytes {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *validatingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// validateResponse checks a captured response against the schema the
+// operation documents for its status, unwrapping the success envelope
+func (d *openAPIDocument) validateResponse(op *openAPIOperation, w *validatingWriter) []string {
+	if w.overflow || w.body.Len() == 0 || !isJSONMediaType(w.Header().Get("Content-Type")) {
+		return nil
+	}
+	response, ok := op.Responses[strconv.Itoa(w.status)]
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not documented", w.status)}
+	}
+	if response == nil || response.Schema == nil {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(w.body.Bytes(), &v); err != nil {
+		return []string{"body is not valid JSON"}
+	}
+	if envelope, ok := v.(map[string]any); ok && w.status < 400 && w.Header().Get("Content-Type") != BareMediaType {
+		if _, ok := envelope["success"]; ok {
+			v = envelope["data"]
+		}
+	}
+	var errs validationErrors
+	d.validate(response.Schema, v, "", &errs)
+	problems := make([]string, len(errs))
+	for i, e := range errs {
+		problems[i] = e.Message
+	}
+	return problems
+}
+
+// OpenAPIValidationMiddleware holds the versioned API to the document it
+// publishes. Requests whose query parameters or JSON body the
+// document does not allow are answered 400 before reaching their handler,
+// with a field error for each problem. In OpenAPIValidationAll mode,
+// responses are checked as well and any the document does not describe
+// are logged, so drift between handlers and the contract shows up in
+// development rather than in clients.
+func OpenAPIValidationMiddleware(mode string, logger *zap.Logger) func(http.Handler) http.Handler {
+	var doc *openAPIDocument
+	if mode != OpenAPIValidationOff {
+		var err error
+		if doc, err = loadOpenAPIDocument(docs.SwaggerJSON); err != nil {
+			logger.Error("OpenAPI validation disabled", zap.Error(err))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		if doc == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := doc.match(r.URL.Path)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			op := route.operations[r.Method]
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Bodies over the limit are left for the handler to refuse
+			var body []byte
+			if r.Body != nil && r.Body != http.NoBody && isJSONMediaType(r.Header.Get("Content-Type")) {
+				limit := maxBodyBytes(r)
+				data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+				r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+				if err == nil && int64(len(data)) <= limit && len(bytes.TrimSpace(data)) > 0 {
+					body = data
+				}
+			}
+			if errs := doc.validateRequest(op, r, body); len(errs) > 0 {
+				writeAPIError(w, http.StatusBadRequest, errs.err())
+				return
+			}
+
+			if mode != OpenAPIValidationAll {
+				next.ServeHTTP(w, r)
+				return
+			}
+			vw := &validatingWriter{ResponseWriter: w}
+			next.ServeHTTP(vw, r)
+			if problems := doc.validateResponse(op, vw); len(problems) > 0 {
+				loggerFromContext(r.Context(), logger).Error("Response does not match the OpenAPI document",
+					zap.String("method", r.Method),
+					zap.String("route", route.template),
+					zap.Int("status", vw.status),
+					zap.Strings("problems", problems),
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"main.go/docs"
+)
+
+func TestOpenAPIRequestValidation(t *testing.T) {
+	t.Setenv("OPENAPI_VALIDATION", OpenAPIValidationRequests)
+	api := newTestAPI(t)
+
+	for _, c := range []struct {
+		name, method, path, body string
+		code                     string
+		fields                   []string
+	}{
+		{"string for integer", "POST", "/v2/block-account", `{"user_id":"7","principal":100,"period":"3m"}`, CodeInvalidType, []string{"user_id"}},
+		{"fraction for integer", "POST", "/v2/block-account", `{"user_id":7.5,"principal":100,"period":"3m"}`, CodeInvalidType, []string{"user_id"}},
+		{"above maximum", "POST", "/v2/block-account", `{"user_id":7,"principal":2e12,"period":"3m"}`, CodeInvalidField, []string{"principal"}},
+		{"several problems", "POST", "/v2/block-account", `{"user_id":"7","principal":"100","period":"3m"}`, CodeValidationFailed, []string{"principal", "user_id"}},
+		{"query enum", "GET", "/v2/admin/maturities?group_by=year", "", CodeInvalidField, []string{"group_by"}},
+		{"missing query", "GET", "/v2/user/7/tax-certificate", "", CodeFieldRequired, []string{"year"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			w := api.do(c.method, c.path, c.body)
+			if w.Code != http.StatusBadRequest || errorCode(w) != c.code {
+				t.Fatalf("%d %s, want 400 %s", w.Code, w.Body, c.code)
+			}
+			var resp ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			fields := map[string]bool{}
+			for _, f := range resp.Fields {
+				fields[f.Field] = true
+			}
+			for _, f := range c.fields {
+				if !fields[f] {
+					t.Errorf("fields %+v, want %s", resp.Fields, f)
+				}
+			}
+		})
+	}
+
+	// Valid requests, and bodies the handler must report itself, get through
+	if w := api.do("POST", "/v2/block-account", `{"user_id":7,"principal":100,"period":"3m","settlement_account":null}`); w.Code != http.StatusCreated {
+		t.Errorf("valid request: %d %s", w.Code, w.Body)
+	}
+	if w := api.do("POST", "/v2/block-account", `{"user_id":`); errorCode(w) == CodeInvalidType {
+		t.Errorf("malformed body: %s", w.Body)
+	}
+}
+
+func TestOpenAPIResponseValidation(t *testing.T) {
+	doc, err := loadOpenAPIDocument(docs.SwaggerJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := doc.match("/v2/block-account/0192c3e5-b1a7-7c3d-9f2e-8a4b6c1d2e3f")
+	if route == nil || route.template != "/v2/block-account/{id}" {
+		t.Fatalf("matched %+v", route)
+	}
+	if route := doc.match("/v2/block-account/bulk"); route == nil || route.template != "/v2/block-account/bulk" {
+		t.Fatalf("literal segment matched %+v", route)
+	}
+	op := route.operations[http.MethodGet]
+
+	respond := func(status int, contentType, body string) []string {
+		w := &validatingWriter{ResponseWriter: httptest.NewRecorder()}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+		return doc.validateResponse(op, w)
+	}
+	if problems := respond(http.StatusOK, "application/json", `{"success":true,"data":{"id":"a","principal":100}}`); len(problems) > 0 {
+		t.Errorf("valid response: %v", problems)
+	}
+	if problems := respond(http.StatusOK, BareMediaType, `{"id":"a","principal":"100"}`); len(problems) != 1 {
+		t.Errorf("bare response with a string principal: %v", problems)
+	}
+	if problems := respond(http.StatusOK, "application/json", `{"success":true,"data":{"id":7}}`); len(problems) != 1 {
+		t.Errorf("enveloped response with a numeric id: %v", problems)
+	}
+	if problems := respond(http.StatusTeapot, "application/json", `{}`); len(problems) != 1 {
+		t.Errorf("undocumented status: %v", problems)
+	}
+	if problems := respond(http.StatusOK, "text/csv", `id`); len(problems) > 0 {
+		t.Errorf("CSV response: %v", problems)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Webhook subscription channels
+const (
+	// ChannelAccount carries account lifecycle events
+	ChannelAccount = "account"
+	// ChannelOperations carries operational events for incident tooling
+	ChannelOperations = "operations"
+)
+
+// Operational event types
+const (
+	EventJobFailed           = "job.failed"
+	EventReconciliationBreak = "reconciliation.break"
+	EventWebhookDeadLettered = "webhook.dead_lettered"
+	EventConfigChanged       = "config.changed"
+	EventApprovalRequested   = "approval.requested"
+	EventRegionFailover      = "region.failover"
+)
+
+// Operational event severities
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// OperationalEvent is the payload delivered to operations webhooks
+type OperationalEvent struct {
+	ID            string         `json:"id"`
+	Type          string         `json:"type"`
+	SchemaVersion int            `json:"schema_version"`
+	OccurredAt    time.Time      `json:"occurred_at"`
+	Severity      string         `json:"severity"`
+	Summary       string         `json:"summary"`
+	Details       map[string]any `json:"details"`
+	// Region is the region the event was raised in, when REGION is set
+	Region string `json:"region,omitempty"`
+}
+
+// Payload encodes the event as it is delivered
+func (e *OperationalEvent) Payload() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// emitOperational queues an operational event for every operations webhook
+// subscribed to it, logging rather than failing when it cannot be queued
+func (s *service) emitOperational(ctx context.Context, eventType, severity, summary string, details map[string]any) {
+	if details == nil {
+		details = map[string]any{}
+	}
+	event := &OperationalEvent{
+		ID:            uuid.NewString(),
+		Type:          eventType,
+		SchemaVersion: EventSchemaVersion,
+		OccurredAt:    time.Now().UTC(),
+		Severity:      severity,
+		Summary:       summary,
+		Details:       details,
+		Region:        regionName(),
+	}
+	if _, err := s.repo.EnqueueOperationalEvent(ctx, event); err != nil {
+		s.log(ctx).Warn("Failed to queue operational event", zap.Error(err), zap.String("event", eventType))
+	}
+}
+
+// reportJobFailures wraps a worker run so every failed run emits job.failed.
+// Runs cut short because the worker is stopping are not failures.
+func (s *service) reportJobFailures(job string, run func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := run(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.emitOperational(ctx, EventJobFailed, SeverityCritical, fmt.Sprintf("Worker %s failed", job),
+				map[string]any{"job": job, "error": err.Error()})
+		}
+		return err
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// Supported EVENT_BROKER values. The log broker only writes events to the
+// log and is meant for local development.
+const (
+	BrokerKafka = "kafka"
+	BrokerNATS  = "nats"
+	BrokerLog   = "log"
+)
+
+// Default broker destinations when KAFKA_TOPIC or NATS_SUBJECT is not set
+const (
+	defaultKafkaTopic  = "block-account-events"
+	defaultNATSSubject = "block-account.events"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the state
+// change it describes, waiting to be relayed to the broker
+type OutboxEvent struct {
+	ID          int64
+	EventID     string
+	AggregateID int
+	// AggregateKey is the account's external ID, empty for events written
+	// before accounts had one
+	AggregateKey  string
+	Type          string
+	SchemaVersion int
+	Payload       []byte
+	Attempts      int
+	// TenantID is the tenant of the account the event is about
+	TenantID string
+	// UserID is the account holder, 0 for events written before it was kept
+	UserID    int
+	CreatedAt time.Time
+}
+
+// Key returns the message key the event is published under, so events for
+// one account stay in order
+func (e *OutboxEvent) Key() string {
+	if e.AggregateKey != "" {
+		return e.AggregateKey
+	}
+	return strconv.Itoa(e.AggregateID)
+}
+
+// EventPublisher delivers outbox events to a message broker. Publish must
+// only return nil once the broker has acknowledged the event.
+type EventPublisher interface {
+	Publish(ctx context.Context, e *OutboxEvent) error
+	Close() error
+}
+
+// newEventPublisher connects to the broker selected by EVENT_BROKER
+func newEventPublisher(logger *zap.Logger) (EventPublisher, error) {
+	return newEventPublisherTo(logger, "")
+}
+
+// newEventPublisherTo connects to the broker selected by EVENT_BROKER and
+// publishes to topic instead of the configured KAFKA_TOPIC or NATS_SUBJECT.
+// An empty topic keeps the configured destination.
+func newEventPublisherTo(logger *zap.Logger, topic string) (EventPublisher, error) {
+	switch broker := os.Getenv("EVENT_BROKER"); broker {
+	case BrokerKafka:
+		return newKafkaPublisher(topic)
+	case BrokerNATS:
+		return newNATSPublisher(topic)
+	case BrokerLog:
+		if topic != "" {
+			logger = logger.With(zap.String("topic", topic))
+		}
+		return &logPublisher{logger: logger}, nil
+	case "":
+		return nil, fmt.Errorf("EVENT_BROKER must be set to %s, %s or %s", BrokerKafka, BrokerNATS, BrokerLog)
+	default:
+		return nil, fmt.Errorf("unsupported EVENT_BROKER: %s", broker)
+	}
+}
+
+// kafkaPublisher produces events through a Kafka REST proxy (Confluent REST
+// Proxy v2 API) to a single topic, keyed by account ID so each account's
+// events land on one partition in order. The proxy only answers once the
+// brokers have acknowledged the write.
+type kafkaPublisher struct {
+	client *http.Client
+	url    string
+}
+
+func newKafkaPublisher(topic string) (*kafkaPublisher, error) {
+	proxy := os.Getenv("KAFKA_REST_URL")
+	if proxy == "" {
+		return nil, fmt.Errorf("KAFKA_REST_URL is required when EVENT_BROKER=%s", BrokerKafka)
+	}
+	if topic == "" {
+		topic = os.Getenv("KAFKA_TOPIC")
+	}
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+	return &kafkaPublisher{
+		client: &http.Client{Timeout: 10 * time.Second},
+		url:    strings.TrimRight(proxy, "/") + "/topics/" + url.PathEscape(topic),
+	}, nil
+}
+
+// kafkaProduceRequest is the REST proxy's JSON-embedded produce request
+type kafkaProduceRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// kafkaProduceResponse reports a per-record outcome for a produce request
+type kafkaProduceResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, e *OutboxEvent) error {
+	body, err := json.Marshal(kafkaProduceRequest{Records: []kafkaRecord{
+		{Key: e.Key(), Value: e.Payload},
+	}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest proxy returned %s", resp.Status)
+	}
+
+	var result kafkaProduceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid kafka rest proxy response: %w", err)
+	}
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("kafka rejected event %s: %s", e.EventID, offset.Error)
+		}
+	}
+	return nil
+}
+
+func (p *kafkaPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
+
+// natsPublisher publishes events to JetStream on <NATS_SUBJECT>.<event type>.
+// The event ID is sent as Nats-Msg-Id so JetStream drops redelivered duplicates.
+type natsPublisher struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+func newNATSPublisher(subject string) (*natsPublisher, error) {
+	server := os.Getenv("NATS_URL")
+	if server == "" {
+		server = nats.DefaultURL
+	}
+	if subject == "" {
+		subject = os.Getenv("NATS_SUBJECT")
+	}
+	if subject == "" {
+		subject = defaultNATSSubject
+	}
+
+	conn, err := nats.Connect(server, nats.Name("block-account-outbox"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats at %s: %w", server, err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open jetstream: %w", err)
+	}
+	return &natsPublisher{conn: conn, js: js, subject: subject}, nil
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, e *OutboxEvent) error {
+	msg := nats.NewMsg(p.subject + "." + e.Type)
+	msg.Data = e.Payload
+	msg.Header.Set("Event-Type", e.Type)
+	msg.Header.Set("Schema-Version", strconv.Itoa(e.SchemaVersion))
+	_, err := p.js.PublishMsg(msg, nats.MsgId(e.EventID), nats.Context(ctx))
+	return err
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
+
+// logPublisher writes events to the log instead of a broker
+type logPublisher struct {
+	logger *zap.Logger
+}
+
+func (p *logPublisher) Publish(ctx context.Context, e *OutboxEvent) error {
+	p.logger.Info("Event published", zap.String("eventID", e.EventID), zap.String("type", e.Type),
+		zap.Int("aggregateID", e.AggregateID), zap.String("key", e.Key()), zap.ByteString("payload", e.Payload))
+	return nil
+}
+
+func (p *logPublisher) Close() error {
+	return nil
+}
+
+// RelayEvents publishes pending outbox events in order until none are left.
+// Events are marked published only after the broker acknowledges them, so a
+// crash between the two re-sends rather than loses them (at-least-once).
+func (s *service) RelayEvents(ctx context.Context, publisher EventPublisher, batchSize int) (int, error) {
+	total := 0
+	for {
+		n, err := s.repo.RelayOutbox(ctx, batchSize, func(e *OutboxEvent) error {
+			return publisher.Publish(ctx, e)
+		})
+		total += n
+		if err != nil {
+			s.log(ctx).Error("Failed to relay outbox events", zap.Error(err))
+			return total, err
+		}
+		if n < batchSize {
+			return total, nil
+		}
+	}
+}
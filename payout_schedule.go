@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Interest payout frequencies
+const (
+	FrequencyAtMaturity = "at_maturity"
+	FrequencyMonthly    = "monthly"
+	FrequencyQuarterly  = "quarterly"
+)
+
+// payoutIntervalMonths is the number of months between interest payments for
+// each frequency that pays before maturity
+var payoutIntervalMonths = map[string]int{
+	FrequencyMonthly:   1,
+	FrequencyQuarterly: 3,
+}
+
+// isValidPayoutFrequency validates the payout_frequency parameter
+func isValidPayoutFrequency(frequency string) bool {
+	_, ok := payoutIntervalMonths[frequency]
+	return ok || frequency == FrequencyAtMaturity
+}
+
+// Scheduled payout types
+const (
+	ScheduledInterest = "interest"
+	ScheduledMaturity = "maturity"
+)
+
+// InterestPayout is an interest payment made before maturity
+// @Description Interest paid on a block account for one accrual period
+type InterestPayout struct {
+	ID                int       `json:"id" example:"1"`
+	AccountID         int       `json:"-"`
+	AccountExternalID string    `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	Destination       string    `json:"destination_account" example:"*********6789"`
+	PeriodStart       time.Time `json:"period_start"`
+	PeriodEnd         time.Time `json:"period_end"`
+	Amount            float64   `json:"amount" example:"4.11"`
+	Status            string    `json:"status" example:"pending"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// ScheduledPayout is an upcoming payment on a block account
+// @Description Upcoming interest or maturity payment
+type ScheduledPayout struct {
+	Date time.Time `json:"date"`
+	// Type is "interest" for a periodic payment or "maturity" for the final one
+	Type      string  `json:"type" example:"interest"`
+	Interest  float64 `json:"interest" example:"4.11"`
+	Principal float64 `json:"principal" example:"0"`
+	Amount    float64 `json:"amount" example:"4.11"`
+}
+
+// PayoutSchedule lists the payments made and due on a block account
+// @Description Interest paid so far and the upcoming payout dates of a block account
+type PayoutSchedule struct {
+	AccountExternalID string             `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	PayoutFrequency   string             `json:"payout_frequency" example:"monthly"`
+	Paid              []*InterestPayout  `json:"paid"`
+	Upcoming          []*ScheduledPayout `json:"upcoming"`
+}
+
+// interestPayoutDates returns the account's interest payment dates after
+// from and before maturity. Payments fall every payout interval counted in
+// calendar months from the start date, dated with the term's conventions.
+func interestPayoutDates(a *BlockAccount, from time.Time) []time.Time {
+	months, ok := payoutIntervalMonths[a.PayoutFrequency]
+	if !ok {
+		return nil
+	}
+	convention := defaultTermConvention
+	if term, err := periodTerms(a.Period); err == nil {
+		convention = term.Convention
+	}
+
+	start := a.StartDate.In(businessLocation())
+	holidays := businessHolidays()
+	var dates []time.Time
+	for n := months; ; n += months {
+		d := compressTerm(a.StartDate, adjustBusinessDay(addMonths(start, n, convention.EndOfMonth), convention.BusinessDay, holidays).UTC())
+		if !d.Before(a.EndDate) {
+			return dates
+		}
+		if d.After(from) {
+			dates = append(dates, d)
+		}
+	}
+}
+
+// nextInterestPayoutDate returns the account's first interest payment date
+// after from, or nil when the rest of its interest is paid at maturity
+func nextInterestPayoutDate(a *BlockAccount, from time.Time) *time.Time {
+	dates := interestPayoutDates(a, from)
+	if len(dates) == 0 {
+		return nil
+	}
+	return &dates[0]
+}
+
+// scheduleInterest sets the next interest payment date of an account opened
+// before now, and counts the payments that fell due before now as paid
+func scheduleInterest(a *BlockAccount, now time.Time) {
+	a.NextPayoutDate = nextInterestPayoutDate(a, now)
+	for _, d := range interestPayoutDates(a, a.StartDate) {
+		if d.After(now) {
+			break
+		}
+		paid := d
+		a.InterestPaidThrough = &paid
+	}
+}
+
+// interestPaidFrom returns where the account's unpaid interest starts accruing
+func interestPaidFrom(a *BlockAccount) time.Time {
+	if a.InterestPaidThrough != nil {
+		return *a.InterestPaidThrough
+	}
+	return a.StartDate
+}
+
+// planInterestPayout pays the interest accrued up to the account's next payout date
+func planInterestPayout(a *BlockAccount) (*InterestOutcome, error) {
+	from, to := interestPaidFrom(a), *a.NextPayoutDate
+	return &InterestOutcome{
+		Payout: &InterestPayout{
+			AccountID:   a.ID,
+			Destination: a.PayoutDestination,
+			PeriodStart: from,
+			PeriodEnd:   to,
+			Amount:      roundMoney(interestBetween(a, from, to)),
+			Status:      PayoutPending,
+		},
+		NextPayoutDate: nextInterestPayoutDate(a, to),
+	}, nil
+}
+
+// ProcessInterestPayouts records the interest payments due at now, in
+// batches, until none are left. An account more than one payment behind
+// catches up one payment per batch. It returns the number of payments recorded.
+func (s *service) ProcessInterestPayouts(ctx context.Context, now time.Time, batchSize int) (int, error) {
+	total := 0
+	for {
+		n, err := s.repo.PayInterestDue(ctx, now, batchSize, planInterestPayout)
+		total += n
+		if err != nil {
+			s.log(ctx).Error("Failed to pay interest", zap.Error(err))
+			return total, err
+		}
+		if n == 0 {
+			return total, nil
+		}
+	}
+}
+
+// GetPayoutSchedule returns the interest paid on an account and its upcoming
+// payments, or nil if the account does not exist
+func (s *service) GetPayoutSchedule(ctx context.Context, id int) (*PayoutSchedule, error) {
+	account, err := s.repo.GetAccount(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get block account", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+
+	paid, err := s.repo.ListInterestPayouts(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to list interest payouts", zap.Error(err), zap.Int("id", id))
+		return nil, err
+	}
+	if paid == nil {
+		paid = []*InterestPayout{}
+	}
+
+	schedule := &PayoutSchedule{
+		AccountExternalID: account.ExternalID,
+		PayoutFrequency:   account.PayoutFrequency,
+		Paid:              paid,
+		Upcoming:          []*ScheduledPayout{},
+	}
+	if account.Status == StatusActive {
+		schedule.Upcoming = upcomingPayouts(account)
+	}
+	return schedule, nil
+}
+
+// upcomingPayouts returns the interest payments an active account has yet
+// to make, then its maturity payment
+func upcomingPayouts(account *BlockAccount) []*ScheduledPayout {
+	var upcoming []*ScheduledPayout
+	from := interestPaidFrom(account)
+	for _, date := range interestPayoutDates(account, from) {
+		interest := roundMoney(interestBetween(account, from, date))
+		upcoming = append(upcoming, &ScheduledPayout{
+			Date: date, Type: ScheduledInterest, Interest: interest, Amount: interest,
+		})
+		from = date
+	}
+	interest := roundMoney(interestBetween(account, from, account.EndDate))
+	return append(upcoming, &ScheduledPayout{
+		Date:      account.EndDate,
+		Type:      ScheduledMaturity,
+		Interest:  interest,
+		Principal: account.Principal,
+		Amount:    roundMoney(account.Principal + interest),
+	})
+}
+
+// getPayoutScheduleHandler godoc
+// @Summary Get the payout schedule of a block account
+// @Description Lists the interest paid on a block account and its upcoming interest and maturity payments with their expected amounts
+// @Tags block-account
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Success 200 {object} PayoutSchedule
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/block-account/{id}/payout-schedule [get]
+func getPayoutScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	schedule, err := svc.GetPayoutSchedule(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if schedule == nil {
+		writeErrorCode(w, http.StatusNotFound, CodeAccountNotFound, "Block account not found")
+		return
+	}
+
+	writeSuccess(w, r, schedule, "Payout schedule retrieved successfully")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Block account statuses
+const (
+	StatusActive       = "active"
+	StatusMatured      = "matured"
+	StatusRolledOver   = "rolled_over"
+	StatusPayoutFailed = "payout_failed"
+)
+
+// Payout statuses
+const (
+	PayoutPending = "pending"
+	PayoutSent    = "sent"
+	PayoutFailed  = "failed"
+)
+
+// ErrPayoutNotFailed is returned when retrying a payout that has not failed
+var ErrPayoutNotFailed = newAPIError(CodePayoutNotFailed, "payout is not in a failed state")
+
+// Payout represents a maturity payout instruction for a block account
+// @Description Maturity payout instruction and its delivery state
+type Payout struct {
+	ID                int       `json:"id" example:"1"`
+	AccountID         int       `json:"-"`
+	AccountExternalID string    `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	Destination       string    `json:"destination_account" example:"*********6789"`
+	Amount            float64   `json:"amount" example:"1050.00"`
+	Status            string    `json:"status" example:"failed"`
+	FailureReason     string    `json:"failure_reason,omitempty" example:"Rejected account number"`
+	Attempts          int       `json:"attempts" example:"1"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// PayoutFailureRequest reports why a payout instruction failed
+// @Description Request payload for reporting a failed payout
+type PayoutFailureRequest struct {
+	Reason string `json:"reason" example:"Rejected account number" validate:"notblank"`
+}
+
+// RetryPayoutRequest retries a failed payout, optionally to a new destination
+// @Description Request payload for retrying or redirecting a failed payout
+type RetryPayoutRequest struct {
+	DestinationAccount string `json:"destination_account,omitempty" example:"1000987654321"`
+}
+
+// Notifier delivers operational and customer-facing notices
+type Notifier interface {
+	NotifyOperations(ctx context.Context, subject, message string) error
+	NotifyCustomer(ctx context.Context, userID int, subject, message string) error
+}
+
+// logNotifier is the default Notifier which only records notices in the log
+type logNotifier struct {
+	logger *zap.Logger
+}
+
+func (n *logNotifier) NotifyOperations(ctx context.Context, subject, message string) error {
+	loggerFromContext(ctx, n.logger).Warn("Operations notification",
+		zap.String("subject", subject), zap.String("message", message))
+	return nil
+}
+
+func (n *logNotifier) NotifyCustomer(ctx context.Context, userID int, subject, message string) error {
+	loggerFromContext(ctx, n.logger).Info("Customer notification",
+		zap.Int("userID", userID), zap.String("subject", subject), zap.String("message", message))
+	return nil
+}
+
+// FailPayout marks an in-flight payout as failed and moves the account to payout_failed
+func (s *service) FailPayout(ctx context.Context, accountID int, reason string) (*Payout, error) {
+	payout, userID, err := s.repo.FailPayout(ctx, accountID, reason)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to mark payout failed", zap.Error(err), zap.Int("accountID", accountID))
+		}
+		return nil, err
+	}
+
+	s.notify(ctx, func(n Notifier) error {
+		return n.NotifyOperations(ctx, "Payout failed",
+			fmt.Sprintf("Payout %d for block account %d failed: %s", payout.ID, accountID, reason))
+	})
+	s.notifyCustomer(ctx, EventPayoutFailed, notificationData{AccountID: accountID, UserID: userID, Reason: reason})
+
+	return payout, nil
+}
+
+// RetryPayout re-queues a failed payout, redirecting it when destination is set
+func (s *service) RetryPayout(ctx context.Context, accountID int, destination string) (*Payout, error) {
+	payout, userID, err := s.repo.RetryPayout(ctx, accountID, destination)
+	if err != nil {
+		if err != sql.ErrNoRows && err != ErrPayoutNotFailed {
+			s.log(ctx).Error("Failed to retry payout", zap.Error(err), zap.Int("accountID", accountID))
+		}
+		return nil, err
+	}
+
+	if destination != "" {
+		s.notifyCustomer(ctx, EventPayoutRedirected, notificationData{
+			AccountID:   accountID,
+			UserID:      userID,
+			Destination: maskAccountNumber(payout.Destination),
+		})
+	}
+
+	return payout, nil
+}
+
+// notify sends a notice, logging rather than failing when delivery fails
+func (s *service) notify(ctx context.Context, send func(Notifier) error) {
+	if s.notifier == nil {
+		return
+	}
+	if err := send(s.notifier); err != nil {
+		s.log(ctx).Warn("Failed to send notification", zap.Error(err))
+	}
+}
+
+// failPayoutHandler godoc
+// @Summary Report a failed payout
+// @Description Marks the account's in-flight maturity payout as failed, moves the account to payout_failed and notifies operations and the customer
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param failure body PayoutFailureRequest true "Failure details"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/block-account/{id}/payout/failure [post]
+func failPayoutHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	var req PayoutFailureRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	payout, err := svc.FailPayout(ctx, id, req.Reason)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "No payout in progress for this block account")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, payout, "Payout marked as failed")
+}
+
+// retryPayoutHandler godoc
+// @Summary Retry or redirect a failed payout
+// @Description Re-queues a failed maturity payout, optionally to a different destination account
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Account ID" Format(uuid)
+// @Param retry body RetryPayoutRequest false "Optional new destination"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/block-account/{id}/payout/retry [post]
+func retryPayoutHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, ok := accountIDParam(w, r, svc)
+	if !ok {
+		return
+	}
+
+	var req RetryPayoutRequest
+	if r.ContentLength != 0 && !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	payout, err := svc.RetryPayout(ctx, id, req.DestinationAccount)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			writeError(w, http.StatusNotFound, "No payout found for this block account")
+		case ErrPayoutNotFailed:
+			writeAPIError(w, http.StatusConflict, err)
+		default:
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, payout, "Payout queued for retry")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PortfolioStatus sums a user's accounts in one status
+// @Description Accounts of a user in one status, with their principal and interest accrued
+type PortfolioStatus struct {
+	Accounts  int     `json:"accounts" example:"2"`
+	Principal float64 `json:"principal" example:"15000.00"`
+	// AccruedInterest is the interest earned to date by those accounts that
+	// still earn it, active and frozen ones; 0 for other statuses
+	AccruedInterest float64 `json:"accrued_interest" example:"312.45"`
+}
+
+// UserPortfolio sums up all of a user's block accounts
+// @Description A user's block accounts summed up: what they hold, earn and when the next one matures
+type UserPortfolio struct {
+	UserID   int    `json:"user_id" example:"123"`
+	Currency string `json:"currency" example:"ETB"`
+	// Accounts counts every account of the user, in any status
+	Accounts int `json:"accounts" example:"3"`
+	// TotalPrincipal, TotalAccruedInterest and WeightedAverageRate cover the
+	// accounts still earning interest, active and frozen ones
+	TotalPrincipal       float64 `json:"total_principal" example:"15000.00"`
+	TotalAccruedInterest float64 `json:"total_accrued_interest" example:"312.45"`
+	// WeightedAverageRate is the rate of those accounts weighted by principal
+	WeightedAverageRate float64 `json:"weighted_average_rate" example:"0.0567"`
+	// NextMaturityDate is the earliest end date among them, omitted when
+	// there are none
+	NextMaturityDate      *time.Time `json:"next_maturity_date,omitempty"`
+	NextMaturityAccountID string     `json:"next_maturity_account_id,omitempty" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	// ByStatus sums the accounts in each status the user has one in
+	ByStatus map[string]PortfolioStatus `json:"by_status"`
+	// ValuedAt is the instant the interest is accrued to, as for an
+	// account's valuation
+	ValuedAt time.Time `json:"valued_at"`
+	// Display is set when a display_currency was requested
+	Display *DisplayAmounts `json:"display,omitempty"`
+}
+
+// summarizePortfolio sums up accounts valued at now, as GetUserBlockAccounts
+// returns them
+func summarizePortfolio(userID int, accounts []*BlockAccount, now time.Time) *UserPortfolio {
+	p := &UserPortfolio{
+		UserID:   userID,
+		Currency: accountCurrency(),
+		Accounts: len(accounts),
+		ByStatus: map[string]PortfolioStatus{},
+		ValuedAt: valuationTime(now),
+	}
+	var weightedRate float64
+	for _, a := range accounts {
+		status := p.ByStatus[a.Status]
+		status.Accounts++
+		status.Principal += a.Principal
+		if a.Valuation != nil {
+			status.AccruedInterest += a.Valuation.AccruedInterestToDate
+			p.TotalPrincipal += a.Principal
+			p.TotalAccruedInterest += a.Valuation.AccruedInterestToDate
+			weightedRate += a.Principal * a.InterestRate
+			if p.NextMaturityDate == nil || a.EndDate.Before(*p.NextMaturityDate) {
+				end := a.EndDate
+				p.NextMaturityDate, p.NextMaturityAccountID = &end, a.ExternalID
+			}
+		}
+		p.ByStatus[a.Status] = status
+	}
+	for key, status := range p.ByStatus {
+		status.Principal, status.AccruedInterest = roundMoney(status.Principal), roundMoney(status.AccruedInterest)
+		p.ByStatus[key] = status
+	}
+	if p.TotalPrincipal > 0 {
+		p.WeightedAverageRate = weightedRate / p.TotalPrincipal
+	}
+	p.TotalPrincipal, p.TotalAccruedInterest = roundMoney(p.TotalPrincipal), roundMoney(p.TotalAccruedInterest)
+	return p
+}
+
+// GetUserPortfolio sums up every block account of userID, including joint
+// accounts of which they are a secondary holder
+func (s *service) GetUserPortfolio(ctx context.Context, userID int) (*UserPortfolio, error) {
+	accounts, err := s.GetUserBlockAccounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return summarizePortfolio(userID, accounts, s.Now()), nil
+}
+
+// getUserPortfolioHandler godoc
+// @Summary Get a user's portfolio summary
+// @Description Sums up all of a user's block accounts, including joint accounts of which they are a secondary holder, so clients need not page through and add up the accounts themselves. Total principal, total interest accrued to date, the principal-weighted average rate and the next maturity date cover the active and frozen accounts; by_status counts every account by status. Interest is accrued to the start of the business day, as in an account's valuation. With display_currency, the totals are also presented converted at the current rate.
+// @Tags block-account
+// @Produce json
+// @Param userID path int true "User ID" Format(int64)
+// @Param display_currency query string false "ISO 4217 currency to also present amounts in" example(EUR)
+// @Success 200 {object} UserPortfolio
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /v2/user/{userID}/portfolio [get]
+func getUserPortfolioHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	rate, ok := displayRate(ctx, w, r, svc)
+	if !ok {
+		return
+	}
+
+	portfolio, err := svc.GetUserPortfolio(ctx, userID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if rate != nil {
+		portfolio.Display = rate.display(map[string]float64{
+			"total_principal": portfolio.TotalPrincipal, "total_accrued_interest": portfolio.TotalAccruedInterest,
+		})
+	}
+
+	writeSuccess(w, r, portfolio, "User portfolio retrieved successfully")
+}
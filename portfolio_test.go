@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSummarizePortfolio(t *testing.T) {
+	now := time.Now().UTC()
+	soon, later := now.AddDate(0, 2, 0), now.AddDate(1, 0, 0)
+	accounts := []*BlockAccount{
+		{ExternalID: "a", Status: StatusActive, Principal: 1000, InterestRate: 0.05, EndDate: later,
+			Valuation: &AccountValuation{AccruedInterestToDate: 10.25}},
+		{ExternalID: "f", Status: StatusFrozen, Principal: 3000, InterestRate: 0.07, EndDate: soon,
+			Valuation: &AccountValuation{AccruedInterestToDate: 30.5}},
+		{ExternalID: "m", Status: StatusMatured, Principal: 500, InterestRate: 0.04, EndDate: now.AddDate(0, -1, 0)},
+	}
+
+	p := summarizePortfolio(7, accounts, now)
+	if p.Accounts != 3 || p.TotalPrincipal != 4000 || p.TotalAccruedInterest != 40.75 ||
+		math.Abs(p.WeightedAverageRate-0.065) > 1e-9 {
+		t.Errorf("totals = %+v, want 4000 principal, 40.75 interest at 6.5%%", p)
+	}
+	if p.NextMaturityDate == nil || !p.NextMaturityDate.Equal(soon) || p.NextMaturityAccountID != "f" {
+		t.Errorf("next maturity = %v %s, want the frozen account's", p.NextMaturityDate, p.NextMaturityAccountID)
+	}
+	want := map[string]PortfolioStatus{
+		StatusActive:  {Accounts: 1, Principal: 1000, AccruedInterest: 10.25},
+		StatusFrozen:  {Accounts: 1, Principal: 3000, AccruedInterest: 30.5},
+		StatusMatured: {Accounts: 1, Principal: 500},
+	}
+	for status, w := range want {
+		if p.ByStatus[status] != w {
+			t.Errorf("%s = %+v, want %+v", status, p.ByStatus[status], w)
+		}
+	}
+
+	if empty := summarizePortfolio(8, nil, now); empty.Accounts != 0 || empty.NextMaturityDate != nil || empty.WeightedAverageRate != 0 {
+		t.Errorf("empty portfolio = %+v", empty)
+	}
+}
+
+func TestUserPortfolio(t *testing.T) {
+	api := newTestAPI(t)
+	api.createAccount(73)
+	api.createAccount(73)
+
+	var p UserPortfolio
+	api.create(http.MethodGet, "/v2/user/73/portfolio", "", &p)
+	if p.Accounts != 2 || p.TotalPrincipal != 2000 || p.ByStatus[StatusActive].Accounts != 2 || p.NextMaturityDate == nil {
+		t.Errorf("portfolio = %+v", p)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ProductQuote is what a principal would earn on one product opened now
+// @Description Rate, maturity date and interest of one deposit product for the compared principal
+type ProductQuote struct {
+	Product
+	// MaturityDate is when an account opened now would mature
+	MaturityDate time.Time `json:"maturity_date"`
+	// GrossInterest is the interest over the full term, before tax
+	GrossInterest float64 `json:"gross_interest" example:"500.00"`
+	TaxWithheld   float64 `json:"tax_withheld" example:"25.00"`
+	NetInterest   float64 `json:"net_interest" example:"475.00"`
+	// MaturityValue is the principal with the net interest
+	MaturityValue float64 `json:"maturity_value" example:"10475.00"`
+	// Eligible is false when the principal is below the product's minimum
+	Eligible bool `json:"eligible" example:"true"`
+}
+
+// ProductComparison quotes every product a user can open for one principal
+// @Description Interest a principal would earn on each deposit product, shortest term first
+type ProductComparison struct {
+	Principal       float64        `json:"principal" example:"10000"`
+	Currency        string         `json:"currency" example:"ETB"`
+	WithholdingRate float64        `json:"withholding_rate" example:"0.05"`
+	Products        []ProductQuote `json:"products"`
+	// QuotedAt is the start date the maturities and interest are worked out from
+	QuotedAt time.Time `json:"quoted_at"`
+}
+
+// CompareProducts quotes principal on every product userID can open in the
+// caller's tenant, as ListProducts lists them, as if the account were opened
+// now. Interest is worked out the way an account's is, and taxed at the
+// withholding rate of tax certificates.
+func (s *service) CompareProducts(ctx context.Context, userID int, principal float64) (*ProductComparison, error) {
+	products, err := s.ListProducts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.Now().UTC()
+	taxRate := withholdingRate()
+	comparison := &ProductComparison{
+		Principal:       principal,
+		Currency:        accountCurrency(),
+		WithholdingRate: taxRate,
+		Products:        make([]ProductQuote, 0, len(products)),
+		QuotedAt:        now,
+	}
+	for _, p := range products {
+		term, err := periodTerms(p.Period)
+		if err != nil {
+			return nil, err
+		}
+		account := &BlockAccount{Principal: principal, InterestRate: p.Rate, StartDate: now, EndDate: term.maturityDate(now)}
+		gross := roundMoney(interestBetween(account, account.StartDate, account.EndDate))
+		tax := roundMoney(gross * taxRate)
+		comparison.Products = append(comparison.Products, ProductQuote{
+			Product:       *p,
+			MaturityDate:  account.EndDate,
+			GrossInterest: gross,
+			TaxWithheld:   tax,
+			NetInterest:   roundMoney(gross - tax),
+			MaturityValue: roundMoney(principal + gross - tax),
+			Eligible:      principal >= p.MinPrincipal,
+		})
+	}
+	return comparison, nil
+}
+
+// compareProductsHandler godoc
+// @Summary Compare deposit products
+// @Description Quotes a principal on every deposit product the user can open: its rate, the maturity date of an account opened now, and the gross and net interest over the full term after withholding tax at TAX_WITHHOLDING_RATE. Products the principal is below the minimum of are listed with eligible false. user_id works as it does for GET /products.
+// @Tags block-account
+// @Produce json
+// @Param principal query number true "Amount to deposit"
+// @Param user_id query int false "User ID"
+// @Success 200 {object} ProductComparison
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/products/compare [get]
+func compareProductsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("principal") == "" {
+		writeErrorCode(w, http.StatusBadRequest, CodeFieldRequired, "principal is required")
+		return
+	}
+	principal, err := strconv.ParseFloat(query.Get("principal"), 64)
+	switch {
+	case err != nil || principal <= 0:
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidAmount, "principal must be a positive number")
+		return
+	case principal > MaxPrincipal:
+		writeErrorCode(w, http.StatusBadRequest, CodeAmountTooLarge, "principal must be at most "+strconv.FormatFloat(MaxPrincipal, 'f', 2, 64))
+		return
+	}
+
+	userID := 0
+	if v := query.Get("user_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "user_id must be positive")
+			return
+		}
+		userID = n
+	}
+
+	ctx := r.Context()
+
+	comparison, err := svc.CompareProducts(ctx, userID, principal)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, r, comparison, "Products compared successfully")
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// ErrProductUnavailable is returned when a user opens a gated product they
+// are not part of the pilot for
+var ErrProductUnavailable = newAPIError(CodeProductUnavailable, "period is not available")
+
+// maxAllowedUsers bounds a gate's allowlist; wider pilots should use a rollout percentage
+const maxAllowedUsers = 1000
+
+// ProductGate limits a product to a pilot group while it soft launches
+// @Description Pilot gate restricting a deposit product to allowlisted users and a percentage rollout
+type ProductGate struct {
+	Product        string `json:"product" example:"3y"`
+	AllowedUserIDs []int  `json:"allowed_user_ids"`
+	// RolloutPercent opens the product to a stable share of all other users
+	RolloutPercent int       `json:"rollout_percent" example:"10"`
+	UpdatedBy      string    `json:"updated_by,omitempty" example:"staff-42"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ProductGateRequest is the payload for gating a product
+// @Description Request payload for gating a deposit product
+type ProductGateRequest struct {
+	AllowedUserIDs []int `json:"allowed_user_ids" validate:"dive,gt=0"`
+	RolloutPercent int   `json:"rollout_percent" example:"10" validate:"gte=0,lte=100"`
+}
+
+// Product is a deposit product a customer can open
+// @Description Deposit product offered to a user
+type Product struct {
+	// Period is the product code, sent as period or product_code to open it
+	Period       string  `json:"period" example:"1y"`
+	Name         string  `json:"name" example:"1-year deposit"`
+	Months       int     `json:"months" example:"12"`
+	Rate         float64 `json:"rate" example:"0.05"`
+	MinPrincipal float64 `json:"min_principal" example:"500"`
+	// EarlyWithdrawal is "allowed", "approval" or "not_allowed"
+	EarlyWithdrawal string `json:"early_withdrawal" example:"allowed"`
+	// Pilot is set while the product is gated and only open to some users
+	Pilot bool `json:"pilot"`
+}
+
+// allows reports whether the gate lets userID see and open the product.
+// Rollout buckets are a hash of the product and user, so raising the
+// percentage only ever adds users and each product samples different ones.
+func (g *ProductGate) allows(userID int) bool {
+	if slices.Contains(g.AllowedUserIDs, userID) {
+		return true
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", g.Product, userID)
+	return int(h.Sum32()%100) < g.RolloutPercent
+}
+
+// validateProductGateRequest validates the gate payload for product
+func validateProductGateRequest(product string, req *ProductGateRequest) error {
+	if !isValidPeriod(product) {
+		return fmt.Errorf("invalid period: %s. Valid options are: %s", product, validPeriods())
+	}
+	if len(req.AllowedUserIDs) > maxAllowedUsers {
+		return fmt.Errorf("allowed_user_ids may list at most %d users", maxAllowedUsers)
+	}
+	return nil
+}
+
+// checkProductAvailable returns ErrProductUnavailable when period is gated
+// and userID is not in its pilot
+func (s *service) checkProductAvailable(ctx context.Context, period string, userID int) error {
+	gate, err := s.repo.GetProductGate(ctx, period)
+	if err != nil {
+		s.log(ctx).Error("Failed to get product gate", zap.Error(err), zap.String("product", period))
+		return err
+	}
+	if gate != nil && !gate.allows(userID) {
+		return ErrProductUnavailable
+	}
+	return nil
+}
+
+// ListProducts returns the products userID can open in the caller's tenant,
+// at its rates, shortest term first. A userID of 0 lists only the generally
+// available products.
+func (s *service) ListProducts(ctx context.Context, userID int) ([]*Product, error) {
+	rates, err := s.ratePlan(ctx, tenantOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	gates, err := s.repo.ListProductGates(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to list product gates", zap.Error(err))
+		return nil, err
+	}
+	gated := make(map[string]*ProductGate, len(gates))
+	for _, g := range gates {
+		gated[g.Product] = g
+	}
+
+	products := []*Product{}
+	for _, p := range catalog.offered() {
+		gate := gated[p.Code]
+		if gate != nil && (userID == 0 || !gate.allows(userID)) {
+			continue
+		}
+		term, err := rates.terms(p.Code)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, &Product{Period: p.Code, Name: p.Name, Months: term.Months, Rate: term.Rate,
+			MinPrincipal: p.MinPrincipal, EarlyWithdrawal: p.EarlyWithdrawal, Pilot: gate != nil})
+	}
+	return products, nil
+}
+
+// ListProductGates returns every gated product
+func (s *service) ListProductGates(ctx context.Context) ([]*ProductGate, error) {
+	gates, err := s.repo.ListProductGates(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to list product gates", zap.Error(err))
+		return nil, err
+	}
+	if gates == nil {
+		gates = []*ProductGate{}
+	}
+	return gates, nil
+}
+
+// SetProductGate gates a product, replacing any gate it already has
+func (s *service) SetProductGate(ctx context.Context, product, staffID string, req *ProductGateRequest) (*ProductGate, error) {
+	allowed := req.AllowedUserIDs
+	if allowed == nil {
+		allowed = []int{}
+	}
+	gate := &ProductGate{
+		Product:        product,
+		AllowedUserIDs: allowed,
+		RolloutPercent: req.RolloutPercent,
+		UpdatedBy:      staffID,
+	}
+	if err := s.repo.SaveProductGate(ctx, gate); err != nil {
+		s.log(ctx).Error("Failed to save product gate", zap.Error(err), zap.String("product", product))
+		return nil, err
+	}
+	s.log(ctx).Info("Product gate updated", zap.String("product", product), zap.String("staffID", staffID),
+		zap.Int("allowedUsers", len(gate.AllowedUserIDs)), zap.Int("rolloutPercent", gate.RolloutPercent))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Product %s gated", product),
+		map[string]any{"setting": "product_gate", "product": product, "changed_by": staffID,
+			"allowed_users": len(gate.AllowedUserIDs), "rollout_percent": gate.RolloutPercent})
+	return gate, nil
+}
+
+// DeleteProductGate launches a gated product to every user
+func (s *service) DeleteProductGate(ctx context.Context, product string) error {
+	if err := s.repo.DeleteProductGate(ctx, product); err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to delete product gate", zap.Error(err), zap.String("product", product))
+		}
+		return err
+	}
+	s.log(ctx).Info("Product launched to all users", zap.String("product", product))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Product %s launched to all users", product),
+		map[string]any{"setting": "product_gate", "product": product})
+	return nil
+}
+
+// listProductsHandler godoc
+// @Summary List deposit products
+// @Description Lists the deposit products the user can open, including pilots they have been let into. Without user_id only generally available products are listed.
+// @Tags block-account
+// @Produce json
+// @Param user_id query int false "User ID"
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]Product}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/products [get]
+func listProductsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	userID := 0
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "user_id must be positive")
+			return
+		}
+		userID = n
+	}
+
+	ctx := r.Context()
+
+	products, err := svc.ListProducts(ctx, userID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, products, "Products retrieved successfully")
+}
+
+// listProductGatesHandler godoc
+// @Summary List product gates
+// @Description Lists the products in soft launch with their allowlists and rollout percentages
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]ProductGate}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/product-gates [get]
+func listProductGatesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	gates, err := svc.ListProductGates(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, gates, "Product gates retrieved successfully")
+}
+
+// setProductGateHandler godoc
+// @Summary Gate a product for a pilot launch
+// @Description Restricts a deposit product to the allowlisted users plus a stable percentage of all other users. Other users neither see it nor can open it. Replaces any existing gate.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param product path string true "Product period code"
+// @Param gate body ProductGateRequest true "Pilot group"
+// @Param X-Staff-ID header string false "Staff member, set by the gateway"
+// @Success 200 {object} ProductGate
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/product-gates/{product} [put]
+func setProductGateHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	product := chi.URLParam(r, "product")
+
+	var req ProductGateRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := validateProductGateRequest(product, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	gate, err := svc.SetProductGate(ctx, product, r.Header.Get(StaffIDHeader), &req)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, r, gate, "Product gate saved successfully")
+}
+
+// deleteProductGateHandler godoc
+// @Summary Launch a gated product to all users
+// @Description Removes a product's gate so every user can see and open it
+// @Tags admin
+// @Param product path string true "Product period code"
+// @Success 204 {string} string "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/product-gates/{product} [delete]
+func deleteProductGateHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	product := chi.URLParam(r, "product")
+
+	ctx := r.Context()
+
+	if err := svc.DeleteProductGate(ctx, product); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Product is not gated")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
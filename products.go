@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// What a product allows when an account is closed before it matures
+const (
+	// EarlyWithdrawalAllowed closes the account, needing approval only
+	// from APPROVAL_EARLY_WITHDRAWAL_THRESHOLD
+	EarlyWithdrawalAllowed = "allowed"
+	// EarlyWithdrawalApproval needs an approved early_withdrawal whatever
+	// the principal
+	EarlyWithdrawalApproval = "approval"
+	// EarlyWithdrawalNotAllowed refuses to close the account until it matures
+	EarlyWithdrawalNotAllowed = "not_allowed"
+)
+
+// productRefreshInterval is how often a process reloads the product
+// catalog, so products defined through another instance are offered by this
+// one soon after
+const productRefreshInterval = time.Minute
+
+var (
+	// ErrEarlyWithdrawalNotAllowed is returned when closing an account before
+	// maturity that its product keeps open until then
+	ErrEarlyWithdrawalNotAllowed = newAPIError(CodeEarlyWithdrawalNotAllowed, "product does not allow closing the account before it matures")
+	// ErrProductMismatch is returned when a create names different products
+	// in period and product_code
+	ErrProductMismatch = newAPIError(CodeInvalidPeriod, "period and product_code name different products")
+)
+
+// productCodePattern is what a product code looks like. Codes are stored as
+// accounts' periods and used in paths, e.g. "9m" or "2y".
+var productCodePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,15}$`)
+
+// ProductDefinition is a deposit product as the back office configures it
+// @Description Deposit product definition: its term, built-in rate, minimum principal and early withdrawal rule
+type ProductDefinition struct {
+	// Code is stored as the period of the accounts opened as the product
+	Code       string `json:"code" example:"9m"`
+	Name       string `json:"name" example:"9-month deposit"`
+	TermMonths int    `json:"term_months" example:"9"`
+	// Rate is the built-in rate, offered unless a tenant sets its own
+	Rate         float64 `json:"rate" example:"0.042"`
+	MinPrincipal float64 `json:"min_principal" example:"500"`
+	// EarlyWithdrawal is "allowed", "approval" or "not_allowed"
+	EarlyWithdrawal string `json:"early_withdrawal" example:"allowed"`
+	// RetiredAt is set once the product can no longer be opened
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	UpdatedBy string     `json:"updated_by,omitempty" example:"staff-42"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ProductDefinitionRequest is the payload for defining a product
+// @Description Request payload for creating or changing a deposit product
+type ProductDefinitionRequest struct {
+	Name         string  `json:"name" example:"9-month deposit" validate:"notblank,max=100"`
+	TermMonths   int     `json:"term_months" example:"9" validate:"gte=1,lte=120"`
+	Rate         float64 `json:"rate" example:"0.042" validate:"gte=0,lt=1"`
+	MinPrincipal float64 `json:"min_principal,omitempty" example:"500" validate:"gte=0,max_principal"`
+	// EarlyWithdrawal defaults to "allowed"
+	EarlyWithdrawal string `json:"early_withdrawal,omitempty" example:"approval" validate:"omitempty,oneof=allowed approval not_allowed"`
+}
+
+// builtinProducts are the products the products table starts with. The
+// catalog holds them until it is first loaded.
+var builtinProducts = []*ProductDefinition{
+	{Code: "3m", Name: "3-month deposit", TermMonths: 3, Rate: 0.02, EarlyWithdrawal: EarlyWithdrawalAllowed},
+	{Code: "6m", Name: "6-month deposit", TermMonths: 6, Rate: 0.035, EarlyWithdrawal: EarlyWithdrawalAllowed},
+	{Code: "1y", Name: "1-year deposit", TermMonths: 12, Rate: 0.05, EarlyWithdrawal: EarlyWithdrawalAllowed},
+	{Code: "3y", Name: "3-year deposit", TermMonths: 36, Rate: 0.10, EarlyWithdrawal: EarlyWithdrawalAllowed},
+}
+
+// productCatalog is the deposit products a process knows, by code. Periods
+// are checked against it wherever requests are validated, so it is kept in
+// memory and reloaded from the products table by watchProducts and after
+// every change made through this process.
+type productCatalog struct {
+	mu       sync.RWMutex
+	products map[string]*ProductDefinition
+}
+
+// catalog is the process's product catalog
+var catalog = newProductCatalog(builtinProducts)
+
+func newProductCatalog(products []*ProductDefinition) *productCatalog {
+	c := &productCatalog{}
+	c.replace(products)
+	return c
+}
+
+// replace swaps the catalog's products for products
+func (c *productCatalog) replace(products []*ProductDefinition) {
+	byCode := make(map[string]*ProductDefinition, len(products))
+	for _, p := range products {
+		byCode[p.Code] = p
+	}
+	c.mu.Lock()
+	c.products = byCode
+	c.mu.Unlock()
+}
+
+// get returns the product with code, retired or not
+func (c *productCatalog) get(code string) (*ProductDefinition, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p, ok := c.products[code]
+	return p, ok
+}
+
+// offered returns the products that can be opened, shortest term first
+func (c *productCatalog) offered() []*ProductDefinition {
+	c.mu.RLock()
+	products := make([]*ProductDefinition, 0, len(c.products))
+	for _, p := range c.products {
+		if p.RetiredAt == nil {
+			products = append(products, p)
+		}
+	}
+	c.mu.RUnlock()
+	sortProducts(products)
+	return products
+}
+
+// sortProducts orders products shortest term first, then by code
+func sortProducts(products []*ProductDefinition) {
+	sort.Slice(products, func(i, j int) bool {
+		if products[i].TermMonths != products[j].TermMonths {
+			return products[i].TermMonths < products[j].TermMonths
+		}
+		return products[i].Code < products[j].Code
+	})
+}
+
+// validPeriods lists the codes of the products that can be opened, for
+// error messages
+func validPeriods() string {
+	offered := catalog.offered()
+	codes := make([]string, len(offered))
+	for i, p := range offered {
+		codes[i] = p.Code
+	}
+	return strings.Join(codes, ", ")
+}
+
+// earlyWithdrawalRule returns what the product of period allows when an
+// account is closed before maturity
+func earlyWithdrawalRule(period string) string {
+	if p, ok := catalog.get(period); ok && p.EarlyWithdrawal != "" {
+		return p.EarlyWithdrawal
+	}
+	return EarlyWithdrawalAllowed
+}
+
+// checkMinPrincipal returns a *LimitViolation when principal is below the
+// minimum of the product of period
+func checkMinPrincipal(period string, principal float64) error {
+	p, ok := catalog.get(period)
+	if !ok || principal >= p.MinPrincipal {
+		return nil
+	}
+	return &LimitViolation{Rule: RuleMinPrincipal, Limit: p.MinPrincipal,
+		Message: fmt.Sprintf("principal must be at least %.2f for %s accounts", p.MinPrincipal, period)}
+}
+
+// loadProducts replaces the catalog with the products in repo
+func loadProducts(ctx context.Context, repo Repository) error {
+	products, err := repo.ListProductDefinitions(ctx)
+	if err != nil {
+		return err
+	}
+	catalog.replace(products)
+	return nil
+}
+
+// watchProducts loads the catalog, then reloads it every
+// productRefreshInterval until ctx ends. Only the first load must succeed;
+// after that a failed reload keeps the products already loaded.
+func watchProducts(ctx context.Context, repo Repository, logger *zap.Logger) error {
+	if err := loadProducts(ctx, repo); err != nil {
+		return fmt.Errorf("load products: %w", err)
+	}
+	go func() {
+		ticker := time.NewTicker(productRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := loadProducts(ctx, repo); err != nil && ctx.Err() == nil {
+					logger.Warn("Failed to reload products", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// ListProductDefinitions returns every product, retired ones included,
+// shortest term first
+func (s *service) ListProductDefinitions(ctx context.Context) ([]*ProductDefinition, error) {
+	products, err := s.repo.ListProductDefinitions(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to list products", zap.Error(err))
+		return nil, err
+	}
+	if products == nil {
+		products = []*ProductDefinition{}
+	}
+	sortProducts(products)
+	return products, nil
+}
+
+// SaveProductDefinition creates the product with code, or replaces its
+// definition, and offers it again if it was retired. Accounts already open
+// keep their rate and maturity date; a changed term applies from their next
+// rollover.
+func (s *service) SaveProductDefinition(ctx context.Context, code, staffID string, req *ProductDefinitionRequest) (*ProductDefinition, error) {
+	product := &ProductDefinition{
+		Code:            code,
+		Name:            strings.TrimSpace(req.Name),
+		TermMonths:      req.TermMonths,
+		Rate:            req.Rate,
+		MinPrincipal:    req.MinPrincipal,
+		EarlyWithdrawal: req.EarlyWithdrawal,
+		UpdatedBy:       staffID,
+	}
+	if product.EarlyWithdrawal == "" {
+		product.EarlyWithdrawal = EarlyWithdrawalAllowed
+	}
+	if err := s.repo.SaveProductDefinition(ctx, product); err != nil {
+		s.log(ctx).Error("Failed to save product", zap.Error(err), zap.String("product", code))
+		return nil, err
+	}
+	s.reloadProducts(ctx)
+	s.log(ctx).Info("Product saved", zap.String("product", code), zap.Int("termMonths", product.TermMonths),
+		zap.Float64("rate", product.Rate), zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Product %s defined", code),
+		map[string]any{"setting": "product", "product": code, "term_months": product.TermMonths, "rate": product.Rate,
+			"min_principal": product.MinPrincipal, "early_withdrawal": product.EarlyWithdrawal, "changed_by": staffID})
+	return product, nil
+}
+
+// RetireProduct stops the product being opened. Accounts already open on it
+// keep maturing and rolling over. It returns sql.ErrNoRows when there is no
+// such product.
+func (s *service) RetireProduct(ctx context.Context, code, staffID string) error {
+	if err := s.repo.RetireProduct(ctx, code, staffID); err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to retire product", zap.Error(err), zap.String("product", code))
+		}
+		return err
+	}
+	s.reloadProducts(ctx)
+	s.log(ctx).Info("Product retired", zap.String("product", code), zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Product %s retired", code),
+		map[string]any{"setting": "product", "product": code, "retired": true, "changed_by": staffID})
+	return nil
+}
+
+// reloadProducts reloads the catalog after a change, so this process offers
+// the change at once. Other processes pick it up within
+// productRefreshInterval.
+func (s *service) reloadProducts(ctx context.Context) {
+	if err := loadProducts(ctx, s.repo); err != nil {
+		s.log(ctx).Warn("Failed to reload products", zap.Error(err))
+	}
+}
+
+// listProductDefinitionsHandler godoc
+// @Summary List product definitions
+// @Description Lists every deposit product with its term, built-in rate, minimum principal and early withdrawal rule, retired ones included. Platform operators only.
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]ProductDefinition}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/products [get]
+func listProductDefinitionsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	products, err := svc.ListProductDefinitions(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, products, "Products retrieved successfully")
+}
+
+// saveProductDefinitionHandler godoc
+// @Summary Define a product
+// @Description Creates a deposit product, or replaces its definition, and offers it again if it was retired. Accounts already open keep their rate and maturity date. Every process offers the change within a minute. Platform operators only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param code path string true "Product code, stored as the period of its accounts"
+// @Param product body ProductDefinitionRequest true "Product"
+// @Param X-Staff-ID header string false "Staff member, set by the gateway"
+// @Success 200 {object} ProductDefinition
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/products/{code} [put]
+func saveProductDefinitionHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	markWrite(w)
+
+	code := chi.URLParam(r, "code")
+	if !productCodePattern.MatchString(code) {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidPeriod, "product code must be 1 to 16 lowercase letters, digits, dashes and underscores, starting with a letter or digit")
+		return
+	}
+
+	var req ProductDefinitionRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	product, err := svc.SaveProductDefinition(ctx, code, r.Header.Get(StaffIDHeader), &req)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, r, product, "Product saved successfully")
+}
+
+// retireProductHandler godoc
+// @Summary Retire a product
+// @Description Stops a deposit product being opened. Accounts already open on it keep maturing and rolling over. Defining the product again offers it again. Platform operators only.
+// @Tags admin
+// @Param code path string true "Product code"
+// @Param X-Staff-ID header string false "Staff member, set by the gateway"
+// @Success 204 {string} string "No Content"
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/products/{code} [delete]
+func retireProductHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	markWrite(w)
+
+	ctx := r.Context()
+
+	if err := svc.RetireProduct(ctx, chi.URLParam(r, "code"), r.Header.Get(StaffIDHeader)); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Product does not exist or is already retired")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCustomProduct(t *testing.T) {
+	api := newTestAPI(t)
+	if w := api.do(http.MethodPut, "/v2/admin/products/9m",
+		`{"name":"9-month deposit","term_months":9,"rate":0.042,"min_principal":500,"early_withdrawal":"not_allowed"}`); w.Code != http.StatusOK {
+		t.Fatalf("define: %d %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"below the minimum", `{"user_id":1,"principal":100,"product_code":"9m"}`, http.StatusUnprocessableEntity, CodeLimitExceeded},
+		{"period and product code differ", `{"user_id":1,"principal":1000,"period":"1y","product_code":"9m"}`, http.StatusBadRequest, CodeInvalidPeriod},
+		{"neither period nor product code", `{"user_id":1,"principal":1000}`, http.StatusBadRequest, CodeFieldRequired},
+		{"unknown product code", `{"user_id":1,"principal":1000,"product_code":"2y"}`, http.StatusBadRequest, CodeInvalidPeriod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := api.do(http.MethodPost, "/v2/block-account", tt.body)
+			if w.Code != tt.status || errorCode(w) != tt.code {
+				t.Errorf("create = %d %s, want %d %s", w.Code, w.Body, tt.status, tt.code)
+			}
+		})
+	}
+
+	var account BlockAccount
+	api.create(http.MethodPost, "/v2/block-account", `{"user_id":1,"principal":1000,"product_code":"9m"}`, &account)
+	if account.Period != "9m" || account.InterestRate != 0.042 {
+		t.Errorf("account = %+v, want a 9m account at 4.2%%", account)
+	}
+	if months := monthsBetween(account.StartDate, account.EndDate); months != 9 {
+		t.Errorf("term = %d months, want 9", months)
+	}
+
+	var products struct {
+		Items []*Product `json:"items"`
+	}
+	decodeData(t, api.do(http.MethodGet, "/v2/products", "").Body.Bytes(), &products)
+	if n := len(products.Items); n != 5 || products.Items[2].Period != "9m" || products.Items[2].MinPrincipal != 500 {
+		t.Errorf("products = %+v, want 9m third of five", products.Items)
+	}
+
+	w := api.do(http.MethodPost, "/v2/block-account/"+account.ExternalID+"/close", `{"destination_account":"1000123456789","method":"bank_transfer"}`,
+		"If-Match", api.etag(account.ExternalID))
+	if w.Code != http.StatusConflict || errorCode(w) != CodeEarlyWithdrawalNotAllowed {
+		t.Errorf("early close = %d %s, want 409 %s", w.Code, w.Body, CodeEarlyWithdrawalNotAllowed)
+	}
+
+	if w := api.do(http.MethodDelete, "/v2/admin/products/9m", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("retire: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodPost, "/v2/block-account", `{"user_id":1,"principal":1000,"product_code":"9m"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("create retired = %d %s, want 400", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodGet, "/v2/block-account/"+account.ExternalID+"/payout-schedule", ""); w.Code != http.StatusOK {
+		t.Errorf("payout schedule of a retired product's account = %d %s, want 200", w.Code, w.Body)
+	}
+}
+
+// monthsBetween counts the whole calendar months from start to end,
+// ignoring the business day adjustment of end
+func monthsBetween(start, end time.Time) int {
+	months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	if end.Day() < start.Day()-3 {
+		months--
+	}
+	return months
+}
+
+func TestCompareProducts(t *testing.T) {
+	api := newTestAPI(t)
+	if w := api.do(http.MethodPut, "/v2/admin/products/9m",
+		`{"name":"9-month deposit","term_months":9,"rate":0.042,"min_principal":50000}`); w.Code != http.StatusOK {
+		t.Fatalf("define: %d %s", w.Code, w.Body)
+	}
+
+	for _, query := range []string{"", "?principal=0", "?principal=abc", "?principal=1e13"} {
+		if w := api.do(http.MethodGet, "/v2/products/compare"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: %d %s, want 400", query, w.Code, w.Body)
+		}
+	}
+
+	var comparison ProductComparison
+	api.create(http.MethodGet, "/v2/products/compare?principal=10000", "", &comparison)
+	if comparison.Principal != 10000 || len(comparison.Products) != 5 {
+		t.Fatalf("comparison = %+v, want five products", comparison)
+	}
+	for _, q := range comparison.Products {
+		if q.GrossInterest <= 0 || q.NetInterest != roundMoney(q.GrossInterest-q.TaxWithheld) ||
+			q.MaturityValue != roundMoney(10000+q.NetInterest) || !q.MaturityDate.After(comparison.QuotedAt) {
+			t.Errorf("quote = %+v", q)
+		}
+		if q.Eligible != (q.Period != "9m") {
+			t.Errorf("%s eligible = %v", q.Period, q.Eligible)
+		}
+	}
+
+	// The quote is what an account opened at the same moment earns
+	var account BlockAccount
+	api.create(http.MethodPost, "/v2/block-account", `{"user_id":1,"principal":10000,"period":"1y"}`, &account)
+	for _, q := range comparison.Products {
+		if q.Period == "1y" && q.GrossInterest != roundMoney(interestBetween(&account, account.StartDate, account.EndDate)) {
+			t.Errorf("1y gross = %v, account earns %v", q.GrossInterest, interestBetween(&account, account.StartDate, account.EndDate))
+		}
+	}
+}
@@ -0,0 +1,609 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: blockaccount/v1/block_account.proto
+
+package blockaccountv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type BlockAccount struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Id           int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	UserId       int64                  `protobuf:"varint,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Principal    float64                `protobuf:"fixed64,3,opt,name=principal,proto3" json:"principal,omitempty"`
+	StartDate    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=start_date,json=startDate,proto3" json:"start_date,omitempty"`
+	EndDate      *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=end_date,json=endDate,proto3" json:"end_date,omitempty"`
+	InterestRate float64                `protobuf:"fixed64,6,opt,name=interest_rate,json=interestRate,proto3" json:"interest_rate,omitempty"`
+	// Term code: 3m, 6m, 1y or 3y.
+	Period string `protobuf:"bytes,7,opt,name=period,proto3" json:"period,omitempty"`
+	// active, matured, rolled_over or payout_failed.
+	Status string `protobuf:"bytes,8,opt,name=status,proto3" json:"status,omitempty"`
+	// payout or rollover.
+	MaturityInstruction string                 `protobuf:"bytes,9,opt,name=maturity_instruction,json=maturityInstruction,proto3" json:"maturity_instruction,omitempty"`
+	PayoutDestination   string                 `protobuf:"bytes,10,opt,name=payout_destination,json=payoutDestination,proto3" json:"payout_destination,omitempty"`
+	CreatedAt           *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt           *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *BlockAccount) Reset() {
+	*x = BlockAccount{}
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockAccount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockAccount) ProtoMessage() {}
+
+func (x *BlockAccount) ProtoReflect() protoreflect.Message {
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockAccount.ProtoReflect.Descriptor instead.
+func (*BlockAccount) Descriptor() ([]byte, []int) {
+	return file_blockaccount_v1_block_account_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *BlockAccount) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *BlockAccount) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *BlockAccount) GetPrincipal() float64 {
+	if x != nil {
+		return x.Principal
+	}
+	return 0
+}
+
+func (x *BlockAccount) GetStartDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartDate
+	}
+	return nil
+}
+
+func (x *BlockAccount) GetEndDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndDate
+	}
+	return nil
+}
+
+func (x *BlockAccount) GetInterestRate() float64 {
+	if x != nil {
+		return x.InterestRate
+	}
+	return 0
+}
+
+func (x *BlockAccount) GetPeriod() string {
+	if x != nil {
+		return x.Period
+	}
+	return ""
+}
+
+func (x *BlockAccount) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *BlockAccount) GetMaturityInstruction() string {
+	if x != nil {
+		return x.MaturityInstruction
+	}
+	return ""
+}
+
+func (x *BlockAccount) GetPayoutDestination() string {
+	if x != nil {
+		return x.PayoutDestination
+	}
+	return ""
+}
+
+func (x *BlockAccount) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *BlockAccount) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type CreateBlockAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Principal     float64                `protobuf:"fixed64,2,opt,name=principal,proto3" json:"principal,omitempty"`
+	Period        string                 `protobuf:"bytes,3,opt,name=period,proto3" json:"period,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateBlockAccountRequest) Reset() {
+	*x = CreateBlockAccountRequest{}
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateBlockAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateBlockAccountRequest) ProtoMessage() {}
+
+func (x *CreateBlockAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateBlockAccountRequest.ProtoReflect.Descriptor instead.
+func (*CreateBlockAccountRequest) Descriptor() ([]byte, []int) {
+	return file_blockaccount_v1_block_account_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateBlockAccountRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+func (x *CreateBlockAccountRequest) GetPrincipal() float64 {
+	if x != nil {
+		return x.Principal
+	}
+	return 0
+}
+
+func (x *CreateBlockAccountRequest) GetPeriod() string {
+	if x != nil {
+		return x.Period
+	}
+	return ""
+}
+
+type GetBlockAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBlockAccountRequest) Reset() {
+	*x = GetBlockAccountRequest{}
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBlockAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBlockAccountRequest) ProtoMessage() {}
+
+func (x *GetBlockAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBlockAccountRequest.ProtoReflect.Descriptor instead.
+func (*GetBlockAccountRequest) Descriptor() ([]byte, []int) {
+	return file_blockaccount_v1_block_account_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetBlockAccountRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type ListUserBlockAccountsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        int64                  `protobuf:"varint,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListUserBlockAccountsRequest) Reset() {
+	*x = ListUserBlockAccountsRequest{}
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListUserBlockAccountsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListUserBlockAccountsRequest) ProtoMessage() {}
+
+func (x *ListUserBlockAccountsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListUserBlockAccountsRequest.ProtoReflect.Descriptor instead.
+func (*ListUserBlockAccountsRequest) Descriptor() ([]byte, []int) {
+	return file_blockaccount_v1_block_account_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListUserBlockAccountsRequest) GetUserId() int64 {
+	if x != nil {
+		return x.UserId
+	}
+	return 0
+}
+
+type ListUserBlockAccountsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accounts      []*BlockAccount        `protobuf:"bytes,1,rep,name=accounts,proto3" json:"accounts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListUserBlockAccountsResponse) Reset() {
+	*x = ListUserBlockAccountsResponse{}
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListUserBlockAccountsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListUserBlockAccountsResponse) ProtoMessage() {}
+
+func (x *ListUserBlockAccountsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListUserBlockAccountsResponse.ProtoReflect.Descriptor instead.
+func (*ListUserBlockAccountsResponse) Descriptor() ([]byte, []int) {
+	return file_blockaccount_v1_block_account_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListUserBlockAccountsResponse) GetAccounts() []*BlockAccount {
+	if x != nil {
+		return x.Accounts
+	}
+	return nil
+}
+
+type DeleteBlockAccountRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteBlockAccountRequest) Reset() {
+	*x = DeleteBlockAccountRequest{}
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteBlockAccountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteBlockAccountRequest) ProtoMessage() {}
+
+func (x *DeleteBlockAccountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteBlockAccountRequest.ProtoReflect.Descriptor instead.
+func (*DeleteBlockAccountRequest) Descriptor() ([]byte, []int) {
+	return file_blockaccount_v1_block_account_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteBlockAccountRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeleteBlockAccountResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteBlockAccountResponse) Reset() {
+	*x = DeleteBlockAccountResponse{}
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteBlockAccountResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteBlockAccountResponse) ProtoMessage() {}
+
+func (x *DeleteBlockAccountResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteBlockAccountResponse.ProtoReflect.Descriptor instead.
+func (*DeleteBlockAccountResponse) Descriptor() ([]byte, []int) {
+	return file_blockaccount_v1_block_account_proto_rawDescGZIP(), []int{6}
+}
+
+type ChangeMaturityInstructionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// payout or rollover.
+	Instruction string `protobuf:"bytes,2,opt,name=instruction,proto3" json:"instruction,omitempty"`
+	// Account to pay out to; required for payout.
+	DestinationAccount string `protobuf:"bytes,3,opt,name=destination_account,json=destinationAccount,proto3" json:"destination_account,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *ChangeMaturityInstructionRequest) Reset() {
+	*x = ChangeMaturityInstructionRequest{}
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChangeMaturityInstructionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChangeMaturityInstructionRequest) ProtoMessage() {}
+
+func (x *ChangeMaturityInstructionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blockaccount_v1_block_account_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChangeMaturityInstructionRequest.ProtoReflect.Descriptor instead.
+func (*ChangeMaturityInstructionRequest) Descriptor() ([]byte, []int) {
+	return file_blockaccount_v1_block_account_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ChangeMaturityInstructionRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ChangeMaturityInstructionRequest) GetInstruction() string {
+	if x != nil {
+		return x.Instruction
+	}
+	return ""
+}
+
+func (x *ChangeMaturityInstructionRequest) GetDestinationAccount() string {
+	if x != nil {
+		return x.DestinationAccount
+	}
+	return ""
+}
+
+var File_blockaccount_v1_block_account_proto protoreflect.FileDescriptor
+
+const file_blockaccount_v1_block_account_proto_rawDesc = "" +
+	"\n" +
+	"#blockaccount/v1/block_account.proto\x12\x0fblockaccount.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xf4\x03\n" +
+	"\fBlockAccount\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\x03R\x06userId\x12\x1c\n" +
+	"\tprincipal\x18\x03 \x01(\x01R\tprincipal\x129\n" +
+	"\n" +
+	"start_date\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tstartDate\x125\n" +
+	"\bend_date\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\aendDate\x12#\n" +
+	"\rinterest_rate\x18\x06 \x01(\x01R\finterestRate\x12\x16\n" +
+	"\x06period\x18\a \x01(\tR\x06period\x12\x16\n" +
+	"\x06status\x18\b \x01(\tR\x06status\x121\n" +
+	"\x14maturity_instruction\x18\t \x01(\tR\x13maturityInstruction\x12-\n" +
+	"\x12payout_destination\x18\n" +
+	" \x01(\tR\x11payoutDestination\x129\n" +
+	"\n" +
+	"created_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"j\n" +
+	"\x19CreateBlockAccountRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\x12\x1c\n" +
+	"\tprincipal\x18\x02 \x01(\x01R\tprincipal\x12\x16\n" +
+	"\x06period\x18\x03 \x01(\tR\x06period\"(\n" +
+	"\x16GetBlockAccountRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"7\n" +
+	"\x1cListUserBlockAccountsRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\x03R\x06userId\"Z\n" +
+	"\x1dListUserBlockAccountsResponse\x129\n" +
+	"\baccounts\x18\x01 \x03(\v2\x1d.blockaccount.v1.BlockAccountR\baccounts\"+\n" +
+	"\x19DeleteBlockAccountRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\"\x1c\n" +
+	"\x1aDeleteBlockAccountResponse\"\x85\x01\n" +
+	" ChangeMaturityInstructionRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12 \n" +
+	"\vinstruction\x18\x02 \x01(\tR\vinstruction\x12/\n" +
+	"\x13destination_account\x18\x03 \x01(\tR\x12destinationAccount2\xa7\x04\n" +
+	"\x13BlockAccountService\x12_\n" +
+	"\x12CreateBlockAccount\x12*.blockaccount.v1.CreateBlockAccountRequest\x1a\x1d.blockaccount.v1.BlockAccount\x12Y\n" +
+	"\x0fGetBlockAccount\x12'.blockaccount.v1.GetBlockAccountRequest\x1a\x1d.blockaccount.v1.BlockAccount\x12v\n" +
+	"\x15ListUserBlockAccounts\x12-.blockaccount.v1.ListUserBlockAccountsRequest\x1a..blockaccount.v1.ListUserBlockAccountsResponse\x12m\n" +
+	"\x12DeleteBlockAccount\x12*.blockaccount.v1.DeleteBlockAccountRequest\x1a+.blockaccount.v1.DeleteBlockAccountResponse\x12m\n" +
+	"\x19ChangeMaturityInstruction\x121.blockaccount.v1.ChangeMaturityInstructionRequest\x1a\x1d.blockaccount.v1.BlockAccountB.Z,main.go/proto/blockaccount/v1;blockaccountv1b\x06proto3"
+
+var (
+	file_blockaccount_v1_block_account_proto_rawDescOnce sync.Once
+	file_blockaccount_v1_block_account_proto_rawDescData []byte
+)
+
+func file_blockaccount_v1_block_account_proto_rawDescGZIP() []byte {
+	file_blockaccount_v1_block_account_proto_rawDescOnce.Do(func() {
+		file_blockaccount_v1_block_account_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_blockaccount_v1_block_account_proto_rawDesc), len(file_blockaccount_v1_block_account_proto_rawDesc)))
+	})
+	return file_blockaccount_v1_block_account_proto_rawDescData
+}
+
+var file_blockaccount_v1_block_account_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_blockaccount_v1_block_account_proto_goTypes = []any{
+	(*BlockAccount)(nil),                     // 0: blockaccount.v1.BlockAccount
+	(*CreateBlockAccountRequest)(nil),        // 1: blockaccount.v1.CreateBlockAccountRequest
+	(*GetBlockAccountRequest)(nil),           // 2: blockaccount.v1.GetBlockAccountRequest
+	(*ListUserBlockAccountsRequest)(nil),     // 3: blockaccount.v1.ListUserBlockAccountsRequest
+	(*ListUserBlockAccountsResponse)(nil),    // 4: blockaccount.v1.ListUserBlockAccountsResponse
+	(*DeleteBlockAccountRequest)(nil),        // 5: blockaccount.v1.DeleteBlockAccountRequest
+	(*DeleteBlockAccountResponse)(nil),       // 6: blockaccount.v1.DeleteBlockAccountResponse
+	(*ChangeMaturityInstructionRequest)(nil), // 7: blockaccount.v1.ChangeMaturityInstructionRequest
+	(*timestamppb.Timestamp)(nil),            // 8: google.protobuf.Timestamp
+}
+var file_blockaccount_v1_block_account_proto_depIdxs = []int32{
+	8,  // 0: blockaccount.v1.BlockAccount.start_date:type_name -> google.protobuf.Timestamp
+	8,  // 1: blockaccount.v1.BlockAccount.end_date:type_name -> google.protobuf.Timestamp
+	8,  // 2: blockaccount.v1.BlockAccount.created_at:type_name -> google.protobuf.Timestamp
+	8,  // 3: blockaccount.v1.BlockAccount.updated_at:type_name -> google.protobuf.Timestamp
+	0,  // 4: blockaccount.v1.ListUserBlockAccountsResponse.accounts:type_name -> blockaccount.v1.BlockAccount
+	1,  // 5: blockaccount.v1.BlockAccountService.CreateBlockAccount:input_type -> blockaccount.v1.CreateBlockAccountRequest
+	2,  // 6: blockaccount.v1.BlockAccountService.GetBlockAccount:input_type -> blockaccount.v1.GetBlockAccountRequest
+	3,  // 7: blockaccount.v1.BlockAccountService.ListUserBlockAccounts:input_type -> blockaccount.v1.ListUserBlockAccountsRequest
+	5,  // 8: blockaccount.v1.BlockAccountService.DeleteBlockAccount:input_type -> blockaccount.v1.DeleteBlockAccountRequest
+	7,  // 9: blockaccount.v1.BlockAccountService.ChangeMaturityInstruction:input_type -> blockaccount.v1.ChangeMaturityInstructionRequest
+	0,  // 10: blockaccount.v1.BlockAccountService.CreateBlockAccount:output_type -> blockaccount.v1.BlockAccount
+	0,  // 11: blockaccount.v1.BlockAccountService.GetBlockAccount:output_type -> blockaccount.v1.BlockAccount
+	4,  // 12: blockaccount.v1.BlockAccountService.ListUserBlockAccounts:output_type -> blockaccount.v1.ListUserBlockAccountsResponse
+	6,  // 13: blockaccount.v1.BlockAccountService.DeleteBlockAccount:output_type -> blockaccount.v1.DeleteBlockAccountResponse
+	0,  // 14: blockaccount.v1.BlockAccountService.ChangeMaturityInstruction:output_type -> blockaccount.v1.BlockAccount
+	10, // [10:15] is the sub-list for method output_type
+	5,  // [5:10] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_blockaccount_v1_block_account_proto_init() }
+func file_blockaccount_v1_block_account_proto_init() {
+	if File_blockaccount_v1_block_account_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_blockaccount_v1_block_account_proto_rawDesc), len(file_blockaccount_v1_block_account_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_blockaccount_v1_block_account_proto_goTypes,
+		DependencyIndexes: file_blockaccount_v1_block_account_proto_depIdxs,
+		MessageInfos:      file_blockaccount_v1_block_account_proto_msgTypes,
+	}.Build()
+	File_blockaccount_v1_block_account_proto = out.File
+	file_blockaccount_v1_block_account_proto_goTypes = nil
+	file_blockaccount_v1_block_account_proto_depIdxs = nil
+}
@@ -0,0 +1,291 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: blockaccount/v1/block_account.proto
+
+package blockaccountv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	BlockAccountService_CreateBlockAccount_FullMethodName        = "/blockaccount.v1.BlockAccountService/CreateBlockAccount"
+	BlockAccountService_GetBlockAccount_FullMethodName           = "/blockaccount.v1.BlockAccountService/GetBlockAccount"
+	BlockAccountService_ListUserBlockAccounts_FullMethodName     = "/blockaccount.v1.BlockAccountService/ListUserBlockAccounts"
+	BlockAccountService_DeleteBlockAccount_FullMethodName        = "/blockaccount.v1.BlockAccountService/DeleteBlockAccount"
+	BlockAccountService_ChangeMaturityInstruction_FullMethodName = "/blockaccount.v1.BlockAccountService/ChangeMaturityInstruction"
+)
+
+// BlockAccountServiceClient is the client API for BlockAccountService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// BlockAccountService manages fixed-term block accounts. It shares its
+// business logic with the REST API; errors use the standard gRPC codes
+// (INVALID_ARGUMENT, NOT_FOUND, FAILED_PRECONDITION, INTERNAL).
+type BlockAccountServiceClient interface {
+	// CreateBlockAccount opens a deposit for the given period at its current rate.
+	CreateBlockAccount(ctx context.Context, in *CreateBlockAccountRequest, opts ...grpc.CallOption) (*BlockAccount, error)
+	// GetBlockAccount returns one account.
+	GetBlockAccount(ctx context.Context, in *GetBlockAccountRequest, opts ...grpc.CallOption) (*BlockAccount, error)
+	// ListUserBlockAccounts returns all of a user's accounts, newest first.
+	ListUserBlockAccounts(ctx context.Context, in *ListUserBlockAccountsRequest, opts ...grpc.CallOption) (*ListUserBlockAccountsResponse, error)
+	// DeleteBlockAccount deletes an account.
+	DeleteBlockAccount(ctx context.Context, in *DeleteBlockAccountRequest, opts ...grpc.CallOption) (*DeleteBlockAccountResponse, error)
+	// ChangeMaturityInstruction sets what happens at maturity, up to the cutoff before the end date.
+	ChangeMaturityInstruction(ctx context.Context, in *ChangeMaturityInstructionRequest, opts ...grpc.CallOption) (*BlockAccount, error)
+}
+
+type blockAccountServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBlockAccountServiceClient(cc grpc.ClientConnInterface) BlockAccountServiceClient {
+	return &blockAccountServiceClient{cc}
+}
+
+func (c *blockAccountServiceClient) CreateBlockAccount(ctx context.Context, in *CreateBlockAccountRequest, opts ...grpc.CallOption) (*BlockAccount, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BlockAccount)
+	err := c.cc.Invoke(ctx, BlockAccountService_CreateBlockAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blockAccountServiceClient) GetBlockAccount(ctx context.Context, in *GetBlockAccountRequest, opts ...grpc.CallOption) (*BlockAccount, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BlockAccount)
+	err := c.cc.Invoke(ctx, BlockAccountService_GetBlockAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blockAccountServiceClient) ListUserBlockAccounts(ctx context.Context, in *ListUserBlockAccountsRequest, opts ...grpc.CallOption) (*ListUserBlockAccountsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListUserBlockAccountsResponse)
+	err := c.cc.Invoke(ctx, BlockAccountService_ListUserBlockAccounts_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blockAccountServiceClient) DeleteBlockAccount(ctx context.Context, in *DeleteBlockAccountRequest, opts ...grpc.CallOption) (*DeleteBlockAccountResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteBlockAccountResponse)
+	err := c.cc.Invoke(ctx, BlockAccountService_DeleteBlockAccount_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blockAccountServiceClient) ChangeMaturityInstruction(ctx context.Context, in *ChangeMaturityInstructionRequest, opts ...grpc.CallOption) (*BlockAccount, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BlockAccount)
+	err := c.cc.Invoke(ctx, BlockAccountService_ChangeMaturityInstruction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BlockAccountServiceServer is the server API for BlockAccountService service.
+// All implementations must embed UnimplementedBlockAccountServiceServer
+// for forward compatibility.
+//
+// BlockAccountService manages fixed-term block accounts. It shares its
+// business logic with the REST API; errors use the standard gRPC codes
+// (INVALID_ARGUMENT, NOT_FOUND, FAILED_PRECONDITION, INTERNAL).
+type BlockAccountServiceServer interface {
+	// CreateBlockAccount opens a deposit for the given period at its current rate.
+	CreateBlockAccount(context.Context, *CreateBlockAccountRequest) (*BlockAccount, error)
+	// GetBlockAccount returns one account.
+	GetBlockAccount(context.Context, *GetBlockAccountRequest) (*BlockAccount, error)
+	// ListUserBlockAccounts returns all of a user's accounts, newest first.
+	ListUserBlockAccounts(context.Context, *ListUserBlockAccountsRequest) (*ListUserBlockAccountsResponse, error)
+	// DeleteBlockAccount deletes an account.
+	DeleteBlockAccount(context.Context, *DeleteBlockAccountRequest) (*DeleteBlockAccountResponse, error)
+	// ChangeMaturityInstruction sets what happens at maturity, up to the cutoff before the end date.
+	ChangeMaturityInstruction(context.Context, *ChangeMaturityInstructionRequest) (*BlockAccount, error)
+	mustEmbedUnimplementedBlockAccountServiceServer()
+}
+
+// UnimplementedBlockAccountServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBlockAccountServiceServer struct{}
+
+func (UnimplementedBlockAccountServiceServer) CreateBlockAccount(context.Context, *CreateBlockAccountRequest) (*BlockAccount, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateBlockAccount not implemented")
+}
+func (UnimplementedBlockAccountServiceServer) GetBlockAccount(context.Context, *GetBlockAccountRequest) (*BlockAccount, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlockAccount not implemented")
+}
+func (UnimplementedBlockAccountServiceServer) ListUserBlockAccounts(context.Context, *ListUserBlockAccountsRequest) (*ListUserBlockAccountsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUserBlockAccounts not implemented")
+}
+func (UnimplementedBlockAccountServiceServer) DeleteBlockAccount(context.Context, *DeleteBlockAccountRequest) (*DeleteBlockAccountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteBlockAccount not implemented")
+}
+func (UnimplementedBlockAccountServiceServer) ChangeMaturityInstruction(context.Context, *ChangeMaturityInstructionRequest) (*BlockAccount, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeMaturityInstruction not implemented")
+}
+func (UnimplementedBlockAccountServiceServer) mustEmbedUnimplementedBlockAccountServiceServer() {}
+func (UnimplementedBlockAccountServiceServer) testEmbeddedByValue()                             {}
+
+// UnsafeBlockAccountServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BlockAccountServiceServer will
+// result in compilation errors.
+type UnsafeBlockAccountServiceServer interface {
+	mustEmbedUnimplementedBlockAccountServiceServer()
+}
+
+func RegisterBlockAccountServiceServer(s grpc.ServiceRegistrar, srv BlockAccountServiceServer) {
+	// If the following call pancis, it indicates UnimplementedBlockAccountServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&BlockAccountService_ServiceDesc, srv)
+}
+
+func _BlockAccountService_CreateBlockAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateBlockAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockAccountServiceServer).CreateBlockAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BlockAccountService_CreateBlockAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockAccountServiceServer).CreateBlockAccount(ctx, req.(*CreateBlockAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlockAccountService_GetBlockAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlockAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockAccountServiceServer).GetBlockAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BlockAccountService_GetBlockAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockAccountServiceServer).GetBlockAccount(ctx, req.(*GetBlockAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlockAccountService_ListUserBlockAccounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUserBlockAccountsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockAccountServiceServer).ListUserBlockAccounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BlockAccountService_ListUserBlockAccounts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockAccountServiceServer).ListUserBlockAccounts(ctx, req.(*ListUserBlockAccountsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlockAccountService_DeleteBlockAccount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBlockAccountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockAccountServiceServer).DeleteBlockAccount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BlockAccountService_DeleteBlockAccount_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockAccountServiceServer).DeleteBlockAccount(ctx, req.(*DeleteBlockAccountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlockAccountService_ChangeMaturityInstruction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangeMaturityInstructionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlockAccountServiceServer).ChangeMaturityInstruction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BlockAccountService_ChangeMaturityInstruction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlockAccountServiceServer).ChangeMaturityInstruction(ctx, req.(*ChangeMaturityInstructionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// BlockAccountService_ServiceDesc is the grpc.ServiceDesc for BlockAccountService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BlockAccountService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "blockaccount.v1.BlockAccountService",
+	HandlerType: (*BlockAccountServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateBlockAccount",
+			Handler:    _BlockAccountService_CreateBlockAccount_Handler,
+		},
+		{
+			MethodName: "GetBlockAccount",
+			Handler:    _BlockAccountService_GetBlockAccount_Handler,
+		},
+		{
+			MethodName: "ListUserBlockAccounts",
+			Handler:    _BlockAccountService_ListUserBlockAccounts_Handler,
+		},
+		{
+			MethodName: "DeleteBlockAccount",
+			Handler:    _BlockAccountService_DeleteBlockAccount_Handler,
+		},
+		{
+			MethodName: "ChangeMaturityInstruction",
+			Handler:    _BlockAccountService_ChangeMaturityInstruction_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "blockaccount/v1/block_account.proto",
+}
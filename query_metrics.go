@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// timedRepository measures the latency of the queries on the read path, and
+// the account insert, into queryDuration. It sits under the read cache so it
+// times the database rather than Redis; everything else passes through.
+type timedRepository struct {
+	Repository
+}
+
+func newTimedRepository(repo Repository) *timedRepository {
+	return &timedRepository{Repository: repo}
+}
+
+// timed runs query, recording how long it took under name, whether it
+// failed or not
+func timed[T any](name string, query func() (T, error)) (T, error) {
+	start := time.Now()
+	v, err := query()
+	queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	return v, err
+}
+
+func (t *timedRepository) CreateAccount(ctx context.Context, a *BlockAccount, admit func(UserExposure, *BlockAccount) error) (*BlockAccount, error) {
+	return timed("create_account", func() (*BlockAccount, error) { return t.Repository.CreateAccount(ctx, a, admit) })
+}
+
+func (t *timedRepository) GetAccount(ctx context.Context, id int) (*BlockAccount, error) {
+	return timed("get_account", func() (*BlockAccount, error) { return t.Repository.GetAccount(ctx, id) })
+}
+
+func (t *timedRepository) GetAccountsByExternalID(ctx context.Context, externalIDs []string) ([]*BlockAccount, error) {
+	return timed("get_accounts_by_external_id", func() ([]*BlockAccount, error) {
+		return t.Repository.GetAccountsByExternalID(ctx, externalIDs)
+	})
+}
+
+func (t *timedRepository) ResolveAccountID(ctx context.Context, externalID string) (int, error) {
+	return timed("resolve_account_id", func() (int, error) { return t.Repository.ResolveAccountID(ctx, externalID) })
+}
+
+func (t *timedRepository) ListAccountsByUser(ctx context.Context, userID int) ([]*BlockAccount, error) {
+	return timed("list_accounts_by_user", func() ([]*BlockAccount, error) {
+		return t.Repository.ListAccountsByUser(ctx, userID)
+	})
+}
+
+func (t *timedRepository) ListAccountsOverlapping(ctx context.Context, userID int, from, to time.Time) ([]*BlockAccount, error) {
+	return timed("list_accounts_overlapping", func() ([]*BlockAccount, error) {
+		return t.Repository.ListAccountsOverlapping(ctx, userID, from, to)
+	})
+}
+
+func (t *timedRepository) ListMaturingBetween(ctx context.Context, from, to time.Time, limit int) ([]*BlockAccount, error) {
+	return timed("list_maturing_between", func() ([]*BlockAccount, error) {
+		return t.Repository.ListMaturingBetween(ctx, from, to, limit)
+	})
+}
+
+func (t *timedRepository) ListAccountsUpdatedAfter(ctx context.Context, updatedAt time.Time, id, limit int) ([]*BlockAccount, error) {
+	return timed("list_accounts_updated_after", func() ([]*BlockAccount, error) {
+		return t.Repository.ListAccountsUpdatedAfter(ctx, updatedAt, id, limit)
+	})
+}
+
+func (t *timedRepository) GetFunding(ctx context.Context, accountID int) (*Funding, error) {
+	return timed("get_funding", func() (*Funding, error) { return t.Repository.GetFunding(ctx, accountID) })
+}
+
+func (t *timedRepository) GetClosure(ctx context.Context, accountID int) (*AccountClosure, error) {
+	return timed("get_closure", func() (*AccountClosure, error) { return t.Repository.GetClosure(ctx, accountID) })
+}
+
+func (t *timedRepository) ListStatusChanges(ctx context.Context, accountID int) ([]*StatusChange, error) {
+	return timed("list_status_changes", func() ([]*StatusChange, error) {
+		return t.Repository.ListStatusChanges(ctx, accountID)
+	})
+}
+
+func (t *timedRepository) ListInterestPayouts(ctx context.Context, accountID int) ([]*InterestPayout, error) {
+	return timed("list_interest_payouts", func() ([]*InterestPayout, error) {
+		return t.Repository.ListInterestPayouts(ctx, accountID)
+	})
+}
+
+func (t *timedRepository) ListPayouts(ctx context.Context, accountID int) ([]*Payout, error) {
+	return timed("list_payouts", func() ([]*Payout, error) { return t.Repository.ListPayouts(ctx, accountID) })
+}
+
+func (t *timedRepository) ListApprovals(ctx context.Context, status string, limit int) ([]*Approval, error) {
+	return timed("list_approvals", func() ([]*Approval, error) { return t.Repository.ListApprovals(ctx, status, limit) })
+}
+
+func (t *timedRepository) ListComplianceFlags(ctx context.Context, status string, limit int) ([]*ComplianceFlag, error) {
+	return timed("list_compliance_flags", func() ([]*ComplianceFlag, error) {
+		return t.Repository.ListComplianceFlags(ctx, status, limit)
+	})
+}
+
+func (t *timedRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	return timed("get_api_key_by_prefix", func() (*APIKey, error) { return t.Repository.GetAPIKeyByPrefix(ctx, prefix) })
+}
+
+func (t *timedRepository) GetTenant(ctx context.Context, id string) (*Tenant, error) {
+	return timed("get_tenant", func() (*Tenant, error) { return t.Repository.GetTenant(ctx, id) })
+}
+
+func (t *timedRepository) PortfolioGroups(ctx context.Context) ([]PortfolioGroup, error) {
+	return timed("portfolio_groups", func() ([]PortfolioGroup, error) { return t.Repository.PortfolioGroups(ctx) })
+}
+
+func (t *timedRepository) DashboardCounts(ctx context.Context, failedSince time.Time) (*Dashboard, error) {
+	return timed("dashboard_counts", func() (*Dashboard, error) { return t.Repository.DashboardCounts(ctx, failedSince) })
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RateScenarioRequest proposes new annual rates per period
+// @Description Hypothetical rate table to price against the current active portfolio
+type RateScenarioRequest struct {
+	Rates map[string]float64 `json:"rates" example:"1y:0.055" validate:"min=1,dive,keys,period,endkeys,gte=0,lt=1"`
+}
+
+// RateScenarioResult compares full-term interest liability under current and proposed rates
+// @Description Portfolio-wide interest liability under current and hypothetical rates
+type RateScenarioResult struct {
+	Periods           []PeriodProjection `json:"periods"`
+	Accounts          int                `json:"accounts" example:"1200"`
+	Principal         float64            `json:"principal" example:"1500000.00"`
+	CurrentLiability  float64            `json:"current_liability" example:"75000.00"`
+	ScenarioLiability float64            `json:"scenario_liability" example:"82500.00"`
+	Change            float64            `json:"change" example:"7500.00"`
+	GeneratedAt       time.Time          `json:"generated_at"`
+	// Display is set when a display_currency was requested
+	Display *DisplayAmounts `json:"display,omitempty"`
+}
+
+// PeriodProjection is the liability of one period's active accounts
+// @Description Interest liability of the active accounts of one period
+type PeriodProjection struct {
+	Period            string  `json:"period" example:"1y"`
+	Accounts          int     `json:"accounts" example:"400"`
+	Principal         float64 `json:"principal" example:"500000.00"`
+	CurrentRate       float64 `json:"current_rate" example:"0.05"` // principal and term weighted average
+	ScenarioRate      float64 `json:"scenario_rate" example:"0.055"`
+	CurrentLiability  float64 `json:"current_liability" example:"25000.00"`
+	ScenarioLiability float64 `json:"scenario_liability" example:"27500.00"`
+	Change            float64 `json:"change" example:"2500.00"`
+}
+
+// ProjectRateScenario prices the full-term interest of every active account
+// as if it carried the proposed rate for its period. Nothing is persisted;
+// periods without a proposed rate keep their current rates.
+func (s *service) ProjectRateScenario(ctx context.Context, rates map[string]float64) (*RateScenarioResult, error) {
+	exposures, err := s.repo.ActiveExposureByPeriod(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to aggregate active accounts", zap.Error(err))
+		return nil, err
+	}
+
+	result := &RateScenarioResult{Periods: []PeriodProjection{}, GeneratedAt: time.Now().UTC()}
+	for _, e := range exposures {
+		p := PeriodProjection{
+			Period:           e.Period,
+			Accounts:         e.Accounts,
+			Principal:        roundMoney(e.Principal),
+			CurrentLiability: roundMoney(e.Interest),
+		}
+		if p.Period == "" {
+			p.Period = "unknown"
+		}
+		if e.PrincipalYears > 0 {
+			p.CurrentRate = e.Interest / e.PrincipalYears
+		}
+
+		p.ScenarioRate = p.CurrentRate
+		p.ScenarioLiability = p.CurrentLiability
+		if rate, ok := rates[e.Period]; ok {
+			p.ScenarioRate = rate
+			p.ScenarioLiability = roundMoney(rate * e.PrincipalYears)
+		}
+		p.Change = roundMoney(p.ScenarioLiability - p.CurrentLiability)
+
+		result.Periods = append(result.Periods, p)
+		result.Accounts += p.Accounts
+		result.Principal += p.Principal
+		result.CurrentLiability += p.CurrentLiability
+		result.ScenarioLiability += p.ScenarioLiability
+	}
+	result.Principal = roundMoney(result.Principal)
+	result.CurrentLiability = roundMoney(result.CurrentLiability)
+	result.ScenarioLiability = roundMoney(result.ScenarioLiability)
+	result.Change = roundMoney(result.ScenarioLiability - result.CurrentLiability)
+	return result, nil
+}
+
+// rateScenarioHandler godoc
+// @Summary Project interest liability under a rate scenario
+// @Description Recomputes the full-term interest liability of the active portfolio under a hypothetical rate table, per period and in total, without persisting anything
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param scenario body RateScenarioRequest true "Proposed rates per period"
+// @Param display_currency query string false "ISO 4217 currency to also present the totals in" example(EUR)
+// @Success 200 {object} RateScenarioResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /v2/admin/analysis/rate-scenario [post]
+func rateScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	var req RateScenarioRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(r, longRequestTimeout)
+	defer cancel()
+
+	rate, ok := displayRate(ctx, w, r, svc)
+	if !ok {
+		return
+	}
+
+	result, err := svc.ProjectRateScenario(ctx, req.Rates)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if rate != nil {
+		result.Display = rate.display(map[string]float64{
+			"principal":          result.Principal,
+			"current_liability":  result.CurrentLiability,
+			"scenario_liability": result.ScenarioLiability,
+			"change":             result.Change,
+		})
+	}
+
+	writeSuccess(w, r, result, "Rate scenario projected successfully")
+}
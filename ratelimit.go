@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// APIKeyHeader carries the caller's API key
+const APIKeyHeader = "X-API-Key"
+
+// Rate limit headers sent with every limited response
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+)
+
+// rateLimitSweepInterval is how often idle in-memory buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+// rateLimit is a token bucket: burst requests at once, refilled at rate
+// requests per second
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// RateLimiter takes tokens from per-client token buckets
+type RateLimiter interface {
+	// Take takes a token from key's bucket. When none is left it returns
+	// allowed false and how long until one is.
+	Take(ctx context.Context, key string, limit rateLimit) (allowed bool, remaining int, retryAfter time.Duration, err error)
+}
+
+// rateLimits are the quotas for reads (GET and HEAD) and writes. A zero
+// limit leaves its kind of request unlimited.
+type rateLimits struct {
+	read, write rateLimit
+}
+
+// parseRateLimit parses "<requests>/<s|m|h>" with an optional burst, which
+// defaults to the request count
+func parseRateLimit(name, burstName string) (rateLimit, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return rateLimit{}, nil
+	}
+	count, unit, ok := strings.Cut(v, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return rateLimit{}, fmt.Errorf("%s must look like 100/m", name)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if per == 0 {
+		return rateLimit{}, fmt.Errorf("%s must be per s, m or h", name)
+	}
+	limit := rateLimit{rate: float64(n) / per.Seconds(), burst: n}
+	if b := os.Getenv(burstName); b != "" {
+		if limit.burst, err = strconv.Atoi(b); err != nil || limit.burst <= 0 {
+			return rateLimit{}, fmt.Errorf("%s must be a positive number", burstName)
+		}
+	}
+	return limit, nil
+}
+
+// newRateLimits reads RATE_LIMIT_READ and RATE_LIMIT_WRITE, with their
+// _BURST variables
+func newRateLimits() (rateLimits, error) {
+	read, err := parseRateLimit("RATE_LIMIT_READ", "RATE_LIMIT_READ_BURST")
+	if err != nil {
+		return rateLimits{}, err
+	}
+	write, err := parseRateLimit("RATE_LIMIT_WRITE", "RATE_LIMIT_WRITE_BURST")
+	if err != nil {
+		return rateLimits{}, err
+	}
+	return rateLimits{read: read, write: write}, nil
+}
+
+// newRateLimiter returns the bucket store named by RATE_LIMIT_STORE, or nil
+// when no rate limit is configured. The memory store limits each replica on
+// its own; the redis store shares buckets across replicas through the Redis
+// at REDIS_ADDR.
+func newRateLimiter(client *redis.Client, limits rateLimits) (RateLimiter, error) {
+	if limits.read.rate == 0 && limits.write.rate == 0 {
+		return nil, nil
+	}
+	switch store := os.Getenv("RATE_LIMIT_STORE"); store {
+	case "", "memory":
+		return newMemoryRateLimiter(), nil
+	case "redis":
+		if client == nil {
+			return nil, fmt.Errorf("RATE_LIMIT_STORE=redis needs REDIS_ADDR")
+		}
+		return &redisRateLimiter{client: client}, nil
+	default:
+		return nil, fmt.Errorf("invalid RATE_LIMIT_STORE: %s. Valid options are: memory, redis", store)
+	}
+}
+
+// rateLimitClient names the client a request is counted against: its
+// authenticated principal, its API key, the staff member set by the gateway,
+// or else its address. X-Staff-ID is only taken from a caller that presented
+// a verified client certificate, as the gateway does; from anyone else it
+// would let each request pick a fresh bucket. Keys and staff IDs are hashed
+// so they are never held in memory or Redis.
+func rateLimitClient(r *http.Request) string {
+	if p := principalFromContext(r.Context()); p != nil {
+		return p.Kind + ":" + p.ID
+	}
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return "key:" + rateLimitHash(key)
+	}
+	if staffID := r.Header.Get(StaffIDHeader); staffID != "" && verifiedCaller(r) {
+		return "staff:" + rateLimitHash(staffID)
+	}
+	return "ip:" + clientIP(r)
+}
+
+// rateLimitHash shortens a credential to the part of its hash buckets are
+// named by
+func rateLimitHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// verifiedCaller reports whether r came with a client certificate verified
+// against server.tls.client_ca_file
+func verifiedCaller(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// RateLimitMiddleware refuses requests over the client's read or write quota
+// with 429 and a Retry-After. Limiter failures are logged and let the request
+// through, so a Redis outage cannot take the API down.
+func RateLimitMiddleware(limiter RateLimiter, limits rateLimits, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			kind, limit := "write", limits.write
+			if readOnlyRequest(r) {
+				kind, limit = "read", limits.read
+			}
+			if limit.rate == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			client := rateLimitClient(r)
+			allowed, remaining, retryAfter, err := limiter.Take(r.Context(), client+":"+kind, limit)
+			if err != nil {
+				loggerFromContext(r.Context(), logger).Warn("Rate limiter unavailable, request let through",
+					zap.Error(err), zap.String("client", client))
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set(RateLimitLimitHeader, strconv.Itoa(limit.burst))
+			w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(remaining))
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, fmt.Sprintf("%s rate limit exceeded; retry in %s", kind, retryAfter.Round(time.Second)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// memoryRateLimiter keeps buckets in this process
+type memoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	limit   rateLimit
+}
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{buckets: make(map[string]*tokenBucket), lastSweep: time.Now()}
+}
+
+func (l *memoryRateLimiter) Take(_ context.Context, key string, limit rateLimit) (bool, int, time.Duration, error) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		// A bucket that has refilled is the same as no bucket
+		for k, b := range l.buckets {
+			if b.refill(now) >= float64(b.limit.burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.burst), updated: now, limit: limit}
+		l.buckets[key] = b
+	}
+	b.tokens, b.updated = b.refill(now), now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.rate * float64(time.Second))
+		return false, 0, wait, nil
+	}
+	b.tokens--
+	return true, int(b.tokens), 0, nil
+}
+
+// refill returns the bucket's tokens at now
+func (b *tokenBucket) refill(now time.Time) float64 {
+	return math.Min(float64(b.limit.burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.rate)
+}
+
+// redisRateLimiter keeps buckets in Redis so replicas share them. Buckets
+// are refilled against the Redis clock, so replicas' clocks need not agree.
+type redisRateLimiter struct {
+	client *redis.Client
+}
+
+// takeTokenScript refills and takes from the bucket at KEYS[1] atomically.
+// ARGV is the rate per second and the burst; it returns whether a token was
+// taken, the tokens left and the milliseconds until the next one.
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, math.floor(tokens), wait}
+`)
+
+func (l *redisRateLimiter) Take(ctx context.Context, key string, limit rateLimit) (bool, int, time.Duration, error) {
+	res, err := takeTokenScript.Run(ctx, l.client, []string{cacheKeyPrefix + "ratelimit:" + key},
+		limit.rate, limit.burst).Int64Slice()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	if len(res) != 3 {
+		return false, 0, 0, fmt.Errorf("unexpected rate limit script result %v", res)
+	}
+	return res[0] == 1, int(res[1]), time.Duration(res[2]) * time.Millisecond, nil
+}
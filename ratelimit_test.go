@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimitClient(t *testing.T) {
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{}}}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		tls     *tls.ConnectionState
+		want    string
+	}{
+		{"API key", map[string]string{APIKeyHeader: "secret", StaffIDHeader: "staff-1"}, nil, "key:" + rateLimitHash("secret")},
+		{"staff from the gateway", map[string]string{StaffIDHeader: "staff-1"}, verified, "staff:" + rateLimitHash("staff-1")},
+		{"staff without a client certificate", map[string]string{StaffIDHeader: "staff-1"}, nil, "ip:192.0.2.1"},
+		{"staff over unverified TLS", map[string]string{StaffIDHeader: "staff-1"}, &tls.ConnectionState{}, "ip:192.0.2.1"},
+		{"anonymous", nil, nil, "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v2/products", nil)
+			r.RemoteAddr = "192.0.2.1:4711"
+			r.TLS = tt.tls
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			got := rateLimitClient(r)
+			if got != tt.want {
+				t.Errorf("client = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(got, "secret") || strings.Contains(got, "staff-1") {
+				t.Errorf("client %q holds the credential in clear", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Reconciliation break statuses
+const (
+	BreakOpen         = "open"
+	BreakAcknowledged = "acknowledged"
+	BreakResolved     = "resolved"
+)
+
+// defaultReconciliationSchedule runs the reconciliation worker nightly, in
+// BUSINESS_TIMEZONE
+const defaultReconciliationSchedule = "0 1 * * *"
+
+// reconciledStatuses are the statuses of accounts that hold a balance the
+// reconciliation worker can check. Accounts still pending funding or whose
+// funding failed never held one, and rolled over accounts carried theirs
+// into the account they rolled into.
+var reconciledStatuses = []string{StatusActive, StatusFrozen, StatusMatured, StatusPayoutFailed}
+
+// ErrBreakNotOpen is returned when acknowledging a break that is no longer open
+var ErrBreakNotOpen = newAPIError(CodeBreakNotOpen, "reconciliation break is not open")
+
+// ReconciliationBreak is an account whose balance by its ledger differs from
+// the balance its stored fields give. Later runs update the figures of an
+// unresolved break; it resolves once a run finds the account in balance.
+// @Description An account found out of balance by the nightly reconciliation
+type ReconciliationBreak struct {
+	ID                int     `json:"id" example:"1"`
+	AccountID         int     `json:"-"`
+	AccountExternalID string  `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	TenantID          string  `json:"-"`
+	Principal         float64 `json:"principal" example:"1000.00"`
+	// PostedInterest is the interest paid out periodically, the interest
+	// adjustments recorded and, once the account matured, the interest it
+	// accrued since its last periodic payment
+	PostedInterest float64 `json:"posted_interest" example:"50.00"`
+	// PaidOut is the periodic interest payments and the maturity payout
+	// unless it failed
+	PaidOut float64 `json:"paid_out" example:"0"`
+	// LedgerBalance is Principal + PostedInterest - PaidOut
+	LedgerBalance float64 `json:"ledger_balance" example:"1050.00"`
+	// StoredBalance is what the account's fields say it holds: its principal
+	// and interest adjustment, and nothing once its maturity payout is sent
+	StoredBalance float64 `json:"stored_balance" example:"1045.00"`
+	// Difference is LedgerBalance - StoredBalance
+	Difference     float64    `json:"difference" example:"5.00"`
+	Status         string     `json:"status" example:"open"`
+	Occurrences    int        `json:"occurrences" example:"1"`
+	DetectedAt     time.Time  `json:"detected_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty" example:"staff-42"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	Note           string     `json:"note,omitempty" example:"Adjustment posted twice, reversal requested"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+}
+
+// AcknowledgeBreakRequest acknowledges a break
+// @Description Acknowledgement of a reconciliation break being worked on
+type AcknowledgeBreakRequest struct {
+	Note string `json:"note" example:"Adjustment posted twice, reversal requested" validate:"notblank,max=1000"`
+}
+
+// reconciliationSchedule returns RECONCILIATION_SCHEDULE, falling back to
+// the default
+func reconciliationSchedule() string {
+	if v := os.Getenv("RECONCILIATION_SCHEDULE"); v != "" {
+		return v
+	}
+	return defaultReconciliationSchedule
+}
+
+// reconcileAccount works out the account's balance by its ledger, its
+// interest payments, interest adjustments and maturity payouts, against the
+// balance its stored fields give
+func reconcileAccount(a *BlockAccount, interest []*InterestPayout, adjustments []*InterestAdjustment, payouts []*Payout) *ReconciliationBreak {
+	var posted, paid float64
+	for _, p := range interest {
+		posted += p.Amount
+		paid += p.Amount
+	}
+	for _, adj := range adjustments {
+		posted += adj.Amount
+	}
+	stored := a.Principal + a.InterestAdjustment
+	if len(payouts) > 0 {
+		// The maturity payout pays the interest accrued since the last
+		// periodic payment along with the principal
+		accrued := roundMoney(interestBetween(a, interestPaidFrom(a), a.EndDate))
+		posted += accrued
+		stored += accrued
+	}
+	for _, p := range payouts {
+		if p.Status != PayoutFailed {
+			paid += p.Amount
+			stored = 0
+		}
+	}
+
+	b := &ReconciliationBreak{
+		AccountID:      a.ID,
+		TenantID:       a.TenantID,
+		Principal:      roundMoney(a.Principal),
+		PostedInterest: roundMoney(posted),
+		PaidOut:        roundMoney(paid),
+		StoredBalance:  roundMoney(stored),
+	}
+	b.LedgerBalance = roundMoney(b.Principal + b.PostedInterest - b.PaidOut)
+	b.Difference = roundMoney(b.LedgerBalance - b.StoredBalance)
+	return b
+}
+
+// ReconcileAccounts checks every account holding a balance, batchSize at a
+// time, recording a break for each out of balance and resolving the breaks
+// of those back in balance. It returns how many accounts were out of
+// balance.
+func (s *service) ReconcileAccounts(ctx context.Context, now time.Time, batchSize int) (int, error) {
+	breaks, resolved := 0, 0
+	afterID := 0
+	for {
+		accounts, err := s.repo.ListAccountsAfter(ctx, afterID, reconciledStatuses, batchSize)
+		if err != nil {
+			s.log(ctx).Error("Failed to list accounts to reconcile", zap.Error(err))
+			return breaks, err
+		}
+		if len(accounts) == 0 {
+			break
+		}
+
+		ids := make([]int, len(accounts))
+		for i, a := range accounts {
+			ids[i] = a.ID
+		}
+		interest, err := s.repo.ListInterestPayoutsOf(ctx, ids)
+		if err != nil {
+			s.log(ctx).Error("Failed to list interest payouts", zap.Error(err))
+			return breaks, err
+		}
+		adjustments, err := s.repo.ListInterestAdjustmentsOf(ctx, ids)
+		if err != nil {
+			s.log(ctx).Error("Failed to list interest adjustments", zap.Error(err))
+			return breaks, err
+		}
+		payouts, err := s.repo.ListPayoutsOf(ctx, ids)
+		if err != nil {
+			s.log(ctx).Error("Failed to list payouts", zap.Error(err))
+			return breaks, err
+		}
+		interestOf := make(map[int][]*InterestPayout)
+		for _, p := range interest {
+			interestOf[p.AccountID] = append(interestOf[p.AccountID], p)
+		}
+		adjustmentsOf := make(map[int][]*InterestAdjustment)
+		for _, adj := range adjustments {
+			adjustmentsOf[adj.AccountID] = append(adjustmentsOf[adj.AccountID], adj)
+		}
+		payoutsOf := make(map[int][]*Payout)
+		for _, p := range payouts {
+			payoutsOf[p.AccountID] = append(payoutsOf[p.AccountID], p)
+		}
+
+		var balanced []int
+		for _, a := range accounts {
+			b := reconcileAccount(a, interestOf[a.ID], adjustmentsOf[a.ID], payoutsOf[a.ID])
+			if math.Abs(b.Difference) < 0.01 {
+				balanced = append(balanced, a.ID)
+				continue
+			}
+			recorded, err := s.repo.RecordReconciliationBreak(ctx, b, now)
+			if err != nil {
+				s.log(ctx).Error("Failed to record reconciliation break", zap.Error(err), zap.Int("accountID", a.ID))
+				return breaks, err
+			}
+			breaks++
+			s.log(ctx).Warn("Account out of balance", zap.Int("break_id", recorded.ID),
+				zap.String("accountID", recorded.AccountExternalID), zap.Float64("ledgerBalance", b.LedgerBalance),
+				zap.Float64("storedBalance", b.StoredBalance), zap.Int("occurrences", recorded.Occurrences))
+		}
+		n, err := s.repo.ResolveReconciliationBreaks(ctx, balanced, now)
+		if err != nil {
+			s.log(ctx).Error("Failed to resolve reconciliation breaks", zap.Error(err))
+			return breaks, err
+		}
+		resolved += n
+
+		afterID = accounts[len(accounts)-1].ID
+		if len(accounts) < batchSize {
+			break
+		}
+	}
+	if resolved > 0 {
+		s.log(ctx).Info("Reconciliation breaks resolved", zap.Int("resolved", resolved))
+	}
+	return breaks, nil
+}
+
+// ListReconciliationBreaks returns the latest 200 breaks, only those in
+// status when it is set
+func (s *service) ListReconciliationBreaks(ctx context.Context, status string) ([]*ReconciliationBreak, error) {
+	breaks, err := s.repo.ListReconciliationBreaks(ctx, status, 200)
+	if err != nil {
+		s.log(ctx).Error("Failed to list reconciliation breaks", zap.Error(err))
+		return nil, err
+	}
+	if breaks == nil {
+		breaks = []*ReconciliationBreak{}
+	}
+	return breaks, nil
+}
+
+// AcknowledgeReconciliationBreak acknowledges an open break. It returns nil
+// when the break does not exist and ErrBreakNotOpen when it is no longer
+// open.
+func (s *service) AcknowledgeReconciliationBreak(ctx context.Context, id int, staffID string, req *AcknowledgeBreakRequest) (*ReconciliationBreak, error) {
+	b, err := s.repo.GetReconciliationBreak(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get reconciliation break", zap.Error(err), zap.Int("break_id", id))
+		return nil, err
+	}
+	if b == nil {
+		return nil, nil
+	}
+	if b.Status != BreakOpen {
+		return nil, ErrBreakNotOpen
+	}
+
+	b, err = s.repo.AcknowledgeReconciliationBreak(ctx, id, staffID, strings.TrimSpace(req.Note), time.Now().UTC())
+	if err == sql.ErrNoRows {
+		// Acknowledged by someone else, or resolved, since it was read
+		return nil, ErrBreakNotOpen
+	}
+	if err != nil {
+		s.log(ctx).Error("Failed to acknowledge reconciliation break", zap.Error(err), zap.Int("break_id", id))
+		return nil, err
+	}
+	s.log(ctx).Info("Reconciliation break acknowledged", zap.Int("break_id", id),
+		zap.String("accountID", b.AccountExternalID), zap.String("staffID", staffID))
+	return b, nil
+}
+
+// listReconciliationBreaksHandler godoc
+// @Summary List reconciliation breaks
+// @Description Lists the latest 200 accounts the nightly reconciliation found out of balance, newest first: those whose principal plus posted interest less payouts differs from the balance their stored fields give. Filter on status=open for the work queue.
+// @Tags admin
+// @Produce json
+// @Param status query string false "Only breaks in this status" Enums(open, acknowledged, resolved)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]ReconciliationBreak}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/reconciliation/breaks [get]
+func listReconciliationBreaksHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", BreakOpen, BreakAcknowledged, BreakResolved:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid status: %s. Valid options are: open, acknowledged, resolved", status))
+		return
+	}
+
+	ctx := r.Context()
+
+	breaks, err := svc.ListReconciliationBreaks(ctx, status)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, breaks, "Reconciliation breaks retrieved successfully")
+}
+
+// acknowledgeReconciliationBreakHandler godoc
+// @Summary Acknowledge a reconciliation break
+// @Description Marks an open break as being worked on, with a note. The break stays acknowledged until a reconciliation run finds the account back in balance and resolves it.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Break ID" Format(int64)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param acknowledgement body AcknowledgeBreakRequest true "Acknowledgement"
+// @Success 200 {object} ReconciliationBreak
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/reconciliation/breaks/{id}/acknowledge [post]
+func acknowledgeReconciliationBreakHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid reconciliation break ID")
+		return
+	}
+
+	var req AcknowledgeBreakRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	b, err := svc.AcknowledgeReconciliationBreak(ctx, id, staffID, &req)
+	if err == ErrBreakNotOpen {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if b == nil {
+		writeError(w, http.StatusNotFound, "Reconciliation break not found")
+		return
+	}
+
+	markWrite(w)
+	writeSuccess(w, r, b, "Reconciliation break acknowledged successfully")
+}
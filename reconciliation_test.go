@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReconcileAccounts(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	api.createAccount(1)
+	broken := api.createAccount(2)
+
+	if n, err := api.svc.ReconcileAccounts(ctx, time.Now().UTC(), 1); err != nil || n != 0 {
+		t.Fatalf("reconcile balanced accounts = %d, %v, want no breaks", n, err)
+	}
+
+	// An interest adjustment on the account with no adjustment behind it
+	if _, err := api.db.Exec(`UPDATE block_accounts SET interest_adjustment=5 WHERE id =
+        (SELECT account_id FROM account_ids WHERE external_id=?)`, broken); err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		if n, err := api.svc.ReconcileAccounts(ctx, time.Now().UTC(), 1); err != nil || n != 1 {
+			t.Fatalf("reconcile run %d = %d, %v, want 1 break", run, n, err)
+		}
+	}
+
+	var listed struct {
+		Items []*ReconciliationBreak `json:"items"`
+	}
+	decodeData(t, api.do(http.MethodGet, "/v2/admin/reconciliation/breaks?status=open", "").Body.Bytes(), &listed)
+	if len(listed.Items) != 1 {
+		t.Fatalf("open breaks = %+v, want one", listed.Items)
+	}
+	b := listed.Items[0]
+	if b.AccountExternalID != broken || b.LedgerBalance != 1000 || b.StoredBalance != 1005 || b.Difference != -5 || b.Occurrences != 2 {
+		t.Errorf("break = %+v, want %s out by -5 seen twice", b, broken)
+	}
+
+	path := "/v2/admin/reconciliation/breaks/" + strconv.Itoa(b.ID) + "/acknowledge"
+	if w := api.do(http.MethodPost, path, `{"note":"Looking into it"}`, StaffIDHeader, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("acknowledge without staff ID = %d, want 401", w.Code)
+	}
+	if w := api.do(http.MethodPost, path, `{"note":"Looking into it"}`); w.Code != http.StatusOK {
+		t.Fatalf("acknowledge: %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodPost, path, `{"note":"Again"}`); w.Code != http.StatusConflict || errorCode(w) != CodeBreakNotOpen {
+		t.Errorf("acknowledge again = %d %s, want 409 %s", w.Code, w.Body, CodeBreakNotOpen)
+	}
+	if w := api.do(http.MethodGet, "/v2/admin/reconciliation/breaks?status=stuck", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("list with unknown status = %d, want 400", w.Code)
+	}
+
+	if _, err := api.db.Exec(`UPDATE block_accounts SET interest_adjustment=0`); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := api.svc.ReconcileAccounts(ctx, time.Now().UTC(), 10); err != nil || n != 0 {
+		t.Fatalf("reconcile after the fix = %d, %v, want no breaks", n, err)
+	}
+	decodeData(t, api.do(http.MethodGet, "/v2/admin/reconciliation/breaks?status=resolved", "").Body.Bytes(), &listed)
+	if len(listed.Items) != 1 || listed.Items[0].ResolvedAt == nil || listed.Items[0].AcknowledgedBy != "staff-1" {
+		t.Errorf("resolved breaks = %+v, want the acknowledged break resolved", listed.Items)
+	}
+}
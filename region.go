@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Region roles. Only the active region's workers run; a standby region
+// serves reads from its replica and waits to be promoted.
+const (
+	RegionActive  = "active"
+	RegionStandby = "standby"
+)
+
+const (
+	// defaultMaxReplicationLag is how far behind its primary a replica may
+	// fall before the instance reports not ready, when MAX_REPLICATION_LAG
+	// is not set
+	defaultMaxReplicationLag = 30 * time.Second
+	// regionCheckInterval is how often a running worker checks that its
+	// region is still active
+	regionCheckInterval = 5 * time.Second
+	// regionFenceGrace is how long a failover waits after fencing for the
+	// old region's workers to notice and stop
+	regionFenceGrace = 2 * regionCheckInterval
+)
+
+var (
+	// ErrRegionNotConfigured is returned by failover operations when REGION is not set
+	ErrRegionNotConfigured = newAPIError(CodeRegionNotConfigured, "REGION is not set; this deployment is single-region")
+	// ErrRegionAlreadyActive is returned when promoting the region that is already active
+	ErrRegionAlreadyActive = newAPIError(CodeRegionAlreadyActive, "region is already active")
+	// errRegionFenced is the cause of a worker's context being cancelled
+	// once another region has been promoted
+	errRegionFenced = errors.New("region was fenced by a failover")
+)
+
+// RegionState is the active region as last set by a failover
+type RegionState struct {
+	ActiveRegion string
+	// Epoch counts failovers
+	Epoch      int
+	PromotedAt time.Time
+	PromotedBy string
+}
+
+// RegionStatus describes this instance's region
+// @Description This instance's region, its role and how far its replica lags
+type RegionStatus struct {
+	Region       string `json:"region" example:"eu-west"`
+	ActiveRegion string `json:"active_region" example:"eu-west"`
+	// Role is "active" or "standby"
+	Role                  string     `json:"role" example:"active"`
+	Epoch                 int        `json:"epoch" example:"2"`
+	ReplicationLagSeconds float64    `json:"replication_lag_seconds" example:"0.4"`
+	PromotedAt            *time.Time `json:"promoted_at,omitempty"`
+	PromotedBy            string     `json:"promoted_by,omitempty" example:"ops-17"`
+}
+
+// PromoteRegionRequest asks for this instance's region to be promoted
+// @Description Request payload for promoting this region to active
+type PromoteRegionRequest struct {
+	Reason string `json:"reason" example:"eu-west database unavailable" validate:"notblank"`
+}
+
+// regionFailover is the payload of a region failover job
+type regionFailover struct {
+	Region         string `json:"region"`
+	PreviousRegion string `json:"previous_region"`
+	FromEpoch      int    `json:"from_epoch"`
+	Reason         string `json:"reason"`
+}
+
+// RegionFailoverResult is the result of a finished region failover job
+type RegionFailoverResult struct {
+	Region         string    `json:"region"`
+	PreviousRegion string    `json:"previous_region"`
+	Epoch          int       `json:"epoch"`
+	PromotedAt     time.Time `json:"promoted_at"`
+}
+
+// regionName returns REGION, this instance's region, or "" in a
+// single-region deployment
+func regionName() string {
+	return os.Getenv("REGION")
+}
+
+// maxReplicationLag returns MAX_REPLICATION_LAG, the replica lag readiness tolerates
+func maxReplicationLag() time.Duration {
+	if v := os.Getenv("MAX_REPLICATION_LAG"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultMaxReplicationLag
+}
+
+// regionActive reports whether this instance's workers may run. Every
+// region is active until the first failover names one.
+func (s *service) regionActive(ctx context.Context) (bool, error) {
+	region := regionName()
+	if region == "" {
+		return true, nil
+	}
+	state, err := s.repo.GetRegionState(ctx)
+	if err != nil {
+		return false, err
+	}
+	return state == nil || state.ActiveRegion == region, nil
+}
+
+// inActiveRegion wraps a worker run so it only runs in the active region,
+// and is cancelled midway when another region is promoted. Workers save
+// their progress as they go, so the promoted region carries on from there.
+func (s *service) inActiveRegion(worker string, run func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if regionName() == "" {
+			return run(ctx)
+		}
+		active, err := s.regionActive(ctx)
+		if err != nil {
+			return fmt.Errorf("check region: %w", err)
+		}
+		if !active {
+			s.log(ctx).Debug("Worker idle in standby region", zap.String("worker", worker))
+			return nil
+		}
+
+		runCtx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		go s.watchRegion(runCtx, cancel)
+		err = run(runCtx)
+		if errors.Is(context.Cause(runCtx), errRegionFenced) {
+			s.log(ctx).Warn("Worker stopped by failover", zap.String("worker", worker))
+			return nil
+		}
+		return err
+	}
+}
+
+// watchRegion cancels ctx with errRegionFenced once this region is no
+// longer active. A failed check is retried rather than stopping the worker.
+func (s *service) watchRegion(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(regionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		active, err := s.regionActive(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log(ctx).Warn("Failed to check region", zap.Error(err))
+			}
+			continue
+		}
+		if !active {
+			cancel(errRegionFenced)
+			return
+		}
+	}
+}
+
+// GetRegionStatus reports this instance's region, or nil in a single-region deployment
+func (s *service) GetRegionStatus(ctx context.Context) (*RegionStatus, error) {
+	region := regionName()
+	if region == "" {
+		return nil, nil
+	}
+	state, err := s.repo.GetRegionState(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to get region state", zap.Error(err))
+		return nil, err
+	}
+	lag, err := s.repo.ReplicationLag(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to measure replication lag", zap.Error(err))
+		return nil, err
+	}
+
+	status := &RegionStatus{
+		Region:                region,
+		ActiveRegion:          region,
+		Role:                  RegionActive,
+		ReplicationLagSeconds: lag.Seconds(),
+	}
+	if state != nil {
+		promotedAt := state.PromotedAt
+		status.ActiveRegion, status.Epoch = state.ActiveRegion, state.Epoch
+		status.PromotedAt, status.PromotedBy = &promotedAt, state.PromotedBy
+		if state.ActiveRegion != region {
+			status.Role = RegionStandby
+		}
+	}
+	return status, nil
+}
+
+// PromoteRegion queues the failover that makes this instance's region the
+// active one. The job is pinned to this region, so only its workers run it.
+func (s *service) PromoteRegion(ctx context.Context, staffID string, req *PromoteRegionRequest) (*Job, error) {
+	region := regionName()
+	if region == "" {
+		return nil, ErrRegionNotConfigured
+	}
+	state, err := s.repo.GetRegionState(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to get region state", zap.Error(err))
+		return nil, err
+	}
+	failover := regionFailover{Region: region, Reason: req.Reason}
+	if state != nil {
+		if state.ActiveRegion == region {
+			return nil, ErrRegionAlreadyActive
+		}
+		failover.PreviousRegion, failover.FromEpoch = state.ActiveRegion, state.Epoch
+	}
+
+	job, err := newJob(JobTypeRegionFailover, failover, staffID)
+	if err != nil {
+		return nil, err
+	}
+	job.Region = region
+	if job, err = s.repo.CreateJob(ctx, job); err != nil {
+		s.log(ctx).Error("Failed to queue region failover", zap.Error(err))
+		return nil, err
+	}
+	s.log(ctx).Warn("Region failover queued", zap.Int("jobID", job.ID), zap.String("region", region),
+		zap.String("previousRegion", failover.PreviousRegion), zap.String("staffID", staffID))
+	return job, nil
+}
+
+// runRegionFailoverJob promotes the job's region and fences the previous
+// one: its workers see they are no longer active within regionCheckInterval
+// and stop, leaving their saved progress for this region's workers. A
+// retried job that finds its promotion already done goes on from there.
+func runRegionFailoverJob(ctx context.Context, s *service, job *Job, progress func(done, total int)) (any, error) {
+	var failover regionFailover
+	if err := json.Unmarshal(job.Payload, &failover); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	if region := regionName(); region != failover.Region {
+		return nil, fmt.Errorf("failover to %s cannot run in region %q", failover.Region, region)
+	}
+
+	progress(0, 2)
+	state, err := s.repo.PromoteRegion(ctx, failover.Region, failover.FromEpoch, job.RequestedBy, time.Now().UTC())
+	if err == sql.ErrNoRows {
+		if state, err = s.repo.GetRegionState(ctx); err == nil &&
+			(state == nil || state.ActiveRegion != failover.Region || state.Epoch != failover.FromEpoch+1) {
+			return nil, fmt.Errorf("region state changed since the failover was requested")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	progress(1, 2)
+
+	// Give the previous region's workers time to notice they were fenced
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(regionFenceGrace):
+	}
+	progress(2, 2)
+
+	s.emitOperational(ctx, EventRegionFailover, SeverityCritical,
+		fmt.Sprintf("Region %s promoted to active", failover.Region),
+		map[string]any{"region": failover.Region, "previous_region": failover.PreviousRegion, "epoch": state.Epoch,
+			"promoted_by": job.RequestedBy, "reason": failover.Reason})
+	return &RegionFailoverResult{
+		Region:         failover.Region,
+		PreviousRegion: failover.PreviousRegion,
+		Epoch:          state.Epoch,
+		PromotedAt:     state.PromotedAt,
+	}, nil
+}
+
+// getRegionHandler godoc
+// @Summary Get this instance's region
+// @Description Reports this instance's region, whether it is the active or a standby region, the failover epoch and the replication lag of its replica
+// @Tags admin
+// @Produce json
+// @Success 200 {object} RegionStatus
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/region [get]
+func getRegionHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	ctx := r.Context()
+
+	status, err := svc.GetRegionStatus(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if status == nil {
+		writeAPIError(w, http.StatusNotFound, ErrRegionNotConfigured)
+		return
+	}
+	writeSuccess(w, r, status, "Region status retrieved successfully")
+}
+
+// promoteRegionHandler godoc
+// @Summary Promote this region to active
+// @Description Queues a failover job that makes this instance's region the active one and fences the workers of the previous active region, which stop within seconds and leave their saved progress to this region. Promote the region's database first. Poll GET /jobs/{id} for progress.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member requesting the failover"
+// @Param request body PromoteRegionRequest true "Why the region is being promoted"
+// @Success 202 {object} Job
+// @Header 202 {string} Location "Job status URL"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/region/promote [post]
+func promoteRegionHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req PromoteRegionRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := svc.PromoteRegion(ctx, staffID, &req)
+	if err != nil {
+		switch err {
+		case ErrRegionNotConfigured, ErrRegionAlreadyActive:
+			writeAPIError(w, http.StatusConflict, err)
+		default:
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	markWrite(w)
+
+	w.Header().Set("Location", jobLocation(job.ID))
+	writeSuccessStatus(w, r, http.StatusAccepted, job, "Region failover queued")
+}
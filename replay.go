@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Event replay destinations. A broker replay publishes to the configured
+// broker, on its usual topic unless one is given; a webhook replay queues
+// deliveries for one subscription.
+const (
+	ReplayToBroker  = "broker"
+	ReplayToWebhook = "webhook"
+)
+
+// Event replay statuses
+const (
+	ReplayQueued    = "queued"
+	ReplayRunning   = "running"
+	ReplayCompleted = "completed"
+)
+
+// maxReplayAccounts caps the account set of one replay
+const maxReplayAccounts = 1000
+
+// ErrReplayWebhookChannel is returned when a replay targets a webhook on the
+// operations channel, which never receives outbox events
+var ErrReplayWebhookChannel = newAPIError(CodeWebhookChannelMismatch, "webhook is not subscribed to the account channel")
+
+// ErrReplayUnknownAccount is returned when a replay lists an account ID
+// that never named an account
+var ErrReplayUnknownAccount = newAPIError(CodeAccountNotFound, "account_ids lists an unknown account")
+
+// ReplayDestination is where a replay sends its events
+// @Description Where replayed events are sent: the broker, optionally on another topic, or one webhook subscription
+type ReplayDestination struct {
+	Type string `json:"type" example:"broker" enums:"broker,webhook" validate:"oneof=broker webhook"`
+	// Topic overrides KAFKA_TOPIC, or NATS_SUBJECT on NATS, for a broker replay
+	Topic     string `json:"topic,omitempty" example:"block-account-events-replay"`
+	WebhookID int    `json:"webhook_id,omitempty" example:"3"`
+}
+
+// EventReplayRequest selects the stored events to replay
+// @Description Request payload for replaying stored events. At least one of from, after_sequence or account_ids is required.
+type EventReplayRequest struct {
+	// From (inclusive) and To (exclusive) bound the events' creation time.
+	// To defaults to, and is capped at, now.
+	From *time.Time `json:"from,omitempty" example:"2026-10-01T00:00:00Z"`
+	To   *time.Time `json:"to,omitempty" example:"2026-10-02T00:00:00Z"`
+	// AfterSequence starts the replay after this position in the event log,
+	// such as the last sequence a consumer processed before an outage
+	AfterSequence int64             `json:"after_sequence,omitempty" example:"98000" validate:"gte=0"`
+	AccountIDs    []string          `json:"account_ids,omitempty" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	EventTypes    []string          `json:"event_types,omitempty" example:"account.created,account.matured"`
+	Destination   ReplayDestination `json:"destination"`
+}
+
+// EventReplay is a queued or finished replay of stored events
+// @Description Progress of a replay of stored outbox events
+type EventReplay struct {
+	ID          int               `json:"id" example:"5"`
+	Status      string            `json:"status" example:"completed"`
+	Destination ReplayDestination `json:"destination"`
+	From        *time.Time        `json:"from,omitempty"`
+	To          time.Time         `json:"to"`
+	// AccountIDs are the internal IDs the outbox is filtered on, and
+	// AccountExternalIDs the same accounts as the API names them
+	AccountIDs         []int    `json:"-"`
+	AccountExternalIDs []string `json:"account_ids" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	EventTypes         []string `json:"event_types"`
+	// Replayed counts the events handed to the destination so far. Webhook
+	// replays skip events the subscription does not listen to.
+	Replayed int `json:"replayed" example:"1840"`
+	// LastOutboxID is the replay's position; events up to it have been replayed
+	LastOutboxID int64      `json:"last_outbox_id" example:"99120"`
+	LastError    string     `json:"last_error,omitempty"`
+	RequestedBy  string     `json:"requested_by" example:"ops-17"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// validateEventReplayRequest validates a replay request and defaults To to now
+func validateEventReplayRequest(req *EventReplayRequest, now time.Time) error {
+	switch req.Destination.Type {
+	case ReplayToBroker:
+		if req.Destination.WebhookID != 0 {
+			return fmt.Errorf("webhook_id is only valid for webhook replays")
+		}
+	case ReplayToWebhook:
+		if req.Destination.WebhookID <= 0 {
+			return fmt.Errorf("webhook_id is required for webhook replays")
+		}
+		if req.Destination.Topic != "" {
+			return fmt.Errorf("topic is only valid for broker replays")
+		}
+	}
+
+	if req.From == nil && req.AfterSequence == 0 && len(req.AccountIDs) == 0 {
+		return fmt.Errorf("from, after_sequence or account_ids is required")
+	}
+	if req.To == nil || req.To.After(now) {
+		req.To = &now
+	}
+	if req.From != nil && !req.From.Before(*req.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	if len(req.AccountIDs) > maxReplayAccounts {
+		return fmt.Errorf("account_ids cannot list more than %d accounts", maxReplayAccounts)
+	}
+	for i, id := range req.AccountIDs {
+		externalID, ok := parseExternalID(id)
+		if !ok {
+			return fmt.Errorf("invalid account ID: %s", id)
+		}
+		req.AccountIDs[i] = externalID
+	}
+	for _, event := range req.EventTypes {
+		if !webhookEvents[ChannelAccount][event] {
+			return fmt.Errorf("invalid event: %s. Valid options are: account.created, account.matured, account.closed, account.funded, account.funding_failed", event)
+		}
+	}
+	return nil
+}
+
+// QueueEventReplay stores a replay for the outbox worker. It returns
+// sql.ErrNoRows when the destination webhook does not exist and
+// ErrReplayUnknownAccount when an account ID does not resolve.
+func (s *service) QueueEventReplay(ctx context.Context, staffID string, req *EventReplayRequest) (*EventReplay, error) {
+	if req.Destination.Type == ReplayToWebhook {
+		webhook, err := s.repo.GetWebhook(ctx, req.Destination.WebhookID)
+		if err != nil {
+			s.log(ctx).Error("Failed to get webhook", zap.Error(err), zap.Int("id", req.Destination.WebhookID))
+			return nil, err
+		}
+		if webhook == nil {
+			return nil, sql.ErrNoRows
+		}
+		if webhook.Channel != ChannelAccount {
+			return nil, ErrReplayWebhookChannel
+		}
+	}
+
+	replay := &EventReplay{
+		Status:      ReplayQueued,
+		Destination: req.Destination,
+		From:        req.From,
+		To:          req.To.UTC(),
+		AccountIDs:  []int{},
+		EventTypes:  req.EventTypes,
+		// The replay's position starts where the caller asked
+		LastOutboxID: req.AfterSequence,
+		RequestedBy:  staffID,
+	}
+	for _, externalID := range req.AccountIDs {
+		id, err := s.ResolveAccountID(ctx, externalID)
+		if err != nil {
+			return nil, err
+		}
+		if id == 0 {
+			return nil, ErrReplayUnknownAccount
+		}
+		replay.AccountIDs = append(replay.AccountIDs, id)
+	}
+	if replay.EventTypes == nil {
+		replay.EventTypes = []string{}
+	}
+	replay, err := s.repo.CreateEventReplay(ctx, replay)
+	if err != nil {
+		s.log(ctx).Error("Failed to queue event replay", zap.Error(err))
+		return nil, err
+	}
+	if err := s.setReplayAccountIDs(ctx, replay); err != nil {
+		return nil, err
+	}
+	s.log(ctx).Info("Event replay queued", zap.Int("replayID", replay.ID),
+		zap.String("destination", replay.Destination.Type), zap.String("staffID", staffID))
+	return replay, nil
+}
+
+// GetEventReplay returns a replay's progress, or nil when it does not exist
+func (s *service) GetEventReplay(ctx context.Context, id int) (*EventReplay, error) {
+	replay, err := s.repo.GetEventReplay(ctx, id)
+	if err != nil {
+		s.log(ctx).Error("Failed to get event replay", zap.Error(err), zap.Int("replayID", id))
+		return nil, err
+	}
+	if replay == nil {
+		return nil, nil
+	}
+	if err := s.setReplayAccountIDs(ctx, replay); err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+// setReplayAccountIDs fills in the external IDs of the replay's accounts
+func (s *service) setReplayAccountIDs(ctx context.Context, replay *EventReplay) error {
+	externalIDs, err := s.repo.AccountExternalIDs(ctx, replay.AccountIDs)
+	if err != nil {
+		s.log(ctx).Error("Failed to get account external IDs", zap.Error(err), zap.Int("replayID", replay.ID))
+		return err
+	}
+	replay.AccountExternalIDs = make([]string, 0, len(replay.AccountIDs))
+	for _, id := range replay.AccountIDs {
+		if externalID, ok := externalIDs[id]; ok {
+			replay.AccountExternalIDs = append(replay.AccountExternalIDs, externalID)
+		}
+	}
+	return nil
+}
+
+// RunEventReplays works through queued replays, and those whose worker's
+// lease ran out, and returns how many it completed. publisher sends broker
+// replays without their own topic; publisherTo connects to another topic.
+func (s *service) RunEventReplays(ctx context.Context, publisher EventPublisher,
+	publisherTo func(topic string) (EventPublisher, error), lease time.Duration, batchSize int) (int, error) {
+	completed := 0
+	for {
+		replay, err := s.repo.ClaimEventReplay(ctx, time.Now().UTC(), lease)
+		if err != nil {
+			s.log(ctx).Error("Failed to claim event replay", zap.Error(err))
+			return completed, err
+		}
+		if replay == nil {
+			return completed, nil
+		}
+
+		pub := publisher
+		if replay.Destination.Type == ReplayToBroker && replay.Destination.Topic != "" {
+			if pub, err = publisherTo(replay.Destination.Topic); err != nil {
+				s.log(ctx).Error("Failed to connect replay publisher", zap.Error(err), zap.Int("replayID", replay.ID))
+				return completed, err
+			}
+		}
+		err = s.replayEvents(ctx, replay, pub, batchSize)
+		if pub != publisher {
+			pub.Close()
+		}
+		if err != nil {
+			return completed, err
+		}
+		completed++
+	}
+}
+
+// replayEvents hands the replay's remaining events to its destination a
+// batch at a time, saving its position after each batch. Like the outbox
+// relay this is at-least-once: a batch interrupted midway is sent again when
+// the replay is resumed.
+func (s *service) replayEvents(ctx context.Context, replay *EventReplay, publisher EventPublisher, batchSize int) error {
+	for {
+		events, err := s.repo.ListReplayEvents(ctx, replay, batchSize)
+		if err != nil {
+			s.log(ctx).Error("Failed to list replay events", zap.Error(err), zap.Int("replayID", replay.ID))
+			return err
+		}
+
+		if len(events) == 0 {
+			completed := time.Now().UTC()
+			replay.Status, replay.CompletedAt, replay.LastError = ReplayCompleted, &completed, ""
+			if err := s.repo.SaveEventReplay(ctx, replay); err != nil {
+				s.log(ctx).Error("Failed to complete event replay", zap.Error(err), zap.Int("replayID", replay.ID))
+				return err
+			}
+			s.log(ctx).Info("Event replay completed", zap.Int("replayID", replay.ID), zap.Int("replayed", replay.Replayed))
+			return nil
+		}
+
+		if replay.Destination.Type == ReplayToWebhook {
+			if err := s.repo.QueueReplayDeliveries(ctx, replay, events); err != nil {
+				s.log(ctx).Error("Failed to queue replay deliveries", zap.Error(err), zap.Int("replayID", replay.ID))
+				return err
+			}
+			continue
+		}
+
+		for _, e := range events {
+			if publishErr := publisher.Publish(ctx, e); publishErr != nil {
+				// Keep what was sent so the retry after the lease starts at the failed event
+				replay.LastError = publishErr.Error()
+				if err := s.repo.SaveEventReplay(ctx, replay); err != nil {
+					s.log(ctx).Error("Failed to save event replay", zap.Error(err), zap.Int("replayID", replay.ID))
+				}
+				s.log(ctx).Error("Failed to replay event", zap.Error(publishErr),
+					zap.Int("replayID", replay.ID), zap.String("eventID", e.EventID))
+				return fmt.Errorf("replay event %s: %w", e.EventID, publishErr)
+			}
+			replay.LastOutboxID = e.ID
+			replay.Replayed++
+		}
+		if err := s.repo.SaveEventReplay(ctx, replay); err != nil {
+			s.log(ctx).Error("Failed to save event replay", zap.Error(err), zap.Int("replayID", replay.ID))
+			return err
+		}
+	}
+}
+
+// replayEventsHandler godoc
+// @Summary Replay stored events
+// @Description Queues a replay of stored outbox events, published or not, for a time range and/or account set to the broker (optionally on another topic) or one webhook subscription. Events keep their IDs, so consumers that deduplicate on them only process what they missed. The outbox worker runs the replay; poll GET /admin/events/replay/{id} for progress.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member requesting the replay"
+// @Param request body EventReplayRequest true "Events to replay and their destination"
+// @Success 202 {object} EventReplay
+// @Header 202 {string} Location "URL of the replay's progress"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/events/replay [post]
+func replayEventsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req EventReplayRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := validateEventReplayRequest(&req, time.Now().UTC()); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	replay, err := svc.QueueEventReplay(ctx, staffID, &req)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			writeError(w, http.StatusNotFound, "Webhook not found")
+		case ErrReplayWebhookChannel:
+			writeAPIError(w, http.StatusConflict, err)
+		case ErrReplayUnknownAccount:
+			writeAPIError(w, http.StatusBadRequest, err)
+		default:
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	markWrite(w)
+
+	w.Header().Set("Location", apiPath("/admin/events/replay/"+strconv.Itoa(replay.ID)))
+	writeSuccessStatus(w, r, http.StatusAccepted, replay, "Event replay queued")
+}
+
+// getEventReplayHandler godoc
+// @Summary Get an event replay
+// @Description Returns a replay's status and how many events it has replayed so far
+// @Tags admin
+// @Produce json
+// @Param id path int true "Replay ID" Format(int64)
+// @Success 200 {object} EventReplay
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/events/replay/{id} [get]
+func getEventReplayHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid replay ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	replay, err := svc.GetEventReplay(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if replay == nil {
+		writeError(w, http.StatusNotFound, "Event replay not found")
+		return
+	}
+
+	writeSuccess(w, r, replay, "Event replay retrieved successfully")
+}
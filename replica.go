@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// replicaCheckInterval is how often the replica's reachability and lag
+	// are checked while reads are being routed
+	replicaCheckInterval = 2 * time.Second
+	// replicaCheckTimeout bounds one check, so a hung replica counts as down
+	replicaCheckTimeout = time.Second
+)
+
+// replicaRouter decides whether reads go to the read replica. The replica is
+// checked in the background, at most every replicaCheckInterval and only
+// while reads are asking, and reads stay on the primary while it is
+// unreachable or further behind than maxLag. Until the first check answers,
+// reads go to the primary.
+type replicaRouter struct {
+	db     *sql.DB
+	maxLag time.Duration
+	logger *zap.Logger
+
+	usable   atomic.Bool
+	checking atomic.Bool
+	// checkedAt is when the last check finished, in Unix nanoseconds
+	checkedAt atomic.Int64
+}
+
+func newReplicaRouter(db *sql.DB, maxLag time.Duration, logger *zap.Logger) *replicaRouter {
+	return &replicaRouter{db: db, maxLag: maxLag, logger: logger}
+}
+
+// use reports whether reads should go to the replica, starting a check when
+// the last one is stale
+func (r *replicaRouter) use() bool {
+	if time.Since(time.Unix(0, r.checkedAt.Load())) >= replicaCheckInterval && r.checking.CompareAndSwap(false, true) {
+		go r.check()
+	}
+	return r.usable.Load()
+}
+
+// check measures the replica and routes reads accordingly
+func (r *replicaRouter) check() {
+	defer r.checking.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+
+	lag, err := replicationLag(ctx, r.db)
+	r.checkedAt.Store(time.Now().UnixNano())
+	usable := err == nil && lag <= r.maxLag
+	if err != nil {
+		replicaCheckFailures.Inc()
+	} else {
+		replicaLag.Set(lag.Seconds())
+	}
+	if usable {
+		replicaUp.Set(1)
+	} else {
+		replicaUp.Set(0)
+	}
+
+	if r.usable.Swap(usable) == usable {
+		return
+	}
+	switch {
+	case usable:
+		r.logger.Info("Reads routed to the replica", zap.Duration("lag", lag))
+	case err != nil:
+		r.logger.Warn("Replica unreachable, reads fall back to the primary", zap.Error(err))
+	default:
+		r.logger.Warn("Replica behind, reads fall back to the primary", zap.Duration("lag", lag), zap.Duration("maxLag", r.maxLag))
+	}
+}
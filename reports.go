@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Report types
+const (
+	// ReportDailySummary covers new accounts, matured accounts and the
+	// interest accrued during one business day
+	ReportDailySummary = "daily_summary"
+)
+
+// reportDateLayout is how report dates are written
+const reportDateLayout = "2006-01-02"
+
+// defaultReportSchedule is when the reports worker runs if REPORT_SCHEDULE is
+// not set: 06:00 in the business timezone, for the day before
+const defaultReportSchedule = "0 6 * * *"
+
+// ErrUnknownReport is returned for a report type that does not exist
+var ErrUnknownReport = newAPIError(CodeUnknownReport, "unknown report type")
+
+//go:embed templates/reports/*.tmpl
+var reportTemplateFiles embed.FS
+
+// reportTypes lists the report types that can be generated
+var reportTypes = map[string]bool{ReportDailySummary: true}
+
+// ReportTotals counts accounts and sums their principal
+type ReportTotals struct {
+	Accounts  int     `json:"accounts" example:"12"`
+	Principal float64 `json:"principal" example:"48000.00"`
+}
+
+// DailySummary is the content of a daily_summary report
+// @Description Accounts opened and matured and interest accrued during a business day
+type DailySummary struct {
+	Date     string `json:"date" example:"2025-06-30"`
+	Timezone string `json:"timezone" example:"Africa/Addis_Ababa"`
+	Currency string `json:"currency" example:"USD"`
+	// NewAccounts were opened during the day, excluding failed fundings
+	NewAccounts ReportTotals `json:"new_accounts"`
+	// MaturedAccounts reached their end date during the day and were matured
+	MaturedAccounts ReportTotals `json:"matured_accounts"`
+	// InterestAccrued is what funded accounts earned during the day, paid or not
+	InterestAccrued float64 `json:"interest_accrued" example:"131.51"`
+}
+
+// Report is a generated report and where it was delivered
+// @Description A generated operations report
+type Report struct {
+	ID      int          `json:"id" example:"3"`
+	Type    string       `json:"type" example:"daily_summary"`
+	Date    string       `json:"date" example:"2025-06-30"`
+	Summary DailySummary `json:"summary"`
+	// Recipients were emailed the report
+	Recipients []string `json:"recipients"`
+	// DocumentKey is where the rendered report was kept in the object store
+	DocumentKey string    `json:"document_key,omitempty" example:"reports/daily_summary/2025-06-30.txt"`
+	RequestedBy string    `json:"requested_by" example:"scheduler"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// reportSchedule returns REPORT_SCHEDULE, falling back to the default
+func reportSchedule() string {
+	if v := os.Getenv("REPORT_SCHEDULE"); v != "" {
+		return v
+	}
+	return defaultReportSchedule
+}
+
+// reportRecipients returns the addresses in REPORT_EMAIL_TO
+func reportRecipients() []string {
+	var to []string
+	for _, addr := range strings.Split(os.Getenv("REPORT_EMAIL_TO"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	return to
+}
+
+// reportKey is where a report is kept in the object store
+func reportKey(reportType, date string) string {
+	return fmt.Sprintf("reports/%s/%s.txt", reportType, date)
+}
+
+// parseReportDate parses a report date as a day in the business timezone
+func parseReportDate(date string) (time.Time, error) {
+	day, err := time.ParseInLocation(reportDateLayout, date, businessLocation())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date must be YYYY-MM-DD")
+	}
+	return day, nil
+}
+
+// renderReport fills the report type's template, returning its subject and body
+func renderReport(reportType string, summary *DailySummary) (string, string, error) {
+	tmpl, err := template.New(reportType).Funcs(documentTemplateFuncs).
+		ParseFS(reportTemplateFiles, "templates/reports/"+reportType+".tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("report template %s: %w", reportType, err)
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", summary); err != nil {
+		return "", "", fmt.Errorf("report template %s: %w", reportType, err)
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", summary); err != nil {
+		return "", "", fmt.Errorf("report template %s: %w", reportType, err)
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// GenerateReport aggregates a report for a business day and delivers it:
+// emailed to REPORT_EMAIL_TO when SMTP is configured and kept in the object
+// store when one is configured. The report is recorded either way, and
+// generating a day again replaces its record.
+func (s *service) GenerateReport(ctx context.Context, reportType string, day time.Time, requestedBy string) (*Report, error) {
+	if !reportTypes[reportType] {
+		return nil, ErrUnknownReport
+	}
+	loc := businessLocation()
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	date := from.Format(reportDateLayout)
+
+	summary, err := s.repo.DailySummary(ctx, from.UTC(), from.AddDate(0, 0, 1).UTC())
+	if err != nil {
+		s.log(ctx).Error("Failed to aggregate report", zap.Error(err), zap.String("type", reportType), zap.String("date", date))
+		return nil, err
+	}
+	summary.Date, summary.Timezone, summary.Currency = date, loc.String(), accountCurrency()
+	summary.NewAccounts.Principal = roundMoney(summary.NewAccounts.Principal)
+	summary.MaturedAccounts.Principal = roundMoney(summary.MaturedAccounts.Principal)
+	summary.InterestAccrued = roundMoney(summary.InterestAccrued)
+
+	subject, body, err := renderReport(reportType, summary)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Type: reportType, Date: date, Summary: *summary, Recipients: []string{}, RequestedBy: requestedBy}
+	if s.store != nil {
+		key := reportKey(reportType, date)
+		if err := s.store.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain; charset=utf-8"); err != nil {
+			s.log(ctx).Error("Failed to store report", zap.Error(err), zap.String("key", key))
+			return nil, err
+		}
+		report.DocumentKey = key
+	}
+	if to := reportRecipients(); s.mailer != nil && len(to) > 0 {
+		if err := s.mailer.Send(ctx, to, subject, body); err != nil {
+			s.log(ctx).Error("Failed to email report", zap.Error(err), zap.String("type", reportType), zap.String("date", date))
+			return nil, err
+		}
+		report.Recipients = to
+	}
+
+	if report, err = s.repo.SaveReport(ctx, report); err != nil {
+		s.log(ctx).Error("Failed to save report", zap.Error(err), zap.String("type", reportType), zap.String("date", date))
+		return nil, err
+	}
+	s.log(ctx).Info("Report generated", zap.String("type", reportType), zap.String("date", date),
+		zap.Int("recipients", len(report.Recipients)), zap.String("key", report.DocumentKey))
+	return report, nil
+}
+
+// RunScheduledReports generates the reports for the business day before now
+// that have not been generated yet
+func (s *service) RunScheduledReports(ctx context.Context, now time.Time) (int, error) {
+	day := now.In(businessLocation()).AddDate(0, 0, -1)
+	generated := 0
+	for reportType := range reportTypes {
+		existing, err := s.repo.GetReport(ctx, reportType, day.Format(reportDateLayout))
+		if err != nil {
+			return generated, err
+		}
+		if existing != nil {
+			continue
+		}
+		if _, err := s.GenerateReport(ctx, reportType, day, "scheduler"); err != nil {
+			return generated, err
+		}
+		generated++
+	}
+	return generated, nil
+}
+
+// GetReport returns the report of a type for a date, or nil when it was not generated
+func (s *service) GetReport(ctx context.Context, reportType, date string) (*Report, error) {
+	if !reportTypes[reportType] {
+		return nil, ErrUnknownReport
+	}
+	report, err := s.repo.GetReport(ctx, reportType, date)
+	if err != nil {
+		s.log(ctx).Error("Failed to get report", zap.Error(err), zap.String("type", reportType), zap.String("date", date))
+	}
+	return report, err
+}
+
+// reportJobPayload is the input of a report job
+type reportJobPayload struct {
+	Type string `json:"type"`
+	Date string `json:"date"`
+}
+
+// QueueReport queues a job that generates and delivers a report for a date
+func (s *service) QueueReport(ctx context.Context, reportType, date, staffID string) (*Job, error) {
+	if !reportTypes[reportType] {
+		return nil, ErrUnknownReport
+	}
+	return s.enqueueJob(ctx, JobTypeReport, reportJobPayload{Type: reportType, Date: date}, staffID)
+}
+
+// runReportJob generates the report named in the job's payload
+func runReportJob(ctx context.Context, s *service, job *Job, progress func(done, total int)) (any, error) {
+	var p reportJobPayload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return nil, err
+	}
+	day, err := parseReportDate(p.Date)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.GenerateReport(ctx, p.Type, day, job.RequestedBy)
+	if err != nil {
+		return nil, err
+	}
+	progress(1, 1)
+	return map[string]any{"report_id": report.ID, "type": report.Type, "date": report.Date,
+		"recipients": report.Recipients, "document_key": report.DocumentKey}, nil
+}
+
+// runReportHandler godoc
+// @Summary Generate a report
+// @Description Queues a job that generates a report for a business day and delivers it like a scheduled run: by email to REPORT_EMAIL_TO and to the object store, where configured. Generating a day again replaces its report. Requires the X-Staff-ID header.
+// @Tags admin
+// @Produce json
+// @Param type path string true "Report type" Enums(daily_summary)
+// @Param date query string false "Business day, YYYY-MM-DD (default yesterday)"
+// @Param X-Staff-ID header string true "Staff member requesting the report"
+// @Success 202 {object} Job
+// @Header 202 {string} Location "Job status URL"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/reports/{type}/run [post]
+func runReportHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	today := svc.Now().In(businessLocation())
+	date := today.AddDate(0, 0, -1).Format(reportDateLayout)
+	if v := r.URL.Query().Get("date"); v != "" {
+		day, err := parseReportDate(v)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		if day.After(today) {
+			writeError(w, http.StatusBadRequest, "date must not be in the future")
+			return
+		}
+		date = v
+	}
+
+	ctx := r.Context()
+
+	job, err := svc.QueueReport(ctx, chi.URLParam(r, "type"), date, staffID)
+	if err == ErrUnknownReport {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	markWrite(w)
+
+	w.Header().Set("Location", jobLocation(job.ID))
+	writeSuccessStatus(w, r, http.StatusAccepted, job, "Report queued")
+}
+
+// getReportHandler godoc
+// @Summary Get a report
+// @Description Returns a generated report for a business day with where it was delivered
+// @Tags admin
+// @Produce json
+// @Param type path string true "Report type" Enums(daily_summary)
+// @Param date path string true "Business day, YYYY-MM-DD"
+// @Success 200 {object} Report
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/reports/{type}/{date} [get]
+func getReportHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	date := chi.URLParam(r, "date")
+	if _, err := parseReportDate(date); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	report, err := svc.GetReport(ctx, chi.URLParam(r, "type"), date)
+	if err == ErrUnknownReport {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if report == nil {
+		writeError(w, http.StatusNotFound, "Report not found")
+		return
+	}
+	writeSuccess(w, r, report, "Report retrieved successfully")
+}
@@ -0,0 +1,1971 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Repository persists block accounts and their payouts. Lookups that find
+// nothing return nil, nil; updates and deletes whose target does not exist
+// return sql.ErrNoRows. Account creation, maturity and deletion enqueue their
+// domain events in the outbox, and a delivery for every subscribed webhook,
+// within the same transaction.
+//
+// Accounts and what is configured or requested for them belong to a tenant.
+// Reads only see the rows of the tenant their context is scoped to, every
+// tenant's when it is scoped to none (see tenantFromContext), and records
+// are created in the context's tenant unless they carry their own.
+type Repository interface {
+	// CreateAccount inserts the account with its holder, creation status,
+	// funding and created event. An account carrying an idempotency key
+	// stores it with the account; when a create with the same key committed
+	// within idempotencyKeyTTL, nothing is written and errIdempotencyKeyTaken
+	// is returned. When admit is set, the account's user is locked for the
+	// transaction, so creates for one user are admitted one at a time, and
+	// admit is passed, with the lock held, what the user holds (see
+	// GetUserExposure) and the latest account the user opened since the
+	// account's duplicatesSince with the same principal and period, leaving
+	// out accounts whose funding failed, or nil. Nothing is written when
+	// admit returns an error, which is returned.
+	CreateAccount(ctx context.Context, account *BlockAccount, admit func(exposure UserExposure, duplicate *BlockAccount) error) (*BlockAccount, error)
+	// CreateAccounts inserts accounts and their events in one transaction and
+	// passes the stored accounts to record. When record returns an import, its
+	// progress is saved in the same transaction.
+	CreateAccounts(ctx context.Context, accounts []*BlockAccount, record func([]*BlockAccount) *AccountImport) ([]*BlockAccount, error)
+	GetAccount(ctx context.Context, id int) (*BlockAccount, error)
+	// GetAccountsByExternalID returns the accounts, of those with externalIDs,
+	// that exist
+	GetAccountsByExternalID(ctx context.Context, externalIDs []string) ([]*BlockAccount, error)
+	ListAccountsByUser(ctx context.Context, userID int) ([]*BlockAccount, error)
+	// ListAccountsOverlapping returns the user's accounts whose term overlaps [from, to)
+	ListAccountsOverlapping(ctx context.Context, userID int, from, to time.Time) ([]*BlockAccount, error)
+	// ListMaturingBetween returns up to limit active accounts ending in (from, to], soonest first
+	ListMaturingBetween(ctx context.Context, from, to time.Time, limit int) ([]*BlockAccount, error)
+	// ListAccountsUpdatedAfter returns up to limit accounts that come after
+	// (updatedAt, id) in (updated_at, id) order, in that order
+	ListAccountsUpdatedAfter(ctx context.Context, updatedAt time.Time, id, limit int) ([]*BlockAccount, error)
+	// ListAccountsAfter returns up to limit accounts in statuses with IDs
+	// above afterID, lowest first
+	ListAccountsAfter(ctx context.Context, afterID int, statuses []string, limit int) ([]*BlockAccount, error)
+	// DeleteAccount locks the account and, when check is not nil, passes its
+	// current state to check and only deletes it when check returns nil. It
+	// returns sql.ErrNoRows for a missing account.
+	DeleteAccount(ctx context.Context, id int, check func(*BlockAccount) error) error
+	// BeginClosure locks the account and passes its current state to plan.
+	// With the closure plan returns, it moves the account to closing,
+	// records the closure and queues its final payout, and returns the
+	// account with its closure. It returns nil, nil for a missing account.
+	BeginClosure(ctx context.Context, id int, plan func(*BlockAccount) (*AccountClosure, error)) (*BlockAccount, error)
+	// GetClosure returns the account's closure, or nil if its holder never closed it
+	GetClosure(ctx context.Context, accountID int) (*AccountClosure, error)
+
+	// CreateAgreement records an account's agreement. If the account already
+	// has one, it is kept and returned instead.
+	CreateAgreement(ctx context.Context, agreement *Agreement) (*Agreement, error)
+	// GetAgreement returns the account's agreement, or nil if none was issued
+	GetAgreement(ctx context.Context, accountID int) (*Agreement, error)
+
+	// GetFunding returns the debit funding the account, or nil if it was opened without one
+	GetFunding(ctx context.Context, accountID int) (*Funding, error)
+	// ListFundingsOf returns the fundings of the accounts in accountIDs
+	ListFundingsOf(ctx context.Context, accountIDs []int) ([]*Funding, error)
+	// ListPendingFundings returns up to limit pending fundings of accounts after afterAccountID, in account order
+	ListPendingFundings(ctx context.Context, afterAccountID, limit int) ([]*Funding, error)
+	// SettleFunding locks the account and its pending funding, asks plan how
+	// it settles and applies the outcome to both. It returns sql.ErrNoRows
+	// when the account has no pending funding.
+	SettleFunding(ctx context.Context, accountID int, plan func(*BlockAccount) (*FundingOutcome, error)) (*BlockAccount, error)
+
+	// UpdateMaturityInstruction locks the account, passes its current state to
+	// check and only applies the change when check returns nil
+	UpdateMaturityInstruction(ctx context.Context, id int, instruction, destination string, check func(*BlockAccount) error) (*BlockAccount, error)
+	// UpdateAccountStatus locks the account, passes its current state to check
+	// and only sets the status when check returns nil
+	UpdateAccountStatus(ctx context.Context, id int, status string, check func(*BlockAccount) error) (*BlockAccount, error)
+	// MatureDue locks up to limit active accounts due at now, asks plan how
+	// each one matures and persists the outcomes atomically. It returns how
+	// many matured; an account another worker matured first is skipped.
+	MatureDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*MaturityOutcome, error)) (int, error)
+	// MatureAccount matures the account with id as MatureDue would, if it is
+	// active and due at now, and reports whether it did
+	MatureAccount(ctx context.Context, id int, now time.Time, plan func(*BlockAccount) (*MaturityOutcome, error)) (bool, error)
+	// PayInterestDue locks up to limit active accounts with an interest payment
+	// due at now, asks plan for the payment and records it with the account's
+	// next payment date atomically. It returns how many were paid; a period
+	// already paid is skipped.
+	PayInterestDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*InterestOutcome, error)) (int, error)
+	// ListInterestPayouts returns the interest paid on the account, oldest first
+	ListInterestPayouts(ctx context.Context, accountID int) ([]*InterestPayout, error)
+	// ListInterestPayoutsOf returns the interest paid on the accounts in
+	// accountIDs, each account's oldest first
+	ListInterestPayoutsOf(ctx context.Context, accountIDs []int) ([]*InterestPayout, error)
+	// AdjustInterest locks the account and applies the adjustment plan
+	// returns for it, given the interest paid on it and its earlier
+	// adjustments: it sets the account's rate, adds the amount to its
+	// interest_adjustment and records the adjustment. It returns
+	// sql.ErrNoRows when the account does not exist.
+	AdjustInterest(ctx context.Context, accountID int, plan func(*BlockAccount, []*InterestPayout, []*InterestAdjustment) (*InterestAdjustment, error)) (*BlockAccount, *InterestAdjustment, error)
+	// ListInterestAdjustments returns the account's interest adjustments,
+	// oldest first
+	ListInterestAdjustments(ctx context.Context, accountID int) ([]*InterestAdjustment, error)
+	// ListInterestAdjustmentsOf returns the interest adjustments of the
+	// accounts in accountIDs, each account's oldest first
+	ListInterestAdjustmentsOf(ctx context.Context, accountIDs []int) ([]*InterestAdjustment, error)
+	// ListPayouts returns the account's maturity payouts, oldest first
+	ListPayouts(ctx context.Context, accountID int) ([]*Payout, error)
+	// ListPayoutsOf returns the maturity payouts of the accounts in
+	// accountIDs, each account's oldest first
+	ListPayoutsOf(ctx context.Context, accountIDs []int) ([]*Payout, error)
+	// ListStatusChanges returns every status the account has had, oldest
+	// first, including those of an account since closed
+	ListStatusChanges(ctx context.Context, accountID int) ([]*StatusChange, error)
+	// ListStatusChangesOf returns the status changes of the accounts in
+	// accountIDs, each account's oldest first
+	ListStatusChangesOf(ctx context.Context, accountIDs []int) ([]*StatusChange, error)
+
+	// ConfirmPayout marks the account's pending payout sent and returns it,
+	// reporting whether it closed a closing account
+	ConfirmPayout(ctx context.Context, accountID int) (*Payout, bool, error)
+	// FailPayout marks the account's in-flight payout failed and returns it with the account holder's user ID
+	FailPayout(ctx context.Context, accountID int, reason string) (*Payout, int, error)
+	// RetryPayout re-queues the account's failed payout and returns it with the account holder's user ID
+	RetryPayout(ctx context.Context, accountID int, destination string) (*Payout, int, error)
+
+	// RecordCommunication appends to the communications log and sets c's ID and CreatedAt
+	RecordCommunication(ctx context.Context, c *Communication) error
+	// ListCommunications returns the account's communications log, oldest first
+	ListCommunications(ctx context.Context, accountID int) ([]*Communication, error)
+	// ClaimNotifications returns up to limit pending notifications of the
+	// priority lane, oldest first, hiding them from other workers for lease
+	ClaimNotifications(ctx context.Context, priority string, now time.Time, lease time.Duration, limit int) ([]*Communication, error)
+	// UpdateCommunicationStatus records a notification's delivery outcome,
+	// stamping sent_at when it was sent
+	UpdateCommunicationStatus(ctx context.Context, id int, status, lastError string) error
+	// QueueNotifications records pending notifications, skipping any whose
+	// dedup key was queued on the same channel before, and returns how many
+	// were new. A non-empty consumer's event cursor is moved to cursor in the
+	// same transaction.
+	QueueNotifications(ctx context.Context, comms []*Communication, consumer string, cursor int64) (int, error)
+	// EventCursor returns the ID of the last outbox event consumer has read, 0 before its first
+	EventCursor(ctx context.Context, consumer string) (int64, error)
+	// ListOutboxAfter returns up to limit outbox events after afterID that
+	// were created before before, in order
+	ListOutboxAfter(ctx context.Context, afterID int64, before time.Time, limit int) ([]*OutboxEvent, error)
+	// LastOutboxID returns the ID of the newest outbox event created before
+	// before, 0 when there is none
+	LastOutboxID(ctx context.Context, before time.Time) (int64, error)
+	// ListUserOutboxAfter returns up to limit outbox events about userID's
+	// accounts in the context's tenant with IDs after afterID and up to
+	// throughID, in order
+	ListUserOutboxAfter(ctx context.Context, userID int, afterID, throughID int64, limit int) ([]*OutboxEvent, error)
+	// ListEventLog returns up to limit outbox events after afterID, in
+	// order, limited to one account's external ID and one event type when
+	// they are not empty
+	ListEventLog(ctx context.Context, afterID int64, accountKey, eventType string, limit int) ([]*OutboxEvent, error)
+	// RewindEventCursor moves consumer's event cursor back to cursor, so the
+	// events after it are read again. A cursor already at or before it is
+	// left alone.
+	RewindEventCursor(ctx context.Context, consumer string, cursor int64) error
+	// ListDueMaturityReminders returns up to limit active accounts within
+	// their holder's reminder lead time of maturity (defaultDays for holders
+	// without preferences) that have no reminder yet and whose holder has
+	// not opted out, soonest first
+	ListDueMaturityReminders(ctx context.Context, now time.Time, defaultDays, limit int) ([]*BlockAccount, error)
+	// GetNotificationPreferences returns nil when the user never set any
+	GetNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error)
+	// SaveNotificationPreferences creates or replaces the user's preferences
+	SaveNotificationPreferences(ctx context.Context, prefs *NotificationPreferences) (*NotificationPreferences, error)
+	// MuteNotifications ends the account's mute active at now, if any, and
+	// records m in its place in one transaction
+	MuteNotifications(ctx context.Context, m *NotificationMute, now time.Time) (*NotificationMute, error)
+	// UnmuteNotifications ends the account's mute active at now, returning
+	// nil when there is none
+	UnmuteNotifications(ctx context.Context, accountID int, now time.Time, endedBy string) (*NotificationMute, error)
+	// ActiveNotificationMute returns the account's mute active at now, or nil
+	ActiveNotificationMute(ctx context.Context, accountID int, now time.Time) (*NotificationMute, error)
+	// ListNotificationMutes returns every mute of the account, newest first
+	ListNotificationMutes(ctx context.Context, accountID int) ([]*NotificationMute, error)
+
+	// ListAccountHolders returns the account's holders, its primary holder
+	// first and then its secondary holders in the order they were added
+	ListAccountHolders(ctx context.Context, accountID int) ([]*AccountHolder, error)
+	// AddAccountHolder records h, setting its CreatedAt, or returns
+	// ErrAlreadyHolder when its user already holds the account
+	AddAccountHolder(ctx context.Context, h *AccountHolder) error
+	// RemoveAccountHolder removes a secondary holder from the account,
+	// returning sql.ErrNoRows when userID is not one
+	RemoveAccountHolder(ctx context.Context, accountID, userID int) error
+	// ListSecondaryHolderIDs returns the user IDs of the secondary holders
+	// of the accounts, each once
+	ListSecondaryHolderIDs(ctx context.Context, accountIDs []int) ([]int, error)
+	// ListBeneficiaries returns the beneficiaries of the accounts, by account
+	// and then in the order they were named
+	ListBeneficiaries(ctx context.Context, accountIDs []int) ([]*Beneficiary, error)
+	// ReplaceBeneficiaries stores beneficiaries in place of the account's
+	// current ones in one transaction; none clears them
+	ReplaceBeneficiaries(ctx context.Context, accountID int, beneficiaries []*Beneficiary) error
+	// ListArchivable returns up to limit IDs of accounts, lowest first, that
+	// ended in status before closedBefore. Closed accounts are the deleted
+	// ones whose history is still kept.
+	ListArchivable(ctx context.Context, status string, closedBefore time.Time, limit int) ([]int, error)
+	// ArchiveAccount stores a in archived_accounts and purges the account,
+	// its history and everything that goes with it from the live tables, in
+	// one transaction. It returns sql.ErrNoRows, archiving nothing, when the
+	// account is no longer in a.Status.
+	ArchiveAccount(ctx context.Context, a *ArchivedAccount) error
+	// GetArchivedAccount returns nil when the account was not archived
+	GetArchivedAccount(ctx context.Context, accountID int) (*ArchivedAccount, error)
+	// RewriteSensitiveFields passes every non-empty value of sensitiveColumns
+	// through rewrite, with its field named table.column, and stores what it
+	// returns when that differs. It returns how many values it changed.
+	RewriteSensitiveFields(ctx context.Context, rewrite func(ctx context.Context, field, value string) (string, error)) (int, error)
+
+	// RecordAccountCreation records who opened an account and from where, for
+	// velocity checks, and forgets creations from before forgetBefore
+	RecordAccountCreation(ctx context.Context, accountID, userID int, clientIP string, at, forgetBefore time.Time) error
+	// CountAccountCreations returns the accounts opened since by userID and
+	// from clientIP. The IP count is 0 when clientIP is empty.
+	CountAccountCreations(ctx context.Context, userID int, clientIP string, since time.Time) (byUser, byIP int, err error)
+	// FindIdempotentCreate returns the account a create with the
+	// idempotency key opened since since, and the fingerprint of that
+	// create's request, or 0 when none did
+	FindIdempotentCreate(ctx context.Context, key string, since time.Time) (int, string, error)
+	// RaiseComplianceFlag adds an occurrence to the open flag of f's rule and
+	// subject last seen since since, or queues f as a new flag when there is none
+	RaiseComplianceFlag(ctx context.Context, f *ComplianceFlag, now, since time.Time) (*ComplianceFlag, error)
+	// GetComplianceFlag returns nil when the flag does not exist
+	GetComplianceFlag(ctx context.Context, id int) (*ComplianceFlag, error)
+	// ListComplianceFlags returns up to limit flags, newest first, only those in status when it is set
+	ListComplianceFlags(ctx context.Context, status string, limit int) ([]*ComplianceFlag, error)
+	// ReviewComplianceFlag closes an open flag with status. It returns
+	// sql.ErrNoRows when the flag is not open.
+	ReviewComplianceFlag(ctx context.Context, id int, status, staffID, note string, now time.Time) (*ComplianceFlag, error)
+
+	// RecordReconciliationBreak updates the figures of the account's
+	// unresolved break and adds an occurrence to it, or opens b as a new
+	// break when there is none
+	RecordReconciliationBreak(ctx context.Context, b *ReconciliationBreak, now time.Time) (*ReconciliationBreak, error)
+	// ResolveReconciliationBreaks resolves the unresolved breaks of the
+	// accounts in accountIDs and returns how many it resolved
+	ResolveReconciliationBreaks(ctx context.Context, accountIDs []int, now time.Time) (int, error)
+	// GetReconciliationBreak returns nil when the break does not exist
+	GetReconciliationBreak(ctx context.Context, id int) (*ReconciliationBreak, error)
+	// ListReconciliationBreaks returns up to limit breaks, newest first, only those in status when it is set
+	ListReconciliationBreaks(ctx context.Context, status string, limit int) ([]*ReconciliationBreak, error)
+	// AcknowledgeReconciliationBreak acknowledges an open break. It returns
+	// sql.ErrNoRows when the break is not open.
+	AcknowledgeReconciliationBreak(ctx context.Context, id int, staffID, note string, now time.Time) (*ReconciliationBreak, error)
+
+	// CreateAPIKey stores k, which carries the hash of its secret
+	CreateAPIKey(ctx context.Context, k *APIKey) (*APIKey, error)
+	// GetAPIKey returns nil when the key does not exist
+	GetAPIKey(ctx context.Context, id int) (*APIKey, error)
+	// GetAPIKeyByPrefix returns nil when no key has prefix
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	// ListAPIKeys returns every key, newest first
+	ListAPIKeys(ctx context.Context) ([]*APIKey, error)
+	// RotateAPIKey replaces an unrevoked key's hash, keeping the old one
+	// valid until previousExpiresAt. It returns sql.ErrNoRows when the key
+	// does not exist or is revoked.
+	RotateAPIKey(ctx context.Context, id int, keyHash string, previousExpiresAt, now time.Time) (*APIKey, error)
+	// RevokeAPIKey revokes an unrevoked key. It returns sql.ErrNoRows when
+	// the key does not exist or is already revoked.
+	RevokeAPIKey(ctx context.Context, id int, revokedBy string, now time.Time) (*APIKey, error)
+	// TouchAPIKey records that the key was used at now
+	TouchAPIKey(ctx context.Context, id int, now time.Time) error
+
+	// ResolveAccountID returns the internal ID of the account with
+	// externalID, including accounts since deleted, or 0 when there is none
+	ResolveAccountID(ctx context.Context, externalID string) (int, error)
+	// GetRegionState returns the active region as last set by a failover,
+	// or nil before the first one. It always reads the primary.
+	GetRegionState(ctx context.Context) (*RegionState, error)
+	// PromoteRegion makes region the active one and advances the epoch, as
+	// long as the epoch is still fromEpoch. It returns sql.ErrNoRows when
+	// another failover got there first.
+	PromoteRegion(ctx context.Context, region string, fromEpoch int, promotedBy string, now time.Time) (*RegionState, error)
+	// ClaimDeployment records whether the database belongs to a sandbox
+	// unless that was recorded before, and returns what is recorded
+	ClaimDeployment(ctx context.Context, sandbox bool, now time.Time) (bool, error)
+	// ClockOffset returns how far the deployment's clock runs ahead of real
+	// time, 0 before the deployment is claimed
+	ClockOffset(ctx context.Context) (time.Duration, error)
+	// AdvanceClock moves the deployment's clock forward by d and returns its
+	// new offset. It returns sql.ErrNoRows before the deployment is claimed.
+	AdvanceClock(ctx context.Context, d time.Duration) (time.Duration, error)
+	// ReplicationLag returns how far the replica reads are served from is
+	// behind its primary, 0 when reads are served by a primary
+	ReplicationLag(ctx context.Context) (time.Duration, error)
+	// RecordWorkerHeartbeat records that a worker finished a run, replacing
+	// its previous heartbeat
+	RecordWorkerHeartbeat(ctx context.Context, hb *WorkerHeartbeat) error
+	// ListWorkerHeartbeats returns the last heartbeat of every worker that
+	// has recorded one, by worker name. It always reads the primary.
+	ListWorkerHeartbeats(ctx context.Context) ([]*WorkerHeartbeat, error)
+	// AcquireWorkerLease makes holder the leader of worker until lease after
+	// now, when the lease is free, has lapsed or is already holder's, and
+	// reports whether holder leads
+	AcquireWorkerLease(ctx context.Context, worker, holder string, now time.Time, lease time.Duration) (bool, error)
+	// ReleaseWorkerLease gives up holder's lease on worker, if it holds it
+	ReleaseWorkerLease(ctx context.Context, worker, holder string) error
+
+	// AccountExternalIDs maps each of the internal account IDs that has an
+	// external ID to it
+	AccountExternalIDs(ctx context.Context, ids []int) (map[int]string, error)
+
+	// RelayOutbox hands up to limit unpublished events to publish in order and
+	// marks each published once publish returns nil. It stops at the first
+	// failure, recording it against that event, and returns the number published.
+	RelayOutbox(ctx context.Context, limit int, publish func(*OutboxEvent) error) (int, error)
+
+	CreateWebhook(ctx context.Context, webhook *Webhook) (*Webhook, error)
+	GetWebhook(ctx context.Context, id int) (*Webhook, error)
+	// DeleteWebhook removes the webhook and its deliveries
+	DeleteWebhook(ctx context.Context, id int) error
+	// ListWebhookDeliveries returns up to limit of the webhook's deliveries, newest first, with their attempt logs
+	ListWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]*WebhookDelivery, error)
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due at now
+	// with their destinations, hiding them from other workers for lease
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error)
+	// RecordWebhookAttempt logs the attempt and saves the delivery's new state
+	RecordWebhookAttempt(ctx context.Context, delivery *WebhookDelivery, attempt *WebhookAttempt) error
+	// EnqueueOperationalEvent queues a delivery of the event for every active
+	// operations webhook subscribed to it and returns how many were queued
+	EnqueueOperationalEvent(ctx context.Context, e *OperationalEvent) (int, error)
+	// ReplayWebhookDeliveries re-queues the webhook's failed deliveries at now and returns how many
+	ReplayWebhookDeliveries(ctx context.Context, webhookID int, now time.Time) (int, error)
+
+	// CreateImpersonation stores a new session and sets its ID and CreatedAt
+	CreateImpersonation(ctx context.Context, session *ImpersonationSession) (*ImpersonationSession, error)
+	GetImpersonation(ctx context.Context, id int) (*ImpersonationSession, error)
+	GetImpersonationByTokenHash(ctx context.Context, tokenHash string) (*ImpersonationSession, error)
+	// EndImpersonation ends an active session at now
+	EndImpersonation(ctx context.Context, id int, now time.Time) error
+	RecordImpersonationAccess(ctx context.Context, access *ImpersonationAccess) error
+	// ListImpersonationAudit returns the requests made with a session, oldest first
+	ListImpersonationAudit(ctx context.Context, sessionID int) ([]*ImpersonationAccess, error)
+
+	// GetProductGate returns the product's gate, or nil if it is generally available
+	GetProductGate(ctx context.Context, product string) (*ProductGate, error)
+	ListProductGates(ctx context.Context) ([]*ProductGate, error)
+	// SaveProductGate creates or replaces the product's gate and sets its UpdatedAt
+	SaveProductGate(ctx context.Context, gate *ProductGate) error
+	DeleteProductGate(ctx context.Context, product string) error
+	// ListFeatureFlags returns the feature flags set through the admin API,
+	// of every tenant
+	ListFeatureFlags(ctx context.Context) ([]*FeatureFlag, error)
+	// SaveFeatureFlag creates or replaces the flag and sets its UpdatedAt
+	SaveFeatureFlag(ctx context.Context, flag *FeatureFlag) error
+	// DeleteFeatureFlag returns sql.ErrNoRows when the flag is not set
+	DeleteFeatureFlag(ctx context.Context, name string) error
+
+	ListAccountLimits(ctx context.Context) ([]*AccountLimit, error)
+	// SaveAccountLimit creates or replaces the limit for its rule and period and sets its UpdatedAt
+	SaveAccountLimit(ctx context.Context, limit *AccountLimit) error
+	DeleteAccountLimit(ctx context.Context, rule, period string) error
+	// UserExists reports whether the user is in the local users table
+	UserExists(ctx context.Context, userID int) (bool, error)
+	// SaveUsers adds the users that are not in the local users table yet
+	SaveUsers(ctx context.Context, userIDs []int) error
+	// GetUserExposure counts the active, pending funding and frozen accounts
+	// the user holds, jointly or alone, and sums their principal
+	GetUserExposure(ctx context.Context, userID int) (UserExposure, error)
+
+	// CreateAccountImport stores a queued import with its rows, and the job
+	// that loads it, and sets their IDs and CreatedAt
+	CreateAccountImport(ctx context.Context, imp *AccountImport, job *Job) (*AccountImport, error)
+	// GetAccountImport returns an import with its results, without its rows
+	GetAccountImport(ctx context.Context, id int) (*AccountImport, error)
+	// StartAccountImport marks the import loaded by the job running and
+	// returns it with its rows, or nil when there is none
+	StartAccountImport(ctx context.Context, jobID int) (*AccountImport, error)
+	// CompleteAccountImport saves a finished import's status and results
+	CompleteAccountImport(ctx context.Context, imp *AccountImport) error
+
+	// CreateEventReplay stores a queued replay and sets its ID and CreatedAt
+	CreateEventReplay(ctx context.Context, replay *EventReplay) (*EventReplay, error)
+	GetEventReplay(ctx context.Context, id int) (*EventReplay, error)
+	// ClaimEventReplay returns the oldest queued replay, or running one whose
+	// lease ran out, hiding it from other workers for lease
+	ClaimEventReplay(ctx context.Context, now time.Time, lease time.Duration) (*EventReplay, error)
+	// ListReplayEvents returns up to limit outbox events matching the replay's
+	// filters after its LastOutboxID, in order
+	ListReplayEvents(ctx context.Context, replay *EventReplay, limit int) ([]*OutboxEvent, error)
+	// SaveEventReplay saves a replay's status, position and last error
+	SaveEventReplay(ctx context.Context, replay *EventReplay) error
+	// QueueReplayDeliveries queues deliveries of the events the replay's
+	// webhook subscribes to and advances the replay past them in one transaction
+	QueueReplayDeliveries(ctx context.Context, replay *EventReplay, events []*OutboxEvent) error
+
+	// CreateJob stores a queued job and sets its ID and CreatedAt
+	CreateJob(ctx context.Context, job *Job) (*Job, error)
+	GetJob(ctx context.Context, id int) (*Job, error)
+	// CountPendingJobs counts the queued and running jobs of jobType
+	CountPendingJobs(ctx context.Context, jobType string) (int, error)
+	// ClaimJob returns the oldest queued job, or running one whose lease ran
+	// out, marked running and hidden from other workers for lease. Every
+	// claim counts as an attempt. Jobs pinned to a region are only claimed
+	// for that region; pinnedOnly claims nothing else.
+	ClaimJob(ctx context.Context, now time.Time, lease time.Duration, region string, pinnedOnly bool) (*Job, error)
+	// RenewJob extends a running job's lease and reports whether it was asked to cancel
+	RenewJob(ctx context.Context, id int, leaseUntil time.Time) (bool, error)
+	SaveJobProgress(ctx context.Context, id int, progress JobProgress) error
+	// FinishJob saves a job's final status, result and error
+	FinishJob(ctx context.Context, job *Job) error
+	// CancelJob cancels a queued job or flags a running one for cancellation
+	// at now. It returns nil when the job does not exist and ErrJobFinished
+	// when it has already finished.
+	CancelJob(ctx context.Context, id int, now time.Time) (*Job, error)
+
+	// CreateApproval stores a pending approval and sets its ID, Status and CreatedAt
+	CreateApproval(ctx context.Context, approval *Approval) (*Approval, error)
+	GetApproval(ctx context.Context, id int) (*Approval, error)
+	// ListApprovals returns up to limit approvals, newest first, only those in status when it is set
+	ListApprovals(ctx context.Context, status string, limit int) ([]*Approval, error)
+	// DecideApproval moves a pending approval requested by someone other than
+	// staffID to status. It returns sql.ErrNoRows when no such approval is pending.
+	DecideApproval(ctx context.Context, id int, status, staffID, note string) (*Approval, error)
+	// FailApproval records that an approved action could not be carried out
+	FailApproval(ctx context.Context, id int, reason string) error
+
+	// ActiveExposureByPeriod aggregates active accounts per period
+	ActiveExposureByPeriod(ctx context.Context) ([]PeriodExposure, error)
+	// PortfolioGroups aggregates all accounts per status and period
+	PortfolioGroups(ctx context.Context) ([]PortfolioGroup, error)
+	// MaturingTotals counts and sums the active accounts ending in (from, to]
+	MaturingTotals(ctx context.Context, from, to time.Time) (int, float64, error)
+	// MaturityCalendar aggregates the active accounts ending in [from, to)
+	// per day, week or month of their end date in loc, earliest first.
+	// Buckets without maturities are left out.
+	MaturityCalendar(ctx context.Context, from, to time.Time, groupBy string, loc *time.Location) ([]*MaturityBucket, error)
+	// DailySummary aggregates the accounts opened, matured and accruing in [from, to)
+	DailySummary(ctx context.Context, from, to time.Time) (*DailySummary, error)
+	// SaveReport records a generated report, replacing an earlier one of the
+	// same type and date, and sets its ID and CreatedAt
+	SaveReport(ctx context.Context, report *Report) (*Report, error)
+	// GetReport returns the report of a type for a date, or nil if none was generated
+	GetReport(ctx context.Context, reportType, date string) (*Report, error)
+	// DashboardCounts reads the operations dashboard counters, counting jobs failed since failedSince
+	DashboardCounts(ctx context.Context, failedSince time.Time) (*Dashboard, error)
+
+	// GetCheckpoint returns the job's checkpoint, or nil if it has never run
+	GetCheckpoint(ctx context.Context, job string) (*WorkerCheckpoint, error)
+	// SaveCheckpoint creates or replaces the job's checkpoint
+	SaveCheckpoint(ctx context.Context, cp *WorkerCheckpoint) error
+
+	// ListScheduledJobs returns the scheduled jobs that have been scheduled,
+	// paused or triggered, by name
+	ListScheduledJobs(ctx context.Context) ([]*ScheduledJob, error)
+	// GetScheduledJob returns nil when job has no state yet
+	GetScheduledJob(ctx context.Context, job string) (*ScheduledJob, error)
+	// ScheduleJob records the schedule job runs on and its next run
+	ScheduleJob(ctx context.Context, job, schedule string, nextRunAt time.Time) error
+	// StartScheduledRun marks job running since at and clears a run
+	// triggered up to then
+	StartScheduledRun(ctx context.Context, job string, at time.Time) error
+	// FinishScheduledRun records the end of job's run at at, with the error
+	// it failed with or "" when it succeeded
+	FinishScheduledRun(ctx context.Context, job string, at time.Time, runErr string) error
+	// PauseScheduledJob pauses or resumes job's scheduled runs
+	PauseScheduledJob(ctx context.Context, job string, paused bool, staffID string) error
+	// TriggerScheduledJob asks for a run of job. A run already asked for and
+	// not yet started is kept.
+	TriggerScheduledJob(ctx context.Context, job string, at time.Time, staffID string) error
+
+	// GetTenant returns nil when the tenant does not exist
+	GetTenant(ctx context.Context, id string) (*Tenant, error)
+	ListTenants(ctx context.Context) ([]*Tenant, error)
+	// CreateTenant stores a new tenant and sets its CreatedAt. It returns
+	// ErrTenantExists when the ID is taken.
+	CreateTenant(ctx context.Context, tenant *Tenant) (*Tenant, error)
+	// ListTenantRates returns the rates tenant set for itself, or those of
+	// every tenant when it is empty
+	ListTenantRates(ctx context.Context, tenant string) ([]*TenantRate, error)
+	// SaveTenantRate creates or replaces the tenant's rate for its period and sets its UpdatedAt
+	SaveTenantRate(ctx context.Context, rate *TenantRate) error
+	DeleteTenantRate(ctx context.Context, tenant, period string) error
+
+	// ListProductDefinitions returns every product, retired ones included
+	ListProductDefinitions(ctx context.Context) ([]*ProductDefinition, error)
+	// SaveProductDefinition creates or replaces the product, offering it
+	// again if it was retired, and sets its CreatedAt and UpdatedAt
+	SaveProductDefinition(ctx context.Context, product *ProductDefinition) error
+	// RetireProduct marks the product retired by staffID. It returns
+	// sql.ErrNoRows when no product that can be opened has the code.
+	RetireProduct(ctx context.Context, code, staffID string) error
+
+	Ping(ctx context.Context) error
+	// PoolStats reports the primary database's connection pool
+	PoolStats() sql.DBStats
+}
+
+// PeriodExposure aggregates the active accounts of one period
+type PeriodExposure struct {
+	Period    string
+	Accounts  int
+	Principal float64
+	// PrincipalYears is the sum of principal times term length in years,
+	// so full-term interest at a flat rate r is r * PrincipalYears
+	PrincipalYears float64
+	// Interest is the full-term interest owed at the accounts' own rates
+	Interest float64
+}
+
+// scanExposures scans and closes rows of per-period aggregates
+func scanExposures(rows *sql.Rows) ([]PeriodExposure, error) {
+	defer rows.Close()
+
+	var exposures []PeriodExposure
+	for rows.Next() {
+		var e PeriodExposure
+		if err := rows.Scan(&e.Period, &e.Accounts, &e.Principal, &e.PrincipalYears, &e.Interest); err != nil {
+			return nil, err
+		}
+		exposures = append(exposures, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return exposures, nil
+}
+
+// dashboardCountsQuery reads every dashboard counter in one round trip. Its
+// single bind parameter is when failed jobs start counting.
+const dashboardCountsQuery = `SELECT
+	(SELECT COUNT(*) FROM outbox WHERE published_at IS NULL),
+	(SELECT COUNT(*) FROM webhook_deliveries WHERE status='pending'),
+	(SELECT COUNT(*) FROM communications WHERE status='pending'),
+	(SELECT COUNT(*) FROM jobs WHERE status='queued'),
+	(SELECT COUNT(*) FROM jobs WHERE status='running'),
+	(SELECT COUNT(*) FROM event_replays WHERE status IN ('queued', 'running')),
+	(SELECT COUNT(*) FROM jobs WHERE status='failed' AND completed_at >= %s),
+	(SELECT COUNT(*) FROM approvals WHERE status='pending'),
+	(SELECT COUNT(*) FROM block_accounts WHERE status='payout_failed'),
+	(SELECT COUNT(*) FROM block_accounts WHERE status='funding_failed'),
+	(SELECT COUNT(*) FROM block_accounts WHERE status='pending_funding'),
+	(SELECT COUNT(*) FROM block_accounts WHERE status='frozen')`
+
+// scanDashboardCounts scans the row selected by dashboardCountsQuery
+func scanDashboardCounts(row *sql.Row) (*Dashboard, error) {
+	var d Dashboard
+	err := row.Scan(&d.Queues.Outbox, &d.Queues.WebhookDeliveries, &d.Queues.Notifications, &d.Queues.JobsQueued,
+		&d.Queues.JobsRunning, &d.Queues.EventReplays, &d.FailedJobs, &d.PendingApprovals, &d.Accounts.PayoutFailed,
+		&d.Accounts.FundingFailed, &d.Accounts.PendingFunding, &d.Accounts.Frozen)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// dailySummaryQuery aggregates a day's report in one round trip. The
+// backends differ only in how they compute the interest accrued in the
+// overlap of the day and each account's term, which is passed as accrual
+// with the day's bounds bound as from and to.
+func dailySummaryQuery(accrual, from, to string) string {
+	return `SELECT
+	(SELECT COUNT(*) FROM block_accounts WHERE created_at >= ` + from + ` AND created_at < ` + to + ` AND status <> 'funding_failed'),
+	(SELECT COALESCE(SUM(principal), 0) FROM block_accounts WHERE created_at >= ` + from + ` AND created_at < ` + to + ` AND status <> 'funding_failed'),
+	(SELECT COUNT(*) FROM block_accounts WHERE end_date >= ` + from + ` AND end_date < ` + to + `
+		AND status IN ('matured', 'rolled_over', 'payout_failed')),
+	(SELECT COALESCE(SUM(principal), 0) FROM block_accounts WHERE end_date >= ` + from + ` AND end_date < ` + to + `
+		AND status IN ('matured', 'rolled_over', 'payout_failed')),
+	(SELECT COALESCE(SUM(` + accrual + `), 0) FROM block_accounts WHERE start_date < ` + to + ` AND end_date > ` + from + `
+		AND status NOT IN ('pending_funding', 'funding_failed'))`
+}
+
+// scanDailySummary scans the row selected by dailySummaryQuery
+func scanDailySummary(row *sql.Row) (*DailySummary, error) {
+	var d DailySummary
+	err := row.Scan(&d.NewAccounts.Accounts, &d.NewAccounts.Principal, &d.MaturedAccounts.Accounts,
+		&d.MaturedAccounts.Principal, &d.InterestAccrued)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// maturityCalendarQuery aggregates the maturity calendar in one round trip.
+// The backends differ in how they truncate an end date to its bucket's first
+// day, passed as bucket, and in how they compute the interest an account
+// still pays at maturity, passed as interest. The window's bounds are bound
+// as from and to and the tenant as tenant.
+func maturityCalendarQuery(bucket, interest, from, to, tenant string) string {
+	return `SELECT bucket, COUNT(*), COALESCE(SUM(principal), 0), COALESCE(SUM(interest), 0),
+	COALESCE(SUM(CASE WHEN maturity_instruction = 'rollover' THEN principal + interest ELSE 0 END), 0)
+	FROM (SELECT ` + bucket + ` AS bucket, principal, maturity_instruction, ` + interest + ` AS interest
+		FROM block_accounts WHERE status = 'active' AND end_date >= ` + from + ` AND end_date < ` + to + `
+		AND tenant_id = COALESCE(NULLIF(` + tenant + `, ''), tenant_id)) maturing
+	GROUP BY bucket ORDER BY bucket`
+}
+
+// scanMaturityBuckets scans the rows selected by maturityCalendarQuery
+func scanMaturityBuckets(rows *sql.Rows) ([]*MaturityBucket, error) {
+	defer rows.Close()
+	var buckets []*MaturityBucket
+	for rows.Next() {
+		var b MaturityBucket
+		if err := rows.Scan(&b.Start, &b.Accounts, &b.Principal, &b.Interest, &b.RolloverAmount); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, &b)
+	}
+	return buckets, rows.Err()
+}
+
+// reportColumns is the column list scanned by scanReport
+const reportColumns = `id, type, report_date, summary, recipients, COALESCE(document_key, ''), requested_by, created_at`
+
+// scanReport scans a row selected with reportColumns. The summary is stored
+// as JSON and the recipients comma-separated.
+func scanReport(row interface{ Scan(...any) error }, r *Report) error {
+	var summary []byte
+	var recipients string
+	if err := row.Scan(&r.ID, &r.Type, &r.Date, &summary, &recipients, &r.DocumentKey, &r.RequestedBy, &r.CreatedAt); err != nil {
+		return err
+	}
+	r.Recipients = []string{}
+	if recipients != "" {
+		r.Recipients = strings.Split(recipients, ",")
+	}
+	return json.Unmarshal(summary, &r.Summary)
+}
+
+func scanPortfolioGroups(rows *sql.Rows) ([]PortfolioGroup, error) {
+	defer rows.Close()
+
+	var groups []PortfolioGroup
+	for rows.Next() {
+		var g PortfolioGroup
+		if err := rows.Scan(&g.Status, &g.Period, &g.Accounts, &g.Principal, &g.RateSum, &g.WeightedRateSum); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// MaturityOutcome describes how a due account matures
+type MaturityOutcome struct {
+	Status   string        // new status of the matured account
+	Rollover *BlockAccount // deposit to open in its place, if any
+	Payout   *Payout       // payout to queue, if any
+}
+
+// InterestOutcome describes an interest payment due on an account
+type InterestOutcome struct {
+	Payout *InterestPayout // payment to record; the account is paid through its PeriodEnd
+	// NextPayoutDate is when the following payment is due, or nil when the
+	// rest of the interest is paid at maturity
+	NextPayoutDate *time.Time
+}
+
+// Supported DB_DRIVER values
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// newRepository returns the Repository implementation for driver. replica,
+// when not nil, serves the reads that can tolerate its lag; only postgres
+// supports one.
+func newRepository(driver string, db *sql.DB, replica *replicaRouter) (Repository, error) {
+	switch driver {
+	case DriverPostgres:
+		return &postgresRepository{db: db, replica: replica}, nil
+	case DriverSQLite:
+		return &sqliteRepository{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER: %s", driver)
+	}
+}
+
+// stmtCache prepares each hot statement once per database handle and reuses
+// it, instead of having the server parse and plan the SQL on every request.
+// database/sql re-prepares a cached statement transparently on connections
+// that haven't seen it yet. The zero value is ready to use.
+type stmtCache struct {
+	mu    sync.Mutex
+	stmts map[stmtKey]*sql.Stmt
+}
+
+type stmtKey struct {
+	db    *sql.DB
+	query string
+}
+
+// prepare returns the cached statement for query on db, preparing it on first use
+func (c *stmtCache) prepare(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := stmtKey{db: db, query: query}
+	if stmt, ok := c.stmts[key]; ok {
+		return stmt, nil
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if c.stmts == nil {
+		c.stmts = make(map[stmtKey]*sql.Stmt)
+	}
+	c.stmts[key] = stmt
+	return stmt, nil
+}
+
+// accountRefColumn selects the external ID of the account that table's
+// account_id refers to, from account_ids so it outlives the account
+func accountRefColumn(table string) string {
+	return `COALESCE((SELECT CAST(external_id AS TEXT) FROM account_ids WHERE account_ids.account_id = ` +
+		table + `.account_id), '')`
+}
+
+// accountTenantColumn selects the tenant of the account that table's
+// account_id refers to, from account_ids so it outlives the account
+func accountTenantColumn(table string) string {
+	return `COALESCE((SELECT tenant_id FROM account_ids WHERE account_ids.account_id = ` +
+		table + `.account_id), '` + DefaultTenant + `')`
+}
+
+// accountColumns is the column list scanned by scanAccount
+const accountColumns = `id, external_id, user_id, principal, start_date, end_date, interest_rate, COALESCE(period, ''), status,
+         maturity_instruction, COALESCE(payout_destination, ''), payout_frequency, next_payout_date,
+         interest_paid_through, interest_adjustment, tenant_id, created_at, updated_at`
+
+// scanAccount scans a row selected with accountColumns
+func scanAccount(row interface{ Scan(...any) error }, account *BlockAccount) error {
+	var nextPayout, paidThrough sql.NullTime
+	if err := row.Scan(&account.ID, &account.ExternalID, &account.UserID, &account.Principal, &account.StartDate, &account.EndDate,
+		&account.InterestRate, &account.Period, &account.Status, &account.MaturityInstruction,
+		&account.PayoutDestination, &account.PayoutFrequency, &nextPayout, &paidThrough,
+		&account.InterestAdjustment, &account.TenantID, &account.CreatedAt, &account.UpdatedAt); err != nil {
+		return err
+	}
+	if nextPayout.Valid {
+		account.NextPayoutDate = &nextPayout.Time
+	}
+	if paidThrough.Valid {
+		account.InterestPaidThrough = &paidThrough.Time
+	}
+	return nil
+}
+
+// fundingColumns is the column list scanned by scanFunding
+var fundingColumns = `account_id, settlement_account, reference, amount, status, failure_reason, created_at,
+         updated_at, settled_at, ` + accountRefColumn("account_fundings")
+
+// scanFunding scans a row selected with fundingColumns
+func scanFunding(row interface{ Scan(...any) error }, f *Funding) error {
+	var settledAt sql.NullTime
+	if err := row.Scan(&f.AccountID, &f.SettlementAccount, &f.Reference, &f.Amount, &f.Status, &f.FailureReason,
+		&f.CreatedAt, &f.UpdatedAt, &settledAt, &f.AccountExternalID); err != nil {
+		return err
+	}
+	if settledAt.Valid {
+		f.SettledAt = &settledAt.Time
+	}
+	return nil
+}
+
+// scanFundings scans and closes rows selected with fundingColumns
+func scanFundings(rows *sql.Rows) ([]*Funding, error) {
+	defer rows.Close()
+
+	var fundings []*Funding
+	for rows.Next() {
+		var f Funding
+		if err := scanFunding(rows, &f); err != nil {
+			return nil, err
+		}
+		fundings = append(fundings, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return fundings, nil
+}
+
+// closureColumns is the column list scanned by scanClosure
+var closureColumns = `account_id, destination_account, method, amount, requested_at, closed_at`
+
+// scanClosure scans a row selected with closureColumns
+func scanClosure(row interface{ Scan(...any) error }, c *AccountClosure) error {
+	var closedAt sql.NullTime
+	if err := row.Scan(&c.AccountID, &c.DestinationAccount, &c.Method, &c.Amount, &c.RequestedAt, &closedAt); err != nil {
+		return err
+	}
+	if closedAt.Valid {
+		c.ClosedAt = &closedAt.Time
+	}
+	return nil
+}
+
+// fundingEvent returns the domain event for a settled funding
+func fundingEvent(status string) string {
+	if status == FundingConfirmed {
+		return EventAccountFunded
+	}
+	return EventAccountFundingFailed
+}
+
+// scanAccounts scans and closes rows selected with accountColumns
+func scanAccounts(rows *sql.Rows) ([]*BlockAccount, error) {
+	defer rows.Close()
+
+	var accounts []*BlockAccount
+	for rows.Next() {
+		var account BlockAccount
+		if err := scanAccount(rows, &account); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, &account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// payoutColumns is the column list scanned by scanPayout
+var payoutColumns = `id, account_id, destination_account, amount, status, COALESCE(failure_reason, ''), attempts, created_at, updated_at, ` +
+	accountRefColumn("payouts")
+
+func scanPayout(row interface{ Scan(...any) error }, p *Payout) error {
+	return row.Scan(&p.ID, &p.AccountID, &p.Destination, &p.Amount, &p.Status, &p.FailureReason,
+		&p.Attempts, &p.CreatedAt, &p.UpdatedAt, &p.AccountExternalID)
+}
+
+// scanPayouts scans and closes rows selected with payoutColumns
+func scanPayouts(rows *sql.Rows) ([]*Payout, error) {
+	defer rows.Close()
+
+	var payouts []*Payout
+	for rows.Next() {
+		var p Payout
+		if err := scanPayout(rows, &p); err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return payouts, nil
+}
+
+// interestAdjustmentColumns is the column list scanned by scanInterestAdjustments
+const interestAdjustmentColumns = `id, account_id, kind, amount, previous_rate, rate, reason, approval_id, requested_by,
+         approved_by, created_at, value_date`
+
+// scanInterestAdjustment scans a row selected with interestAdjustmentColumns
+func scanInterestAdjustment(row interface{ Scan(...any) error }, adj *InterestAdjustment) error {
+	var valueDate sql.NullTime
+	if err := row.Scan(&adj.ID, &adj.AccountID, &adj.Kind, &adj.Amount, &adj.PreviousRate, &adj.Rate, &adj.Reason,
+		&adj.ApprovalID, &adj.RequestedBy, &adj.ApprovedBy, &adj.CreatedAt, &valueDate); err != nil {
+		return err
+	}
+	if valueDate.Valid {
+		adj.ValueDate = &valueDate.Time
+	}
+	return nil
+}
+
+// scanInterestAdjustments scans and closes rows selected with interestAdjustmentColumns
+func scanInterestAdjustments(rows *sql.Rows) ([]*InterestAdjustment, error) {
+	defer rows.Close()
+
+	var adjustments []*InterestAdjustment
+	for rows.Next() {
+		var adj InterestAdjustment
+		if err := scanInterestAdjustment(rows, &adj); err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, &adj)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
+
+// statusChangeColumns is the column list scanned by scanStatusChanges
+var statusChangeColumns = `account_id, COALESCE(from_status, ''), to_status, principal, COALESCE(note, ''), changed_at`
+
+// scanStatusChanges scans and closes rows selected with statusChangeColumns
+func scanStatusChanges(rows *sql.Rows) ([]*StatusChange, error) {
+	defer rows.Close()
+
+	var changes []*StatusChange
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.AccountID, &c.From, &c.To, &c.Principal, &c.Note, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// interestPayoutColumns is the column list scanned by scanInterestPayouts
+var interestPayoutColumns = `id, account_id, destination_account, period_start, period_end, amount, status, created_at, ` +
+	accountRefColumn("interest_payouts")
+
+// scanInterestPayouts scans and closes rows selected with interestPayoutColumns
+func scanInterestPayouts(rows *sql.Rows) ([]*InterestPayout, error) {
+	defer rows.Close()
+
+	var payouts []*InterestPayout
+	for rows.Next() {
+		var p InterestPayout
+		if err := rows.Scan(&p.ID, &p.AccountID, &p.Destination, &p.PeriodStart, &p.PeriodEnd, &p.Amount,
+			&p.Status, &p.CreatedAt, &p.AccountExternalID); err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return payouts, nil
+}
+
+// communicationColumns is the column list scanned by scanCommunications
+var communicationColumns = `id, account_id, user_id, kind, event, subject, message, status, priority, channel,
+         COALESCE(last_error, ''), sent_at, created_at, ` + accountRefColumn("communications") + `, ` +
+	accountTenantColumn("communications")
+
+// scanCommunications scans and closes rows selected with communicationColumns
+func scanCommunications(rows *sql.Rows) ([]*Communication, error) {
+	defer rows.Close()
+
+	var communications []*Communication
+	for rows.Next() {
+		var c Communication
+		var sentAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.AccountID, &c.UserID, &c.Kind, &c.Event, &c.Subject, &c.Message,
+			&c.Status, &c.Priority, &c.Channel, &c.LastError, &sentAt, &c.CreatedAt, &c.AccountExternalID, &c.tenantID); err != nil {
+			return nil, err
+		}
+		if sentAt.Valid {
+			c.SentAt = &sentAt.Time
+		}
+		communications = append(communications, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return communications, nil
+}
+
+// notificationPreferencesColumns is the column list scanned by scanNotificationPreferences
+const notificationPreferencesColumns = `user_id, channels, email, phone, reminder_days, disabled_events, locale, updated_at`
+
+// scanNotificationPreferences scans a row selected with
+// notificationPreferencesColumns. Channels and disabled events are stored
+// comma-separated; a blank locale, from before customers chose one, is the
+// default locale.
+func scanNotificationPreferences(row *sql.Row) (*NotificationPreferences, error) {
+	var p NotificationPreferences
+	var channels, disabled string
+	var updatedAt time.Time
+	err := row.Scan(&p.UserID, &channels, &p.Email, &p.Phone, &p.ReminderDays, &disabled, &p.Locale, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = &updatedAt
+	p.Channels, p.DisabledEvents = []string{}, []string{}
+	if channels != "" {
+		p.Channels = strings.Split(channels, ",")
+	}
+	if disabled != "" {
+		p.DisabledEvents = strings.Split(disabled, ",")
+	}
+	if p.Locale == "" {
+		p.Locale = defaultLocale()
+	}
+	return &p, nil
+}
+
+// notificationMuteColumns is the column list scanned by scanNotificationMute
+var notificationMuteColumns = `id, account_id, muted_until, reason, muted_by, created_at, ended_at, COALESCE(ended_by, ''), ` +
+	accountRefColumn("notification_mutes")
+
+// scanNotificationMute scans a row selected with notificationMuteColumns
+func scanNotificationMute(row interface{ Scan(...any) error }, m *NotificationMute) error {
+	var endedAt sql.NullTime
+	if err := row.Scan(&m.ID, &m.AccountID, &m.MutedUntil, &m.Reason, &m.MutedBy, &m.CreatedAt,
+		&endedAt, &m.EndedBy, &m.AccountExternalID); err != nil {
+		return err
+	}
+	if endedAt.Valid {
+		m.EndedAt = &endedAt.Time
+	}
+	return nil
+}
+
+// scanNotificationMutes scans and closes rows selected with notificationMuteColumns
+func scanNotificationMutes(rows *sql.Rows) ([]*NotificationMute, error) {
+	defer rows.Close()
+
+	var mutes []*NotificationMute
+	for rows.Next() {
+		var m NotificationMute
+		if err := scanNotificationMute(rows, &m); err != nil {
+			return nil, err
+		}
+		mutes = append(mutes, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+// accountHolderColumns is the column list scanned by scanAccountHolders
+const accountHolderColumns = `account_id, user_id, role, added_by, created_at`
+
+// scanAccountHolders scans and closes rows selected with accountHolderColumns
+func scanAccountHolders(rows *sql.Rows) ([]*AccountHolder, error) {
+	defer rows.Close()
+
+	var holders []*AccountHolder
+	for rows.Next() {
+		var h AccountHolder
+		if err := rows.Scan(&h.AccountID, &h.UserID, &h.Role, &h.AddedBy, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		holders = append(holders, &h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return holders, nil
+}
+
+// beneficiaryColumns is the column list scanned by scanBeneficiaries
+const beneficiaryColumns = `account_id, name, relationship, allocation_percent, designated_by, created_at`
+
+// scanBeneficiaries scans and closes rows selected with beneficiaryColumns
+func scanBeneficiaries(rows *sql.Rows) ([]*Beneficiary, error) {
+	defer rows.Close()
+
+	var beneficiaries []*Beneficiary
+	for rows.Next() {
+		var b Beneficiary
+		if err := rows.Scan(&b.AccountID, &b.Name, &b.Relationship, &b.AllocationPercent, &b.DesignatedBy, &b.DesignatedAt); err != nil {
+			return nil, err
+		}
+		beneficiaries = append(beneficiaries, &b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return beneficiaries, nil
+}
+
+// sensitiveColumns are the columns encryptingRepository encrypts, with the
+// columns that key their table's rows. Values are encrypted for the field
+// table.column unless field names another.
+var sensitiveColumns = []struct {
+	table   string
+	key     []string
+	columns []string
+	field   string
+}{
+	{"account_beneficiaries", []string{"account_id", "position"}, []string{"name", "relationship"}, ""},
+	{"notification_preferences", []string{"tenant_id", "user_id"}, []string{"email", "phone"}, ""},
+	{"archived_accounts", []string{"account_id"}, []string{"record"}, ""},
+	{"block_accounts", []string{"id"}, []string{"payout_destination"}, accountNumberField},
+	{"account_fundings", []string{"account_id"}, []string{"settlement_account"}, accountNumberField},
+	{"account_closures", []string{"account_id"}, []string{"destination_account"}, accountNumberField},
+	{"payouts", []string{"id"}, []string{"destination_account"}, accountNumberField},
+	{"interest_payouts", []string{"id"}, []string{"destination_account"}, accountNumberField},
+}
+
+// rewriteSensitiveFieldsBatch is how many rows RewriteSensitiveFields reads
+// and updates at a time
+const rewriteSensitiveFieldsBatch = 500
+
+// rewriteSensitiveFields implements RewriteSensitiveFields for both
+// databases, which differ only in placeholders. Each batch of rows is
+// updated in its own transaction, so an interrupted run keeps what it did
+// and a second one carries on.
+func rewriteSensitiveFields(ctx context.Context, db *sql.DB, placeholder func(n int) string,
+	rewrite func(ctx context.Context, field, value string) (string, error)) (int, error) {
+	changed := 0
+	for _, t := range sensitiveColumns {
+		cols := append([]string{}, t.key...)
+		var set, where, fields []string
+		for i, c := range t.columns {
+			cols = append(cols, "COALESCE("+c+", '')")
+			set = append(set, c+"="+placeholder(i+1))
+			field := t.field
+			if field == "" {
+				field = t.table + "." + c
+			}
+			fields = append(fields, field)
+		}
+		for i, k := range t.key {
+			where = append(where, k+"="+placeholder(len(t.columns)+i+1))
+		}
+		update := `UPDATE ` + t.table + ` SET ` + strings.Join(set, ", ") + ` WHERE ` + strings.Join(where, " AND ")
+
+		for offset := 0; ; offset += rewriteSensitiveFieldsBatch {
+			rows, err := db.QueryContext(ctx,
+				`SELECT `+strings.Join(cols, ", ")+` FROM `+t.table+` ORDER BY `+strings.Join(t.key, ", ")+
+					` LIMIT `+strconv.Itoa(rewriteSensitiveFieldsBatch)+` OFFSET `+strconv.Itoa(offset))
+			if err != nil {
+				return changed, err
+			}
+			var batch [][]string
+			for rows.Next() {
+				values := make([]string, len(cols))
+				dest := make([]any, len(cols))
+				for i := range values {
+					dest[i] = &values[i]
+				}
+				if err := rows.Scan(dest...); err != nil {
+					rows.Close()
+					return changed, err
+				}
+				batch = append(batch, values)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return changed, err
+			}
+
+			n, err := rewriteRows(ctx, db, update, fields, len(t.key), batch, rewrite)
+			changed += n
+			if err != nil {
+				return changed, err
+			}
+			if len(batch) < rewriteSensitiveFieldsBatch {
+				break
+			}
+		}
+	}
+	return changed, nil
+}
+
+// rewriteRows rewrites the sensitive columns of rows, each its nkey key
+// values followed by its column values, in one transaction. fields names the
+// field each column is encrypted for.
+func rewriteRows(ctx context.Context, db *sql.DB, update string, fields []string, nkey int, rows [][]string,
+	rewrite func(ctx context.Context, field, value string) (string, error)) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	changed := 0
+	for _, row := range rows {
+		args := make([]any, 0, len(row))
+		differs := false
+		for i, field := range fields {
+			value := row[nkey+i]
+			if value != "" {
+				rewritten, err := rewrite(ctx, field, value)
+				if err != nil {
+					return 0, err
+				}
+				differs = differs || rewritten != value
+				value = rewritten
+			}
+			args = append(args, value)
+		}
+		if !differs {
+			continue
+		}
+		for _, k := range row[:nkey] {
+			args = append(args, k)
+		}
+		if _, err := tx.ExecContext(ctx, update, args...); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// archivedAccountColumns is the column list scanned by scanArchivedAccount
+const archivedAccountColumns = `account_id, external_id, tenant_id, status, closed_at, archived_at, record`
+
+// scanArchivedAccount scans a row selected with archivedAccountColumns
+func scanArchivedAccount(row *sql.Row) (*ArchivedAccount, error) {
+	var a ArchivedAccount
+	var record string
+	err := row.Scan(&a.AccountID, &a.ExternalID, &a.TenantID, &a.Status, &a.ClosedAt, &a.ArchivedAt, &record)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.ClosedAt, a.ArchivedAt = a.ClosedAt.UTC(), a.ArchivedAt.UTC()
+	a.Record = json.RawMessage(record)
+	return &a, nil
+}
+
+// scanIDs scans and closes rows of a single ID column
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// complianceFlagColumns is the column list scanned by scanComplianceFlag
+var complianceFlagColumns = `id, rule, subject, user_id, account_id, client_ip, detail, action, occurrences, status,
+	created_at, last_seen_at, COALESCE(reviewed_by, ''), reviewed_at, COALESCE(review_note, ''), ` +
+	accountRefColumn("compliance_flags")
+
+// scanComplianceFlag scans a row selected with complianceFlagColumns
+func scanComplianceFlag(row interface{ Scan(...any) error }, f *ComplianceFlag) error {
+	var accountID sql.NullInt64
+	var reviewedAt sql.NullTime
+	if err := row.Scan(&f.ID, &f.Rule, &f.Subject, &f.UserID, &accountID, &f.ClientIP, &f.Detail, &f.Action,
+		&f.Occurrences, &f.Status, &f.CreatedAt, &f.LastSeenAt, &f.ReviewedBy, &reviewedAt, &f.ReviewNote,
+		&f.AccountExternalID); err != nil {
+		return err
+	}
+	if accountID.Valid {
+		id := int(accountID.Int64)
+		f.AccountID = &id
+	}
+	if reviewedAt.Valid {
+		f.ReviewedAt = &reviewedAt.Time
+	}
+	return nil
+}
+
+// scanComplianceFlags scans and closes rows selected with complianceFlagColumns
+func scanComplianceFlags(rows *sql.Rows) ([]*ComplianceFlag, error) {
+	defer rows.Close()
+
+	var flags []*ComplianceFlag
+	for rows.Next() {
+		var f ComplianceFlag
+		if err := scanComplianceFlag(rows, &f); err != nil {
+			return nil, err
+		}
+		flags = append(flags, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// reconciliationBreakColumns is the column list scanned by scanReconciliationBreak
+var reconciliationBreakColumns = `id, account_id, tenant_id, principal, posted_interest, paid_out, ledger_balance,
+	stored_balance, status, occurrences, detected_at, last_seen_at, COALESCE(acknowledged_by, ''), acknowledged_at,
+	COALESCE(note, ''), resolved_at, ` + accountRefColumn("reconciliation_breaks")
+
+// scanReconciliationBreak scans a row selected with reconciliationBreakColumns
+func scanReconciliationBreak(row interface{ Scan(...any) error }, b *ReconciliationBreak) error {
+	var acknowledgedAt, resolvedAt sql.NullTime
+	if err := row.Scan(&b.ID, &b.AccountID, &b.TenantID, &b.Principal, &b.PostedInterest, &b.PaidOut,
+		&b.LedgerBalance, &b.StoredBalance, &b.Status, &b.Occurrences, &b.DetectedAt, &b.LastSeenAt,
+		&b.AcknowledgedBy, &acknowledgedAt, &b.Note, &resolvedAt, &b.AccountExternalID); err != nil {
+		return err
+	}
+	if acknowledgedAt.Valid {
+		b.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if resolvedAt.Valid {
+		b.ResolvedAt = &resolvedAt.Time
+	}
+	b.Difference = roundMoney(b.LedgerBalance - b.StoredBalance)
+	return nil
+}
+
+// scanReconciliationBreaks scans and closes rows selected with reconciliationBreakColumns
+func scanReconciliationBreaks(rows *sql.Rows) ([]*ReconciliationBreak, error) {
+	defer rows.Close()
+
+	var breaks []*ReconciliationBreak
+	for rows.Next() {
+		var b ReconciliationBreak
+		if err := scanReconciliationBreak(rows, &b); err != nil {
+			return nil, err
+		}
+		breaks = append(breaks, &b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return breaks, nil
+}
+
+// apiKeyColumns is the column list scanned by scanAPIKey
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, created_by, created_at, expires_at, last_used_at,
+	rotated_at, COALESCE(previous_hash, ''), previous_expires_at, revoked_at, COALESCE(revoked_by, ''), tenant_id`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...any) error }, k *APIKey) error {
+	var scopes string
+	var expiresAt, lastUsedAt, rotatedAt, previousExpiresAt, revokedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.keyHash, &scopes, &k.CreatedBy, &k.CreatedAt, &expiresAt,
+		&lastUsedAt, &rotatedAt, &k.previousHash, &previousExpiresAt, &revokedAt, &k.RevokedBy, &k.TenantID); err != nil {
+		return err
+	}
+	k.Scopes = strings.Split(scopes, ",")
+	for _, t := range []struct {
+		src sql.NullTime
+		dst **time.Time
+	}{
+		{expiresAt, &k.ExpiresAt},
+		{lastUsedAt, &k.LastUsedAt},
+		{rotatedAt, &k.RotatedAt},
+		{previousExpiresAt, &k.PreviousKeyExpiresAt},
+		{revokedAt, &k.RevokedAt},
+	} {
+		if t.src.Valid {
+			v := t.src.Time
+			*t.dst = &v
+		}
+	}
+	return nil
+}
+
+// scanAPIKeys scans and closes rows selected with apiKeyColumns
+func scanAPIKeys(rows *sql.Rows) ([]*APIKey, error) {
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		var k APIKey
+		if err := scanAPIKey(rows, &k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, &k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// dueMaturityRemindersQuery builds ListDueMaturityReminders' query from the
+// binds for now, the default lead time and the limit. within is the
+// dialect's test that end_date is no later than its first argument plus its
+// second in days.
+func dueMaturityRemindersQuery(within, now, defaultDays, limit string) string {
+	days := `COALESCE((SELECT p.reminder_days FROM notification_preferences p
+             WHERE p.tenant_id = block_accounts.tenant_id AND p.user_id = block_accounts.user_id), ` + defaultDays + `)`
+	return `SELECT ` + accountColumns + ` FROM block_accounts
+         WHERE status='active' AND end_date > ` + now + ` AND ` + fmt.Sprintf(within, now, days) + `
+           AND NOT EXISTS (SELECT 1 FROM communications c
+                           WHERE c.account_id = block_accounts.id AND c.event = '` + EventMaturityReminder + `')
+           AND NOT EXISTS (SELECT 1 FROM notification_preferences p
+                           WHERE p.tenant_id = block_accounts.tenant_id AND p.user_id = block_accounts.user_id
+                             AND (',' || p.disabled_events || ',') LIKE '%,` + EventMaturityReminder + `,%')
+         ORDER BY end_date, id LIMIT ` + limit
+}
+
+// outboxColumns is the column list scanned by scanOutbox
+const outboxColumns = `id, event_id, aggregate_id, aggregate_key, event_type, schema_version, payload, attempts, tenant_id, user_id, created_at`
+
+// scanOutbox scans and closes rows selected with outboxColumns
+func scanOutbox(rows *sql.Rows) ([]*OutboxEvent, error) {
+	defer rows.Close()
+
+	var events []*OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.EventID, &e.AggregateID, &e.AggregateKey, &e.Type, &e.SchemaVersion, &e.Payload,
+			&e.Attempts, &e.TenantID, &e.UserID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// webhookColumns is the column list scanned by scanWebhook
+const webhookColumns = `id, url, channel, secret, events, active, created_at`
+
+// scanWebhook scans a row selected with webhookColumns. Events are stored
+// comma-separated.
+func scanWebhook(row interface{ Scan(...any) error }, w *Webhook) error {
+	var events string
+	if err := row.Scan(&w.ID, &w.URL, &w.Channel, &w.Secret, &events, &w.Active, &w.CreatedAt); err != nil {
+		return err
+	}
+	w.Events = strings.Split(events, ",")
+	return nil
+}
+
+// deliveryColumns is the column list scanned by scanDelivery
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+         COALESCE(d.last_status_code, 0), COALESCE(d.last_error, ''), d.created_at, d.updated_at`
+
+// scanDelivery scans a row selected with deliveryColumns plus any extra destinations
+func scanDelivery(row interface{ Scan(...any) error }, d *WebhookDelivery, extra ...any) error {
+	var payload []byte
+	dest := []any{&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	d.Payload = payload
+	return nil
+}
+
+// scanDeliveries scans and closes rows selected with deliveryColumns
+func scanDeliveries(rows *sql.Rows) ([]*WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		d := &WebhookDelivery{AttemptLog: []*WebhookAttempt{}}
+		if err := scanDelivery(rows, d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// attemptColumns is the column list scanned by attachAttempts
+const attemptColumns = `id, delivery_id, attempt, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, attempted_at`
+
+// attachAttempts scans and closes rows selected with attemptColumns, adding
+// each attempt to its delivery's log
+func attachAttempts(rows *sql.Rows, deliveries []*WebhookDelivery) error {
+	defer rows.Close()
+
+	byID := make(map[int]*WebhookDelivery, len(deliveries))
+	for _, d := range deliveries {
+		byID[d.ID] = d
+	}
+	for rows.Next() {
+		var a WebhookAttempt
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.DurationMs,
+			&a.AttemptedAt); err != nil {
+			return err
+		}
+		if d, ok := byID[a.DeliveryID]; ok {
+			d.AttemptLog = append(d.AttemptLog, &a)
+		}
+	}
+	return rows.Err()
+}
+
+// checkpointColumns is the column list scanned by scanCheckpoint
+const checkpointColumns = `job, run_started_at, processed, completed_at, last_completed_at, updated_at`
+
+// scanCheckpoint scans a row selected with checkpointColumns
+func scanCheckpoint(row interface{ Scan(...any) error }, cp *WorkerCheckpoint) error {
+	var completedAt, lastCompletedAt sql.NullTime
+	if err := row.Scan(&cp.Job, &cp.RunStartedAt, &cp.Processed, &completedAt, &lastCompletedAt, &cp.UpdatedAt); err != nil {
+		return err
+	}
+	if completedAt.Valid {
+		cp.CompletedAt = &completedAt.Time
+	}
+	if lastCompletedAt.Valid {
+		cp.LastCompletedAt = &lastCompletedAt.Time
+	}
+	return nil
+}
+
+// scheduledJobColumns is the column list scanned by scanScheduledJob
+const scheduledJobColumns = `job, schedule, paused, paused_by, trigger_requested_at, trigger_requested_by, running_since,
+    last_started_at, last_finished_at, last_status, last_error, next_run_at, updated_at`
+
+// scanScheduledJob scans a row selected with scheduledJobColumns
+func scanScheduledJob(row interface{ Scan(...any) error }, j *ScheduledJob) error {
+	var triggerRequestedAt, runningSince, lastStartedAt, lastFinishedAt, nextRunAt, updatedAt sql.NullTime
+	if err := row.Scan(&j.Job, &j.Schedule, &j.Paused, &j.PausedBy, &triggerRequestedAt, &j.TriggerRequestedBy, &runningSince,
+		&lastStartedAt, &lastFinishedAt, &j.LastStatus, &j.LastError, &nextRunAt, &updatedAt); err != nil {
+		return err
+	}
+	for _, t := range []struct {
+		v   sql.NullTime
+		dst **time.Time
+	}{
+		{triggerRequestedAt, &j.TriggerRequestedAt}, {runningSince, &j.RunningSince}, {lastStartedAt, &j.LastStartedAt},
+		{lastFinishedAt, &j.LastFinishedAt}, {nextRunAt, &j.NextRunAt}, {updatedAt, &j.UpdatedAt},
+	} {
+		if t.v.Valid {
+			v := t.v.Time
+			*t.dst = &v
+		}
+	}
+	return nil
+}
+
+// scanScheduledJobs scans and closes rows selected with scheduledJobColumns
+func scanScheduledJobs(rows *sql.Rows) ([]*ScheduledJob, error) {
+	defer rows.Close()
+	var jobs []*ScheduledJob
+	for rows.Next() {
+		var j ScheduledJob
+		if err := scanScheduledJob(rows, &j); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &j)
+	}
+	return jobs, rows.Err()
+}
+
+// impersonationColumns is the column list scanned by scanImpersonation
+const impersonationColumns = `id, token_hash, staff_id, staff_role, user_id, reason, created_at, expires_at, ended_at, tenant_id`
+
+// scanImpersonation scans a row selected with impersonationColumns
+func scanImpersonation(row interface{ Scan(...any) error }, s *ImpersonationSession) error {
+	var endedAt sql.NullTime
+	if err := row.Scan(&s.ID, &s.tokenHash, &s.StaffID, &s.StaffRole, &s.UserID, &s.Reason,
+		&s.CreatedAt, &s.ExpiresAt, &endedAt, &s.TenantID); err != nil {
+		return err
+	}
+	if endedAt.Valid {
+		s.EndedAt = &endedAt.Time
+	}
+	return nil
+}
+
+// impersonationAuditColumns is the column list scanned by scanImpersonationAudit
+const impersonationAuditColumns = `id, session_id, method, path, status, created_at`
+
+// scanImpersonationAudit scans and closes rows selected with impersonationAuditColumns
+func scanImpersonationAudit(rows *sql.Rows) ([]*ImpersonationAccess, error) {
+	defer rows.Close()
+
+	var audit []*ImpersonationAccess
+	for rows.Next() {
+		var a ImpersonationAccess
+		if err := rows.Scan(&a.ID, &a.SessionID, &a.Method, &a.Path, &a.Status, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		audit = append(audit, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return audit, nil
+}
+
+// productGateColumns is the column list scanned by scanProductGate
+const productGateColumns = `product, allowed_user_ids, rollout_percent, updated_by, updated_at`
+
+// scanProductGate scans a row selected with productGateColumns. Allowed user
+// IDs are stored comma-separated.
+func scanProductGate(row interface{ Scan(...any) error }, g *ProductGate) error {
+	var allowed string
+	if err := row.Scan(&g.Product, &allowed, &g.RolloutPercent, &g.UpdatedBy, &g.UpdatedAt); err != nil {
+		return err
+	}
+	g.AllowedUserIDs = []int{}
+	for _, v := range strings.Split(allowed, ",") {
+		if id, err := strconv.Atoi(v); err == nil {
+			g.AllowedUserIDs = append(g.AllowedUserIDs, id)
+		}
+	}
+	return nil
+}
+
+// scanProductGates scans and closes rows selected with productGateColumns
+func scanProductGates(rows *sql.Rows) ([]*ProductGate, error) {
+	defer rows.Close()
+
+	var gates []*ProductGate
+	for rows.Next() {
+		var g ProductGate
+		if err := scanProductGate(rows, &g); err != nil {
+			return nil, err
+		}
+		gates = append(gates, &g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return gates, nil
+}
+
+// featureFlagColumns is the column list scanned by scanFeatureFlags
+const featureFlagColumns = `name, enabled, tenants, rollout_percent, updated_by, updated_at`
+
+// scanFeatureFlags scans and closes rows selected with featureFlagColumns.
+// Tenants are stored comma-separated.
+func scanFeatureFlags(rows *sql.Rows) ([]*FeatureFlag, error) {
+	defer rows.Close()
+
+	var flags []*FeatureFlag
+	for rows.Next() {
+		var f FeatureFlag
+		var tenants string
+		var updatedAt time.Time
+		if err := rows.Scan(&f.Name, &f.Enabled, &tenants, &f.RolloutPercent, &f.UpdatedBy, &updatedAt); err != nil {
+			return nil, err
+		}
+		f.Tenants = []string{}
+		if tenants != "" {
+			f.Tenants = strings.Split(tenants, ",")
+		}
+		f.Source, f.UpdatedAt = FeatureSourceDatabase, &updatedAt
+		flags = append(flags, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// accountLimitColumns is the column list scanned by scanAccountLimits
+const accountLimitColumns = `rule, period, value, updated_by, updated_at`
+
+// scanAccountLimits scans and closes rows selected with accountLimitColumns
+func scanAccountLimits(rows *sql.Rows) ([]*AccountLimit, error) {
+	defer rows.Close()
+
+	var limits []*AccountLimit
+	for rows.Next() {
+		var l AccountLimit
+		if err := rows.Scan(&l.Rule, &l.Period, &l.Value, &l.UpdatedBy, &l.UpdatedAt); err != nil {
+			return nil, err
+		}
+		limits = append(limits, &l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// accountImportColumns is the column list scanned by scanAccountImport
+const accountImportColumns = `id, COALESCE(job_id, 0), status, total_rows, processed_rows, created_rows, failed_rows, requested_by, results,
+	created_at, completed_at, tenant_id`
+
+// scanAccountImport scans a row selected with accountImportColumns plus any extra destinations
+func scanAccountImport(row interface{ Scan(...any) error }, imp *AccountImport, extra ...any) error {
+	var results []byte
+	var completedAt sql.NullTime
+	dest := []any{&imp.ID, &imp.JobID, &imp.Status, &imp.Total, &imp.Processed, &imp.Created, &imp.Failed,
+		&imp.RequestedBy, &results, &imp.CreatedAt, &completedAt, &imp.tenantID}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	if completedAt.Valid {
+		imp.CompletedAt = &completedAt.Time
+	}
+	imp.Results = []*BulkRowResult{}
+	return json.Unmarshal(results, &imp.Results)
+}
+
+// regionStateColumns is the column list scanned by scanRegionState
+const regionStateColumns = `active_region, epoch, promoted_at, promoted_by`
+
+// scanRegionState scans a row selected with regionStateColumns, returning
+// nil when there is none
+func scanRegionState(row *sql.Row) (*RegionState, error) {
+	var state RegionState
+	err := row.Scan(&state.ActiveRegion, &state.Epoch, &state.PromotedAt, &state.PromotedBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// jobColumns is the column list scanned by scanJob
+const jobColumns = `id, type, status, payload, progress_done, progress_total, result, COALESCE(error, ''),
+	cancel_requested, attempts, requested_by, created_at, started_at, completed_at, region`
+
+// scanJob scans a row selected with jobColumns
+func scanJob(row interface{ Scan(...any) error }, job *Job) error {
+	var payload, result []byte
+	var startedAt, completedAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.Type, &job.Status, &payload, &job.Progress.Done, &job.Progress.Total, &result,
+		&job.Error, &job.CancelRequested, &job.Attempts, &job.RequestedBy, &job.CreatedAt, &startedAt,
+		&completedAt, &job.Region); err != nil {
+		return err
+	}
+	job.Payload = json.RawMessage(payload)
+	if result != nil {
+		job.Result = json.RawMessage(result)
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return nil
+}
+
+// eventReplayColumns is the column list scanned by scanEventReplay
+const eventReplayColumns = `id, status, destination, topic, COALESCE(webhook_id, 0), from_time, to_time, account_ids,
+	event_types, last_outbox_id, replayed, COALESCE(last_error, ''), requested_by, created_at, completed_at`
+
+// scanEventReplay scans a row selected with eventReplayColumns. Account IDs
+// and event types are stored comma-separated.
+func scanEventReplay(row interface{ Scan(...any) error }, replay *EventReplay) error {
+	var accountIDs, eventTypes string
+	var from, completedAt sql.NullTime
+	if err := row.Scan(&replay.ID, &replay.Status, &replay.Destination.Type, &replay.Destination.Topic,
+		&replay.Destination.WebhookID, &from, &replay.To, &accountIDs, &eventTypes, &replay.LastOutboxID,
+		&replay.Replayed, &replay.LastError, &replay.RequestedBy, &replay.CreatedAt, &completedAt); err != nil {
+		return err
+	}
+	if from.Valid {
+		replay.From = &from.Time
+	}
+	if completedAt.Valid {
+		replay.CompletedAt = &completedAt.Time
+	}
+	replay.AccountIDs = []int{}
+	for _, v := range strings.Split(accountIDs, ",") {
+		if id, err := strconv.Atoi(v); err == nil {
+			replay.AccountIDs = append(replay.AccountIDs, id)
+		}
+	}
+	replay.EventTypes = []string{}
+	if eventTypes != "" {
+		replay.EventTypes = strings.Split(eventTypes, ",")
+	}
+	return nil
+}
+
+// replayEventsQuery builds ListReplayEvents' query, formatting the nth bind
+// parameter with placeholder so both backends can share it
+func replayEventsQuery(replay *EventReplay, limit int, placeholder func(n int) string) (string, []any) {
+	var args []any
+	bind := func(v any) string {
+		args = append(args, v)
+		return placeholder(len(args))
+	}
+
+	where := []string{"id > " + bind(replay.LastOutboxID), "created_at < " + bind(replay.To)}
+	if replay.From != nil {
+		where = append(where, "created_at >= "+bind(*replay.From))
+	}
+	if len(replay.AccountIDs) > 0 {
+		in := make([]string, len(replay.AccountIDs))
+		for i, id := range replay.AccountIDs {
+			in[i] = bind(id)
+		}
+		where = append(where, "aggregate_id IN ("+strings.Join(in, ", ")+")")
+	}
+	if len(replay.EventTypes) > 0 {
+		in := make([]string, len(replay.EventTypes))
+		for i, t := range replay.EventTypes {
+			in[i] = bind(t)
+		}
+		where = append(where, "event_type IN ("+strings.Join(in, ", ")+")")
+	}
+	return `SELECT ` + outboxColumns + ` FROM outbox WHERE ` + strings.Join(where, " AND ") +
+		` ORDER BY id LIMIT ` + bind(limit), args
+}
+
+// inList returns the bind parameters of an IN list of values, numbered from
+// first, and the values as arguments
+func inList[T any](values []T, first int, placeholder func(n int) string) (string, []any) {
+	args := make([]any, len(values))
+	in := make([]string, len(values))
+	for i, v := range values {
+		args[i], in[i] = v, placeholder(first+i)
+	}
+	return strings.Join(in, ", "), args
+}
+
+// accountExternalIDsQuery selects the external IDs of the accounts in ids
+func accountExternalIDsQuery(ids []int, placeholder func(n int) string) (string, []any) {
+	args := make([]any, len(ids))
+	in := make([]string, len(ids))
+	for i, id := range ids {
+		args[i], in[i] = id, placeholder(i+1)
+	}
+	return `SELECT account_id, CAST(external_id AS TEXT) FROM account_ids WHERE account_id IN (` +
+		strings.Join(in, ", ") + `)`, args
+}
+
+// scanAccountExternalIDs scans and closes rows selected with accountExternalIDsQuery
+func scanAccountExternalIDs(rows *sql.Rows) (map[int]string, error) {
+	defer rows.Close()
+
+	ids := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var externalID string
+		if err := rows.Scan(&id, &externalID); err != nil {
+			return nil, err
+		}
+		ids[id] = externalID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// agreementColumns is the column list scanned by scanAgreement
+const agreementColumns = `account_id, template_version, terms, sha256, COALESCE(document_key, ''), created_at`
+
+// scanAgreement scans a row selected with agreementColumns. The terms are stored as JSON.
+func scanAgreement(row interface{ Scan(...any) error }, a *Agreement) error {
+	var terms []byte
+	if err := row.Scan(&a.AccountID, &a.TemplateVersion, &terms, &a.SHA256, &a.DocumentKey, &a.CreatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal(terms, &a.Terms)
+}
+
+// approvalColumns is the column list scanned by scanApproval
+var approvalColumns = `id, action, account_id, amount, adjustment, reason, status, requested_by, decided_by, decision_note,
+	failure_reason, created_at, decided_at, value_date, ` + accountRefColumn("approvals")
+
+// scanApproval scans a row selected with approvalColumns
+func scanApproval(row interface{ Scan(...any) error }, a *Approval) error {
+	var decidedAt, valueDate sql.NullTime
+	if err := row.Scan(&a.ID, &a.Action, &a.AccountID, &a.Amount, &a.Adjustment, &a.Reason, &a.Status, &a.RequestedBy,
+		&a.DecidedBy, &a.DecisionNote, &a.FailureReason, &a.CreatedAt, &decidedAt, &valueDate, &a.AccountExternalID); err != nil {
+		return err
+	}
+	if decidedAt.Valid {
+		a.DecidedAt = &decidedAt.Time
+	}
+	if valueDate.Valid {
+		a.ValueDate = &valueDate.Time
+	}
+	return nil
+}
+
+// scanApprovals scans and closes rows selected with approvalColumns
+func scanApprovals(rows *sql.Rows) ([]*Approval, error) {
+	defer rows.Close()
+
+	var approvals []*Approval
+	for rows.Next() {
+		var a Approval
+		if err := scanApproval(rows, &a); err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
+// joinIDs formats IDs for comma-separated columns such as allowed_user_ids
+func joinIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// tenantColumns is the column list scanned by scanTenants
+const tenantColumns = `id, name, created_at`
+
+// scanTenants scans and closes rows selected with tenantColumns
+func scanTenants(rows *sql.Rows) ([]*Tenant, error) {
+	defer rows.Close()
+
+	var tenants []*Tenant
+	for rows.Next() {
+		var t Tenant
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// productColumns is the column list scanned by scanProducts
+const productColumns = `code, name, term_months, rate, min_principal, early_withdrawal, retired_at, updated_by, created_at, updated_at`
+
+// scanProducts scans and closes rows selected with productColumns
+func scanProducts(rows *sql.Rows) ([]*ProductDefinition, error) {
+	defer rows.Close()
+
+	var products []*ProductDefinition
+	for rows.Next() {
+		var p ProductDefinition
+		var retiredAt sql.NullTime
+		if err := rows.Scan(&p.Code, &p.Name, &p.TermMonths, &p.Rate, &p.MinPrincipal, &p.EarlyWithdrawal,
+			&retiredAt, &p.UpdatedBy, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if retiredAt.Valid {
+			p.RetiredAt = &retiredAt.Time
+		}
+		products = append(products, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// tenantRateColumns is the column list scanned by scanTenantRates
+const tenantRateColumns = `tenant_id, period, rate, updated_by, updated_at`
+
+// scanTenantRates scans and closes rows selected with tenantRateColumns
+func scanTenantRates(rows *sql.Rows) ([]*TenantRate, error) {
+	defer rows.Close()
+
+	var rates []*TenantRate
+	for rows.Next() {
+		var r TenantRate
+		var updatedAt time.Time
+		if err := rows.Scan(&r.TenantID, &r.Period, &r.Rate, &r.UpdatedBy, &updatedAt); err != nil {
+			return nil, err
+		}
+		r.Custom, r.UpdatedAt = true, &updatedAt
+		rates = append(rates, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"main.go/config"
+)
+
+// The benchmarks compare the repository's cached prepared statements with
+// the same SQL run ad hoc, as every request did before statements were
+// cached. They use an in-memory SQLite database by default; set
+// BENCH_POSTGRES=1 and the usual DB_* variables to run them against PostgreSQL,
+// where parse and plan savings are larger because every query is a round trip:
+//
+//	go test -run '^$' -bench Repository -benchmem
+//	BENCH_POSTGRES=1 DB_HOST=localhost ... go test -run '^$' -bench Repository -benchmem
+
+// benchUsers and benchAccountsPerUser shape the seeded data like production
+// reads: many users with a handful of deposits each
+const (
+	benchUsers           = 200
+	benchAccountsPerUser = 5
+)
+
+// benchQueries are the driver's SQL for the statements the benchmarks run
+// ad hoc
+type benchQueries struct {
+	getAccount, listAccountsByUser, resolveAccountID string
+}
+
+// benchRepository returns a migrated, seeded repository and the queries it
+// serves from its statement cache
+func benchRepository(b *testing.B) (Repository, *sql.DB, benchQueries) {
+	b.Helper()
+	ctx := context.Background()
+
+	driver := DriverSQLite
+	if os.Getenv("BENCH_POSTGRES") != "" {
+		driver = DriverPostgres
+	} else {
+		os.Setenv("SQLITE_PATH", fmt.Sprintf("%s/bench.db", b.TempDir()))
+	}
+	os.Setenv("DB_DRIVER", driver)
+
+	cfg, err := config.Load("")
+	if err != nil {
+		b.Fatalf("load config: %v", err)
+	}
+	db, err := openDatabase(cfg.Database)
+	if err != nil {
+		b.Fatalf("open database: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	migrator, err := newMigrator(db, driver, zap.NewNop())
+	if err != nil {
+		b.Fatalf("load migrations: %v", err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		b.Fatalf("migrate: %v", err)
+	}
+
+	repo, err := newRepository(driver, db, nil)
+	if err != nil {
+		b.Fatalf("new repository: %v", err)
+	}
+	for u := 1; u <= benchUsers; u++ {
+		for i := 0; i < benchAccountsPerUser; i++ {
+			if _, err := repo.CreateAccount(ctx, benchAccount(u), nil); err != nil {
+				b.Fatalf("seed: %v", err)
+			}
+		}
+	}
+
+	if driver == DriverPostgres {
+		return repo, db, benchQueries{pgGetAccount, pgListAccountsByUser, pgResolveAccountID}
+	}
+	return repo, db, benchQueries{sqliteGetAccount, sqliteListAccountsByUser, sqliteResolveAccountID}
+}
+
+func benchAccount(userID int) *BlockAccount {
+	start := time.Now().UTC()
+	return &BlockAccount{
+		ExternalID:          uuid.NewString(),
+		UserID:              userID,
+		Principal:           1000,
+		StartDate:           start,
+		EndDate:             start.AddDate(1, 0, 0),
+		InterestRate:        0.05,
+		Period:              "1y",
+		Status:              StatusActive,
+		MaturityInstruction: InstructionPayout,
+	}
+}
+
+func BenchmarkRepositoryGetAccount(b *testing.B) {
+	repo, db, queries := benchRepository(b)
+	query := queries.getAccount
+	ctx := context.Background()
+	ids := benchUsers * benchAccountsPerUser
+
+	b.Run("prepared", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetAccount(ctx, i%ids+1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("adhoc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var account BlockAccount
+			if err := scanAccount(db.QueryRowContext(ctx, query, i%ids+1, ""), &account); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkRepositoryListAccountsByUser(b *testing.B) {
+	repo, db, queries := benchRepository(b)
+	query := queries.listAccountsByUser
+	ctx := context.Background()
+
+	b.Run("prepared", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.ListAccountsByUser(ctx, i%benchUsers+1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("adhoc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := db.QueryContext(ctx, query, i%benchUsers+1, "")
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := scanAccounts(rows); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkRepositoryResolveAccountID covers the lookup every v2 request by
+// external ID makes before anything else
+func BenchmarkRepositoryResolveAccountID(b *testing.B) {
+	repo, db, queries := benchRepository(b)
+	ctx := context.Background()
+	accounts, err := repo.ListAccountsByUser(ctx, 1)
+	if err != nil || len(accounts) == 0 {
+		b.Fatalf("list seeded accounts: %v", err)
+	}
+	externalID := accounts[0].ExternalID
+
+	b.Run("prepared", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.ResolveAccountID(ctx, externalID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("adhoc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var id int
+			if err := db.QueryRowContext(ctx, queries.resolveAccountID, externalID, "").Scan(&id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkRepositoryGetAccountParallel(b *testing.B) {
+	repo, db, queries := benchRepository(b)
+	query := queries.getAccount
+	ctx := context.Background()
+	ids := benchUsers * benchAccountsPerUser
+
+	b.Run("prepared", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if _, err := repo.GetAccount(ctx, i%ids+1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+	b.Run("adhoc", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				var account BlockAccount
+				if err := scanAccount(db.QueryRowContext(ctx, query, i%ids+1, ""), &account); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,3127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// postgresRepository is the PostgreSQL Repository implementation. Scans of
+// active accounts spell status='active' out as a literal rather than a
+// parameter so the planner can match the partial indexes on active rows.
+type postgresRepository struct {
+	db      *sql.DB
+	replica *replicaRouter // optional read replica, nil when replica routing is disabled
+	stmts   stmtCache
+}
+
+// Hot statements, prepared once and served from the stmtCache
+const (
+	pgInsertAccount = `INSERT INTO block_accounts(user_id, principal, start_date, end_date, interest_rate, period, status,
+             maturity_instruction, payout_destination, payout_frequency, next_payout_date, external_id, tenant_id)
+         VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, NULLIF($9, ''), $10, $11, $12, $13)
+         RETURNING ` + accountColumns
+	pgUserExposure = `SELECT COUNT(*), COALESCE(SUM(principal), 0) FROM block_accounts
+         WHERE id IN (SELECT account_id FROM account_holders WHERE user_id=$1)
+             AND status IN ('active', 'pending_funding', 'frozen') AND tenant_id=$2`
+	pgGetAccount = `SELECT ` + accountColumns + ` FROM block_accounts
+         WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`
+	pgListAccountsByUser = `SELECT ` + accountColumns + ` FROM block_accounts
+         WHERE id IN (SELECT account_id FROM account_holders WHERE user_id=$1) AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id) ORDER BY created_at DESC`
+	pgListAccountsOverlapping = `SELECT ` + accountColumns + ` FROM block_accounts
+         WHERE user_id=$1 AND start_date < $3 AND end_date > $2 AND tenant_id = COALESCE(NULLIF($4, ''), tenant_id)
+         ORDER BY start_date`
+	pgResolveAccountID = `SELECT account_id FROM account_ids
+         WHERE external_id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`
+	pgGetAPIKeyByPrefix = `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix=$1`
+	pgGetTenant         = `SELECT ` + tenantColumns + ` FROM tenants WHERE id=$1`
+)
+
+// pgGetFunding is hot too, but built from columns that aren't constant
+var pgGetFunding = `SELECT ` + fundingColumns + ` FROM account_fundings WHERE account_id=$1`
+
+// readDB returns the database handle reads for ctx should use. Reads go to the
+// replica when one is configured, unless the caller asked for read-your-writes
+// or the replica is down or too far behind.
+func (r *postgresRepository) readDB(ctx context.Context) *sql.DB {
+	if r.replica == nil || primaryRequired(ctx) {
+		return r.db
+	}
+	if !r.replica.use() {
+		dbReads.WithLabelValues(readPrimary).Inc()
+		return r.db
+	}
+	dbReads.WithLabelValues(readReplica).Inc()
+	return r.replica.db
+}
+
+func (r *postgresRepository) CreateAccount(ctx context.Context, a *BlockAccount, admit func(UserExposure, *BlockAccount) error) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if admit != nil {
+		// The lock is held to commit, so what is read under it counts every
+		// account an earlier create for the user opened
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('block_accounts.user_id'), $1)`, a.UserID); err != nil {
+			return nil, err
+		}
+		var e UserExposure
+		if err := tx.QueryRowContext(ctx, pgUserExposure, a.UserID, a.TenantID).Scan(&e.OpenAccounts, &e.Principal); err != nil {
+			return nil, err
+		}
+		var duplicate *BlockAccount
+		if !a.duplicatesSince.IsZero() {
+			var d BlockAccount
+			err := scanAccount(tx.QueryRowContext(ctx,
+				`SELECT `+accountColumns+` FROM block_accounts
+                 WHERE user_id=$1 AND principal=$2 AND period=$3 AND created_at >= $4 AND tenant_id=$5 AND status <> 'funding_failed'
+                 ORDER BY created_at DESC, id DESC LIMIT 1`,
+				a.UserID, roundMoney(a.Principal), a.Period, a.duplicatesSince.UTC(), a.TenantID), &d)
+			switch {
+			case err == nil:
+				duplicate = &d
+			case err != sql.ErrNoRows:
+				return nil, err
+			}
+		}
+		if err := admit(e, duplicate); err != nil {
+			return nil, err
+		}
+	}
+
+	insert, err := r.stmts.prepare(ctx, r.db, pgInsertAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	var account BlockAccount
+	err = scanAccount(tx.StmtContext(ctx, insert).QueryRowContext(ctx,
+		a.UserID, a.Principal, a.StartDate, a.EndDate, a.InterestRate, a.Period, a.Status,
+		a.MaturityInstruction, a.PayoutDestination, a.PayoutFrequency, a.NextPayoutDate, a.ExternalID, a.TenantID), &account)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.insertAccountID(ctx, tx, &account); err != nil {
+		return nil, err
+	}
+	if err := r.insertIdempotencyKey(ctx, tx, a, account.ID); err != nil {
+		return nil, err
+	}
+	if err := r.insertHolders(ctx, tx, &account, 0); err != nil {
+		return nil, err
+	}
+	if err := r.insertStatusChange(ctx, tx, &StatusChange{AccountID: account.ID, To: account.Status, Principal: account.Principal, Note: a.bookingNote}); err != nil {
+		return nil, err
+	}
+	if a.Funding != nil {
+		var f Funding
+		err = scanFunding(tx.QueryRowContext(ctx,
+			`INSERT INTO account_fundings(account_id, settlement_account, reference, amount, status)
+             VALUES ($1, $2, $3, $4, $5) RETURNING `+fundingColumns,
+			account.ID, a.Funding.SettlementAccount, a.Funding.Reference, a.Funding.Amount, a.Funding.Status), &f)
+		if err != nil {
+			return nil, err
+		}
+		account.Funding = &f
+	}
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountCreated, &account)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// insertIdempotencyKey stores a's idempotency key for the account with id.
+// A key stored within idempotencyKeyTTL is kept and errIdempotencyKeyTaken
+// returned; a create racing for the key waits here for the other to end.
+func (r *postgresRepository) insertIdempotencyKey(ctx context.Context, tx *sql.Tx, a *BlockAccount, id int) error {
+	if a.idempotencyKey == "" {
+		return nil
+	}
+	now := time.Now().UTC()
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO idempotency_keys(tenant_id, idempotency_key, fingerprint, account_id, created_at)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (tenant_id, idempotency_key) DO UPDATE
+             SET fingerprint=EXCLUDED.fingerprint, account_id=EXCLUDED.account_id, created_at=EXCLUDED.created_at
+             WHERE idempotency_keys.created_at < $6`,
+		a.TenantID, a.idempotencyKey, a.fingerprint, id, now, now.Add(-idempotencyKeyTTL))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errIdempotencyKeyTaken
+	}
+	return nil
+}
+
+func (r *postgresRepository) FindIdempotentCreate(ctx context.Context, key string, since time.Time) (int, string, error) {
+	var accountID int
+	var fingerprint string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT account_id, fingerprint FROM idempotency_keys WHERE tenant_id=$1 AND idempotency_key=$2 AND created_at >= $3`,
+		tenantOf(ctx), key, since.UTC()).Scan(&accountID, &fingerprint)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return accountID, fingerprint, err
+}
+
+func (r *postgresRepository) CreateAccounts(ctx context.Context, accounts []*BlockAccount, record func([]*BlockAccount) *AccountImport) ([]*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx,
+		`INSERT INTO block_accounts(user_id, principal, start_date, end_date, interest_rate, period, status,
+             maturity_instruction, payout_destination, payout_frequency, next_payout_date, interest_paid_through, external_id,
+             tenant_id)
+         VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, NULLIF($9, ''), $10, $11, $12, $13, $14)
+         RETURNING `+accountColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer insert.Close()
+
+	stored := make([]*BlockAccount, len(accounts))
+	for i, a := range accounts {
+		var account BlockAccount
+		err := scanAccount(insert.QueryRowContext(ctx,
+			a.UserID, a.Principal, a.StartDate, a.EndDate, a.InterestRate, a.Period, a.Status,
+			a.MaturityInstruction, a.PayoutDestination, a.PayoutFrequency, a.NextPayoutDate, a.InterestPaidThrough,
+			a.ExternalID, a.TenantID), &account)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.insertAccountID(ctx, tx, &account); err != nil {
+			return nil, err
+		}
+		if err := r.insertHolders(ctx, tx, &account, 0); err != nil {
+			return nil, err
+		}
+		if err := r.insertStatusChange(ctx, tx, &StatusChange{AccountID: account.ID, To: account.Status, Principal: account.Principal, Note: "imported"}); err != nil {
+			return nil, err
+		}
+		if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountCreated, &account)); err != nil {
+			return nil, err
+		}
+		stored[i] = &account
+	}
+	if imp := record(stored); imp != nil {
+		results, err := json.Marshal(imp.Results)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE account_imports SET processed_rows=$2, created_rows=$3, failed_rows=$4, results=$5 WHERE id=$1`,
+			imp.ID, imp.Processed, imp.Created, imp.Failed, results)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := commit(ctx, tx); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+func (r *postgresRepository) GetAccount(ctx context.Context, id int) (*BlockAccount, error) {
+	get, err := r.stmts.prepare(ctx, r.readDB(ctx), pgGetAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	var account BlockAccount
+	err = scanAccount(get.QueryRowContext(ctx, id, tenantFromContext(ctx)), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *postgresRepository) ListAccountsByUser(ctx context.Context, userID int) ([]*BlockAccount, error) {
+	list, err := r.stmts.prepare(ctx, r.readDB(ctx), pgListAccountsByUser)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := list.QueryContext(ctx, userID, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *postgresRepository) ListAccountsOverlapping(ctx context.Context, userID int, from, to time.Time) ([]*BlockAccount, error) {
+	list, err := r.stmts.prepare(ctx, r.readDB(ctx), pgListAccountsOverlapping)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := list.QueryContext(ctx, userID, from, to, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *postgresRepository) ListMaturingBetween(ctx context.Context, from, to time.Time, limit int) ([]*BlockAccount, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts
+         WHERE status='active' AND end_date > $1 AND end_date <= $2 AND tenant_id = COALESCE(NULLIF($4, ''), tenant_id)
+         ORDER BY end_date LIMIT $3`,
+		from, to, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *postgresRepository) ListAccountsUpdatedAfter(ctx context.Context, updatedAt time.Time, id, limit int) ([]*BlockAccount, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts
+         WHERE (updated_at, id) > ($1, $2) AND tenant_id = COALESCE(NULLIF($4, ''), tenant_id)
+         ORDER BY updated_at, id LIMIT $3`,
+		updatedAt, id, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *postgresRepository) ListAccountsAfter(ctx context.Context, afterID int, statuses []string, limit int) ([]*BlockAccount, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	in, args := inList(statuses, 4, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts
+         WHERE id > $1 AND status IN (`+in+`) AND tenant_id = COALESCE(NULLIF($3, ''), tenant_id)
+         ORDER BY id LIMIT $2`,
+		append([]any{afterID, limit, tenantFromContext(ctx)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *postgresRepository) DeleteAccount(ctx context.Context, id int, check func(*BlockAccount) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	if check != nil {
+		err = scanAccount(tx.QueryRowContext(ctx,
+			`SELECT `+accountColumns+` FROM block_accounts WHERE id=$1 FOR UPDATE`, id), &account)
+		if err != nil {
+			return err
+		}
+		if err := check(&account); err != nil {
+			return err
+		}
+	}
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`DELETE FROM block_accounts WHERE id=$1 RETURNING `+accountColumns, id), &account)
+	if err != nil {
+		return err
+	}
+	closed := &StatusChange{AccountID: account.ID, From: account.Status, To: StatusClosed, Principal: account.Principal}
+	if err := r.insertStatusChange(ctx, tx, closed); err != nil {
+		return err
+	}
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountClosed, &account)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresRepository) BeginClosure(ctx context.Context, id int, plan func(*BlockAccount) (*AccountClosure, error)) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=$1 FOR UPDATE`, id), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	closure, err := plan(&account)
+	if err != nil {
+		return nil, err
+	}
+
+	from := account.Status
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=$2, updated_at=CURRENT_TIMESTAMP WHERE id=$1 RETURNING `+accountColumns,
+		id, StatusClosing), &account)
+	if err != nil {
+		return nil, err
+	}
+	err = scanClosure(tx.QueryRowContext(ctx,
+		`INSERT INTO account_closures(account_id, destination_account, method, amount, requested_at)
+         VALUES ($1, $2, $3, $4, $5) RETURNING `+closureColumns,
+		id, closure.DestinationAccount, closure.Method, closure.Amount, closure.RequestedAt), closure)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO payouts(account_id, destination_account, amount, status) VALUES ($1, $2, $3, $4)`,
+		id, closure.DestinationAccount, closure.Amount, PayoutPending); err != nil {
+		return nil, err
+	}
+	closing := &StatusChange{AccountID: id, From: from, To: StatusClosing, Principal: account.Principal, Note: "closed by " + closure.Method}
+	if err := r.insertStatusChange(ctx, tx, closing); err != nil {
+		return nil, err
+	}
+	if err := r.insertOutbox(ctx, tx, newStatusChangedEvent(&account, from)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	account.Closure = closure
+	return &account, nil
+}
+
+func (r *postgresRepository) GetClosure(ctx context.Context, accountID int) (*AccountClosure, error) {
+	var c AccountClosure
+	err := scanClosure(r.db.QueryRowContext(ctx,
+		`SELECT `+closureColumns+` FROM account_closures WHERE account_id=$1`, accountID), &c)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *postgresRepository) GetFunding(ctx context.Context, accountID int) (*Funding, error) {
+	get, err := r.stmts.prepare(ctx, r.db, pgGetFunding)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Funding
+	err = scanFunding(get.QueryRowContext(ctx, accountID), &f)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *postgresRepository) ListPendingFundings(ctx context.Context, afterAccountID, limit int) ([]*Funding, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+fundingColumns+` FROM account_fundings WHERE status='pending' AND account_id > $1
+         ORDER BY account_id LIMIT $2`,
+		afterAccountID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanFundings(rows)
+}
+
+func (r *postgresRepository) SettleFunding(ctx context.Context, accountID int, plan func(*BlockAccount) (*FundingOutcome, error)) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=$1 AND status='pending_funding' FOR UPDATE`,
+		accountID), &account)
+	if err != nil {
+		return nil, err
+	}
+	outcome, err := plan(&account)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Funding
+	err = scanFunding(tx.QueryRowContext(ctx,
+		`UPDATE account_fundings SET status=$1, failure_reason=$2, settled_at=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+         WHERE account_id=$3 AND status='pending' RETURNING `+fundingColumns,
+		outcome.Status, outcome.Reason, accountID), &f)
+	if err != nil {
+		return nil, err
+	}
+	if outcome.Status == FundingConfirmed {
+		err = scanAccount(tx.QueryRowContext(ctx,
+			`UPDATE block_accounts SET status='active', start_date=$1, end_date=$2, next_payout_date=$3,
+                 updated_at=CURRENT_TIMESTAMP
+             WHERE id=$4 RETURNING `+accountColumns,
+			outcome.StartDate, outcome.EndDate, outcome.NextPayoutDate, accountID), &account)
+	} else {
+		err = scanAccount(tx.QueryRowContext(ctx,
+			`UPDATE block_accounts SET status='funding_failed', updated_at=CURRENT_TIMESTAMP
+             WHERE id=$1 RETURNING `+accountColumns,
+			accountID), &account)
+	}
+	if err != nil {
+		return nil, err
+	}
+	settled := &StatusChange{AccountID: account.ID, From: StatusPendingFunding, To: account.Status, Principal: account.Principal, Note: outcome.Reason}
+	if err := r.insertStatusChange(ctx, tx, settled); err != nil {
+		return nil, err
+	}
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(fundingEvent(outcome.Status), &account)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	account.Funding = &f
+	return &account, nil
+}
+
+func (r *postgresRepository) UpdateAccountStatus(ctx context.Context, id int, status string, check func(*BlockAccount) error) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=$1 FOR UPDATE`, id), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := check(&account); err != nil {
+		return nil, err
+	}
+
+	from := account.Status
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=$2, updated_at=CURRENT_TIMESTAMP WHERE id=$1 RETURNING `+accountColumns,
+		id, status), &account)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.insertStatusChange(ctx, tx, &StatusChange{AccountID: id, From: from, To: status, Principal: account.Principal}); err != nil {
+		return nil, err
+	}
+	if err := r.insertOutbox(ctx, tx, newStatusChangedEvent(&account, from)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *postgresRepository) UpdateMaturityInstruction(ctx context.Context, id int, instruction, destination string, check func(*BlockAccount) error) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=$1 FOR UPDATE`, id), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := check(&account); err != nil {
+		return nil, err
+	}
+
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET maturity_instruction=$2, payout_destination=NULLIF($3, ''), updated_at=CURRENT_TIMESTAMP
+         WHERE id=$1 RETURNING `+accountColumns,
+		id, instruction, destination), &account)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// MatureDue skips rows locked by another worker rather than waiting on them
+func (r *postgresRepository) MatureDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*MaturityOutcome, error)) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+accountColumns+`
+         FROM block_accounts WHERE status='active' AND end_date <= $1
+         ORDER BY end_date LIMIT $2 FOR UPDATE SKIP LOCKED`,
+		now, limit)
+	if err != nil {
+		return 0, err
+	}
+	due, err := scanAccounts(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	matured := 0
+	for _, a := range due {
+		ok, err := r.matureAccount(ctx, tx, a, plan)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			matured++
+		}
+	}
+
+	if err := commit(ctx, tx); err != nil {
+		return 0, err
+	}
+	return matured, nil
+}
+
+// MatureAccount matures one account, as MatureDue does, if it is active and
+// due at now. It waits for a worker holding the account's lock.
+func (r *postgresRepository) MatureAccount(ctx context.Context, id int, now time.Time, plan func(*BlockAccount) (*MaturityOutcome, error)) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var a BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=$1 AND status='active' AND end_date <= $2 FOR UPDATE`,
+		id, now), &a)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	ok, err := r.matureAccount(ctx, tx, &a, plan)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, commit(ctx, tx)
+}
+
+// matureAccount carries out plan's outcome for a within tx. It reports
+// false when a was no longer active.
+func (r *postgresRepository) matureAccount(ctx context.Context, tx *sql.Tx, a *BlockAccount, plan func(*BlockAccount) (*MaturityOutcome, error)) (bool, error) {
+	outcome, err := plan(a)
+	if err != nil {
+		return false, err
+	}
+	// Only the worker that moves the account out of active matures it;
+	// the payout is also unique per account and maturity date
+	res, err := tx.ExecContext(ctx,
+		`UPDATE block_accounts SET status=$2, updated_at=CURRENT_TIMESTAMP WHERE id=$1 AND status='active'`,
+		a.ID, outcome.Status)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		return false, nil
+	}
+	if outcome.Rollover != nil {
+		n := outcome.Rollover
+		if err := tx.QueryRowContext(ctx,
+			`INSERT INTO block_accounts(user_id, principal, start_date, end_date, interest_rate, period, status,
+                     maturity_instruction, payout_destination, payout_frequency, next_payout_date, external_id, tenant_id)
+                 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, NULLIF($9, ''), $10, $11, $12, $13)
+                 RETURNING id`,
+			n.UserID, n.Principal, n.StartDate, n.EndDate, n.InterestRate, n.Period, n.Status,
+			n.MaturityInstruction, n.PayoutDestination, n.PayoutFrequency, n.NextPayoutDate, n.ExternalID,
+			n.TenantID).Scan(&n.ID); err != nil {
+			return false, err
+		}
+		if err := r.insertAccountID(ctx, tx, n); err != nil {
+			return false, err
+		}
+		if err := r.insertHolders(ctx, tx, n, a.ID); err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO account_beneficiaries(account_id, position, name, relationship, allocation_percent, designated_by, created_at)
+                 SELECT $1, position, name, relationship, allocation_percent, designated_by, created_at
+                 FROM account_beneficiaries WHERE account_id=$2`, n.ID, a.ID); err != nil {
+			return false, err
+		}
+		opened := &StatusChange{AccountID: n.ID, To: n.Status, Principal: n.Principal, Note: "rollover of " + a.ExternalID}
+		if err := r.insertStatusChange(ctx, tx, opened); err != nil {
+			return false, err
+		}
+		if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountCreated, n)); err != nil {
+			return false, err
+		}
+	}
+	if outcome.Payout != nil {
+		p := outcome.Payout
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO payouts(account_id, destination_account, amount, status, maturity_date) VALUES ($1, $2, $3, $4, $5)`,
+			a.ID, p.Destination, p.Amount, p.Status, a.EndDate); err != nil {
+			return false, err
+		}
+	}
+	if err := r.insertStatusChange(ctx, tx, maturedChange(a, outcome, time.Time{})); err != nil {
+		return false, err
+	}
+	a.Status = outcome.Status
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountMatured, a)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *postgresRepository) PayInterestDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*InterestOutcome, error)) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+accountColumns+`
+         FROM block_accounts WHERE status='active' AND next_payout_date <= $1
+         ORDER BY next_payout_date LIMIT $2 FOR UPDATE SKIP LOCKED`,
+		now, limit)
+	if err != nil {
+		return 0, err
+	}
+	due, err := scanAccounts(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	paid := 0
+	for _, a := range due {
+		outcome, err := plan(a)
+		if err != nil {
+			return 0, err
+		}
+		// Interest is paid once per account and period end; a period
+		// another worker already paid is skipped
+		p := outcome.Payout
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO interest_payouts(account_id, destination_account, period_start, period_end, amount, status)
+             VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (account_id, period_end) DO NOTHING`,
+			a.ID, p.Destination, p.PeriodStart, p.PeriodEnd, p.Amount, p.Status)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return 0, err
+		} else if n == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE block_accounts SET interest_paid_through=$2, next_payout_date=$3, updated_at=CURRENT_TIMESTAMP
+             WHERE id=$1`,
+			a.ID, p.PeriodEnd, outcome.NextPayoutDate); err != nil {
+			return 0, err
+		}
+		if err := r.insertOutbox(ctx, tx, newInterestPaidEvent(a, p)); err != nil {
+			return 0, err
+		}
+		paid++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return paid, nil
+}
+
+func (r *postgresRepository) ListInterestPayouts(ctx context.Context, accountID int) ([]*InterestPayout, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+interestPayoutColumns+` FROM interest_payouts WHERE account_id=$1 ORDER BY period_end`,
+		accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanInterestPayouts(rows)
+}
+
+func (r *postgresRepository) AdjustInterest(ctx context.Context, accountID int, plan func(*BlockAccount, []*InterestPayout, []*InterestAdjustment) (*InterestAdjustment, error)) (*BlockAccount, *InterestAdjustment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=$1 FOR UPDATE`, accountID), &account)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+interestPayoutColumns+` FROM interest_payouts WHERE account_id=$1 ORDER BY period_end`, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	paid, err := scanInterestPayouts(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err = tx.QueryContext(ctx,
+		`SELECT `+interestAdjustmentColumns+` FROM interest_adjustments WHERE account_id=$1 ORDER BY id`, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	prior, err := scanInterestAdjustments(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	adj, err := plan(&account, paid, prior)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET interest_rate=$2, interest_adjustment=interest_adjustment+$3, updated_at=CURRENT_TIMESTAMP
+         WHERE id=$1 RETURNING `+accountColumns,
+		accountID, adj.Rate, adj.Amount), &account)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = scanInterestAdjustment(tx.QueryRowContext(ctx,
+		`INSERT INTO interest_adjustments(account_id, kind, amount, previous_rate, rate, reason, approval_id,
+             requested_by, approved_by, value_date)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING `+interestAdjustmentColumns,
+		accountID, adj.Kind, adj.Amount, adj.PreviousRate, adj.Rate, adj.Reason, adj.ApprovalID,
+		adj.RequestedBy, adj.ApprovedBy, adj.ValueDate), adj)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := commit(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+	return &account, adj, nil
+}
+
+func (r *postgresRepository) ListInterestAdjustments(ctx context.Context, accountID int) ([]*InterestAdjustment, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+interestAdjustmentColumns+` FROM interest_adjustments WHERE account_id=$1 ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanInterestAdjustments(rows)
+}
+
+func (r *postgresRepository) ListInterestAdjustmentsOf(ctx context.Context, accountIDs []int) ([]*InterestAdjustment, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+interestAdjustmentColumns+` FROM interest_adjustments WHERE account_id IN (`+in+`)
+         ORDER BY account_id, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanInterestAdjustments(rows)
+}
+
+func (r *postgresRepository) ListPayouts(ctx context.Context, accountID int) ([]*Payout, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+payoutColumns+` FROM payouts WHERE account_id=$1 ORDER BY created_at, id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPayouts(rows)
+}
+
+func (r *postgresRepository) ConfirmPayout(ctx context.Context, accountID int) (*Payout, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// An account may have paid out before, so only its pending payout moves
+	var payoutID int
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM payouts WHERE account_id=$1 AND status=$2 ORDER BY created_at DESC, id DESC LIMIT 1 FOR UPDATE`,
+		accountID, PayoutPending).Scan(&payoutID)
+	if err != nil {
+		return nil, false, err
+	}
+	var payout Payout
+	err = scanPayout(tx.QueryRowContext(ctx,
+		`UPDATE payouts SET status=$2, updated_at=CURRENT_TIMESTAMP WHERE id=$1
+         RETURNING `+payoutColumns,
+		payoutID, PayoutSent), &payout)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The final payout of a closing account closes it
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=$2, updated_at=CURRENT_TIMESTAMP WHERE id=$1 AND status=$3 RETURNING `+accountColumns,
+		accountID, StatusClosed, StatusClosing), &account)
+	if err == sql.ErrNoRows {
+		return &payout, false, tx.Commit()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE account_closures SET closed_at=CURRENT_TIMESTAMP WHERE account_id=$1`, accountID); err != nil {
+		return nil, false, err
+	}
+	closed := &StatusChange{AccountID: accountID, From: StatusClosing, To: StatusClosed, Principal: account.Principal, Note: "final payout sent"}
+	if err := r.insertStatusChange(ctx, tx, closed); err != nil {
+		return nil, false, err
+	}
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountClosed, &account)); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return &payout, true, nil
+}
+
+func (r *postgresRepository) FailPayout(ctx context.Context, accountID int, reason string) (*Payout, int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var payoutID int
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM payouts WHERE account_id=$1 AND status IN ('pending', 'sent')
+         ORDER BY created_at DESC, id DESC LIMIT 1 FOR UPDATE`,
+		accountID).Scan(&payoutID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var payout Payout
+	err = scanPayout(tx.QueryRowContext(ctx,
+		`UPDATE payouts SET status=$2, failure_reason=$3, updated_at=CURRENT_TIMESTAMP WHERE id=$1
+         RETURNING `+payoutColumns,
+		payoutID, PayoutFailed, reason), &payout)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := r.recordStatus(ctx, tx, accountID, StatusPayoutFailed, reason); err != nil {
+		return nil, 0, err
+	}
+
+	var userID int
+	err = tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=$2, updated_at=CURRENT_TIMESTAMP WHERE id=$1 RETURNING user_id`,
+		accountID, StatusPayoutFailed).Scan(&userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return &payout, userID, nil
+}
+
+func (r *postgresRepository) RetryPayout(ctx context.Context, accountID int, destination string) (*Payout, int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var payoutID int
+	var status string
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, status FROM payouts WHERE account_id=$1 ORDER BY created_at DESC, id DESC LIMIT 1 FOR UPDATE`,
+		accountID).Scan(&payoutID, &status)
+	if err != nil {
+		return nil, 0, err
+	}
+	if status != PayoutFailed {
+		return nil, 0, ErrPayoutNotFailed
+	}
+
+	var payout Payout
+	err = scanPayout(tx.QueryRowContext(ctx,
+		`UPDATE payouts SET status=$2, failure_reason=NULL, attempts=attempts+1,
+             destination_account=COALESCE(NULLIF($3, ''), destination_account), updated_at=CURRENT_TIMESTAMP
+         WHERE id=$1
+         RETURNING `+payoutColumns,
+		payoutID, PayoutPending, destination), &payout)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A closing account whose final payout failed goes back to closing
+	var closing bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM account_closures WHERE account_id=$1)`, accountID).Scan(&closing)
+	if err != nil {
+		return nil, 0, err
+	}
+	to := StatusMatured
+	if closing {
+		to = StatusClosing
+	}
+	if err := r.recordStatus(ctx, tx, accountID, to, "payout retried"); err != nil {
+		return nil, 0, err
+	}
+
+	var userID int
+	err = tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=$2, updated_at=CURRENT_TIMESTAMP WHERE id=$1 RETURNING user_id`,
+		accountID, to).Scan(&userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return &payout, userID, nil
+}
+
+func (r *postgresRepository) RecordCommunication(ctx context.Context, c *Communication) error {
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO communications(account_id, user_id, kind, event, subject, message, status, priority, next_attempt_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP) RETURNING id, created_at`,
+		c.AccountID, c.UserID, c.Kind, c.Event, c.Subject, c.Message, c.Status, c.Priority).Scan(&c.ID, &c.CreatedAt)
+}
+
+func (r *postgresRepository) ListCommunications(ctx context.Context, accountID int) ([]*Communication, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+communicationColumns+` FROM communications WHERE account_id=$1 ORDER BY created_at, id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanCommunications(rows)
+}
+
+// ClaimNotifications skips rows locked by another worker rather than waiting on them
+func (r *postgresRepository) ClaimNotifications(ctx context.Context, priority string, now time.Time, lease time.Duration, limit int) ([]*Communication, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`UPDATE communications SET next_attempt_at=$3
+         WHERE id IN (
+             SELECT id FROM communications
+             WHERE status='pending' AND priority=$1 AND next_attempt_at <= $2
+             ORDER BY next_attempt_at, id LIMIT $4 FOR UPDATE SKIP LOCKED)
+         RETURNING `+communicationColumns,
+		priority, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanCommunications(rows)
+}
+
+func (r *postgresRepository) UpdateCommunicationStatus(ctx context.Context, id int, status, lastError string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE communications SET status=$2, last_error=NULLIF($3, ''),
+             sent_at=CASE WHEN $2='sent' THEN CURRENT_TIMESTAMP END
+         WHERE id=$1`, id, status, lastError)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) QueueNotifications(ctx context.Context, comms []*Communication, consumer string, cursor int64) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	queued := 0
+	for _, c := range comms {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO communications(account_id, user_id, kind, event, subject, message, status, priority,
+                 channel, dedup_key, next_attempt_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), CURRENT_TIMESTAMP)
+             ON CONFLICT (dedup_key, channel) WHERE dedup_key IS NOT NULL DO NOTHING
+             RETURNING id, created_at`,
+			c.AccountID, c.UserID, c.Kind, c.Event, c.Subject, c.Message, c.Status, c.Priority,
+			c.Channel, c.DedupKey).Scan(&c.ID, &c.CreatedAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		queued++
+	}
+
+	if consumer != "" {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO event_cursors(consumer, last_outbox_id) VALUES ($1, $2)
+             ON CONFLICT (consumer) DO UPDATE SET last_outbox_id=EXCLUDED.last_outbox_id, updated_at=CURRENT_TIMESTAMP
+             WHERE event_cursors.last_outbox_id < EXCLUDED.last_outbox_id`,
+			consumer, cursor); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return queued, nil
+}
+
+func (r *postgresRepository) EventCursor(ctx context.Context, consumer string) (int64, error) {
+	var cursor int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT last_outbox_id FROM event_cursors WHERE consumer=$1`, consumer).Scan(&cursor)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return cursor, err
+}
+
+func (r *postgresRepository) ListOutboxAfter(ctx context.Context, afterID int64, before time.Time, limit int) ([]*OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox WHERE id > $1 AND created_at < $2 ORDER BY id LIMIT $3`,
+		afterID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func (r *postgresRepository) LastOutboxID(ctx context.Context, before time.Time) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(id), 0) FROM outbox WHERE created_at < $1`, before).Scan(&id)
+	return id, err
+}
+
+func (r *postgresRepository) ListUserOutboxAfter(ctx context.Context, userID int, afterID, throughID int64, limit int) ([]*OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox
+         WHERE tenant_id=$1 AND user_id=$2 AND id > $3 AND id <= $4 ORDER BY id LIMIT $5`,
+		tenantOf(ctx), userID, afterID, throughID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func (r *postgresRepository) ListEventLog(ctx context.Context, afterID int64, accountKey, eventType string, limit int) ([]*OutboxEvent, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox
+         WHERE id > $1 AND ($2 = '' OR aggregate_key = $2) AND ($3 = '' OR event_type = $3) ORDER BY id LIMIT $4`,
+		afterID, accountKey, eventType, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func (r *postgresRepository) RewindEventCursor(ctx context.Context, consumer string, cursor int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO event_cursors(consumer, last_outbox_id, updated_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+         ON CONFLICT (consumer) DO UPDATE SET last_outbox_id=EXCLUDED.last_outbox_id, updated_at=CURRENT_TIMESTAMP
+         WHERE event_cursors.last_outbox_id > EXCLUDED.last_outbox_id`,
+		consumer, cursor)
+	return err
+}
+
+func (r *postgresRepository) ListDueMaturityReminders(ctx context.Context, now time.Time, defaultDays, limit int) ([]*BlockAccount, error) {
+	rows, err := r.db.QueryContext(ctx,
+		dueMaturityRemindersQuery(`end_date <= %s + make_interval(days => %s)`, "$1", "$2", "$3"),
+		now, defaultDays, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *postgresRepository) GetNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	return scanNotificationPreferences(r.readDB(ctx).QueryRowContext(ctx,
+		`SELECT `+notificationPreferencesColumns+` FROM notification_preferences WHERE tenant_id=$1 AND user_id=$2`,
+		tenantOf(ctx), userID))
+}
+
+func (r *postgresRepository) SaveNotificationPreferences(ctx context.Context, p *NotificationPreferences) (*NotificationPreferences, error) {
+	return scanNotificationPreferences(r.db.QueryRowContext(ctx,
+		`INSERT INTO notification_preferences(user_id, channels, email, phone, reminder_days, disabled_events, locale, tenant_id)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+         ON CONFLICT (tenant_id, user_id) DO UPDATE SET channels=EXCLUDED.channels, email=EXCLUDED.email, phone=EXCLUDED.phone,
+             reminder_days=EXCLUDED.reminder_days, disabled_events=EXCLUDED.disabled_events, locale=EXCLUDED.locale,
+             updated_at=CURRENT_TIMESTAMP
+         RETURNING `+notificationPreferencesColumns,
+		p.UserID, strings.Join(p.Channels, ","), p.Email, p.Phone, p.ReminderDays, strings.Join(p.DisabledEvents, ","),
+		p.Locale, tenantOf(ctx)))
+}
+
+func (r *postgresRepository) MuteNotifications(ctx context.Context, m *NotificationMute, now time.Time) (*NotificationMute, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE notification_mutes SET ended_at=$2, ended_by=$3
+         WHERE account_id=$1 AND ended_at IS NULL AND muted_until > $2`,
+		m.AccountID, now, m.MutedBy); err != nil {
+		return nil, err
+	}
+	var mute NotificationMute
+	if err := scanNotificationMute(tx.QueryRowContext(ctx,
+		`INSERT INTO notification_mutes(account_id, muted_until, reason, muted_by) VALUES ($1, $2, $3, $4)
+         RETURNING `+notificationMuteColumns,
+		m.AccountID, m.MutedUntil, m.Reason, m.MutedBy), &mute); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &mute, nil
+}
+
+func (r *postgresRepository) UnmuteNotifications(ctx context.Context, accountID int, now time.Time, endedBy string) (*NotificationMute, error) {
+	var mute NotificationMute
+	err := scanNotificationMute(r.db.QueryRowContext(ctx,
+		`UPDATE notification_mutes SET ended_at=$2, ended_by=$3
+         WHERE account_id=$1 AND ended_at IS NULL AND muted_until > $2
+         RETURNING `+notificationMuteColumns,
+		accountID, now, endedBy), &mute)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mute, nil
+}
+
+func (r *postgresRepository) ActiveNotificationMute(ctx context.Context, accountID int, now time.Time) (*NotificationMute, error) {
+	var mute NotificationMute
+	err := scanNotificationMute(r.db.QueryRowContext(ctx,
+		`SELECT `+notificationMuteColumns+` FROM notification_mutes
+         WHERE account_id=$1 AND ended_at IS NULL AND muted_until > $2
+         ORDER BY id DESC LIMIT 1`,
+		accountID, now), &mute)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mute, nil
+}
+
+func (r *postgresRepository) ListNotificationMutes(ctx context.Context, accountID int) ([]*NotificationMute, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+notificationMuteColumns+` FROM notification_mutes WHERE account_id=$1 ORDER BY id DESC`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotificationMutes(rows)
+}
+
+func (r *postgresRepository) ListAccountHolders(ctx context.Context, accountID int) ([]*AccountHolder, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+accountHolderColumns+` FROM account_holders WHERE account_id=$1
+         ORDER BY role='secondary', created_at, user_id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountHolders(rows)
+}
+
+func (r *postgresRepository) AddAccountHolder(ctx context.Context, h *AccountHolder) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO account_holders(account_id, user_id, role, added_by) VALUES ($1, $2, $3, $4)
+         ON CONFLICT (account_id, user_id) DO NOTHING RETURNING created_at`,
+		h.AccountID, h.UserID, h.Role, h.AddedBy).Scan(&h.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrAlreadyHolder
+	}
+	return err
+}
+
+func (r *postgresRepository) RemoveAccountHolder(ctx context.Context, accountID, userID int) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM account_holders WHERE account_id=$1 AND user_id=$2 AND role='secondary'`, accountID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListSecondaryHolderIDs(ctx context.Context, accountIDs []int) ([]int, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT DISTINCT user_id FROM account_holders WHERE account_id IN (`+in+`) AND role='secondary'`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func (r *postgresRepository) ListBeneficiaries(ctx context.Context, accountIDs []int) ([]*Beneficiary, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+beneficiaryColumns+` FROM account_beneficiaries WHERE account_id IN (`+in+`)
+         ORDER BY account_id, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBeneficiaries(rows)
+}
+
+func (r *postgresRepository) ReplaceBeneficiaries(ctx context.Context, accountID int, beneficiaries []*Beneficiary) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM account_beneficiaries WHERE account_id=$1`, accountID); err != nil {
+		return err
+	}
+	for i, b := range beneficiaries {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO account_beneficiaries(account_id, position, name, relationship, allocation_percent, designated_by, created_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			accountID, i+1, b.Name, b.Relationship, b.AllocationPercent, b.DesignatedBy, b.DesignatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *postgresRepository) ListArchivable(ctx context.Context, status string, closedBefore time.Time, limit int) ([]int, error) {
+	query := `SELECT id FROM block_accounts WHERE status=$1 AND updated_at < $2 ORDER BY id LIMIT $3`
+	if status == StatusClosed {
+		query = `SELECT DISTINCT account_id FROM account_status_history
+         WHERE to_status=$1 AND changed_at < $2 ORDER BY account_id LIMIT $3`
+	}
+	rows, err := r.db.QueryContext(ctx, query, status, closedBefore.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func (r *postgresRepository) ArchiveAccount(ctx context.Context, a *ArchivedAccount) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Deleting the account takes its payouts, funding, closure, holders and
+	// beneficiaries with it. A closed account staff deleted has none left.
+	result, err := tx.ExecContext(ctx, `DELETE FROM block_accounts WHERE id=$1 AND status=$2`, a.AccountID, a.Status)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		deleted := false
+		if a.Status == StatusClosed {
+			err = tx.QueryRowContext(ctx,
+				`SELECT EXISTS (SELECT 1 FROM account_status_history WHERE account_id=$1 AND to_status=$2)
+                 AND NOT EXISTS (SELECT 1 FROM block_accounts WHERE id=$1)`, a.AccountID, a.Status).Scan(&deleted)
+			if err != nil {
+				return err
+			}
+		}
+		if !deleted {
+			return sql.ErrNoRows
+		}
+	}
+	for _, table := range []string{"account_status_history", "interest_adjustments"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE account_id=$1`, a.AccountID); err != nil {
+			return err
+		}
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO archived_accounts(account_id, external_id, tenant_id, status, closed_at, archived_at, record)
+         SELECT account_id, external_id, tenant_id, $2, $3, $4, $5 FROM account_ids WHERE account_id=$1
+         RETURNING external_id, tenant_id`,
+		a.AccountID, a.Status, a.ClosedAt.UTC(), a.ArchivedAt.UTC(), string(a.Record)).Scan(&a.ExternalID, &a.TenantID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresRepository) GetArchivedAccount(ctx context.Context, accountID int) (*ArchivedAccount, error) {
+	return scanArchivedAccount(r.db.QueryRowContext(ctx,
+		`SELECT `+archivedAccountColumns+` FROM archived_accounts
+         WHERE account_id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`, accountID, tenantFromContext(ctx)))
+}
+
+func (r *postgresRepository) RewriteSensitiveFields(ctx context.Context, rewrite func(ctx context.Context, field, value string) (string, error)) (int, error) {
+	return rewriteSensitiveFields(ctx, r.db, func(n int) string { return "$" + strconv.Itoa(n) }, rewrite)
+}
+
+func (r *postgresRepository) RecordAccountCreation(ctx context.Context, accountID, userID int, clientIP string, at, forgetBefore time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO account_creations(account_id, user_id, client_ip, created_at, tenant_id) VALUES ($1, $2, $3, $4, $5)`,
+		accountID, userID, clientIP, at, tenantOf(ctx)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM account_creations WHERE created_at < $1`, forgetBefore); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresRepository) CountAccountCreations(ctx context.Context, userID int, clientIP string, since time.Time) (int, int, error) {
+	var byUser, byIP int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM account_creations WHERE user_id=$1 AND created_at >= $3 AND tenant_id=$4),
+                (SELECT COUNT(*) FROM account_creations WHERE $2 <> '' AND client_ip=$2 AND created_at >= $3 AND tenant_id=$4)`,
+		userID, clientIP, since, tenantOf(ctx)).Scan(&byUser, &byIP)
+	return byUser, byIP, err
+}
+
+func (r *postgresRepository) RaiseComplianceFlag(ctx context.Context, f *ComplianceFlag, now, since time.Time) (*ComplianceFlag, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var flag ComplianceFlag
+	err = scanComplianceFlag(tx.QueryRowContext(ctx,
+		`UPDATE compliance_flags SET occurrences=occurrences+1, last_seen_at=$3, detail=$4, action=$5,
+                account_id=COALESCE($6, account_id), client_ip=$7
+         WHERE id = (SELECT id FROM compliance_flags
+                     WHERE rule=$1 AND subject=$2 AND status='open' AND last_seen_at >= $8 AND tenant_id=$9
+                     ORDER BY id DESC LIMIT 1 FOR UPDATE)
+         RETURNING `+complianceFlagColumns,
+		f.Rule, f.Subject, now, f.Detail, f.Action, f.AccountID, f.ClientIP, since, tenantOf(ctx)), &flag)
+	if err == sql.ErrNoRows {
+		err = scanComplianceFlag(tx.QueryRowContext(ctx,
+			`INSERT INTO compliance_flags(rule, subject, user_id, account_id, client_ip, detail, action, created_at, last_seen_at,
+                 tenant_id)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $9)
+             RETURNING `+complianceFlagColumns,
+			f.Rule, f.Subject, f.UserID, f.AccountID, f.ClientIP, f.Detail, f.Action, now, tenantOf(ctx)), &flag)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+func (r *postgresRepository) GetComplianceFlag(ctx context.Context, id int) (*ComplianceFlag, error) {
+	var flag ComplianceFlag
+	err := scanComplianceFlag(r.db.QueryRowContext(ctx,
+		`SELECT `+complianceFlagColumns+` FROM compliance_flags WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`,
+		id, tenantFromContext(ctx)), &flag)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+func (r *postgresRepository) ListComplianceFlags(ctx context.Context, status string, limit int) ([]*ComplianceFlag, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+complianceFlagColumns+` FROM compliance_flags
+         WHERE ($1 = '' OR status = $1) AND tenant_id = COALESCE(NULLIF($3, ''), tenant_id) ORDER BY id DESC LIMIT $2`,
+		status, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanComplianceFlags(rows)
+}
+
+func (r *postgresRepository) ReviewComplianceFlag(ctx context.Context, id int, status, staffID, note string, now time.Time) (*ComplianceFlag, error) {
+	var flag ComplianceFlag
+	err := scanComplianceFlag(r.db.QueryRowContext(ctx,
+		`UPDATE compliance_flags SET status=$2, reviewed_by=$3, review_note=$4, reviewed_at=$5
+         WHERE id=$1 AND status='open' AND tenant_id = COALESCE(NULLIF($6, ''), tenant_id) RETURNING `+complianceFlagColumns,
+		id, status, staffID, note, now, tenantFromContext(ctx)), &flag)
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+func (r *postgresRepository) RecordReconciliationBreak(ctx context.Context, b *ReconciliationBreak, now time.Time) (*ReconciliationBreak, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var recorded ReconciliationBreak
+	err = scanReconciliationBreak(tx.QueryRowContext(ctx,
+		`UPDATE reconciliation_breaks SET principal=$2, posted_interest=$3, paid_out=$4, ledger_balance=$5,
+                stored_balance=$6, occurrences=occurrences+1, last_seen_at=$7
+         WHERE account_id=$1 AND status <> 'resolved'
+         RETURNING `+reconciliationBreakColumns,
+		b.AccountID, b.Principal, b.PostedInterest, b.PaidOut, b.LedgerBalance, b.StoredBalance, now), &recorded)
+	if err == sql.ErrNoRows {
+		err = scanReconciliationBreak(tx.QueryRowContext(ctx,
+			`INSERT INTO reconciliation_breaks(account_id, tenant_id, principal, posted_interest, paid_out, ledger_balance,
+                 stored_balance, detected_at, last_seen_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+             RETURNING `+reconciliationBreakColumns,
+			b.AccountID, b.TenantID, b.Principal, b.PostedInterest, b.PaidOut, b.LedgerBalance, b.StoredBalance, now), &recorded)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &recorded, nil
+}
+
+func (r *postgresRepository) ResolveReconciliationBreaks(ctx context.Context, accountIDs []int, now time.Time) (int, error) {
+	if len(accountIDs) == 0 {
+		return 0, nil
+	}
+	in, args := inList(accountIDs, 2, func(n int) string { return "$" + strconv.Itoa(n) })
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE reconciliation_breaks SET status='resolved', resolved_at=$1
+         WHERE status <> 'resolved' AND account_id IN (`+in+`)`,
+		append([]any{now}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *postgresRepository) GetReconciliationBreak(ctx context.Context, id int) (*ReconciliationBreak, error) {
+	var b ReconciliationBreak
+	err := scanReconciliationBreak(r.db.QueryRowContext(ctx,
+		`SELECT `+reconciliationBreakColumns+` FROM reconciliation_breaks
+         WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`,
+		id, tenantFromContext(ctx)), &b)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *postgresRepository) ListReconciliationBreaks(ctx context.Context, status string, limit int) ([]*ReconciliationBreak, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+reconciliationBreakColumns+` FROM reconciliation_breaks
+         WHERE ($1 = '' OR status = $1) AND tenant_id = COALESCE(NULLIF($3, ''), tenant_id) ORDER BY id DESC LIMIT $2`,
+		status, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanReconciliationBreaks(rows)
+}
+
+func (r *postgresRepository) AcknowledgeReconciliationBreak(ctx context.Context, id int, staffID, note string, now time.Time) (*ReconciliationBreak, error) {
+	var b ReconciliationBreak
+	err := scanReconciliationBreak(r.db.QueryRowContext(ctx,
+		`UPDATE reconciliation_breaks SET status='acknowledged', acknowledged_by=$2, note=$3, acknowledged_at=$4
+         WHERE id=$1 AND status='open' AND tenant_id = COALESCE(NULLIF($5, ''), tenant_id)
+         RETURNING `+reconciliationBreakColumns,
+		id, staffID, note, now, tenantFromContext(ctx)), &b)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *postgresRepository) CreateAPIKey(ctx context.Context, k *APIKey) (*APIKey, error) {
+	var key APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys(name, prefix, key_hash, scopes, created_by, created_at, expires_at, tenant_id)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+         RETURNING `+apiKeyColumns,
+		k.Name, k.Prefix, k.keyHash, strings.Join(k.Scopes, ","), k.CreatedBy, time.Now().UTC(), k.ExpiresAt, k.TenantID), &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *postgresRepository) GetAPIKey(ctx context.Context, id int) (*APIKey, error) {
+	return r.getAPIKey(ctx, `id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`, id, tenantFromContext(ctx))
+}
+
+func (r *postgresRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	get, err := r.stmts.prepare(ctx, r.db, pgGetAPIKeyByPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var key APIKey
+	err = scanAPIKey(get.QueryRowContext(ctx, prefix), &key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// getAPIKey returns the key matching where, or nil
+func (r *postgresRepository) getAPIKey(ctx context.Context, where string, args ...any) (*APIKey, error) {
+	var key APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE `+where, args...), &key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *postgresRepository) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id = COALESCE(NULLIF($1, ''), tenant_id) ORDER BY id DESC`, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+func (r *postgresRepository) RotateAPIKey(ctx context.Context, id int, keyHash string, previousExpiresAt, now time.Time) (*APIKey, error) {
+	var key APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx,
+		`UPDATE api_keys SET previous_hash=key_hash, previous_expires_at=$3, key_hash=$2, rotated_at=$4
+         WHERE id=$1 AND revoked_at IS NULL AND tenant_id = COALESCE(NULLIF($5, ''), tenant_id) RETURNING `+apiKeyColumns,
+		id, keyHash, previousExpiresAt, now, tenantFromContext(ctx)), &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *postgresRepository) RevokeAPIKey(ctx context.Context, id int, revokedBy string, now time.Time) (*APIKey, error) {
+	var key APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx,
+		`UPDATE api_keys SET revoked_at=$3, revoked_by=$2
+         WHERE id=$1 AND revoked_at IS NULL AND tenant_id = COALESCE(NULLIF($4, ''), tenant_id) RETURNING `+apiKeyColumns,
+		id, revokedBy, now, tenantFromContext(ctx)), &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *postgresRepository) TouchAPIKey(ctx context.Context, id int, now time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at=$2 WHERE id=$1`, id, now)
+	return err
+}
+
+func (r *postgresRepository) ResolveAccountID(ctx context.Context, externalID string) (int, error) {
+	resolve, err := r.stmts.prepare(ctx, r.readDB(ctx), pgResolveAccountID)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = resolve.QueryRowContext(ctx, externalID, tenantFromContext(ctx)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (r *postgresRepository) AccountExternalIDs(ctx context.Context, ids []int) (map[int]string, error) {
+	if len(ids) == 0 {
+		return map[int]string{}, nil
+	}
+	query, args := accountExternalIDsQuery(ids, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountExternalIDs(rows)
+}
+
+func (r *postgresRepository) GetRegionState(ctx context.Context) (*RegionState, error) {
+	return scanRegionState(r.db.QueryRowContext(ctx, `SELECT `+regionStateColumns+` FROM region_state WHERE id=1`))
+}
+
+func (r *postgresRepository) PromoteRegion(ctx context.Context, region string, fromEpoch int, promotedBy string, now time.Time) (*RegionState, error) {
+	state, err := scanRegionState(r.db.QueryRowContext(ctx,
+		`INSERT INTO region_state(id, active_region, epoch, promoted_at, promoted_by) VALUES (1, $1, $2 + 1, $3, $4)
+         ON CONFLICT (id) DO UPDATE SET active_region=EXCLUDED.active_region, epoch=EXCLUDED.epoch,
+             promoted_at=EXCLUDED.promoted_at, promoted_by=EXCLUDED.promoted_by
+         WHERE region_state.epoch = $2
+         RETURNING `+regionStateColumns,
+		region, fromEpoch, now, promotedBy))
+	if err == nil && state == nil {
+		return nil, sql.ErrNoRows
+	}
+	return state, err
+}
+
+func (r *postgresRepository) ClaimDeployment(ctx context.Context, sandbox bool, now time.Time) (bool, error) {
+	if _, err := r.db.ExecContext(ctx,
+		`INSERT INTO deployment(id, sandbox, created_at) VALUES (1, $1, $2) ON CONFLICT (id) DO NOTHING`, sandbox, now); err != nil {
+		return false, err
+	}
+	var recorded bool
+	err := r.db.QueryRowContext(ctx, `SELECT sandbox FROM deployment WHERE id=1`).Scan(&recorded)
+	return recorded, err
+}
+
+func (r *postgresRepository) ClockOffset(ctx context.Context) (time.Duration, error) {
+	var ms int64
+	err := r.db.QueryRowContext(ctx, `SELECT clock_offset_ms FROM deployment WHERE id=1`).Scan(&ms)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+func (r *postgresRepository) AdvanceClock(ctx context.Context, d time.Duration) (time.Duration, error) {
+	var ms int64
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE deployment SET clock_offset_ms = clock_offset_ms + $1 WHERE id=1 RETURNING clock_offset_ms`,
+		d.Milliseconds()).Scan(&ms)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+// ReplicationLag measures the replica when one is configured, or else the
+// database itself, which is a standby in a passive region
+func (r *postgresRepository) ReplicationLag(ctx context.Context) (time.Duration, error) {
+	db := r.db
+	if r.replica != nil {
+		db = r.replica.db
+	}
+	return replicationLag(ctx, db)
+}
+
+// replicationLag measures how far db, a standby, is behind its primary. A
+// standby that has replayed everything it received counts as caught up, and
+// a primary as never behind.
+func replicationLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRowContext(ctx,
+		`SELECT CASE WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+                ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (r *postgresRepository) RecordWorkerHeartbeat(ctx context.Context, hb *WorkerHeartbeat) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO worker_heartbeats(worker, instance, interval_ms, last_run_failed, beat_at) VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (worker) DO UPDATE SET instance=excluded.instance, interval_ms=excluded.interval_ms,
+             last_run_failed=excluded.last_run_failed, beat_at=excluded.beat_at`,
+		hb.Worker, hb.Instance, hb.Interval.Milliseconds(), hb.LastRunFailed, hb.BeatAt)
+	return err
+}
+
+func (r *postgresRepository) AcquireWorkerLease(ctx context.Context, worker, holder string, now time.Time, lease time.Duration) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO worker_leases(worker, holder, acquired_at, expires_at) VALUES ($1, $2, $3, $4)
+         ON CONFLICT (worker) DO UPDATE SET holder=excluded.holder, expires_at=excluded.expires_at,
+             acquired_at=CASE WHEN worker_leases.holder=excluded.holder THEN worker_leases.acquired_at ELSE excluded.acquired_at END
+         WHERE worker_leases.holder=excluded.holder OR worker_leases.expires_at <= $3`,
+		worker, holder, now, now.Add(lease))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *postgresRepository) ReleaseWorkerLease(ctx context.Context, worker, holder string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM worker_leases WHERE worker=$1 AND holder=$2`, worker, holder)
+	return err
+}
+
+func (r *postgresRepository) ListWorkerHeartbeats(ctx context.Context) ([]*WorkerHeartbeat, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT worker, instance, interval_ms, last_run_failed, beat_at FROM worker_heartbeats ORDER BY worker`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var heartbeats []*WorkerHeartbeat
+	for rows.Next() {
+		hb := &WorkerHeartbeat{}
+		var intervalMS int64
+		if err := rows.Scan(&hb.Worker, &hb.Instance, &intervalMS, &hb.LastRunFailed, &hb.BeatAt); err != nil {
+			return nil, err
+		}
+		hb.Interval = time.Duration(intervalMS) * time.Millisecond
+		heartbeats = append(heartbeats, hb)
+	}
+	return heartbeats, rows.Err()
+}
+
+func (r *postgresRepository) ListStatusChanges(ctx context.Context, accountID int) ([]*StatusChange, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+statusChangeColumns+` FROM account_status_history WHERE account_id=$1 ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanStatusChanges(rows)
+}
+
+// insertStatusChange records an account's change of status as part of tx,
+// at the transaction's time
+func (r *postgresRepository) insertStatusChange(ctx context.Context, tx *sql.Tx, c *StatusChange) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO account_status_history(account_id, from_status, to_status, principal, note, changed_at)
+         VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), CURRENT_TIMESTAMP)`,
+		c.AccountID, c.From, c.To, c.Principal, c.Note)
+	return err
+}
+
+// recordStatus records the change of the account's status to the one about
+// to be set, locking its row
+func (r *postgresRepository) recordStatus(ctx context.Context, tx *sql.Tx, accountID int, to, note string) error {
+	c := &StatusChange{AccountID: accountID, To: to, Note: note}
+	err := tx.QueryRowContext(ctx,
+		`SELECT status, principal FROM block_accounts WHERE id=$1 FOR UPDATE`, accountID).Scan(&c.From, &c.Principal)
+	if err != nil {
+		return err
+	}
+	return r.insertStatusChange(ctx, tx, c)
+}
+
+// insertAccountID records the account's external ID as part of tx
+func (r *postgresRepository) insertAccountID(ctx context.Context, tx *sql.Tx, a *BlockAccount) error {
+	if a.ExternalID == "" {
+		return errNoExternalID
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO account_ids(account_id, external_id, tenant_id) VALUES ($1, $2, $3)`,
+		a.ID, a.ExternalID, a.TenantID)
+	return err
+}
+
+// insertHolders records the account's user as its primary holder as part of
+// tx and, when it is the rollover of the account rolledOver, carries that
+// account's secondary holders over to it
+func (r *postgresRepository) insertHolders(ctx context.Context, tx *sql.Tx, a *BlockAccount, rolledOver int) error {
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO account_holders(account_id, user_id, role) VALUES ($1, $2, 'primary')`, a.ID, a.UserID); err != nil {
+		return err
+	}
+	if rolledOver == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO account_holders(account_id, user_id, role, added_by, created_at)
+         SELECT $1, user_id, role, added_by, created_at FROM account_holders WHERE account_id=$2 AND role='secondary'`,
+		a.ID, rolledOver)
+	return err
+}
+
+// insertOutbox enqueues e as part of tx
+func (r *postgresRepository) insertOutbox(ctx context.Context, tx *sql.Tx, e *AccountEvent) error {
+	payload, err := e.Payload()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox(event_id, aggregate_id, aggregate_key, event_type, schema_version, payload, tenant_id, user_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		e.ID, e.accountID, e.Account.ID, e.Type, e.SchemaVersion, string(payload), e.tenantID, e.Account.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Fan the event out to every active webhook of the account's tenant
+	// subscribed to it
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload)
+         SELECT id, $1::uuid, $2::text, $3::jsonb FROM webhooks
+         WHERE active AND channel='account' AND tenant_id=$4 AND (',' || events || ',') LIKE ('%,' || $2::text || ',%')`,
+		e.ID, e.Type, string(payload), e.tenantID)
+	return err
+}
+
+// outboxRelayLock is the advisory lock key held by the relay. Only one relay
+// publishes at a time so events reach the broker in commit order.
+const outboxRelayLock = 7263001
+
+func (r *postgresRepository) RelayOutbox(ctx context.Context, limit int, publish func(*OutboxEvent) error) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLock).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		// Another relay is running
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		return 0, err
+	}
+	events, err := scanOutbox(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, e := range events {
+		if publishErr := publish(e); publishErr != nil {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE outbox SET attempts=attempts+1, last_error=$2 WHERE id=$1`, e.ID, publishErr.Error()); err != nil {
+				return 0, err
+			}
+			if err := tx.Commit(); err != nil {
+				return 0, err
+			}
+			return published, fmt.Errorf("publish event %s: %w", e.EventID, publishErr)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE outbox SET attempts=attempts+1, last_error=NULL, published_at=CURRENT_TIMESTAMP WHERE id=$1`,
+			e.ID); err != nil {
+			return 0, err
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return published, nil
+}
+
+func (r *postgresRepository) CreateWebhook(ctx context.Context, w *Webhook) (*Webhook, error) {
+	var webhook Webhook
+	err := scanWebhook(r.db.QueryRowContext(ctx,
+		`INSERT INTO webhooks(url, channel, secret, events, active, tenant_id) VALUES ($1, $2, $3, $4, $5, $6)
+         RETURNING `+webhookColumns,
+		w.URL, w.Channel, w.Secret, strings.Join(w.Events, ","), w.Active, tenantOf(ctx)), &webhook)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *postgresRepository) GetWebhook(ctx context.Context, id int) (*Webhook, error) {
+	var webhook Webhook
+	err := scanWebhook(r.readDB(ctx).QueryRowContext(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`, id, tenantFromContext(ctx)), &webhook)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *postgresRepository) DeleteWebhook(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`, id, tenantFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]*WebhookDelivery, error) {
+	db := r.readDB(ctx)
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries d
+         WHERE d.webhook_id = (SELECT id FROM webhooks WHERE id=$1 AND tenant_id = COALESCE(NULLIF($3, ''), tenant_id))
+         ORDER BY d.id DESC LIMIT $2`,
+		webhookID, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanDeliveries(rows)
+	if err != nil || len(deliveries) == 0 {
+		return deliveries, err
+	}
+
+	rows, err = db.QueryContext(ctx,
+		`SELECT `+attemptColumns+` FROM webhook_delivery_attempts
+         WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY id DESC LIMIT $2)
+         ORDER BY id`,
+		webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachAttempts(rows, deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *postgresRepository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+deliveryColumns+`, w.url, w.secret
+         FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+         WHERE d.status='pending' AND d.next_attempt_at <= $1
+         ORDER BY d.next_attempt_at, d.id LIMIT $2 FOR UPDATE OF d SKIP LOCKED`,
+		now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanDelivery(rows, &d, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, d := range deliveries {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE webhook_deliveries SET next_attempt_at=$2 WHERE id=$1`, d.ID, now.Add(lease)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *postgresRepository) RecordWebhookAttempt(ctx context.Context, d *WebhookDelivery, a *WebhookAttempt) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO webhook_delivery_attempts(delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+         VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, ''), $5, $6) RETURNING id`,
+		a.DeliveryID, a.Attempt, a.StatusCode, a.Error, a.DurationMs, a.AttemptedAt).Scan(&a.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status=$2, attempts=$3, next_attempt_at=$4,
+             last_status_code=NULLIF($5, 0), last_error=NULLIF($6, ''), updated_at=CURRENT_TIMESTAMP
+         WHERE id=$1`,
+		d.ID, d.Status, d.Attempts, d.NextAttemptAt, d.LastStatusCode, d.LastError); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *postgresRepository) EnqueueOperationalEvent(ctx context.Context, e *OperationalEvent) (int, error) {
+	payload, err := e.Payload()
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload)
+         SELECT id, $1::uuid, $2::text, $3::jsonb FROM webhooks
+         WHERE active AND channel='operations' AND tenant_id=$4 AND (',' || events || ',') LIKE ('%,' || $2::text || ',%')`,
+		e.ID, e.Type, string(payload), tenantOf(ctx))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *postgresRepository) ReplayWebhookDeliveries(ctx context.Context, webhookID int, now time.Time) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT id FROM webhooks WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`, webhookID, tenantFromContext(ctx)).Scan(&id); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=$2, updated_at=CURRENT_TIMESTAMP
+         WHERE webhook_id=$1 AND status='failed'`,
+		webhookID, now)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (r *postgresRepository) CreateImpersonation(ctx context.Context, s *ImpersonationSession) (*ImpersonationSession, error) {
+	if err := r.db.QueryRowContext(ctx,
+		`INSERT INTO impersonation_sessions(token_hash, staff_id, staff_role, user_id, reason, expires_at, tenant_id)
+         VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`,
+		s.tokenHash, s.StaffID, s.StaffRole, s.UserID, s.Reason, s.ExpiresAt, s.TenantID).Scan(&s.ID, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *postgresRepository) GetImpersonation(ctx context.Context, id int) (*ImpersonationSession, error) {
+	var s ImpersonationSession
+	err := scanImpersonation(r.db.QueryRowContext(ctx,
+		`SELECT `+impersonationColumns+` FROM impersonation_sessions WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`,
+		id, tenantFromContext(ctx)), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *postgresRepository) GetImpersonationByTokenHash(ctx context.Context, tokenHash string) (*ImpersonationSession, error) {
+	var s ImpersonationSession
+	err := scanImpersonation(r.db.QueryRowContext(ctx,
+		`SELECT `+impersonationColumns+` FROM impersonation_sessions WHERE token_hash=$1`, tokenHash), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *postgresRepository) EndImpersonation(ctx context.Context, id int, now time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE impersonation_sessions SET ended_at=$2
+         WHERE id=$1 AND ended_at IS NULL AND expires_at > $2 AND tenant_id = COALESCE(NULLIF($3, ''), tenant_id)`,
+		id, now, tenantFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) RecordImpersonationAccess(ctx context.Context, a *ImpersonationAccess) error {
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO impersonation_audit(session_id, method, path, status) VALUES ($1, $2, $3, $4)
+         RETURNING id, created_at`,
+		a.SessionID, a.Method, a.Path, a.Status).Scan(&a.ID, &a.CreatedAt)
+}
+
+func (r *postgresRepository) ListImpersonationAudit(ctx context.Context, sessionID int) ([]*ImpersonationAccess, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+impersonationAuditColumns+` FROM impersonation_audit WHERE session_id=$1 ORDER BY id`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return scanImpersonationAudit(rows)
+}
+
+func (r *postgresRepository) ActiveExposureByPeriod(ctx context.Context) ([]PeriodExposure, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT COALESCE(period, ''), COUNT(*), COALESCE(SUM(principal), 0),
+             COALESCE(SUM(principal * EXTRACT(EPOCH FROM (end_date - start_date)) / 86400 / 365), 0),
+             COALESCE(SUM(principal * interest_rate * EXTRACT(EPOCH FROM (end_date - start_date)) / 86400 / 365), 0)
+         FROM block_accounts WHERE status='active' AND tenant_id = COALESCE(NULLIF($1, ''), tenant_id) GROUP BY period ORDER BY period`,
+		tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanExposures(rows)
+}
+
+func (r *postgresRepository) PortfolioGroups(ctx context.Context) ([]PortfolioGroup, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT status, COALESCE(period, ''), COUNT(*), COALESCE(SUM(principal), 0),
+             COALESCE(SUM(interest_rate), 0), COALESCE(SUM(principal * interest_rate), 0)
+         FROM block_accounts WHERE tenant_id = COALESCE(NULLIF($1, ''), tenant_id) GROUP BY status, period ORDER BY status, period`,
+		tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanPortfolioGroups(rows)
+}
+
+func (r *postgresRepository) MaturingTotals(ctx context.Context, from, to time.Time) (int, float64, error) {
+	var count int
+	var principal float64
+	err := r.readDB(ctx).QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(principal), 0) FROM block_accounts
+         WHERE status='active' AND end_date > $1 AND end_date <= $2 AND tenant_id = COALESCE(NULLIF($3, ''), tenant_id)`,
+		from, to, tenantFromContext(ctx)).Scan(&count, &principal)
+	return count, principal, err
+}
+
+func (r *postgresRepository) MaturityCalendar(ctx context.Context, from, to time.Time, groupBy string, loc *time.Location) ([]*MaturityBucket, error) {
+	bucket := `to_char(date_trunc($4, end_date AT TIME ZONE $5), 'YYYY-MM-DD')`
+	interest := `interest_adjustment + principal * interest_rate *
+		EXTRACT(EPOCH FROM (end_date - COALESCE(interest_paid_through, start_date))) / 86400 / 365`
+	rows, err := r.readDB(ctx).QueryContext(ctx, maturityCalendarQuery(bucket, interest, "$1", "$2", "$3"),
+		from, to, tenantFromContext(ctx), groupBy, loc.String())
+	if err != nil {
+		return nil, err
+	}
+	return scanMaturityBuckets(rows)
+}
+
+func (r *postgresRepository) DailySummary(ctx context.Context, from, to time.Time) (*DailySummary, error) {
+	accrual := `principal * interest_rate * EXTRACT(EPOCH FROM (LEAST(end_date, $2) - GREATEST(start_date, $1))) / 86400 / 365`
+	return scanDailySummary(r.readDB(ctx).QueryRowContext(ctx, dailySummaryQuery(accrual, "$1", "$2"), from, to))
+}
+
+func (r *postgresRepository) SaveReport(ctx context.Context, report *Report) (*Report, error) {
+	summary, err := json.Marshal(report.Summary)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.QueryRowContext(ctx,
+		`INSERT INTO reports(type, report_date, summary, recipients, document_key, requested_by)
+         VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+         ON CONFLICT (type, report_date) DO UPDATE SET summary=EXCLUDED.summary, recipients=EXCLUDED.recipients,
+             document_key=EXCLUDED.document_key, requested_by=EXCLUDED.requested_by, created_at=CURRENT_TIMESTAMP
+         RETURNING id, created_at`,
+		report.Type, report.Date, string(summary), strings.Join(report.Recipients, ","), report.DocumentKey,
+		report.RequestedBy).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (r *postgresRepository) GetReport(ctx context.Context, reportType, date string) (*Report, error) {
+	var report Report
+	err := scanReport(r.readDB(ctx).QueryRowContext(ctx,
+		`SELECT `+reportColumns+` FROM reports WHERE type=$1 AND report_date=$2`, reportType, date), &report)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *postgresRepository) DashboardCounts(ctx context.Context, failedSince time.Time) (*Dashboard, error) {
+	return scanDashboardCounts(r.readDB(ctx).QueryRowContext(ctx, fmt.Sprintf(dashboardCountsQuery, "$1"), failedSince))
+}
+
+func (r *postgresRepository) GetCheckpoint(ctx context.Context, job string) (*WorkerCheckpoint, error) {
+	var cp WorkerCheckpoint
+	err := scanCheckpoint(r.db.QueryRowContext(ctx,
+		`SELECT `+checkpointColumns+` FROM worker_checkpoints WHERE job=$1`, job), &cp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (r *postgresRepository) SaveCheckpoint(ctx context.Context, cp *WorkerCheckpoint) error {
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO worker_checkpoints(job, run_started_at, processed, completed_at, last_completed_at, updated_at)
+         VALUES ($1, $2, $3, $4, $4, CURRENT_TIMESTAMP)
+         ON CONFLICT (job) DO UPDATE SET run_started_at=EXCLUDED.run_started_at, processed=EXCLUDED.processed,
+             completed_at=EXCLUDED.completed_at,
+             last_completed_at=COALESCE(EXCLUDED.completed_at, worker_checkpoints.last_completed_at),
+             updated_at=EXCLUDED.updated_at
+         RETURNING last_completed_at, updated_at`,
+		cp.Job, cp.RunStartedAt, cp.Processed, cp.CompletedAt).Scan(&cp.LastCompletedAt, &cp.UpdatedAt)
+}
+
+func (r *postgresRepository) ListScheduledJobs(ctx context.Context) ([]*ScheduledJob, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+scheduledJobColumns+` FROM scheduled_jobs ORDER BY job`)
+	if err != nil {
+		return nil, err
+	}
+	return scanScheduledJobs(rows)
+}
+
+func (r *postgresRepository) GetScheduledJob(ctx context.Context, job string) (*ScheduledJob, error) {
+	var j ScheduledJob
+	err := scanScheduledJob(r.db.QueryRowContext(ctx, `SELECT `+scheduledJobColumns+` FROM scheduled_jobs WHERE job=$1`, job), &j)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *postgresRepository) ScheduleJob(ctx context.Context, job, schedule string, nextRunAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO scheduled_jobs(job, schedule, next_run_at, updated_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+         ON CONFLICT (job) DO UPDATE SET schedule=EXCLUDED.schedule, next_run_at=EXCLUDED.next_run_at,
+             updated_at=EXCLUDED.updated_at`,
+		job, schedule, nextRunAt)
+	return err
+}
+
+func (r *postgresRepository) StartScheduledRun(ctx context.Context, job string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE scheduled_jobs SET running_since=$1, last_started_at=$1,
+             trigger_requested_by=CASE WHEN trigger_requested_at <= $1 THEN '' ELSE trigger_requested_by END,
+             trigger_requested_at=CASE WHEN trigger_requested_at <= $1 THEN NULL ELSE trigger_requested_at END,
+             updated_at=$1
+         WHERE job=$2`,
+		at, job)
+	return err
+}
+
+func (r *postgresRepository) FinishScheduledRun(ctx context.Context, job string, at time.Time, runErr string) error {
+	status := ScheduledRunSucceeded
+	if runErr != "" {
+		status = ScheduledRunFailed
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE scheduled_jobs SET running_since=NULL, last_finished_at=$1, last_status=$2, last_error=$3, updated_at=$1
+         WHERE job=$4`,
+		at, status, runErr, job)
+	return err
+}
+
+func (r *postgresRepository) PauseScheduledJob(ctx context.Context, job string, paused bool, staffID string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO scheduled_jobs(job, paused, paused_by, updated_at) VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+         ON CONFLICT (job) DO UPDATE SET paused=EXCLUDED.paused, paused_by=EXCLUDED.paused_by,
+             updated_at=EXCLUDED.updated_at`,
+		job, paused, staffID)
+	return err
+}
+
+func (r *postgresRepository) TriggerScheduledJob(ctx context.Context, job string, at time.Time, staffID string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO scheduled_jobs(job, trigger_requested_at, trigger_requested_by, updated_at) VALUES ($1, $2, $3, $2)
+         ON CONFLICT (job) DO UPDATE SET
+             trigger_requested_by=COALESCE(NULLIF(scheduled_jobs.trigger_requested_by, ''), EXCLUDED.trigger_requested_by),
+             trigger_requested_at=COALESCE(scheduled_jobs.trigger_requested_at, EXCLUDED.trigger_requested_at),
+             updated_at=EXCLUDED.updated_at`,
+		job, at, staffID)
+	return err
+}
+
+func (r *postgresRepository) GetProductGate(ctx context.Context, product string) (*ProductGate, error) {
+	var gate ProductGate
+	err := scanProductGate(r.db.QueryRowContext(ctx,
+		`SELECT `+productGateColumns+` FROM product_gates WHERE tenant_id=$1 AND product=$2`, tenantOf(ctx), product), &gate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &gate, nil
+}
+
+func (r *postgresRepository) ListProductGates(ctx context.Context) ([]*ProductGate, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+productGateColumns+` FROM product_gates WHERE tenant_id=$1 ORDER BY product`, tenantOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanProductGates(rows)
+}
+
+func (r *postgresRepository) SaveProductGate(ctx context.Context, gate *ProductGate) error {
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO product_gates(product, allowed_user_ids, rollout_percent, updated_by, tenant_id)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (tenant_id, product) DO UPDATE SET allowed_user_ids=excluded.allowed_user_ids,
+             rollout_percent=excluded.rollout_percent, updated_by=excluded.updated_by, updated_at=CURRENT_TIMESTAMP
+         RETURNING updated_at`,
+		gate.Product, joinIDs(gate.AllowedUserIDs), gate.RolloutPercent, gate.UpdatedBy, tenantOf(ctx)).Scan(&gate.UpdatedAt)
+}
+
+func (r *postgresRepository) DeleteProductGate(ctx context.Context, product string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM product_gates WHERE tenant_id=$1 AND product=$2`, tenantOf(ctx), product)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListFeatureFlags(ctx context.Context) ([]*FeatureFlag, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+featureFlagColumns+` FROM feature_flags ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	return scanFeatureFlags(rows)
+}
+
+func (r *postgresRepository) SaveFeatureFlag(ctx context.Context, flag *FeatureFlag) error {
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO feature_flags(name, enabled, tenants, rollout_percent, updated_by)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (name) DO UPDATE SET enabled=excluded.enabled, tenants=excluded.tenants,
+             rollout_percent=excluded.rollout_percent, updated_by=excluded.updated_by, updated_at=CURRENT_TIMESTAMP
+         RETURNING updated_at`,
+		flag.Name, flag.Enabled, strings.Join(flag.Tenants, ","), flag.RolloutPercent, flag.UpdatedBy).Scan(&updatedAt)
+	if err != nil {
+		return err
+	}
+	flag.UpdatedAt = &updatedAt
+	return nil
+}
+
+func (r *postgresRepository) DeleteFeatureFlag(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM feature_flags WHERE name=$1`, name)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListAccountLimits(ctx context.Context) ([]*AccountLimit, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+accountLimitColumns+` FROM account_limits WHERE tenant_id=$1 ORDER BY rule, period`, tenantOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountLimits(rows)
+}
+
+func (r *postgresRepository) SaveAccountLimit(ctx context.Context, limit *AccountLimit) error {
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO account_limits(rule, period, value, updated_by, tenant_id)
+         VALUES ($1, $2, $3, $4, $5)
+         ON CONFLICT (tenant_id, rule, period) DO UPDATE SET value=excluded.value, updated_by=excluded.updated_by,
+             updated_at=CURRENT_TIMESTAMP
+         RETURNING updated_at`,
+		limit.Rule, limit.Period, limit.Value, limit.UpdatedBy, tenantOf(ctx)).Scan(&limit.UpdatedAt)
+}
+
+func (r *postgresRepository) DeleteAccountLimit(ctx context.Context, rule, period string) error {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM account_limits WHERE tenant_id=$1 AND rule=$2 AND period=$3`, tenantOf(ctx), rule, period)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) UserExists(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)`, userID).Scan(&exists)
+	return exists, err
+}
+
+func (r *postgresRepository) SaveUsers(ctx context.Context, userIDs []int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO users(id) VALUES ($1) ON CONFLICT (id) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range userIDs {
+		if _, err := stmt.ExecContext(ctx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *postgresRepository) GetUserExposure(ctx context.Context, userID int) (UserExposure, error) {
+	var e UserExposure
+	err := r.db.QueryRowContext(ctx, pgUserExposure, userID, tenantOf(ctx)).Scan(&e.OpenAccounts, &e.Principal)
+	return e, err
+}
+
+func (r *postgresRepository) CreateAccountImport(ctx context.Context, imp *AccountImport, job *Job) (*AccountImport, error) {
+	rows, err := json.Marshal(imp.rows)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := r.insertJob(ctx, tx, job); err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO account_imports(job_id, status, total_rows, requested_by, rows, tenant_id)
+         VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		job.ID, imp.Status, imp.Total, imp.RequestedBy, rows, imp.tenantID).Scan(&imp.ID, &imp.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	imp.JobID = job.ID
+	return imp, nil
+}
+
+func (r *postgresRepository) GetAccountImport(ctx context.Context, id int) (*AccountImport, error) {
+	var imp AccountImport
+	err := scanAccountImport(r.readDB(ctx).QueryRowContext(ctx,
+		`SELECT `+accountImportColumns+` FROM account_imports WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`,
+		id, tenantFromContext(ctx)), &imp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+func (r *postgresRepository) StartAccountImport(ctx context.Context, jobID int) (*AccountImport, error) {
+	var imp AccountImport
+	var rows []byte
+	err := scanAccountImport(r.db.QueryRowContext(ctx,
+		`UPDATE account_imports SET status='running' WHERE job_id=$1 RETURNING `+accountImportColumns+`, rows`,
+		jobID), &imp, &rows)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(rows, &imp.rows); err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+func (r *postgresRepository) CompleteAccountImport(ctx context.Context, imp *AccountImport) error {
+	results, err := json.Marshal(imp.Results)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`UPDATE account_imports SET status=$2, processed_rows=$3, created_rows=$4, failed_rows=$5, results=$6, completed_at=$7
+         WHERE id=$1`,
+		imp.ID, imp.Status, imp.Processed, imp.Created, imp.Failed, results, imp.CompletedAt)
+	return err
+}
+
+func (r *postgresRepository) CreateEventReplay(ctx context.Context, replay *EventReplay) (*EventReplay, error) {
+	var webhookID any
+	if replay.Destination.WebhookID != 0 {
+		webhookID = replay.Destination.WebhookID
+	}
+	if err := r.db.QueryRowContext(ctx,
+		`INSERT INTO event_replays(status, destination, topic, webhook_id, from_time, to_time, account_ids, event_types,
+             last_outbox_id, requested_by)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at`,
+		replay.Status, replay.Destination.Type, replay.Destination.Topic, webhookID, replay.From, replay.To,
+		joinIDs(replay.AccountIDs), strings.Join(replay.EventTypes, ","), replay.LastOutboxID, replay.RequestedBy,
+	).Scan(&replay.ID, &replay.CreatedAt); err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+func (r *postgresRepository) GetEventReplay(ctx context.Context, id int) (*EventReplay, error) {
+	var replay EventReplay
+	err := scanEventReplay(r.readDB(ctx).QueryRowContext(ctx,
+		`SELECT `+eventReplayColumns+` FROM event_replays WHERE id=$1`, id), &replay)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+func (r *postgresRepository) ClaimEventReplay(ctx context.Context, now time.Time, lease time.Duration) (*EventReplay, error) {
+	var replay EventReplay
+	err := scanEventReplay(r.db.QueryRowContext(ctx,
+		`UPDATE event_replays SET status='running', lease_until=$2
+         WHERE id = (
+             SELECT id FROM event_replays
+             WHERE status='queued' OR (status='running' AND lease_until <= $1)
+             ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+         RETURNING `+eventReplayColumns,
+		now, now.Add(lease)), &replay)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+func (r *postgresRepository) ListReplayEvents(ctx context.Context, replay *EventReplay, limit int) ([]*OutboxEvent, error) {
+	query, args := replayEventsQuery(replay, limit, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func (r *postgresRepository) SaveEventReplay(ctx context.Context, replay *EventReplay) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE event_replays SET status=$2, last_outbox_id=$3, replayed=$4, last_error=NULLIF($5, ''), completed_at=$6,
+             lease_until=CASE WHEN $2='running' THEN lease_until END
+         WHERE id=$1`,
+		replay.ID, replay.Status, replay.LastOutboxID, replay.Replayed, replay.LastError, replay.CompletedAt)
+	return err
+}
+
+func (r *postgresRepository) QueueReplayDeliveries(ctx context.Context, replay *EventReplay, events []*OutboxEvent) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queued := 0
+	for _, e := range events {
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload)
+             SELECT id, $2::uuid, $3::text, $4::jsonb FROM webhooks
+             WHERE id=$1 AND tenant_id=$5 AND (',' || events || ',') LIKE ('%,' || $3::text || ',%')`,
+			replay.Destination.WebhookID, e.EventID, e.Type, string(e.Payload), e.TenantID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		queued += int(n)
+	}
+
+	last := events[len(events)-1].ID
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE event_replays SET last_outbox_id=$2, replayed=replayed+$3 WHERE id=$1`,
+		replay.ID, last, queued); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	replay.LastOutboxID = last
+	replay.Replayed += queued
+	return nil
+}
+
+func (r *postgresRepository) CreateApproval(ctx context.Context, a *Approval) (*Approval, error) {
+	if err := r.db.QueryRowContext(ctx,
+		`INSERT INTO approvals(action, account_id, amount, adjustment, reason, requested_by, tenant_id, value_date)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, status, created_at`,
+		a.Action, a.AccountID, a.Amount, a.Adjustment, a.Reason, a.RequestedBy,
+		tenantOf(ctx), a.ValueDate).Scan(&a.ID, &a.Status, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *postgresRepository) GetApproval(ctx context.Context, id int) (*Approval, error) {
+	var a Approval
+	err := scanApproval(r.readDB(ctx).QueryRowContext(ctx,
+		`SELECT `+approvalColumns+` FROM approvals WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`, id, tenantFromContext(ctx)), &a)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *postgresRepository) ListApprovals(ctx context.Context, status string, limit int) ([]*Approval, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+approvalColumns+` FROM approvals
+         WHERE ($1 = '' OR status = $1) AND tenant_id = COALESCE(NULLIF($3, ''), tenant_id) ORDER BY id DESC LIMIT $2`,
+		status, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanApprovals(rows)
+}
+
+func (r *postgresRepository) DecideApproval(ctx context.Context, id int, status, staffID, note string) (*Approval, error) {
+	var a Approval
+	err := scanApproval(r.db.QueryRowContext(ctx,
+		`UPDATE approvals SET status=$2, decided_by=$3, decision_note=$4, decided_at=CURRENT_TIMESTAMP
+         WHERE id=$1 AND status='pending' AND requested_by <> $3 AND tenant_id = COALESCE(NULLIF($5, ''), tenant_id) RETURNING `+approvalColumns,
+		id, status, staffID, note, tenantFromContext(ctx)), &a)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *postgresRepository) FailApproval(ctx context.Context, id int, reason string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE approvals SET status='failed', failure_reason=$2 WHERE id=$1`, id, reason)
+	return err
+}
+
+func (r *postgresRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *postgresRepository) PoolStats() sql.DBStats {
+	return r.db.Stats()
+}
+
+// insertJob stores a queued job within tx and sets its ID and CreatedAt
+func (r *postgresRepository) insertJob(ctx context.Context, tx *sql.Tx, job *Job) error {
+	return tx.QueryRowContext(ctx,
+		`INSERT INTO jobs(type, status, payload, requested_by, region, tenant_id) VALUES ($1, $2, $3, $4, $5, $6)
+         RETURNING id, created_at`,
+		job.Type, job.Status, string(job.Payload), job.RequestedBy, job.Region, tenantOf(ctx)).Scan(&job.ID, &job.CreatedAt)
+}
+
+func (r *postgresRepository) CreateJob(ctx context.Context, job *Job) (*Job, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := r.insertJob(ctx, tx, job); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *postgresRepository) GetJob(ctx context.Context, id int) (*Job, error) {
+	var job Job
+	err := scanJob(r.readDB(ctx).QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE id=$1 AND tenant_id = COALESCE(NULLIF($2, ''), tenant_id)`, id, tenantFromContext(ctx)), &job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *postgresRepository) CountPendingJobs(ctx context.Context, jobType string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM jobs WHERE type=$1 AND status IN ('queued', 'running')`, jobType).Scan(&n)
+	return n, err
+}
+
+func (r *postgresRepository) ClaimJob(ctx context.Context, now time.Time, lease time.Duration, region string, pinnedOnly bool) (*Job, error) {
+	var job Job
+	err := scanJob(r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET status='running', attempts=attempts+1, lease_until=$2, started_at=COALESCE(started_at, $1)
+         WHERE id = (
+             SELECT id FROM jobs
+             WHERE (status='queued' OR (status='running' AND lease_until <= $1))
+               AND (region = $3 OR (region = '' AND NOT $4))
+             ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+         RETURNING `+jobColumns,
+		now, now.Add(lease), region, pinnedOnly), &job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *postgresRepository) RenewJob(ctx context.Context, id int, leaseUntil time.Time) (bool, error) {
+	var cancelRequested bool
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET lease_until=$2 WHERE id=$1 AND status='running' RETURNING cancel_requested`,
+		id, leaseUntil).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return cancelRequested, err
+}
+
+func (r *postgresRepository) SaveJobProgress(ctx context.Context, id int, progress JobProgress) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE jobs SET progress_done=$2, progress_total=$3 WHERE id=$1`, id, progress.Done, progress.Total)
+	return err
+}
+
+func (r *postgresRepository) FinishJob(ctx context.Context, job *Job) error {
+	var result any
+	if job.Result != nil {
+		result = string(job.Result)
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE jobs SET status=$2, result=$3, error=NULLIF($4, ''), completed_at=$5, lease_until=NULL WHERE id=$1`,
+		job.ID, job.Status, result, job.Error, job.CompletedAt)
+	return err
+}
+
+func (r *postgresRepository) CancelJob(ctx context.Context, id int, now time.Time) (*Job, error) {
+	var job Job
+	err := scanJob(r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET
+             status=CASE WHEN status='queued' THEN 'cancelled' ELSE status END,
+             completed_at=CASE WHEN status='queued' THEN $2 ELSE completed_at END,
+             cancel_requested=TRUE
+         WHERE id=$1 AND status IN ('queued', 'running') AND tenant_id = COALESCE(NULLIF($3, ''), tenant_id)
+         RETURNING `+jobColumns,
+		id, now, tenantFromContext(ctx)), &job)
+	if err == sql.ErrNoRows {
+		existing, err := r.GetJob(ctx, id)
+		if err != nil || existing == nil {
+			return nil, err
+		}
+		return nil, ErrJobFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *postgresRepository) CreateAgreement(ctx context.Context, agreement *Agreement) (*Agreement, error) {
+	terms, err := json.Marshal(agreement.Terms)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO account_agreements(account_id, template_version, terms, sha256, document_key)
+         VALUES ($1, $2, $3, $4, NULLIF($5, '')) ON CONFLICT (account_id) DO NOTHING`,
+		agreement.AccountID, agreement.TemplateVersion, string(terms), agreement.SHA256, agreement.DocumentKey)
+	if err != nil {
+		return nil, err
+	}
+	var stored Agreement
+	err = scanAgreement(r.db.QueryRowContext(ctx,
+		`SELECT `+agreementColumns+` FROM account_agreements WHERE account_id=$1`, agreement.AccountID), &stored)
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func (r *postgresRepository) GetAgreement(ctx context.Context, accountID int) (*Agreement, error) {
+	var agreement Agreement
+	err := scanAgreement(r.db.QueryRowContext(ctx,
+		`SELECT `+agreementColumns+` FROM account_agreements WHERE account_id=$1`, accountID), &agreement)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &agreement, nil
+}
+
+func (r *postgresRepository) GetTenant(ctx context.Context, id string) (*Tenant, error) {
+	get, err := r.stmts.prepare(ctx, r.readDB(ctx), pgGetTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := get.QueryContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := scanTenants(rows)
+	if err != nil || len(tenants) == 0 {
+		return nil, err
+	}
+	return tenants[0], nil
+}
+
+func (r *postgresRepository) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	rows, err := r.readDB(ctx).QueryContext(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTenants(rows)
+}
+
+func (r *postgresRepository) CreateTenant(ctx context.Context, tenant *Tenant) (*Tenant, error) {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO tenants(id, name) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING RETURNING created_at`,
+		tenant.ID, tenant.Name).Scan(&tenant.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTenantExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+func (r *postgresRepository) ListTenantRates(ctx context.Context, tenant string) ([]*TenantRate, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+tenantRateColumns+` FROM tenant_rates WHERE tenant_id = COALESCE(NULLIF($1, ''), tenant_id)
+         ORDER BY tenant_id, period`,
+		tenant)
+	if err != nil {
+		return nil, err
+	}
+	return scanTenantRates(rows)
+}
+
+func (r *postgresRepository) SaveTenantRate(ctx context.Context, rate *TenantRate) error {
+	var updatedAt time.Time
+	if err := r.db.QueryRowContext(ctx,
+		`INSERT INTO tenant_rates(tenant_id, period, rate, updated_by)
+         VALUES ($1, $2, $3, $4)
+         ON CONFLICT (tenant_id, period) DO UPDATE SET rate=excluded.rate, updated_by=excluded.updated_by,
+             updated_at=CURRENT_TIMESTAMP
+         RETURNING updated_at`,
+		rate.TenantID, rate.Period, rate.Rate, rate.UpdatedBy).Scan(&updatedAt); err != nil {
+		return err
+	}
+	rate.UpdatedAt = &updatedAt
+	return nil
+}
+
+func (r *postgresRepository) DeleteTenantRate(ctx context.Context, tenant, period string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM tenant_rates WHERE tenant_id=$1 AND period=$2`, tenant, period)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListProductDefinitions(ctx context.Context) ([]*ProductDefinition, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+productColumns+` FROM products ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	return scanProducts(rows)
+}
+
+func (r *postgresRepository) SaveProductDefinition(ctx context.Context, product *ProductDefinition) error {
+	product.RetiredAt = nil
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO products(code, name, term_months, rate, min_principal, early_withdrawal, updated_by)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)
+         ON CONFLICT (code) DO UPDATE SET name=excluded.name, term_months=excluded.term_months, rate=excluded.rate,
+             min_principal=excluded.min_principal, early_withdrawal=excluded.early_withdrawal, retired_at=NULL,
+             updated_by=excluded.updated_by, updated_at=CURRENT_TIMESTAMP
+         RETURNING created_at, updated_at`,
+		product.Code, product.Name, product.TermMonths, product.Rate, product.MinPrincipal, product.EarlyWithdrawal,
+		product.UpdatedBy).Scan(&product.CreatedAt, &product.UpdatedAt)
+}
+
+func (r *postgresRepository) RetireProduct(ctx context.Context, code, staffID string) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE products SET retired_at=CURRENT_TIMESTAMP, updated_by=$2, updated_at=CURRENT_TIMESTAMP
+         WHERE code=$1 AND retired_at IS NULL`,
+		code, staffID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *postgresRepository) GetAccountsByExternalID(ctx context.Context, externalIDs []string) ([]*BlockAccount, error) {
+	if len(externalIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(externalIDs, 2, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts
+         WHERE external_id IN (`+in+`) AND tenant_id = COALESCE(NULLIF($1, ''), tenant_id)`,
+		append([]any{tenantFromContext(ctx)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *postgresRepository) ListFundingsOf(ctx context.Context, accountIDs []int) ([]*Funding, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+fundingColumns+` FROM account_fundings WHERE account_id IN (`+in+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanFundings(rows)
+}
+
+func (r *postgresRepository) ListInterestPayoutsOf(ctx context.Context, accountIDs []int) ([]*InterestPayout, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+interestPayoutColumns+` FROM interest_payouts WHERE account_id IN (`+in+`)
+         ORDER BY account_id, period_end`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanInterestPayouts(rows)
+}
+
+func (r *postgresRepository) ListPayoutsOf(ctx context.Context, accountIDs []int) ([]*Payout, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+payoutColumns+` FROM payouts WHERE account_id IN (`+in+`)
+         ORDER BY account_id, created_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanPayouts(rows)
+}
+
+func (r *postgresRepository) ListStatusChangesOf(ctx context.Context, accountIDs []int) ([]*StatusChange, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "$" + strconv.Itoa(n) })
+	rows, err := r.readDB(ctx).QueryContext(ctx,
+		`SELECT `+statusChangeColumns+` FROM account_status_history WHERE account_id IN (`+in+`)
+         ORDER BY account_id, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanStatusChanges(rows)
+}
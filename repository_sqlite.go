@@ -0,0 +1,3135 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqliteRepository is the SQLite Repository implementation, meant for local
+// development and tests. Timestamps are stored in UTC in SQLite's own text
+// format (_time_format=sqlite) so they compare correctly as text and work
+// with its date functions. Open the database with _txlock=immediate so
+// read-then-write transactions take the write lock up front. As in the
+// PostgreSQL implementation, active scans use a status='active' literal so the
+// partial indexes apply.
+type sqliteRepository struct {
+	db    *sql.DB
+	stmts stmtCache
+}
+
+// Hot statements, prepared once and served from the stmtCache
+const (
+	sqliteUserExposure = `SELECT COUNT(*), COALESCE(SUM(principal), 0) FROM block_accounts
+         WHERE id IN (SELECT account_id FROM account_holders WHERE user_id=?)
+             AND status IN ('active', 'pending_funding', 'frozen') AND tenant_id=?`
+	sqliteInsertAccount = `INSERT INTO block_accounts(user_id, principal, start_date, end_date, interest_rate, period, status,
+             maturity_instruction, payout_destination, payout_frequency, next_payout_date, created_at, updated_at,
+             external_id, tenant_id)
+         VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?)
+         RETURNING ` + accountColumns
+	sqliteGetAccount = `SELECT ` + accountColumns + ` FROM block_accounts
+         WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`
+	sqliteListAccountsByUser = `SELECT ` + accountColumns + ` FROM block_accounts
+         WHERE id IN (SELECT account_id FROM account_holders WHERE user_id=?) AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id) ORDER BY created_at DESC, id DESC`
+	sqliteListAccountsOverlapping = `SELECT ` + accountColumns + ` FROM block_accounts
+         WHERE user_id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id) AND start_date < ? AND end_date > ?
+         ORDER BY start_date`
+	sqliteResolveAccountID = `SELECT account_id FROM account_ids
+         WHERE external_id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`
+	sqliteGetAPIKeyByPrefix = `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix=?`
+	sqliteGetTenant         = `SELECT ` + tenantColumns + ` FROM tenants WHERE id=?`
+)
+
+// sqliteGetFunding is hot too, but built from columns that aren't constant
+var sqliteGetFunding = `SELECT ` + fundingColumns + ` FROM account_fundings WHERE account_id=?`
+
+func (r *sqliteRepository) CreateAccount(ctx context.Context, a *BlockAccount, admit func(UserExposure, *BlockAccount) error) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The transaction holds the write lock from its start, which serves as
+	// the lock on the user
+	if admit != nil {
+		var e UserExposure
+		if err := tx.QueryRowContext(ctx, sqliteUserExposure, a.UserID, a.TenantID).Scan(&e.OpenAccounts, &e.Principal); err != nil {
+			return nil, err
+		}
+		var duplicate *BlockAccount
+		if !a.duplicatesSince.IsZero() {
+			var d BlockAccount
+			err := scanAccount(tx.QueryRowContext(ctx,
+				`SELECT `+accountColumns+` FROM block_accounts
+                 WHERE user_id=?1 AND principal=?2 AND period=?3 AND created_at >= ?4 AND tenant_id=?5 AND status <> 'funding_failed'
+                 ORDER BY created_at DESC, id DESC LIMIT 1`,
+				a.UserID, roundMoney(a.Principal), a.Period, a.duplicatesSince.UTC(), a.TenantID), &d)
+			switch {
+			case err == nil:
+				duplicate = &d
+			case err != sql.ErrNoRows:
+				return nil, err
+			}
+		}
+		if err := admit(e, duplicate); err != nil {
+			return nil, err
+		}
+	}
+
+	insert, err := r.stmts.prepare(ctx, r.db, sqliteInsertAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	var account BlockAccount
+	now := time.Now().UTC()
+	err = scanAccount(tx.StmtContext(ctx, insert).QueryRowContext(ctx,
+		a.UserID, a.Principal, a.StartDate.UTC(), a.EndDate.UTC(), a.InterestRate, a.Period, a.Status,
+		a.MaturityInstruction, a.PayoutDestination, a.PayoutFrequency, utcOrNil(a.NextPayoutDate), now, now,
+		a.ExternalID, a.TenantID), &account)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.insertAccountID(ctx, tx, &account); err != nil {
+		return nil, err
+	}
+	if err := r.insertIdempotencyKey(ctx, tx, a, account.ID, now); err != nil {
+		return nil, err
+	}
+	if err := r.insertHolders(ctx, tx, &account, 0); err != nil {
+		return nil, err
+	}
+	if err := r.insertStatusChange(ctx, tx, &StatusChange{AccountID: account.ID, To: account.Status, Principal: account.Principal, Note: a.bookingNote, ChangedAt: now}); err != nil {
+		return nil, err
+	}
+	if a.Funding != nil {
+		var f Funding
+		err = scanFunding(tx.QueryRowContext(ctx,
+			`INSERT INTO account_fundings(account_id, settlement_account, reference, amount, status, created_at, updated_at)
+             VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING `+fundingColumns,
+			account.ID, a.Funding.SettlementAccount, a.Funding.Reference, a.Funding.Amount, a.Funding.Status, now, now), &f)
+		if err != nil {
+			return nil, err
+		}
+		account.Funding = &f
+	}
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountCreated, &account)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// insertIdempotencyKey stores a's idempotency key for the account with id.
+// A key stored within idempotencyKeyTTL is kept and errIdempotencyKeyTaken
+// returned.
+func (r *sqliteRepository) insertIdempotencyKey(ctx context.Context, tx *sql.Tx, a *BlockAccount, id int, now time.Time) error {
+	if a.idempotencyKey == "" {
+		return nil
+	}
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO idempotency_keys(tenant_id, idempotency_key, fingerprint, account_id, created_at)
+         VALUES (?1, ?2, ?3, ?4, ?5)
+         ON CONFLICT (tenant_id, idempotency_key) DO UPDATE
+             SET fingerprint=excluded.fingerprint, account_id=excluded.account_id, created_at=excluded.created_at
+             WHERE idempotency_keys.created_at < ?6`,
+		a.TenantID, a.idempotencyKey, a.fingerprint, id, now, now.Add(-idempotencyKeyTTL))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errIdempotencyKeyTaken
+	}
+	return nil
+}
+
+func (r *sqliteRepository) FindIdempotentCreate(ctx context.Context, key string, since time.Time) (int, string, error) {
+	var accountID int
+	var fingerprint string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT account_id, fingerprint FROM idempotency_keys WHERE tenant_id=? AND idempotency_key=? AND created_at >= ?`,
+		tenantOf(ctx), key, since.UTC()).Scan(&accountID, &fingerprint)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return accountID, fingerprint, err
+}
+
+func (r *sqliteRepository) CreateAccounts(ctx context.Context, accounts []*BlockAccount, record func([]*BlockAccount) *AccountImport) ([]*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx,
+		`INSERT INTO block_accounts(user_id, principal, start_date, end_date, interest_rate, period, status,
+             maturity_instruction, payout_destination, payout_frequency, next_payout_date, interest_paid_through,
+             created_at, updated_at, external_id, tenant_id)
+         VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?)
+         RETURNING `+accountColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer insert.Close()
+
+	now := time.Now().UTC()
+	stored := make([]*BlockAccount, len(accounts))
+	for i, a := range accounts {
+		var account BlockAccount
+		err := scanAccount(insert.QueryRowContext(ctx,
+			a.UserID, a.Principal, a.StartDate.UTC(), a.EndDate.UTC(), a.InterestRate, a.Period, a.Status,
+			a.MaturityInstruction, a.PayoutDestination, a.PayoutFrequency, utcOrNil(a.NextPayoutDate),
+			utcOrNil(a.InterestPaidThrough), now, now, a.ExternalID, a.TenantID), &account)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.insertAccountID(ctx, tx, &account); err != nil {
+			return nil, err
+		}
+		if err := r.insertHolders(ctx, tx, &account, 0); err != nil {
+			return nil, err
+		}
+		if err := r.insertStatusChange(ctx, tx, &StatusChange{AccountID: account.ID, To: account.Status, Principal: account.Principal, Note: "imported", ChangedAt: now}); err != nil {
+			return nil, err
+		}
+		if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountCreated, &account)); err != nil {
+			return nil, err
+		}
+		stored[i] = &account
+	}
+	if imp := record(stored); imp != nil {
+		results, err := json.Marshal(imp.Results)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE account_imports SET processed_rows=?, created_rows=?, failed_rows=?, results=? WHERE id=?`,
+			imp.Processed, imp.Created, imp.Failed, results, imp.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := commit(ctx, tx); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+func (r *sqliteRepository) GetAccount(ctx context.Context, id int) (*BlockAccount, error) {
+	get, err := r.stmts.prepare(ctx, r.db, sqliteGetAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	var account BlockAccount
+	err = scanAccount(get.QueryRowContext(ctx, id, tenantFromContext(ctx)), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *sqliteRepository) ListAccountsByUser(ctx context.Context, userID int) ([]*BlockAccount, error) {
+	list, err := r.stmts.prepare(ctx, r.db, sqliteListAccountsByUser)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := list.QueryContext(ctx, userID, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *sqliteRepository) ListAccountsOverlapping(ctx context.Context, userID int, from, to time.Time) ([]*BlockAccount, error) {
+	list, err := r.stmts.prepare(ctx, r.db, sqliteListAccountsOverlapping)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := list.QueryContext(ctx, userID, tenantFromContext(ctx), to.UTC(), from.UTC())
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *sqliteRepository) ListMaturingBetween(ctx context.Context, from, to time.Time, limit int) ([]*BlockAccount, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts
+         WHERE status='active' AND end_date > ? AND end_date <= ? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)
+         ORDER BY end_date LIMIT ?`,
+		from.UTC(), to.UTC(), tenantFromContext(ctx), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *sqliteRepository) ListAccountsUpdatedAfter(ctx context.Context, updatedAt time.Time, id, limit int) ([]*BlockAccount, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts
+         WHERE (updated_at, id) > (?, ?) AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)
+         ORDER BY updated_at, id LIMIT ?`,
+		updatedAt.UTC(), id, tenantFromContext(ctx), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *sqliteRepository) ListAccountsAfter(ctx context.Context, afterID int, statuses []string, limit int) ([]*BlockAccount, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	in, args := inList(statuses, 4, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts
+         WHERE id > ?1 AND status IN (`+in+`) AND tenant_id = COALESCE(NULLIF(?3, ''), tenant_id)
+         ORDER BY id LIMIT ?2`,
+		append([]any{afterID, limit, tenantFromContext(ctx)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *sqliteRepository) DeleteAccount(ctx context.Context, id int, check func(*BlockAccount) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	if check != nil {
+		err = scanAccount(tx.QueryRowContext(ctx,
+			`SELECT `+accountColumns+` FROM block_accounts WHERE id=?`, id), &account)
+		if err != nil {
+			return err
+		}
+		if err := check(&account); err != nil {
+			return err
+		}
+	}
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`DELETE FROM block_accounts WHERE id=? RETURNING `+accountColumns, id), &account)
+	if err != nil {
+		return err
+	}
+	closed := &StatusChange{AccountID: account.ID, From: account.Status, To: StatusClosed, Principal: account.Principal, ChangedAt: time.Now().UTC()}
+	if err := r.insertStatusChange(ctx, tx, closed); err != nil {
+		return err
+	}
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountClosed, &account)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) BeginClosure(ctx context.Context, id int, plan func(*BlockAccount) (*AccountClosure, error)) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=?`, id), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	closure, err := plan(&account)
+	if err != nil {
+		return nil, err
+	}
+
+	from, now := account.Status, time.Now().UTC()
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=?, updated_at=? WHERE id=? RETURNING `+accountColumns,
+		StatusClosing, now, id), &account)
+	if err != nil {
+		return nil, err
+	}
+	err = scanClosure(tx.QueryRowContext(ctx,
+		`INSERT INTO account_closures(account_id, destination_account, method, amount, requested_at)
+         VALUES (?, ?, ?, ?, ?) RETURNING `+closureColumns,
+		id, closure.DestinationAccount, closure.Method, closure.Amount, closure.RequestedAt.UTC()), closure)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO payouts(account_id, destination_account, amount, status, created_at, updated_at)
+         VALUES (?, ?, ?, ?, ?, ?)`,
+		id, closure.DestinationAccount, closure.Amount, PayoutPending, now, now); err != nil {
+		return nil, err
+	}
+	closing := &StatusChange{AccountID: id, From: from, To: StatusClosing, Principal: account.Principal, Note: "closed by " + closure.Method, ChangedAt: now}
+	if err := r.insertStatusChange(ctx, tx, closing); err != nil {
+		return nil, err
+	}
+	if err := r.insertOutbox(ctx, tx, newStatusChangedEvent(&account, from)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	account.Closure = closure
+	return &account, nil
+}
+
+func (r *sqliteRepository) GetClosure(ctx context.Context, accountID int) (*AccountClosure, error) {
+	var c AccountClosure
+	err := scanClosure(r.db.QueryRowContext(ctx,
+		`SELECT `+closureColumns+` FROM account_closures WHERE account_id=?`, accountID), &c)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *sqliteRepository) GetFunding(ctx context.Context, accountID int) (*Funding, error) {
+	get, err := r.stmts.prepare(ctx, r.db, sqliteGetFunding)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Funding
+	err = scanFunding(get.QueryRowContext(ctx, accountID), &f)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *sqliteRepository) ListPendingFundings(ctx context.Context, afterAccountID, limit int) ([]*Funding, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+fundingColumns+` FROM account_fundings WHERE status='pending' AND account_id > ?
+         ORDER BY account_id LIMIT ?`,
+		afterAccountID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanFundings(rows)
+}
+
+func (r *sqliteRepository) SettleFunding(ctx context.Context, accountID int, plan func(*BlockAccount) (*FundingOutcome, error)) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=? AND status='pending_funding'`,
+		accountID), &account)
+	if err != nil {
+		return nil, err
+	}
+	outcome, err := plan(&account)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var f Funding
+	err = scanFunding(tx.QueryRowContext(ctx,
+		`UPDATE account_fundings SET status=?, failure_reason=?, settled_at=?, updated_at=?
+         WHERE account_id=? AND status='pending' RETURNING `+fundingColumns,
+		outcome.Status, outcome.Reason, now, now, accountID), &f)
+	if err != nil {
+		return nil, err
+	}
+	if outcome.Status == FundingConfirmed {
+		err = scanAccount(tx.QueryRowContext(ctx,
+			`UPDATE block_accounts SET status='active', start_date=?, end_date=?, next_payout_date=?, updated_at=?
+             WHERE id=? RETURNING `+accountColumns,
+			outcome.StartDate.UTC(), outcome.EndDate.UTC(), utcOrNil(outcome.NextPayoutDate), now, accountID), &account)
+	} else {
+		err = scanAccount(tx.QueryRowContext(ctx,
+			`UPDATE block_accounts SET status='funding_failed', updated_at=? WHERE id=? RETURNING `+accountColumns,
+			now, accountID), &account)
+	}
+	if err != nil {
+		return nil, err
+	}
+	settled := &StatusChange{AccountID: account.ID, From: StatusPendingFunding, To: account.Status, Principal: account.Principal, Note: outcome.Reason, ChangedAt: now}
+	if err := r.insertStatusChange(ctx, tx, settled); err != nil {
+		return nil, err
+	}
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(fundingEvent(outcome.Status), &account)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	account.Funding = &f
+	return &account, nil
+}
+
+func (r *sqliteRepository) UpdateAccountStatus(ctx context.Context, id int, status string, check func(*BlockAccount) error) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=?`, id), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := check(&account); err != nil {
+		return nil, err
+	}
+
+	from, now := account.Status, time.Now().UTC()
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=?, updated_at=? WHERE id=? RETURNING `+accountColumns,
+		status, now, id), &account)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.insertStatusChange(ctx, tx, &StatusChange{AccountID: id, From: from, To: status, Principal: account.Principal, ChangedAt: now}); err != nil {
+		return nil, err
+	}
+	if err := r.insertOutbox(ctx, tx, newStatusChangedEvent(&account, from)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *sqliteRepository) UpdateMaturityInstruction(ctx context.Context, id int, instruction, destination string, check func(*BlockAccount) error) (*BlockAccount, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=?`, id), &account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := check(&account); err != nil {
+		return nil, err
+	}
+
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET maturity_instruction=?, payout_destination=NULLIF(?, ''), updated_at=?
+         WHERE id=? RETURNING `+accountColumns,
+		instruction, destination, time.Now().UTC(), id), &account)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *sqliteRepository) MatureDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*MaturityOutcome, error)) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+accountColumns+`
+         FROM block_accounts WHERE status='active' AND end_date <= ?
+         ORDER BY end_date LIMIT ?`,
+		now.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+	due, err := scanAccounts(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	updatedAt := time.Now().UTC()
+	matured := 0
+	for _, a := range due {
+		ok, err := r.matureAccount(ctx, tx, a, plan, updatedAt)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			matured++
+		}
+	}
+
+	if err := commit(ctx, tx); err != nil {
+		return 0, err
+	}
+	return matured, nil
+}
+
+// MatureAccount matures one account, as MatureDue does, if it is active and
+// due at now
+func (r *sqliteRepository) MatureAccount(ctx context.Context, id int, now time.Time, plan func(*BlockAccount) (*MaturityOutcome, error)) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var a BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=? AND status='active' AND end_date <= ?`,
+		id, now.UTC()), &a)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	ok, err := r.matureAccount(ctx, tx, &a, plan, time.Now().UTC())
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, commit(ctx, tx)
+}
+
+// matureAccount carries out plan's outcome for a within tx. It reports
+// false when a was no longer active.
+func (r *sqliteRepository) matureAccount(ctx context.Context, tx *sql.Tx, a *BlockAccount, plan func(*BlockAccount) (*MaturityOutcome, error), updatedAt time.Time) (bool, error) {
+	outcome, err := plan(a)
+	if err != nil {
+		return false, err
+	}
+	// Only the worker that moves the account out of active matures it;
+	// the payout is also unique per account and maturity date
+	res, err := tx.ExecContext(ctx,
+		`UPDATE block_accounts SET status=?, updated_at=? WHERE id=? AND status='active'`,
+		outcome.Status, updatedAt, a.ID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		return false, nil
+	}
+	if outcome.Rollover != nil {
+		n := outcome.Rollover
+		if err := tx.QueryRowContext(ctx,
+			`INSERT INTO block_accounts(user_id, principal, start_date, end_date, interest_rate, period, status,
+                     maturity_instruction, payout_destination, payout_frequency, next_payout_date, created_at, updated_at,
+                     external_id, tenant_id)
+                 VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?)
+                 RETURNING id`,
+			n.UserID, n.Principal, n.StartDate.UTC(), n.EndDate.UTC(), n.InterestRate, n.Period, n.Status,
+			n.MaturityInstruction, n.PayoutDestination, n.PayoutFrequency, utcOrNil(n.NextPayoutDate),
+			updatedAt, updatedAt, n.ExternalID, n.TenantID).Scan(&n.ID); err != nil {
+			return false, err
+		}
+		if err := r.insertAccountID(ctx, tx, n); err != nil {
+			return false, err
+		}
+		if err := r.insertHolders(ctx, tx, n, a.ID); err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO account_beneficiaries(account_id, position, name, relationship, allocation_percent, designated_by, created_at)
+                 SELECT ?, position, name, relationship, allocation_percent, designated_by, created_at
+                 FROM account_beneficiaries WHERE account_id=?`, n.ID, a.ID); err != nil {
+			return false, err
+		}
+		opened := &StatusChange{AccountID: n.ID, To: n.Status, Principal: n.Principal, Note: "rollover of " + a.ExternalID, ChangedAt: updatedAt}
+		if err := r.insertStatusChange(ctx, tx, opened); err != nil {
+			return false, err
+		}
+		if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountCreated, n)); err != nil {
+			return false, err
+		}
+	}
+	if outcome.Payout != nil {
+		p := outcome.Payout
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO payouts(account_id, destination_account, amount, status, maturity_date, created_at, updated_at)
+                 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			a.ID, p.Destination, p.Amount, p.Status, a.EndDate.UTC(), updatedAt, updatedAt); err != nil {
+			return false, err
+		}
+	}
+	if err := r.insertStatusChange(ctx, tx, maturedChange(a, outcome, updatedAt)); err != nil {
+		return false, err
+	}
+	a.Status = outcome.Status
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountMatured, a)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *sqliteRepository) PayInterestDue(ctx context.Context, now time.Time, limit int, plan func(*BlockAccount) (*InterestOutcome, error)) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+accountColumns+`
+         FROM block_accounts WHERE status='active' AND next_payout_date <= ?
+         ORDER BY next_payout_date LIMIT ?`,
+		now.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+	due, err := scanAccounts(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	updatedAt := time.Now().UTC()
+	paid := 0
+	for _, a := range due {
+		outcome, err := plan(a)
+		if err != nil {
+			return 0, err
+		}
+		// Interest is paid once per account and period end; a period
+		// another worker already paid is skipped
+		p := outcome.Payout
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO interest_payouts(account_id, destination_account, period_start, period_end, amount, status, created_at)
+             VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (account_id, period_end) DO NOTHING`,
+			a.ID, p.Destination, p.PeriodStart.UTC(), p.PeriodEnd.UTC(), p.Amount, p.Status, updatedAt)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return 0, err
+		} else if n == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE block_accounts SET interest_paid_through=?, next_payout_date=?, updated_at=? WHERE id=?`,
+			p.PeriodEnd.UTC(), utcOrNil(outcome.NextPayoutDate), updatedAt, a.ID); err != nil {
+			return 0, err
+		}
+		if err := r.insertOutbox(ctx, tx, newInterestPaidEvent(a, p)); err != nil {
+			return 0, err
+		}
+		paid++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return paid, nil
+}
+
+func (r *sqliteRepository) ListInterestPayouts(ctx context.Context, accountID int) ([]*InterestPayout, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+interestPayoutColumns+` FROM interest_payouts WHERE account_id=? ORDER BY period_end`,
+		accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanInterestPayouts(rows)
+}
+
+func (r *sqliteRepository) AdjustInterest(ctx context.Context, accountID int, plan func(*BlockAccount, []*InterestPayout, []*InterestAdjustment) (*InterestAdjustment, error)) (*BlockAccount, *InterestAdjustment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts WHERE id=?`, accountID), &account)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+interestPayoutColumns+` FROM interest_payouts WHERE account_id=? ORDER BY period_end`, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	paid, err := scanInterestPayouts(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err = tx.QueryContext(ctx,
+		`SELECT `+interestAdjustmentColumns+` FROM interest_adjustments WHERE account_id=? ORDER BY id`, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+	prior, err := scanInterestAdjustments(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	adj, err := plan(&account, paid, prior)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET interest_rate=?, interest_adjustment=interest_adjustment+?, updated_at=?
+         WHERE id=? RETURNING `+accountColumns,
+		adj.Rate, adj.Amount, now, accountID), &account)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = scanInterestAdjustment(tx.QueryRowContext(ctx,
+		`INSERT INTO interest_adjustments(account_id, kind, amount, previous_rate, rate, reason, approval_id,
+             requested_by, approved_by, created_at, value_date)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING `+interestAdjustmentColumns,
+		accountID, adj.Kind, adj.Amount, adj.PreviousRate, adj.Rate, adj.Reason, adj.ApprovalID,
+		adj.RequestedBy, adj.ApprovedBy, now, utcOrNil(adj.ValueDate)), adj)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := commit(ctx, tx); err != nil {
+		return nil, nil, err
+	}
+	return &account, adj, nil
+}
+
+func (r *sqliteRepository) ListInterestAdjustments(ctx context.Context, accountID int) ([]*InterestAdjustment, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+interestAdjustmentColumns+` FROM interest_adjustments WHERE account_id=? ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanInterestAdjustments(rows)
+}
+
+func (r *sqliteRepository) ListInterestAdjustmentsOf(ctx context.Context, accountIDs []int) ([]*InterestAdjustment, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+interestAdjustmentColumns+` FROM interest_adjustments WHERE account_id IN (`+in+`)
+         ORDER BY account_id, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanInterestAdjustments(rows)
+}
+
+func (r *sqliteRepository) ListPayouts(ctx context.Context, accountID int) ([]*Payout, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+payoutColumns+` FROM payouts WHERE account_id=? ORDER BY created_at, id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPayouts(rows)
+}
+
+func (r *sqliteRepository) ConfirmPayout(ctx context.Context, accountID int) (*Payout, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// An account may have paid out before, so only its pending payout moves
+	var payoutID int
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM payouts WHERE account_id=? AND status=? ORDER BY created_at DESC, id DESC LIMIT 1`,
+		accountID, PayoutPending).Scan(&payoutID)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now().UTC()
+	var payout Payout
+	err = scanPayout(tx.QueryRowContext(ctx,
+		`UPDATE payouts SET status=?, updated_at=? WHERE id=?
+         RETURNING `+payoutColumns,
+		PayoutSent, now, payoutID), &payout)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The final payout of a closing account closes it
+	var account BlockAccount
+	err = scanAccount(tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=?, updated_at=? WHERE id=? AND status=? RETURNING `+accountColumns,
+		StatusClosed, now, accountID, StatusClosing), &account)
+	if err == sql.ErrNoRows {
+		return &payout, false, tx.Commit()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE account_closures SET closed_at=? WHERE account_id=?`, now, accountID); err != nil {
+		return nil, false, err
+	}
+	closed := &StatusChange{AccountID: accountID, From: StatusClosing, To: StatusClosed, Principal: account.Principal, Note: "final payout sent", ChangedAt: now}
+	if err := r.insertStatusChange(ctx, tx, closed); err != nil {
+		return nil, false, err
+	}
+	if err := r.insertOutbox(ctx, tx, newAccountEvent(EventAccountClosed, &account)); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return &payout, true, nil
+}
+
+func (r *sqliteRepository) FailPayout(ctx context.Context, accountID int, reason string) (*Payout, int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var payoutID int
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM payouts WHERE account_id=? AND status IN ('pending', 'sent')
+         ORDER BY created_at DESC, id DESC LIMIT 1`,
+		accountID).Scan(&payoutID)
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now().UTC()
+	var payout Payout
+	err = scanPayout(tx.QueryRowContext(ctx,
+		`UPDATE payouts SET status=?, failure_reason=?, updated_at=? WHERE id=?
+         RETURNING `+payoutColumns,
+		PayoutFailed, reason, now, payoutID), &payout)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := r.recordStatus(ctx, tx, accountID, StatusPayoutFailed, reason, now); err != nil {
+		return nil, 0, err
+	}
+
+	var userID int
+	err = tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=?, updated_at=? WHERE id=? RETURNING user_id`,
+		StatusPayoutFailed, now, accountID).Scan(&userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return &payout, userID, nil
+}
+
+func (r *sqliteRepository) RetryPayout(ctx context.Context, accountID int, destination string) (*Payout, int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var payoutID int
+	var status string
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, status FROM payouts WHERE account_id=? ORDER BY created_at DESC, id DESC LIMIT 1`,
+		accountID).Scan(&payoutID, &status)
+	if err != nil {
+		return nil, 0, err
+	}
+	if status != PayoutFailed {
+		return nil, 0, ErrPayoutNotFailed
+	}
+
+	now := time.Now().UTC()
+	var payout Payout
+	err = scanPayout(tx.QueryRowContext(ctx,
+		`UPDATE payouts SET status=?, failure_reason=NULL, attempts=attempts+1,
+             destination_account=COALESCE(NULLIF(?, ''), destination_account), updated_at=?
+         WHERE id=?
+         RETURNING `+payoutColumns,
+		PayoutPending, destination, now, payoutID), &payout)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A closing account whose final payout failed goes back to closing
+	var closing bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM account_closures WHERE account_id=?)`, accountID).Scan(&closing)
+	if err != nil {
+		return nil, 0, err
+	}
+	to := StatusMatured
+	if closing {
+		to = StatusClosing
+	}
+	if err := r.recordStatus(ctx, tx, accountID, to, "payout retried", now); err != nil {
+		return nil, 0, err
+	}
+
+	var userID int
+	err = tx.QueryRowContext(ctx,
+		`UPDATE block_accounts SET status=?, updated_at=? WHERE id=? RETURNING user_id`,
+		to, now, accountID).Scan(&userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return &payout, userID, nil
+}
+
+func (r *sqliteRepository) RecordCommunication(ctx context.Context, c *Communication) error {
+	c.CreatedAt = time.Now().UTC()
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO communications(account_id, user_id, kind, event, subject, message, status, priority,
+             created_at, next_attempt_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		c.AccountID, c.UserID, c.Kind, c.Event, c.Subject, c.Message, c.Status, c.Priority,
+		c.CreatedAt, c.CreatedAt).Scan(&c.ID)
+}
+
+func (r *sqliteRepository) ListCommunications(ctx context.Context, accountID int) ([]*Communication, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+communicationColumns+` FROM communications WHERE account_id=? ORDER BY created_at, id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanCommunications(rows)
+}
+
+func (r *sqliteRepository) ClaimNotifications(ctx context.Context, priority string, now time.Time, lease time.Duration, limit int) ([]*Communication, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`UPDATE communications SET next_attempt_at=?
+         WHERE id IN (
+             SELECT id FROM communications
+             WHERE status='pending' AND priority=? AND next_attempt_at <= ?
+             ORDER BY next_attempt_at, id LIMIT ?)
+         RETURNING `+communicationColumns,
+		now.Add(lease).UTC(), priority, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanCommunications(rows)
+}
+
+func (r *sqliteRepository) UpdateCommunicationStatus(ctx context.Context, id int, status, lastError string) error {
+	var sentAt *time.Time
+	if status == DeliverySent {
+		now := time.Now().UTC()
+		sentAt = &now
+	}
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE communications SET status=?, last_error=NULLIF(?, ''), sent_at=? WHERE id=?`,
+		status, lastError, sentAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) QueueNotifications(ctx context.Context, comms []*Communication, consumer string, cursor int64) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	queued := 0
+	for _, c := range comms {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO communications(account_id, user_id, kind, event, subject, message, status, priority,
+                 channel, dedup_key, created_at, next_attempt_at)
+             VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+             ON CONFLICT (dedup_key, channel) WHERE dedup_key IS NOT NULL DO NOTHING
+             RETURNING id`,
+			c.AccountID, c.UserID, c.Kind, c.Event, c.Subject, c.Message, c.Status, c.Priority,
+			c.Channel, c.DedupKey, now, now).Scan(&c.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.CreatedAt = now
+		queued++
+	}
+
+	if consumer != "" {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO event_cursors(consumer, last_outbox_id, updated_at) VALUES (?1, ?2, ?3)
+             ON CONFLICT (consumer) DO UPDATE SET last_outbox_id=excluded.last_outbox_id, updated_at=excluded.updated_at
+             WHERE event_cursors.last_outbox_id < excluded.last_outbox_id`,
+			consumer, cursor, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return queued, nil
+}
+
+func (r *sqliteRepository) EventCursor(ctx context.Context, consumer string) (int64, error) {
+	var cursor int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT last_outbox_id FROM event_cursors WHERE consumer=?`, consumer).Scan(&cursor)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return cursor, err
+}
+
+func (r *sqliteRepository) ListOutboxAfter(ctx context.Context, afterID int64, before time.Time, limit int) ([]*OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox WHERE id > ? AND created_at < ? ORDER BY id LIMIT ?`,
+		afterID, before.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func (r *sqliteRepository) LastOutboxID(ctx context.Context, before time.Time) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(id), 0) FROM outbox WHERE created_at < ?`, before.UTC()).Scan(&id)
+	return id, err
+}
+
+func (r *sqliteRepository) ListUserOutboxAfter(ctx context.Context, userID int, afterID, throughID int64, limit int) ([]*OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox
+         WHERE tenant_id=? AND user_id=? AND id > ? AND id <= ? ORDER BY id LIMIT ?`,
+		tenantOf(ctx), userID, afterID, throughID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func (r *sqliteRepository) ListEventLog(ctx context.Context, afterID int64, accountKey, eventType string, limit int) ([]*OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox
+         WHERE id > ?1 AND (?2 = '' OR aggregate_key = ?2) AND (?3 = '' OR event_type = ?3) ORDER BY id LIMIT ?4`,
+		afterID, accountKey, eventType, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func (r *sqliteRepository) RewindEventCursor(ctx context.Context, consumer string, cursor int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO event_cursors(consumer, last_outbox_id, updated_at) VALUES (?1, ?2, ?3)
+         ON CONFLICT (consumer) DO UPDATE SET last_outbox_id=excluded.last_outbox_id, updated_at=excluded.updated_at
+         WHERE event_cursors.last_outbox_id > excluded.last_outbox_id`,
+		consumer, cursor, time.Now().UTC())
+	return err
+}
+
+func (r *sqliteRepository) ListDueMaturityReminders(ctx context.Context, now time.Time, defaultDays, limit int) ([]*BlockAccount, error) {
+	rows, err := r.db.QueryContext(ctx,
+		dueMaturityRemindersQuery(`julianday(end_date) <= julianday(%s) + %s`, "?1", "?2", "?3"),
+		now.UTC(), defaultDays, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *sqliteRepository) GetNotificationPreferences(ctx context.Context, userID int) (*NotificationPreferences, error) {
+	return scanNotificationPreferences(r.db.QueryRowContext(ctx,
+		`SELECT `+notificationPreferencesColumns+` FROM notification_preferences WHERE tenant_id=? AND user_id=?`,
+		tenantOf(ctx), userID))
+}
+
+func (r *sqliteRepository) SaveNotificationPreferences(ctx context.Context, p *NotificationPreferences) (*NotificationPreferences, error) {
+	return scanNotificationPreferences(r.db.QueryRowContext(ctx,
+		`INSERT INTO notification_preferences(user_id, channels, email, phone, reminder_days, disabled_events, locale, updated_at, tenant_id)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+         ON CONFLICT (tenant_id, user_id) DO UPDATE SET channels=excluded.channels, email=excluded.email, phone=excluded.phone,
+             reminder_days=excluded.reminder_days, disabled_events=excluded.disabled_events, locale=excluded.locale,
+             updated_at=excluded.updated_at
+         RETURNING `+notificationPreferencesColumns,
+		p.UserID, strings.Join(p.Channels, ","), p.Email, p.Phone, p.ReminderDays, strings.Join(p.DisabledEvents, ","),
+		p.Locale, time.Now().UTC(), tenantOf(ctx)))
+}
+
+func (r *sqliteRepository) MuteNotifications(ctx context.Context, m *NotificationMute, now time.Time) (*NotificationMute, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE notification_mutes SET ended_at=?2, ended_by=?3
+         WHERE account_id=?1 AND ended_at IS NULL AND muted_until > ?2`,
+		m.AccountID, now.UTC(), m.MutedBy); err != nil {
+		return nil, err
+	}
+	var mute NotificationMute
+	if err := scanNotificationMute(tx.QueryRowContext(ctx,
+		`INSERT INTO notification_mutes(account_id, muted_until, reason, muted_by, created_at) VALUES (?, ?, ?, ?, ?)
+         RETURNING `+notificationMuteColumns,
+		m.AccountID, m.MutedUntil.UTC(), m.Reason, m.MutedBy, now.UTC()), &mute); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &mute, nil
+}
+
+func (r *sqliteRepository) UnmuteNotifications(ctx context.Context, accountID int, now time.Time, endedBy string) (*NotificationMute, error) {
+	var mute NotificationMute
+	err := scanNotificationMute(r.db.QueryRowContext(ctx,
+		`UPDATE notification_mutes SET ended_at=?2, ended_by=?3
+         WHERE account_id=?1 AND ended_at IS NULL AND muted_until > ?2
+         RETURNING `+notificationMuteColumns,
+		accountID, now.UTC(), endedBy), &mute)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mute, nil
+}
+
+func (r *sqliteRepository) ActiveNotificationMute(ctx context.Context, accountID int, now time.Time) (*NotificationMute, error) {
+	var mute NotificationMute
+	err := scanNotificationMute(r.db.QueryRowContext(ctx,
+		`SELECT `+notificationMuteColumns+` FROM notification_mutes
+         WHERE account_id=? AND ended_at IS NULL AND muted_until > ?
+         ORDER BY id DESC LIMIT 1`,
+		accountID, now.UTC()), &mute)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mute, nil
+}
+
+func (r *sqliteRepository) ListNotificationMutes(ctx context.Context, accountID int) ([]*NotificationMute, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+notificationMuteColumns+` FROM notification_mutes WHERE account_id=? ORDER BY id DESC`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotificationMutes(rows)
+}
+
+func (r *sqliteRepository) ListAccountHolders(ctx context.Context, accountID int) ([]*AccountHolder, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+accountHolderColumns+` FROM account_holders WHERE account_id=?
+         ORDER BY role='secondary', created_at, user_id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountHolders(rows)
+}
+
+func (r *sqliteRepository) AddAccountHolder(ctx context.Context, h *AccountHolder) error {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO account_holders(account_id, user_id, role, added_by, created_at) VALUES (?, ?, ?, ?, ?)
+         ON CONFLICT (account_id, user_id) DO NOTHING RETURNING created_at`,
+		h.AccountID, h.UserID, h.Role, h.AddedBy, time.Now().UTC()).Scan(&h.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrAlreadyHolder
+	}
+	return err
+}
+
+func (r *sqliteRepository) RemoveAccountHolder(ctx context.Context, accountID, userID int) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM account_holders WHERE account_id=? AND user_id=? AND role='secondary'`, accountID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) ListSecondaryHolderIDs(ctx context.Context, accountIDs []int) ([]int, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT DISTINCT user_id FROM account_holders WHERE account_id IN (`+in+`) AND role='secondary'`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func (r *sqliteRepository) ListBeneficiaries(ctx context.Context, accountIDs []int) ([]*Beneficiary, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+beneficiaryColumns+` FROM account_beneficiaries WHERE account_id IN (`+in+`)
+         ORDER BY account_id, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBeneficiaries(rows)
+}
+
+func (r *sqliteRepository) ReplaceBeneficiaries(ctx context.Context, accountID int, beneficiaries []*Beneficiary) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM account_beneficiaries WHERE account_id=?`, accountID); err != nil {
+		return err
+	}
+	for i, b := range beneficiaries {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO account_beneficiaries(account_id, position, name, relationship, allocation_percent, designated_by, created_at)
+             VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			accountID, i+1, b.Name, b.Relationship, b.AllocationPercent, b.DesignatedBy, b.DesignatedAt.UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) ListArchivable(ctx context.Context, status string, closedBefore time.Time, limit int) ([]int, error) {
+	query := `SELECT id FROM block_accounts WHERE status=? AND updated_at < ? ORDER BY id LIMIT ?`
+	if status == StatusClosed {
+		query = `SELECT DISTINCT account_id FROM account_status_history
+         WHERE to_status=? AND changed_at < ? ORDER BY account_id LIMIT ?`
+	}
+	rows, err := r.db.QueryContext(ctx, query, status, closedBefore.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func (r *sqliteRepository) ArchiveAccount(ctx context.Context, a *ArchivedAccount) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Deleting the account takes its payouts, funding, closure, holders and
+	// beneficiaries with it. A closed account staff deleted has none left.
+	result, err := tx.ExecContext(ctx, `DELETE FROM block_accounts WHERE id=?1 AND status=?2`, a.AccountID, a.Status)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		deleted := false
+		if a.Status == StatusClosed {
+			err = tx.QueryRowContext(ctx,
+				`SELECT EXISTS (SELECT 1 FROM account_status_history WHERE account_id=?1 AND to_status=?2)
+                 AND NOT EXISTS (SELECT 1 FROM block_accounts WHERE id=?1)`, a.AccountID, a.Status).Scan(&deleted)
+			if err != nil {
+				return err
+			}
+		}
+		if !deleted {
+			return sql.ErrNoRows
+		}
+	}
+	for _, table := range []string{"account_status_history", "interest_adjustments"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE account_id=?`, a.AccountID); err != nil {
+			return err
+		}
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO archived_accounts(account_id, external_id, tenant_id, status, closed_at, archived_at, record)
+         SELECT account_id, external_id, tenant_id, ?2, ?3, ?4, ?5 FROM account_ids WHERE account_id=?1
+         RETURNING external_id, tenant_id`,
+		a.AccountID, a.Status, a.ClosedAt.UTC(), a.ArchivedAt.UTC(), string(a.Record)).Scan(&a.ExternalID, &a.TenantID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) GetArchivedAccount(ctx context.Context, accountID int) (*ArchivedAccount, error) {
+	return scanArchivedAccount(r.db.QueryRowContext(ctx,
+		`SELECT `+archivedAccountColumns+` FROM archived_accounts
+         WHERE account_id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`, accountID, tenantFromContext(ctx)))
+}
+
+func (r *sqliteRepository) RewriteSensitiveFields(ctx context.Context, rewrite func(ctx context.Context, field, value string) (string, error)) (int, error) {
+	return rewriteSensitiveFields(ctx, r.db, func(n int) string { return "?" + strconv.Itoa(n) }, rewrite)
+}
+
+func (r *sqliteRepository) RecordAccountCreation(ctx context.Context, accountID, userID int, clientIP string, at, forgetBefore time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO account_creations(account_id, user_id, client_ip, created_at, tenant_id) VALUES (?, ?, ?, ?, ?)`,
+		accountID, userID, clientIP, at.UTC(), tenantOf(ctx)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM account_creations WHERE created_at < ?`, forgetBefore.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) CountAccountCreations(ctx context.Context, userID int, clientIP string, since time.Time) (int, int, error) {
+	var byUser, byIP int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM account_creations WHERE user_id=?1 AND created_at >= ?3 AND tenant_id=?4),
+                (SELECT COUNT(*) FROM account_creations WHERE ?2 <> '' AND client_ip=?2 AND created_at >= ?3 AND tenant_id=?4)`,
+		userID, clientIP, since.UTC(), tenantOf(ctx)).Scan(&byUser, &byIP)
+	return byUser, byIP, err
+}
+
+func (r *sqliteRepository) RaiseComplianceFlag(ctx context.Context, f *ComplianceFlag, now, since time.Time) (*ComplianceFlag, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var flag ComplianceFlag
+	err = scanComplianceFlag(tx.QueryRowContext(ctx,
+		`UPDATE compliance_flags SET occurrences=occurrences+1, last_seen_at=?3, detail=?4, action=?5,
+                account_id=COALESCE(?6, account_id), client_ip=?7
+         WHERE id = (SELECT id FROM compliance_flags
+                     WHERE rule=?1 AND subject=?2 AND status='open' AND last_seen_at >= ?8 AND tenant_id=?9
+                     ORDER BY id DESC LIMIT 1)
+         RETURNING `+complianceFlagColumns,
+		f.Rule, f.Subject, now.UTC(), f.Detail, f.Action, f.AccountID, f.ClientIP, since.UTC(), tenantOf(ctx)), &flag)
+	if err == sql.ErrNoRows {
+		err = scanComplianceFlag(tx.QueryRowContext(ctx,
+			`INSERT INTO compliance_flags(rule, subject, user_id, account_id, client_ip, detail, action, created_at, last_seen_at,
+                 tenant_id)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?8, ?9)
+             RETURNING `+complianceFlagColumns,
+			f.Rule, f.Subject, f.UserID, f.AccountID, f.ClientIP, f.Detail, f.Action, now.UTC(), tenantOf(ctx)), &flag)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+func (r *sqliteRepository) GetComplianceFlag(ctx context.Context, id int) (*ComplianceFlag, error) {
+	var flag ComplianceFlag
+	err := scanComplianceFlag(r.db.QueryRowContext(ctx,
+		`SELECT `+complianceFlagColumns+` FROM compliance_flags WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`,
+		id, tenantFromContext(ctx)), &flag)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+func (r *sqliteRepository) ListComplianceFlags(ctx context.Context, status string, limit int) ([]*ComplianceFlag, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+complianceFlagColumns+` FROM compliance_flags
+         WHERE (?1 = '' OR status = ?1) AND tenant_id = COALESCE(NULLIF(?3, ''), tenant_id) ORDER BY id DESC LIMIT ?2`,
+		status, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanComplianceFlags(rows)
+}
+
+func (r *sqliteRepository) ReviewComplianceFlag(ctx context.Context, id int, status, staffID, note string, now time.Time) (*ComplianceFlag, error) {
+	var flag ComplianceFlag
+	err := scanComplianceFlag(r.db.QueryRowContext(ctx,
+		`UPDATE compliance_flags SET status=?2, reviewed_by=?3, review_note=?4, reviewed_at=?5
+         WHERE id=?1 AND status='open' AND tenant_id = COALESCE(NULLIF(?6, ''), tenant_id) RETURNING `+complianceFlagColumns,
+		id, status, staffID, note, now.UTC(), tenantFromContext(ctx)), &flag)
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+func (r *sqliteRepository) RecordReconciliationBreak(ctx context.Context, b *ReconciliationBreak, now time.Time) (*ReconciliationBreak, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var recorded ReconciliationBreak
+	err = scanReconciliationBreak(tx.QueryRowContext(ctx,
+		`UPDATE reconciliation_breaks SET principal=?2, posted_interest=?3, paid_out=?4, ledger_balance=?5,
+                stored_balance=?6, occurrences=occurrences+1, last_seen_at=?7
+         WHERE account_id=?1 AND status <> 'resolved'
+         RETURNING `+reconciliationBreakColumns,
+		b.AccountID, b.Principal, b.PostedInterest, b.PaidOut, b.LedgerBalance, b.StoredBalance, now.UTC()), &recorded)
+	if err == sql.ErrNoRows {
+		err = scanReconciliationBreak(tx.QueryRowContext(ctx,
+			`INSERT INTO reconciliation_breaks(account_id, tenant_id, principal, posted_interest, paid_out, ledger_balance,
+                 stored_balance, detected_at, last_seen_at)
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?8)
+             RETURNING `+reconciliationBreakColumns,
+			b.AccountID, b.TenantID, b.Principal, b.PostedInterest, b.PaidOut, b.LedgerBalance, b.StoredBalance, now.UTC()), &recorded)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &recorded, nil
+}
+
+func (r *sqliteRepository) ResolveReconciliationBreaks(ctx context.Context, accountIDs []int, now time.Time) (int, error) {
+	if len(accountIDs) == 0 {
+		return 0, nil
+	}
+	in, args := inList(accountIDs, 2, func(n int) string { return "?" + strconv.Itoa(n) })
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE reconciliation_breaks SET status='resolved', resolved_at=?1
+         WHERE status <> 'resolved' AND account_id IN (`+in+`)`,
+		append([]any{now.UTC()}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *sqliteRepository) GetReconciliationBreak(ctx context.Context, id int) (*ReconciliationBreak, error) {
+	var b ReconciliationBreak
+	err := scanReconciliationBreak(r.db.QueryRowContext(ctx,
+		`SELECT `+reconciliationBreakColumns+` FROM reconciliation_breaks
+         WHERE id=?1 AND tenant_id = COALESCE(NULLIF(?2, ''), tenant_id)`,
+		id, tenantFromContext(ctx)), &b)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *sqliteRepository) ListReconciliationBreaks(ctx context.Context, status string, limit int) ([]*ReconciliationBreak, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+reconciliationBreakColumns+` FROM reconciliation_breaks
+         WHERE (?1 = '' OR status = ?1) AND tenant_id = COALESCE(NULLIF(?3, ''), tenant_id) ORDER BY id DESC LIMIT ?2`,
+		status, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanReconciliationBreaks(rows)
+}
+
+func (r *sqliteRepository) AcknowledgeReconciliationBreak(ctx context.Context, id int, staffID, note string, now time.Time) (*ReconciliationBreak, error) {
+	var b ReconciliationBreak
+	err := scanReconciliationBreak(r.db.QueryRowContext(ctx,
+		`UPDATE reconciliation_breaks SET status='acknowledged', acknowledged_by=?2, note=?3, acknowledged_at=?4
+         WHERE id=?1 AND status='open' AND tenant_id = COALESCE(NULLIF(?5, ''), tenant_id)
+         RETURNING `+reconciliationBreakColumns,
+		id, staffID, note, now.UTC(), tenantFromContext(ctx)), &b)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *sqliteRepository) CreateAPIKey(ctx context.Context, k *APIKey) (*APIKey, error) {
+	var key APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys(name, prefix, key_hash, scopes, created_by, created_at, expires_at, tenant_id)
+         VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8)
+         RETURNING `+apiKeyColumns,
+		k.Name, k.Prefix, k.keyHash, strings.Join(k.Scopes, ","), k.CreatedBy, time.Now().UTC(), utcOrNil(k.ExpiresAt),
+		k.TenantID), &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *sqliteRepository) GetAPIKey(ctx context.Context, id int) (*APIKey, error) {
+	return r.getAPIKey(ctx, `id=?1 AND tenant_id = COALESCE(NULLIF(?2, ''), tenant_id)`, id, tenantFromContext(ctx))
+}
+
+func (r *sqliteRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	get, err := r.stmts.prepare(ctx, r.db, sqliteGetAPIKeyByPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var key APIKey
+	err = scanAPIKey(get.QueryRowContext(ctx, prefix), &key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// getAPIKey returns the key matching where, or nil
+func (r *sqliteRepository) getAPIKey(ctx context.Context, where string, args ...any) (*APIKey, error) {
+	var key APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE `+where, args...), &key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *sqliteRepository) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id = COALESCE(NULLIF(?, ''), tenant_id) ORDER BY id DESC`,
+		tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+func (r *sqliteRepository) RotateAPIKey(ctx context.Context, id int, keyHash string, previousExpiresAt, now time.Time) (*APIKey, error) {
+	var key APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx,
+		`UPDATE api_keys SET previous_hash=key_hash, previous_expires_at=?3, key_hash=?2, rotated_at=?4
+         WHERE id=?1 AND revoked_at IS NULL AND tenant_id = COALESCE(NULLIF(?5, ''), tenant_id) RETURNING `+apiKeyColumns,
+		id, keyHash, previousExpiresAt.UTC(), now.UTC(), tenantFromContext(ctx)), &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *sqliteRepository) RevokeAPIKey(ctx context.Context, id int, revokedBy string, now time.Time) (*APIKey, error) {
+	var key APIKey
+	err := scanAPIKey(r.db.QueryRowContext(ctx,
+		`UPDATE api_keys SET revoked_at=?3, revoked_by=?2
+         WHERE id=?1 AND revoked_at IS NULL AND tenant_id = COALESCE(NULLIF(?4, ''), tenant_id) RETURNING `+apiKeyColumns,
+		id, revokedBy, now.UTC(), tenantFromContext(ctx)), &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *sqliteRepository) TouchAPIKey(ctx context.Context, id int, now time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at=?2 WHERE id=?1`, id, now.UTC())
+	return err
+}
+
+func (r *sqliteRepository) ResolveAccountID(ctx context.Context, externalID string) (int, error) {
+	resolve, err := r.stmts.prepare(ctx, r.db, sqliteResolveAccountID)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = resolve.QueryRowContext(ctx, externalID, tenantFromContext(ctx)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func (r *sqliteRepository) AccountExternalIDs(ctx context.Context, ids []int) (map[int]string, error) {
+	if len(ids) == 0 {
+		return map[int]string{}, nil
+	}
+	query, args := accountExternalIDsQuery(ids, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountExternalIDs(rows)
+}
+
+func (r *sqliteRepository) GetRegionState(ctx context.Context) (*RegionState, error) {
+	return scanRegionState(r.db.QueryRowContext(ctx, `SELECT `+regionStateColumns+` FROM region_state WHERE id=1`))
+}
+
+func (r *sqliteRepository) PromoteRegion(ctx context.Context, region string, fromEpoch int, promotedBy string, now time.Time) (*RegionState, error) {
+	state, err := scanRegionState(r.db.QueryRowContext(ctx,
+		`INSERT INTO region_state(id, active_region, epoch, promoted_at, promoted_by) VALUES (1, ?1, ?2 + 1, ?3, ?4)
+         ON CONFLICT (id) DO UPDATE SET active_region=excluded.active_region, epoch=excluded.epoch,
+             promoted_at=excluded.promoted_at, promoted_by=excluded.promoted_by
+         WHERE region_state.epoch = ?2
+         RETURNING `+regionStateColumns,
+		region, fromEpoch, now.UTC(), promotedBy))
+	if err == nil && state == nil {
+		return nil, sql.ErrNoRows
+	}
+	return state, err
+}
+
+func (r *sqliteRepository) ClaimDeployment(ctx context.Context, sandbox bool, now time.Time) (bool, error) {
+	if _, err := r.db.ExecContext(ctx,
+		`INSERT INTO deployment(id, sandbox, created_at) VALUES (1, ?, ?) ON CONFLICT (id) DO NOTHING`, sandbox, now.UTC()); err != nil {
+		return false, err
+	}
+	var recorded bool
+	err := r.db.QueryRowContext(ctx, `SELECT sandbox FROM deployment WHERE id=1`).Scan(&recorded)
+	return recorded, err
+}
+
+func (r *sqliteRepository) ClockOffset(ctx context.Context) (time.Duration, error) {
+	var ms int64
+	err := r.db.QueryRowContext(ctx, `SELECT clock_offset_ms FROM deployment WHERE id=1`).Scan(&ms)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+func (r *sqliteRepository) AdvanceClock(ctx context.Context, d time.Duration) (time.Duration, error) {
+	var ms int64
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE deployment SET clock_offset_ms = clock_offset_ms + ? WHERE id=1 RETURNING clock_offset_ms`,
+		d.Milliseconds()).Scan(&ms)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+// ReplicationLag is always 0: SQLite has no replicas
+func (r *sqliteRepository) ReplicationLag(ctx context.Context) (time.Duration, error) {
+	return 0, nil
+}
+
+func (r *sqliteRepository) RecordWorkerHeartbeat(ctx context.Context, hb *WorkerHeartbeat) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO worker_heartbeats(worker, instance, interval_ms, last_run_failed, beat_at) VALUES (?, ?, ?, ?, ?)
+         ON CONFLICT (worker) DO UPDATE SET instance=excluded.instance, interval_ms=excluded.interval_ms,
+             last_run_failed=excluded.last_run_failed, beat_at=excluded.beat_at`,
+		hb.Worker, hb.Instance, hb.Interval.Milliseconds(), hb.LastRunFailed, hb.BeatAt.UTC())
+	return err
+}
+
+func (r *sqliteRepository) AcquireWorkerLease(ctx context.Context, worker, holder string, now time.Time, lease time.Duration) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO worker_leases(worker, holder, acquired_at, expires_at) VALUES (?1, ?2, ?3, ?4)
+         ON CONFLICT (worker) DO UPDATE SET holder=excluded.holder, expires_at=excluded.expires_at,
+             acquired_at=CASE WHEN worker_leases.holder=excluded.holder THEN worker_leases.acquired_at ELSE excluded.acquired_at END
+         WHERE worker_leases.holder=excluded.holder OR worker_leases.expires_at <= ?3`,
+		worker, holder, now.UTC(), now.Add(lease).UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (r *sqliteRepository) ReleaseWorkerLease(ctx context.Context, worker, holder string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM worker_leases WHERE worker=? AND holder=?`, worker, holder)
+	return err
+}
+
+func (r *sqliteRepository) ListWorkerHeartbeats(ctx context.Context) ([]*WorkerHeartbeat, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT worker, instance, interval_ms, last_run_failed, beat_at FROM worker_heartbeats ORDER BY worker`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var heartbeats []*WorkerHeartbeat
+	for rows.Next() {
+		hb := &WorkerHeartbeat{}
+		var intervalMS int64
+		if err := rows.Scan(&hb.Worker, &hb.Instance, &intervalMS, &hb.LastRunFailed, &hb.BeatAt); err != nil {
+			return nil, err
+		}
+		hb.Interval = time.Duration(intervalMS) * time.Millisecond
+		heartbeats = append(heartbeats, hb)
+	}
+	return heartbeats, rows.Err()
+}
+
+func (r *sqliteRepository) ListStatusChanges(ctx context.Context, accountID int) ([]*StatusChange, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+statusChangeColumns+` FROM account_status_history WHERE account_id=? ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return scanStatusChanges(rows)
+}
+
+// insertStatusChange records an account's change of status as part of tx
+func (r *sqliteRepository) insertStatusChange(ctx context.Context, tx *sql.Tx, c *StatusChange) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO account_status_history(account_id, from_status, to_status, principal, note, changed_at)
+         VALUES (?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?)`,
+		c.AccountID, c.From, c.To, c.Principal, c.Note, c.ChangedAt.UTC())
+	return err
+}
+
+// recordStatus records the change of the account's status, whose row tx
+// holds, to the one about to be set
+func (r *sqliteRepository) recordStatus(ctx context.Context, tx *sql.Tx, accountID int, to, note string, at time.Time) error {
+	c := &StatusChange{AccountID: accountID, To: to, Note: note, ChangedAt: at}
+	err := tx.QueryRowContext(ctx, `SELECT status, principal FROM block_accounts WHERE id=?`, accountID).Scan(&c.From, &c.Principal)
+	if err != nil {
+		return err
+	}
+	return r.insertStatusChange(ctx, tx, c)
+}
+
+// insertAccountID records the account's external ID as part of tx
+func (r *sqliteRepository) insertAccountID(ctx context.Context, tx *sql.Tx, a *BlockAccount) error {
+	if a.ExternalID == "" {
+		return errNoExternalID
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO account_ids(account_id, external_id, tenant_id) VALUES (?, ?, ?)`,
+		a.ID, a.ExternalID, a.TenantID)
+	return err
+}
+
+// insertHolders records the account's user as its primary holder as part of
+// tx and, when it is the rollover of the account rolledOver, carries that
+// account's secondary holders over to it
+func (r *sqliteRepository) insertHolders(ctx context.Context, tx *sql.Tx, a *BlockAccount, rolledOver int) error {
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO account_holders(account_id, user_id, role, created_at) VALUES (?, ?, 'primary', ?)`,
+		a.ID, a.UserID, time.Now().UTC()); err != nil {
+		return err
+	}
+	if rolledOver == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO account_holders(account_id, user_id, role, added_by, created_at)
+         SELECT ?, user_id, role, added_by, created_at FROM account_holders WHERE account_id=? AND role='secondary'`,
+		a.ID, rolledOver)
+	return err
+}
+
+// insertOutbox enqueues e as part of tx
+func (r *sqliteRepository) insertOutbox(ctx context.Context, tx *sql.Tx, e *AccountEvent) error {
+	payload, err := e.Payload()
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox(event_id, aggregate_id, aggregate_key, event_type, schema_version, payload, tenant_id, user_id, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.accountID, e.Account.ID, e.Type, e.SchemaVersion, string(payload), e.tenantID, e.Account.UserID, e.OccurredAt)
+	if err != nil {
+		return err
+	}
+
+	// Fan the event out to every active webhook of the account's tenant
+	// subscribed to it
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload, next_attempt_at, created_at, updated_at)
+         SELECT id, ?1, ?2, ?3, ?4, ?4, ?4 FROM webhooks
+         WHERE active AND channel='account' AND tenant_id = ?5 AND (',' || events || ',') LIKE ('%,' || ?2 || ',%')`,
+		e.ID, e.Type, string(payload), e.OccurredAt, e.tenantID)
+	return err
+}
+
+// RelayOutbox needs no extra locking: the immediate transaction already
+// serializes relays
+func (r *sqliteRepository) RelayOutbox(ctx context.Context, limit int, publish func(*OutboxEvent) error) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+outboxColumns+` FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return 0, err
+	}
+	events, err := scanOutbox(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, e := range events {
+		if publishErr := publish(e); publishErr != nil {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE outbox SET attempts=attempts+1, last_error=? WHERE id=?`, publishErr.Error(), e.ID); err != nil {
+				return 0, err
+			}
+			if err := tx.Commit(); err != nil {
+				return 0, err
+			}
+			return published, fmt.Errorf("publish event %s: %w", e.EventID, publishErr)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE outbox SET attempts=attempts+1, last_error=NULL, published_at=? WHERE id=?`,
+			time.Now().UTC(), e.ID); err != nil {
+			return 0, err
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return published, nil
+}
+
+func (r *sqliteRepository) CreateWebhook(ctx context.Context, w *Webhook) (*Webhook, error) {
+	var webhook Webhook
+	err := scanWebhook(r.db.QueryRowContext(ctx,
+		`INSERT INTO webhooks(url, channel, secret, events, active, created_at, tenant_id) VALUES (?, ?, ?, ?, ?, ?, ?)
+         RETURNING `+webhookColumns,
+		w.URL, w.Channel, w.Secret, strings.Join(w.Events, ","), w.Active, time.Now().UTC(), tenantOf(ctx)), &webhook)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *sqliteRepository) GetWebhook(ctx context.Context, id int) (*Webhook, error) {
+	var webhook Webhook
+	err := scanWebhook(r.db.QueryRowContext(ctx,
+		`SELECT `+webhookColumns+` FROM webhooks WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`, id, tenantFromContext(ctx)), &webhook)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *sqliteRepository) DeleteWebhook(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`, id, tenantFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) ListWebhookDeliveries(ctx context.Context, webhookID, limit int) ([]*WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries d
+         WHERE d.webhook_id = (SELECT id FROM webhooks WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id))
+         ORDER BY d.id DESC LIMIT ?`,
+		webhookID, tenantFromContext(ctx), limit)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanDeliveries(rows)
+	if err != nil || len(deliveries) == 0 {
+		return deliveries, err
+	}
+
+	rows, err = r.db.QueryContext(ctx,
+		`SELECT `+attemptColumns+` FROM webhook_delivery_attempts
+         WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE webhook_id=? ORDER BY id DESC LIMIT ?)
+         ORDER BY id`,
+		webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachAttempts(rows, deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *sqliteRepository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT `+deliveryColumns+`, w.url, w.secret
+         FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+         WHERE d.status='pending' AND d.next_attempt_at <= ?
+         ORDER BY d.next_attempt_at, d.id LIMIT ?`,
+		now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanDelivery(rows, &d, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, d := range deliveries {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE webhook_deliveries SET next_attempt_at=? WHERE id=?`, now.Add(lease).UTC(), d.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r *sqliteRepository) RecordWebhookAttempt(ctx context.Context, d *WebhookDelivery, a *WebhookAttempt) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO webhook_delivery_attempts(delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+         VALUES (?, ?, NULLIF(?, 0), NULLIF(?, ''), ?, ?) RETURNING id`,
+		a.DeliveryID, a.Attempt, a.StatusCode, a.Error, a.DurationMs, a.AttemptedAt.UTC()).Scan(&a.ID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status=?, attempts=?, next_attempt_at=?,
+             last_status_code=NULLIF(?, 0), last_error=NULLIF(?, ''), updated_at=?
+         WHERE id=?`,
+		d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.LastStatusCode, d.LastError, time.Now().UTC(), d.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) EnqueueOperationalEvent(ctx context.Context, e *OperationalEvent) (int, error) {
+	payload, err := e.Payload()
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload, next_attempt_at, created_at, updated_at)
+         SELECT id, ?1, ?2, ?3, ?4, ?4, ?4 FROM webhooks
+         WHERE active AND channel='operations' AND tenant_id = ?5 AND (',' || events || ',') LIKE ('%,' || ?2 || ',%')`,
+		e.ID, e.Type, string(payload), e.OccurredAt, tenantOf(ctx))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (r *sqliteRepository) ReplayWebhookDeliveries(ctx context.Context, webhookID int, now time.Time) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT id FROM webhooks WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`, webhookID, tenantFromContext(ctx)).Scan(&id); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=?, updated_at=?
+         WHERE webhook_id=? AND status='failed'`,
+		now.UTC(), time.Now().UTC(), webhookID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (r *sqliteRepository) CreateImpersonation(ctx context.Context, s *ImpersonationSession) (*ImpersonationSession, error) {
+	s.CreatedAt = time.Now().UTC()
+	s.ExpiresAt = s.ExpiresAt.UTC()
+	if err := r.db.QueryRowContext(ctx,
+		`INSERT INTO impersonation_sessions(token_hash, staff_id, staff_role, user_id, reason, created_at, expires_at, tenant_id)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		s.tokenHash, s.StaffID, s.StaffRole, s.UserID, s.Reason, s.CreatedAt, s.ExpiresAt, s.TenantID).Scan(&s.ID); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *sqliteRepository) GetImpersonation(ctx context.Context, id int) (*ImpersonationSession, error) {
+	var s ImpersonationSession
+	err := scanImpersonation(r.db.QueryRowContext(ctx,
+		`SELECT `+impersonationColumns+` FROM impersonation_sessions WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`,
+		id, tenantFromContext(ctx)), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sqliteRepository) GetImpersonationByTokenHash(ctx context.Context, tokenHash string) (*ImpersonationSession, error) {
+	var s ImpersonationSession
+	err := scanImpersonation(r.db.QueryRowContext(ctx,
+		`SELECT `+impersonationColumns+` FROM impersonation_sessions WHERE token_hash=?`, tokenHash), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sqliteRepository) EndImpersonation(ctx context.Context, id int, now time.Time) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE impersonation_sessions SET ended_at=?1
+         WHERE id=?2 AND ended_at IS NULL AND expires_at > ?1 AND tenant_id = COALESCE(NULLIF(?3, ''), tenant_id)`,
+		now.UTC(), id, tenantFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) RecordImpersonationAccess(ctx context.Context, a *ImpersonationAccess) error {
+	a.CreatedAt = time.Now().UTC()
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO impersonation_audit(session_id, method, path, status, created_at) VALUES (?, ?, ?, ?, ?)
+         RETURNING id`,
+		a.SessionID, a.Method, a.Path, a.Status, a.CreatedAt).Scan(&a.ID)
+}
+
+func (r *sqliteRepository) ListImpersonationAudit(ctx context.Context, sessionID int) ([]*ImpersonationAccess, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+impersonationAuditColumns+` FROM impersonation_audit WHERE session_id=? ORDER BY id`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return scanImpersonationAudit(rows)
+}
+
+func (r *sqliteRepository) ActiveExposureByPeriod(ctx context.Context) ([]PeriodExposure, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT COALESCE(period, ''), COUNT(*), COALESCE(SUM(principal), 0),
+             COALESCE(SUM(principal * (julianday(end_date) - julianday(start_date)) / 365), 0),
+             COALESCE(SUM(principal * interest_rate * (julianday(end_date) - julianday(start_date)) / 365), 0)
+         FROM block_accounts WHERE status='active' AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id) GROUP BY period ORDER BY period`,
+		tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanExposures(rows)
+}
+
+func (r *sqliteRepository) PortfolioGroups(ctx context.Context) ([]PortfolioGroup, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT status, COALESCE(period, ''), COUNT(*), COALESCE(SUM(principal), 0),
+             COALESCE(SUM(interest_rate), 0), COALESCE(SUM(principal * interest_rate), 0)
+         FROM block_accounts WHERE tenant_id = COALESCE(NULLIF(?, ''), tenant_id) GROUP BY status, period ORDER BY status, period`,
+		tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanPortfolioGroups(rows)
+}
+
+func (r *sqliteRepository) MaturingTotals(ctx context.Context, from, to time.Time) (int, float64, error) {
+	var count int
+	var principal float64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(principal), 0) FROM block_accounts
+         WHERE status='active' AND end_date > ? AND end_date <= ? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`,
+		from.UTC(), to.UTC(), tenantFromContext(ctx)).Scan(&count, &principal)
+	return count, principal, err
+}
+
+func (r *sqliteRepository) MaturityCalendar(ctx context.Context, from, to time.Time, groupBy string, loc *time.Location) ([]*MaturityBucket, error) {
+	// SQLite knows no zones, so end dates are shifted by the zone's offset
+	// at the start of the window
+	_, offset := from.In(loc).Zone()
+	day := fmt.Sprintf(`date(end_date, '%+d seconds')`, offset)
+	bucket := day
+	switch groupBy {
+	case GroupByWeek:
+		bucket = `date(` + day + `, 'weekday 0', '-6 days')`
+	case GroupByMonth:
+		bucket = `date(` + day + `, 'start of month')`
+	}
+	interest := `interest_adjustment + principal * interest_rate *
+		(julianday(end_date) - julianday(COALESCE(interest_paid_through, start_date))) / 365`
+	rows, err := r.db.QueryContext(ctx, maturityCalendarQuery(bucket, interest, "?1", "?2", "?3"),
+		from.UTC(), to.UTC(), tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanMaturityBuckets(rows)
+}
+
+func (r *sqliteRepository) DailySummary(ctx context.Context, from, to time.Time) (*DailySummary, error) {
+	accrual := `principal * interest_rate * (julianday(MIN(end_date, ?2)) - julianday(MAX(start_date, ?1))) / 365`
+	return scanDailySummary(r.db.QueryRowContext(ctx, dailySummaryQuery(accrual, "?1", "?2"), from.UTC(), to.UTC()))
+}
+
+func (r *sqliteRepository) SaveReport(ctx context.Context, report *Report) (*Report, error) {
+	summary, err := json.Marshal(report.Summary)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.QueryRowContext(ctx,
+		`INSERT INTO reports(type, report_date, summary, recipients, document_key, requested_by, created_at)
+         VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+         ON CONFLICT (type, report_date) DO UPDATE SET summary=excluded.summary, recipients=excluded.recipients,
+             document_key=excluded.document_key, requested_by=excluded.requested_by, created_at=excluded.created_at
+         RETURNING id, created_at`,
+		report.Type, report.Date, string(summary), strings.Join(report.Recipients, ","), report.DocumentKey,
+		report.RequestedBy, time.Now().UTC()).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (r *sqliteRepository) GetReport(ctx context.Context, reportType, date string) (*Report, error) {
+	var report Report
+	err := scanReport(r.db.QueryRowContext(ctx,
+		`SELECT `+reportColumns+` FROM reports WHERE type=? AND report_date=?`, reportType, date), &report)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (r *sqliteRepository) DashboardCounts(ctx context.Context, failedSince time.Time) (*Dashboard, error) {
+	return scanDashboardCounts(r.db.QueryRowContext(ctx, fmt.Sprintf(dashboardCountsQuery, "?"), failedSince.UTC()))
+}
+
+func (r *sqliteRepository) GetCheckpoint(ctx context.Context, job string) (*WorkerCheckpoint, error) {
+	var cp WorkerCheckpoint
+	err := scanCheckpoint(r.db.QueryRowContext(ctx,
+		`SELECT `+checkpointColumns+` FROM worker_checkpoints WHERE job=?`, job), &cp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (r *sqliteRepository) SaveCheckpoint(ctx context.Context, cp *WorkerCheckpoint) error {
+	cp.UpdatedAt = time.Now().UTC()
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO worker_checkpoints(job, run_started_at, processed, completed_at, last_completed_at, updated_at)
+         VALUES (?, ?, ?, ?, ?, ?)
+         ON CONFLICT (job) DO UPDATE SET run_started_at=excluded.run_started_at, processed=excluded.processed,
+             completed_at=excluded.completed_at,
+             last_completed_at=COALESCE(excluded.completed_at, worker_checkpoints.last_completed_at),
+             updated_at=excluded.updated_at`,
+		cp.Job, cp.RunStartedAt.UTC(), cp.Processed, utcOrNil(cp.CompletedAt), utcOrNil(cp.CompletedAt), cp.UpdatedAt)
+	return err
+}
+
+func (r *sqliteRepository) ListScheduledJobs(ctx context.Context) ([]*ScheduledJob, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+scheduledJobColumns+` FROM scheduled_jobs ORDER BY job`)
+	if err != nil {
+		return nil, err
+	}
+	return scanScheduledJobs(rows)
+}
+
+func (r *sqliteRepository) GetScheduledJob(ctx context.Context, job string) (*ScheduledJob, error) {
+	var j ScheduledJob
+	err := scanScheduledJob(r.db.QueryRowContext(ctx, `SELECT `+scheduledJobColumns+` FROM scheduled_jobs WHERE job=?`, job), &j)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *sqliteRepository) ScheduleJob(ctx context.Context, job, schedule string, nextRunAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO scheduled_jobs(job, schedule, next_run_at, updated_at) VALUES (?, ?, ?, ?)
+         ON CONFLICT (job) DO UPDATE SET schedule=excluded.schedule, next_run_at=excluded.next_run_at,
+             updated_at=excluded.updated_at`,
+		job, schedule, nextRunAt.UTC(), time.Now().UTC())
+	return err
+}
+
+func (r *sqliteRepository) StartScheduledRun(ctx context.Context, job string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE scheduled_jobs SET running_since=?1, last_started_at=?1,
+             trigger_requested_by=CASE WHEN trigger_requested_at <= ?1 THEN '' ELSE trigger_requested_by END,
+             trigger_requested_at=CASE WHEN trigger_requested_at <= ?1 THEN NULL ELSE trigger_requested_at END,
+             updated_at=?1
+         WHERE job=?2`,
+		at.UTC(), job)
+	return err
+}
+
+func (r *sqliteRepository) FinishScheduledRun(ctx context.Context, job string, at time.Time, runErr string) error {
+	status := ScheduledRunSucceeded
+	if runErr != "" {
+		status = ScheduledRunFailed
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE scheduled_jobs SET running_since=NULL, last_finished_at=?1, last_status=?2, last_error=?3, updated_at=?1
+         WHERE job=?4`,
+		at.UTC(), status, runErr, job)
+	return err
+}
+
+func (r *sqliteRepository) PauseScheduledJob(ctx context.Context, job string, paused bool, staffID string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO scheduled_jobs(job, paused, paused_by, updated_at) VALUES (?, ?, ?, ?)
+         ON CONFLICT (job) DO UPDATE SET paused=excluded.paused, paused_by=excluded.paused_by,
+             updated_at=excluded.updated_at`,
+		job, paused, staffID, time.Now().UTC())
+	return err
+}
+
+func (r *sqliteRepository) TriggerScheduledJob(ctx context.Context, job string, at time.Time, staffID string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO scheduled_jobs(job, trigger_requested_at, trigger_requested_by, updated_at) VALUES (?1, ?2, ?3, ?2)
+         ON CONFLICT (job) DO UPDATE SET
+             trigger_requested_by=COALESCE(NULLIF(scheduled_jobs.trigger_requested_by, ''), excluded.trigger_requested_by),
+             trigger_requested_at=COALESCE(scheduled_jobs.trigger_requested_at, excluded.trigger_requested_at),
+             updated_at=excluded.updated_at`,
+		job, at.UTC(), staffID)
+	return err
+}
+
+func (r *sqliteRepository) GetProductGate(ctx context.Context, product string) (*ProductGate, error) {
+	var gate ProductGate
+	err := scanProductGate(r.db.QueryRowContext(ctx,
+		`SELECT `+productGateColumns+` FROM product_gates WHERE tenant_id=? AND product=?`, tenantOf(ctx), product), &gate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &gate, nil
+}
+
+func (r *sqliteRepository) ListProductGates(ctx context.Context) ([]*ProductGate, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+productGateColumns+` FROM product_gates WHERE tenant_id=? ORDER BY product`, tenantOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanProductGates(rows)
+}
+
+func (r *sqliteRepository) SaveProductGate(ctx context.Context, gate *ProductGate) error {
+	gate.UpdatedAt = time.Now().UTC()
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO product_gates(tenant_id, product, allowed_user_ids, rollout_percent, updated_by, updated_at)
+         VALUES (?, ?, ?, ?, ?, ?)
+         ON CONFLICT (tenant_id, product) DO UPDATE SET allowed_user_ids=excluded.allowed_user_ids,
+             rollout_percent=excluded.rollout_percent, updated_by=excluded.updated_by, updated_at=excluded.updated_at`,
+		tenantOf(ctx), gate.Product, joinIDs(gate.AllowedUserIDs), gate.RolloutPercent, gate.UpdatedBy, gate.UpdatedAt)
+	return err
+}
+
+func (r *sqliteRepository) DeleteProductGate(ctx context.Context, product string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM product_gates WHERE tenant_id=? AND product=?`, tenantOf(ctx), product)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) ListFeatureFlags(ctx context.Context) ([]*FeatureFlag, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+featureFlagColumns+` FROM feature_flags ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	return scanFeatureFlags(rows)
+}
+
+func (r *sqliteRepository) SaveFeatureFlag(ctx context.Context, flag *FeatureFlag) error {
+	updatedAt := time.Now().UTC()
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO feature_flags(name, enabled, tenants, rollout_percent, updated_by, updated_at)
+         VALUES (?, ?, ?, ?, ?, ?)
+         ON CONFLICT (name) DO UPDATE SET enabled=excluded.enabled, tenants=excluded.tenants,
+             rollout_percent=excluded.rollout_percent, updated_by=excluded.updated_by, updated_at=excluded.updated_at`,
+		flag.Name, flag.Enabled, strings.Join(flag.Tenants, ","), flag.RolloutPercent, flag.UpdatedBy, updatedAt)
+	if err != nil {
+		return err
+	}
+	flag.UpdatedAt = &updatedAt
+	return nil
+}
+
+func (r *sqliteRepository) DeleteFeatureFlag(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM feature_flags WHERE name=?`, name)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) ListAccountLimits(ctx context.Context) ([]*AccountLimit, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+accountLimitColumns+` FROM account_limits WHERE tenant_id=? ORDER BY rule, period`, tenantOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanAccountLimits(rows)
+}
+
+func (r *sqliteRepository) SaveAccountLimit(ctx context.Context, limit *AccountLimit) error {
+	limit.UpdatedAt = time.Now().UTC()
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO account_limits(tenant_id, rule, period, value, updated_by, updated_at)
+         VALUES (?, ?, ?, ?, ?, ?)
+         ON CONFLICT (tenant_id, rule, period) DO UPDATE SET value=excluded.value, updated_by=excluded.updated_by,
+             updated_at=excluded.updated_at`,
+		tenantOf(ctx), limit.Rule, limit.Period, limit.Value, limit.UpdatedBy, limit.UpdatedAt)
+	return err
+}
+
+func (r *sqliteRepository) DeleteAccountLimit(ctx context.Context, rule, period string) error {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM account_limits WHERE tenant_id=? AND rule=? AND period=?`, tenantOf(ctx), rule, period)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) UserExists(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id=?)`, userID).Scan(&exists)
+	return exists, err
+}
+
+func (r *sqliteRepository) SaveUsers(ctx context.Context, userIDs []int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO users(id) VALUES (?) ON CONFLICT (id) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range userIDs {
+		if _, err := stmt.ExecContext(ctx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) GetUserExposure(ctx context.Context, userID int) (UserExposure, error) {
+	var e UserExposure
+	err := r.db.QueryRowContext(ctx, sqliteUserExposure, userID, tenantOf(ctx)).Scan(&e.OpenAccounts, &e.Principal)
+	return e, err
+}
+
+func (r *sqliteRepository) CreateAccountImport(ctx context.Context, imp *AccountImport, job *Job) (*AccountImport, error) {
+	rows, err := json.Marshal(imp.rows)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := r.insertJob(ctx, tx, job); err != nil {
+		return nil, err
+	}
+	imp.CreatedAt = job.CreatedAt
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO account_imports(job_id, status, total_rows, requested_by, rows, created_at, tenant_id)
+         VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		job.ID, imp.Status, imp.Total, imp.RequestedBy, rows, imp.CreatedAt, imp.tenantID).Scan(&imp.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	imp.JobID = job.ID
+	return imp, nil
+}
+
+func (r *sqliteRepository) GetAccountImport(ctx context.Context, id int) (*AccountImport, error) {
+	var imp AccountImport
+	err := scanAccountImport(r.db.QueryRowContext(ctx,
+		`SELECT `+accountImportColumns+` FROM account_imports WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`,
+		id, tenantFromContext(ctx)), &imp)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+func (r *sqliteRepository) StartAccountImport(ctx context.Context, jobID int) (*AccountImport, error) {
+	var imp AccountImport
+	var rows []byte
+	err := scanAccountImport(r.db.QueryRowContext(ctx,
+		`UPDATE account_imports SET status='running' WHERE job_id=? RETURNING `+accountImportColumns+`, rows`,
+		jobID), &imp, &rows)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(rows, &imp.rows); err != nil {
+		return nil, err
+	}
+	return &imp, nil
+}
+
+func (r *sqliteRepository) CompleteAccountImport(ctx context.Context, imp *AccountImport) error {
+	results, err := json.Marshal(imp.Results)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`UPDATE account_imports SET status=?, processed_rows=?, created_rows=?, failed_rows=?, results=?, completed_at=?
+         WHERE id=?`,
+		imp.Status, imp.Processed, imp.Created, imp.Failed, results, utcOrNil(imp.CompletedAt), imp.ID)
+	return err
+}
+
+func (r *sqliteRepository) CreateEventReplay(ctx context.Context, replay *EventReplay) (*EventReplay, error) {
+	var webhookID any
+	if replay.Destination.WebhookID != 0 {
+		webhookID = replay.Destination.WebhookID
+	}
+	replay.CreatedAt = time.Now().UTC()
+	if err := r.db.QueryRowContext(ctx,
+		`INSERT INTO event_replays(status, destination, topic, webhook_id, from_time, to_time, account_ids, event_types,
+             last_outbox_id, requested_by, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		replay.Status, replay.Destination.Type, replay.Destination.Topic, webhookID, utcOrNil(replay.From),
+		replay.To.UTC(), joinIDs(replay.AccountIDs), strings.Join(replay.EventTypes, ","), replay.LastOutboxID,
+		replay.RequestedBy, replay.CreatedAt).Scan(&replay.ID); err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+func (r *sqliteRepository) GetEventReplay(ctx context.Context, id int) (*EventReplay, error) {
+	var replay EventReplay
+	err := scanEventReplay(r.db.QueryRowContext(ctx,
+		`SELECT `+eventReplayColumns+` FROM event_replays WHERE id=?`, id), &replay)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+func (r *sqliteRepository) ClaimEventReplay(ctx context.Context, now time.Time, lease time.Duration) (*EventReplay, error) {
+	var replay EventReplay
+	err := scanEventReplay(r.db.QueryRowContext(ctx,
+		`UPDATE event_replays SET status='running', lease_until=?2
+         WHERE id = (
+             SELECT id FROM event_replays
+             WHERE status='queued' OR (status='running' AND lease_until <= ?1)
+             ORDER BY id LIMIT 1)
+         RETURNING `+eventReplayColumns,
+		now.UTC(), now.Add(lease).UTC()), &replay)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+func (r *sqliteRepository) ListReplayEvents(ctx context.Context, replay *EventReplay, limit int) ([]*OutboxEvent, error) {
+	query, args := replayEventsQuery(replay, limit, func(n int) string { return "?" + strconv.Itoa(n) })
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			args[i] = t.UTC()
+		}
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutbox(rows)
+}
+
+func (r *sqliteRepository) SaveEventReplay(ctx context.Context, replay *EventReplay) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE event_replays SET status=?2, last_outbox_id=?3, replayed=?4, last_error=NULLIF(?5, ''), completed_at=?6,
+             lease_until=CASE WHEN ?2='running' THEN lease_until END
+         WHERE id=?1`,
+		replay.ID, replay.Status, replay.LastOutboxID, replay.Replayed, replay.LastError, utcOrNil(replay.CompletedAt))
+	return err
+}
+
+func (r *sqliteRepository) QueueReplayDeliveries(ctx context.Context, replay *EventReplay, events []*OutboxEvent) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	queued := 0
+	for _, e := range events {
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload, next_attempt_at, created_at, updated_at)
+             SELECT id, ?2, ?3, ?4, ?5, ?5, ?5 FROM webhooks
+             WHERE id=?1 AND tenant_id=?6 AND (',' || events || ',') LIKE ('%,' || ?3 || ',%')`,
+			replay.Destination.WebhookID, e.EventID, e.Type, string(e.Payload), now, e.TenantID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		queued += int(n)
+	}
+
+	last := events[len(events)-1].ID
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE event_replays SET last_outbox_id=?, replayed=replayed+? WHERE id=?`,
+		last, queued, replay.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	replay.LastOutboxID = last
+	replay.Replayed += queued
+	return nil
+}
+
+func (r *sqliteRepository) CreateApproval(ctx context.Context, a *Approval) (*Approval, error) {
+	a.Status = ApprovalPending
+	a.CreatedAt = time.Now().UTC()
+	if err := r.db.QueryRowContext(ctx,
+		`INSERT INTO approvals(action, account_id, amount, adjustment, reason, status, requested_by, created_at, tenant_id,
+             value_date)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		a.Action, a.AccountID, a.Amount, a.Adjustment, a.Reason, a.Status, a.RequestedBy, a.CreatedAt,
+		tenantOf(ctx), utcOrNil(a.ValueDate)).Scan(&a.ID); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (r *sqliteRepository) GetApproval(ctx context.Context, id int) (*Approval, error) {
+	var a Approval
+	err := scanApproval(r.db.QueryRowContext(ctx,
+		`SELECT `+approvalColumns+` FROM approvals WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`, id, tenantFromContext(ctx)), &a)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *sqliteRepository) ListApprovals(ctx context.Context, status string, limit int) ([]*Approval, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+approvalColumns+` FROM approvals
+         WHERE (?1 = '' OR status = ?1) AND tenant_id = COALESCE(NULLIF(?3, ''), tenant_id) ORDER BY id DESC LIMIT ?2`,
+		status, limit, tenantFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return scanApprovals(rows)
+}
+
+func (r *sqliteRepository) DecideApproval(ctx context.Context, id int, status, staffID, note string) (*Approval, error) {
+	var a Approval
+	err := scanApproval(r.db.QueryRowContext(ctx,
+		`UPDATE approvals SET status=?, decided_by=?, decision_note=?, decided_at=?
+         WHERE id=? AND status='pending' AND requested_by <> ? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id) RETURNING `+approvalColumns,
+		status, staffID, note, time.Now().UTC(), id, staffID, tenantFromContext(ctx)), &a)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *sqliteRepository) FailApproval(ctx context.Context, id int, reason string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE approvals SET status='failed', failure_reason=? WHERE id=?`, reason, id)
+	return err
+}
+
+func (r *sqliteRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *sqliteRepository) PoolStats() sql.DBStats {
+	return r.db.Stats()
+}
+
+// utcOrNil converts an optional time to UTC for storage
+func utcOrNil(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// insertJob stores a queued job within tx and sets its ID and CreatedAt
+func (r *sqliteRepository) insertJob(ctx context.Context, tx *sql.Tx, job *Job) error {
+	job.CreatedAt = time.Now().UTC()
+	return tx.QueryRowContext(ctx,
+		`INSERT INTO jobs(type, status, payload, requested_by, created_at, region, tenant_id)
+         VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		job.Type, job.Status, string(job.Payload), job.RequestedBy, job.CreatedAt, job.Region, tenantOf(ctx)).Scan(&job.ID)
+}
+
+func (r *sqliteRepository) CreateJob(ctx context.Context, job *Job) (*Job, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := r.insertJob(ctx, tx, job); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (r *sqliteRepository) GetJob(ctx context.Context, id int) (*Job, error) {
+	var job Job
+	err := scanJob(r.db.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE id=? AND tenant_id = COALESCE(NULLIF(?, ''), tenant_id)`, id, tenantFromContext(ctx)), &job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *sqliteRepository) CountPendingJobs(ctx context.Context, jobType string) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM jobs WHERE type=? AND status IN ('queued', 'running')`, jobType).Scan(&n)
+	return n, err
+}
+
+func (r *sqliteRepository) ClaimJob(ctx context.Context, now time.Time, lease time.Duration, region string, pinnedOnly bool) (*Job, error) {
+	var job Job
+	err := scanJob(r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET status='running', attempts=attempts+1, lease_until=?2, started_at=COALESCE(started_at, ?1)
+         WHERE id = (
+             SELECT id FROM jobs
+             WHERE (status='queued' OR (status='running' AND lease_until <= ?1))
+               AND (region = ?3 OR (region = '' AND NOT ?4))
+             ORDER BY id LIMIT 1)
+         RETURNING `+jobColumns,
+		now.UTC(), now.Add(lease).UTC(), region, pinnedOnly), &job)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *sqliteRepository) RenewJob(ctx context.Context, id int, leaseUntil time.Time) (bool, error) {
+	var cancelRequested bool
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET lease_until=? WHERE id=? AND status='running' RETURNING cancel_requested`,
+		leaseUntil.UTC(), id).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return cancelRequested, err
+}
+
+func (r *sqliteRepository) SaveJobProgress(ctx context.Context, id int, progress JobProgress) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE jobs SET progress_done=?, progress_total=? WHERE id=?`, progress.Done, progress.Total, id)
+	return err
+}
+
+func (r *sqliteRepository) FinishJob(ctx context.Context, job *Job) error {
+	var result any
+	if job.Result != nil {
+		result = string(job.Result)
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE jobs SET status=?, result=?, error=NULLIF(?, ''), completed_at=?, lease_until=NULL WHERE id=?`,
+		job.Status, result, job.Error, utcOrNil(job.CompletedAt), job.ID)
+	return err
+}
+
+func (r *sqliteRepository) CancelJob(ctx context.Context, id int, now time.Time) (*Job, error) {
+	var job Job
+	err := scanJob(r.db.QueryRowContext(ctx,
+		`UPDATE jobs SET
+             status=CASE WHEN status='queued' THEN 'cancelled' ELSE status END,
+             completed_at=CASE WHEN status='queued' THEN ?2 ELSE completed_at END,
+             cancel_requested=TRUE
+         WHERE id=?1 AND status IN ('queued', 'running') AND tenant_id = COALESCE(NULLIF(?3, ''), tenant_id)
+         RETURNING `+jobColumns,
+		id, now.UTC(), tenantFromContext(ctx)), &job)
+	if err == sql.ErrNoRows {
+		existing, err := r.GetJob(ctx, id)
+		if err != nil || existing == nil {
+			return nil, err
+		}
+		return nil, ErrJobFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *sqliteRepository) CreateAgreement(ctx context.Context, agreement *Agreement) (*Agreement, error) {
+	terms, err := json.Marshal(agreement.Terms)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO account_agreements(account_id, template_version, terms, sha256, document_key, created_at)
+         VALUES (?, ?, ?, ?, NULLIF(?, ''), ?) ON CONFLICT (account_id) DO NOTHING`,
+		agreement.AccountID, agreement.TemplateVersion, string(terms), agreement.SHA256, agreement.DocumentKey,
+		time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	var stored Agreement
+	err = scanAgreement(r.db.QueryRowContext(ctx,
+		`SELECT `+agreementColumns+` FROM account_agreements WHERE account_id=?`, agreement.AccountID), &stored)
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func (r *sqliteRepository) GetAgreement(ctx context.Context, accountID int) (*Agreement, error) {
+	var agreement Agreement
+	err := scanAgreement(r.db.QueryRowContext(ctx,
+		`SELECT `+agreementColumns+` FROM account_agreements WHERE account_id=?`, accountID), &agreement)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &agreement, nil
+}
+
+func (r *sqliteRepository) GetTenant(ctx context.Context, id string) (*Tenant, error) {
+	get, err := r.stmts.prepare(ctx, r.db, sqliteGetTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := get.QueryContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := scanTenants(rows)
+	if err != nil || len(tenants) == 0 {
+		return nil, err
+	}
+	return tenants[0], nil
+}
+
+func (r *sqliteRepository) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTenants(rows)
+}
+
+func (r *sqliteRepository) CreateTenant(ctx context.Context, tenant *Tenant) (*Tenant, error) {
+	tenant.CreatedAt = time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO tenants(id, name, created_at) VALUES (?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		tenant.ID, tenant.Name, tenant.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrTenantExists
+	}
+	return tenant, nil
+}
+
+func (r *sqliteRepository) ListTenantRates(ctx context.Context, tenant string) ([]*TenantRate, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+tenantRateColumns+` FROM tenant_rates WHERE tenant_id = COALESCE(NULLIF(?, ''), tenant_id)
+         ORDER BY tenant_id, period`,
+		tenant)
+	if err != nil {
+		return nil, err
+	}
+	return scanTenantRates(rows)
+}
+
+func (r *sqliteRepository) SaveTenantRate(ctx context.Context, rate *TenantRate) error {
+	now := time.Now().UTC()
+	rate.UpdatedAt = &now
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO tenant_rates(tenant_id, period, rate, updated_by, updated_at)
+         VALUES (?, ?, ?, ?, ?)
+         ON CONFLICT (tenant_id, period) DO UPDATE SET rate=excluded.rate, updated_by=excluded.updated_by,
+             updated_at=excluded.updated_at`,
+		rate.TenantID, rate.Period, rate.Rate, rate.UpdatedBy, now)
+	return err
+}
+
+func (r *sqliteRepository) DeleteTenantRate(ctx context.Context, tenant, period string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM tenant_rates WHERE tenant_id=? AND period=?`, tenant, period)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) ListProductDefinitions(ctx context.Context) ([]*ProductDefinition, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+productColumns+` FROM products ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	return scanProducts(rows)
+}
+
+func (r *sqliteRepository) SaveProductDefinition(ctx context.Context, product *ProductDefinition) error {
+	now := time.Now().UTC()
+	product.RetiredAt = nil
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO products(code, name, term_months, rate, min_principal, early_withdrawal, updated_by, created_at, updated_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+         ON CONFLICT (code) DO UPDATE SET name=excluded.name, term_months=excluded.term_months, rate=excluded.rate,
+             min_principal=excluded.min_principal, early_withdrawal=excluded.early_withdrawal, retired_at=NULL,
+             updated_by=excluded.updated_by, updated_at=excluded.updated_at
+         RETURNING created_at, updated_at`,
+		product.Code, product.Name, product.TermMonths, product.Rate, product.MinPrincipal, product.EarlyWithdrawal,
+		product.UpdatedBy, now, now).Scan(&product.CreatedAt, &product.UpdatedAt)
+}
+
+func (r *sqliteRepository) RetireProduct(ctx context.Context, code, staffID string) error {
+	now := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE products SET retired_at=?, updated_by=?, updated_at=? WHERE code=? AND retired_at IS NULL`,
+		now, staffID, now, code)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *sqliteRepository) GetAccountsByExternalID(ctx context.Context, externalIDs []string) ([]*BlockAccount, error) {
+	if len(externalIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(externalIDs, 2, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+accountColumns+` FROM block_accounts
+         WHERE external_id IN (`+in+`) AND tenant_id = COALESCE(NULLIF(?1, ''), tenant_id)`,
+		append([]any{tenantFromContext(ctx)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccounts(rows)
+}
+
+func (r *sqliteRepository) ListFundingsOf(ctx context.Context, accountIDs []int) ([]*Funding, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+fundingColumns+` FROM account_fundings WHERE account_id IN (`+in+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanFundings(rows)
+}
+
+func (r *sqliteRepository) ListInterestPayoutsOf(ctx context.Context, accountIDs []int) ([]*InterestPayout, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+interestPayoutColumns+` FROM interest_payouts WHERE account_id IN (`+in+`)
+         ORDER BY account_id, period_end`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanInterestPayouts(rows)
+}
+
+func (r *sqliteRepository) ListPayoutsOf(ctx context.Context, accountIDs []int) ([]*Payout, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+payoutColumns+` FROM payouts WHERE account_id IN (`+in+`)
+         ORDER BY account_id, created_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanPayouts(rows)
+}
+
+func (r *sqliteRepository) ListStatusChangesOf(ctx context.Context, accountIDs []int) ([]*StatusChange, error) {
+	if len(accountIDs) == 0 {
+		return nil, nil
+	}
+	in, args := inList(accountIDs, 1, func(n int) string { return "?" + strconv.Itoa(n) })
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+statusChangeColumns+` FROM account_status_history WHERE account_id IN (`+in+`)
+         ORDER BY account_id, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanStatusChanges(rows)
+}
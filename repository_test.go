@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"main.go/blockaccounttest"
+	"main.go/config"
+)
+
+// The repository tests run the same cases against every driver. SQLite uses
+// a file in the test's temp dir; PostgreSQL runs in a container started by
+// blockaccounttest.StartPostgres, and its tests are skipped without Docker
+// unless BLOCKACCOUNT_TEST_POSTGRES_URL names an empty database:
+//
+//	go test -run Repository
+//	BLOCKACCOUNT_TEST_POSTGRES_URL=postgres://... go test -run Repository
+
+// testDatabase returns the settings of an empty database of driver for t
+func testDatabase(t *testing.T, driver string) config.Database {
+	t.Helper()
+	cfg := config.Default().Database
+	cfg.Driver = driver
+	if driver == DriverSQLite {
+		cfg.SQLitePath = fmt.Sprintf("%s/test.db", t.TempDir())
+		return cfg
+	}
+	pg := blockaccounttest.StartPostgres(t)
+	cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name = pg.Host, pg.Port, pg.User, pg.Password, pg.Database
+	cfg.SSLMode = "disable"
+	return cfg
+}
+
+// testRepository returns a repository over a freshly migrated database
+func testRepository(t *testing.T, cfg config.Database) (Repository, *sql.DB) {
+	t.Helper()
+	db, err := openDatabase(cfg)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := newMigrator(db, cfg.Driver, zap.NewNop())
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	repo, err := newRepository(cfg.Driver, db, nil)
+	if err != nil {
+		t.Fatalf("new repository: %v", err)
+	}
+	return repo, db
+}
+
+func TestRepository(t *testing.T) {
+	for _, driver := range []string{DriverSQLite, DriverPostgres} {
+		t.Run(driver, func(t *testing.T) {
+			repo, _ := testRepository(t, testDatabase(t, driver))
+			for _, tc := range repositoryCases {
+				t.Run(tc.name, func(t *testing.T) { tc.run(t, repo) })
+			}
+		})
+	}
+}
+
+// repositoryCases share one database per driver, so each creates the
+// accounts it needs under user IDs no other case uses
+var repositoryCases = []struct {
+	name string
+	run  func(t *testing.T, repo Repository)
+}{
+	{"create and get", testRepositoryCreateAndGet},
+	{"list by user", testRepositoryListByUser},
+	{"tenant isolation", testRepositoryTenantIsolation},
+	{"status change check", testRepositoryStatusChangeCheck},
+	{"delete", testRepositoryDelete},
+	{"mature due once", testRepositoryMatureDueOnce},
+	{"worker lease", testRepositoryWorkerLease},
+	{"products", testRepositoryProducts},
+	{"account holders", testRepositoryAccountHolders},
+	{"admission", testRepositoryAdmission},
+}
+
+// testAccount returns an active 1y account of userID in the default tenant
+// that started at start
+func testAccount(userID int, start time.Time) *BlockAccount {
+	return &BlockAccount{
+		ExternalID:          uuid.NewString(),
+		UserID:              userID,
+		TenantID:            DefaultTenant,
+		Principal:           1000,
+		StartDate:           start,
+		EndDate:             start.AddDate(1, 0, 0),
+		InterestRate:        0.05,
+		Period:              "1y",
+		Status:              StatusActive,
+		MaturityInstruction: InstructionPayout,
+		PayoutFrequency:     FrequencyAtMaturity,
+	}
+}
+
+// mustCreate stores account or fails t
+func mustCreate(t *testing.T, repo Repository, account *BlockAccount) *BlockAccount {
+	t.Helper()
+	created, err := repo.CreateAccount(context.Background(), account, nil)
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	return created
+}
+
+func testRepositoryCreateAndGet(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, testAccount(101, time.Now().UTC()))
+	if created.ID == 0 || created.CreatedAt.IsZero() {
+		t.Fatalf("created = %+v, want its ID and timestamps set", created)
+	}
+
+	got, err := repo.GetAccount(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.ExternalID != created.ExternalID || got.Principal != 1000 || got.Status != StatusActive {
+		t.Errorf("get = %+v, want %+v", got, created)
+	}
+
+	id, err := repo.ResolveAccountID(ctx, created.ExternalID)
+	if err != nil || id != created.ID {
+		t.Errorf("resolve = %d, %v; want %d", id, err, created.ID)
+	}
+	if id, err := repo.ResolveAccountID(ctx, uuid.NewString()); err != nil || id != 0 {
+		t.Errorf("resolve unknown = %d, %v; want 0", id, err)
+	}
+
+	found, err := repo.GetAccountsByExternalID(ctx, []string{created.ExternalID, uuid.NewString()})
+	if err != nil || len(found) != 1 || found[0].ID != created.ID {
+		t.Errorf("by external ID = %v, %v; want only %d", found, err, created.ID)
+	}
+}
+
+func testRepositoryListByUser(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	start := time.Now().UTC().Add(-time.Hour)
+	var want []int
+	for i := 0; i < 3; i++ {
+		want = append(want, mustCreate(t, repo, testAccount(102, start)).ID)
+	}
+	mustCreate(t, repo, testAccount(103, start))
+
+	accounts, err := repo.ListAccountsByUser(ctx, 102)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(accounts) != len(want) {
+		t.Fatalf("listed %d accounts, want %d", len(accounts), len(want))
+	}
+	// Newest first
+	for i, a := range accounts {
+		if a.ID != want[len(want)-1-i] {
+			t.Errorf("accounts[%d] = %d, want %d", i, a.ID, want[len(want)-1-i])
+		}
+	}
+
+	overlapping, err := repo.ListAccountsOverlapping(ctx, 102, start.AddDate(0, 6, 0), start.AddDate(2, 0, 0))
+	if err != nil || len(overlapping) != len(want) {
+		t.Errorf("overlapping = %d accounts, %v; want %d", len(overlapping), err, len(want))
+	}
+	overlapping, err = repo.ListAccountsOverlapping(ctx, 102, start.AddDate(2, 0, 0), start.AddDate(3, 0, 0))
+	if err != nil || len(overlapping) != 0 {
+		t.Errorf("overlapping after maturity = %d accounts, %v; want none", len(overlapping), err)
+	}
+}
+
+func testRepositoryTenantIsolation(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	if _, err := repo.CreateTenant(ctx, &Tenant{ID: "acme", Name: "Acme Savings Bank"}); err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	account := testAccount(104, time.Now().UTC())
+	account.TenantID = "acme"
+	created := mustCreate(t, repo, account)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		visible bool
+	}{
+		{"own tenant", withTenant(ctx, "acme"), true},
+		{"other tenant", withTenant(ctx, DefaultTenant), false},
+		{"platform", ctx, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetAccount(tt.ctx, created.ID)
+			if err != nil || (got != nil) != tt.visible {
+				t.Errorf("get = %v, %v; visible %v", got, err, tt.visible)
+			}
+			accounts, err := repo.ListAccountsByUser(tt.ctx, 104)
+			if err != nil || (len(accounts) == 1) != tt.visible {
+				t.Errorf("list = %d accounts, %v; visible %v", len(accounts), err, tt.visible)
+			}
+		})
+	}
+}
+
+func testRepositoryStatusChangeCheck(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, testAccount(105, time.Now().UTC()))
+
+	refused := errors.New("refused")
+	if _, err := repo.UpdateAccountStatus(ctx, created.ID, StatusFrozen, func(*BlockAccount) error { return refused }); !errors.Is(err, refused) {
+		t.Fatalf("refused update: err = %v, want %v", err, refused)
+	}
+	if got, _ := repo.GetAccount(ctx, created.ID); got.Status != StatusActive {
+		t.Fatalf("status after a refused update = %s, want %s", got.Status, StatusActive)
+	}
+
+	updated, err := repo.UpdateAccountStatus(ctx, created.ID, StatusFrozen, func(*BlockAccount) error { return nil })
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Status != StatusFrozen || !updated.UpdatedAt.After(created.UpdatedAt) {
+		t.Errorf("updated = %+v, want frozen with a later updated_at", updated)
+	}
+	changes, err := repo.ListStatusChanges(ctx, created.ID)
+	if err != nil || len(changes) == 0 || changes[len(changes)-1].To != StatusFrozen {
+		t.Errorf("status changes = %v, %v; want the freeze last", changes, err)
+	}
+}
+
+func testRepositoryDelete(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	created := mustCreate(t, repo, testAccount(106, time.Now().UTC()))
+
+	if err := repo.DeleteAccount(ctx, created.ID, nil); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got, err := repo.GetAccount(ctx, created.ID); err != nil || got != nil {
+		t.Errorf("get deleted = %v, %v; want nil", got, err)
+	}
+	if err := repo.DeleteAccount(ctx, created.ID, nil); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("delete again: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testRepositoryMatureDueOnce(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	due := mustCreate(t, repo, testAccount(107, now.AddDate(-1, 0, -1)))
+
+	mature := func(a *BlockAccount) (*MaturityOutcome, error) {
+		return &MaturityOutcome{Status: StatusMatured}, nil
+	}
+	if _, err := repo.MatureDue(ctx, now, 1000, mature); err != nil {
+		t.Fatalf("mature: %v", err)
+	}
+	got, err := repo.GetAccount(ctx, due.ID)
+	if err != nil || got.Status != StatusMatured {
+		t.Fatalf("after maturing = %+v, %v; want matured", got, err)
+	}
+
+	// A second run finds nothing left to mature
+	n, err := repo.MatureDue(ctx, now, 1000, func(a *BlockAccount) (*MaturityOutcome, error) {
+		if a.ID == due.ID {
+			t.Errorf("account %d matured twice", a.ID)
+		}
+		return &MaturityOutcome{Status: StatusMatured}, nil
+	})
+	if err != nil {
+		t.Fatalf("mature again: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("matured %d accounts again, want 0", n)
+	}
+}
+
+func testRepositoryWorkerLease(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	const worker = "repository-test"
+
+	steps := []struct {
+		name   string
+		holder string
+		at     time.Time
+		want   bool
+	}{
+		{"first holder", "a", now, true},
+		{"other holder while held", "b", now.Add(time.Second), false},
+		{"holder renews", "a", now.Add(2 * time.Second), true},
+		{"other holder after expiry", "b", now.Add(time.Minute), true},
+	}
+	for _, s := range steps {
+		got, err := repo.AcquireWorkerLease(ctx, worker, s.holder, s.at, 10*time.Second)
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got != s.want {
+			t.Errorf("%s: acquired = %v, want %v", s.name, got, s.want)
+		}
+	}
+
+	if err := repo.ReleaseWorkerLease(ctx, worker, "b"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if got, err := repo.AcquireWorkerLease(ctx, worker, "a", now.Add(time.Minute), 10*time.Second); err != nil || !got {
+		t.Errorf("acquire after release = %v, %v; want true", got, err)
+	}
+}
+
+func testRepositoryProducts(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	byCode := func() map[string]*ProductDefinition {
+		t.Helper()
+		products, err := repo.ListProductDefinitions(ctx)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		m := map[string]*ProductDefinition{}
+		for _, p := range products {
+			m[p.Code] = p
+		}
+		return m
+	}
+	if builtin := byCode(); len(builtin) != len(builtinProducts) || builtin["3y"].TermMonths != 36 || builtin["3y"].Rate != 0.10 {
+		t.Fatalf("products after migrating = %v, want the built-in ones", builtin)
+	}
+
+	product := &ProductDefinition{Code: "2y", Name: "2-year deposit", TermMonths: 24, Rate: 0.07, MinPrincipal: 1000,
+		EarlyWithdrawal: EarlyWithdrawalApproval, UpdatedBy: "staff-1"}
+	if err := repo.SaveProductDefinition(ctx, product); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if product.CreatedAt.IsZero() || product.UpdatedAt.IsZero() {
+		t.Errorf("saved = %+v, want its timestamps set", product)
+	}
+
+	if err := repo.RetireProduct(ctx, "2y", "staff-2"); err != nil {
+		t.Fatalf("retire: %v", err)
+	}
+	if err := repo.RetireProduct(ctx, "2y", "staff-2"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("retire again: err = %v, want sql.ErrNoRows", err)
+	}
+	if got := byCode()["2y"]; got == nil || got.RetiredAt == nil || got.UpdatedBy != "staff-2" {
+		t.Fatalf("retired = %+v, want retired by staff-2", got)
+	}
+
+	// Defining a retired product again offers it again
+	product.Rate = 0.065
+	if err := repo.SaveProductDefinition(ctx, product); err != nil {
+		t.Fatalf("save again: %v", err)
+	}
+	got := byCode()["2y"]
+	if got.RetiredAt != nil || got.Rate != 0.065 || got.MinPrincipal != 1000 || got.EarlyWithdrawal != EarlyWithdrawalApproval {
+		t.Errorf("redefined = %+v, want it offered at 6.5%%", got)
+	}
+}
+
+func testRepositoryAccountHolders(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	joint := mustCreate(t, repo, testAccount(108, now.AddDate(-1, 0, -1)))
+
+	if err := repo.AddAccountHolder(ctx, &AccountHolder{AccountID: joint.ID, UserID: 109, Role: HolderSecondary, AddedBy: "customer"}); err != nil {
+		t.Fatalf("add holder: %v", err)
+	}
+	if err := repo.AddAccountHolder(ctx, &AccountHolder{AccountID: joint.ID, UserID: 109, Role: HolderSecondary}); err != ErrAlreadyHolder {
+		t.Errorf("add holder again: err = %v, want ErrAlreadyHolder", err)
+	}
+
+	holders, err := repo.ListAccountHolders(ctx, joint.ID)
+	if err != nil || len(holders) != 2 || holders[0].UserID != 108 || holders[0].Role != HolderPrimary ||
+		holders[1].UserID != 109 || holders[1].AddedBy != "customer" {
+		t.Fatalf("holders = %v, %v; want 108 primary then 109", holders, err)
+	}
+	accounts, err := repo.ListAccountsByUser(ctx, 109)
+	if err != nil || len(accounts) != 1 || accounts[0].ID != joint.ID {
+		t.Errorf("co-holder's accounts = %v, %v; want only %d", accounts, err, joint.ID)
+	}
+
+	// A rollover stays joint
+	var rollover *BlockAccount
+	if _, err := repo.MatureDue(ctx, now, 1000, func(a *BlockAccount) (*MaturityOutcome, error) {
+		if a.ID != joint.ID {
+			return &MaturityOutcome{Status: StatusMatured}, nil
+		}
+		rollover = testAccount(108, now)
+		return &MaturityOutcome{Status: StatusRolledOver, Rollover: rollover}, nil
+	}); err != nil {
+		t.Fatalf("mature: %v", err)
+	}
+	if ids, err := repo.ListSecondaryHolderIDs(ctx, []int{rollover.ID}); err != nil || len(ids) != 1 || ids[0] != 109 {
+		t.Errorf("rollover's secondary holders = %v, %v; want [109]", ids, err)
+	}
+
+	if err := repo.RemoveAccountHolder(ctx, joint.ID, 108); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("remove primary: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := repo.RemoveAccountHolder(ctx, joint.ID, 109); err != nil {
+		t.Fatalf("remove holder: %v", err)
+	}
+	if accounts, err := repo.ListAccountsByUser(ctx, 109); err != nil || len(accounts) != 1 || accounts[0].ID != rollover.ID {
+		t.Errorf("co-holder's accounts after removal = %v, %v; want only the rollover", accounts, err)
+	}
+}
+
+func testRepositoryAdmission(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	// An account the user co-holds counts towards what they hold
+	joint := mustCreate(t, repo, testAccount(111, now))
+	if err := repo.AddAccountHolder(ctx, &AccountHolder{AccountID: joint.ID, UserID: 110, Role: HolderSecondary}); err != nil {
+		t.Fatalf("add holder: %v", err)
+	}
+	if e, err := repo.GetUserExposure(withTenant(ctx, DefaultTenant), 110); err != nil || e.OpenAccounts != 1 || e.Principal != 1000 {
+		t.Fatalf("co-holder's exposure = %+v, %v; want the joint account", e, err)
+	}
+
+	// Creates racing for the user's last allowed account are admitted one at
+	// a time, so only one gets it
+	errFull := errors.New("user holds two accounts")
+	var wg sync.WaitGroup
+	results := make([]error, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, results[i] = repo.CreateAccount(ctx, testAccount(110, now), func(e UserExposure, _ *BlockAccount) error {
+				if e.OpenAccounts >= 2 {
+					return errFull
+				}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	created := 0
+	for _, err := range results {
+		switch {
+		case err == nil:
+			created++
+		case err != errFull:
+			t.Errorf("create: %v", err)
+		}
+	}
+	if e, err := repo.GetUserExposure(withTenant(ctx, DefaultTenant), 110); created != 1 || err != nil || e.OpenAccounts != 2 {
+		t.Errorf("%d admitted, exposure %+v, %v; want one more account", created, e, err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// External dependencies, the dependency label of their metrics. The
+// upper-cased name prefixes their settings, as in FUNDING_TIMEOUT.
+const (
+	DependencyUserService   = "user_service"
+	DependencyFunding       = "funding"
+	DependencySMS           = "sms"
+	DependencyNotifyWebhook = "notify_webhook"
+	DependencySMTP          = "smtp"
+)
+
+// Circuit breaker states, the values of dependencyCircuitState
+const (
+	circuitClosed = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+// Outcomes of a call, the outcome label of dependencyCalls
+const (
+	outcomeSuccess  = "success"
+	outcomeFailure  = "failure"
+	outcomeRejected = "rejected"
+)
+
+// ErrCircuitOpen is returned, wrapped with the dependency's name, for calls
+// refused without being made because the dependency's breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+var (
+	// dependencyCalls counts the calls to each dependency by how they ended:
+	// rejected calls were refused by an open breaker
+	dependencyCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockaccount_dependency_calls_total",
+		Help: "Calls to external dependencies, by dependency and outcome (success, failure, rejected).",
+	}, []string{"dependency", "outcome"})
+	// dependencyRetries counts the attempts made after a call's first
+	dependencyRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blockaccount_dependency_retries_total",
+		Help: "Attempts repeated after a failure, by dependency.",
+	}, []string{"dependency"})
+	// dependencyCircuitState is the state of each dependency's breaker
+	dependencyCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "blockaccount_dependency_circuit_state",
+		Help: "Circuit breaker state by dependency: 0 closed, 1 half-open, 2 open.",
+	}, []string{"dependency"})
+)
+
+// ResiliencePolicy is how calls to one dependency are bounded and retried
+type ResiliencePolicy struct {
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// MaxAttempts is how many times a retryable call is tried, 1 for no retries
+	MaxAttempts int
+	// Backoff is the most the first retry waits. Each retry after it may wait
+	// twice as long, up to maxRetryBackoff, and waits a random part of that.
+	Backoff time.Duration
+	// BreakerThreshold is how many failures in a row open the breaker; 0
+	// leaves it closed
+	BreakerThreshold int
+	// BreakerCooldown is how long an open breaker refuses calls before it
+	// lets one through to probe the dependency
+	BreakerCooldown time.Duration
+}
+
+// maxRetryBackoff caps the wait between two attempts
+const maxRetryBackoff = 5 * time.Second
+
+// resiliencePolicy returns defaults with the settings of dependency name
+// from the environment: <NAME>_TIMEOUT, <NAME>_MAX_ATTEMPTS,
+// <NAME>_RETRY_BACKOFF, <NAME>_BREAKER_THRESHOLD and <NAME>_BREAKER_COOLDOWN
+func resiliencePolicy(name string, defaults ResiliencePolicy) (ResiliencePolicy, error) {
+	p, prefix := defaults, strings.ToUpper(name)+"_"
+	durations := []struct {
+		key string
+		v   *time.Duration
+		min time.Duration
+	}{
+		{"TIMEOUT", &p.Timeout, time.Millisecond},
+		{"RETRY_BACKOFF", &p.Backoff, 0},
+		{"BREAKER_COOLDOWN", &p.BreakerCooldown, time.Millisecond},
+	}
+	for _, d := range durations {
+		if v := os.Getenv(prefix + d.key); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed < d.min {
+				return p, fmt.Errorf("%s%s must be a positive duration such as 5s", prefix, d.key)
+			}
+			*d.v = parsed
+		}
+	}
+	counts := []struct {
+		key string
+		v   *int
+		min int
+	}{
+		{"MAX_ATTEMPTS", &p.MaxAttempts, 1},
+		{"BREAKER_THRESHOLD", &p.BreakerThreshold, 0},
+	}
+	for _, c := range counts {
+		if v := os.Getenv(prefix + c.key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < c.min {
+				return p, fmt.Errorf("%s%s must be a whole number of at least %d", prefix, c.key, c.min)
+			}
+			*c.v = n
+		}
+	}
+	return p, nil
+}
+
+// permanentError is a failure that retrying will not fix, such as a 4xx
+// answer. It says nothing about the dependency's health, so it does not
+// count towards opening the breaker.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent marks err as not worth retrying
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// dependency guards the calls to one external service: each attempt gets
+// the policy's timeout, retryable calls are retried with jittered
+// exponential backoff, and a circuit breaker stops calls to a service that
+// keeps failing until it has had time to recover. A dependency is shared by
+// every call to its service in the process.
+type dependency struct {
+	name   string
+	policy ResiliencePolicy
+	now    func() time.Time
+	// sleep waits between attempts; it returns ctx's error when ctx ends first
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	// probing is set while the one call a half-open breaker lets through runs
+	probing bool
+}
+
+// newDependency returns the guard of dependency name, with defaults
+// overridden by its settings
+func newDependency(name string, defaults ResiliencePolicy) (*dependency, error) {
+	policy, err := resiliencePolicy(name, defaults)
+	if err != nil {
+		return nil, err
+	}
+	dependencyCircuitState.WithLabelValues(name).Set(circuitClosed)
+	return &dependency{name: name, policy: policy, now: time.Now, sleep: sleepContext}, nil
+}
+
+// sleepContext waits for d or until ctx ends
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// call runs fn, retrying it as the policy allows. Only calls that are safe
+// to repeat, such as lookups, should be made with call; the rest use
+// callOnce.
+func (d *dependency) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.run(ctx, d.policy.MaxAttempts, fn)
+}
+
+// callOnce runs fn a single time, under the policy's timeout and breaker
+func (d *dependency) callOnce(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.run(ctx, 1, fn)
+}
+
+func (d *dependency) run(ctx context.Context, attempts int, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if d.sleep(ctx, d.backoff(attempt)) != nil {
+				break
+			}
+			dependencyRetries.WithLabelValues(d.name).Inc()
+		}
+		if rejected := d.allow(); rejected != nil {
+			dependencyCalls.WithLabelValues(d.name, outcomeRejected).Inc()
+			if err == nil {
+				err = rejected
+			}
+			return err
+		}
+		err = d.attempt(ctx, fn)
+		var perm *permanentError
+		switch {
+		case err == nil:
+			d.record(true)
+			dependencyCalls.WithLabelValues(d.name, outcomeSuccess).Inc()
+			return nil
+		case errors.As(err, &perm):
+			// The service answered, so it is up
+			d.record(true)
+			dependencyCalls.WithLabelValues(d.name, outcomeFailure).Inc()
+			return perm.err
+		case ctx.Err() != nil:
+			// The caller gave up, which says nothing about the service
+			d.release()
+			dependencyCalls.WithLabelValues(d.name, outcomeFailure).Inc()
+			return err
+		}
+		d.record(false)
+		dependencyCalls.WithLabelValues(d.name, outcomeFailure).Inc()
+	}
+	return err
+}
+
+// attempt runs fn once under the policy's timeout
+func (d *dependency) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, d.policy.Timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// backoff returns how long to wait before the given retry: a random
+// duration up to Backoff doubled for each earlier retry, capped at
+// maxRetryBackoff
+func (d *dependency) backoff(retry int) time.Duration {
+	ceiling := d.policy.Backoff
+	for i := 1; i < retry && ceiling < maxRetryBackoff; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, maxRetryBackoff)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// allow reports whether a call may be made now, moving an open breaker
+// whose cooldown has passed to half-open. It returns the error of a
+// refused call.
+func (d *dependency) allow() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch d.state {
+	case circuitOpen:
+		if d.now().Sub(d.openedAt) < d.policy.BreakerCooldown {
+			return fmt.Errorf("%s: %w", d.name, ErrCircuitOpen)
+		}
+		d.setState(circuitHalfOpen)
+		d.probing = true
+	case circuitHalfOpen:
+		if d.probing {
+			return fmt.Errorf("%s: %w", d.name, ErrCircuitOpen)
+		}
+		d.probing = true
+	}
+	return nil
+}
+
+// record counts the result of a call: a success closes the breaker, and a
+// failure reopens a half-open one or opens a closed one at the threshold
+func (d *dependency) record(ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.probing = false
+	if ok {
+		d.failures = 0
+		d.setState(circuitClosed)
+		return
+	}
+	d.failures++
+	if d.state == circuitHalfOpen || (d.policy.BreakerThreshold > 0 && d.failures >= d.policy.BreakerThreshold) {
+		d.openedAt = d.now()
+		d.setState(circuitOpen)
+	}
+}
+
+// release lets a half-open breaker probe again after a call ended without
+// a verdict on the service
+func (d *dependency) release() {
+	d.mu.Lock()
+	d.probing = false
+	d.mu.Unlock()
+}
+
+// setState moves the breaker to state; d.mu must be held
+func (d *dependency) setState(state int) {
+	d.state = state
+	dependencyCircuitState.WithLabelValues(d.name).Set(float64(state))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testDependency returns a dependency whose clock is at *now and that does
+// not wait between attempts
+func testDependency(t *testing.T, policy ResiliencePolicy, now *time.Time) *dependency {
+	t.Helper()
+	d, err := newDependency("test_dependency", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.now = func() time.Time { return *now }
+	d.sleep = func(context.Context, time.Duration) error { return nil }
+	return d
+}
+
+func TestDependencyRetries(t *testing.T) {
+	now := time.Now()
+	d := testDependency(t, ResiliencePolicy{Timeout: time.Second, MaxAttempts: 3}, &now)
+	failure := errors.New("connection reset")
+
+	calls := 0
+	err := d.call(context.Background(), func(context.Context) error {
+		if calls++; calls < 3 {
+			return failure
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("retried call = %v after %d attempts, want success after 3", err, calls)
+	}
+
+	calls = 0
+	err = d.call(context.Background(), func(context.Context) error {
+		calls++
+		return permanent(failure)
+	})
+	if err != failure || calls != 1 {
+		t.Errorf("permanent failure = %v after %d attempts, want it unwrapped after 1", err, calls)
+	}
+
+	calls = 0
+	if err := d.callOnce(context.Background(), func(context.Context) error { calls++; return failure }); err != failure || calls != 1 {
+		t.Errorf("callOnce = %v after %d attempts", err, calls)
+	}
+
+	err = d.call(context.Background(), func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("attempt has no deadline")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDependencyBackoff(t *testing.T) {
+	d := &dependency{policy: ResiliencePolicy{Backoff: 100 * time.Millisecond}}
+	for retry, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 20: maxRetryBackoff} {
+		for range 50 {
+			if wait := d.backoff(retry); wait < 0 || wait > ceiling {
+				t.Fatalf("backoff(%d) = %v, want at most %v", retry, wait, ceiling)
+			}
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	d := testDependency(t, ResiliencePolicy{Timeout: time.Second, MaxAttempts: 1, BreakerThreshold: 2, BreakerCooldown: time.Minute}, &now)
+	fail := func(context.Context) error { return errors.New("503 Service Unavailable") }
+	succeed := func(context.Context) error { return nil }
+
+	d.call(context.Background(), fail)
+	d.call(context.Background(), func(context.Context) error { return permanent(errors.New("404 Not Found")) })
+	d.call(context.Background(), fail)
+	if d.state != circuitClosed {
+		t.Fatalf("state = %d after failures broken by an answer, want closed", d.state)
+	}
+	d.call(context.Background(), fail)
+	if d.state != circuitOpen {
+		t.Fatalf("state = %d after 2 failures in a row, want open", d.state)
+	}
+
+	called := false
+	err := d.call(context.Background(), func(context.Context) error { called = true; return nil })
+	if !errors.Is(err, ErrCircuitOpen) || called {
+		t.Errorf("call through open breaker = %v, called %v", err, called)
+	}
+
+	// After the cooldown one probe is let through; failing it reopens the breaker
+	now = now.Add(time.Minute)
+	if err := d.call(context.Background(), fail); errors.Is(err, ErrCircuitOpen) || d.state != circuitOpen {
+		t.Errorf("failed probe = %v, state %d", err, d.state)
+	}
+	if err := d.call(context.Background(), succeed); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("call after failed probe = %v, want refused", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := d.call(context.Background(), succeed); err != nil || d.state != circuitClosed {
+		t.Errorf("successful probe = %v, state %d", err, d.state)
+	}
+}
+
+func TestResiliencePolicySettings(t *testing.T) {
+	t.Setenv("TEST_DEPENDENCY_TIMEOUT", "250ms")
+	t.Setenv("TEST_DEPENDENCY_MAX_ATTEMPTS", "5")
+	t.Setenv("TEST_DEPENDENCY_BREAKER_THRESHOLD", "0")
+	p, err := resiliencePolicy("test_dependency", ResiliencePolicy{Timeout: time.Second, MaxAttempts: 1, BreakerThreshold: 5, BreakerCooldown: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Timeout != 250*time.Millisecond || p.MaxAttempts != 5 || p.BreakerThreshold != 0 || p.BreakerCooldown != time.Minute {
+		t.Errorf("policy = %+v", p)
+	}
+
+	t.Setenv("TEST_DEPENDENCY_MAX_ATTEMPTS", "0")
+	if _, err := resiliencePolicy("test_dependency", ResiliencePolicy{}); err == nil {
+		t.Error("0 attempts accepted")
+	}
+}
+
+func TestUserServiceResilience(t *testing.T) {
+	var calls atomic.Int32
+	failing := atomic.Bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch {
+		case failing.Load():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/users/403":
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("USER_SERVICE_URL", server.URL+"/users/{id}")
+	t.Setenv("USER_SERVICE_RETRY_BACKOFF", "0s")
+	t.Setenv("USER_SERVICE_BREAKER_THRESHOLD", "2")
+
+	v, err := newHTTPUserValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if exists, err := v.UserExists(ctx, 403); err == nil || exists || calls.Load() != 1 {
+		t.Errorf("403 = %v %v after %d calls, want an error without retries", exists, err, calls.Load())
+	}
+
+	failing.Store(true)
+	calls.Store(0)
+	if _, err := v.UserExists(ctx, 1); err == nil || calls.Load() != 2 {
+		t.Errorf("failing service = %v after %d calls, want the breaker to open on the second", err, calls.Load())
+	}
+	if _, err := v.UserExists(ctx, 1); !errors.Is(err, ErrCircuitOpen) || calls.Load() != 2 {
+		t.Errorf("open breaker = %v after %d calls", err, calls.Load())
+	}
+
+	s := &service{users: v, logger: zap.NewNop()}
+	if err := s.checkUserExists(ctx, 1); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("check without fallback = %v", err)
+	}
+	t.Setenv("USER_SERVICE_FALLBACK", "allow")
+	if err := s.checkUserExists(ctx, 1); err != nil {
+		t.Errorf("check with fallback = %v", err)
+	}
+}
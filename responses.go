@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// BareMediaType is the media type a client lists in Accept to get resources
+// without the success envelope. Errors keep their format either way.
+const BareMediaType = "application/vnd.block-account.bare+json"
+
+// List pages from v2 on hold defaultPageLimit items unless the request asks
+// for up to maxPageLimit
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// Page is the envelope of every list from v2 on
+// @Description One page of a list. Pass next_cursor as the cursor query parameter for the next page.
+type Page struct {
+	Items interface{} `json:"items"`
+	// NextCursor is left out on the last page
+	NextCursor string `json:"next_cursor,omitempty" example:"NTA"`
+	Limit      int    `json:"limit" example:"50"`
+}
+
+// writeSuccessStatus writes a success response with status in the format
+// the request's Accept header prefers: enveloped JSON, bare JSON, the
+// envelope as XML, or the data alone as CSV. Account numbers in data are
+// masked whichever it is.
+func writeSuccessStatus(w http.ResponseWriter, r *http.Request, status int, data interface{}, message string) {
+	w.Header().Add("Vary", "Accept")
+	data = maskAccountNumbers(data)
+	envelope := SuccessResponse{
+		Success: true,
+		Data:    data,
+		Message: message,
+	}
+	format := responseFormat(r)
+	var body []byte
+	var err error
+	switch format {
+	case formatXML:
+		body, err = encodeXML("response", envelope)
+	case formatCSV:
+		body, err = encodeCSV(data)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.WriteHeader(status)
+	switch format {
+	case formatBare:
+		json.NewEncoder(w).Encode(data)
+	case formatXML, formatCSV:
+		w.Write(body)
+	default:
+		json.NewEncoder(w).Encode(envelope)
+	}
+}
+
+// writeCreated writes the resource a POST created, with its URL in
+// Location. v2 answers 201 Created; v1 keeps the 200 its clients expect.
+func writeCreated(w http.ResponseWriter, r *http.Request, location string, data interface{}, message string) {
+	w.Header().Set("Location", location)
+	status := http.StatusCreated
+	if requestAPIVersion(r) == "v1" {
+		status = http.StatusOK
+	}
+	writeSuccessStatus(w, r, status, data, message)
+}
+
+// listPage is the part of a list a request asked for. v1 lists are not
+// paginated, so in v1 it is the whole list.
+type listPage struct {
+	offset, limit int
+	all           bool
+}
+
+// pageParams reads the limit and cursor query parameters of a list
+// request, writing the error response and returning false when either is
+// invalid
+func pageParams(w http.ResponseWriter, r *http.Request) (listPage, bool) {
+	if requestAPIVersion(r) == "v1" {
+		return listPage{all: true}, true
+	}
+
+	page := listPage{limit: defaultPageLimit}
+	query := r.URL.Query()
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return listPage{}, false
+		}
+		page.limit = n
+	}
+	if v := query.Get("cursor"); v != "" {
+		offset, ok := decodeCursor(v)
+		if !ok {
+			writeErrorCode(w, http.StatusBadRequest, CodeInvalidCursor, "cursor is not one returned by this list")
+			return listPage{}, false
+		}
+		page.offset = offset
+	}
+	return page, true
+}
+
+// end returns the index just past the page
+func (p listPage) end() int {
+	return p.offset + p.limit
+}
+
+// encodeCursor returns the cursor of the page starting at offset. Cursors
+// are opaque to clients so the paging scheme can change.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset of a cursor from encodeCursor
+func decodeCursor(cursor string) (int, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	offset, err := strconv.Atoi(string(raw))
+	return offset, err == nil && offset >= 0
+}
+
+// writeList writes the page of items that page covers as a Page, with a
+// Link to the next page when there is one. A whole list, in v1, is written
+// as it is.
+func writeList[T any](w http.ResponseWriter, r *http.Request, page listPage, items []T, message string) {
+	if page.all {
+		writeSuccess(w, r, items, message)
+		return
+	}
+
+	start := min(page.offset, len(items))
+	end := min(start+page.limit, len(items))
+	resp := Page{Items: append([]T{}, items[start:end]...), Limit: page.limit}
+	if end < len(items) {
+		resp.NextCursor = encodeCursor(end)
+		next := *r.URL
+		query := next.Query()
+		query.Set("cursor", resp.NextCursor)
+		next.RawQuery = query.Encode()
+		w.Header().Add("Link", "<"+next.RequestURI()+`>; rel="next"`)
+	}
+	writeSuccess(w, r, resp, message)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultSandboxTimeScale lets a day of a sandbox account's life pass in
+	// a minute, so a 3m deposit matures in about an hour and a half
+	defaultSandboxTimeScale = 24 * 60
+	// sandboxKeyLifetime is how long a self-service sandbox key works
+	sandboxKeyLifetime = 30 * 24 * time.Hour
+	// sandboxKeyCreator is recorded as the issuer of self-service keys
+	sandboxKeyCreator = "sandbox-signup"
+	// SandboxHeader marks every response of a sandbox deployment
+	SandboxHeader = "X-Sandbox"
+)
+
+// sandboxMode reports whether this is a sandbox deployment, set by
+// SANDBOX=true. A sandbox is where partner developers integrate: accounts
+// live on an accelerated clock, funding is faked and anyone may issue
+// themselves an API key. It runs against its own database.
+func sandboxMode() bool {
+	return os.Getenv("SANDBOX") == "true"
+}
+
+// sandboxTimeScale returns how many times faster than real time account
+// terms run: SANDBOX_TIME_SCALE in a sandbox, and 1 everywhere else
+func sandboxTimeScale() float64 {
+	if !sandboxMode() {
+		return 1
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("SANDBOX_TIME_SCALE"), 64); err == nil && v >= 1 {
+		return v
+	}
+	return defaultSandboxTimeScale
+}
+
+// compressTerm returns when a span from start to end, dated on the
+// calendar, ends on the sandbox's clock. Outside a sandbox it is end.
+func compressTerm(start, end time.Time) time.Time {
+	scale := sandboxTimeScale()
+	if scale == 1 {
+		return end
+	}
+	return start.Add(time.Duration(float64(end.Sub(start)) / scale))
+}
+
+// checkSandboxConfig fails on sandbox settings that cannot be used
+func checkSandboxConfig() error {
+	if !sandboxMode() {
+		return nil
+	}
+	if v := os.Getenv("SANDBOX_TIME_SCALE"); v != "" {
+		if scale, err := strconv.ParseFloat(v, 64); err != nil || scale < 1 {
+			return fmt.Errorf("invalid SANDBOX_TIME_SCALE: %s", v)
+		}
+	}
+	if p := os.Getenv("FUNDING_PROVIDER"); p != "" && p != FundingProviderSandbox {
+		return fmt.Errorf("FUNDING_PROVIDER=%s cannot be used in a sandbox, which never moves real money", p)
+	}
+	return nil
+}
+
+// checkDeployment refuses to run a sandbox against a production database or
+// production against a sandbox one. The first server or worker to start
+// against a database claims it for its kind of deployment.
+func (a *app) checkDeployment(ctx context.Context) error {
+	sandbox, err := a.repo.ClaimDeployment(ctx, sandboxMode(), time.Now().UTC())
+	switch {
+	case err != nil:
+		return fmt.Errorf("check deployment: %w", err)
+	case sandbox && !sandboxMode():
+		return fmt.Errorf("the database belongs to a sandbox; set SANDBOX=true or use a production database")
+	case !sandbox && sandboxMode():
+		return fmt.Errorf("the database belongs to a production deployment; a sandbox needs a database of its own")
+	}
+	return nil
+}
+
+// withDeployment adapts a function needing the app into a cobra RunE, like
+// withApp, for commands that read or change accounts. It loads the product
+// catalog and a sandbox's clock and keeps them current while the command
+// runs.
+func withDeployment(run func(ctx context.Context, a *app, args []string) error) func(*cobra.Command, []string) error {
+	return withApp(func(ctx context.Context, a *app, args []string) error {
+		if err := a.checkDeployment(ctx); err != nil {
+			a.logger.Error("Deployment mismatch", zap.Error(err))
+			return err
+		}
+		if err := watchProducts(ctx, a.repo, a.logger); err != nil {
+			return err
+		}
+		if err := watchClock(ctx, a.repo, a.clock, a.logger); err != nil {
+			return err
+		}
+		return run(ctx, a, args)
+	})
+}
+
+// sandboxHeaders marks responses as coming from a sandbox
+func sandboxHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(SandboxHeader, "true")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SandboxKeyRequest is the payload for issuing oneself a sandbox API key
+// @Description Request payload for a self-service sandbox API key
+type SandboxKeyRequest struct {
+	// Name identifies the integration, e.g. the partner and app
+	Name string `json:"name" example:"acme-payroll-dev" validate:"notblank,max=100"`
+}
+
+// issueSandboxKeyHandler godoc
+// @Summary Issue a sandbox API key
+// @Description Issues a read and write API key that works for 30 days, without credentials. Only served by sandbox deployments.
+// @Tags sandbox
+// @Accept json
+// @Produce json
+// @Param request body SandboxKeyRequest true "Key name"
+// @Success 201 {object} APIKey
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/sandbox/keys [post]
+func issueSandboxKeyHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	var req SandboxKeyRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	expiresAt := time.Now().UTC().Add(sandboxKeyLifetime)
+	apiKey, err := svc.IssueAPIKey(ctx, sandboxKeyCreator, &IssueAPIKeyRequest{
+		Name:      req.Name,
+		Scopes:    []string{ScopeRead, ScopeWrite},
+		ExpiresAt: &expiresAt,
+		TenantID:  DefaultTenant,
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	writeSuccessStatus(w, r, http.StatusCreated, apiKey, "Sandbox API key issued; store it now, it will not be shown again")
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Jobs the scheduler drives. Each takes the lease of the standalone worker
+// of the same name, so a job never runs in both at once.
+const (
+	ScheduledJobMaturity       = "maturity"
+	ScheduledJobAccrual        = "accrual"
+	ScheduledJobReconciliation = "reconciliation"
+	ScheduledJobReports        = "reports"
+	ScheduledJobRetention      = "retention"
+)
+
+// scheduledJobNames are the jobs the scheduler drives, in the order they are listed
+var scheduledJobNames = []string{ScheduledJobMaturity, ScheduledJobAccrual, ScheduledJobReconciliation, ScheduledJobReports, ScheduledJobRetention}
+
+// How a scheduled job's last run ended
+const (
+	ScheduledRunSucceeded = "succeeded"
+	ScheduledRunFailed    = "failed"
+)
+
+// schedulerPollInterval is how often the scheduler checks for due jobs and
+// for pauses and runs triggered through the admin API
+const schedulerPollInterval = 5 * time.Second
+
+// ErrUnknownScheduledJob is returned for a job the scheduler does not drive
+var ErrUnknownScheduledJob = newAPIError(CodeUnknownScheduledJob, "scheduled job does not exist")
+
+// ScheduledJob is the state of a job the scheduler drives
+// @Description A periodic job run by `worker scheduler`: its cron schedule, whether it is paused, and its last and next runs
+type ScheduledJob struct {
+	Job string `json:"job" example:"maturity"`
+	// Schedule is the cron expression, in BUSINESS_TIMEZONE, the scheduler
+	// last started with; empty until a scheduler has run
+	Schedule string `json:"schedule" example:"* * * * *"`
+	// Paused jobs are not run on their schedule, only when triggered
+	Paused   bool   `json:"paused" example:"false"`
+	PausedBy string `json:"paused_by,omitempty" example:"staff-42"`
+	// TriggerRequestedAt is set while a triggered run waits to start
+	TriggerRequestedAt *time.Time `json:"trigger_requested_at,omitempty"`
+	TriggerRequestedBy string     `json:"trigger_requested_by,omitempty" example:"staff-42"`
+	// RunningSince is set while the job runs
+	RunningSince   *time.Time `json:"running_since,omitempty"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty"`
+	LastStatus     string     `json:"last_status,omitempty" enums:"succeeded,failed" example:"succeeded"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// periodicJob is a job the scheduler runs on a cron schedule
+type periodicJob struct {
+	name  string
+	sched *cronSchedule
+	run   func(context.Context) error
+}
+
+// scheduler runs periodic jobs on their cron schedules, evaluated in loc.
+// A job that is still running when it falls due again is not started a
+// second time; the run is skipped, as are runs missed while it was busy.
+// Each run takes the job's worker lease, so across replicas too a job runs
+// once at a time. Pauses and triggered runs are read from scheduled_jobs
+// every schedulerPollInterval, and each run's start and end recorded there.
+type scheduler struct {
+	svc  *service
+	loc  *time.Location
+	jobs []*periodicJob
+
+	mu      sync.Mutex
+	running map[string]bool
+	next    map[string]time.Time
+	wg      sync.WaitGroup
+}
+
+// newScheduler returns a scheduler of jobs, each run as the leader of its
+// worker lease in the active region and reported on the operations channel
+// when it fails. It refuses a schedule that never runs.
+func (s *service) newScheduler(loc *time.Location, lease time.Duration, jobs ...*periodicJob) (*scheduler, error) {
+	sc := &scheduler{svc: s, loc: loc, running: map[string]bool{}, next: map[string]time.Time{}}
+	for _, j := range jobs {
+		if j.sched.next(time.Now().In(loc)).IsZero() {
+			return nil, fmt.Errorf("schedule %q of %s never runs", j.sched.expr, j.name)
+		}
+		sc.jobs = append(sc.jobs, &periodicJob{
+			name:  j.name,
+			sched: j.sched,
+			run:   s.reportJobFailures(j.name, s.inActiveRegion(j.name, s.asLeader(j.name, lease, sc.recorded(j.name, j.run)))),
+		})
+	}
+	return sc, nil
+}
+
+// recorded wraps a job's run so its start and end are recorded on the job's
+// state. Failing to record them is logged rather than failing the run.
+func (sc *scheduler) recorded(name string, run func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if err := sc.svc.repo.StartScheduledRun(ctx, name, time.Now().UTC()); err != nil {
+			sc.svc.log(ctx).Warn("Failed to record scheduled run start", zap.String("job", name), zap.Error(err))
+		}
+		err := run(ctx)
+		var runErr string
+		if err != nil {
+			runErr = err.Error()
+		}
+		// A run stopped by shutdown is still recorded as ended
+		recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if ferr := sc.svc.repo.FinishScheduledRun(recordCtx, name, time.Now().UTC(), runErr); ferr != nil {
+			sc.svc.log(ctx).Warn("Failed to record scheduled run end", zap.String("job", name), zap.Error(ferr))
+		}
+		return err
+	}
+}
+
+// Run schedules every job and runs them as they fall due or are triggered
+// until ctx is cancelled, then waits for the runs under way to stop
+func (sc *scheduler) Run(ctx context.Context) {
+	now := time.Now()
+	for _, j := range sc.jobs {
+		sc.schedule(ctx, j, now)
+	}
+	ticker := time.NewTicker(schedulerPollInterval)
+	defer ticker.Stop()
+	for {
+		sc.tick(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			sc.wg.Wait()
+			sc.svc.log(ctx).Info("Scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// schedule works out j's next run after now and records it
+func (sc *scheduler) schedule(ctx context.Context, j *periodicJob, now time.Time) {
+	next := j.sched.next(now.In(sc.loc))
+	sc.mu.Lock()
+	sc.next[j.name] = next
+	sc.mu.Unlock()
+	if err := sc.svc.repo.ScheduleJob(ctx, j.name, j.sched.expr, next); err != nil && ctx.Err() == nil {
+		sc.svc.log(ctx).Warn("Failed to record next scheduled run", zap.String("job", j.name), zap.Error(err))
+	}
+	sc.svc.log(ctx).Debug("Next scheduled run", zap.String("job", j.name), zap.Time("at", next))
+}
+
+// tick starts the jobs that are due at now and not paused, and those
+// triggered, unless they are already running. Nothing is started while the
+// jobs' state cannot be read, so a pause is never missed.
+func (sc *scheduler) tick(ctx context.Context, now time.Time) {
+	states, err := sc.svc.repo.ListScheduledJobs(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			sc.svc.log(ctx).Warn("Failed to read scheduled jobs", zap.Error(err))
+		}
+		return
+	}
+	byName := make(map[string]*ScheduledJob, len(states))
+	for _, st := range states {
+		byName[st.Job] = st
+	}
+
+	for _, j := range sc.jobs {
+		st := byName[j.name]
+		sc.mu.Lock()
+		due, running := !now.Before(sc.next[j.name]), sc.running[j.name]
+		sc.mu.Unlock()
+		if due {
+			sc.schedule(ctx, j, now)
+		}
+		triggered := st != nil && st.TriggerRequestedAt != nil
+		switch {
+		case running:
+			if due {
+				sc.svc.log(ctx).Info("Scheduled run skipped, the last one is still running", zap.String("job", j.name))
+			}
+		case triggered || (due && (st == nil || !st.Paused)):
+			sc.start(ctx, j)
+		case due:
+			sc.svc.log(ctx).Info("Scheduled run skipped, the job is paused", zap.String("job", j.name))
+		}
+	}
+}
+
+// start runs j in the background
+func (sc *scheduler) start(ctx context.Context, j *periodicJob) {
+	sc.mu.Lock()
+	sc.running[j.name] = true
+	sc.mu.Unlock()
+	sc.wg.Add(1)
+	go func() {
+		defer sc.wg.Done()
+		defer func() {
+			sc.mu.Lock()
+			delete(sc.running, j.name)
+			sc.mu.Unlock()
+		}()
+		if err := j.run(ctx); err != nil && ctx.Err() == nil {
+			sc.svc.log(ctx).Error("Scheduled job failed", zap.String("job", j.name), zap.Error(err))
+		}
+	}()
+}
+
+// scheduledJob returns job's state, or a blank one when it has none yet
+func (s *service) scheduledJob(ctx context.Context, job string) (*ScheduledJob, error) {
+	st, err := s.repo.GetScheduledJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		st = &ScheduledJob{Job: job}
+	}
+	return st, nil
+}
+
+// ListScheduledJobs returns the state of every job the scheduler drives,
+// blank for those no scheduler has run, paused or triggered yet
+func (s *service) ListScheduledJobs(ctx context.Context) ([]*ScheduledJob, error) {
+	states, err := s.repo.ListScheduledJobs(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to list scheduled jobs", zap.Error(err))
+		return nil, err
+	}
+	byName := make(map[string]*ScheduledJob, len(states))
+	for _, st := range states {
+		byName[st.Job] = st
+	}
+	jobs := make([]*ScheduledJob, 0, len(scheduledJobNames))
+	for _, name := range scheduledJobNames {
+		st := byName[name]
+		if st == nil {
+			st = &ScheduledJob{Job: name}
+		}
+		jobs = append(jobs, st)
+	}
+	return jobs, nil
+}
+
+// PauseScheduledJob stops or resumes running job on its schedule. A paused
+// job can still be triggered; a run under way is not stopped.
+func (s *service) PauseScheduledJob(ctx context.Context, job, staffID string, paused bool) (*ScheduledJob, error) {
+	if !slices.Contains(scheduledJobNames, job) {
+		return nil, ErrUnknownScheduledJob
+	}
+	pausedBy, verb := staffID, "paused"
+	if !paused {
+		pausedBy, verb = "", "resumed"
+	}
+	if err := s.repo.PauseScheduledJob(ctx, job, paused, pausedBy); err != nil {
+		s.log(ctx).Error("Failed to pause scheduled job", zap.Error(err), zap.String("job", job))
+		return nil, err
+	}
+	s.log(ctx).Info("Scheduled job "+verb, zap.String("job", job), zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Scheduled job %s %s", job, verb),
+		map[string]any{"setting": "scheduled_job", "job": job, "paused": paused, "changed_by": staffID})
+	return s.scheduledJob(ctx, job)
+}
+
+// TriggerScheduledJob asks the scheduler for a run of job now, paused or
+// not. The run starts within schedulerPollInterval, or once a run under way
+// ends.
+func (s *service) TriggerScheduledJob(ctx context.Context, job, staffID string) (*ScheduledJob, error) {
+	if !slices.Contains(scheduledJobNames, job) {
+		return nil, ErrUnknownScheduledJob
+	}
+	if err := s.repo.TriggerScheduledJob(ctx, job, s.Now().UTC(), staffID); err != nil {
+		s.log(ctx).Error("Failed to trigger scheduled job", zap.Error(err), zap.String("job", job))
+		return nil, err
+	}
+	s.log(ctx).Info("Scheduled job triggered", zap.String("job", job), zap.String("staffID", staffID))
+	return s.scheduledJob(ctx, job)
+}
+
+// listScheduledJobsHandler godoc
+// @Summary List scheduled jobs
+// @Description Lists the jobs `worker scheduler` runs on cron schedules (maturity, accrual, reconciliation, reports and retention) with their schedules, whether they are paused or triggered, whether they are running, and their last and next runs
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]ScheduledJob}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/scheduler/jobs [get]
+func listScheduledJobsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	jobs, err := svc.ListScheduledJobs(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, jobs, "Scheduled jobs retrieved successfully")
+}
+
+// triggerScheduledJobHandler godoc
+// @Summary Trigger a scheduled job
+// @Description Asks the scheduler to run the job now, even if it is paused. The run starts within 5 seconds, or when a run under way ends; triggering again before it starts asks for the same run. Poll GET /admin/scheduler/jobs for its progress.
+// @Tags admin
+// @Produce json
+// @Param job path string true "Job" Enums(maturity, accrual, reconciliation, reports, retention)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Success 202 {object} ScheduledJob
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/scheduler/jobs/{job}/trigger [post]
+func triggerScheduledJobHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := svc.TriggerScheduledJob(ctx, chi.URLParam(r, "job"), staffID)
+	switch {
+	case err == ErrUnknownScheduledJob:
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	writeSuccessStatus(w, r, http.StatusAccepted, job, "Scheduled job triggered")
+}
+
+// pauseScheduledJobHandler godoc
+// @Summary Pause a scheduled job
+// @Description Stops the scheduler running the job on its schedule until it is resumed. A run under way finishes, and the job can still be triggered.
+// @Tags admin
+// @Produce json
+// @Param job path string true "Job" Enums(maturity, accrual, reconciliation, reports, retention)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Success 200 {object} ScheduledJob
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/scheduler/jobs/{job}/pause [post]
+func pauseScheduledJobHandler(w http.ResponseWriter, r *http.Request) {
+	setScheduledJobPaused(w, r, true)
+}
+
+// resumeScheduledJobHandler godoc
+// @Summary Resume a scheduled job
+// @Description Puts a paused job back on its schedule. Runs missed while it was paused are not made up; the next one is at its next scheduled time.
+// @Tags admin
+// @Produce json
+// @Param job path string true "Job" Enums(maturity, accrual, reconciliation, reports, retention)
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Success 200 {object} ScheduledJob
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/scheduler/jobs/{job}/resume [post]
+func resumeScheduledJobHandler(w http.ResponseWriter, r *http.Request) {
+	setScheduledJobPaused(w, r, false)
+}
+
+// setScheduledJobPaused serves pausing and resuming a scheduled job
+func setScheduledJobPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := svc.PauseScheduledJob(ctx, chi.URLParam(r, "job"), staffID, paused)
+	switch {
+	case err == ErrUnknownScheduledJob:
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	message := "Scheduled job paused"
+	if !paused {
+		message = "Scheduled job resumed"
+	}
+	markWrite(w)
+	writeSuccess(w, r, job, message)
+}
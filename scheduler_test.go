@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	every, _ := parseCron("* * * * *")
+
+	var maturities, accruals atomic.Int32
+	sc, err := api.svc.newScheduler(time.UTC, 30*time.Second,
+		&periodicJob{name: ScheduledJobMaturity, sched: every, run: func(context.Context) error { maturities.Add(1); return nil }},
+		&periodicJob{name: ScheduledJobAccrual, sched: every, run: func(context.Context) error {
+			accruals.Add(1)
+			return errors.New("ledger unavailable")
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	for _, j := range sc.jobs {
+		sc.schedule(ctx, j, now)
+	}
+	tick := func(at time.Time) {
+		sc.tick(ctx, at)
+		sc.wg.Wait()
+	}
+
+	tick(now)
+	if maturities.Load() != 0 || accruals.Load() != 0 {
+		t.Fatalf("runs before they are due: %d maturity, %d accrual", maturities.Load(), accruals.Load())
+	}
+	now = now.Add(time.Minute)
+	tick(now)
+	if maturities.Load() != 1 || accruals.Load() != 1 {
+		t.Fatalf("due runs: %d maturity, %d accrual, want 1 each", maturities.Load(), accruals.Load())
+	}
+
+	byName := func() map[string]*ScheduledJob {
+		t.Helper()
+		var page struct{ Items []*ScheduledJob }
+		api.create(http.MethodGet, "/v2/admin/scheduler/jobs", "", &page)
+		m := map[string]*ScheduledJob{}
+		for _, j := range page.Items {
+			m[j.Job] = j
+		}
+		return m
+	}
+	jobs := byName()
+	if len(jobs) != len(scheduledJobNames) {
+		t.Errorf("listed %d jobs, want %d", len(jobs), len(scheduledJobNames))
+	}
+	maturity, accrual := jobs[ScheduledJobMaturity], jobs[ScheduledJobAccrual]
+	if maturity.Schedule != "* * * * *" || maturity.LastStatus != ScheduledRunSucceeded || maturity.RunningSince != nil ||
+		maturity.NextRunAt == nil || !maturity.NextRunAt.After(now) {
+		t.Errorf("maturity = %+v", maturity)
+	}
+	if accrual.LastStatus != ScheduledRunFailed || accrual.LastError != "ledger unavailable" {
+		t.Errorf("accrual = %+v", accrual)
+	}
+
+	// A paused job skips its scheduled runs but still runs when triggered
+	var paused ScheduledJob
+	api.create(http.MethodPost, "/v2/admin/scheduler/jobs/"+ScheduledJobMaturity+"/pause", "", &paused)
+	if !paused.Paused || paused.PausedBy != "staff-1" {
+		t.Errorf("paused = %+v", paused)
+	}
+	now = now.Add(time.Minute)
+	tick(now)
+	if maturities.Load() != 1 || accruals.Load() != 2 {
+		t.Errorf("runs with maturity paused: %d maturity, %d accrual", maturities.Load(), accruals.Load())
+	}
+	var triggered ScheduledJob
+	api.create(http.MethodPost, "/v2/admin/scheduler/jobs/"+ScheduledJobMaturity+"/trigger", "", &triggered)
+	if triggered.TriggerRequestedAt == nil || triggered.TriggerRequestedBy != "staff-1" {
+		t.Errorf("triggered = %+v", triggered)
+	}
+	tick(now.Add(time.Second))
+	if maturities.Load() != 2 || accruals.Load() != 2 {
+		t.Errorf("runs after trigger: %d maturity, %d accrual", maturities.Load(), accruals.Load())
+	}
+	if maturity := byName()[ScheduledJobMaturity]; maturity.TriggerRequestedAt != nil || !maturity.Paused {
+		t.Errorf("maturity after triggered run = %+v", maturity)
+	}
+	var resumed ScheduledJob
+	api.create(http.MethodPost, "/v2/admin/scheduler/jobs/"+ScheduledJobMaturity+"/resume", "", &resumed)
+	if resumed.Paused || resumed.PausedBy != "" {
+		t.Errorf("resumed = %+v", resumed)
+	}
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	every, _ := parseCron("* * * * *")
+
+	var runs atomic.Int32
+	release := make(chan struct{})
+	sc, err := api.svc.newScheduler(time.UTC, 30*time.Second,
+		&periodicJob{name: ScheduledJobReconciliation, sched: every, run: func(context.Context) error {
+			runs.Add(1)
+			<-release
+			return nil
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	sc.schedule(ctx, sc.jobs[0], now)
+
+	sc.tick(ctx, now.Add(time.Minute))
+	sc.tick(ctx, now.Add(2*time.Minute))
+	close(release)
+	sc.wg.Wait()
+	if runs.Load() != 1 {
+		t.Errorf("runs = %d, want the second skipped while the first ran", runs.Load())
+	}
+
+	never, _ := parseCron("0 0 30 2 *")
+	if _, err := api.svc.newScheduler(time.UTC, 30*time.Second, &periodicJob{name: ScheduledJobReports, sched: never}); err == nil {
+		t.Error("schedule that never runs accepted")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"main.go/config"
+)
+
+// apiContentSecurityPolicy is the policy of API responses: they are data,
+// never a page, so nothing they could contain may load or run or be framed
+const apiContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// CORSMiddleware lets pages from the configured origins call the API. It
+// answers preflight requests itself, before authentication, which browsers
+// send without credentials. Requests from other origins are served without
+// CORS headers, so browsers keep their pages from reading the response.
+// Nothing is added when no origins are configured.
+func CORSMiddleware(cfg config.CORS) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		if len(cfg.AllowedOrigins) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// The answer depends on the origin unless every origin gets "*"
+			if !anyOrigin || cfg.AllowCredentials {
+				w.Header().Add("Vary", "Origin")
+			}
+			allowed := anyOrigin || slices.ContainsFunc(cfg.AllowedOrigins, func(o string) bool {
+				return strings.EqualFold(strings.TrimSuffix(o, "/"), origin)
+			})
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !allowed {
+				if preflight {
+					writeErrorCode(w, http.StatusForbidden, CodeForbidden, "Origin not allowed")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin && !cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// SecurityHeadersMiddleware sets the standard hardening headers on every
+// response: no MIME sniffing, no framing, no referrer, HTTPS only when HSTS
+// is configured, and a Content-Security-Policy that allows nothing except on
+// the Swagger UI, which gets the configured one.
+func SecurityHeadersMiddleware(cfg config.SecurityHeaders) func(http.Handler) http.Handler {
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "no-referrer")
+			if hsts != "" {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			if strings.HasPrefix(r.URL.Path, "/swagger/") {
+				if cfg.SwaggerCSP != "" {
+					h.Set("Content-Security-Policy", cfg.SwaggerCSP)
+				}
+			} else {
+				h.Set("Content-Security-Policy", apiContentSecurityPolicy)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
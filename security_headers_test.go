@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"main.go/config"
+)
+
+func TestCORS(t *testing.T) {
+	api := newTestAPI(t)
+	server := config.Default().Server
+	server.CORS.AllowedOrigins = []string{"https://dash.example.com"}
+	handler := newRouter(api.svc, nil, rateLimits{}, server, zap.NewNop())
+	serve := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Preflights are answered before authentication
+	w := serve(http.MethodOptions, "/v2/block-account", "https://dash.example.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" ||
+		w.Header().Get("Access-Control-Allow-Methods") == "" || w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("preflight = %d %v", w.Code, w.Header())
+	}
+	if w := serve(http.MethodOptions, "/v2/block-account", "https://evil.example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("preflight from another origin = %d, want 403", w.Code)
+	}
+
+	w = serve(http.MethodGet, "/healthz", "https://dash.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" ||
+		w.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("CORS headers = %v", w.Header())
+	}
+	if w := serve(http.MethodGet, "/healthz", "https://evil.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("another origin allowed: %v", w.Header())
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	api := newTestAPI(t)
+	w := api.do(http.MethodGet, "/healthz", "")
+	for name, want := range map[string]string{
+		"X-Content-Type-Options":      "nosniff",
+		"Strict-Transport-Security":   "max-age=31536000; includeSubDomains",
+		"Content-Security-Policy":     apiContentSecurityPolicy,
+		"Access-Control-Allow-Origin": "",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	w = api.do(http.MethodGet, "/swagger/index.html", "")
+	if got := w.Header().Get("Content-Security-Policy"); got != config.Default().Server.Security.SwaggerCSP {
+		t.Errorf("Swagger UI policy = %q", got)
+	}
+}
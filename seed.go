@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// seedBatchSize is how many seeded accounts are inserted per transaction
+const seedBatchSize = 500
+
+// seedRecentMaturities is how far back accounts seeded as matured, closed
+// or past their maturity date matured
+const seedRecentMaturities = 365 * 24 * time.Hour
+
+// seedStatuses are the statuses seeded accounts can be given
+var seedStatuses = map[string]bool{StatusActive: true, StatusFrozen: true, StatusMatured: true, StatusClosed: true}
+
+// seedPlan shapes the accounts seedAccounts generates. Periods, Statuses and
+// Frequencies weigh how often each value is picked, e.g. {"1y": 3, "3y": 1}
+// picks 1y three times as often as 3y.
+type seedPlan struct {
+	Accounts int
+	// Users is how many user IDs, from 1, the accounts are spread across
+	Users int
+	// Tenant is the tenant the accounts belong to
+	Tenant      string
+	Periods     map[string]int
+	Statuses    map[string]int
+	Frequencies map[string]int
+	// Due is the fraction of active accounts seeded past their maturity
+	// date, for the maturity worker to pick up
+	Due float64
+	// MaturingWithin, when set, dates the maturities of the other active
+	// and frozen accounts within that long from now; otherwise they fall
+	// anywhere in their term
+	MaturingWithin time.Duration
+}
+
+// validate checks the plan before anything is inserted
+func (p *seedPlan) validate() error {
+	if p.Accounts < 1 || p.Users < 1 {
+		return fmt.Errorf("--accounts and --users must be positive")
+	}
+	if p.Due < 0 || p.Due > 1 {
+		return fmt.Errorf("--due must be between 0 and 1")
+	}
+	if p.MaturingWithin < 0 {
+		return fmt.Errorf("--maturing-within must not be negative")
+	}
+	if err := validateWeights("--periods", p.Periods, isValidPeriod); err != nil {
+		return err
+	}
+	if err := validateWeights("--statuses", p.Statuses, func(v string) bool { return seedStatuses[v] }); err != nil {
+		return err
+	}
+	return validateWeights("--frequencies", p.Frequencies, isValidPayoutFrequency)
+}
+
+// validateWeights checks that weights name only valid values and give at
+// least one of them a positive weight
+func validateWeights(flag string, weights map[string]int, valid func(string) bool) error {
+	total := 0
+	for v, w := range weights {
+		if !valid(v) {
+			return fmt.Errorf("%s: invalid value %q", flag, v)
+		}
+		if w < 0 {
+			return fmt.Errorf("%s: weight of %s must not be negative", flag, v)
+		}
+		total += w
+	}
+	if total == 0 {
+		return fmt.Errorf("%s: at least one weight must be positive", flag)
+	}
+	return nil
+}
+
+// weightedPick picks a value of weights with probability proportional to
+// its weight. Values are walked in sorted order so a seed always picks the
+// same values.
+func weightedPick(weights map[string]int, rng *rand.Rand) string {
+	values := make([]string, 0, len(weights))
+	total := 0
+	for v, w := range weights {
+		values = append(values, v)
+		total += w
+	}
+	sort.Strings(values)
+	n := rng.Intn(total)
+	for _, v := range values {
+		if n < weights[v] {
+			return v
+		}
+		n -= weights[v]
+	}
+	return values[len(values)-1]
+}
+
+// seedAccounts inserts randomly generated block accounts shaped by plan for
+// local development and load testing, and adds their users to the local
+// users table. External IDs come from ids. It returns how many accounts it
+// seeded of each status.
+func seedAccounts(ctx context.Context, repo Repository, ids IDGenerator, plan *seedPlan, rng *rand.Rand) (map[string]int, error) {
+	if err := plan.validate(); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	userIDs := make([]int, plan.Users)
+	for i := range userIDs {
+		userIDs[i] = i + 1
+	}
+	if err := repo.SaveUsers(ctx, userIDs); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	batch := make([]*BlockAccount, 0, seedBatchSize)
+	for i := 0; i < plan.Accounts; i++ {
+		account, err := seedAccount(plan, now, rng)
+		if err != nil {
+			return nil, err
+		}
+		if account.ExternalID, err = ids.NewID(); err != nil {
+			return nil, err
+		}
+		batch = append(batch, account)
+		counts[account.Status]++
+
+		if len(batch) == cap(batch) || i == plan.Accounts-1 {
+			if _, err := repo.CreateAccounts(ctx, batch, func([]*BlockAccount) *AccountImport { return nil }); err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+	}
+	return counts, nil
+}
+
+// seedAccount generates one account of plan, dated around now
+func seedAccount(plan *seedPlan, now time.Time, rng *rand.Rand) (*BlockAccount, error) {
+	period := weightedPick(plan.Periods, rng)
+	term, err := periodTerms(period)
+	if err != nil {
+		return nil, err
+	}
+	status := weightedPick(plan.Statuses, rng)
+
+	// Date the maturity, then open the account a term before it
+	var maturity time.Time
+	switch {
+	case status == StatusMatured || status == StatusClosed ||
+		status == StatusActive && rng.Float64() < plan.Due:
+		maturity = now.Add(-randomDuration(seedRecentMaturities, rng))
+	case plan.MaturingWithin > 0:
+		maturity = now.Add(randomDuration(plan.MaturingWithin, rng))
+	default:
+		maturity = now.Add(randomDuration(term.maturityDate(now).Sub(now), rng))
+	}
+	start := maturity.AddDate(0, -term.Months, 0)
+	if start.After(now) {
+		start = now
+	}
+
+	account := &BlockAccount{
+		UserID:              1 + rng.Intn(plan.Users),
+		TenantID:            plan.Tenant,
+		Principal:           float64(100+rng.Intn(99900)) + float64(rng.Intn(100))/100,
+		StartDate:           start,
+		EndDate:             term.maturityDate(start),
+		InterestRate:        term.Rate,
+		Period:              period,
+		Status:              status,
+		MaturityInstruction: InstructionPayout,
+		PayoutFrequency:     weightedPick(plan.Frequencies, rng),
+	}
+	if status == StatusActive || status == StatusFrozen {
+		scheduleInterest(account, now)
+	}
+	return account, nil
+}
+
+// randomDuration returns a duration in [0, max)
+func randomDuration(max time.Duration, rng *rand.Rand) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rng.Int63n(int64(max)))
+}
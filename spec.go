@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+	"main.go/docs"
+)
+
+//go:generate go run github.com/swaggo/swag/cmd/swag@v1.16.6 init
+
+// SpecDigest identifies a version of the OpenAPI document, so gateways can
+// poll it cheaply and re-import the spec only when it changes
+// @Description Content hash of the OpenAPI document
+type SpecDigest struct {
+	Algorithm string `json:"algorithm" example:"sha256"`
+	// Digest is the hex-encoded hash of the document's bytes
+	Digest string `json:"digest" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	// ETag is the entity tag /swagger/doc.json is served with
+	ETag         string    `json:"etag" example:"\"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\""`
+	LastModified time.Time `json:"last_modified"`
+	Size         int64     `json:"size" example:"48213"`
+}
+
+// apiSpec is the OpenAPI document embedded in the binary, hashed once
+type apiSpec struct {
+	data []byte
+	sum  [sha256.Size]byte
+	// modTime is when the binary's source was committed, or when the process
+	// started if the build did not record it. The document cannot change
+	// before either.
+	modTime time.Time
+}
+
+var openAPISpec = newAPISpec(docs.SwaggerJSON, time.Now())
+
+// newAPISpec hashes data and dates it from the build, or from startedAt
+func newAPISpec(data []byte, startedAt time.Time) *apiSpec {
+	spec := &apiSpec{data: data, sum: sha256.Sum256(data), modTime: startedAt.UTC().Truncate(time.Second)}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if t, err := time.Parse(time.RFC3339, setting.Value); setting.Key == "vcs.time" && err == nil {
+				spec.modTime = t.UTC()
+			}
+		}
+	}
+	return spec
+}
+
+// load returns the document, its hash and its modification time. It fails
+// when the binary was built without a generated document.
+func (s *apiSpec) load() ([]byte, [sha256.Size]byte, time.Time, error) {
+	if len(s.data) == 0 {
+		return nil, [sha256.Size]byte{}, time.Time{}, errors.New("no OpenAPI document was embedded; run go generate")
+	}
+	return s.data, s.sum, s.modTime, nil
+}
+
+// specETag formats the strong entity tag for a document hash
+func specETag(sum [sha256.Size]byte) string {
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// specHandler serves the OpenAPI document with validators, so clients
+// revalidating with If-None-Match or If-Modified-Since get 304 until it changes.
+// Repr-Digest lets them verify the bytes they received.
+func specHandler(w http.ResponseWriter, r *http.Request) {
+	data, sum, modTime, err := openAPISpec.load()
+	if err != nil {
+		loggerFromContext(r.Context(), zap.NewNop()).Error("Failed to load OpenAPI document", zap.Error(err))
+		writeError(w, http.StatusNotFound, "API documentation not available")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", specETag(sum))
+	w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+	http.ServeContent(w, r, "swagger.json", modTime, bytes.NewReader(data))
+}
+
+// specDigestHandler godoc
+// @Summary OpenAPI document hash
+// @Description Returns the SHA-256 of the document served at /swagger/doc.json with its ETag and modification time. API gateways poll this and re-import the spec only when the digest changes.
+// @Tags health
+// @Produce json
+// @Success 200 {object} SpecDigest
+// @Failure 404 {object} ErrorResponse
+// @Router /swagger/doc.hash [get]
+func specDigestHandler(w http.ResponseWriter, r *http.Request) {
+	data, sum, modTime, err := openAPISpec.load()
+	if err != nil {
+		loggerFromContext(r.Context(), zap.NewNop()).Error("Failed to load OpenAPI document", zap.Error(err))
+		writeError(w, http.StatusNotFound, "API documentation not available")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(SpecDigest{
+		Algorithm:    "sha256",
+		Digest:       hex.EncodeToString(sum[:]),
+		ETag:         specETag(sum),
+		LastModified: modTime.UTC().Truncate(time.Second),
+		Size:         int64(len(data)),
+	})
+}
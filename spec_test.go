@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"main.go/docs"
+)
+
+// TestSpecCoversRoutes fails when a v2 route is missing from the embedded
+// OpenAPI document, so an endpoint added without regenerating it with go
+// generate breaks the build
+func TestSpecCoversRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(docs.SwaggerJSON, &spec); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SANDBOX", "true")
+	api := newTestAPI(t)
+	err := chi.Walk(api.handler.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/")
+		if !strings.HasPrefix(route, "/v2/") || method == http.MethodHead {
+			return nil
+		}
+		if _, ok := spec.Paths[route][strings.ToLower(method)]; !ok {
+			t.Errorf("%s %s is not in docs/swagger.json; run go generate", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultStatsCacheTTL is how long portfolio statistics are reused when STATS_CACHE_TTL is not set
+const defaultStatsCacheTTL = 30 * time.Second
+
+// maturityWindowDays are the upcoming maturity windows reported by /admin/stats
+var maturityWindowDays = []int{7, 30, 90}
+
+// PortfolioGroup aggregates the accounts sharing a status and period
+type PortfolioGroup struct {
+	Status    string
+	Period    string
+	Accounts  int
+	Principal float64
+	// RateSum and WeightedRateSum are the sums of interest_rate and
+	// principal * interest_rate, so averages can be combined across groups
+	RateSum         float64
+	WeightedRateSum float64
+}
+
+// StatsBucket is the count and principal of one group of accounts
+// @Description Count, principal and average rate of a group of accounts
+type StatsBucket struct {
+	Accounts  int     `json:"accounts" example:"42"`
+	Principal float64 `json:"principal" example:"125000.00"`
+	// AverageRate is the plain mean of the accounts' interest rates
+	AverageRate float64 `json:"average_rate" example:"0.05"`
+
+	rateSum float64
+}
+
+// add folds a group into the bucket
+func (b *StatsBucket) add(g PortfolioGroup) {
+	b.Accounts += g.Accounts
+	b.Principal += g.Principal
+	b.rateSum += g.RateSum
+}
+
+// finish rounds the principal and computes the average rate
+func (b *StatsBucket) finish() {
+	b.Principal = roundMoney(b.Principal)
+	if b.Accounts > 0 {
+		b.AverageRate = b.rateSum / float64(b.Accounts)
+	}
+}
+
+// MaturityWindow is how much active principal matures within a number of days
+// @Description Active accounts maturing within the next days
+type MaturityWindow struct {
+	Days      int     `json:"days" example:"30"`
+	Accounts  int     `json:"accounts" example:"12"`
+	Principal float64 `json:"principal" example:"36000.00"`
+}
+
+// PortfolioStats summarises the whole book for dashboards
+// @Description Aggregate portfolio statistics
+type PortfolioStats struct {
+	// Currency is the currency every amount is held in
+	Currency  string  `json:"currency" example:"USD"`
+	Accounts  int     `json:"accounts" example:"420"`
+	Principal float64 `json:"principal" example:"1250000.00"`
+	// AverageRate and WeightedAverageRate are over active accounts; the
+	// weighted average weighs each rate by the account's principal
+	AverageRate         float64                `json:"average_rate" example:"0.052"`
+	WeightedAverageRate float64                `json:"weighted_average_rate" example:"0.055"`
+	ByStatus            map[string]StatsBucket `json:"by_status"`
+	ByPeriod            map[string]StatsBucket `json:"by_period"`
+	ByCurrency          map[string]StatsBucket `json:"by_currency"`
+	// UpcomingMaturities covers the next 7, 30 and 90 days
+	UpcomingMaturities []MaturityWindow `json:"upcoming_maturities"`
+	ComputedAt         time.Time        `json:"computed_at"`
+}
+
+// statsCacheTTL returns STATS_CACHE_TTL, falling back to the default
+func statsCacheTTL() time.Duration {
+	if v := os.Getenv("STATS_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return defaultStatsCacheTTL
+}
+
+// statsCache keeps the last computed statistics of each tenant for a short
+// while, so a wall of dashboards polling /admin/stats costs one set of
+// queries per TTL
+type statsCache struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*PortfolioStats // by tenant, "" for the whole platform
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{ttl: ttl, stats: map[string]*PortfolioStats{}}
+}
+
+// GetPortfolioStats aggregates the caller's tenant's book in the database
+// and serves the result from the stats cache until it is older than the TTL
+func (s *service) GetPortfolioStats(ctx context.Context) (*PortfolioStats, error) {
+	if s.stats == nil {
+		return s.computePortfolioStats(ctx)
+	}
+
+	// Holding the lock while computing makes concurrent callers wait for one
+	// refresh instead of all hitting the database
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	tenant := tenantFromContext(ctx)
+	if cached := s.stats.stats[tenant]; cached != nil && time.Since(cached.ComputedAt) < s.stats.ttl {
+		return cached, nil
+	}
+	stats, err := s.computePortfolioStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.stats.stats[tenant] = stats
+	return stats, nil
+}
+
+func (s *service) computePortfolioStats(ctx context.Context) (*PortfolioStats, error) {
+	now := s.Now().UTC()
+	groups, err := s.repo.PortfolioGroups(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to aggregate portfolio", zap.Error(err))
+		return nil, err
+	}
+
+	currency := accountCurrency()
+	stats := &PortfolioStats{
+		Currency:           currency,
+		ByStatus:           map[string]StatsBucket{},
+		ByPeriod:           map[string]StatsBucket{},
+		ByCurrency:         map[string]StatsBucket{},
+		UpcomingMaturities: []MaturityWindow{},
+		ComputedAt:         now,
+	}
+	var active StatsBucket
+	var activeWeighted, activePrincipal float64
+	for _, g := range groups {
+		period := g.Period
+		if period == "" {
+			period = "unknown"
+		}
+		for _, by := range []struct {
+			buckets map[string]StatsBucket
+			key     string
+		}{{stats.ByStatus, g.Status}, {stats.ByPeriod, period}, {stats.ByCurrency, currency}} {
+			b := by.buckets[by.key]
+			b.add(g)
+			by.buckets[by.key] = b
+		}
+		stats.Accounts += g.Accounts
+		stats.Principal += g.Principal
+		if g.Status == StatusActive {
+			active.add(g)
+			activeWeighted += g.WeightedRateSum
+			activePrincipal += g.Principal
+		}
+	}
+	for _, buckets := range []map[string]StatsBucket{stats.ByStatus, stats.ByPeriod, stats.ByCurrency} {
+		for key, b := range buckets {
+			b.finish()
+			buckets[key] = b
+		}
+	}
+	stats.Principal = roundMoney(stats.Principal)
+	active.finish()
+	stats.AverageRate = active.AverageRate
+	if activePrincipal > 0 {
+		stats.WeightedAverageRate = activeWeighted / activePrincipal
+	}
+
+	for _, days := range maturityWindowDays {
+		accounts, principal, err := s.repo.MaturingTotals(ctx, now, now.AddDate(0, 0, days))
+		if err != nil {
+			s.log(ctx).Error("Failed to aggregate upcoming maturities", zap.Error(err), zap.Int("days", days))
+			return nil, err
+		}
+		stats.UpcomingMaturities = append(stats.UpcomingMaturities,
+			MaturityWindow{Days: days, Accounts: accounts, Principal: roundMoney(principal)})
+	}
+	return stats, nil
+}
+
+// portfolioStatsHandler godoc
+// @Summary Portfolio statistics
+// @Description Counts and summed principal by status, period and currency, upcoming maturities in the next 7, 30 and 90 days and the average rate of active accounts. Aggregated in the database and cached for STATS_CACHE_TTL (30s by default); computed_at tells how fresh the figures are.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} PortfolioStats
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/stats [get]
+func portfolioStatsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	ctx := r.Context()
+
+	stats, err := svc.GetPortfolioStats(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(statsCacheTTL().Seconds())))
+	writeSuccess(w, r, stats, "Portfolio statistics retrieved successfully")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Public service statuses
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusMajorOutage = "major_outage"
+)
+
+// maturityRunStaleAfter is how long after the last maturity run the
+// maturity pipeline counts as degraded
+const maturityRunStaleAfter = 26 * time.Hour
+
+// ServiceStatus is the sanitized operational summary shown on the public
+// status page. It carries no error messages, hostnames or versions.
+// @Description Public operational summary of the service
+type ServiceStatus struct {
+	// Status is "operational", "degraded" or "major_outage"
+	Status        string `json:"status" example:"operational"`
+	UptimeSeconds int64  `json:"uptime_seconds" example:"86400"`
+	// Dependencies reports whether each dependency is reachable. The cache is
+	// only listed when it is enabled.
+	Dependencies map[string]bool `json:"dependencies"`
+	// LastMaturityRunAt is when the maturity worker last completed a run
+	LastMaturityRunAt *time.Time `json:"last_maturity_run_at"`
+	CheckedAt         time.Time  `json:"checked_at"`
+}
+
+// GetStatus checks the service's dependencies for the public status page.
+// The database being down is a major outage; anything else degrades.
+func (s *service) GetStatus(ctx context.Context) *ServiceStatus {
+	now := time.Now().UTC()
+	status := &ServiceStatus{
+		Status:        StatusOperational,
+		UptimeSeconds: int64(now.Sub(s.startedAt).Seconds()),
+		Dependencies:  map[string]bool{},
+		CheckedAt:     now,
+	}
+
+	if err := s.repo.Ping(ctx); err != nil {
+		s.log(ctx).Warn("Status check: database unreachable", zap.Error(err))
+		status.Dependencies["database"] = false
+		status.Status = StatusMajorOutage
+		return status
+	}
+	status.Dependencies["database"] = true
+
+	if cache, ok := s.repo.(*cachedRepository); ok {
+		err := cache.client.Ping(ctx).Err()
+		if err != nil {
+			s.log(ctx).Warn("Status check: cache unreachable", zap.Error(err))
+		}
+		status.Dependencies["cache"] = err == nil
+	}
+
+	cp, err := s.repo.GetCheckpoint(ctx, JobMaturity)
+	if err != nil {
+		s.log(ctx).Warn("Status check: failed to read maturity checkpoint", zap.Error(err))
+	}
+	if cp != nil {
+		status.LastMaturityRunAt = cp.LastCompletedAt
+	}
+
+	for _, up := range status.Dependencies {
+		if !up {
+			status.Status = StatusDegraded
+		}
+	}
+	if status.LastMaturityRunAt == nil || now.Sub(*status.LastMaturityRunAt) > maturityRunStaleAfter {
+		status.Status = StatusDegraded
+	}
+	return status
+}
+
+// statusHandler godoc
+// @Summary Public service status
+// @Description Sanitized operational summary for the public status page: uptime, whether each dependency is reachable and when maturities last ran. Always answers 200 so pollers can tell a degraded service from an unreachable one.
+// @Tags health
+// @Produce json
+// @Success 200 {object} ServiceStatus
+// @Router /status [get]
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, "Service not available")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=10")
+	json.NewEncoder(w).Encode(svc.GetStatus(ctx))
+}
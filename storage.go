@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Supported OBJECT_STORE values. Google Cloud Storage is reached through its
+// S3-compatible XML API with HMAC keys.
+const (
+	ObjectStoreLocal = "local"
+	ObjectStoreS3    = "s3"
+	ObjectStoreGCS   = "gcs"
+	ObjectStoreAzure = "azure"
+)
+
+// defaultObjectStoreDir is where the local object store keeps objects when
+// OBJECT_STORE_DIR is not set
+const defaultObjectStoreDir = "./data/objects"
+
+// ErrObjectNotFound is returned by ObjectStore.Get for a key with no object
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore keeps documents such as statements, attachments, exports and
+// archives outside the database. Keys are slash-separated paths like
+// "statements/tax-certificates/123/2024.pdf".
+type ObjectStore interface {
+	// Put stores size bytes read from body under key, replacing any object there
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the object under key, or returns ErrObjectNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object under key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// newObjectStore connects to the store selected by OBJECT_STORE. It returns
+// nil when OBJECT_STORE is not set, in which case documents are not kept.
+func newObjectStore() (ObjectStore, error) {
+	switch store := os.Getenv("OBJECT_STORE"); store {
+	case "":
+		return nil, nil
+	case ObjectStoreLocal:
+		dir := os.Getenv("OBJECT_STORE_DIR")
+		if dir == "" {
+			dir = defaultObjectStoreDir
+		}
+		return newLocalObjectStore(dir)
+	case ObjectStoreS3:
+		return newS3ObjectStore()
+	case ObjectStoreGCS:
+		return newGCSObjectStore()
+	case ObjectStoreAzure:
+		return newAzureObjectStore()
+	default:
+		return nil, fmt.Errorf("unsupported OBJECT_STORE: %s", store)
+	}
+}
+
+// validateObjectKey rejects keys that are empty, absolute or could climb out
+// of the store's root
+func validateObjectKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return fmt.Errorf("invalid object key: %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid object key: %q", key)
+		}
+	}
+	return nil
+}
+
+// objectPath escapes each segment of key for a URL path
+func objectPath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, part := range parts {
+		parts[i] = uriEncode(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// uriEncode percent-encodes everything but the RFC 3986 unreserved
+// characters, as SigV4 canonical requests require
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// localObjectStore keeps objects as files under a directory, for development
+// and single-host deployments with a mounted volume
+type localObjectStore struct {
+	root string
+}
+
+func newLocalObjectStore(dir string) (*localObjectStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create object store directory %s: %w", dir, err)
+	}
+	return &localObjectStore{root: dir}, nil
+}
+
+func (s *localObjectStore) path(key string) (string, error) {
+	if err := validateObjectKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file and renames it into place, so readers never
+// see a partly written object
+func (s *localObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("object %s: wrote %d bytes, expected %d", key, n, size)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *localObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+func (s *localObjectStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// s3ObjectStore talks to the S3 REST API with Signature Version 4. It also
+// serves S3-compatible stores such as MinIO and the GCS XML API. Payloads are
+// sent unsigned so uploads can stream; use an https endpoint.
+type s3ObjectStore struct {
+	client       *http.Client
+	endpoint     *url.URL
+	bucket       string
+	pathStyle    bool
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// newS3ObjectStore configures an S3 bucket. S3_ENDPOINT points it at an
+// S3-compatible service, addressed path-style.
+func newS3ObjectStore() (*s3ObjectStore, error) {
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET is required when OBJECT_STORE=%s", ObjectStoreS3)
+	}
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint, pathStyle := "https://s3."+region+".amazonaws.com", false
+	if v := os.Getenv("S3_ENDPOINT"); v != "" {
+		endpoint, pathStyle = v, true
+	}
+	return newSigV4ObjectStore(endpoint, pathStyle, bucket, region,
+		os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN"))
+}
+
+// newGCSObjectStore configures a Cloud Storage bucket through the XML API
+func newGCSObjectStore() (*s3ObjectStore, error) {
+	bucket := os.Getenv("GCS_BUCKET")
+	if bucket == "" {
+		return nil, fmt.Errorf("GCS_BUCKET is required when OBJECT_STORE=%s", ObjectStoreGCS)
+	}
+	return newSigV4ObjectStore("https://storage.googleapis.com", true, bucket, "auto",
+		os.Getenv("GCS_HMAC_ACCESS_ID"), os.Getenv("GCS_HMAC_SECRET"), "")
+}
+
+func newSigV4ObjectStore(endpoint string, pathStyle bool, bucket, region, accessKey, secretKey, sessionToken string) (*s3ObjectStore, error) {
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid object store endpoint: %s", endpoint)
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("object store credentials are required for bucket %s", bucket)
+	}
+	if !pathStyle {
+		u.Host = bucket + "." + u.Host
+	}
+	return &s3ObjectStore{
+		client:       &http.Client{Timeout: 5 * time.Minute},
+		endpoint:     u,
+		bucket:       bucket,
+		pathStyle:    pathStyle,
+		region:       region,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+	}, nil
+}
+
+// unsignedPayload is the SigV4 payload hash of a request whose body is not signed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func (s *s3ObjectStore) request(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	if err := validateObjectKey(key); err != nil {
+		return nil, err
+	}
+	u := *s.endpoint
+	prefix := u.Path
+	if s.pathStyle {
+		prefix += "/" + uriEncode(s.bucket)
+	}
+	u.RawPath = prefix + "/" + objectPath(key)
+	var err error
+	if u.Path, err = url.PathUnescape(u.RawPath); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, time.Now().UTC())
+	return req, nil
+}
+
+// sign adds SigV4 authentication for the host and x-amz-* headers
+func (s *s3ObjectStore) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, unsignedPayload,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (s *s3ObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := s.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	return objectStoreCall(s.client, req, key, http.StatusOK)
+}
+
+func (s *s3ObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return objectStoreGet(s.client, req, key)
+}
+
+func (s *s3ObjectStore) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	return objectStoreCall(s.client, req, key, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
+
+// azureObjectStore talks to the Azure Blob REST API, authorized by a shared
+// access signature scoped to the container
+type azureObjectStore struct {
+	client    *http.Client
+	container *url.URL
+	sas       string
+}
+
+// azureStorageVersion is the Blob service API version requests are made against
+const azureStorageVersion = "2021-08-06"
+
+func newAzureObjectStore() (*azureObjectStore, error) {
+	account, container := os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_CONTAINER")
+	if container == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_CONTAINER is required when OBJECT_STORE=%s", ObjectStoreAzure)
+	}
+	sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	if sas == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_SAS_TOKEN is required when OBJECT_STORE=%s", ObjectStoreAzure)
+	}
+	endpoint := os.Getenv("AZURE_STORAGE_ENDPOINT")
+	if endpoint == "" {
+		if account == "" {
+			return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_ENDPOINT is required when OBJECT_STORE=%s", ObjectStoreAzure)
+		}
+		endpoint = "https://" + account + ".blob.core.windows.net"
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/") + "/" + uriEncode(container))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid AZURE_STORAGE_ENDPOINT: %s", endpoint)
+	}
+	return &azureObjectStore{client: &http.Client{Timeout: 5 * time.Minute}, container: u, sas: sas}, nil
+}
+
+func (s *azureObjectStore) request(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	if err := validateObjectKey(key); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.container.String()+"/"+objectPath(key)+"?"+s.sas, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureStorageVersion)
+	return req, nil
+}
+
+func (s *azureObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := s.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	return objectStoreCall(s.client, req, key, http.StatusCreated)
+}
+
+func (s *azureObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return objectStoreGet(s.client, req, key)
+}
+
+func (s *azureObjectStore) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	return objectStoreCall(s.client, req, key, http.StatusAccepted, http.StatusNotFound)
+}
+
+// objectStoreCall sends req and fails unless the response status is one of ok
+func objectStoreCall(client *http.Client, req *http.Request, key string, ok ...int) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("object store %s %s: %w", req.Method, key, err)
+	}
+	defer resp.Body.Close()
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+	}
+	return objectStoreError(req.Method, key, resp)
+}
+
+// objectStoreGet sends req and returns the response body of a found object
+func objectStoreGet(client *http.Client, req *http.Request, key string) (io.ReadCloser, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("object store %s %s: %w", req.Method, key, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrObjectNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, objectStoreError(req.Method, key, resp)
+	}
+}
+
+func objectStoreError(method, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("object store %s %s: status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(body)))
+}
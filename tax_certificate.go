@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// defaultWithholdingRate is the tax withheld on deposit interest when
+// TAX_WITHHOLDING_RATE is not set
+const defaultWithholdingRate = 0.05
+
+// TaxCertificate summarizes a user's interest income for one tax year
+// @Description Annual summary of interest earned and tax withheld across a user's block accounts
+type TaxCertificate struct {
+	UserID           int                  `json:"user_id" example:"123"`
+	Year             int                  `json:"year" example:"2024"`
+	WithholdingRate  float64              `json:"withholding_rate" example:"0.05"`
+	Accounts         []TaxCertificateLine `json:"accounts"`
+	TotalInterest    float64              `json:"total_interest" example:"50.00"`
+	TotalTaxWithheld float64              `json:"total_tax_withheld" example:"2.50"`
+	NetInterest      float64              `json:"net_interest" example:"47.50"`
+	GeneratedAt      time.Time            `json:"generated_at"`
+	// Display is set when a display_currency was requested
+	Display *DisplayAmounts `json:"display,omitempty"`
+}
+
+// TaxCertificateLine is one account's contribution to a tax certificate
+// @Description Interest earned and tax withheld on one block account within the tax year
+type TaxCertificateLine struct {
+	AccountID         int     `json:"-"`
+	AccountExternalID string  `json:"account_id" example:"01927c3e-5b1a-7c3d-9f2e-8a4b6c1d2e3f"`
+	Principal         float64 `json:"principal" example:"1000.00"`
+	InterestRate      float64 `json:"interest_rate" example:"0.05"`
+	InterestEarned    float64 `json:"interest_earned" example:"50.00"`
+	TaxWithheld       float64 `json:"tax_withheld" example:"2.50"`
+	// Beneficiaries are the account's beneficiaries as the certificate is issued
+	Beneficiaries []*Beneficiary `json:"beneficiaries,omitempty"`
+}
+
+// withholdingRate returns the configured interest withholding tax rate
+func withholdingRate() float64 {
+	if v := os.Getenv("TAX_WITHHOLDING_RATE"); v != "" {
+		if rate, err := strconv.ParseFloat(v, 64); err == nil && rate >= 0 && rate < 1 {
+			return rate
+		}
+	}
+	return defaultWithholdingRate
+}
+
+// GetTaxCertificate builds the user's interest certificate for a calendar year
+func (s *service) GetTaxCertificate(ctx context.Context, userID, year int) (*TaxCertificate, error) {
+	// The tax year runs from midnight on January 1 in the business time zone
+	yearStart := time.Date(year, time.January, 1, 0, 0, 0, 0, businessLocation())
+	yearEnd := yearStart.AddDate(1, 0, 0)
+
+	accounts, err := s.repo.ListAccountsOverlapping(ctx, userID, yearStart, yearEnd)
+	if err != nil {
+		s.log(ctx).Error("Failed to get accounts for tax certificate", zap.Error(err), zap.Int("userID", userID))
+		return nil, err
+	}
+
+	rate := withholdingRate()
+	cert := &TaxCertificate{
+		UserID:          userID,
+		Year:            year,
+		WithholdingRate: rate,
+		Accounts:        []TaxCertificateLine{},
+		GeneratedAt:     time.Now().UTC(),
+	}
+	for _, account := range accounts {
+		interest := roundMoney(interestBetween(account, yearStart, yearEnd))
+		if interest == 0 {
+			continue
+		}
+		tax := roundMoney(interest * rate)
+		cert.Accounts = append(cert.Accounts, TaxCertificateLine{
+			AccountID:         account.ID,
+			AccountExternalID: account.ExternalID,
+			Principal:         account.Principal,
+			InterestRate:      account.InterestRate,
+			InterestEarned:    interest,
+			TaxWithheld:       tax,
+		})
+		cert.TotalInterest += interest
+		cert.TotalTaxWithheld += tax
+	}
+
+	if err := s.attachBeneficiaries(ctx, cert); err != nil {
+		return nil, err
+	}
+
+	cert.TotalInterest = roundMoney(cert.TotalInterest)
+	cert.TotalTaxWithheld = roundMoney(cert.TotalTaxWithheld)
+	cert.NetInterest = roundMoney(cert.TotalInterest - cert.TotalTaxWithheld)
+
+	// Each account on the certificate gets the issue in its communications log
+	for _, line := range cert.Accounts {
+		s.recordCommunication(ctx, &Communication{
+			AccountID: line.AccountID,
+			UserID:    userID,
+			Kind:      CommunicationCertificate,
+			Event:     EventTaxCertificateIssued,
+			Subject:   fmt.Sprintf("Interest certificate %d", year),
+			Message: fmt.Sprintf("Interest earned %.2f, tax withheld %.2f in %d.",
+				line.InterestEarned, line.TaxWithheld, year),
+			Status:   DeliverySent,
+			Priority: PriorityBulk,
+		})
+	}
+	return cert, nil
+}
+
+// attachBeneficiaries lists each account's beneficiaries on its line of cert
+func (s *service) attachBeneficiaries(ctx context.Context, cert *TaxCertificate) error {
+	ids := make([]int, len(cert.Accounts))
+	for i, line := range cert.Accounts {
+		ids[i] = line.AccountID
+	}
+	beneficiaries, err := s.repo.ListBeneficiaries(ctx, ids)
+	if err != nil {
+		s.log(ctx).Error("Failed to get beneficiaries for tax certificate", zap.Error(err), zap.Int("userID", cert.UserID))
+		return err
+	}
+	byAccount := map[int][]*Beneficiary{}
+	for _, b := range beneficiaries {
+		byAccount[b.AccountID] = append(byAccount[b.AccountID], b)
+	}
+	for i := range cert.Accounts {
+		cert.Accounts[i].Beneficiaries = byAccount[cert.Accounts[i].AccountID]
+	}
+	return nil
+}
+
+// taxCertificateKey is the object key a closed tax year's certificate PDF is archived under
+func taxCertificateKey(userID, year int) string {
+	return fmt.Sprintf("statements/tax-certificates/%d/%d.pdf", userID, year)
+}
+
+// GetTaxCertificatePDF renders the user's certificate for a year as a PDF.
+// With an object store configured, the first PDF issued for a closed tax
+// year is archived and served again unchanged, so the customer and the tax
+// office always see the same document. Archive errors are logged and the
+// certificate is rendered afresh.
+func (s *service) GetTaxCertificatePDF(ctx context.Context, userID, year int) ([]byte, error) {
+	archive := s.store != nil && year < s.Now().In(businessLocation()).Year()
+	key := taxCertificateKey(userID, year)
+	if archive {
+		doc, err := s.store.Get(ctx, key)
+		if err == nil {
+			defer doc.Close()
+			b, err := io.ReadAll(doc)
+			if err == nil {
+				return b, nil
+			}
+			s.log(ctx).Warn("Failed to read archived tax certificate", zap.Error(err), zap.String("key", key))
+		} else if !errors.Is(err, ErrObjectNotFound) {
+			s.log(ctx).Warn("Failed to read archived tax certificate", zap.Error(err), zap.String("key", key))
+		}
+	}
+
+	cert, err := s.GetTaxCertificate(ctx, userID, year)
+	if err != nil {
+		return nil, err
+	}
+	doc := renderTaxCertificatePDF(cert)
+	if archive {
+		if err := s.store.Put(ctx, key, bytes.NewReader(doc), int64(len(doc)), "application/pdf"); err != nil {
+			s.log(ctx).Warn("Failed to archive tax certificate", zap.Error(err), zap.String("key", key))
+		}
+	}
+	return doc, nil
+}
+
+// renderTaxCertificatePDF lays the certificate out as a printable document
+func renderTaxCertificatePDF(cert *TaxCertificate) []byte {
+	doc := &simplePDF{title: fmt.Sprintf("Interest Certificate %d", cert.Year)}
+	doc.addLine("INTEREST CERTIFICATE - TAX YEAR %d", cert.Year)
+	doc.addLine("")
+	doc.addLine("User ID: %d", cert.UserID)
+	doc.addLine("Generated: %s", cert.GeneratedAt.Format("2006-01-02 15:04 MST"))
+	doc.addLine("Withholding rate: %.2f%%", cert.WithholdingRate*100)
+	doc.addLine("")
+	doc.addLine("%-10s %15s %8s %15s %15s", "Account", "Principal", "Rate", "Interest", "Tax withheld")
+	for _, line := range cert.Accounts {
+		doc.addLine("%-10d %15.2f %7.2f%% %15.2f %15.2f",
+			line.AccountID, line.Principal, line.InterestRate*100, line.InterestEarned, line.TaxWithheld)
+		for _, b := range line.Beneficiaries {
+			doc.addLine("  Beneficiary: %s (%s), %.2f%%", b.Name, b.Relationship, b.AllocationPercent)
+		}
+	}
+	doc.addLine("")
+	doc.addLine("Total interest earned: %.2f", cert.TotalInterest)
+	doc.addLine("Total tax withheld:    %.2f", cert.TotalTaxWithheld)
+	doc.addLine("Net interest:          %.2f", cert.NetInterest)
+	return doc.Bytes()
+}
+
+// getTaxCertificateHandler godoc
+// @Summary Get annual interest certificate
+// @Description Summarizes interest earned and tax withheld across all of a user's block accounts for a tax year, with each account's beneficiaries, as JSON or PDF (format=pdf or Accept: application/pdf). With an object store configured, the PDF for a closed tax year is archived when first issued and served unchanged afterwards.
+// @Tags block-account
+// @Produce json
+// @Produce application/pdf
+// @Param userID path int true "User ID" Format(int64)
+// @Param year query int true "Tax year" example(2024)
+// @Param format query string false "Response format" Enums(json, pdf)
+// @Param display_currency query string false "ISO 4217 currency to also present the JSON totals in" example(EUR)
+// @Success 200 {object} TaxCertificate
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /v2/user/{userID}/tax-certificate [get]
+func getTaxCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	userIDStr := chi.URLParam(r, "userID")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidUserID, "Invalid user ID")
+		return
+	}
+
+	year, err := strconv.Atoi(r.URL.Query().Get("year"))
+	if err != nil || year < 1900 || year > svc.Now().In(businessLocation()).Year() {
+		writeError(w, http.StatusBadRequest, "Invalid year")
+		return
+	}
+
+	ctx := r.Context()
+
+	if r.URL.Query().Get("format") == "pdf" || strings.Contains(r.Header.Get("Accept"), "application/pdf") {
+		doc, err := svc.GetTaxCertificatePDF(ctx, userID, year)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="interest-certificate-%d-%d.pdf"`, userID, year))
+		w.Write(doc)
+		return
+	}
+
+	cert, err := svc.GetTaxCertificate(ctx, userID, year)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rate, ok := displayRate(ctx, w, r, svc)
+	if !ok {
+		return
+	}
+	if rate != nil {
+		cert.Display = rate.display(map[string]float64{
+			"total_interest":     cert.TotalInterest,
+			"total_tax_withheld": cert.TotalTaxWithheld,
+			"net_interest":       cert.NetInterest,
+		})
+	}
+
+	writeSuccess(w, r, cert, "Tax certificate generated successfully")
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// DefaultTenant owns everything from before tenants, and serves requests
+// that name no tenant
+const DefaultTenant = "default"
+
+// TenantHeader names the tenant a platform caller acts for
+const TenantHeader = "X-Tenant-ID"
+
+// tenantCacheTTL is how long TenantMiddleware trusts that a tenant exists
+const tenantCacheTTL = time.Minute
+
+const tenantKey ctxKey = "tenant"
+
+var (
+	// ErrTenantExists is returned when a tenant is created with an ID in use
+	ErrTenantExists = newAPIError(CodeTenantExists, "tenant already exists")
+	// ErrUnknownTenant is returned for a tenant that does not exist
+	ErrUnknownTenant = newAPIError(CodeUnknownTenant, "tenant does not exist")
+	// ErrTenantMismatch is returned when a caller bound to a tenant acts
+	// for another
+	ErrTenantMismatch = newAPIError(CodeTenantMismatch, "credentials are for another tenant")
+	// ErrTenantPlatformOnly is returned when a caller without a tenant of
+	// its own, and without the admin scope, names a tenant
+	ErrTenantPlatformOnly = newAPIError(CodePlatformOnly, "only platform operators may choose a tenant")
+)
+
+// tenantIDPattern is what a tenant ID looks like: it is sent in headers and
+// token claims, so it is kept to lowercase letters, digits and dashes
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// Tenant is an institution whose accounts are kept apart from every other's
+// @Description Institution whose accounts, configuration and requests are isolated from other tenants
+type Tenant struct {
+	ID        string    `json:"id" example:"acme"`
+	Name      string    `json:"name" example:"Acme Savings Bank"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateTenantRequest is the payload for creating a tenant
+// @Description Request payload for creating a tenant
+type CreateTenantRequest struct {
+	ID   string `json:"id" example:"acme" validate:"tenant_id"`
+	Name string `json:"name" example:"Acme Savings Bank" validate:"notblank,max=100"`
+}
+
+// TenantRate is the interest rate a tenant offers on a period
+// @Description Interest rate of a period in the caller's tenant's rate plan
+type TenantRate struct {
+	TenantID string  `json:"-"`
+	Period   string  `json:"period" example:"1y"`
+	Rate     float64 `json:"rate" example:"0.045"`
+	// DefaultRate is the period's built-in rate, offered unless the tenant
+	// sets its own
+	DefaultRate float64 `json:"default_rate" example:"0.05"`
+	// Custom is set when the tenant set its own rate
+	Custom    bool       `json:"custom"`
+	UpdatedBy string     `json:"updated_by,omitempty" example:"staff-42"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// TenantRateRequest is the payload for setting a tenant's rate
+// @Description Request payload for setting the interest rate of a period
+type TenantRateRequest struct {
+	Rate float64 `json:"rate" example:"0.045" validate:"gte=0,lt=1"`
+}
+
+// tenantScope is the tenant a request acts for
+type tenantScope struct {
+	id string
+	// bound is set when the caller's credentials name the tenant, so the
+	// caller cannot act for any other
+	bound bool
+}
+
+// withTenant scopes ctx to tenant, or to every tenant when it is empty
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, &tenantScope{id: tenant})
+}
+
+// tenantFromContext returns the tenant ctx is scoped to, or "" when it may
+// see every tenant, as workers do. Repositories filter on it.
+func tenantFromContext(ctx context.Context) string {
+	if scope, ok := ctx.Value(tenantKey).(*tenantScope); ok {
+		return scope.id
+	}
+	return ""
+}
+
+// tenantOf returns the tenant records created in ctx belong to
+func tenantOf(ctx context.Context) string {
+	if tenant := tenantFromContext(ctx); tenant != "" {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// tenantBound reports whether the caller's credentials tie it to its tenant
+func tenantBound(ctx context.Context) bool {
+	scope, ok := ctx.Value(tenantKey).(*tenantScope)
+	return ok && scope.bound
+}
+
+// inTenant reports whether a record of tenant may be seen in ctx
+func inTenant(ctx context.Context, tenant string) bool {
+	scoped := tenantFromContext(ctx)
+	return scoped == "" || scoped == tenant
+}
+
+// tenantCache remembers for a while which tenants exist, so resolving the
+// tenant of a request rarely reads the database
+type tenantCache struct {
+	mu    sync.Mutex
+	known map[string]time.Time // tenant ID to when it was last confirmed
+}
+
+func newTenantCache() *tenantCache {
+	return &tenantCache{known: map[string]time.Time{}}
+}
+
+// TenantExists reports whether tenant exists
+func (s *service) TenantExists(ctx context.Context, tenant string) (bool, error) {
+	if s.tenants != nil {
+		s.tenants.mu.Lock()
+		confirmed, ok := s.tenants.known[tenant]
+		s.tenants.mu.Unlock()
+		if ok && time.Since(confirmed) < tenantCacheTTL {
+			return true, nil
+		}
+	}
+	t, err := s.repo.GetTenant(ctx, tenant)
+	if err != nil {
+		s.log(ctx).Error("Failed to get tenant", zap.Error(err), zap.String("tenant", tenant))
+		return false, err
+	}
+	if t != nil && s.tenants != nil {
+		s.tenants.mu.Lock()
+		s.tenants.known[tenant] = time.Now()
+		s.tenants.mu.Unlock()
+	}
+	return t != nil, nil
+}
+
+// ListTenants returns every tenant
+func (s *service) ListTenants(ctx context.Context) ([]*Tenant, error) {
+	tenants, err := s.repo.ListTenants(ctx)
+	if err != nil {
+		s.log(ctx).Error("Failed to list tenants", zap.Error(err))
+		return nil, err
+	}
+	if tenants == nil {
+		tenants = []*Tenant{}
+	}
+	return tenants, nil
+}
+
+// CreateTenant creates a tenant with the built-in rate plan and no limits
+func (s *service) CreateTenant(ctx context.Context, req *CreateTenantRequest) (*Tenant, error) {
+	tenant, err := s.repo.CreateTenant(ctx, &Tenant{ID: req.ID, Name: strings.TrimSpace(req.Name)})
+	if err != nil {
+		if err != ErrTenantExists {
+			s.log(ctx).Error("Failed to create tenant", zap.Error(err), zap.String("tenant", req.ID))
+		}
+		return nil, err
+	}
+	s.log(ctx).Info("Tenant created", zap.String("tenant", tenant.ID))
+	return tenant, nil
+}
+
+// ratePlan is the interest rate of each period in one tenant's plan, where
+// the tenant set its own
+type ratePlan map[string]float64
+
+// terms returns the term of period with the plan's rate
+func (p ratePlan) terms(period string) (*periodTerm, error) {
+	term, err := periodTerms(period)
+	if err != nil {
+		return nil, err
+	}
+	if rate, ok := p[period]; ok {
+		term.Rate = rate
+	}
+	return term, nil
+}
+
+// ratePlan returns the rate plan of tenant
+func (s *service) ratePlan(ctx context.Context, tenant string) (ratePlan, error) {
+	plans, err := s.ratePlans(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	return plans[tenant], nil
+}
+
+// ratePlans returns the rate plans of tenant, or of every tenant when it is
+// empty, by tenant
+func (s *service) ratePlans(ctx context.Context, tenant string) (map[string]ratePlan, error) {
+	rates, err := s.repo.ListTenantRates(ctx, tenant)
+	if err != nil {
+		s.log(ctx).Error("Failed to list tenant rates", zap.Error(err), zap.String("tenant", tenant))
+		return nil, err
+	}
+	plans := map[string]ratePlan{}
+	for _, r := range rates {
+		if plans[r.TenantID] == nil {
+			plans[r.TenantID] = ratePlan{}
+		}
+		plans[r.TenantID][r.Period] = r.Rate
+	}
+	return plans, nil
+}
+
+// ListTenantRates returns the rate of every product that can be opened in
+// the tenant's plan, shortest term first
+func (s *service) ListTenantRates(ctx context.Context) ([]*TenantRate, error) {
+	tenant := tenantOf(ctx)
+	custom, err := s.repo.ListTenantRates(ctx, tenant)
+	if err != nil {
+		s.log(ctx).Error("Failed to list tenant rates", zap.Error(err), zap.String("tenant", tenant))
+		return nil, err
+	}
+	set := make(map[string]*TenantRate, len(custom))
+	for _, r := range custom {
+		set[r.Period] = r
+	}
+
+	offered := catalog.offered()
+	rates := make([]*TenantRate, 0, len(offered))
+	for _, p := range offered {
+		rate := &TenantRate{TenantID: tenant, Period: p.Code, Rate: p.Rate, DefaultRate: p.Rate}
+		if r, ok := set[p.Code]; ok {
+			rate.Rate, rate.Custom, rate.UpdatedBy, rate.UpdatedAt = r.Rate, true, r.UpdatedBy, r.UpdatedAt
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// SetTenantRate sets the rate the tenant offers on new accounts of period.
+// Accounts already open keep their rate until they roll over or are
+// recalculated.
+func (s *service) SetTenantRate(ctx context.Context, period, staffID string, req *TenantRateRequest) (*TenantRate, error) {
+	tenant := tenantOf(ctx)
+	rate := &TenantRate{TenantID: tenant, Period: period, Rate: req.Rate, UpdatedBy: staffID}
+	if err := s.repo.SaveTenantRate(ctx, rate); err != nil {
+		s.log(ctx).Error("Failed to save tenant rate", zap.Error(err), zap.String("tenant", tenant), zap.String("period", period))
+		return nil, err
+	}
+	if p, ok := catalog.get(period); ok {
+		rate.DefaultRate = p.Rate
+	}
+	rate.Custom = true
+	s.log(ctx).Info("Tenant rate updated", zap.String("tenant", tenant), zap.String("period", period),
+		zap.Float64("rate", req.Rate), zap.String("staffID", staffID))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Rate of %s set to %g for tenant %s", period, req.Rate, tenant),
+		map[string]any{"setting": "tenant_rate", "tenant_id": tenant, "period": period, "rate": req.Rate, "changed_by": staffID})
+	return rate, nil
+}
+
+// DeleteTenantRate puts period back on its built-in rate for the tenant
+func (s *service) DeleteTenantRate(ctx context.Context, period string) error {
+	tenant := tenantOf(ctx)
+	if err := s.repo.DeleteTenantRate(ctx, tenant, period); err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to delete tenant rate", zap.Error(err), zap.String("tenant", tenant), zap.String("period", period))
+		}
+		return err
+	}
+	s.log(ctx).Info("Tenant rate removed", zap.String("tenant", tenant), zap.String("period", period))
+	s.emitOperational(ctx, EventConfigChanged, SeverityInfo, fmt.Sprintf("Rate of %s reset for tenant %s", period, tenant),
+		map[string]any{"setting": "tenant_rate", "tenant_id": tenant, "period": period})
+	return nil
+}
+
+// resolveTenant returns the tenant the caller authenticated on ctx acts for
+// when it asks for requested. Callers whose API key, token or impersonation
+// session names a tenant act for that tenant only, and may only ask for it.
+// Platform callers, whose key or token has no tenant and holds the admin
+// scope, act for the tenant they ask for; everyone else acts for the
+// default tenant and may only ask for that one.
+func resolveTenant(ctx context.Context, svc BlockAccountService, requested string) (*tenantScope, error) {
+	var bound string
+	platform := false
+	if session := impersonationFromContext(ctx); session != nil {
+		bound = session.TenantID
+	} else if p := principalFromContext(ctx); p != nil {
+		bound = p.Tenant
+		platform = bound == "" && p.grants(ScopeAdmin)
+	}
+
+	scope := &tenantScope{id: requested, bound: bound != ""}
+	switch {
+	case bound != "" && requested != "" && requested != bound:
+		return nil, ErrTenantMismatch
+	case bound == "" && !platform && requested != "" && requested != DefaultTenant:
+		return nil, ErrTenantPlatformOnly
+	case bound != "":
+		scope.id = bound
+	case requested == "":
+		scope.id = DefaultTenant
+	}
+
+	exists, err := svc.TenantExists(ctx, scope.id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUnknownTenant
+	}
+	return scope, nil
+}
+
+// withTenantScope scopes ctx to the tenant a request was resolved to act for
+func withTenantScope(ctx context.Context, scope *tenantScope) context.Context {
+	ctx = context.WithValue(ctx, tenantKey, scope)
+	return withCallerFields(ctx, zap.NewNop(), zap.String("tenant", scope.id))
+}
+
+// TenantMiddleware resolves the tenant every request acts for, from the
+// caller's credentials and X-Tenant-ID, and scopes its context to it
+func TenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "Service not available")
+			return
+		}
+
+		scope, err := resolveTenant(r.Context(), svc, strings.TrimSpace(r.Header.Get(TenantHeader)))
+		switch err {
+		case nil:
+		case ErrTenantMismatch, ErrTenantPlatformOnly:
+			writeAPIError(w, http.StatusForbidden, err)
+			return
+		case ErrUnknownTenant:
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		default:
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set(TenantHeader, scope.id)
+		next.ServeHTTP(w, r.WithContext(withTenantScope(r.Context(), scope)))
+	})
+}
+
+// PlatformOnlyMiddleware keeps callers bound to a tenant out of routes that
+// act on the whole platform. The routes see every tenant unless X-Tenant-ID
+// narrows them to one.
+func PlatformOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenantBound(r.Context()) {
+			writeErrorCode(w, http.StatusForbidden, CodePlatformOnly, "This route is only open to platform operators")
+			return
+		}
+		if r.Header.Get(TenantHeader) == "" {
+			w.Header().Del(TenantHeader)
+			r = r.WithContext(withTenant(r.Context(), ""))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listTenantsHandler godoc
+// @Summary List tenants
+// @Description Lists every tenant. Platform operators only.
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]Tenant}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/tenants [get]
+func listTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+
+	tenants, err := svc.ListTenants(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeList(w, r, page, tenants, "Tenants retrieved successfully")
+}
+
+// createTenantHandler godoc
+// @Summary Create a tenant
+// @Description Creates a tenant, on the built-in rate plan and without limits or product gates. Platform operators only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tenant body CreateTenantRequest true "Tenant"
+// @Success 201 {object} Tenant
+// @Header 201 {string} Location "URL of the tenant list"
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/tenants [post]
+func createTenantHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	markWrite(w)
+
+	var req CreateTenantRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	tenant, err := svc.CreateTenant(ctx, &req)
+	switch {
+	case err == ErrTenantExists:
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeCreated(w, r, apiPath("/admin/tenants"), tenant, "Tenant created successfully")
+}
+
+// listTenantRatesHandler godoc
+// @Summary List the rate plan
+// @Description Lists the interest rate new accounts of each period open at in the caller's tenant: the tenant's own where it set one, the built-in rate otherwise
+// @Tags admin
+// @Produce json
+// @Param X-Tenant-ID header string false "Tenant, for platform callers"
+// @Success 200 {array} TenantRate
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/rates [get]
+func listTenantRatesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	ctx := r.Context()
+
+	rates, err := svc.ListTenantRates(ctx)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, r, rates, "Rate plan retrieved successfully")
+}
+
+// setTenantRateHandler godoc
+// @Summary Set a rate
+// @Description Sets the interest rate new accounts of a period open and roll over at in the caller's tenant. Accounts already open keep their rate.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param period path string true "Product code"
+// @Param rate body TenantRateRequest true "Rate, as a fraction"
+// @Param X-Staff-ID header string false "Staff member, set by the gateway"
+// @Param X-Tenant-ID header string false "Tenant, for platform callers"
+// @Success 200 {object} TenantRate
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/rates/{period} [put]
+func setTenantRateHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	markWrite(w)
+
+	period := chi.URLParam(r, "period")
+	if !isValidPeriod(period) {
+		writeErrorCode(w, http.StatusBadRequest, CodeInvalidPeriod, "invalid period: "+period+". Valid options are: "+validPeriods())
+		return
+	}
+
+	var req TenantRateRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	rate, err := svc.SetTenantRate(ctx, period, r.Header.Get(StaffIDHeader), &req)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, r, rate, "Rate saved successfully")
+}
+
+// deleteTenantRateHandler godoc
+// @Summary Reset a rate
+// @Description Puts a period back on its built-in rate in the caller's tenant
+// @Tags admin
+// @Param period path string true "Period"
+// @Param X-Tenant-ID header string false "Tenant, for platform callers"
+// @Success 204 {string} string "No Content"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/rates/{period} [delete]
+func deleteTenantRateHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	markWrite(w)
+
+	ctx := r.Context()
+
+	if err := svc.DeleteTenantRate(ctx, chi.URLParam(r, "period")); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Tenant has no rate of its own for this period")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
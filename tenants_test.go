@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTenantHeader(t *testing.T) {
+	api := newTestAPI(t)
+	var tenant Tenant
+	api.create(http.MethodPost, "/v2/admin/tenants", `{"id":"acme","name":"Acme Savings Bank"}`, &tenant)
+	var writer, bound APIKey
+	api.create(http.MethodPost, "/v2/admin/api-keys", `{"name":"batch","scopes":["write"]}`, &writer)
+	api.create(http.MethodPost, "/v2/admin/api-keys", `{"name":"acme-batch","scopes":["write"],"tenant_id":"acme"}`, &bound)
+
+	for _, c := range []struct {
+		name, key, tenant string
+		status            int
+	}{
+		{"no credentials", "", "acme", http.StatusForbidden},
+		{"no credentials, default tenant", "", DefaultTenant, http.StatusOK},
+		{"unbound key without admin", writer.Key, "acme", http.StatusForbidden},
+		{"unbound key, no header", writer.Key, "", http.StatusOK},
+		{"bound key, own tenant", bound.Key, "acme", http.StatusOK},
+		{"bound key, other tenant", bound.Key, DefaultTenant, http.StatusForbidden},
+		{"platform admin", api.adminKey, "acme", http.StatusOK},
+	} {
+		w := api.do(http.MethodGet, "/v2/user/1/block-accounts", "", APIKeyHeader, c.key, TenantHeader, c.tenant)
+		if w.Code != c.status {
+			t.Errorf("%s: %d %s, want %d", c.name, w.Code, w.Body, c.status)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// BusinessDayConvention says how a maturity date that falls on a weekend or
+// holiday is moved to a business day
+type BusinessDayConvention string
+
+const (
+	// Unadjusted keeps the date even when it is not a business day
+	Unadjusted BusinessDayConvention = "unadjusted"
+	// Following moves the date to the next business day
+	Following BusinessDayConvention = "following"
+	// ModifiedFollowing moves the date to the next business day unless that
+	// is in the next month, in which case it moves to the previous one
+	ModifiedFollowing BusinessDayConvention = "modified_following"
+)
+
+// TermConvention is how a deposit's maturity date is derived from its start
+type TermConvention struct {
+	// EndOfMonth keeps deposits opened on the last day of a month maturing on
+	// the last day of a month (Feb 28 + 1m is Mar 31, not Mar 28)
+	EndOfMonth  bool
+	BusinessDay BusinessDayConvention
+}
+
+// periodTerm is a deposit period's length in calendar months, its rate and
+// the conventions used to date its maturity
+type periodTerm struct {
+	Months     int
+	Rate       float64
+	Convention TermConvention
+}
+
+// defaultTermConvention dates maturities the way most deposit products do
+var defaultTermConvention = TermConvention{EndOfMonth: true, BusinessDay: ModifiedFollowing}
+
+// termConventionOverrides returns business day conventions set per period in
+// TERM_CONVENTIONS, e.g. "3m:following,1y:unadjusted"
+func termConventionOverrides() map[string]BusinessDayConvention {
+	overrides := map[string]BusinessDayConvention{}
+	for _, entry := range strings.Split(os.Getenv("TERM_CONVENTIONS"), ",") {
+		period, convention, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			continue
+		}
+		switch c := BusinessDayConvention(strings.TrimSpace(convention)); c {
+		case Unadjusted, Following, ModifiedFollowing:
+			overrides[strings.TrimSpace(period)] = c
+		}
+	}
+	return overrides
+}
+
+// businessHolidays returns the non-weekend dates in BUSINESS_HOLIDAYS
+// (comma-separated YYYY-MM-DD) on which deposits cannot mature
+func businessHolidays() map[string]bool {
+	holidays := map[string]bool{}
+	for _, v := range strings.Split(os.Getenv("BUSINESS_HOLIDAYS"), ",") {
+		v = strings.TrimSpace(v)
+		if _, err := time.Parse(time.DateOnly, v); err == nil {
+			holidays[v] = true
+		}
+	}
+	return holidays
+}
+
+// periodTerms returns the term and interest rate of the product with code
+// period. Retired products still have terms, for the accounts open on them.
+func periodTerms(period string) (*periodTerm, error) {
+	product, ok := catalog.get(period)
+	if !ok {
+		return nil, fmt.Errorf("invalid period: %s", period)
+	}
+	term := periodTerm{Months: product.TermMonths, Rate: product.Rate, Convention: defaultTermConvention}
+	if c, ok := termConventionOverrides()[period]; ok {
+		term.Convention.BusinessDay = c
+	}
+	return &term, nil
+}
+
+// maturityDate returns when a deposit of this term opened at start matures.
+// Calendar months and business days are counted in the business time zone,
+// and the term is shortened in a sandbox.
+func (t *periodTerm) maturityDate(start time.Time) time.Time {
+	end := addMonths(start.In(businessLocation()), t.Months, t.Convention.EndOfMonth)
+	return compressTerm(start, adjustBusinessDay(end, t.Convention.BusinessDay, businessHolidays()).UTC())
+}
+
+// addMonths adds calendar months to t, clamping to the last day of the target
+// month instead of overflowing into the next one as time.AddDate does. With
+// endOfMonth, a t on the last day of its month lands on the last day of the
+// target month.
+func addMonths(t time.Time, months int, endOfMonth bool) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+
+	first := time.Date(year, month+time.Month(months), 1, hour, min, sec, t.Nanosecond(), t.Location())
+	last := daysIn(first.Year(), first.Month())
+	if day > last || (endOfMonth && day == daysIn(year, month)) {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// daysIn returns the number of days in the month
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// isBusinessDay reports whether t is neither a weekend nor a holiday
+func isBusinessDay(t time.Time, holidays map[string]bool) bool {
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	return !holidays[t.Format(time.DateOnly)]
+}
+
+// adjustBusinessDay moves t to a business day according to convention
+func adjustBusinessDay(t time.Time, convention BusinessDayConvention, holidays map[string]bool) time.Time {
+	if convention == Unadjusted || isBusinessDay(t, holidays) {
+		return t
+	}
+
+	next := t
+	for !isBusinessDay(next, holidays) {
+		next = next.AddDate(0, 0, 1)
+	}
+	if convention == Following || next.Month() == t.Month() {
+		return next
+	}
+
+	prev := t
+	for !isBusinessDay(prev, holidays) {
+		prev = prev.AddDate(0, 0, -1)
+	}
+	return prev
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// date returns midnight UTC of the YYYY-MM-DD s
+func date(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		name       string
+		start      string
+		months     int
+		endOfMonth bool
+		want       string
+	}{
+		{"Jan 31 into a leap February", "2024-01-31", 1, false, "2024-02-29"},
+		{"Jan 31 into a common February", "2025-01-31", 1, false, "2025-02-28"},
+		{"Jan 30 into a common February", "2025-01-30", 1, false, "2025-02-28"},
+		{"Jan 31 into April", "2025-01-31", 3, false, "2025-04-30"},
+		{"Feb 29 a year on", "2024-02-29", 12, false, "2025-02-28"},
+		{"Feb 28 a year on to a leap year", "2023-02-28", 12, false, "2024-02-28"},
+		{"Feb 28 a year on to a leap year, end of month", "2023-02-28", 12, true, "2024-02-29"},
+		{"Feb 28 into March", "2025-02-28", 1, false, "2025-03-28"},
+		{"Feb 28 into March, end of month", "2025-02-28", 1, true, "2025-03-31"},
+		{"Feb 28 of a leap year is not its end", "2024-02-28", 1, true, "2024-03-28"},
+		{"Apr 30 into May, end of month", "2025-04-30", 1, true, "2025-05-31"},
+		{"mid-month", "2025-01-15", 1, true, "2025-02-15"},
+		{"across a year", "2025-11-30", 3, false, "2026-02-28"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := addMonths(date(t, tt.start), tt.months, tt.endOfMonth)
+			if got.Format(time.DateOnly) != tt.want {
+				t.Errorf("addMonths(%s, %d, %v) = %s, want %s", tt.start, tt.months, tt.endOfMonth, got.Format(time.DateOnly), tt.want)
+			}
+		})
+	}
+}
+
+func TestAddMonthsKeepsTheDayOfMonth(t *testing.T) {
+	// Each period is counted from the start, so one short month does not
+	// pull the later ones back to its last day
+	start := date(t, "2025-01-31")
+	want := []string{"2025-02-28", "2025-03-31", "2025-04-30", "2025-05-31", "2025-06-30", "2025-07-31",
+		"2025-08-31", "2025-09-30", "2025-10-31", "2025-11-30", "2025-12-31", "2026-01-31"}
+	for n, w := range want {
+		if got := addMonths(start, n+1, false).Format(time.DateOnly); got != w {
+			t.Errorf("period %d = %s, want %s", n+1, got, w)
+		}
+	}
+}
+
+func TestAdjustBusinessDay(t *testing.T) {
+	holidays := map[string]bool{"2025-12-25": true, "2025-12-26": true, "2025-10-31": true}
+	tests := []struct {
+		name       string
+		day        string
+		convention BusinessDayConvention
+		want       string
+	}{
+		{"business day", "2025-05-30", ModifiedFollowing, "2025-05-30"},
+		{"unadjusted Saturday", "2025-05-31", Unadjusted, "2025-05-31"},
+		{"Saturday mid-month, following", "2025-03-15", Following, "2025-03-17"},
+		{"Saturday mid-month, modified following", "2025-03-15", ModifiedFollowing, "2025-03-17"},
+		{"Saturday at month end, following", "2025-05-31", Following, "2025-06-02"},
+		{"Saturday at month end, modified following", "2025-05-31", ModifiedFollowing, "2025-05-30"},
+		{"Sunday at month end, modified following", "2025-08-31", ModifiedFollowing, "2025-08-29"},
+		{"holidays and a weekend, following", "2025-12-25", Following, "2025-12-29"},
+		{"holidays and a weekend, modified following", "2025-12-25", ModifiedFollowing, "2025-12-29"},
+		{"holiday at month end, following", "2025-10-31", Following, "2025-11-03"},
+		{"holiday at month end, modified following", "2025-10-31", ModifiedFollowing, "2025-10-30"},
+		{"unadjusted holiday", "2025-12-25", Unadjusted, "2025-12-25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := adjustBusinessDay(date(t, tt.day), tt.convention, holidays)
+			if got.Format(time.DateOnly) != tt.want {
+				t.Errorf("adjustBusinessDay(%s, %s) = %s, want %s", tt.day, tt.convention, got.Format(time.DateOnly), tt.want)
+			}
+		})
+	}
+}
+
+func TestPeriodTerms(t *testing.T) {
+	t.Setenv("TERM_CONVENTIONS", "3m:following, 6m:unadjusted, 1y:sideways")
+	tests := []struct {
+		period string
+		months int
+		want   BusinessDayConvention
+	}{
+		{"3m", 3, Following},
+		{"6m", 6, Unadjusted},
+		{"1y", 12, ModifiedFollowing},
+		{"3y", 36, ModifiedFollowing},
+	}
+	for _, tt := range tests {
+		term, err := periodTerms(tt.period)
+		if err != nil {
+			t.Fatalf("periodTerms(%s): %v", tt.period, err)
+		}
+		if term.Months != tt.months || term.Convention.BusinessDay != tt.want || !term.Convention.EndOfMonth {
+			t.Errorf("periodTerms(%s) = %+v, want %d months %s", tt.period, term, tt.months, tt.want)
+		}
+	}
+	if _, err := periodTerms("2y"); err == nil {
+		t.Error("periodTerms(2y) succeeded for an unknown product")
+	}
+}
+
+func TestMaturityDate(t *testing.T) {
+	t.Setenv("BUSINESS_HOLIDAYS", "2025-12-31")
+	tests := []struct {
+		name        string
+		start       string
+		conventions string
+		period      string
+		want        string
+	}{
+		{"Jan 31 for a year to a Saturday", "2025-01-31", "", "1y", "2026-01-30"},
+		{"Jan 31 for a year, following", "2025-01-31", "1y:following", "1y", "2026-02-02"},
+		{"Jan 31 for a year, unadjusted", "2025-01-31", "1y:unadjusted", "1y", "2026-01-31"},
+		{"Nov 30 for three months into a common February", "2024-11-30", "", "3m", "2025-02-28"},
+		{"Feb 29 for three years", "2024-02-29", "", "3y", "2027-02-26"},
+		{"Jun 30 for six months to a holiday", "2025-06-30", "", "6m", "2025-12-30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TERM_CONVENTIONS", tt.conventions)
+			term, err := periodTerms(tt.period)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := term.maturityDate(date(t, tt.start)).Format(time.DateOnly); got != tt.want {
+				t.Errorf("maturity of %s from %s = %s, want %s", tt.period, tt.start, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"main.go/config"
+)
+
+const (
+	// defaultRequestTimeout and defaultMaxBodyBytes apply to requests that
+	// didn't pass through RequestLimitsMiddleware
+	defaultRequestTimeout = 5 * time.Second
+	defaultMaxBodyBytes   = 64 << 10
+	// longRequestTimeout is the budget of requests known to take a while,
+	// such as queueing a bulk import or projecting a rate scenario
+	longRequestTimeout = 30 * time.Second
+)
+
+const requestLimitsKey ctxKey = "requestLimits"
+
+// requestLimits are the limits a request runs under
+type requestLimits struct {
+	// base is the request's context before its timeout, which ends when the
+	// client goes away
+	base    context.Context
+	timeout time.Duration
+	maxBody int64
+}
+
+// newHTTPServer returns the API server listening on addr, with the
+// configured timeouts so that slow clients can't hold connections open
+func newHTTPServer(addr string, handler http.Handler, cfg config.Server) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// RequestLimitsMiddleware gives every request's context the configured
+// timeout, and records the limit on JSON bodies for decodeRequest. Handlers
+// that need longer ask for it with withRequestTimeout.
+func RequestLimitsMiddleware(cfg config.Server) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limits := &requestLimits{base: r.Context(), timeout: cfg.RequestTimeout, maxBody: cfg.MaxBodyBytes}
+			ctx, cancel := context.WithTimeout(context.WithValue(r.Context(), requestLimitsKey, limits), cfg.RequestTimeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestTimeout returns how long r's work may take
+func requestTimeout(r *http.Request) time.Duration {
+	if limits, ok := r.Context().Value(requestLimitsKey).(*requestLimits); ok {
+		return limits.timeout
+	}
+	return defaultRequestTimeout
+}
+
+// maxBodyBytes returns the size limit on r's JSON body
+func maxBodyBytes(r *http.Request) int64 {
+	if limits, ok := r.Context().Value(requestLimitsKey).(*requestLimits); ok {
+		return limits.maxBody
+	}
+	return defaultMaxBodyBytes
+}
+
+// withRequestTimeout returns a context for r's work that ends after d in
+// place of the request's usual timeout, or when the client goes away. It
+// keeps the values of r's context.
+func withRequestTimeout(r *http.Request, d time.Duration) (context.Context, context.CancelFunc) {
+	limits, ok := r.Context().Value(requestLimitsKey).(*requestLimits)
+	if !ok {
+		return context.WithTimeout(r.Context(), d)
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), d)
+	stop := context.AfterFunc(limits.base, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	// Embed the zone database so BUSINESS_TIMEZONE works in minimal images
+	_ "time/tzdata"
+)
+
+// businessLocation returns the zone in which calendar dates are decided:
+// maturity dates, business days and tax years. It is read from
+// BUSINESS_TIMEZONE (an IANA name such as Africa/Addis_Ababa) and defaults to
+// UTC. Instants are always stored and exchanged in UTC; only day boundaries
+// depend on this zone. checkTimezoneConfig refuses an unknown zone at
+// startup.
+func businessLocation() *time.Location {
+	if v := os.Getenv("BUSINESS_TIMEZONE"); v != "" {
+		if loc, err := time.LoadLocation(v); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// legacyTimestampZone is the zone the service's hosts ran in before
+// timestamps were stored with their zone: LEGACY_TIMESTAMP_ZONE, else TZ,
+// else UTC. Migrating a PostgreSQL database reads its naive timestamps as
+// wall-clock times in this zone.
+func legacyTimestampZone() string {
+	for _, name := range []string{"LEGACY_TIMESTAMP_ZONE", "TZ"} {
+		// TZ may name a zone file as :Area/City
+		if v := strings.TrimPrefix(os.Getenv(name), ":"); v != "" {
+			return v
+		}
+	}
+	return "UTC"
+}
+
+// checkTimezoneConfig refuses to start with a BUSINESS_TIMEZONE or
+// LEGACY_TIMESTAMP_ZONE that is not a known IANA zone
+func checkTimezoneConfig() error {
+	for _, name := range []string{"BUSINESS_TIMEZONE", "LEGACY_TIMESTAMP_ZONE"} {
+		if v := os.Getenv(name); v != "" {
+			if _, err := time.LoadLocation(v); err != nil {
+				return fmt.Errorf("invalid %s: %s is not an IANA time zone", name, v)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestTimezoneConfig(t *testing.T) {
+	t.Setenv("BUSINESS_TIMEZONE", "Africa/Addis_Ababa")
+	t.Setenv("LEGACY_TIMESTAMP_ZONE", "")
+	t.Setenv("TZ", ":Europe/Berlin")
+	if err := checkTimezoneConfig(); err != nil {
+		t.Errorf("valid zones refused: %v", err)
+	}
+	if businessLocation().String() != "Africa/Addis_Ababa" || legacyTimestampZone() != "Europe/Berlin" {
+		t.Errorf("business %s, legacy %s", businessLocation(), legacyTimestampZone())
+	}
+
+	t.Setenv("BUSINESS_TIMEZONE", "Africa/Atlantis")
+	if err := checkTimezoneConfig(); err == nil {
+		t.Error("unknown BUSINESS_TIMEZONE accepted")
+	}
+	t.Setenv("BUSINESS_TIMEZONE", "")
+	t.Setenv("LEGACY_TIMESTAMP_ZONE", "EAT+3")
+	if err := checkTimezoneConfig(); err == nil {
+		t.Error("unknown LEGACY_TIMESTAMP_ZONE accepted")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"main.go/config"
+)
+
+// certReloadInterval is how often the certificate files are checked for a
+// renewed certificate, so rotating them needs no restart
+const certReloadInterval = time.Minute
+
+// tlsVersions maps the configured minimum versions to their constants
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig returns the HTTP listener's TLS configuration, or nil when it
+// serves plaintext. Certificates come from the configured files, reloaded
+// when they change, or from ACME. With a client CA, callers' certificates
+// are verified against it.
+func newTLSConfig(cfg config.TLS, logger *zap.Logger) (*tls.Config, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	var tlsConfig *tls.Config
+	if len(cfg.ACMEDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Cache:      autocert.DirCache(cfg.ACMECacheDir),
+			Email:      cfg.ACMEEmail,
+		}
+		if cfg.ACMEDirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: cfg.ACMEDirectoryURL}
+		}
+		tlsConfig = manager.TLSConfig()
+	} else {
+		certs, err := newCertReloader(cfg.CertFile, cfg.KeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{GetCertificate: certs.getCertificate}
+	}
+	tlsConfig.MinVersion = tlsVersions[cfg.MinVersion]
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client CA file %s holds no PEM certificates", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if cfg.ClientAuth == config.ClientAuthVerifyIfGiven {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certReloader serves the certificate in a pair of files, rereading them
+// when they have changed since it last looked. A pair that fails to load
+// keeps the certificate already loaded.
+type certReloader struct {
+	certFile, keyFile string
+	logger            *zap.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// newCertReloader loads the certificate, failing when the files are missing
+// or do not hold a matching pair
+func newCertReloader(certFile, keyFile string, logger *zap.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	info, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("read TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	r.cert, r.modTime = &cert, info.ModTime()
+	return nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.checkedAt) >= certReloadInterval {
+		r.checkedAt = now
+		if info, err := os.Stat(r.certFile); err == nil && !info.ModTime().Equal(r.modTime) {
+			if err := r.load(); err != nil {
+				r.logger.Warn("Failed to reload TLS certificate", zap.Error(err))
+			} else {
+				r.logger.Info("TLS certificate reloaded", zap.String("file", r.certFile))
+			}
+		}
+	}
+	return r.cert, nil
+}
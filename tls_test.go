@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"main.go/config"
+)
+
+// testCert issues a certificate for name signed by parent, self-signed when
+// parent is nil, and returns it with its key
+func testCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// writePEM writes a certificate, and its key when it is given, to files in dir
+func writePEM(t *testing.T, dir, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+	t.Helper()
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if key != nil {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := testCert(t, "test-ca", nil, nil)
+	caFile, _ := writePEM(t, dir, "ca", ca, nil)
+	serverCert, serverKey := testCert(t, "block-account", ca, caKey)
+	certFile, keyFile := writePEM(t, dir, "server", serverCert, serverKey)
+	clientCert, clientKey := testCert(t, "payments-service", ca, caKey)
+
+	tlsConfig, err := newTLSConfig(config.TLS{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile,
+		ClientAuth: config.ClientAuthRequire, MinVersion: "1.2"}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: newTestAPI(t).handler, TLSConfig: tlsConfig}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		return client.Get("https://" + listener.Addr().String() + "/healthz")
+	}
+
+	if resp, err := get(); err == nil {
+		resp.Body.Close()
+		t.Error("a caller without a client certificate was served")
+	}
+	resp, err := get(tls.Certificate{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey})
+	if err != nil {
+		t.Fatalf("caller with a client certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTLSConfigDisabled(t *testing.T) {
+	if tlsConfig, err := newTLSConfig(config.Default().Server.TLS, zap.NewNop()); tlsConfig != nil || err != nil {
+		t.Errorf("default TLS = %v, %v, want plaintext", tlsConfig, err)
+	}
+	if _, err := newTLSConfig(config.TLS{CertFile: "missing.crt", KeyFile: "missing.key"}, zap.NewNop()); err == nil {
+		t.Error("missing certificate files loaded")
+	}
+}
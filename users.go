@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Supported USER_VALIDATOR values. User IDs are accepted without a check when
+// USER_VALIDATOR is not set.
+const (
+	UserValidatorLocal = "local"
+	UserValidatorHTTP  = "http"
+	UserValidatorGRPC  = "grpc"
+)
+
+// userServiceDefaults is how the user service is called unless its
+// USER_SERVICE_* settings say otherwise. Lookups are safe to retry.
+var userServiceDefaults = ResiliencePolicy{Timeout: 3 * time.Second, MaxAttempts: 3, Backoff: 100 * time.Millisecond,
+	BreakerThreshold: 5, BreakerCooldown: 30 * time.Second}
+
+// ErrUnknownUser is returned when an account is opened for a user that does not exist
+var ErrUnknownUser = newAPIError(CodeUserNotFound, "user does not exist")
+
+// UserValidator reports whether a user exists. An error means the answer is
+// not known, not that the user is missing.
+type UserValidator interface {
+	UserExists(ctx context.Context, userID int) (bool, error)
+}
+
+// newUserValidator builds the validator selected by USER_VALIDATOR, or nil
+// when user IDs are not checked
+func newUserValidator(repo Repository) (UserValidator, error) {
+	switch v := os.Getenv("USER_VALIDATOR"); v {
+	case "":
+		return nil, nil
+	case UserValidatorLocal:
+		return repo, nil
+	case UserValidatorHTTP:
+		return newHTTPUserValidator()
+	case UserValidatorGRPC:
+		return newGRPCUserValidator()
+	default:
+		return nil, fmt.Errorf("unsupported USER_VALIDATOR: %s", v)
+	}
+}
+
+// httpUserValidator looks users up with a GET to USER_SERVICE_URL, in which
+// {id} is replaced by the user ID. 200 means the user exists and 404 that it
+// does not; anything else is an error.
+type httpUserValidator struct {
+	client *http.Client
+	dep    *dependency
+	url    string
+}
+
+func newHTTPUserValidator() (*httpUserValidator, error) {
+	u := os.Getenv("USER_SERVICE_URL")
+	if !strings.Contains(u, "{id}") {
+		return nil, fmt.Errorf("USER_SERVICE_URL with an {id} placeholder is required when USER_VALIDATOR=%s", UserValidatorHTTP)
+	}
+	dep, err := newDependency(DependencyUserService, userServiceDefaults)
+	if err != nil {
+		return nil, err
+	}
+	return &httpUserValidator{client: &http.Client{}, dep: dep, url: u}, nil
+}
+
+func (v *httpUserValidator) UserExists(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := v.dep.call(ctx, func(ctx context.Context) (err error) {
+		exists, err = v.lookUp(ctx, userID)
+		return err
+	})
+	return exists, err
+}
+
+// lookUp makes one request for userID. Answers other than 5xx and 429 are
+// permanent.
+func (v *httpUserValidator) lookUp(ctx context.Context, userID int) (bool, error) {
+	target := strings.ReplaceAll(v.url, "{id}", url.PathEscape(strconv.Itoa(userID)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return false, err
+	}
+	if reqID := middleware.GetReqID(ctx); reqID != "" {
+		req.Header.Set(RequestIDHeader, reqID)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("look up user: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	err = fmt.Errorf("look up user: %s", resp.Status)
+	if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+		return false, permanent(err)
+	}
+	return false, err
+}
+
+// grpcUserValidator calls USER_SERVICE_GRPC_METHOD on the user service at
+// USER_SERVICE_GRPC_ADDR. The request carries the user ID as int64 field 1,
+// which matches the usual GetUserRequest{int64 id = 1}. OK means the user
+// exists and NOT_FOUND that it does not; the response body is ignored.
+type grpcUserValidator struct {
+	conn   *grpc.ClientConn
+	dep    *dependency
+	method string
+}
+
+func newGRPCUserValidator() (*grpcUserValidator, error) {
+	addr := os.Getenv("USER_SERVICE_GRPC_ADDR")
+	method := os.Getenv("USER_SERVICE_GRPC_METHOD")
+	if addr == "" || !strings.HasPrefix(method, "/") {
+		return nil, fmt.Errorf("USER_SERVICE_GRPC_ADDR and USER_SERVICE_GRPC_METHOD (/package.Service/Method) are required when USER_VALIDATOR=%s", UserValidatorGRPC)
+	}
+	dep, err := newDependency(DependencyUserService, userServiceDefaults)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("connect to user service: %w", err)
+	}
+	return &grpcUserValidator{conn: conn, dep: dep, method: method}, nil
+}
+
+func (v *grpcUserValidator) UserExists(ctx context.Context, userID int) (bool, error) {
+	var exists bool
+	err := v.dep.call(ctx, func(ctx context.Context) error {
+		err := v.conn.Invoke(ctx, v.method, wrapperspb.Int64(int64(userID)), &emptypb.Empty{})
+		switch status.Code(err) {
+		case codes.OK:
+			exists = true
+			return nil
+		case codes.NotFound:
+			return nil
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown:
+			return fmt.Errorf("look up user: %w", err)
+		default:
+			return permanent(fmt.Errorf("look up user: %w", err))
+		}
+	})
+	return exists, err
+}
+
+func (v *grpcUserValidator) Close() error {
+	return v.conn.Close()
+}
+
+// userServiceFallback reports whether USER_SERVICE_FALLBACK is allow, which
+// accepts user IDs while the user service cannot be asked about them
+func userServiceFallback() bool {
+	return os.Getenv("USER_SERVICE_FALLBACK") == "allow"
+}
+
+// checkUserExists returns ErrUnknownUser when the configured validator does not know userID
+func (s *service) checkUserExists(ctx context.Context, userID int) error {
+	if s.users == nil {
+		return nil
+	}
+	exists, err := s.users.UserExists(ctx, userID)
+	if err != nil && userServiceFallback() && ctx.Err() == nil {
+		s.log(ctx).Warn("User service unavailable, accepting user unchecked", zap.Error(err), zap.Int("userID", userID))
+		return nil
+	}
+	if err != nil {
+		s.log(ctx).Error("Failed to validate user", zap.Error(err), zap.Int("userID", userID))
+		return err
+	}
+	if !exists {
+		return ErrUnknownUser
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate checks requests against the validate tags of their fields.
+// Fields are named by their JSON names in its errors.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	custom := map[string]func(fl validator.FieldLevel) bool{
+		"period": func(fl validator.FieldLevel) bool {
+			return isValidPeriod(fl.Field().String())
+		},
+		"payout_frequency": func(fl validator.FieldLevel) bool {
+			return isValidPayoutFrequency(fl.Field().String())
+		},
+		"max_principal": func(fl validator.FieldLevel) bool {
+			f := fl.Field().Float()
+			return !math.IsNaN(f) && f <= MaxPrincipal
+		},
+		"external_id": func(fl validator.FieldLevel) bool {
+			_, ok := parseExternalID(fl.Field().String())
+			return ok
+		},
+		"tenant_id": func(fl validator.FieldLevel) bool {
+			return tenantIDPattern.MatchString(fl.Field().String())
+		},
+		"notblank": func(fl validator.FieldLevel) bool {
+			return strings.TrimSpace(fl.Field().String()) != ""
+		},
+	}
+	for tag, fn := range custom {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			panic(err)
+		}
+	}
+	return v
+}
+
+// tagCodes are the field error codes of validate tags whose failure means
+// the same thing on any field
+var tagCodes = map[string]string{
+	"required":         CodeFieldRequired,
+	"required_if":      CodeFieldRequired,
+	"required_without": CodeFieldRequired,
+	"notblank":         CodeFieldRequired,
+	"period":           CodeInvalidPeriod,
+	"payout_frequency": CodeInvalidPayoutFrequency,
+	"max_principal":    CodeAmountTooLarge,
+	"external_id":      CodeInvalidAccountID,
+}
+
+// fieldCodes are the field error codes of fields that fail any other tag
+var fieldCodes = map[string]string{
+	"user_id":   CodeInvalidUserID,
+	"principal": CodeInvalidAmount,
+}
+
+// validateRequest checks req's validate tags, reporting every field that
+// fails
+func validateRequest(req any) error {
+	err := validate.Struct(req)
+	var fails validator.ValidationErrors
+	if !errors.As(err, &fails) {
+		return err
+	}
+	var errs validationErrors
+	for _, fe := range fails {
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		code, ok := tagCodes[fe.Tag()]
+		if !ok {
+			if code, ok = fieldCodes[fe.Field()]; !ok {
+				code = CodeInvalidField
+			}
+		}
+		errs.add(field, code, fieldMessage(field, fe))
+	}
+	return errs.err()
+}
+
+// fieldMessage describes the failure of field in the style of the
+// service's other validation messages
+func fieldMessage(field string, fe validator.FieldError) string {
+	counted := fe.Kind() == reflect.Slice || fe.Kind() == reflect.Map
+	switch fe.Tag() {
+	case "required", "required_if", "notblank":
+		return field + " is required"
+	case "required_without":
+		return fmt.Sprintf("%s or %s is required", field, snakeCase(fe.Param()))
+	case "period":
+		return fmt.Sprintf("invalid period: %v. Valid options are: %s", fe.Value(), validPeriods())
+	case "payout_frequency":
+		return fmt.Sprintf("invalid payout_frequency: %v. Valid options are: monthly, quarterly, at_maturity", fe.Value())
+	case "max_principal":
+		return fmt.Sprintf("%s must be at most %.2f", field, float64(MaxPrincipal))
+	case "external_id":
+		return field + " must be a block account ID"
+	case "tenant_id":
+		return field + " must be 1 to 64 lowercase letters, digits and dashes, starting with a letter or digit"
+	case "oneof":
+		return fmt.Sprintf("invalid %s: %v. Valid options are: %s", field, fe.Value(), strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "gt":
+		if fe.Param() == "0" {
+			return field + " must be positive"
+		}
+		return fmt.Sprintf("%s must be greater than %s", field, fe.Param())
+	case "gte", "min":
+		if counted && fe.Param() == "1" {
+			return field + " must not be empty"
+		}
+		if counted {
+			return fmt.Sprintf("%s must list at least %s", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s", field, fe.Param())
+	case "lte", "max":
+		switch {
+		case counted:
+			return fmt.Sprintf("%s may list at most %s", field, fe.Param())
+		case fe.Kind() == reflect.String:
+			return fmt.Sprintf("%s must be at most %s characters", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	case "email":
+		return fmt.Sprintf("invalid email address: %v", fe.Value())
+	case "http_url":
+		return field + " must be an absolute http or https URL"
+	}
+	return field + " is invalid"
+}
+
+// decodeRequest decodes the JSON body of r into req and validates it,
+// writing the error response and returning false when either fails.
+// Bodies over the server's MaxBodyBytes and fields req does not have are
+// rejected.
+func decodeRequest(w http.ResponseWriter, r *http.Request, req any) bool {
+	limit := maxBodyBytes(r)
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(req)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body has data after the JSON value")
+	}
+
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	var errs validationErrors
+	switch {
+	case err == nil:
+		if err := validateRequest(req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return false
+		}
+		return true
+	case errors.As(err, &tooLarge):
+		writeErrorCode(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+			fmt.Sprintf("request body may be at most %d KB", limit>>10))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		errs.add(typeErr.Field, CodeInvalidType, fmt.Sprintf("%s must be a %s", typeErr.Field, jsonTypeName(typeErr.Type)))
+		writeAPIError(w, http.StatusBadRequest, errs.err())
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		errs.add(field, CodeUnknownField, "unknown field: "+field)
+		writeAPIError(w, http.StatusBadRequest, errs.err())
+	default:
+		writeErrorCode(w, http.StatusBadRequest, CodeMalformedBody, "Invalid request body")
+	}
+	return false
+}
+
+// snakeCase returns the JSON name requests give the Go field name, e.g.
+// product_code for ProductCode
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// jsonTypeName names t as JSON would
+func jsonTypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "RFC 3339 time"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "string"
+}
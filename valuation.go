@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// AccountValuation is what an account is worth when it is read
+// @Description The account's interest and value, computed when it is read. Interest accrues by whole business days outside the sandbox, so the valuation changes once a day.
+type AccountValuation struct {
+	// ValuedAt is the instant the figures are computed for: the start of the
+	// current business day in BUSINESS_TIMEZONE, or the read itself in the
+	// sandbox
+	ValuedAt time.Time `json:"valued_at"`
+	// DaysElapsed is the whole days of the term that have passed
+	DaysElapsed int `json:"days_elapsed" example:"91"`
+	// AccruedInterestToDate is the interest earned since the start date,
+	// paid out periodically or not, before interest adjustments
+	AccruedInterestToDate float64 `json:"accrued_interest_to_date" example:"12.47"`
+	// CurrentValue is what the account holds: its principal, the interest
+	// accrued since the last periodic payment and its interest adjustment
+	CurrentValue float64 `json:"current_value" example:"1012.47"`
+	// ProjectedMaturityValue is what the account pays at maturity at its
+	// current rate, as the maturity worker computes it
+	ProjectedMaturityValue float64 `json:"projected_maturity_value" example:"1050.00"`
+}
+
+// valuationTime returns the instant reads at now are valued at. Outside the
+// sandbox that is the start of the business day, so a day's reads agree
+// with each other and with the account's ETag.
+func valuationTime(now time.Time) time.Time {
+	if sandboxTimeScale() != 1 {
+		return now.UTC()
+	}
+	local := now.In(businessLocation())
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location()).UTC()
+}
+
+// valueAccount returns the account's valuation at now, or nil when it holds
+// no balance earning interest: it is not yet funded, or it has reached its
+// maturity status
+func valueAccount(a *BlockAccount, now time.Time) *AccountValuation {
+	if a.Status != StatusActive && a.Status != StatusFrozen {
+		return nil
+	}
+	at := valuationTime(now)
+	if at.Before(a.StartDate) {
+		at = a.StartDate
+	}
+	if at.After(a.EndDate) {
+		at = a.EndDate
+	}
+	return &AccountValuation{
+		ValuedAt:               at,
+		DaysElapsed:            int(math.Floor(yearsBetween(a.StartDate, at)*daysPerYear + 1e-9)),
+		AccruedInterestToDate:  roundMoney(interestBetween(a, a.StartDate, at)),
+		CurrentValue:           roundMoney(a.Principal + interestBetween(a, interestPaidFrom(a), at) + a.InterestAdjustment),
+		ProjectedMaturityValue: roundMoney(a.Principal + interestBetween(a, interestPaidFrom(a), a.EndDate) + a.InterestAdjustment),
+	}
+}
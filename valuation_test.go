@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestValueAccount(t *testing.T) {
+	today := valuationTime(time.Now())
+	start := today.AddDate(0, 0, -73)
+	paidThrough := today.AddDate(0, 0, -30)
+	a := &BlockAccount{Principal: 10000, InterestRate: 0.05, StartDate: start, EndDate: start.AddDate(0, 0, 365),
+		Status: StatusActive, InterestPaidThrough: &paidThrough, InterestAdjustment: 2.5}
+
+	v := valueAccount(a, time.Now())
+	// 73 days at 5% is 100.00, 30 of them not yet paid out 41.10, the term 500
+	if v == nil || !v.ValuedAt.Equal(today) || v.DaysElapsed != 73 || v.AccruedInterestToDate != 100 ||
+		v.CurrentValue != 10043.6 || v.ProjectedMaturityValue != 10000+2.5+roundMoney(500-interestBetween(a, start, paidThrough)) {
+		t.Errorf("valuation = %+v", v)
+	}
+
+	a.Status = StatusMatured
+	if v := valueAccount(a, time.Now()); v != nil {
+		t.Errorf("matured account valued %+v, want no valuation", v)
+	}
+}
+
+func TestAccountValuationETag(t *testing.T) {
+	api := newTestAPI(t)
+	id := api.createAccount(1)
+
+	var account BlockAccount
+	w := api.do(http.MethodGet, "/v2/block-account/"+id, "")
+	decodeData(t, w.Body.Bytes(), &account)
+	if account.Valuation == nil || account.Valuation.CurrentValue != 1000 || account.Valuation.ProjectedMaturityValue <= 1000 {
+		t.Fatalf("valuation = %+v, want the new account valued", account.Valuation)
+	}
+	etag := w.Header().Get("ETag")
+	if w := api.do(http.MethodGet, "/v2/block-account/"+id, "", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match = %d, want 304 on the same day", w.Code)
+	}
+	// A tag read on another day still names the account's version
+	if w := api.do(http.MethodDelete, "/v2/block-account/"+id, "", "If-Match", etag[:len(etag)-1]+"0\""); w.Code != http.StatusNoContent {
+		t.Errorf("close with an earlier day's ETag = %d %s, want 204", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrValueDateInFuture is returned for a value date after now
+	ErrValueDateInFuture = newAPIError(CodeInvalidValueDate, "value_date may not be in the future")
+	// ErrValueDateOutsideTerm is returned for a value date before the
+	// account's start date or from its end date on
+	ErrValueDateOutsideTerm = newAPIError(CodeInvalidValueDate, "value_date must fall within the account's term")
+	// ErrValueDateMatured is returned when booking an account whose term,
+	// counted from the value date, has already ended
+	ErrValueDateMatured = newAPIError(CodeInvalidValueDate, "a deposit opened on value_date would already have matured")
+)
+
+// ValueDatedAccountRequest is the payload for booking an account that
+// opened before it was booked
+// @Description Request payload for booking a block account with a value date in the past, for migrations and corrections
+type ValueDatedAccountRequest struct {
+	UserID    int     `json:"user_id" example:"123" validate:"gt=0"`
+	Principal float64 `json:"principal" example:"1000.00" validate:"gt=0,max_principal" maximum:"1000000000000"`
+	Period    string  `json:"period" example:"1y" validate:"required,period"`
+	// PayoutFrequency defaults to "at_maturity"
+	PayoutFrequency string `json:"payout_frequency,omitempty" example:"monthly" validate:"omitempty,payout_frequency"`
+	// ValueDate is when the deposit opened: its start date, from which
+	// interest accrues and its term is counted
+	ValueDate time.Time `json:"value_date" example:"2026-03-01T00:00:00Z" validate:"required"`
+	Reason    string    `json:"reason" example:"Deposit opened at branch 12 during the outage, case 3120" validate:"notblank"`
+}
+
+// checkValueDate refuses a value date after now or outside the account's
+// term. A nil value date passes.
+func checkValueDate(a *BlockAccount, valueDate *time.Time, now time.Time) error {
+	switch {
+	case valueDate == nil:
+		return nil
+	case valueDate.After(now):
+		return ErrValueDateInFuture
+	case valueDate.Before(a.StartDate) || !valueDate.Before(a.EndDate):
+		return ErrValueDateOutsideTerm
+	}
+	return nil
+}
+
+// earlierValueDate returns valueDate when it falls on an earlier day than
+// bookedAt, in BUSINESS_TIMEZONE, and nil when the entry took effect the day
+// it was booked
+func earlierValueDate(valueDate, bookedAt time.Time) *time.Time {
+	loc := businessLocation()
+	if valueDate.In(loc).Format(time.DateOnly) >= bookedAt.In(loc).Format(time.DateOnly) {
+		return nil
+	}
+	return &valueDate
+}
+
+// CreateValueDatedAccount books an active account that opened on the
+// request's value date: its term is counted and its interest accrues from
+// then, at the caller's tenant's rates. Interest payments that fell due
+// between the value date and now are left due, so the interest worker pays
+// them on its next run. The deposit is taken to be held already, so no
+// funding is debited, and, as for imports, product gates, minimum
+// principals and account limits do not apply. The opening status records
+// the staff member and the reason.
+func (s *service) CreateValueDatedAccount(ctx context.Context, staffID string, req *ValueDatedAccountRequest) (*BlockAccount, error) {
+	now := s.Now().UTC()
+	valueDate := req.ValueDate.UTC()
+	if valueDate.After(now) {
+		return nil, ErrValueDateInFuture
+	}
+	rates, err := s.ratePlan(ctx, tenantOf(ctx))
+	if err != nil {
+		return nil, err
+	}
+	term, err := rates.terms(req.Period)
+	if err != nil {
+		return nil, err
+	}
+	endDate := term.maturityDate(valueDate)
+	if !endDate.After(now) {
+		return nil, ErrValueDateMatured
+	}
+	if err := s.checkUserExists(ctx, req.UserID); err != nil {
+		return nil, err
+	}
+
+	frequency := req.PayoutFrequency
+	if frequency == "" {
+		frequency = FrequencyAtMaturity
+	}
+	account := &BlockAccount{
+		UserID:              req.UserID,
+		Principal:           roundMoney(req.Principal),
+		StartDate:           valueDate,
+		EndDate:             endDate,
+		InterestRate:        term.Rate,
+		Period:              req.Period,
+		Status:              StatusActive,
+		MaturityInstruction: InstructionPayout,
+		PayoutFrequency:     frequency,
+		TenantID:            tenantOf(ctx),
+		bookingNote:         fmt.Sprintf("value-dated %s by %s: %s", valueDate.Format(time.DateOnly), staffID, req.Reason),
+	}
+	account.NextPayoutDate = nextInterestPayoutDate(account, valueDate)
+	if err := s.assignExternalID(account); err != nil {
+		return nil, err
+	}
+
+	account, err = s.repo.CreateAccount(ctx, account, nil)
+	if err != nil {
+		s.log(ctx).Error("Failed to create value-dated block account", zap.Error(err))
+		return nil, err
+	}
+	if _, err := s.issueAgreement(ctx, account); err != nil {
+		s.log(ctx).Error("Failed to issue agreement", zap.Error(err), zap.Int("account_id", account.ID))
+	}
+	s.log(ctx).Info("Value-dated block account booked", zap.Int("accountID", account.ID), zap.String("staffID", staffID),
+		zap.Time("valueDate", valueDate), zap.String("reason", req.Reason))
+	account.AgreementURL = agreementLocation(account.ExternalID)
+	return account, nil
+}
+
+// createValueDatedAccountHandler godoc
+// @Summary Book a value-dated block account
+// @Description Books an active block account that opened before it is booked, for migrations and corrections. Its start date is value_date, from which its term is counted and its interest accrues; its created_at is when it was booked, and its history shows both. Interest payments that fell due since value_date are paid by the next interest payout run. No funding is debited, and product gates, minimum principals and account limits do not apply. value_date may not be in the future, nor so far back that the deposit would already have matured.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Staff-ID header string true "Staff member, set by the gateway"
+// @Param account body ValueDatedAccountRequest true "Account and its value date"
+// @Success 201 {object} BlockAccount
+// @Header 201 {string} Location "URL of the new account"
+// @Header 201 {string} ETag "Version of the account"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse "value_date is in the future or too far back, or the user does not exist"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse "The user service's circuit breaker is open"
+// @Router /v2/admin/block-account [post]
+func createValueDatedAccountHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	staffID := r.Header.Get(StaffIDHeader)
+	if staffID == "" {
+		writeErrorCode(w, http.StatusUnauthorized, CodeStaffIdentityRequired, "Staff identity required")
+		return
+	}
+
+	var req ValueDatedAccountRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+
+	account, err := svc.CreateValueDatedAccount(ctx, staffID, &req)
+	switch {
+	case err == ErrValueDateInFuture || err == ErrValueDateMatured:
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	case err == ErrUnknownUser:
+		writeErrorCode(w, http.StatusUnprocessableEntity, CodeUserNotFound, fmt.Sprintf("user %d does not exist", req.UserID))
+		return
+	case errors.Is(err, ErrCircuitOpen):
+		writeAPIError(w, http.StatusServiceUnavailable, err)
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	markWrite(w)
+	w.Header().Set("ETag", accountETag(r, account))
+	writeCreated(w, r, accountLocation(account.ExternalID), account, "Value-dated block account booked successfully")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValueDatedAccount(t *testing.T) {
+	api := newTestAPI(t)
+	now := time.Now().UTC()
+	valueDate := now.AddDate(0, -2, -1).Truncate(time.Second)
+
+	var account BlockAccount
+	api.create(http.MethodPost, "/v2/admin/block-account", `{"user_id":71,"principal":1200,"period":"1y",
+		"payout_frequency":"monthly","value_date":"`+valueDate.Format(time.RFC3339)+`","reason":"Opened at branch during outage"}`, &account)
+	if !account.StartDate.Equal(valueDate) || account.Status != StatusActive || account.CreatedAt.Before(now.Add(-time.Minute)) {
+		t.Fatalf("account = %+v, want active from %v and booked now", account, valueDate)
+	}
+
+	// The two payments that fell due since the value date are paid at once
+	paid, err := api.svc.ProcessInterestPayouts(context.Background(), now, 10)
+	if err != nil || paid != 2 {
+		t.Errorf("interest payouts = %d, %v, want the 2 due since the value date", paid, err)
+	}
+
+	var history AccountHistory
+	api.create(http.MethodGet, "/v2/block-account/"+account.ExternalID+"/history", "", &history)
+	opening := history.Entries[0]
+	if opening.ValueDate == nil || !opening.ValueDate.Equal(valueDate) || !strings.Contains(opening.Detail, "value-dated") ||
+		opening.At.Before(now.Add(-time.Minute)) {
+		t.Errorf("opening entry = %+v, want booked now and value-dated %v", opening, valueDate)
+	}
+
+	for name, body := range map[string]string{
+		"future":  `{"user_id":71,"principal":1200,"period":"1y","value_date":"` + now.AddDate(0, 0, 2).Format(time.RFC3339) + `","reason":"x"}`,
+		"matured": `{"user_id":71,"principal":1200,"period":"1y","value_date":"` + now.AddDate(-2, 0, 0).Format(time.RFC3339) + `","reason":"x"}`,
+	} {
+		if w := api.do(http.MethodPost, "/v2/admin/block-account", body); w.Code != http.StatusUnprocessableEntity || errorCode(w) != CodeInvalidValueDate {
+			t.Errorf("%s: %d %s", name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestValueDatedRecalculation(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	a := &BlockAccount{Principal: 1000, InterestRate: 0.05, Period: "1y", StartDate: start, EndDate: start.Add(365 * day)}
+	rates := ratePlan{"1y": 0.06}
+
+	// Unpaid interest before the value date keeps the old rate
+	valueDate := start.Add(73 * day)
+	adj, err := planRecalculation(a, rates, nil, nil, &valueDate)
+	if err != nil || adj.Amount != -2 || adj.Rate != 0.06 || !adj.ValueDate.Equal(valueDate) {
+		t.Errorf("unpaid = %+v, %v, want a 2.00 debit", adj, err)
+	}
+
+	// Interest paid since the value date is topped up to the new rate
+	paidThrough := start.Add(146 * day)
+	a.InterestPaidThrough = &paidThrough
+	if adj, err := planRecalculation(a, rates, nil, nil, &valueDate); err != nil || adj.Amount != 2 {
+		t.Errorf("paid = %+v, %v, want a 2.00 credit", adj, err)
+	}
+
+	if _, err := planRecalculation(a, ratePlan{"1y": 0.05}, nil, nil, &valueDate); err != ErrInterestUpToDate {
+		t.Errorf("same rate = %v", err)
+	}
+}
+
+func TestValueDatedAdjustment(t *testing.T) {
+	api := newTestAPI(t)
+	now := time.Now().UTC()
+	var account BlockAccount
+	api.create(http.MethodPost, "/v2/admin/block-account", `{"user_id":72,"principal":1000,"period":"1y",
+		"value_date":"`+now.AddDate(0, -3, 0).Format(time.RFC3339)+`","reason":"Migrated from core banking"}`, &account)
+	path := "/v2/admin/block-account/" + account.ExternalID + "/adjust"
+
+	for name, valueDate := range map[string]time.Time{"future": now.AddDate(0, 0, 1), "before start": now.AddDate(0, -4, 0)} {
+		body := `{"amount":5,"reason":"Goodwill credit","value_date":"` + valueDate.Format(time.RFC3339) + `"}`
+		if w := api.do(http.MethodPost, path, body); w.Code != http.StatusUnprocessableEntity || errorCode(w) != CodeInvalidValueDate {
+			t.Errorf("%s: %d %s", name, w.Code, w.Body)
+		}
+	}
+
+	valueDate := now.AddDate(0, -1, 0).Truncate(time.Second)
+	var approval Approval
+	api.create(http.MethodPost, path, `{"amount":5,"reason":"Goodwill credit","value_date":"`+valueDate.Format(time.RFC3339)+`"}`, &approval)
+	if approval.ValueDate == nil || !approval.ValueDate.Equal(valueDate) {
+		t.Fatalf("approval = %+v", approval)
+	}
+	if w := api.do(http.MethodPost, "/v2/admin/approvals/"+strconv.Itoa(approval.ID)+"/approve", `{}`, StaffIDHeader, "staff-2"); w.Code != http.StatusOK {
+		t.Fatalf("approve: %d %s", w.Code, w.Body)
+	}
+
+	var history AccountHistory
+	api.create(http.MethodGet, "/v2/block-account/"+account.ExternalID+"/history", "", &history)
+	last := history.Entries[len(history.Entries)-1]
+	if last.Type != HistoryAdjustment || last.ValueDate == nil || !last.ValueDate.Equal(valueDate) || last.At.Before(now) {
+		t.Errorf("adjustment entry = %+v, want booked now and value-dated %v", last, valueDate)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Versioning headers. Deprecation (RFC 9745) and Sunset (RFC 8594) are sent
+// on every response of a deprecated version, with a Link to its successor.
+const (
+	APIVersionHeader  = "API-Version"
+	DeprecationHeader = "Deprecation"
+	SunsetHeader      = "Sunset"
+)
+
+// currentAPIVersion is the version new clients are pointed at, and the one
+// links in responses are built for
+const currentAPIVersion = "v2"
+
+// apiVersionKey stores the name of the version serving a request
+const apiVersionKey ctxKey = "apiVersion"
+
+// unversionedDeprecatedAt is when the routes without a version prefix, kept
+// as aliases of v1 for existing clients, were deprecated
+var unversionedDeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// v1DeprecatedAt is when v2 shipped with 201 Created on creates and
+// paginated lists
+var v1DeprecatedAt = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// versionPrefix matches a version path segment such as "/v1"
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+(/|$)`)
+
+// apiVersion is one mounted version of the HTTP API. A version keeps its
+// routes, request and response shapes for its whole life; a breaking change
+// such as a new envelope or decimal money ships as the next version, and the
+// old one is deprecated with a sunset date once its successor is mounted.
+type apiVersion struct {
+	name   string
+	routes func(chi.Router)
+	// deprecatedAt, sunset and successor are set once a newer version ships
+	deprecatedAt time.Time
+	sunset       time.Time
+	successor    string
+}
+
+// apiVersions are mounted under /<name>, oldest first
+var apiVersions = []*apiVersion{
+	{name: "v1", routes: v1Routes, deprecatedAt: v1DeprecatedAt, successor: "v2"},
+	{name: "v2", routes: v1Routes},
+}
+
+// APIVersionInfo describes a mounted API version
+// @Description An API version and its deprecation schedule
+type APIVersionInfo struct {
+	Version string `json:"version" example:"v1"`
+	// Status is "current" or "deprecated"
+	Status       string     `json:"status" example:"current"`
+	DeprecatedAt *time.Time `json:"deprecated_at,omitempty"`
+	Sunset       *time.Time `json:"sunset,omitempty"`
+	Successor    string     `json:"successor,omitempty" example:"v2"`
+}
+
+// apiPath returns path under the current API version, for links in responses
+func apiPath(path string) string {
+	return "/" + currentAPIVersion + path
+}
+
+// unversionedPath strips a leading version segment, so checks on route
+// prefixes hold for every version and for the unversioned aliases
+func unversionedPath(path string) string {
+	if loc := versionPrefix.FindStringIndex(path); loc != nil {
+		return "/" + path[loc[1]:]
+	}
+	return path
+}
+
+// unversionedSunset returns UNVERSIONED_API_SUNSET, the date the routes
+// without a version prefix are removed, or the zero time when not yet decided
+func unversionedSunset() time.Time {
+	t, err := time.Parse(time.DateOnly, os.Getenv("UNVERSIONED_API_SUNSET"))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// mountAPIVersions mounts every API version under its prefix, and the
+// v1 routes without a prefix as deprecated aliases for existing clients.
+// v2 serves the v1 routes; the handlers shape their responses by the
+// version serving the request, see requestAPIVersion.
+func mountAPIVersions(r chi.Router) {
+	for _, v := range apiVersions {
+		r.Route("/"+v.name, func(r chi.Router) {
+			r.Use(versionHeaders(v.name, v.deprecatedAt, v.sunset, v.successor))
+			v.routes(r)
+		})
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(versionHeaders("v1", unversionedDeprecatedAt, unversionedSunset(), "v1"))
+		v1Routes(r)
+	})
+	r.Get("/versions", listAPIVersionsHandler)
+}
+
+// versionHeaders names the version serving each response and, for a
+// deprecated one, when it was deprecated, when it goes away and where the
+// same route lives in its successor. It stores the version's name in the
+// request context.
+func versionHeaders(name string, deprecatedAt, sunset time.Time, successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(APIVersionHeader, name)
+			if !deprecatedAt.IsZero() {
+				w.Header().Set(DeprecationHeader, "@"+strconv.FormatInt(deprecatedAt.Unix(), 10))
+				if !sunset.IsZero() {
+					w.Header().Set(SunsetHeader, sunset.UTC().Format(http.TimeFormat))
+				}
+				if successor != "" {
+					w.Header().Add("Link", `</`+successor+unversionedPath(r.URL.Path)+`>; rel="successor-version"`)
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey, name)))
+		})
+	}
+}
+
+// requestAPIVersion returns the name of the API version serving r, v1 for
+// the routes outside any version
+func requestAPIVersion(r *http.Request) string {
+	if name, ok := r.Context().Value(apiVersionKey).(string); ok {
+		return name
+	}
+	return "v1"
+}
+
+// v1Routes registers the routes of API versions 1 and 2
+func v1Routes(r chi.Router) {
+	r.Get("/products", listProductsHandler)
+	r.Get("/products/compare", compareProductsHandler)
+	r.Get("/features", listFeaturesHandler)
+
+	// Back-office bulk loading, closed to impersonation sessions
+	r.Post("/block-account/bulk", bulkCreateHandler)
+	r.Get("/block-account/bulk/{id}", getAccountImportHandler)
+	r.Get("/jobs/{id}", getJobHandler)
+	r.Post("/jobs/{id}/cancel", cancelJobHandler)
+
+	// API routes, which impersonation sessions may only use for their customer
+	r.Group(func(r chi.Router) {
+		r.Use(ImpersonationScopeMiddleware)
+		r.Use(ActingUserMiddleware)
+		r.Post("/block-account", createBlockAccountHandler)
+		r.Get("/block-account/{id}", getBlockAccountHandler)
+		r.Get("/user/{userID}/block-accounts", getUserBlockAccountsHandler)
+		r.Get("/user/{userID}/block-accounts/events", streamUserEventsHandler)
+		r.Get("/user/{userID}/portfolio", getUserPortfolioHandler)
+		r.Get("/user/{userID}/tax-certificate", getTaxCertificateHandler)
+		r.Get("/user/{userID}/notification-preferences", getNotificationPreferencesHandler)
+		r.Put("/user/{userID}/notification-preferences", setNotificationPreferencesHandler)
+		r.Post("/block-account/{id}/close", closeBlockAccountHandler)
+		r.Put("/block-account/{id}/maturity-instruction", changeMaturityInstructionHandler)
+		r.Get("/block-account/{id}/communications", getAccountCommunicationsHandler)
+		r.Get("/block-account/{id}/payout-schedule", getPayoutScheduleHandler)
+		r.Get("/block-account/{id}/history", getAccountHistoryHandler)
+		r.Get("/block-account/{id}/agreement", getAgreementHandler)
+		r.Put("/block-account/{id}/notification-mute", muteNotificationsHandler)
+		r.Delete("/block-account/{id}/notification-mute", unmuteNotificationsHandler)
+		r.Get("/block-account/{id}/notification-mutes", getNotificationMutesHandler)
+		r.Get("/block-account/{id}/holders", listAccountHoldersHandler)
+		r.Post("/block-account/{id}/holders", addAccountHolderHandler)
+		r.Delete("/block-account/{id}/holders/{userID}", removeAccountHolderHandler)
+		r.Get("/block-account/{id}/beneficiaries", getBeneficiariesHandler)
+		r.Put("/block-account/{id}/beneficiaries", setBeneficiariesHandler)
+		r.Delete("/block-account/{id}/beneficiaries", removeBeneficiariesHandler)
+	})
+
+	// Removing an account's data is a staff tool, not a customer route
+	r.Delete("/block-account/{id}", deleteBlockAccountHandler)
+
+	// Webhook routes
+	r.Post("/webhooks", createWebhookHandler)
+	r.Delete("/webhooks/{id}", deleteWebhookHandler)
+	r.Get("/webhooks/{id}/deliveries", getWebhookDeliveriesHandler)
+
+	// Admin routes
+	r.Post("/admin/block-account", createValueDatedAccountHandler)
+	r.Post("/admin/block-account/{id}/payout/sent", confirmPayoutHandler)
+	r.Post("/admin/block-account/{id}/payout/failure", failPayoutHandler)
+	r.Post("/admin/block-account/{id}/payout/retry", retryPayoutHandler)
+	r.Post("/admin/block-account/{id}/recalculate", recalculateInterestHandler)
+	r.Post("/admin/block-account/{id}/adjust", adjustInterestHandler)
+	r.Get("/admin/block-accounts/maturing-soon", getMaturingSoonHandler)
+	r.Get("/admin/maturities", getMaturityCalendarHandler)
+	r.Get("/admin/stats", portfolioStatsHandler)
+	r.Post("/admin/analysis/rate-scenario", rateScenarioHandler)
+	r.Post("/admin/webhooks/{id}/replay", replayWebhookDeliveriesHandler)
+	r.Post("/admin/impersonations", startImpersonationHandler)
+	r.Get("/admin/impersonations/{id}", getImpersonationHandler)
+	r.Delete("/admin/impersonations/{id}", endImpersonationHandler)
+	r.Get("/admin/product-gates", listProductGatesHandler)
+	r.Put("/admin/product-gates/{product}", setProductGateHandler)
+	r.Delete("/admin/product-gates/{product}", deleteProductGateHandler)
+	r.Get("/admin/limits", listAccountLimitsHandler)
+	r.Put("/admin/limits/{rule}", setAccountLimitHandler)
+	r.Delete("/admin/limits/{rule}", deleteAccountLimitHandler)
+	r.Get("/admin/approvals", listApprovalsHandler)
+	r.Post("/admin/approvals", requestApprovalHandler)
+	r.Get("/admin/approvals/{id}", getApprovalHandler)
+	r.Post("/admin/approvals/{id}/approve", approveHandler)
+	r.Post("/admin/approvals/{id}/reject", rejectHandler)
+	r.Get("/admin/compliance/flags", listComplianceFlagsHandler)
+	r.Post("/admin/compliance/flags/{id}/review", reviewComplianceFlagHandler)
+	r.Get("/admin/reconciliation/breaks", listReconciliationBreaksHandler)
+	r.Post("/admin/reconciliation/breaks/{id}/acknowledge", acknowledgeReconciliationBreakHandler)
+	r.Post("/admin/api-keys", issueAPIKeyHandler)
+	r.Get("/admin/api-keys", listAPIKeysHandler)
+	r.Post("/admin/api-keys/{id}/rotate", rotateAPIKeyHandler)
+	r.Delete("/admin/api-keys/{id}", revokeAPIKeyHandler)
+	r.Get("/admin/rates", listTenantRatesHandler)
+	r.Put("/admin/rates/{period}", setTenantRateHandler)
+	r.Delete("/admin/rates/{period}", deleteTenantRateHandler)
+	r.Get("/admin/archive/block-account/{id}", getArchivedAccountHandler)
+
+	// Admin routes acting on the whole platform, closed to tenant-bound callers
+	r.Group(func(r chi.Router) {
+		r.Use(PlatformOnlyMiddleware)
+		r.Post("/admin/maturity/run", runMaturityHandler)
+		r.Post("/admin/block-accounts/batch-action", batchActionHandler)
+		r.Get("/admin/dashboard", dashboardHandler)
+		r.Post("/admin/reports/{type}/run", runReportHandler)
+		r.Get("/admin/reports/{type}/{date}", getReportHandler)
+		r.Get("/admin/cache/stats", cacheStatsHandler)
+		r.Get("/admin/events", listEventLogHandler)
+		r.Post("/admin/events/rebuild", rebuildProjectionHandler)
+		r.Post("/admin/events/replay", replayEventsHandler)
+		r.Get("/admin/events/replay/{id}", getEventReplayHandler)
+		r.Get("/admin/region", getRegionHandler)
+		r.Post("/admin/region/promote", promoteRegionHandler)
+		r.Get("/admin/tenants", listTenantsHandler)
+		r.Post("/admin/tenants", createTenantHandler)
+		r.Get("/admin/products", listProductDefinitionsHandler)
+		r.Put("/admin/products/{code}", saveProductDefinitionHandler)
+		r.Delete("/admin/products/{code}", retireProductHandler)
+		r.Get("/admin/export/block-accounts", exportAccountsHandler)
+		r.Get("/admin/feature-flags", listFeatureFlagsHandler)
+		r.Put("/admin/feature-flags/{name}", setFeatureFlagHandler)
+		r.Delete("/admin/feature-flags/{name}", deleteFeatureFlagHandler)
+		r.Get("/admin/scheduler/jobs", listScheduledJobsHandler)
+		r.Post("/admin/scheduler/jobs/{job}/trigger", triggerScheduledJobHandler)
+		r.Post("/admin/scheduler/jobs/{job}/pause", pauseScheduledJobHandler)
+		r.Post("/admin/scheduler/jobs/{job}/resume", resumeScheduledJobHandler)
+		if sandboxMode() {
+			r.Post("/admin/sandbox/advance-time", advanceTimeHandler)
+		}
+	})
+}
+
+// listAPIVersionsHandler godoc
+// @Summary List API versions
+// @Description Every mounted API version with its deprecation date, sunset date and successor. Routes without a version prefix are deprecated aliases of v1.
+// @Tags meta
+// @Produce json
+// @Success 200 {array} APIVersionInfo
+// @Router /versions [get]
+func listAPIVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	versions := make([]APIVersionInfo, 0, len(apiVersions))
+	for _, v := range apiVersions {
+		info := APIVersionInfo{Version: v.name, Status: "current", Successor: v.successor}
+		if !v.deprecatedAt.IsZero() {
+			deprecatedAt := v.deprecatedAt
+			info.Status, info.DeprecatedAt = "deprecated", &deprecatedAt
+		}
+		if !v.sunset.IsZero() {
+			sunset := v.sunset
+			info.Sunset = &sunset
+		}
+		versions = append(versions, info)
+	}
+	writeSuccess(w, r, versions, "API versions retrieved successfully")
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+)
+
+// Webhook delivery retry policy: exponential backoff from webhookRetryBase,
+// capped at webhookRetryMax, giving up after webhookMaxAttempts
+const (
+	webhookMaxAttempts = 10
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = 6 * time.Hour
+	// webhookLease is how long a claimed delivery is hidden from other
+	// workers; a worker that dies mid-delivery is retried after it expires
+	webhookLease   = 2 * time.Minute
+	webhookTimeout = 10 * time.Second
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// webhookEvents are the events a webhook can subscribe to on each channel
+var webhookEvents = map[string]map[string]bool{
+	ChannelAccount: {
+		EventAccountCreated:       true,
+		EventAccountMatured:       true,
+		EventAccountClosed:        true,
+		EventAccountFunded:        true,
+		EventAccountFundingFailed: true,
+		EventAccountStatusChanged: true,
+		EventInterestPaid:         true,
+	},
+	ChannelOperations: {
+		EventJobFailed:           true,
+		EventReconciliationBreak: true,
+		EventWebhookDeadLettered: true,
+		EventConfigChanged:       true,
+		EventApprovalRequested:   true,
+		EventRegionFailover:      true,
+	},
+}
+
+// Webhook is a callback URL subscribed to account lifecycle or operational events
+// @Description Callback URL subscribed to account lifecycle or operational events. The secret is only returned on creation.
+type Webhook struct {
+	ID  int    `json:"id" example:"1"`
+	URL string `json:"url" example:"https://example.com/hooks/block-account"`
+	// Channel is "account" for lifecycle events or "operations" for operational events
+	Channel   string    `json:"channel" example:"account"`
+	Events    []string  `json:"events" example:"account.created,account.matured"`
+	Secret    string    `json:"secret,omitempty" example:"4f1c9e0b..."`
+	Active    bool      `json:"active" example:"true"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWebhookRequest registers a webhook
+// @Description Request payload for registering a webhook
+type CreateWebhookRequest struct {
+	URL string `json:"url" example:"https://example.com/hooks/block-account" validate:"http_url"`
+	// Channel defaults to "account"
+	Channel string   `json:"channel,omitempty" example:"account" validate:"omitempty,oneof=account operations"` // "account", "operations"
+	Events  []string `json:"events" example:"account.created,account.matured,account.closed" validate:"min=1"`
+}
+
+// WebhookDelivery is one event queued for one webhook
+// @Description Delivery of one event to one webhook and its attempts so far
+type WebhookDelivery struct {
+	ID             int               `json:"id" example:"1"`
+	WebhookID      int               `json:"webhook_id" example:"1"`
+	EventID        string            `json:"event_id" example:"0b0e0a52-1f7b-4a1f-9a56-3c3f0f1f2a6b"`
+	EventType      string            `json:"event_type" example:"account.created"`
+	Payload        json.RawMessage   `json:"payload" swaggertype:"object"`
+	Status         string            `json:"status" example:"failed"`
+	Attempts       int               `json:"attempts" example:"10"`
+	NextAttemptAt  time.Time         `json:"next_attempt_at"`
+	LastStatusCode int               `json:"last_status_code,omitempty" example:"503"`
+	LastError      string            `json:"last_error,omitempty" example:"unexpected status 503 Service Unavailable"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	AttemptLog     []*WebhookAttempt `json:"attempt_log"`
+
+	// Destination, filled in when a delivery is claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookAttempt records one HTTP call made for a delivery
+// @Description One HTTP call made to deliver a webhook
+type WebhookAttempt struct {
+	ID          int       `json:"id" example:"1"`
+	DeliveryID  int       `json:"delivery_id" example:"1"`
+	Attempt     int       `json:"attempt" example:"1"`
+	StatusCode  int       `json:"status_code,omitempty" example:"200"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms" example:"120"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// validateCreateWebhookRequest validates a webhook registration
+func validateCreateWebhookRequest(req *CreateWebhookRequest) error {
+	if req.Channel == "" {
+		req.Channel = ChannelAccount
+	}
+	events := webhookEvents[req.Channel]
+	for _, event := range req.Events {
+		if events[event] {
+			continue
+		}
+		if req.Channel == ChannelOperations {
+			return fmt.Errorf("invalid event: %s. Valid options are: job.failed, reconciliation.break, webhook.dead_lettered, config.changed, approval.requested, region.failover", event)
+		}
+		return fmt.Errorf("invalid event: %s. Valid options are: account.created, account.matured, account.closed, account.funded, account.funding_failed", event)
+	}
+	return nil
+}
+
+// newWebhookSecret returns a random signing secret
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// signWebhook signs "<timestamp>.<body>" with the webhook's secret. Receivers
+// recompute it to authenticate the delivery and reject stale timestamps.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before retrying after the given attempt
+func webhookBackoff(attempt int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempt && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// CreateWebhook registers a webhook with a freshly generated signing secret
+func (s *service) CreateWebhook(ctx context.Context, req *CreateWebhookRequest) (*Webhook, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := s.repo.CreateWebhook(ctx, &Webhook{URL: req.URL, Channel: req.Channel, Events: req.Events, Secret: secret, Active: true})
+	if err != nil {
+		s.log(ctx).Error("Failed to create webhook", zap.Error(err))
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook along with its delivery history
+func (s *service) DeleteWebhook(ctx context.Context, id int) error {
+	if err := s.repo.DeleteWebhook(ctx, id); err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to delete webhook", zap.Error(err), zap.Int("id", id))
+		}
+		return err
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the webhook's most recent deliveries with
+// their attempt logs, or nil when the webhook does not exist
+func (s *service) GetWebhookDeliveries(ctx context.Context, webhookID int) ([]*WebhookDelivery, error) {
+	webhook, err := s.repo.GetWebhook(ctx, webhookID)
+	if err != nil {
+		s.log(ctx).Error("Failed to get webhook", zap.Error(err), zap.Int("id", webhookID))
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, nil
+	}
+
+	deliveries, err := s.repo.ListWebhookDeliveries(ctx, webhookID, 100)
+	if err != nil {
+		s.log(ctx).Error("Failed to list webhook deliveries", zap.Error(err), zap.Int("id", webhookID))
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []*WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDeliveries re-queues the webhook's failed deliveries for
+// immediate delivery with a fresh retry budget
+func (s *service) ReplayWebhookDeliveries(ctx context.Context, webhookID int) (int, error) {
+	n, err := s.repo.ReplayWebhookDeliveries(ctx, webhookID, time.Now().UTC())
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.log(ctx).Error("Failed to replay webhook deliveries", zap.Error(err), zap.Int("id", webhookID))
+		}
+		return 0, err
+	}
+	return n, nil
+}
+
+// DeliverWebhooks sends due deliveries until none are left and returns how
+// many were attempted
+func (s *service) DeliverWebhooks(ctx context.Context, client *http.Client, batchSize int) (int, error) {
+	total := 0
+	for {
+		deliveries, err := s.repo.ClaimWebhookDeliveries(ctx, time.Now().UTC(), webhookLease, batchSize)
+		if err != nil {
+			s.log(ctx).Error("Failed to claim webhook deliveries", zap.Error(err))
+			return total, err
+		}
+		for _, d := range deliveries {
+			attempt := sendWebhook(ctx, client, d)
+			if err := s.repo.RecordWebhookAttempt(ctx, d, attempt); err != nil {
+				s.log(ctx).Error("Failed to record webhook attempt", zap.Error(err), zap.Int("deliveryID", d.ID))
+				return total, err
+			}
+			if d.Status == DeliveryFailed {
+				s.notify(ctx, func(n Notifier) error {
+					return n.NotifyOperations(ctx, "Webhook delivery failed",
+						fmt.Sprintf("Delivery %d of %s to webhook %d gave up after %d attempts: %s",
+							d.ID, d.EventID, d.WebhookID, d.Attempts, d.LastError))
+				})
+				// An operational delivery that dead-letters is not reported on
+				// the same channel, or an unreachable receiver would loop
+				if !webhookEvents[ChannelOperations][d.EventType] {
+					s.emitOperational(ctx, EventWebhookDeadLettered, SeverityWarning,
+						fmt.Sprintf("Webhook %d delivery %d dead-lettered", d.WebhookID, d.ID),
+						map[string]any{"webhook_id": d.WebhookID, "delivery_id": d.ID, "event_id": d.EventID,
+							"event_type": d.EventType, "attempts": d.Attempts, "last_error": d.LastError})
+				}
+			}
+			total++
+		}
+		if len(deliveries) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// sendWebhook makes one signed delivery attempt and advances d to its next
+// state: succeeded, retry later with backoff, or failed for good
+func sendWebhook(ctx context.Context, client *http.Client, d *WebhookDelivery) *WebhookAttempt {
+	started := time.Now()
+	d.Attempts++
+	attempt := &WebhookAttempt{DeliveryID: d.ID, Attempt: d.Attempts, AttemptedAt: started.UTC()}
+
+	timestamp := strconv.FormatInt(started.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "block-account-webhooks/1")
+		req.Header.Set(WebhookEventHeader, d.EventType)
+		req.Header.Set(WebhookDeliveryHeader, d.EventID)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, signWebhook(d.Secret, timestamp, d.Payload))
+
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			attempt.StatusCode = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("unexpected status %s", resp.Status)
+			}
+		}
+	}
+	attempt.DurationMs = time.Since(started).Milliseconds()
+
+	d.LastStatusCode = attempt.StatusCode
+	switch {
+	case err == nil:
+		d.Status = DeliverySucceeded
+		d.LastError = ""
+	case d.Attempts >= webhookMaxAttempts:
+		attempt.Error = err.Error()
+		d.Status = DeliveryFailed
+		d.LastError = attempt.Error
+	default:
+		attempt.Error = err.Error()
+		d.Status = DeliveryPending
+		d.LastError = attempt.Error
+		d.NextAttemptAt = time.Now().Add(webhookBackoff(d.Attempts)).UTC()
+	}
+	return attempt
+}
+
+// createWebhookHandler godoc
+// @Summary Register a webhook
+// @Description Subscribes a callback URL to account lifecycle events, or with channel "operations" to operational events (job.failed, reconciliation.break, webhook.dead_lettered, config.changed, approval.requested, region.failover). Deliveries are POSTed as JSON and signed with HMAC-SHA256 over "<X-Webhook-Timestamp>.<body>" in X-Webhook-Signature; the secret is returned only in this response.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body CreateWebhookRequest true "Webhook registration"
+// @Success 201 {object} Webhook
+// @Header 201 {string} Location "URL of the webhook"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/webhooks [post]
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	var req CreateWebhookRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	if err := validateCreateWebhookRequest(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	webhook, err := svc.CreateWebhook(ctx, &req)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeCreated(w, r, apiPath("/webhooks/"+strconv.Itoa(webhook.ID)), webhook, "Webhook registered successfully")
+}
+
+// deleteWebhookHandler godoc
+// @Summary Delete a webhook
+// @Description Unsubscribes a webhook and discards its pending deliveries
+// @Tags webhooks
+// @Param id path int true "Webhook ID" Format(int64)
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/webhooks/{id} [delete]
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := svc.DeleteWebhook(ctx, id); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getWebhookDeliveriesHandler godoc
+// @Summary List webhook deliveries
+// @Description Lists the webhook's 100 most recent deliveries, newest first, each with its log of delivery attempts
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID" Format(int64)
+// @Param limit query int false "Page size (1-200)" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} Page{items=[]WebhookDelivery}
+// @Header 200 {string} Link "URL of the next page, rel=next"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/webhooks/{id}/deliveries [get]
+func getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	page, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	deliveries, err := svc.GetWebhookDeliveries(ctx, id)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if deliveries == nil {
+		writeError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	writeList(w, r, page, deliveries, "Webhook deliveries retrieved successfully")
+}
+
+// replayWebhookDeliveriesHandler godoc
+// @Summary Replay failed webhook deliveries
+// @Description Re-queues every failed delivery of the webhook for immediate delivery with a fresh retry budget
+// @Tags admin
+// @Produce json
+// @Param id path int true "Webhook ID" Format(int64)
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /v2/admin/webhooks/{id}/replay [post]
+func replayWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	svc, ok := r.Context().Value(ServiceKey).(BlockAccountService)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Service not available")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	ctx := r.Context()
+
+	n, err := svc.ReplayWebhookDeliveries(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Webhook not found")
+			return
+		}
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeSuccess(w, r, map[string]int{"replayed": n}, "Failed deliveries queued for replay")
+}